@@ -0,0 +1,264 @@
+// Package analysis turns text into the tokens that get indexed and searched for.
+//
+// An Analyzer is anything that does that. Standard is the default pipeline:
+// it splits text on word boundaries, lowercases, drops stopwords and stems with the
+// English snowball stemmer, with a few opt-in steps and a choice of languages and
+// stemmers. Chain builds custom pipelines out of a Tokenizer and a list of
+// TokenFilters.
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Whatever analyzer an index was built with has to be used for its queries too,
+// otherwise the terms won't line up.
+type Analyzer interface {
+	Analyze(text string) []string
+}
+
+// Default is the analyzer used when none is given.
+var Default Analyzer = &Standard{}
+
+// Analysis stages
+// Analyzers that can also report the tokens after every step implement Stager, so
+// a frontend can show how a query is going to be interpreted.
+type Stage struct {
+	Stage  string   `json:"stage"`
+	Tokens []string `json:"tokens"`
+}
+
+type Stager interface {
+	Stages(text string) []Stage
+}
+
+// Stages runs a through its stages when it can, otherwise it reports the final
+// tokens only.
+func Stages(a Analyzer, text string) []Stage {
+	if s, ok := a.(Stager); ok {
+		return s.Stages(text)
+	}
+	return []Stage{{"final", a.Analyze(text)}}
+}
+
+// Exact forms
+// An index that keeps the words as they were besides their stems, to rank exact
+// matches higher, analyzes the text once more without the stemmer. Analyzers that
+// can leave it out implement Unstemmer.
+type Unstemmer interface {
+	Unstemmed() Analyzer
+}
+
+// Tokenizers and filters
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+type TokenizerFunc func(text string) []string
+
+func (f TokenizerFunc) Tokenize(text string) []string { return f(text) }
+
+type TokenFilter interface {
+	Filter(tokens []string) []string
+}
+
+type FilterFunc func(tokens []string) []string
+
+func (f FilterFunc) Filter(tokens []string) []string { return f(tokens) }
+
+// A filter with a name shows up under it in Stages.
+type namedFilter struct {
+	name string
+	fn   func([]string) []string
+}
+
+func (f namedFilter) Filter(tokens []string) []string { return f.fn(tokens) }
+
+func (f namedFilter) Name() string { return f.name }
+
+// Named gives a filter a name for Stages.
+func Named(name string, f TokenFilter) TokenFilter {
+	return namedFilter{name, f.Filter}
+}
+
+var (
+	WordTokenizer    Tokenizer = TokenizerFunc(Tokenize)
+	UnicodeTokenizer Tokenizer = TokenizerFunc(SegmentWords)
+	CJKTokenizer     Tokenizer = TokenizerFunc(CJKBigrams)
+
+	Lowercase        TokenFilter = namedFilter{"lowercase", LowercaseFilter}
+	EnglishStopwords TokenFilter = namedFilter{"stopwords", StopwordFilter}
+	Stemmer          TokenFilter = namedFilter{"stem", StemmerFilter}
+	ScriptBoundaries TokenFilter = namedFilter{"scripts", ScriptBoundaryFilter}
+)
+
+// StopFilter drops the words in s.
+func StopFilter(s StopwordSet) TokenFilter {
+	return namedFilter{"stopwords", s.Filter}
+}
+
+// Chain
+// A tokenizer followed by filters, run in order, after the char filters. A nil
+// Tokenizer splits on word boundaries like the standard analyzer.
+//
+//	a := &analysis.Chain{Filters: []analysis.TokenFilter{analysis.Lowercase}}
+//
+// is the standard pipeline without stopwords and stemming.
+type Chain struct {
+	CharFilters []CharFilter
+	Tokenizer   Tokenizer
+	Filters     []TokenFilter
+}
+
+func (c *Chain) tokenizer() Tokenizer {
+	if c.Tokenizer == nil {
+		return WordTokenizer
+	}
+	return c.Tokenizer
+}
+
+func (c *Chain) Analyze(text string) []string {
+	for _, f := range c.CharFilters {
+		text = f.FilterText(text)
+	}
+	tokens := c.tokenizer().Tokenize(text)
+	for _, f := range c.Filters {
+		tokens = f.Filter(tokens)
+	}
+	return tokens
+}
+
+func (c *Chain) Stages(text string) []Stage {
+	var stages []Stage
+	for i, f := range c.CharFilters {
+		text = f.FilterText(text)
+
+		name := fmt.Sprintf("charfilter%d", i)
+		if n, ok := f.(interface{ Name() string }); ok {
+			name = n.Name()
+		}
+		stages = append(stages, Stage{name, []string{text}})
+	}
+
+	tokens := c.tokenizer().Tokenize(text)
+	stages = append(stages, Stage{"tokenize", tokens})
+
+	for i, f := range c.Filters {
+		tokens = f.Filter(tokens)
+
+		name := fmt.Sprintf("filter%d", i)
+		if n, ok := f.(interface{ Name() string }); ok {
+			name = n.Name()
+		}
+		stages = append(stages, Stage{name, tokens})
+	}
+
+	return append(stages, Stage{"final", tokens})
+}
+
+// Per-field analyzers
+// PerField picks an analyzer by field name and falls back to Default (or the
+// package Default) for fields it doesn't list.
+type PerField struct {
+	Default Analyzer
+	Fields  map[string]Analyzer
+}
+
+func (p *PerField) For(field string) Analyzer {
+	if a, ok := p.Fields[field]; ok {
+		return a
+	}
+	if p.Default != nil {
+		return p.Default
+	}
+	return Default
+}
+
+func (p *PerField) Analyze(text string) []string {
+	return p.For("").Analyze(text)
+}
+
+// ForField is the analyzer a uses for field: the field's own if a is a PerField,
+// a itself otherwise.
+func ForField(a Analyzer, field string) Analyzer {
+	if p, ok := a.(*PerField); ok {
+		return p.For(field)
+	}
+	return a
+}
+
+// Languages
+// Documents can say which language they are in (index.Document.Language). An
+// analyzer that handles languages differently implements LanguageAnalyzer and
+// returns its variant for one; Standard does, switching stemmer and stopwords.
+type LanguageAnalyzer interface {
+	ForLanguage(lang string) Analyzer
+}
+
+// ForLanguage is the analyzer a uses for text in lang: its variant if a is a
+// LanguageAnalyzer, a itself otherwise or if lang is empty.
+func ForLanguage(a Analyzer, lang string) Analyzer {
+	if l, ok := a.(LanguageAnalyzer); ok && lang != "" {
+		return l.ForLanguage(lang)
+	}
+	return a
+}
+
+// Language is the language a analyzes for unless told otherwise: English for
+// the standard analyzer without a Language, "" if a doesn't say.
+func Language(a Analyzer) string {
+	switch a := a.(type) {
+	case *Standard:
+		if a.Language == "" {
+			return "en"
+		}
+		return strings.ToLower(a.Language)
+	case *PerField:
+		return Language(a.For(""))
+	}
+	return ""
+}
+
+// Registry
+// Analyzers can be registered under a name so they can be picked in configuration
+// or over HTTP. "standard", "simple" (lowercased words), "whitespace", and
+// "unicode" and "cjk" (the standard pipeline with Unicode word boundaries or CJK
+// bigrams) are there from the start.
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Analyzer{
+		"standard":   Default,
+		"simple":     &Chain{Filters: []TokenFilter{Lowercase}},
+		"whitespace": &Chain{Tokenizer: TokenizerFunc(strings.Fields)},
+		"unicode":    &Standard{Segmentation: SegmentUnicode},
+		"cjk":        &Standard{Segmentation: SegmentCJK},
+	}
+)
+
+func Register(name string, a Analyzer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = a
+}
+
+func Lookup(name string) (Analyzer, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	a, ok := registry[name]
+	return a, ok
+}
+
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	r := make([]string, 0, len(registry))
+	for name := range registry {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
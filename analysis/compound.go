@@ -0,0 +1,109 @@
+package analysis
+
+import "unicode/utf8"
+
+// Compound words
+// German, Dutch and the Nordic languages write compounds as one word, so a
+// search for "schiff" misses "Donaudampfschifffahrt". A Decompounder adds the
+// words of its dictionary found inside a longer token after the token itself:
+// with donau, dampf, schiff and fahrt, "donaudampfschifffahrt" is also indexed
+// as those four. Linking letters, like the s of "arbeitsamt", are skipped over,
+// since the parts are looked for anywhere in the token rather than one after the
+// other.
+//
+// Standard.Decompound runs one after stopwords and before stemming, so the
+// dictionary holds lowercase, unstemmed words and the parts are stemmed like any
+// other token; in Standard.Filters it's the step FilterDecompound. Every part
+// takes a position of its own, like an n-gram, so phrases across a compound
+// don't line up.
+//
+//	d, _ := analysis.LoadDecompounder("de-words.txt")
+//	a := &analysis.Standard{Language: "de", Decompound: d}
+type Decompounder struct {
+	Words map[string]struct{}
+
+	// Tokens shorter than MinWordSize characters aren't split, and only parts of
+	// MinSubwordSize to MaxSubwordSize characters are looked for; 0 means 5, 2
+	// and 15. OnlyLongestMatch keeps only the longest part starting at each
+	// character, so "schifffahrt" in the dictionary hides its "schiff".
+	MinWordSize      int
+	MinSubwordSize   int
+	MaxSubwordSize   int
+	OnlyLongestMatch bool
+}
+
+const FilterDecompound = "decompound"
+
+func NewDecompounder(words ...string) *Decompounder {
+	return &Decompounder{Words: NewStopwordSet(words...)}
+}
+
+// LoadDecompounder reads a dictionary in the format of LoadStopwords.
+func LoadDecompounder(path string) (*Decompounder, error) {
+	words, err := LoadStopwords(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Decompounder{Words: words}, nil
+}
+
+func (d *Decompounder) Name() string { return FilterDecompound }
+
+func (d *Decompounder) Filter(tokens []string) []string {
+	minWord, minSub, maxSub := d.sizes()
+	r := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		r = append(r, token)
+		if utf8.RuneCountInString(token) < minWord {
+			continue
+		}
+		r = d.split(r, token, minSub, maxSub)
+	}
+	return r
+}
+
+// split appends the dictionary words inside token, by where they start.
+func (d *Decompounder) split(dst []string, token string, minSub, maxSub int) []string {
+	for i := range token {
+		if !utf8.RuneStart(token[i]) {
+			continue
+		}
+		longest := ""
+		n := 0
+		for j := i; j < len(token) && n < maxSub; {
+			_, size := utf8.DecodeRuneInString(token[j:])
+			j += size
+			n++
+			part := token[i:j]
+			if n < minSub || len(part) == len(token) {
+				continue
+			}
+			if _, ok := d.Words[part]; !ok {
+				continue
+			}
+			if d.OnlyLongestMatch {
+				longest = part
+			} else {
+				dst = append(dst, part)
+			}
+		}
+		if longest != "" {
+			dst = append(dst, longest)
+		}
+	}
+	return dst
+}
+
+func (d *Decompounder) sizes() (minWord, minSub, maxSub int) {
+	minWord, minSub, maxSub = d.MinWordSize, d.MinSubwordSize, d.MaxSubwordSize
+	if minWord <= 0 {
+		minWord = 5
+	}
+	if minSub <= 0 {
+		minSub = 2
+	}
+	if maxSub <= 0 {
+		maxSub = 15
+	}
+	return minWord, minSub, maxSub
+}
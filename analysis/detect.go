@@ -0,0 +1,259 @@
+package analysis
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Language detection
+// DetectLanguage guesses the ISO 639-1 code of the language a text is in, so
+// documents that don't say can still get the stemmer and stopwords of their
+// language. A script that only one language we know is written in decides on its
+// own: Cyrillic is taken for Russian, Greek for Greek, kana for Japanese, Hangul
+// for Korean, Han for Chinese, and Arabic and Hebrew for those. Latin text is told
+// apart by its letter trigrams, with the words padded by spaces so their first and
+// last letters count, scored naive Bayes style against profiles built from a
+// paragraph of sample text per language (see samples).
+//
+// A paragraph is not much to go on, so a guess needs a few words: a Latin text
+// with fewer than minDetectLetters letters, or whose best language is not
+// clearly ahead of the next, gets "", as does a text without a script that most
+// of its letters are in. Close languages like Swedish and Norwegian are only
+// told apart on longer texts.
+func DetectLanguage(text string) string {
+	letters := 0
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range detectScripts {
+			if unicode.Is(s.table, r) {
+				scripts[s.lang]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// Han is written in Japanese too, so any kana makes it Japanese.
+	if scripts["ja"] > 0 && scripts["ja"]+scripts["zh"] > letters/2 {
+		return "ja"
+	}
+	lang, most := "", 0
+	for l, n := range scripts {
+		if n > most || (n == most && l < lang) {
+			lang, most = l, n
+		}
+	}
+	if most <= letters/2 {
+		return ""
+	}
+	if lang != "latin" {
+		return lang
+	}
+	if letters < minDetectLetters {
+		return ""
+	}
+	return detectLatin(text)
+}
+
+// DetectableLanguages lists the languages DetectLanguage can return.
+func DetectableLanguages() []string {
+	var r []string
+	for _, s := range detectScripts {
+		if s.lang != "latin" && !slices.Contains(r, s.lang) {
+			r = append(r, s.lang)
+		}
+	}
+	for lang := range samples {
+		r = append(r, lang)
+	}
+	sort.Strings(r)
+	return r
+}
+
+const minDetectLetters = 12
+
+// minDetectMargin is how much more likely, per trigram and in log terms, the best
+// language has to be than the next.
+const minDetectMargin = 0.05
+
+var detectScripts = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"latin", unicode.Latin},
+	{"ru", unicode.Cyrillic},
+	{"el", unicode.Greek},
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+}
+
+type profile struct {
+	counts map[string]int
+	total  int
+}
+
+var (
+	profilesOnce sync.Once
+	profiles     map[string]profile
+	vocabulary   int // distinct trigrams over all profiles, for smoothing
+)
+
+func buildProfiles() {
+	profiles = make(map[string]profile, len(samples))
+	all := make(map[string]struct{})
+	for lang, text := range samples {
+		p := profile{counts: make(map[string]int)}
+		for _, g := range trigrams(text) {
+			p.counts[g]++
+			p.total++
+			all[g] = struct{}{}
+		}
+		profiles[lang] = p
+	}
+	vocabulary = len(all)
+}
+
+func trigrams(text string) []string {
+	var r []string
+	for _, word := range Tokenize(strings.ToLower(text)) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			r = append(r, string(runes[i:i+3]))
+		}
+	}
+	return r
+}
+
+func detectLatin(text string) string {
+	profilesOnce.Do(buildProfiles)
+
+	grams := trigrams(text)
+	if len(grams) == 0 {
+		return ""
+	}
+	scores := make(map[string]float64, len(profiles))
+	for lang, p := range profiles {
+		s := 0.0
+		for _, g := range grams {
+			s += math.Log(float64(p.counts[g]+1) / float64(p.total+vocabulary))
+		}
+		scores[lang] = s
+	}
+
+	best, second := "", ""
+	for lang := range scores {
+		switch {
+		case best == "" || scores[lang] > scores[best]:
+			best, second = lang, best
+		case second == "" || scores[lang] > scores[second]:
+			second = lang
+		}
+	}
+	if (scores[best]-scores[second])/float64(len(grams)) < minDetectMargin {
+		return ""
+	}
+	return best
+}
+
+// Sample text per language: the first article of the Universal Declaration of
+// Human Rights and a few sentences of the kind an encyclopedia abstract has.
+var samples = map[string]string{
+	"en": `All human beings are born free and equal in dignity and rights. They are
+		endowed with reason and conscience and should act towards one another in a
+		spirit of brotherhood. The city is known for its old bridges, the river that
+		runs through the centre and the market held every week since the middle ages.
+		He was an English writer whose novels were widely read during his lifetime,
+		and several of them were later made into films. The species lives in forests
+		and grasslands, where it feeds mainly on insects, seeds and small fruits.
+		Which of these would you like to have, and when should they be delivered?`,
+	"de": `Alle Menschen sind frei und gleich an Würde und Rechten geboren. Sie sind
+		mit Vernunft und Gewissen begabt und sollen einander im Geist der
+		Brüderlichkeit begegnen. Die Stadt ist bekannt für ihre alten Brücken, den
+		Fluss, der durch die Innenstadt fließt, und den Markt, der seit dem
+		Mittelalter jede Woche stattfindet. Er war ein deutscher Schriftsteller, dessen
+		Romane zu seinen Lebzeiten viel gelesen wurden, und einige von ihnen wurden
+		später verfilmt. Die Art lebt in Wäldern und Wiesen, wo sie sich hauptsächlich
+		von Insekten, Samen und kleinen Früchten ernährt. Welche davon möchtest du
+		haben, und wann sollen sie geliefert werden?`,
+	"fr": `Tous les êtres humains naissent libres et égaux en dignité et en droits. Ils
+		sont doués de raison et de conscience et doivent agir les uns envers les
+		autres dans un esprit de fraternité. La ville est connue pour ses vieux ponts,
+		la rivière qui traverse le centre et le marché qui se tient chaque semaine
+		depuis le Moyen Âge. C'était un écrivain français dont les romans ont été
+		beaucoup lus de son vivant, et plusieurs d'entre eux ont ensuite été adaptés
+		au cinéma. L'espèce vit dans les forêts et les prairies, où elle se nourrit
+		surtout d'insectes, de graines et de petits fruits. Lesquels voulez-vous
+		avoir, et quand doivent-ils être livrés ?`,
+	"es": `Todos los seres humanos nacen libres e iguales en dignidad y derechos y,
+		dotados como están de razón y conciencia, deben comportarse fraternalmente
+		los unos con los otros. La ciudad es conocida por sus puentes antiguos, el río
+		que atraviesa el centro y el mercado que se celebra cada semana desde la Edad
+		Media. Fue un escritor español cuyas novelas fueron muy leídas en vida, y
+		varias de ellas se llevaron después al cine. La especie vive en bosques y
+		praderas, donde se alimenta sobre todo de insectos, semillas y frutos
+		pequeños. ¿Cuáles de estos quieres tener y cuándo deben ser entregados?`,
+	"it": `Tutti gli esseri umani nascono liberi ed eguali in dignità e diritti. Essi
+		sono dotati di ragione e di coscienza e devono agire gli uni verso gli altri
+		in spirito di fratellanza. La città è nota per i suoi vecchi ponti, il fiume
+		che attraversa il centro e il mercato che si tiene ogni settimana dal
+		Medioevo. Era uno scrittore italiano i cui romanzi furono molto letti durante
+		la sua vita, e diversi di essi sono stati poi portati sul grande schermo. La
+		specie vive nei boschi e nelle praterie, dove si nutre soprattutto di insetti,
+		semi e piccoli frutti. Quali di questi vorresti avere, e quando devono essere
+		consegnati?`,
+	"pt": `Todos os seres humanos nascem livres e iguais em dignidade e em direitos.
+		Dotados de razão e de consciência, devem agir uns para com os outros em
+		espírito de fraternidade. A cidade é conhecida pelas suas pontes antigas, pelo
+		rio que atravessa o centro e pelo mercado que se realiza todas as semanas
+		desde a Idade Média. Foi um escritor português cujos romances foram muito
+		lidos em vida, e vários deles foram depois adaptados ao cinema. A espécie vive
+		em florestas e campos, onde se alimenta sobretudo de insetos, sementes e
+		pequenos frutos. Quais destes você quer ter, e quando devem ser entregues?`,
+	"nl": `Alle mensen worden vrij en gelijk in waardigheid en rechten geboren. Zij zijn
+		begiftigd met verstand en geweten, en behoren zich jegens elkander in een
+		geest van broederschap te gedragen. De stad is bekend om haar oude bruggen, de
+		rivier die door het centrum stroomt en de markt die sinds de middeleeuwen elke
+		week wordt gehouden. Hij was een Nederlandse schrijver wiens romans tijdens
+		zijn leven veel gelezen werden, en een aantal ervan is later verfilmd. De soort
+		leeft in bossen en graslanden, waar hij zich vooral voedt met insecten, zaden
+		en kleine vruchten. Welke van deze wil je hebben, en wanneer moeten ze worden
+		geleverd?`,
+	"sv": `Alla människor är födda fria och lika i värde och rättigheter. De har
+		utrustats med förnuft och samvete och bör handla gentemot varandra i en anda
+		av broderskap. Staden är känd för sina gamla broar, floden som rinner genom
+		centrum och marknaden som har hållits varje vecka sedan medeltiden. Han var en
+		svensk författare vars romaner lästes mycket under hans livstid, och flera av
+		dem har senare filmatiserats. Arten lever i skogar och på gräsmarker, där den
+		främst äter insekter, frön och små frukter. Vilka av dessa vill du ha, och när
+		ska de levereras?`,
+	"no": `Alle mennesker er født frie og med samme menneskeverd og
+		menneskerettigheter. De er utstyrt med fornuft og samvittighet og bør handle
+		mot hverandre i brorskapets ånd. Byen er kjent for sine gamle broer, elven som
+		renner gjennom sentrum og markedet som har vært holdt hver uke siden
+		middelalderen. Han var en norsk forfatter hvis romaner ble mye lest mens han
+		levde, og flere av dem er senere blitt filmatisert. Arten lever i skog og på
+		gressletter, der den hovedsakelig spiser insekter, frø og små frukter. Hvilke
+		av disse vil du ha, og når skal de leveres?`,
+	"hu": `Minden emberi lény szabadon születik és egyenlő méltósága és joga van. Az
+		emberek, ésszel és lelkiismerettel bírván, egymással szemben testvéri
+		szellemben kell hogy viseltessenek. A város híres régi hídjairól, a
+		belvároson átfolyó folyóról és a piacról, amelyet a középkor óta minden héten
+		megtartanak. Magyar író volt, akinek regényeit életében sokan olvasták, és
+		közülük többet később megfilmesítettek. A faj erdőkben és füves területeken
+		él, ahol főként rovarokkal, magvakkal és apró gyümölcsökkel táplálkozik.
+		Melyiket szeretnéd ezek közül, és mikor kell leszállítani őket?`,
+}
@@ -0,0 +1,202 @@
+package analysis
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	snowballeng "github.com/kljensen/snowball/english"
+)
+
+// Tokenizer
+// The tokenizer is the first step of text analysis.
+// Its job is to convert text into a list of tokens.
+// Our implementation splits the text on a word boundary and removes punctuation marks:
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Offset is where a word starts and ends in a text, in bytes.
+type Offset struct {
+	Start, End int
+}
+
+// WordOffsets returns where the words Tokenize splits text into are.
+func WordOffsets(text string) []Offset {
+	var r []Offset
+	start := -1
+	for i, c := range text {
+		if unicode.IsLetter(c) || unicode.IsNumber(c) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			r = append(r, Offset{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		r = append(r, Offset{start, len(text)})
+	}
+	return r
+}
+
+// Emails and URLs
+// The tokenizer shreds "user@example.com" into "user", "example" and "com".
+// This opt-in filter runs on the raw text before tokenization and pulls emails and
+// URLs out as single lowercased tokens. It returns them along with the text that is
+// left for the tokenizer. With keepParts the matched text is left in place, so the
+// tokenizer still emits the individual parts as well.
+var emailURLPattern = regexp.MustCompile(
+	`(?i)[a-z0-9._%+-]+@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}|\bhttps?://[^\s<>"]*[^\s<>".,;:!?)]`)
+
+func EmailURLFilter(text string, keepParts bool) ([]string, string) {
+	matches := emailURLPattern.FindAllString(text, -1)
+	if matches == nil {
+		return nil, text
+	}
+
+	units := make([]string, len(matches))
+	for i, m := range matches {
+		units[i] = strings.ToLower(m)
+	}
+
+	if keepParts {
+		return units, text
+	}
+	return units, emailURLPattern.ReplaceAllString(text, " ")
+}
+
+// Script boundaries
+// Messy multilingual data is full of tokens like "abcабв" that glue two scripts
+// together. This opt-in filter splits a token wherever it moves between Latin,
+// Cyrillic, Greek, CJK, other letters and digits. Combining marks stay with the
+// character before them.
+const (
+	scriptOther = iota
+	scriptLatin
+	scriptCyrillic
+	scriptGreek
+	scriptCJK
+	scriptDigit
+)
+
+func scriptOf(r rune) int {
+	switch {
+	case unicode.IsNumber(r):
+		return scriptDigit
+	case unicode.Is(unicode.Latin, r):
+		return scriptLatin
+	case unicode.Is(unicode.Cyrillic, r):
+		return scriptCyrillic
+	case unicode.Is(unicode.Greek, r):
+		return scriptGreek
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+		return scriptCJK
+	}
+	return scriptOther
+}
+
+func ScriptBoundaryFilter(tokens []string) []string {
+	r := make([]string, 0, len(tokens))
+
+	for _, token := range tokens {
+		start, prev := 0, -1
+		for i, c := range token {
+			if unicode.Is(unicode.Mn, c) {
+				continue
+			}
+			script := scriptOf(c)
+			if prev >= 0 && script != prev {
+				r = append(r, token[start:i])
+				start = i
+			}
+			prev = script
+		}
+		r = append(r, token[start:])
+	}
+
+	return r
+}
+
+// Filteration
+// Lowercase
+func LowercaseFilter(tokens []string) []string {
+	r := make([]string, len(tokens))
+
+	for i, token := range tokens {
+		r[i] = strings.ToLower(token)
+	}
+
+	return r
+}
+
+// Stopwords needs to be filtered
+var stopwords = StopwordSet{ // I wish Go had built-in sets.
+	"a": {}, "and": {}, "be": {}, "have": {}, "i": {},
+	"in": {}, "of": {}, "that": {}, "the": {}, "to": {}}
+
+// StopwordFilter drops the default English stopwords.
+func StopwordFilter(tokens []string) []string {
+	return stopwords.Filter(tokens)
+}
+
+func (s StopwordSet) Filter(tokens []string) []string {
+	r := make([]string, 0, len(tokens))
+
+	for _, token := range tokens {
+		if _, ok := s[token]; !ok {
+			r = append(r, token)
+		}
+	}
+
+	return r
+}
+
+// Stemming
+// It involves converting the various forms of a word to a single form. This is
+// the English Snowball stemmer, see stemmers.go for the others.
+func StemmerFilter(tokens []string) []string {
+	return stemAll(tokens, unicode.Latin, func(token string) string {
+		return snowballeng.Stem(token, false)
+	}, nil)
+}
+
+// The English stemmer only knows Latin script and turns Cyrillic or CJK tokens
+// into garbage, so those pass through untouched, and so on for the other
+// stemmers and their scripts. A Standard analyzer counts how many did after
+// CountStemSkipped, see StemSkipped.
+func stemmable(token string, script *unicode.RangeTable) bool {
+	for _, r := range token {
+		if unicode.IsLetter(r) && !unicode.Is(script, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// A panic inside the stemmer on exotic input shouldn't kill a whole indexing run,
+// so we fall back to the unstemmed token and log what broke it.
+func stem(token string, fn func(string) string) (stemmed string) {
+	defer func() {
+		if err := recover(); err != nil {
+			sample := token
+			if len(sample) > 64 {
+				// Cut at a rune boundary, or the log gets invalid UTF-8.
+				n := 64
+				for n > 0 && !utf8.RuneStart(sample[n]) {
+					n--
+				}
+				sample = sample[:n] + "..."
+			}
+			slog.Warn("stemmer failed", "token", sample, "bytes", len(token), "error", err)
+			stemmed = token
+		}
+	}()
+
+	return fn(token)
+}
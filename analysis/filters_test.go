@@ -0,0 +1,141 @@
+package analysis
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEmailsAndURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyzer *Standard
+		text     string
+		want     []string
+	}{
+		{"off", &Standard{}, "mail user@example.com", []string{"mail", "user", "exampl", "com"}},
+		{"email", &Standard{KeepEmailsAndURLs: true}, "mail User@Example.com today", []string{"mail", "user@example.com", "today"}},
+		{"url", &Standard{KeepEmailsAndURLs: true}, "see https://example.com/docs/a.html.", []string{"see", "https://example.com/docs/a.html"}},
+		{"in place", &Standard{KeepEmailsAndURLs: true}, "a@example.com or http://b.org then", []string{"a@example.com", "or", "http://b.org", "then"}},
+		{"with parts", &Standard{KeepEmailsAndURLs: true, EmailURLParts: true}, "mail user@example.com now", []string{"mail", "user@example.com", "user", "exampl", "com", "now"}},
+		{"prose unaffected", &Standard{KeepEmailsAndURLs: true}, "the running cats, at home", []string{"run", "cat", "at", "home"}},
+		{"no domain", &Standard{KeepEmailsAndURLs: true}, "user@localhost", []string{"user", "localhost"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.analyzer.Analyze(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Analyze(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStemRecovers(t *testing.T) {
+	long := strings.Repeat("a", 10000)
+	tests := []struct {
+		name  string
+		token string
+		fn    func(string) string
+		want  string
+	}{
+		{"stems", "running", func(string) string { return "run" }, "run"},
+		{"panics", "running", func(string) string { panic("broken stemmer") }, "running"},
+		{"panics on a long token", long, func(string) string { panic("broken stemmer") }, long},
+		{"index out of range", "ab", func(s string) string { return s[:len(s)+1] }, "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stem(tt.token, tt.fn); got != tt.want {
+				t.Errorf("stem = %.20q, want %.20q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStemLogsValidUTF8(t *testing.T) {
+	var logged string
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == "token" {
+				logged = a.Value.String()
+			}
+			return a
+		},
+	})))
+
+	stem("a"+strings.Repeat("é", 100), func(string) string { panic("broken stemmer") })
+	if !utf8.ValidString(logged) {
+		t.Errorf("logged token %q isn't valid UTF-8", logged)
+	}
+	if !strings.HasSuffix(logged, "...") {
+		t.Errorf("logged token %q isn't shortened", logged)
+	}
+}
+
+func TestPathologicalTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"10000 letters", strings.Repeat("a", 10000)},
+		{"10000 repeated suffixes", strings.Repeat("ational", 10000/7)},
+		{"10000 accented letters", strings.Repeat("é", 10000)},
+		{"10000 letters among words", "the " + strings.Repeat("xy", 5000) + " cats"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, a := range []*Standard{{}, {Stemmer: StemPorter}, {Language: "fr"}} {
+				if tokens := a.Analyze(tt.text); len(tokens) == 0 {
+					t.Errorf("%+v: no tokens", a)
+				}
+			}
+		})
+	}
+}
+
+func TestScriptBoundaryFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []string
+		want   []string
+	}{
+		{"latin and cyrillic", []string{"abcабв"}, []string{"abc", "абв"}},
+		{"letters and digits", []string{"abc123"}, []string{"abc", "123"}},
+		{"several transitions", []string{"abc123абв東京"}, []string{"abc", "123", "абв", "東京"}},
+		{"greek", []string{"αβγabc"}, []string{"αβγ", "abc"}},
+		{"single script", []string{"hello", "привет", "東京"}, []string{"hello", "привет", "東京"}},
+		{"combining mark", []string{"cafe\u0301абв"}, []string{"cafe\u0301", "абв"}},
+		{"empty", nil, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ScriptBoundaryFilter(tt.tokens); !slices.Equal(got, tt.want) {
+				t.Errorf("ScriptBoundaryFilter(%q) = %q, want %q", tt.tokens, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitScriptBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyzer *Standard
+		text     string
+		want     []string
+	}{
+		{"off", &Standard{Stemmer: StemNone}, "abcабв", []string{"abcабв"}},
+		{"on", &Standard{Stemmer: StemNone, SplitScriptBoundaries: true}, "abcабв model3", []string{"abc", "абв", "model", "3"}},
+		{"on, prose unaffected", &Standard{Stemmer: StemNone, SplitScriptBoundaries: true}, "wild cats", []string{"wild", "cats"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.analyzer.Analyze(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Analyze(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
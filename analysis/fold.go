@@ -0,0 +1,101 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unicode normalization and folding
+// "café" can be typed as é or as e followed by a combining accent, which look the
+// same and are different words, and the tokenizer even splits the second one at
+// the accent; NFC composes both into é. NFKC goes further and replaces
+// compatibility characters with what they stand for too: the ligature "ﬁ" with
+// "fi", full-width "ＡＢＣ" with "ABC", "²" with "2". Both are char filters, as
+// the text has to be normalized before it's tokenized, and
+// Standard.Normalization names the one to run after its CharFilters.
+//
+// Folding (Standard.FoldAccents) goes further still and takes the diacritics off,
+// so "café", "Café" and "cafe" all meet as "cafe", and spells letters that have no
+// decomposition the ASCII way: "ß" as "ss", "æ" as "ae", "ø" as "o", "ł" as "l".
+// It runs after stem, as stemmers and stopword lists for languages with accents
+// know their words with them.
+const (
+	CharFilterNFC  = "nfc"
+	CharFilterNFKC = "nfkc"
+
+	FilterFold = "fold"
+)
+
+var (
+	NFC  CharFilter = namedCharFilter{CharFilterNFC, norm.NFC.String}
+	NFKC CharFilter = namedCharFilter{CharFilterNFKC, norm.NFKC.String}
+)
+
+var Fold TokenFilter = namedFilter{FilterFold, FoldFilter}
+
+// FoldFilter takes the diacritics off every token and spells the letters without
+// any the ASCII way.
+func FoldFilter(tokens []string) []string {
+	for i, t := range tokens {
+		tokens[i] = FoldString(t)
+	}
+	return tokens
+}
+
+// Letters that don't decompose into a base letter and marks.
+var foldLetters = map[rune]string{
+	'ß': "ss", 'ẞ': "SS",
+	'æ': "ae", 'Æ': "AE",
+	'œ': "oe", 'Œ': "OE",
+	'ø': "o", 'Ø': "O",
+	'đ': "d", 'Đ': "D",
+	'ð': "d", 'Ð': "D",
+	'þ': "th", 'Þ': "TH",
+	'ł': "l", 'Ł': "L",
+	'ħ': "h", 'Ħ': "H",
+	'ı': "i",
+	'ŀ': "l", 'Ŀ': "L",
+	'ĸ': "q",
+	'ŋ': "n", 'Ŋ': "N",
+	'ŧ': "t", 'Ŧ': "T",
+}
+
+// FoldString is what FoldFilter makes of s.
+func FoldString(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if f, ok := foldLetters[r]; ok {
+			b.WriteString(f)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return norm.NFC.String(b.String())
+}
+
+// validateNormalization checks that a.Normalization is a form there is.
+func (a *Standard) validateNormalization() error {
+	switch a.Normalization {
+	case "", CharFilterNFC, CharFilterNFKC:
+		return nil
+	}
+	return fmt.Errorf("unknown normalization %q (have %s, %s)", a.Normalization, CharFilterNFC, CharFilterNFKC)
+}
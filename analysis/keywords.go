@@ -0,0 +1,138 @@
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Keyword marker
+// Product names and acronyms shouldn't go through the steps that change or drop
+// words: "IT" would be dropped as the stopword "it", "Windows" stemmed to
+// "window". Standard.Keywords lists words that the stopwords, decompound and stem
+// steps and the length and pattern filters let through as they are; lowercase
+// and fold still apply, so "IT" is indexed as "it" and a search for "IT" finds
+// it. A keyword with capitals only marks the token written that way, "IT" but not
+// "it" or "It"; one in lowercase marks it however it's written, "go" marks "Go"
+// and "GO". Tokens are matched as the tokenizer makes them, before any filter.
+//
+// The other tokens are filtered a stretch between two keywords at a time, so a
+// registered filter that looks at the tokens next to each one doesn't see past a
+// keyword.
+var protectedSteps = map[string]bool{FilterStopwords: true, FilterDecompound: true, FilterStem: true, FilterLength: true, FilterPattern: true}
+
+// LoadKeywords reads a keyword list, one per line, as it's written; blank lines
+// and lines starting with # are skipped.
+func LoadKeywords(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadKeywords(f)
+}
+
+func ReadKeywords(r io.Reader) ([]string, error) {
+	var words []string
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+func (a *Standard) isKeyword(token string) bool {
+	lower := strings.ToLower(token)
+	for _, k := range a.Keywords {
+		if k == token || k == lower {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *Standard) validateKeywords() error {
+	for _, k := range a.Keywords {
+		if tokens := a.Segmentation.tokenize(k); len(tokens) != 1 || tokens[0] != k {
+			return fmt.Errorf("keyword %q isn't a single token", k)
+		}
+	}
+	return nil
+}
+
+// tokenRun is a keyword, an email or URL kept whole (see Standard.tokenRuns) or
+// a stretch of tokens between them.
+type tokenRun struct {
+	tokens  []string
+	keyword bool
+	unit    bool // skips every step
+}
+
+// keywordRuns splits runs at the keywords.
+func (a *Standard) keywordRuns(runs []tokenRun) []tokenRun {
+	if len(a.Keywords) == 0 {
+		return runs
+	}
+	var r []tokenRun
+	for _, run := range runs {
+		if run.unit {
+			r = append(r, run)
+			continue
+		}
+		tokens, start := run.tokens, 0
+		for i, token := range tokens {
+			if !a.isKeyword(token) {
+				continue
+			}
+			// Capped, so a filter that appends doesn't write over the next run.
+			if start < i {
+				r = append(r, tokenRun{tokens: tokens[start:i:i]})
+			}
+			r = append(r, tokenRun{tokens: tokens[i : i+1 : i+1], keyword: true})
+			start = i + 1
+		}
+		if start < len(tokens) {
+			r = append(r, tokenRun{tokens: tokens[start:]})
+		}
+	}
+	return r
+}
+
+func joinRuns(runs []tokenRun) []string {
+	if len(runs) == 1 {
+		return runs[0].tokens
+	}
+	var r []string
+	for _, run := range runs {
+		r = append(r, run.tokens...)
+	}
+	return r
+}
+
+// filter runs the steps after tokenizing on runs, adding a stage for each to
+// stages unless it's nil.
+func (a *Standard) filter(runs []tokenRun, stages *[]Stage) []string {
+	runs = a.keywordRuns(runs)
+	for _, s := range a.steps() {
+		for i, run := range runs {
+			if !run.unit && (!run.keyword || !protectedSteps[s.name]) {
+				runs[i].tokens = s.fn(run.tokens)
+			}
+		}
+		if stages != nil {
+			*stages = append(*stages, Stage{s.name, joinRuns(runs)})
+		}
+	}
+	return joinRuns(runs)
+}
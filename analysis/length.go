@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"unicode/utf8"
+)
+
+// Token length and patterns
+// Real corpora fill the dictionary with terms nobody searches for: single
+// letters, page numbers, years, IDs, hashes. LengthFilter drops the tokens
+// shorter than minLen or longer than maxLen characters, either bound 0 for none,
+// and PatternFilter the ones a regular expression matches, like DigitsPattern
+// for numbers.
+//
+// Standard.MinTokenLength, MaxTokenLength and DropPattern run them after every
+// other step, so they see the terms as they'd be indexed, and being plain data
+// they're saved along with the index (`fts index -min-length 2 -drop-pattern
+// '^[0-9]+$'`). Emails and URLs kept whole (KeepEmailsAndURLs) aren't filtered.
+// Queries go through the same filters, so a dropped term in a query is treated
+// like a stopword.
+const DigitsPattern = `^[0-9]+$`
+
+const (
+	FilterLength  = "length"
+	FilterPattern = "pattern"
+)
+
+func LengthFilter(minLen, maxLen int) TokenFilter {
+	return namedFilter{FilterLength, func(tokens []string) []string {
+		r := tokens[:0:0]
+		for _, token := range tokens {
+			n := utf8.RuneCountInString(token)
+			if n >= minLen && (maxLen <= 0 || n <= maxLen) {
+				r = append(r, token)
+			}
+		}
+		return r
+	}}
+}
+
+func PatternFilter(re *regexp.Regexp) TokenFilter {
+	return namedFilter{FilterPattern, func(tokens []string) []string {
+		r := tokens[:0:0]
+		for _, token := range tokens {
+			if !re.MatchString(token) {
+				r = append(r, token)
+			}
+		}
+		return r
+	}}
+}
+
+// Standard only keeps the pattern's source, so the compiled expressions are
+// cached by it.
+var patterns sync.Map // string to *regexp.Regexp, or error
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if v, ok := patterns.Load(pattern); ok {
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		return v.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		err = fmt.Errorf("drop pattern: %w", err)
+		patterns.Store(pattern, err)
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+// lengthSteps returns the steps of MinTokenLength, MaxTokenLength and
+// DropPattern. A pattern that doesn't compile, which Validate reports, drops
+// nothing.
+func (a *Standard) lengthSteps() []step {
+	var r []step
+	if a.MinTokenLength > 0 || a.MaxTokenLength > 0 {
+		r = append(r, step{FilterLength, LengthFilter(a.MinTokenLength, a.MaxTokenLength).Filter})
+	}
+	if a.DropPattern != "" {
+		if re, err := compilePattern(a.DropPattern); err == nil {
+			r = append(r, step{FilterPattern, PatternFilter(re).Filter})
+		}
+	}
+	return r
+}
+
+func (a *Standard) validateLengths() error {
+	if a.MinTokenLength < 0 || a.MaxTokenLength < 0 {
+		return fmt.Errorf("negative token length")
+	}
+	if a.MaxTokenLength > 0 && a.MaxTokenLength < a.MinTokenLength {
+		return fmt.Errorf("max token length %d is under the min %d", a.MaxTokenLength, a.MinTokenLength)
+	}
+	if a.DropPattern != "" {
+		_, err := compilePattern(a.DropPattern)
+		return err
+	}
+	return nil
+}
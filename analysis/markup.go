@@ -0,0 +1,236 @@
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Char filters
+// Pages and Markdown files are full of markup that the tokenizer would turn into
+// terms: "div", "href", "https" and every host name linked to. A CharFilter runs
+// on the raw text before it's tokenized and takes that out. StripHTML keeps the
+// text of a page and the alt and title text of its elements, StripMarkdown the
+// text of a Markdown document without its link targets.
+//
+// Standard.CharFilters names the ones to run, in order, and Chain.CharFilters
+// takes them directly:
+//
+//	a := &analysis.Standard{CharFilters: []string{analysis.CharFilterHTML}}
+type CharFilter interface {
+	FilterText(text string) string
+}
+
+type CharFilterFunc func(text string) string
+
+func (f CharFilterFunc) FilterText(text string) string { return f(text) }
+
+const (
+	CharFilterHTML     = "html"
+	CharFilterMarkdown = "markdown"
+)
+
+type namedCharFilter struct {
+	name string
+	fn   func(string) string
+}
+
+func (f namedCharFilter) FilterText(text string) string { return f.fn(text) }
+
+func (f namedCharFilter) Name() string { return f.name }
+
+var (
+	HTML     CharFilter = namedCharFilter{CharFilterHTML, StripHTML}
+	Markdown CharFilter = namedCharFilter{CharFilterMarkdown, StripMarkdown}
+)
+
+var (
+	charFiltersMu sync.RWMutex
+	charFilters   = map[string]CharFilter{CharFilterHTML: HTML, CharFilterMarkdown: Markdown, CharFilterNFC: NFC, CharFilterNFKC: NFKC}
+)
+
+// RegisterCharFilter makes f usable in Standard.CharFilters under name.
+func RegisterCharFilter(name string, f CharFilter) {
+	charFiltersMu.Lock()
+	defer charFiltersMu.Unlock()
+	charFilters[name] = f
+}
+
+func lookupCharFilter(name string) (CharFilter, bool) {
+	charFiltersMu.RLock()
+	defer charFiltersMu.RUnlock()
+	f, ok := charFilters[name]
+	return f, ok
+}
+
+// CharFilterNames lists the char filters Standard.CharFilters can name.
+func CharFilterNames() []string {
+	charFiltersMu.RLock()
+	defer charFiltersMu.RUnlock()
+
+	r := make([]string, 0, len(charFilters))
+	for name := range charFilters {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (a *Standard) filterText(text string, stages *[]Stage) string {
+	names := a.CharFilters
+	if a.Normalization != "" {
+		names = append(names[:len(names):len(names)], a.Normalization)
+	}
+	for _, name := range names {
+		if f, ok := lookupCharFilter(name); ok {
+			text = f.FilterText(text)
+			if stages != nil {
+				*stages = append(*stages, Stage{name, []string{text}})
+			}
+		}
+	}
+	return text
+}
+
+func (a *Standard) validateCharFilters() error {
+	for _, name := range a.CharFilters {
+		if _, ok := lookupCharFilter(name); !ok {
+			return fmt.Errorf("unknown char filter %q (have %s)", name, strings.Join(CharFilterNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// HTML
+// Text inside script and style elements isn't text of the page, so it goes, and
+// so do comments. Block elements like p, li and td end a word, inline ones like b
+// and a don't: "<b>W</b>ord" is "Word". Entities are decoded.
+var htmlBlocks = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+	"caption": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true, "h1": true,
+	"h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "header": true,
+	"hr": true, "li": true, "main": true, "nav": true, "ol": true, "option": true,
+	"p": true, "pre": true, "section": true, "table": true, "td": true, "th": true,
+	"title": true, "tr": true, "ul": true,
+}
+
+var htmlSkipped = map[string]bool{"script": true, "style": true, "noscript": true, "template": true}
+
+func StripHTML(text string) string {
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(text))
+	skip := ""
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return b.String()
+		case html.TextToken:
+			if skip == "" {
+				b.Write(z.Text())
+			}
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			if tt == html.EndTagToken {
+				if tag == skip {
+					skip = ""
+				}
+			} else if htmlSkipped[tag] && tt == html.StartTagToken && skip == "" {
+				skip = tag
+			}
+			if htmlBlocks[tag] {
+				b.WriteByte('\n')
+			}
+			for hasAttr && skip == "" {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if k := string(key); (k == "alt" || k == "title") && len(val) > 0 {
+					b.WriteByte(' ')
+					b.Write(val)
+					b.WriteByte(' ')
+				}
+			}
+		}
+	}
+}
+
+// Markdown
+// The text of headings, lists, quotes, tables and emphasis stays, their markers
+// go. So do the targets of links and images, leaving the link text, the alt text
+// and the title; reference definitions; and the info string of fenced code
+// blocks, whose code stays as it is. Inline HTML goes through StripHTML.
+var (
+	mdFence     = regexp.MustCompile("^\\s*(```|~~~)")
+	mdReference = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s*\S+`)
+	mdRule      = regexp.MustCompile(`^\s{0,3}([-*_=|:]\s*)+$`)
+	mdBlock     = regexp.MustCompile(`^\s{0,3}((>\s?)+|#{1,6}\s+|([-*+]|\d{1,9}[.)])\s+(\[[ xX]\]\s+)?)+`)
+	mdImage     = regexp.MustCompile(`!\[([^\]]*)\]\(\s*<?[^)\s>]*>?(?:\s+["'(]([^"')]*)["')])?\s*\)`)
+	mdLink      = regexp.MustCompile(`\[([^\]]*)\]\(\s*<?[^)\s>]*>?(?:\s+["'(]([^"')]*)["')])?\s*\)`)
+	mdRefLink   = regexp.MustCompile(`\[([^\]]+)\]\[[^\]]*\]`)
+	mdAutolink  = regexp.MustCompile(`<((?:https?|ftp|mailto):[^>\s]+|[^@>\s]+@[^>\s]+)>`)
+)
+
+func StripMarkdown(text string) string {
+	lines := strings.Split(text, "\n")
+	out := lines[:0]
+	fenced := ""
+	for _, line := range lines {
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			switch fenced {
+			case "":
+				fenced = m[1]
+				continue
+			case m[1]:
+				fenced = ""
+				continue
+			}
+		}
+		if fenced != "" {
+			out = append(out, html.EscapeString(line))
+			continue
+		}
+		if mdReference.MatchString(line) || mdRule.MatchString(line) {
+			continue
+		}
+		line = mdBlock.ReplaceAllString(line, "")
+		line = mdImage.ReplaceAllString(line, "$1 $2")
+		line = mdLink.ReplaceAllString(line, "$1 $2")
+		line = mdRefLink.ReplaceAllString(line, "$1")
+		line = mdAutolink.ReplaceAllString(line, "$1")
+		line = strings.ReplaceAll(line, "|", " ")
+		out = append(out, stripEmphasis(line))
+	}
+	return StripHTML(strings.Join(out, "\n"))
+}
+
+// stripEmphasis drops the *, _, ~ and ` around words, but not the ones inside a
+// word like snake_case.
+func stripEmphasis(line string) string {
+	if !strings.ContainsAny(line, "*_~`") {
+		return line
+	}
+	var b strings.Builder
+	for i, r := range line {
+		if r == '*' || r == '_' || r == '~' || r == '`' {
+			before, _ := utf8.DecodeLastRuneInString(line[:i])
+			after, _ := utf8.DecodeRuneInString(line[i+utf8.RuneLen(r):])
+			if r == '`' || !isWordRune(before) || !isWordRune(after) {
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,66 @@
+package analysis
+
+import "fmt"
+
+// N-grams
+// Splitting tokens into their n-grams at index time turns substring and prefix
+// matching into plain term lookups, at the price of a much bigger dictionary.
+// NGramFilter emits every run of minGram to maxGram characters of a token,
+// shortest first at each start ("cat" with 2 and 3: "ca", "cat", "at"), and
+// EdgeNGramFilter only the ones at the start ("c", "ca", "cat"), which is what
+// search-as-you-type needs. A token shorter than minGram is kept as it is, so
+// short words still match themselves. minGram is at least 1 and maxGram at least
+// minGram.
+//
+// Queries go through the same analyzer, and the grams of a query term are AND-ed:
+// with edge n-grams "ca" matches "cat" and "cab", with n-grams "ata" matches
+// "database". Every gram takes a position of its own, so phrase and proximity
+// queries don't mean much on such a field; PerField keeps the filter to the
+// fields that need it.
+func NGramFilter(minGram, maxGram int) TokenFilter {
+	minGram, maxGram = gramSizes(minGram, maxGram)
+	return namedFilter{fmt.Sprintf("ngram%d-%d", minGram, maxGram), func(tokens []string) []string {
+		r := make([]string, 0, len(tokens))
+		for _, token := range tokens {
+			runes := []rune(token)
+			if len(runes) < minGram {
+				r = append(r, token)
+				continue
+			}
+			for start := range runes {
+				for n := minGram; n <= maxGram && start+n <= len(runes); n++ {
+					r = append(r, string(runes[start:start+n]))
+				}
+			}
+		}
+		return r
+	}}
+}
+
+func EdgeNGramFilter(minGram, maxGram int) TokenFilter {
+	minGram, maxGram = gramSizes(minGram, maxGram)
+	return namedFilter{fmt.Sprintf("edgengram%d-%d", minGram, maxGram), func(tokens []string) []string {
+		r := make([]string, 0, len(tokens))
+		for _, token := range tokens {
+			runes := []rune(token)
+			if len(runes) < minGram {
+				r = append(r, token)
+				continue
+			}
+			for n := minGram; n <= maxGram && n <= len(runes); n++ {
+				r = append(r, string(runes[:n]))
+			}
+		}
+		return r
+	}}
+}
+
+func gramSizes(minGram, maxGram int) (int, int) {
+	if minGram < 1 {
+		minGram = 1
+	}
+	if maxGram < minGram {
+		maxGram = minGram
+	}
+	return minGram, maxGram
+}
@@ -0,0 +1,207 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Filter order
+// Standard runs its steps in a fixed order: scripts (if SplitScriptBoundaries),
+// lowercase, stopwords (unless NoStopwords), decompound (if Decompound), stem,
+// fold (if FoldAccents). Standard.Filters names the steps to run instead, in
+// the order given, which can stem before dropping stopwords, leave a step out,
+// or put registered filters in between:
+//
+//	a := &analysis.Standard{Filters: []string{"lowercase", "stem", "stopwords"}}
+//
+// The stopwords, decompound and stem steps still follow Language, Stopwords,
+// Decompound and Stemmer. An empty list is the usual order, a pipeline without
+// any filters is a Chain. Since only the names are kept, an index saved with a
+// registered filter has to have it registered again before it's loaded.
+//
+// The stopword lists, dictionaries and stemmers only know lowercase words, so a
+// stopwords, decompound or stem step that doesn't come after lowercase lets
+// "The" through or mangles "Running". Validate catches that, along with names it
+// doesn't know (which Analyze skips) and steps listed twice.
+const (
+	FilterScripts   = "scripts"
+	FilterLowercase = "lowercase"
+	FilterStopwords = "stopwords"
+	FilterStem      = "stem"
+)
+
+var builtinFilters = []string{FilterScripts, FilterLowercase, FilterStopwords, FilterDecompound, FilterStem, FilterFold}
+
+var (
+	filtersMu sync.RWMutex
+	filters   = map[string]TokenFilter{}
+)
+
+// RegisterFilter makes f usable in Standard.Filters under name. The built-in
+// steps can't be replaced.
+func RegisterFilter(name string, f TokenFilter) {
+	filtersMu.Lock()
+	defer filtersMu.Unlock()
+	filters[name] = f
+}
+
+func lookupFilter(name string) (TokenFilter, bool) {
+	filtersMu.RLock()
+	defer filtersMu.RUnlock()
+	f, ok := filters[name]
+	return f, ok
+}
+
+// FilterNames lists the built-in steps and the registered filters.
+func FilterNames() []string {
+	filtersMu.RLock()
+	defer filtersMu.RUnlock()
+
+	r := append([]string{}, builtinFilters...)
+	for name := range filters {
+		if !isBuiltinFilter(name) {
+			r = append(r, name)
+		}
+	}
+	sort.Strings(r[len(builtinFilters):])
+	return r
+}
+
+func isBuiltinFilter(name string) bool {
+	for _, b := range builtinFilters {
+		if name == b {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFilters splits a comma-separated list of filter names.
+func ParseFilters(s string) []string {
+	var r []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			r = append(r, name)
+		}
+	}
+	return r
+}
+
+// step is one filter of a Standard pipeline; fn is nil for a step that does
+// nothing, like stemming a language without a stemmer.
+type step struct {
+	name string
+	fn   func([]string) []string
+}
+
+func (a *Standard) steps() []step {
+	names := a.Filters
+	if len(names) == 0 {
+		if a.SplitScriptBoundaries {
+			names = append(names, FilterScripts)
+		}
+		names = append(names, FilterLowercase)
+		if !a.NoStopwords {
+			names = append(names, FilterStopwords)
+		}
+		if a.Decompound != nil {
+			names = append(names, FilterDecompound)
+		}
+		names = append(names, FilterStem)
+		if a.FoldAccents {
+			names = append(names, FilterFold)
+		}
+	}
+
+	r := make([]step, 0, len(names))
+	for _, name := range names {
+		s := step{name: name}
+		switch name {
+		case FilterFold:
+			s.fn = FoldFilter
+		case FilterScripts:
+			s.fn = ScriptBoundaryFilter
+		case FilterLowercase:
+			s.fn = LowercaseFilter
+		case FilterStopwords:
+			s.fn = a.stopwords().Filter
+		case FilterDecompound:
+			if a.Decompound != nil {
+				s.fn = a.Decompound.Filter
+			}
+		case FilterStem:
+			s.fn = a.stemmer()
+		default:
+			if f, ok := lookupFilter(name); ok {
+				s.fn = f.Filter
+			}
+		}
+		if s.fn != nil {
+			r = append(r, s)
+		}
+	}
+	return append(r, a.lengthSteps()...)
+}
+
+// Validate checks the order of the filters in a.Filters, see Filter order, that
+// a.CharFilters and a.Normalization are known, the token length bounds and
+// DropPattern make sense and the Keywords are single tokens.
+func (a *Standard) Validate() error {
+	if err := a.validateCharFilters(); err != nil {
+		return err
+	}
+	if err := a.validateNormalization(); err != nil {
+		return err
+	}
+	if err := a.validateLengths(); err != nil {
+		return err
+	}
+	if err := a.validateKeywords(); err != nil {
+		return err
+	}
+	if len(a.Filters) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, name := range a.Filters {
+		if _, ok := lookupFilter(name); !ok && !isBuiltinFilter(name) {
+			return fmt.Errorf("unknown filter %q (have %s)", name, strings.Join(FilterNames(), ", "))
+		}
+		if seen[name] {
+			return fmt.Errorf("filter %q listed twice", name)
+		}
+		seen[name] = true
+	}
+	return checkOrder(a.Filters)
+}
+
+// Validate checks the order of the chain's filters by their names: a filter
+// named stopwords, decompound or stem has to come after one named lowercase,
+// unless the tokenizer lowercases already, which Validate can't know; such a
+// chain needn't call it.
+func (c *Chain) Validate() error {
+	names := make([]string, len(c.Filters))
+	for i, f := range c.Filters {
+		if n, ok := f.(interface{ Name() string }); ok {
+			names[i] = n.Name()
+		}
+	}
+	return checkOrder(names)
+}
+
+func checkOrder(names []string) error {
+	lowercased := false
+	for _, name := range names {
+		switch name {
+		case FilterLowercase:
+			lowercased = true
+		case FilterStopwords, FilterDecompound, FilterStem:
+			if !lowercased {
+				return fmt.Errorf("%s before lowercase: it only matches lowercase words", name)
+			}
+		}
+	}
+	return nil
+}
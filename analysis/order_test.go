@@ -0,0 +1,96 @@
+package analysis
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFilterOrder(t *testing.T) {
+	RegisterFilter("test-shout", FilterFunc(func(tokens []string) []string {
+		r := make([]string, len(tokens))
+		for i, token := range tokens {
+			r[i] = strings.ToUpper(token)
+		}
+		return r
+	}))
+	tests := []struct {
+		name    string
+		filters []string
+		text    string
+		want    []string
+	}{
+		{"usual order", nil, "The Running Cats", []string{"run", "cat"}},
+		{"capitalized stopwords dropped", nil, "THE cat AND The dog", []string{"cat", "dog"}},
+		{"stopwords before stem", nil, "ands cats", []string{"and", "cat"}},
+		{"stem before stopwords", []string{"lowercase", "stem", "stopwords"}, "ands cats", []string{"cat"}},
+		{"without stem", []string{"lowercase", "stopwords"}, "The Running Cats", []string{"running", "cats"}},
+		{"without stopwords", []string{"lowercase", "stem"}, "The Running Cats", []string{"the", "run", "cat"}},
+		{"registered filter in between", []string{"lowercase", "stopwords", "test-shout"}, "The cats", []string{"CATS"}},
+		{"registered filter last", []string{"lowercase", "stopwords", "stem", "test-shout"}, "The Running cats", []string{"RUN", "CAT"}},
+		{"fold after stem", []string{"lowercase", "stem", "fold"}, "Cafés", []string{"cafe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Standard{Filters: tt.filters}
+			if err := a.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if got := a.Analyze(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Analyze(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFilterOrder(t *testing.T) {
+	RegisterFilter("test-noop", FilterFunc(func(tokens []string) []string { return tokens }))
+	tests := []struct {
+		name    string
+		filters []string
+		wantErr string // in the error, "" for none
+	}{
+		{"usual order", nil, ""},
+		{"stem first after lowercase", []string{"lowercase", "stem", "stopwords"}, ""},
+		{"registered", []string{"test-noop", "lowercase", "stopwords"}, ""},
+		{"stopwords before lowercase", []string{"stopwords", "lowercase"}, "stopwords before lowercase"},
+		{"stem without lowercase", []string{"stem"}, "stem before lowercase"},
+		{"decompound before lowercase", []string{"decompound", "lowercase"}, "decompound before lowercase"},
+		{"unknown", []string{"lowercase", "nope"}, `unknown filter "nope"`},
+		{"twice", []string{"lowercase", "stem", "lowercase"}, `filter "lowercase" listed twice`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&Standard{Filters: tt.filters}).Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("err = %v, want none", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateChainOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []TokenFilter
+		wantErr bool
+	}{
+		{"lowercase first", []TokenFilter{Lowercase, EnglishStopwords, Stemmer}, false},
+		{"stopwords first", []TokenFilter{EnglishStopwords, Lowercase}, true},
+		{"unnamed filters", []TokenFilter{FilterFunc(LowercaseFilter), Stemmer}, true},
+		{"renamed", []TokenFilter{Named("lowercase", FilterFunc(LowercaseFilter)), Stemmer}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := (&Chain{Filters: tt.filters}).Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
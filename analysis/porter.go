@@ -0,0 +1,229 @@
+package analysis
+
+import "strings"
+
+// Porter stemmer
+// The original algorithm by Martin Porter (1980), which predates Snowball. It's
+// more aggressive than the Snowball English stemmer ("generalization" and
+// "generous" both become "gener") and is still what many older systems and
+// relevance judgments were built with. It only knows lowercase English words;
+// anything with other characters is returned as it is.
+func PorterStem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+
+	w := porterWord(word)
+	w = w.step1a()
+	w = w.step1b()
+	w = w.step1c()
+	w = w.step2()
+	w = w.step3()
+	w = w.step4()
+	w = w.step5()
+	return string(w)
+}
+
+type porterWord []byte
+
+// consonant reports whether w[i] is a consonant: not a vowel, and y only after a
+// vowel (or at the start).
+func (w porterWord) consonant(i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !w.consonant(i-1)
+	}
+	return true
+}
+
+// measure counts the vowel-consonant sequences of w, the m in [C](VC)^m[V].
+func (w porterWord) measure() int {
+	m, i := 0, 0
+	for i < len(w) && w.consonant(i) {
+		i++
+	}
+	for i < len(w) {
+		for i < len(w) && !w.consonant(i) {
+			i++
+		}
+		if i == len(w) {
+			break
+		}
+		for i < len(w) && w.consonant(i) {
+			i++
+		}
+		m++
+	}
+	return m
+}
+
+func (w porterWord) hasVowel() bool {
+	for i := range w {
+		if !w.consonant(i) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w porterWord) doubleConsonant() bool {
+	n := len(w)
+	return n >= 2 && w[n-1] == w[n-2] && w.consonant(n-1)
+}
+
+// cvc reports whether w ends consonant-vowel-consonant with the last one not w, x
+// or y, as in "hop" but not "snow".
+func (w porterWord) cvc() bool {
+	n := len(w)
+	if n < 3 || !w.consonant(n-3) || w.consonant(n-2) || !w.consonant(n-1) {
+		return false
+	}
+	c := w[n-1]
+	return c != 'w' && c != 'x' && c != 'y'
+}
+
+func (w porterWord) hasSuffix(s string) bool {
+	return strings.HasSuffix(string(w), s)
+}
+
+// replace swaps suffix for repl if what comes before it has a measure above m.
+// ok reports whether w ended with suffix at all.
+func (w porterWord) replace(suffix, repl string, m int) (porterWord, bool) {
+	if !w.hasSuffix(suffix) {
+		return w, false
+	}
+	stem := w[:len(w)-len(suffix)]
+	if stem.measure() > m {
+		return append(stem, repl...), true
+	}
+	return w, true
+}
+
+// replaceFirst applies the first rule whose suffix w ends with.
+func (w porterWord) replaceFirst(rules [][2]string, m int) porterWord {
+	for _, r := range rules {
+		if r, ok := w.replace(r[0], r[1], m); ok {
+			return r
+		}
+	}
+	return w
+}
+
+func (w porterWord) step1a() porterWord {
+	switch {
+	case w.hasSuffix("sses"), w.hasSuffix("ies"):
+		return w[:len(w)-2]
+	case w.hasSuffix("ss"):
+		return w
+	case w.hasSuffix("s"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+func (w porterWord) step1b() porterWord {
+	if w.hasSuffix("eed") {
+		if w[:len(w)-3].measure() > 0 {
+			return w[:len(w)-1]
+		}
+		return w
+	}
+
+	var stem porterWord
+	switch {
+	case w.hasSuffix("ed") && w[:len(w)-2].hasVowel():
+		stem = w[:len(w)-2]
+	case w.hasSuffix("ing") && w[:len(w)-3].hasVowel():
+		stem = w[:len(w)-3]
+	default:
+		return w
+	}
+
+	switch {
+	case stem.hasSuffix("at"), stem.hasSuffix("bl"), stem.hasSuffix("iz"):
+		return append(stem, 'e')
+	case stem.doubleConsonant():
+		if c := stem[len(stem)-1]; c != 'l' && c != 's' && c != 'z' {
+			return stem[:len(stem)-1]
+		}
+	case stem.measure() == 1 && stem.cvc():
+		return append(stem, 'e')
+	}
+	return stem
+}
+
+func (w porterWord) step1c() porterWord {
+	if w.hasSuffix("y") && w[:len(w)-1].hasVowel() {
+		return append(w[:len(w)-1], 'i')
+	}
+	return w
+}
+
+var porterStep2 = [][2]string{
+	{"ational", "ate"}, {"tional", "tion"}, {"enci", "ence"}, {"anci", "ance"},
+	{"izer", "ize"}, {"abli", "able"}, {"alli", "al"}, {"entli", "ent"},
+	{"eli", "e"}, {"ousli", "ous"}, {"ization", "ize"}, {"ation", "ate"},
+	{"ator", "ate"}, {"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"},
+	{"ousness", "ous"}, {"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"},
+}
+
+var porterStep3 = [][2]string{
+	{"icate", "ic"}, {"ative", ""}, {"alize", "al"}, {"iciti", "ic"},
+	{"ical", "ic"}, {"ful", ""}, {"ness", ""},
+}
+
+var porterStep4 = []string{
+	"al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+	"ent", "ion", "ou", "ism", "ate", "iti", "ous", "ive", "ize",
+}
+
+func (w porterWord) step2() porterWord {
+	return w.replaceFirst(porterStep2, 0)
+}
+
+func (w porterWord) step3() porterWord {
+	return w.replaceFirst(porterStep3, 0)
+}
+
+// step4 drops a suffix when the stem keeps a measure above 1; the longest
+// matching suffix decides, and "ion" only goes after s or t.
+func (w porterWord) step4() porterWord {
+	suffix := ""
+	for _, s := range porterStep4 {
+		if w.hasSuffix(s) && len(s) > len(suffix) {
+			suffix = s
+		}
+	}
+	if suffix == "" {
+		return w
+	}
+
+	stem := w[:len(w)-len(suffix)]
+	if suffix == "ion" && !(stem.hasSuffix("s") || stem.hasSuffix("t")) {
+		return w
+	}
+	if stem.measure() > 1 {
+		return stem
+	}
+	return w
+}
+
+func (w porterWord) step5() porterWord {
+	if w.hasSuffix("e") {
+		stem := w[:len(w)-1]
+		if m := stem.measure(); m > 1 || (m == 1 && !stem.cvc()) {
+			w = stem
+		}
+	}
+	if w.measure() > 1 && w.doubleConsonant() && w[len(w)-1] == 'l' {
+		w = w[:len(w)-1]
+	}
+	return w
+}
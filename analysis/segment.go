@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"unicode"
+
+	"github.com/rivo/uniseg"
+)
+
+// Unicode word segmentation
+// Tokenize splits wherever a rune isn't a letter or a digit, which cuts words
+// apart at combining marks ("café" written with a separate accent) or apostrophes
+// and glues a whole line of Chinese or Japanese into one token, since those
+// languages don't put spaces between words. SegmentWords follows the word
+// boundaries of Unicode (UAX #29) instead and keeps the segments that contain a
+// letter or digit. It gives every Han and Hiragana character a token of its
+// own, which finds words but matches single characters.
+//
+// CJKBigrams goes one step further for Chinese and Japanese: every run of
+// adjacent Han, Hiragana and Katakana characters becomes its overlapping pairs,
+// "東京都" turning into "東京" and "京都", and a run of one stays as it is. Bigrams
+// need no dictionary and match words much better than single characters; queries
+// are analyzed the same way, so a word of several characters is a phrase of its
+// bigrams. Other scripts are segmented like SegmentWords does.
+func SegmentWords(text string) []string {
+	var r []string
+	state := -1
+	for text != "" {
+		var word string
+		word, text, state = uniseg.FirstWordInString(text, state)
+		if isWord(word) {
+			r = append(r, word)
+		}
+	}
+	return r
+}
+
+func CJKBigrams(text string) []string {
+	var r []string
+	var run []rune
+	flush := func() {
+		if len(run) == 1 {
+			r = append(r, string(run))
+		}
+		for i := 0; i+1 < len(run); i++ {
+			r = append(r, string(run[i:i+2]))
+		}
+		run = run[:0]
+	}
+
+	state := -1
+	for text != "" {
+		var word string
+		word, text, state = uniseg.FirstWordInString(text, state)
+		switch {
+		case isBigramScript(word):
+			run = append(run, []rune(word)...)
+		case isWord(word):
+			flush()
+			r = append(r, word)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return r
+}
+
+func isWord(segment string) bool {
+	for _, c := range segment {
+		if unicode.IsLetter(c) || unicode.IsNumber(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hangul is left out: Korean puts spaces between words.
+func isBigramScript(segment string) bool {
+	for _, c := range segment {
+		if !unicode.In(c, unicode.Han, unicode.Hiragana, unicode.Katakana) {
+			return false
+		}
+	}
+	return segment != ""
+}
+
+// Segmentation picks the tokenizer of the standard analyzer.
+type Segmentation int
+
+const (
+	SegmentLetters Segmentation = iota // Tokenize
+	SegmentUnicode                     // SegmentWords
+	SegmentCJK                         // CJKBigrams
+)
+
+func (s Segmentation) tokenize(text string) []string {
+	switch s {
+	case SegmentUnicode:
+		return SegmentWords(text)
+	case SegmentCJK:
+		return CJKBigrams(text)
+	}
+	return Tokenize(text)
+}
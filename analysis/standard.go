@@ -0,0 +1,187 @@
+package analysis
+
+import (
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// Standard analyzer
+// The zero value is the default pipeline: tokenize, lowercase, drop stopwords and
+// stem. Its options only switch built-in steps on and off or reorder them, which
+// keeps it plain data that can be saved along with an index.
+type Standard struct {
+	// CharFilters names the char filters run on the text before anything else,
+	// like CharFilterHTML; see Char filters.
+	CharFilters []string
+
+	// KeepEmailsAndURLs emits emails and URLs as single tokens, EmailURLParts
+	// additionally keeps the pieces the tokenizer would have split them into.
+	KeepEmailsAndURLs bool
+	EmailURLParts     bool
+
+	// Segmentation picks the tokenizer: letters and digits (the default),
+	// Unicode word boundaries or CJK bigrams, see SegmentWords.
+	Segmentation Segmentation
+
+	// SplitScriptBoundaries splits tokens that mix scripts, like "abcабв".
+	SplitScriptBoundaries bool
+
+	// Stopwords replaces the default English stopword list, see Stopwords and
+	// LoadStopwords. NoStopwords turns stopword filtering off altogether.
+	Stopwords   StopwordSet
+	NoStopwords bool
+
+	// Language is the ISO 639-1 code of the text, English if empty. It picks the
+	// Snowball stemmer and, unless Stopwords is set, the built-in stopword list;
+	// a language without either skips that step. Stemmer is StemSnowball (or
+	// empty), StemPorter for the original Porter stemmer, which is English only,
+	// or StemNone.
+	Language string
+	Stemmer  string
+
+	// Decompound splits compound words into the words of its dictionary, see
+	// Compound words.
+	Decompound *Decompounder
+
+	// Normalization is the Unicode normalization form the text is put into after
+	// the CharFilters, CharFilterNFC or CharFilterNFKC, none if empty.
+	// FoldAccents takes the diacritics off the tokens. See Unicode normalization
+	// and folding.
+	Normalization string
+	FoldAccents   bool
+
+	// Filters lists the steps after tokenizing by name, in order, replacing
+	// SplitScriptBoundaries, NoStopwords and the usual order; see Filter order.
+	Filters []string
+
+	// MinTokenLength and MaxTokenLength drop shorter and longer tokens, counted in
+	// characters, and DropPattern the tokens matching it; see Token length and
+	// patterns.
+	MinTokenLength int
+	MaxTokenLength int
+	DropPattern    string
+
+	// Keywords lists words the stopwords, decompound, stem, length and pattern
+	// steps leave alone, like "IT" or "Go"; see Keyword marker.
+	Keywords []string
+
+	// The tokens the stemmer passed through for being of another script, counted
+	// after CountStemSkipped; shared with the copies made by ForLanguage and
+	// Unstemmed.
+	stemSkipped *atomic.Int64
+}
+
+func (a *Standard) Analyze(text string) []string {
+	text = a.filterText(text, nil)
+	return a.filter(a.tokenRuns(text), nil)
+}
+
+// tokenRuns tokenizes text. With KeepEmailsAndURLs every email and URL is a run
+// of its own where it is in the text, followed by its parts with EmailURLParts:
+// they skip the filters, the stemmer would only mangle them, but keep their
+// positions for phrases and proximity.
+func (a *Standard) tokenRuns(text string) []tokenRun {
+	if !a.KeepEmailsAndURLs {
+		return []tokenRun{{tokens: a.Segmentation.tokenize(text)}}
+	}
+	var runs []tokenRun
+	at := 0
+	for _, m := range emailURLPattern.FindAllStringIndex(text, -1) {
+		unit := text[m[0]:m[1]]
+		runs = append(runs,
+			tokenRun{tokens: a.Segmentation.tokenize(text[at:m[0]])},
+			tokenRun{tokens: []string{strings.ToLower(unit)}, unit: true})
+		if a.EmailURLParts {
+			runs = append(runs, tokenRun{tokens: a.Segmentation.tokenize(unit)})
+		}
+		at = m[1]
+	}
+	return append(runs, tokenRun{tokens: a.Segmentation.tokenize(text[at:])})
+}
+
+func (a *Standard) stopwords() StopwordSet {
+	if a.Stopwords != nil {
+		return a.Stopwords
+	}
+	if a.Language != "" {
+		return builtinStopwordSet(a.Language)
+	}
+	return stopwords
+}
+
+// stemmer returns nil for no stemming.
+func (a *Standard) stemmer() func([]string) []string {
+	switch {
+	case a.Stemmer == StemNone:
+		return nil
+	case a.Stemmer == StemPorter:
+		return func(tokens []string) []string { return stemAll(tokens, unicode.Latin, PorterStem, a.stemSkipped) }
+	case a.Language == "":
+		return func(tokens []string) []string { return snowballStemmers["en"].filter(tokens, a.stemSkipped) }
+	}
+	s, ok := snowballStemmers[strings.ToLower(a.Language)]
+	if !ok {
+		return nil
+	}
+	return func(tokens []string) []string { return s.filter(tokens, a.stemSkipped) }
+}
+
+// CountStemSkipped makes a count the tokens its stemmer passes through untouched
+// for being of a script it doesn't know, from 0. Call it before analyzing
+// anything with a or its copies.
+func (a *Standard) CountStemSkipped() {
+	a.stemSkipped = new(atomic.Int64)
+}
+
+// StemSkipped is the number of tokens counted since CountStemSkipped, 0 without
+// it.
+func (a *Standard) StemSkipped() int64 {
+	if a.stemSkipped == nil {
+		return 0
+	}
+	return a.stemSkipped.Load()
+}
+
+// Unstemmed is a copy of a that doesn't stem.
+func (a *Standard) Unstemmed() Analyzer {
+	c := *a
+	c.Stemmer = StemNone
+	return &c
+}
+
+// ForLanguage is a copy of a for text in lang, with lang's stopwords.
+func (a *Standard) ForLanguage(lang string) Analyzer {
+	lang = strings.ToLower(lang)
+	if lang == "" || lang == a.Language {
+		return a
+	}
+	c := *a
+	c.Language, c.Stopwords = lang, nil
+	if c.Stemmer == StemPorter && lang != "en" {
+		c.Stemmer = StemSnowball
+	}
+	return &c
+}
+
+func (a *Standard) Stages(text string) []Stage {
+	var stages []Stage
+	text = a.filterText(text, &stages)
+
+	runs := a.tokenRuns(text)
+	if a.KeepEmailsAndURLs {
+		var units []string
+		for _, run := range runs {
+			if run.unit {
+				units = append(units, run.tokens...)
+			}
+		}
+		stages = append(stages, Stage{"emailurl", units})
+	}
+	stages = append(stages, Stage{"tokenize", joinRuns(runs)})
+
+	tokens := a.filter(runs, &stages)
+
+	stages = append(stages, Stage{"final", tokens})
+	return stages
+}
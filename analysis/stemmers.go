@@ -0,0 +1,90 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/kljensen/snowball/french"
+	"github.com/kljensen/snowball/hungarian"
+	"github.com/kljensen/snowball/norwegian"
+	"github.com/kljensen/snowball/russian"
+	"github.com/kljensen/snowball/spanish"
+	"github.com/kljensen/snowball/swedish"
+)
+
+// Stemmers by language
+// The Snowball stemmers we have, by ISO 639-1 code, with the script each of them
+// understands: tokens with letters of any other script pass through untouched,
+// like they do for English.
+type snowballStemmer struct {
+	stem   func(word string, stemStopWords bool) string
+	script *unicode.RangeTable
+}
+
+var snowballStemmers = map[string]snowballStemmer{
+	"en": {english.Stem, unicode.Latin},
+	"es": {spanish.Stem, unicode.Latin},
+	"fr": {french.Stem, unicode.Latin},
+	"hu": {hungarian.Stem, unicode.Latin},
+	"no": {norwegian.Stem, unicode.Latin},
+	"ru": {russian.Stem, unicode.Cyrillic},
+	"sv": {swedish.Stem, unicode.Latin},
+}
+
+// Stemmer names for Standard.Stemmer.
+const (
+	StemSnowball = "snowball"
+	StemPorter   = "porter"
+	StemNone     = "none"
+)
+
+// StemmerLanguages lists the languages with a Snowball stemmer.
+func StemmerLanguages() []string {
+	r := make([]string, 0, len(snowballStemmers))
+	for lang := range snowballStemmers {
+		r = append(r, lang)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// SnowballFilter stems with the Snowball stemmer for an ISO 639-1 language code.
+func SnowballFilter(lang string) (TokenFilter, bool) {
+	s, ok := snowballStemmers[strings.ToLower(lang)]
+	if !ok {
+		return nil, false
+	}
+	return namedFilter{"stem", func(tokens []string) []string {
+		return s.filter(tokens, nil)
+	}}, true
+}
+
+// PorterFilter stems with the original Porter stemmer, see PorterStem.
+func PorterFilter(tokens []string) []string {
+	return stemAll(tokens, unicode.Latin, PorterStem, nil)
+}
+
+// filter stems tokens, counting the ones of another script in skipped unless
+// it's nil.
+func (s snowballStemmer) filter(tokens []string, skipped *atomic.Int64) []string {
+	return stemAll(tokens, s.script, func(token string) string { return s.stem(token, false) }, skipped)
+}
+
+func stemAll(tokens []string, script *unicode.RangeTable, fn func(string) string, skipped *atomic.Int64) []string {
+	r := make([]string, len(tokens))
+
+	for i, token := range tokens {
+		if !stemmable(token, script) {
+			if skipped != nil {
+				skipped.Add(1)
+			}
+			r[i] = token
+			continue
+		}
+		r[i] = stem(token, fn)
+	}
+	return r
+}
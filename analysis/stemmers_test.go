@@ -0,0 +1,59 @@
+package analysis
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStemSkipped(t *testing.T) {
+	tests := []struct {
+		name     string
+		analyzer *Standard
+		text     string
+		want     []string
+		skipped  int64
+	}{
+		{"english", &Standard{}, "running cats", []string{"run", "cat"}, 0},
+		{"cyrillic through english", &Standard{}, "кошки", []string{"кошки"}, 1},
+		{"mixed", &Standard{}, "running кошки cats собаки", []string{"run", "кошки", "cat", "собаки"}, 2},
+		{"cjk through english", &Standard{}, "running 東京", []string{"run", "東京"}, 1},
+		{"porter", &Standard{Stemmer: StemPorter}, "running кошки", []string{"run", "кошки"}, 1},
+		{"russian", &Standard{Language: "ru"}, "кошки cats", []string{"кошк", "cats"}, 1},
+		{"unstemmed", &Standard{Stemmer: StemNone}, "running кошки", []string{"running", "кошки"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.analyzer.CountStemSkipped()
+			if got := tt.analyzer.Analyze(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Analyze(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if n := tt.analyzer.StemSkipped(); n != tt.skipped {
+				t.Errorf("StemSkipped() = %d, want %d", n, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestStemSkippedPerAnalyzer(t *testing.T) {
+	counted, other, uncounted := &Standard{}, &Standard{}, &Standard{}
+	counted.CountStemSkipped()
+	other.CountStemSkipped()
+	counted.Analyze("кошки собаки")
+	counted.ForLanguage("fr").Analyze("кошки")
+	other.Analyze("cats")
+	uncounted.Analyze("кошки")
+
+	for _, tt := range []struct {
+		name     string
+		analyzer *Standard
+		skipped  int64
+	}{
+		{"counted, with its copy", counted, 3},
+		{"other", other, 0},
+		{"not counting", uncounted, 0},
+	} {
+		if n := tt.analyzer.StemSkipped(); n != tt.skipped {
+			t.Errorf("%s: StemSkipped() = %d, want %d", tt.name, n, tt.skipped)
+		}
+	}
+}
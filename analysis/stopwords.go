@@ -0,0 +1,114 @@
+package analysis
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Stopword lists
+// A set of lowercased words to drop. Built-in lists cover the major European
+// languages; anything else can be loaded from a file.
+type StopwordSet map[string]struct{}
+
+func NewStopwordSet(words ...string) StopwordSet {
+	s := make(StopwordSet, len(words))
+	for _, w := range words {
+		s[strings.ToLower(w)] = struct{}{}
+	}
+	return s
+}
+
+// Stopwords returns the built-in list for an ISO 639-1 language code.
+func Stopwords(lang string) (StopwordSet, bool) {
+	words, ok := builtinStopwords[strings.ToLower(lang)]
+	if !ok {
+		return nil, false
+	}
+	return NewStopwordSet(strings.Fields(words)...), true
+}
+
+// languageStopwords holds the built-in list of every language an analyzer has
+// asked for, so it's built once rather than for every text analyzed. The sets
+// are shared and never changed.
+var languageStopwords sync.Map // of StopwordSet, nil for no list, by language
+
+func builtinStopwordSet(lang string) StopwordSet {
+	lang = strings.ToLower(lang)
+	if s, ok := languageStopwords.Load(lang); ok {
+		return s.(StopwordSet)
+	}
+	set, _ := Stopwords(lang)
+	s, _ := languageStopwords.LoadOrStore(lang, set)
+	return s.(StopwordSet)
+}
+
+// StopwordLanguages lists the languages with a built-in list.
+func StopwordLanguages() []string {
+	r := make([]string, 0, len(builtinStopwords))
+	for lang := range builtinStopwords {
+		r = append(r, lang)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// LoadStopwords reads one word per line. Blank lines and lines starting with #
+// are skipped.
+func LoadStopwords(path string) (StopwordSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadStopwords(f)
+}
+
+func ReadStopwords(r io.Reader) (StopwordSet, error) {
+	s := make(StopwordSet)
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s[strings.ToLower(line)] = struct{}{}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+var builtinStopwords = map[string]string{
+	"en": `a an and are as at be but by for from had has have he her his i if in into is
+		it its not of on or she so such that the their then there these they this to
+		was were will with you`,
+	"de": `aber alle als am an auch auf aus bei bin bis da das dass dem den der des die
+		doch du ein eine einem einen einer eines er es für hat ich ihr im in ist ja
+		kein mit nach nicht noch nur oder sich sie sind so und uns von war was wie wir
+		zu zum zur über`,
+	"fr": `au aux avec ce ces dans de des du elle en est et eux il ils je la le les leur
+		lui ma mais me même mes moi mon ne nos notre nous on ou par pas pour qu que qui
+		sa se ses son sur ta te tes toi ton tu un une vos votre vous`,
+	"es": `a al como con de del el ella ellos en es esta este fue ha la las le les lo los
+		me mi no nos o para pero por que se si sin sobre su sus también te un una uno
+		y ya`,
+	"it": `a al alla anche come con da dal del della di e gli ha i il in la le lo ma mi
+		ne nel non o per più se si sono su tra un una uno è`,
+	"pt": `a ao aos as com como da das de do dos e ela ele em era essa esse eu foi há
+		isso mais mas me meu na nas no nos não o os ou para pela pelo por que se sem
+		seu sua são também um uma você à`,
+	"nl": `aan al als bij dat de den der die dit door een en er had heb het hij hoe ik in
+		is je maar me met na naar niet nog of om ook op te tot uit van voor was wat
+		we wij zal ze zich zij zijn`,
+	"ru": `а без бы был была были было в вам вас весь во вот все всё вы где да для до
+		его ее если есть еще её же за и из или им их к как когда кто ли мне мы на
+		над не нет ни но ну о об он она они оно от по при с со так там то тоже только
+		у уже что чтобы эта это я`,
+}
@@ -0,0 +1,97 @@
+package analysis
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// Synonyms
+// Groups of words that should match each other, one group per line:
+//
+//	car,automobile,auto
+//
+// The words are run through the analyzer the index uses, so the groups hold terms
+// the way they end up in the dictionary ("automobiles" finds "car" too). Only
+// words that analyze to a single term take part; "new york,nyc" can't be
+// expressed. A term in several groups belongs to the last one.
+//
+// At query time Expand turns a term into its whole group. At index time Contract
+// is a filter that replaces every term by the first of its group, which keeps
+// positions (and therefore phrases) intact; the query side then has to contract
+// as well, e.g. with the same Chain. Build those synonyms with an analyzer that
+// stops where Contract sits in the chain, so the groups hold terms in the form the
+// filter sees them.
+type Synonyms struct {
+	groups map[string][]string
+}
+
+func NewSynonyms(groups [][]string, a Analyzer) *Synonyms {
+	s := &Synonyms{groups: make(map[string][]string)}
+	for _, words := range groups {
+		var group []string
+		for _, word := range words {
+			if tokens := a.Analyze(word); len(tokens) == 1 {
+				group = append(group, tokens[0])
+			}
+		}
+		if len(group) < 2 {
+			continue
+		}
+		for _, term := range group {
+			s.groups[term] = group
+		}
+	}
+	return s
+}
+
+// LoadSynonyms reads groups of comma-separated words, one per line. Blank lines and
+// lines starting with # are skipped.
+func LoadSynonyms(path string, a Analyzer) (*Synonyms, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadSynonyms(f, a)
+}
+
+func ReadSynonyms(r io.Reader, a Analyzer) (*Synonyms, error) {
+	var groups [][]string
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		groups = append(groups, strings.Split(line, ","))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return NewSynonyms(groups, a), nil
+}
+
+// Expand returns the group of an analyzed term, or just the term if it has no
+// synonyms. A nil *Synonyms has none.
+func (s *Synonyms) Expand(term string) []string {
+	if s != nil {
+		if group, ok := s.groups[term]; ok {
+			return group
+		}
+	}
+	return []string{term}
+}
+
+// Contract is a TokenFilter replacing each term by the first term of its group.
+func (s *Synonyms) Contract() TokenFilter {
+	return Named("synonyms", FilterFunc(func(tokens []string) []string {
+		for i, token := range tokens {
+			tokens[i] = s.Expand(token)[0]
+		}
+		return tokens
+	}))
+}
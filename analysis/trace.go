@@ -0,0 +1,170 @@
+package analysis
+
+import "fmt"
+
+// Token traces
+// Stages shows the tokens after every step; Explain follows each token through
+// them, to tell why a query doesn't match: the position it ends up at (what
+// phrases are matched against), the token it started as and every step that
+// changed it, and the tokens a step dropped, like stopwords. Steps don't say which
+// of their tokens came from which, so a stage's tokens are lined up with the ones
+// before it: tokens that stay the same are matched first, and what's left between
+// two of them is taken as rewritten one for one when the counts agree, as dropped
+// and added otherwise. The tokens of a step that adds some, like synonyms or
+// bigrams, start at that step.
+//
+// Analyze explains text for an analyzer by its registered name (see Register).
+type Analysis struct {
+	Analyzer string        `json:"analyzer,omitempty"`
+	Text     string        `json:"text"`
+	Tokens   []TracedToken `json:"tokens"`
+	Dropped  []TracedToken `json:"dropped,omitempty"`
+	Stages   []Stage       `json:"stages"`
+}
+
+// TracedToken is a token with the steps it went through, the first one being
+// where it came from. Position is -1 for a dropped token.
+type TracedToken struct {
+	Token    string `json:"token"`
+	Position int    `json:"position"`
+	Steps    []Step `json:"steps"`
+}
+
+// Step is a stage that changed a token, with what it made of it; an empty Token
+// means the stage dropped it.
+type Step struct {
+	Stage string `json:"stage"`
+	Token string `json:"token"`
+}
+
+func Analyze(name, text string) (Analysis, error) {
+	a, ok := Lookup(name)
+	if !ok {
+		return Analysis{}, fmt.Errorf("unknown analyzer %q", name)
+	}
+	r := Explain(a, text)
+	r.Analyzer = name
+	return r, nil
+}
+
+// Explain traces the tokens of text through the stages of a.
+func Explain(a Analyzer, text string) Analysis {
+	stages := Stages(a, text)
+	r := Analysis{Text: text, Stages: stages}
+
+	// The stages before tokenize rewrite the text, or set tokens aside that the
+	// tokenizer leaves in place (emailurl). Analyzers that don't report stages
+	// only have a final one.
+	first := 0
+	for i, s := range stages {
+		if s.Stage == "tokenize" {
+			first = i
+			break
+		}
+	}
+	setAside := make(map[string]string)
+	for _, s := range stages[:first] {
+		for _, t := range s.Tokens {
+			setAside[t] = s.Stage
+		}
+	}
+
+	origin := func(t, stage string) string {
+		if aside, ok := setAside[t]; ok {
+			return aside
+		}
+		return stage
+	}
+
+	var tokens []TracedToken
+	for _, t := range stages[first].Tokens {
+		tokens = append(tokens, TracedToken{Token: t, Steps: []Step{{origin(t, stages[first].Stage), t}}})
+	}
+	for _, s := range stages[first+1:] {
+		added := func(t string) string { return origin(t, s.Stage) }
+		var dropped []TracedToken
+		tokens, dropped = align(tokens, s.Tokens, s.Stage, added)
+		r.Dropped = append(r.Dropped, dropped...)
+	}
+	for i := range tokens {
+		tokens[i].Position = i
+	}
+	for i := range r.Dropped {
+		r.Dropped[i].Position = -1
+	}
+	r.Tokens = tokens
+	return r
+}
+
+// align lines the traced tokens before a stage up with the tokens after it,
+// returning the traced tokens after it and the ones it dropped. added names the
+// stage a new token came from.
+func align(before []TracedToken, after []string, stage string, added func(token string) string) ([]TracedToken, []TracedToken) {
+	old := make([]string, len(before))
+	for i, t := range before {
+		old[i] = t.Token
+	}
+	var r, dropped []TracedToken
+	i, j := 0, 0
+	for _, m := range commonTokens(old, after) {
+		a, b := before[i:m[0]], after[j:m[1]]
+		if len(a) == len(b) {
+			for k := range a {
+				r = append(r, rewritten(a[k], b[k], stage))
+			}
+		} else {
+			for _, t := range a {
+				t.Steps = append(t.Steps[:len(t.Steps):len(t.Steps)], Step{Stage: stage})
+				dropped = append(dropped, t)
+			}
+			for _, t := range b {
+				r = append(r, TracedToken{Token: t, Steps: []Step{{added(t), t}}})
+			}
+		}
+		if m[0] < len(old) {
+			r = append(r, before[m[0]])
+		}
+		i, j = m[0]+1, m[1]+1
+	}
+	return r, dropped
+}
+
+func rewritten(t TracedToken, token, stage string) TracedToken {
+	if t.Token != token {
+		t.Steps = append(t.Steps[:len(t.Steps):len(t.Steps)], Step{stage, token})
+		t.Token = token
+	}
+	return t
+}
+
+// commonTokens returns the index pairs of a longest common subsequence of a and
+// b, ending with len(a), len(b).
+func commonTokens(a, b []string) [][2]int {
+	// lengths[i][j] is the length of one of a[i:] and b[j:].
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	var r [][2]int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			r = append(r, [2]int{i, j})
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return append(r, [2]int{len(a), len(b)})
+}
@@ -0,0 +1,82 @@
+// Package bench measures the parts of the engine that decide how fast it is:
+// analysis, building the index, intersecting posting lists and end-to-end
+// searches. The benchmarks are in bench_test.go, run with go test -bench . ./bench;
+// -cpuprofile and -memprofile show where the time goes.
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Sample corpus
+// The benchmarks shouldn't depend on a multi-gigabyte dump being around, so they
+// run over documents made up from the words of the text below. Words are drawn
+// with a Zipf distribution in order of first appearance, which gives posting
+// lists the skew of real text: a few very long ones and a long tail of short ones.
+// The same seed always gives the same corpus, so numbers from different runs and
+// revisions can be compared.
+const sampleText = `The wildcat is a small wild cat species native to Europe, Asia and Africa.
+It is a solitary animal that lives in forests, grasslands and mountains and hunts
+rodents, birds and other small prey at night. The domestic cat descends from the
+African wildcat, which was tamed by early farmers when mice and rats threatened the
+stored grain of their first settlements. Wildcats are larger than domestic cats,
+with a thick striped coat, a broad head and a bushy tail ending in a black tip.
+Populations declined across their range because of habitat loss, hunting and
+interbreeding with feral cats, and several countries now protect them by law.
+Researchers track the remaining populations with camera traps and genetic tests
+to learn how far hybridization has spread. The lynx, the serval, the caracal and
+the ocelot are related species of medium size; the lion, tiger, leopard and jaguar
+belong to the big cats, whose roar comes from a specialized larynx. Cats have keen
+hearing, excellent night vision and retractable claws, and most species climb
+trees well. Kittens are born blind and open their eyes after about ten days.
+Ancient Egyptians worshipped cats, mummified them and punished anyone who harmed
+one; medieval Europe on the other hand often feared them as companions of witches.
+Today cats are among the most popular pets in the world, living with people in
+cities, villages and farms on every continent except Antarctica.`
+
+// Corpus returns n documents of the sample corpus, numbered from 0.
+func Corpus(n int) []index.Document {
+	vocab := vocabulary()
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.1, 2, uint64(len(vocab)-1))
+
+	words := func(n int) string {
+		w := make([]string, n)
+		for i := range w {
+			w[i] = vocab[zipf.Uint64()]
+		}
+		return strings.Join(w, " ")
+	}
+
+	docs := make([]index.Document, n)
+	for i := range docs {
+		docs[i] = index.Document{
+			ID:    i,
+			Title: words(2 + r.Intn(3)),
+			URL:   fmt.Sprintf("https://example.org/wiki/%d", i),
+			Text:  words(20 + r.Intn(60)),
+			Boost: index.DefaultBoost,
+		}
+	}
+	return docs
+}
+
+func vocabulary() []string {
+	var r []string
+	seen := make(map[string]bool)
+	for _, w := range analysis.LowercaseFilter(analysis.Tokenize(sampleText)) {
+		if !seen[w] {
+			seen[w] = true
+			r = append(r, w)
+		}
+	}
+	return r
+}
+
+// Queries are picked to cover frequent and rare terms, phrases and operators.
+var Queries = []string{"cat", "wild cat", "small wild cat species", `"wild cat"`, "cats AND (forests OR mountains) NOT tiger", "lynx~1"}
@@ -0,0 +1,75 @@
+package bench
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+)
+
+// corpusSize is the number of documents the benchmarks run over.
+const corpusSize = 10000
+
+var (
+	corpusOnce sync.Once
+	docs       []index.Document
+	built      *index.Index
+)
+
+// corpus returns the sample corpus and an index of it, made once for all the
+// benchmarks.
+func corpus() ([]index.Document, *index.Index) {
+	corpusOnce.Do(func() {
+		docs = Corpus(corpusSize)
+		built = index.New(nil)
+		built.Add(docs)
+	})
+	return docs, built
+}
+
+func BenchmarkAnalyze(b *testing.B) {
+	docs, _ := corpus()
+	var bytes int64
+	for _, doc := range docs {
+		bytes += int64(len(doc.Text))
+	}
+	b.SetBytes(bytes)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, doc := range docs {
+			analysis.Default.Analyze(doc.Text)
+		}
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	docs, _ := corpus()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index.New(nil).Add(docs)
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	_, idx := corpus()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, q := range Queries[:3] {
+			idx.SearchWithOptions(q, index.SearchOptions{Limit: 10})
+		}
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	_, idx := corpus()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, q := range Queries {
+			if _, _, err := search.QueryWithOptions(idx, q, index.SearchOptions{Limit: 10}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
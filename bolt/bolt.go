@@ -0,0 +1,97 @@
+// Package bolt keeps the posting lists of an index in a BoltDB file, see
+// index.Storage:
+//
+//	s, err := bolt.Open("postings.db")
+//	idx, err := index.NewWithStorage(nil, s)
+//	idx.Add(docs)
+//	err = idx.Commit()
+//
+// Every Commit is a BoltDB transaction, synced to disk before it returns, so the
+// file always holds the index as of some Commit.
+package bolt
+
+import (
+	"errors"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+var bucket = []byte("postings")
+
+// Storage is an index.Storage in a BoltDB file. BoltDB locks the file, so only
+// one process can have it open.
+type Storage struct {
+	db *bbolt.DB
+}
+
+var _ index.Storage = (*Storage)(nil)
+
+// OpenTimeout is how long Open waits for another process to let go of the file.
+var OpenTimeout = time.Second
+
+// Open opens the file at path, creating it if it doesn't exist.
+func Open(path string) (*Storage, error) {
+	db, err := bbolt.Open(path, 0o644, &bbolt.Options{Timeout: OpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Storage{db: db}, nil
+}
+
+func (s *Storage) Get(key string) ([]byte, error) {
+	var r []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		// Values are only valid during the transaction.
+		if v := tx.Bucket(bucket).Get([]byte(key)); v != nil {
+			r = append([]byte{}, v...)
+		}
+		return nil
+	})
+	return r, err
+}
+
+func (s *Storage) Keys() ([]string, error) {
+	var r []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, _ []byte) error {
+			r = append(r, string(k))
+			return nil
+		})
+	})
+	return r, err
+}
+
+func (s *Storage) Write(puts map[string][]byte, deletes []string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucket)
+		for _, key := range deletes {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		for key, v := range puts {
+			if key == "" {
+				return errors.New("empty key")
+			}
+			if err := b.Put([]byte(key), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,474 @@
+// Package cluster spreads a corpus over several fts-server nodes behind a
+// coordinator that speaks the same HTTP API as one of them.
+package cluster
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/server"
+)
+
+// Coordinator
+// Every node is an ordinary fts-server holding one shard of the documents. The
+// coordinator holds nothing: a new document goes to the node its URL (or, without
+// one, its title and text) hashes to, and a search is sent to every node at once,
+// each returning its best offset+limit hits, which are merged into the page.
+//
+// Nodes number their documents themselves, so the coordinator's IDs interleave
+// them: document id of node i is id*n+i to clients, with n nodes. That needs no
+// coordination between nodes, but it does mean the list of nodes can't change
+// order or length once documents are in.
+//
+// A node scores with the statistics of its own shard, so with shards of very
+// different content the same document can score differently than it would in one
+// index; with documents spread by hash that evens out. Facet counts are summed
+// over the top facet_size values of every node and can miss a value that's just
+// below the cut everywhere. With relax=1 every node relaxes the query as far as
+// its own shard needs, so some hits may match fewer terms than others. Sorting by
+// fields isn't supported across nodes.
+//
+//	GET  /search                 scattered to all nodes, hits merged
+//	POST /documents              routed to the document's node
+//	GET  /documents/{id}         routed to the node of the ID, as are PUT and DELETE
+//	POST /bulk                   split by node, results in the order sent
+//	GET  /cluster                the nodes and their statistics
+//
+// Requests to the nodes carry the caller's API key, or the coordinator's own one
+// set with SetNodeKey, and the headers set with SetForwardHeaders, like the one a
+// proxy puts the user's principals in for the nodes' ACLs. SetAuth makes the
+// coordinator itself check keys like a node does.
+type Coordinator struct {
+	nodes   []string // base URLs
+	client  *http.Client
+	mux     *http.ServeMux
+	handler http.Handler // mux, behind the keys of SetAuth if set
+
+	nodeKey string   // "" to send the caller's key on
+	forward []string // headers sent on as they came
+}
+
+// DefaultTimeout bounds every request to a node.
+const DefaultTimeout = 10 * time.Second
+
+func NewCoordinator(nodes []string) *Coordinator {
+	c := &Coordinator{client: &http.Client{Timeout: DefaultTimeout}, mux: http.NewServeMux()}
+	for _, node := range nodes {
+		c.nodes = append(c.nodes, strings.TrimRight(node, "/"))
+	}
+
+	c.mux.HandleFunc("GET /search", c.handleSearch)
+	c.mux.HandleFunc("POST /documents", c.handleAddDocument)
+	c.mux.HandleFunc("GET /documents/{id}", c.handleDocument)
+	c.mux.HandleFunc("PUT /documents/{id}", c.handleDocument)
+	c.mux.HandleFunc("DELETE /documents/{id}", c.handleDocument)
+	c.mux.HandleFunc("POST /bulk", c.handleBulk)
+	c.mux.HandleFunc("GET /cluster", c.handleCluster)
+	c.handler = c.mux
+	return c
+}
+
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.handler.ServeHTTP(w, r)
+}
+
+// SetAuth makes requests to the coordinator need the keys of a, see
+// server.Auth. Call it before serving.
+func (c *Coordinator) SetAuth(a server.Auth) {
+	c.handler = server.Protect(c.mux, a)
+}
+
+// SetNodeKey has the coordinator send key to the nodes instead of the caller's.
+func (c *Coordinator) SetNodeKey(key string) {
+	c.nodeKey = key
+}
+
+// SetForwardHeaders sends the headers named on to the nodes.
+func (c *Coordinator) SetForwardHeaders(names ...string) {
+	c.forward = names
+}
+
+// Route is the node a new document goes to.
+func (c *Coordinator) Route(doc index.Document) int {
+	h := fnv.New32a()
+	if doc.URL != "" {
+		h.Write([]byte(doc.URL))
+	} else {
+		h.Write([]byte(doc.Title + "\x00" + doc.Text))
+	}
+	return int(h.Sum32() % uint32(len(c.nodes)))
+}
+
+// global and local convert between the coordinator's IDs and a node's.
+func (c *Coordinator) global(node, id int) int {
+	return id*len(c.nodes) + node
+}
+
+func (c *Coordinator) local(id int) (node, local int) {
+	return id % len(c.nodes), id / len(c.nodes)
+}
+
+// NodeError is a node that failed or answered with an error status.
+type NodeError struct {
+	Node   string
+	Status int // 0 if there was no response
+	Err    error
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("node %s: %v", e.Node, e.Err)
+}
+
+func (e *NodeError) Unwrap() error { return e.Err }
+
+// call sends a request to node i on behalf of r and decodes a JSON response into
+// v, if given.
+func (c *Coordinator) call(r *http.Request, i int, method, path string, body []byte, v any) error {
+	req, err := http.NewRequestWithContext(r.Context(), method, c.nodes[i]+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.nodeKey != "" {
+		req.Header.Set("X-API-Key", c.nodeKey)
+	} else {
+		for _, name := range []string{"X-API-Key", "Authorization"} {
+			if v := r.Header.Get(name); v != "" {
+				req.Header.Set(name, v)
+			}
+		}
+	}
+	for _, name := range c.forward {
+		if v := r.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return &NodeError{Node: c.nodes[i], Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return &NodeError{Node: c.nodes[i], Status: resp.StatusCode, Err: errors.New(strings.TrimSpace(string(msg)))}
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// each runs fn for every node at once and returns the first error.
+func (c *Coordinator) each(fn func(i int) error) error {
+	errs := make([]error, len(c.nodes))
+	var wg sync.WaitGroup
+	for i := range c.nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// fail answers with the status a node answered with, or 502 for a node that
+// couldn't be reached.
+func fail(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	var ne *NodeError
+	if errors.As(err, &ne) && ne.Status != 0 {
+		status = ne.Status
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (c *Coordinator) handleSearch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	q := r.URL.Query()
+	if q.Get("sort") != "" {
+		http.Error(w, "sorting by fields isn't supported across nodes", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := server.DefaultLimit, 0
+	for _, param := range []struct {
+		name string
+		v    *int
+	}{{"limit", &limit}, {"offset", &offset}} {
+		if v := q.Get(param.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "bad "+param.name+" parameter", http.StatusBadRequest)
+				return
+			}
+			*param.v = n
+		}
+	}
+	facetSize := server.DefaultFacetSize
+	if v, err := strconv.Atoi(q.Get("facet_size")); err == nil {
+		facetSize = v
+	}
+
+	// Every node's first offset+limit hits are enough to make up the page.
+	q.Set("limit", strconv.Itoa(offset+limit))
+	q.Set("offset", "0")
+	path := "/search?" + q.Encode()
+
+	responses := make([]server.SearchResponse, len(c.nodes))
+	if err := c.each(func(i int) error {
+		return c.call(r, i, http.MethodGet, path, nil, &responses[i])
+	}); err != nil {
+		fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.merge(responses, r.URL.Query().Get("q"), limit, offset, facetSize, start))
+}
+
+// merge makes one response of the nodes' ones.
+func (c *Coordinator) merge(responses []server.SearchResponse, query string, limit, offset, facetSize int, start time.Time) server.SearchResponse {
+	resp := server.SearchResponse{Query: query, Hits: []server.Hit{}}
+	facets := make(map[string]map[string]int)
+	for i, nr := range responses {
+		resp.Total += nr.Total
+		for _, hit := range nr.Hits {
+			hit.ID = c.global(i, hit.ID)
+			resp.Hits = append(resp.Hits, hit)
+		}
+		for field, counts := range nr.Facets {
+			if facets[field] == nil {
+				facets[field] = make(map[string]int)
+			}
+			for _, fc := range counts {
+				facets[field][fc.Value] += fc.Count
+			}
+		}
+		if resp.DidYouMean == "" {
+			resp.DidYouMean = nr.DidYouMean
+		}
+		resp.TimedOut = resp.TimedOut || nr.TimedOut
+		resp.Relaxed = resp.Relaxed || nr.Relaxed
+	}
+
+	sort.Slice(resp.Hits, func(i, j int) bool {
+		a, b := resp.Hits[i], resp.Hits[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.ID < b.ID
+	})
+	resp.Hits = resp.Hits[min(offset, len(resp.Hits)):]
+	resp.Hits = resp.Hits[:min(limit, len(resp.Hits))]
+	if resp.Total > 0 {
+		resp.DidYouMean = ""
+	}
+
+	if len(facets) > 0 {
+		resp.Facets = make(map[string][]index.FacetCount)
+		for field, counts := range facets {
+			r := []index.FacetCount{}
+			for value, n := range counts {
+				r = append(r, index.FacetCount{Value: value, Count: n})
+			}
+			sort.Slice(r, func(i, j int) bool {
+				if r[i].Count != r[j].Count {
+					return r[i].Count > r[j].Count
+				}
+				return r[i].Value < r[j].Value
+			})
+			resp.Facets[field] = r[:min(facetSize, len(r))]
+		}
+	}
+	resp.Took = time.Since(start).String()
+	return resp
+}
+
+func (c *Coordinator) handleAddDocument(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var doc index.Document
+	if err := json.Unmarshal(body, &doc); err != nil {
+		http.Error(w, "bad document: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	node := c.Route(doc)
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := c.call(r, node, http.MethodPost, "/documents", body, &resp); err != nil {
+		fail(w, err)
+		return
+	}
+	resp.ID = c.global(node, resp.ID)
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleDocument forwards a request for one document to its node.
+func (c *Coordinator) handleDocument(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 0 {
+		http.Error(w, "bad document id", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) == 0 {
+		body = nil
+	}
+
+	node, local := c.local(id)
+	path := "/documents/" + strconv.Itoa(local)
+	if r.Method == http.MethodDelete {
+		if err := c.call(r, node, r.Method, path, nil, nil); err != nil {
+			fail(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var doc index.Document
+	if err := c.call(r, node, r.Method, path, body, &doc); err != nil {
+		fail(w, err)
+		return
+	}
+	doc.ID = id
+	writeJSON(w, http.StatusOK, doc)
+}
+
+func (c *Coordinator) handleBulk(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var items []server.BulkItem
+	dec := json.NewDecoder(r.Body)
+	for {
+		var item server.BulkItem
+		if err := dec.Decode(&item); err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("bad item %d: %v", len(items), err), http.StatusBadRequest)
+			return
+		}
+		items = append(items, item)
+	}
+
+	// The items of every node, and where each came from.
+	bodies := make([]bytes.Buffer, len(c.nodes))
+	positions := make([][]int, len(c.nodes))
+	for i, item := range items {
+		node := 0
+		if item.Op == index.BulkAdd {
+			if item.Document != nil {
+				node = c.Route(*item.Document)
+			}
+		} else {
+			node, item.ID = c.local(item.ID)
+		}
+		json.NewEncoder(&bodies[node]).Encode(item)
+		positions[node] = append(positions[node], i)
+	}
+
+	resp := server.BulkResponse{Items: make([]server.BulkItemResult, len(items))}
+	responses := make([]server.BulkResponse, len(c.nodes))
+	if err := c.each(func(i int) error {
+		if len(positions[i]) == 0 {
+			return nil
+		}
+		return c.call(r, i, http.MethodPost, "/bulk", bodies[i].Bytes(), &responses[i])
+	}); err != nil {
+		fail(w, err)
+		return
+	}
+	for node, nr := range responses {
+		for j, res := range nr.Items {
+			res.ID = c.global(node, res.ID)
+			resp.Items[positions[node][j]] = res
+		}
+		resp.Errors += nr.Errors
+	}
+	resp.Took = time.Since(start).String()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// NodeStats is what GET /cluster says about a node.
+type NodeStats struct {
+	Node  string       `json:"node"`
+	Stats *index.Stats `json:"stats,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+func (c *Coordinator) handleCluster(w http.ResponseWriter, r *http.Request) {
+	nodes := make([]NodeStats, len(c.nodes))
+	c.each(func(i int) error {
+		nodes[i].Node = c.nodes[i]
+		var st index.Stats
+		if err := c.call(r, i, http.MethodGet, "/stats", nil, &st); err != nil {
+			nodes[i].Error = err.Error()
+			return nil
+		}
+		nodes[i].Stats = &st
+		return nil
+	})
+
+	documents := 0
+	for _, n := range nodes {
+		if n.Stats != nil {
+			documents += n.Stats.Documents
+		}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Documents int         `json:"documents"`
+		Nodes     []NodeStats `json:"nodes"`
+	}{documents, nodes})
+}
+
+// ParseNodes reads a comma-separated list of node addresses, adding http:// to
+// the ones without a scheme.
+func ParseNodes(list string) ([]string, error) {
+	var nodes []string
+	for _, node := range strings.Split(list, ",") {
+		node = strings.TrimSpace(node)
+		if node == "" {
+			continue
+		}
+		if !strings.Contains(node, "://") {
+			node = "http://" + node
+		}
+		if _, err := url.Parse(node); err != nil {
+			return nil, fmt.Errorf("bad node %q: %v", node, err)
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no nodes")
+	}
+	return nodes, nil
+}
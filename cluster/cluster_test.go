@@ -0,0 +1,111 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/server"
+)
+
+func TestCoordinatorAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(c *Coordinator)
+		header  http.Header // of the request to the coordinator
+		status  int
+		forward http.Header // headers the nodes must get, nil if they mustn't be called
+	}{
+		{
+			name:    "caller's key",
+			header:  http.Header{"X-Api-Key": {"k"}},
+			status:  http.StatusOK,
+			forward: http.Header{"X-Api-Key": {"k"}},
+		},
+		{
+			name:    "bearer token",
+			header:  http.Header{"Authorization": {"Bearer k"}},
+			status:  http.StatusOK,
+			forward: http.Header{"Authorization": {"Bearer k"}},
+		},
+		{
+			name:    "node key",
+			setup:   func(c *Coordinator) { c.SetNodeKey("n") },
+			header:  http.Header{"Authorization": {"Bearer k"}},
+			status:  http.StatusOK,
+			forward: http.Header{"X-Api-Key": {"n"}, "Authorization": nil},
+		},
+		{
+			name:    "principals",
+			setup:   func(c *Coordinator) { c.SetForwardHeaders("X-Principals") },
+			header:  http.Header{"X-Principals": {"alice,staff"}},
+			status:  http.StatusOK,
+			forward: http.Header{"X-Principals": {"alice,staff"}},
+		},
+		{
+			name: "no key at a private coordinator",
+			setup: func(c *Coordinator) {
+				c.SetAuth(server.Auth{Keys: map[string]server.Access{"k": server.AccessRead}, Private: true})
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "key at a private coordinator",
+			setup: func(c *Coordinator) {
+				c.SetAuth(server.Auth{Keys: map[string]server.Access{"k": server.AccessRead}, Private: true})
+			},
+			header:  http.Header{"X-Api-Key": {"k"}},
+			status:  http.StatusOK,
+			forward: http.Header{"X-Api-Key": {"k"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var got []http.Header
+			node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				got = append(got, r.Header.Clone())
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"results":[]}`))
+			}))
+			defer node.Close()
+
+			c := NewCoordinator([]string{node.URL, node.URL})
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			req := httptest.NewRequest("GET", "/search?q=cat", nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+			c.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.forward == nil {
+				if len(got) != 0 {
+					t.Fatalf("%d requests reached the nodes", len(got))
+				}
+				return
+			}
+			if len(got) != 2 {
+				t.Fatalf("%d requests reached the nodes, want 2", len(got))
+			}
+			for _, h := range got {
+				for name, values := range tt.forward {
+					want := ""
+					if len(values) > 0 {
+						want = values[0]
+					}
+					if v := h.Get(name); v != want {
+						t.Errorf("node got %s %q, want %q", name, v, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+// Command fts-server serves an index over HTTP as a small search microservice.
+// It takes the same server flags as fts serve, but serves a saved index and a
+// store file rather than an index directory, built from a dump if they're
+// missing. -config names a file with the settings of the flags not given (see
+// package config).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/cmd/internal/serving"
+	"github.com/leoashish/FullTextSearchApp/config"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+	"github.com/leoashish/FullTextSearchApp/server"
+	"github.com/leoashish/FullTextSearchApp/store"
+	"github.com/leoashish/FullTextSearchApp/wal"
+)
+
+func main() {
+	input := flag.String("input", "enwiki-latest-abstract1.xml", "Wikipedia abstract dump to serve")
+	indexPath := flag.String("index", "enwiki-latest-abstract1.idx", "saved index, built from -input if missing")
+	storePath := flag.String("store", "", "document store file, filled from -input if empty; without it the documents are kept in memory")
+	addr := flag.String("addr", ":8080", "address to listen on")
+	restore := flag.String("restore", "", "snapshot directory or tarball to restore -index and -store from before starting")
+	walPath := flag.String("wal", "", "write-ahead log to record changes in and replay on startup; needs -store")
+	queryLog := flag.String("query-log", "", "file to log the queries that find something in and suggest them from with GET /complete?queries=1")
+	percolator := flag.String("percolator", "", "file to keep standing queries in, which new documents are matched against (see PUT /percolator/{id})")
+	flags := serving.Register(flag.CommandLine)
+	configPath := flag.String("config", "", "YAML, TOML or JSON file of settings for the flags not given, "+config.Env+" if empty")
+	flag.Parse()
+	if err := config.ApplyFile(flag.CommandLine, *configPath); err != nil {
+		log.Fatal(err)
+	}
+	s, err := flags.Setup()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flags.Nodes != "" {
+		if err := s.Coordinate(*addr); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *walPath != "" && *storePath == "" {
+		log.Fatal("-wal needs -store")
+	}
+	if *restore != "" {
+		if *storePath == "" {
+			log.Fatal("-restore needs -store")
+		}
+		if err := server.Restore(*restore, *indexPath, *storePath); err != nil {
+			log.Fatal(err)
+		}
+		// Changes logged before are not for the snapshot.
+		if *walPath != "" {
+			if err := os.Remove(*walPath); err != nil && !os.IsNotExist(err) {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	var docs store.Store
+	if *storePath != "" {
+		f, err := store.Open(*storePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		docs = f
+	}
+
+	// The dump is only read if the index or the store have to be made from it.
+	var loaded []index.Document
+	load := func() []index.Document {
+		if loaded == nil {
+			var err error
+			loaded, err = index.LoadDocuments(*input)
+			var bad index.ParseErrors
+			if errors.As(err, &bad) {
+				slog.Warn("skipped bad records", "input", *input, "records", len(bad), "first", bad[0].Error())
+			} else if err != nil {
+				log.Fatal(err)
+			}
+			if flags.Detect {
+				index.DetectLanguages(loaded)
+			}
+		}
+		return loaded
+	}
+
+	if docs == nil {
+		docs = store.NewMemory(load())
+	} else if docs.Len() == 0 {
+		for _, doc := range load() {
+			if err := docs.Put(doc); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	idx, err := index.Load(*indexPath)
+	if os.IsNotExist(err) {
+		idx = index.New(nil)
+		idx.AddConcurrentWithOptions(load(), runtime.NumCPU(), index.Options{Progress: logProgress, ProgressEvery: 10 * time.Second})
+		err = idx.Save(*indexPath)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	loaded = nil
+	if err := s.Index(idx); err != nil {
+		log.Fatal(err)
+	}
+
+	srv := server.New(idx, docs)
+	// The refreshes and checkpoints stop before the last flush of a shutdown.
+	stop := make(chan struct{})
+	s.Server(srv, "", stop)
+	s.Guard(srv)
+	srv.SetSnapshotDir(s.Snapshots)
+	// SIGHUP and POST /reload load -index and -store anew, say after they were
+	// replaced by ones built elsewhere. The documents of a dump are read once.
+	if *storePath != "" && *walPath == "" {
+		srv.SetReload(func() (*index.Index, store.Store, error) {
+			idx, err := index.Load(*indexPath)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := s.Index(idx); err != nil {
+				return nil, nil, err
+			}
+			docs, err := store.Open(*storePath)
+			if err != nil {
+				return nil, nil, err
+			}
+			return idx, docs, nil
+		})
+	}
+	if *queryLog != "" {
+		l, err := search.OpenQueryLog(*queryLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer l.Close()
+		srv.SetQueryLog(l)
+	}
+	if *percolator != "" {
+		p, err := search.OpenPercolator(*percolator, idx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer p.Close()
+		srv.SetPercolator(p)
+	}
+	if *walPath != "" {
+		l, err := wal.Open(*walPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer l.Close()
+		n, err := srv.SetWAL(l)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if n > 0 {
+			slog.Info("replayed the write-ahead log", "changes", n, "wal", *walPath)
+		}
+		go srv.CheckpointEvery(*indexPath, s.Checkpoint, stop, func(err error) { slog.Error("checkpoint", "error", err) })
+	}
+
+	// Without a store file the documents are the dump's, which a saved index
+	// with changes made since wouldn't match, so the index is only saved with one.
+	save := ""
+	if *storePath != "" {
+		save = *indexPath
+	}
+	slog.Info("serving", "documents", docs.Len(), "addr", *addr)
+	err = s.Serve(*addr, srv, srv, func() []*server.Server { return []*server.Server{srv} }, func(context.Context) error {
+		close(stop)
+		return srv.Flush(save)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func logProgress(p index.Progress) {
+	attrs := []any{"documents", p.Documents, "total", p.Total, "rate", int(p.Rate())}
+	if d, ok := p.ETA(); ok && !p.Done {
+		attrs = append(attrs, "eta", d.Round(time.Second))
+	}
+	slog.Info("indexed", attrs...)
+}
@@ -0,0 +1,1098 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/bolt"
+	"github.com/leoashish/FullTextSearchApp/cmd/internal/serving"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+	"github.com/leoashish/FullTextSearchApp/server"
+	"github.com/leoashish/FullTextSearchApp/store"
+	"github.com/leoashish/FullTextSearchApp/wal"
+)
+
+// Index directories
+// fts index writes a directory with the saved index and a store of the documents
+// it was built from, so search, serve and stats need nothing but the directory.
+// That's also what a server snapshot is. fts serve -wal adds a write-ahead log,
+// -query-log a log of the queries to suggest, and -percolator the standing queries
+// new documents are matched against.
+// fts index -storage bolt keeps the posting lists in a BoltDB file instead of the
+// saved index, which every change is committed to, and -storage mapped writes the
+// index for OpenDisk to memory-map: it opens at once and reads a posting list on
+// first use, but can't change, so a server refuses changes to it with 403.
+const (
+	indexFile      = server.SnapshotIndexFile
+	storeFile      = server.SnapshotStoreFile
+	postingsFile   = "postings.db"
+	mappedFile     = "index.ftsd"
+	walFile        = "changes.wal"
+	queryLogFile   = "queries.jsonl"
+	percolatorFile = "percolator.jsonl"
+)
+
+// exists reports whether there's a file at path.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func openIndexDir(dir string) (*index.Index, *store.File, error) {
+	idx, err := loadIndexDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	docs, err := store.Open(filepath.Join(dir, storeFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	return idx, docs, nil
+}
+
+// loadIndexDir opens the index of a directory, from its BoltDB file or mapped
+// index if it has one.
+func loadIndexDir(dir string) (*index.Index, error) {
+	if path := filepath.Join(dir, mappedFile); exists(path) {
+		return index.OpenDisk(path, nil)
+	}
+	path := filepath.Join(dir, postingsFile)
+	if !exists(path) {
+		return index.Load(filepath.Join(dir, indexFile))
+	}
+	s, err := bolt.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := index.NewWithStorage(nil, s)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return idx, nil
+}
+
+var dedupModes = map[string]index.DedupMode{"none": index.DedupNone, "url": index.DedupURL, "exact": index.DedupContentHash, "near": index.DedupNear}
+
+var duplicatePolicies = map[string]index.DuplicatePolicy{"skip": index.DuplicateSkip, "replace": index.DuplicateReplace, "tag": index.DuplicateTag}
+
+// fts index -input dump.xml|app.db [-sql query] [-map fields] [-storage bolt] [-char-filters html] [-filters lowercase,stem,stopwords] [-min-length 2] [-drop-pattern re] [-decompound words.txt] [-keywords words.txt] [-normalize nfkc] [-fold] [-detect-language] [-host] [-offsets] [-field-gap 100] [-exact-forms] [-min-term-freq 2,title=1] [-memory-limit 2GB] -out dir
+func runIndex(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	input := fs.String("input", "enwiki-latest-abstract1.xml", "documents to index: the abstract dump, JSON lines or CSV, optionally compressed")
+	sqlQuery := fs.String("sql", "", "index the rows of this query of the SQLite database -input instead, like SELECT name AS title, body AS text FROM posts")
+	mapping := fs.String("map", "", "the columns or properties the fields are in, like title=name,text=body,keywords=tag,numbers=price")
+	out := fs.String("out", "", "index directory to write")
+	workers := fs.Int("workers", runtime.NumCPU(), "documents analyzed in parallel")
+	dedup := fs.String("dedup", "none", "find duplicates by url, exact text or near-identical text (near)")
+	duplicates := fs.String("duplicates", "skip", "what to do with a duplicate: skip, replace the first one, or tag it with "+index.DuplicateField)
+	charFilters := fs.String("char-filters", "", "markup to strip before tokenizing, like html or markdown (one of "+strings.Join(analysis.CharFilterNames(), ", ")+")")
+	filters := fs.String("filters", "", "analysis steps after tokenizing, in order, like lowercase,stem,stopwords (one of "+strings.Join(analysis.FilterNames(), ", ")+")")
+	minLength := fs.Int("min-length", 0, "drop terms shorter than this many characters")
+	maxLength := fs.Int("max-length", 0, "drop terms longer than this many characters, 0 for no limit")
+	dropPattern := fs.String("drop-pattern", "", "drop terms matching this regular expression, like "+analysis.DigitsPattern+" for numbers")
+	decompound := fs.String("decompound", "", "a dictionary file, one word per line, to split compound words into the words in it")
+	keywords := fs.String("keywords", "", "a file of words, one per line, that aren't stemmed or dropped as stopwords, like IT or Go")
+	normalize := fs.String("normalize", "", "Unicode normalization form to put terms into: nfc, or nfkc to also replace ligatures, full-width letters and the like")
+	fold := fs.Bool("fold", false, "take the accents off terms, so café matches cafe")
+	detect := fs.Bool("detect-language", false, "detect the language of documents that don't declare one and analyze them accordingly")
+	storage := fs.String("storage", "memory", "where the posting lists are kept: memory, saved as a whole, bolt, a BoltDB file every change is committed to, or mapped, a read-only file the posting lists are read from as needed")
+	host := fs.Bool("host", false, "index the host of every URL as the keyword field "+index.HostField+", to collapse results on")
+	offsets := fs.Bool("offsets", false, "store where every term's words are, so results are highlighted without analyzing their text again")
+	exactForms := fs.Bool("exact-forms", false, "index the text and title unstemmed as well, for ranking the words as they were typed above their other forms")
+	fieldGap := fs.Int("field-gap", 0, fmt.Sprintf("index the text and title once more as the field %s, this many positions apart so phrases don't match across them (%d is plenty), 0 not to", index.FieldAll, index.DefaultFieldGap))
+	minTermFreq := fs.String("min-term-freq", "", "drop the terms found in fewer than N documents, which can't be searched for then: N for every field, field=N for one, like 2,title=1")
+	progress := fs.Bool("progress", true, "report the documents indexed, the rate and the time left on stderr")
+	memoryLimit := fs.String("memory-limit", "", "memory the index may take, like 2GB; with -storage bolt it's flushed to disk when it's reached, otherwise indexing stops")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *out == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fts index [-input file] [-sql query] [-map field=column,...] [-storage memory|bolt|mapped] [-workers N] [-dedup url|exact|near] [-duplicates skip|replace|tag] [-char-filters names] [-filters names] [-min-length N] [-max-length N] [-drop-pattern re] [-decompound words.txt] [-keywords words.txt] [-normalize nfc|nfkc] [-fold] [-detect-language] [-host] [-offsets] [-field-gap N] [-exact-forms] [-min-term-freq [field=]N,...] [-memory-limit size] -out dir")
+	}
+	limit, err := parseMemoryLimit(*memoryLimit)
+	if err != nil {
+		return err
+	}
+	fields, err := index.ParseFieldMapping(*mapping)
+	if err != nil {
+		return err
+	}
+	var analyzer analysis.Analyzer
+	if *filters != "" || *charFilters != "" || *minLength != 0 || *maxLength != 0 || *dropPattern != "" || *decompound != "" || *keywords != "" || *normalize != "" || *fold {
+		std := &analysis.Standard{
+			CharFilters:    analysis.ParseFilters(*charFilters),
+			Filters:        analysis.ParseFilters(*filters),
+			MinTokenLength: *minLength,
+			MaxTokenLength: *maxLength,
+			DropPattern:    *dropPattern,
+			Normalization:  *normalize,
+			FoldAccents:    *fold,
+		}
+		if *decompound != "" {
+			var err error
+			if std.Decompound, err = analysis.LoadDecompounder(*decompound); err != nil {
+				return err
+			}
+		}
+		if *keywords != "" {
+			var err error
+			if std.Keywords, err = analysis.LoadKeywords(*keywords); err != nil {
+				return err
+			}
+		}
+		if err := std.Validate(); err != nil {
+			return err
+		}
+		analyzer = std
+	}
+	mode, ok := dedupModes[*dedup]
+	if !ok {
+		return fmt.Errorf("unknown -dedup %q", *dedup)
+	}
+	policy, ok := duplicatePolicies[*duplicates]
+	if !ok {
+		return fmt.Errorf("unknown -duplicates %q", *duplicates)
+	}
+	if *storage != "memory" && *storage != "bolt" && *storage != "mapped" {
+		return fmt.Errorf("unknown -storage %q", *storage)
+	}
+
+	start := time.Now()
+	docs, err := loadDocuments(*input, fields, *sqlQuery)
+	if err != nil {
+		return err
+	}
+	detected := 0
+	if *detect {
+		detected = index.DetectLanguages(docs)
+	}
+	if *host {
+		for i, doc := range docs {
+			docs[i] = index.WithHost(doc)
+		}
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+
+	// A store left from an earlier run would keep documents the index no longer
+	// has, and an index of the other kind would be opened instead of this one.
+	storePath := filepath.Join(*out, storeFile)
+	for _, path := range []string{storePath, filepath.Join(*out, indexFile), filepath.Join(*out, postingsFile), filepath.Join(*out, mappedFile)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	s, err := store.Open(storePath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for _, doc := range docs {
+		if err := s.Put(doc); err != nil {
+			return err
+		}
+	}
+
+	idx := index.New(analyzer)
+	if *storage == "bolt" {
+		bs, err := bolt.Open(filepath.Join(*out, postingsFile))
+		if err != nil {
+			return err
+		}
+		if idx, err = index.NewWithStorage(analyzer, bs); err != nil {
+			return err
+		}
+		defer idx.Close()
+	}
+	idx.SetStoreOffsets(*offsets)
+	idx.SetFieldGap(*fieldGap)
+	idx.SetExactForms(*exactForms)
+	if err := setMinTermFreq(idx, *minTermFreq); err != nil {
+		return err
+	}
+	idx.SetMemoryLimit(limit)
+	opts := index.Options{DedupBy: mode, Duplicates: policy}
+	if *progress {
+		opts.Progress, opts.ProgressEvery = progressBar(os.Stderr)
+	}
+	var dups int
+	if limit > 0 {
+		var added int
+		if added, dups, err = idx.AddWithinLimit(docs, *workers, opts); err != nil {
+			return fmt.Errorf("after %d of %d documents: %w (-storage bolt flushes the index to disk instead)", added, len(docs), err)
+		}
+	} else if dups, err = idx.AddConcurrentWithOptions(docs, *workers, opts); err != nil {
+		return err
+	}
+	switch {
+	case idx.Storage() != nil:
+		err = idx.Commit()
+	case *storage == "mapped":
+		err = idx.SaveDisk(filepath.Join(*out, mappedFile))
+	default:
+		err = idx.Save(filepath.Join(*out, indexFile))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("indexed %d documents into %s in %s\n", len(docs), *out, time.Since(start).Round(time.Millisecond))
+	if dups > 0 {
+		fmt.Printf("%d duplicates (%s)\n", dups, *duplicates)
+	}
+	if *detect {
+		fmt.Printf("detected the language of %d documents\n", detected)
+	}
+	return nil
+}
+
+// fts search -index dir [-limit N] [-offset M] [-sort fields] [-collapse field] [-decay spec] [-diversify spec] [-knn field:vector] [-k N] [-exact] [-timeout D] [-min-match spec] [-relax] [-similarity spec] [query]
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	dir := fs.String("index", "", "index directory written by fts index")
+	limit := fs.Int("limit", 10, "results to show")
+	offset := fs.Int("offset", 0, "results to skip first")
+	sortBy := fs.String("sort", "", "fields to order the results by instead of relevance, like year:desc,title")
+	collapse := fs.String("collapse", "", "show only the best result of each value of this field, like host")
+	decay := fs.String("decay", "", "rank newer documents higher, like date:gauss(30d) or date:exp(7d,1d,0.3)")
+	diversify := fs.String("diversify", "", "let at most so many of the best results share a value of a field, like host:2 or host:2:500 for the best 500")
+	knn := fs.String("knn", "", "rank by nearness to a vector too, like embedding:0.1,0.3,0.2, or by it alone without a query")
+	k := fs.Int("k", index.DefaultK, "nearest neighbours to rank with -knn")
+	exact := fs.Bool("exact", false, "compare with every vector for -knn instead of searching the graph")
+	timeout := fs.Duration("timeout", 0, "give up on the search after this long, 0 for no limit")
+	var match search.MatchOptions
+	fs.StringVar(&match.MinimumShouldMatch, "min-match", "", "how many of the query's terms have to match, like 2, -1 or 75%")
+	fs.BoolVar(&match.Relax, "relax", false, "match fewer of the terms, down to any one, if all of them find nothing")
+	similarity := fs.String("similarity", "", "score with bm25(k1=1.2,b=0.75), tfidf, dfr or constant, per field like title=constant,bm25")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dir == "" || (fs.NArg() == 0 && *knn == "") {
+		return fmt.Errorf("usage: fts search -index dir [-limit N] [-offset M] [-sort fields] [-collapse field] [-decay spec] [-diversify spec] [-knn field:vector] [-k N] [-exact] [-timeout D] [-min-match spec] [-relax] [-similarity spec] [query]")
+	}
+	query := strings.Join(fs.Args(), " ")
+	opts := index.SearchOptions{Limit: *limit, Offset: *offset, Collapse: *collapse}
+	if *knn != "" {
+		q, err := index.ParseVectorQuery(*knn)
+		if err != nil {
+			return err
+		}
+		q.K, q.Exact = *k, *exact
+		opts.Vector = &q
+	}
+	if *sortBy != "" {
+		var err error
+		if opts.Sort, err = index.ParseSort(*sortBy); err != nil {
+			return err
+		}
+	}
+	if *decay != "" {
+		d, err := index.ParseDecay(*decay)
+		if err != nil {
+			return err
+		}
+		opts.Decay = &d
+	}
+	if *diversify != "" {
+		d, err := index.ParseDiversify(*diversify)
+		if err != nil {
+			return err
+		}
+		opts.Diversify = &d
+	}
+	scorer, err := parseScorer(*similarity)
+	if err != nil {
+		return err
+	}
+
+	idx, docs, err := openIndexDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+	defer idx.Close()
+	idx.SetScorer(scorer)
+
+	if err := idx.CheckSort(opts.Sort); err != nil {
+		return err
+	}
+	if err := idx.CheckCollapse(opts.Collapse); err != nil {
+		return err
+	}
+	if err := idx.CheckDecay(opts.Decay); err != nil {
+		return err
+	}
+	if err := idx.CheckDiversify(opts.Diversify); err != nil {
+		return err
+	}
+	if err := idx.CheckVector(opts.Vector); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	// Without a query every document is a hit, ranked by its vector alone.
+	ids, scoring, relaxed := idx.AllIDs(), index.Scoring{}, false
+	if query != "" {
+		if ids, scoring, relaxed, err = search.EvaluateMatch(ctx, idx, query, match); err != nil {
+			return err
+		}
+	}
+	results, err := idx.RankPageContext(ctx, ids, scoring, opts)
+	total := len(ids)
+	if err != nil && results == nil {
+		return err
+	}
+	fmt.Printf("%d results in %s\n", total, time.Since(start))
+	if relaxed {
+		fmt.Printf("no document has enough of the terms, showing those with the most\n")
+	}
+	if err != nil {
+		fmt.Printf("timed out, showing the best of the results ranked so far\n")
+	}
+	if total == 0 {
+		if corrected, ok := search.DidYouMean(idx, query); ok {
+			fmt.Printf("did you mean: %s?\n", corrected)
+		}
+		return nil
+	}
+
+	h := &search.Highlighter{Analyzer: idx.FieldAnalyzer(index.FieldText), Pre: "[", Post: "]"}
+	terms, _ := search.QueryTerms(idx, query, index.FieldText)
+	for i, res := range results {
+		doc, err := docs.Get(res.ID)
+		if err != nil {
+			return err
+		}
+		more := ""
+		if res.Collapsed > 0 {
+			more = fmt.Sprintf(" (+%d more)", res.Collapsed)
+		}
+		fmt.Printf("%3d. [%d] %.3f %s%s\n     %s\n", *offset+i+1, res.ID, res.Score, doc.Title, more, snippet(h, idx, res.ID, doc.Text, terms))
+	}
+	return nil
+}
+
+// parseMemoryLimit is index.ParseBytes, with 0 for "" for no limit.
+func parseMemoryLimit(size string) (int, error) {
+	if size == "" {
+		return 0, nil
+	}
+	n, err := index.ParseBytes(size)
+	if err != nil {
+		return 0, fmt.Errorf("-memory-limit: %w", err)
+	}
+	return n, nil
+}
+
+// setMinTermFreq sets the thresholds of a -min-term-freq spec on idx: N for
+// every field, field=N for one.
+func setMinTermFreq(idx *index.Index, spec string) error {
+	if spec == "" {
+		return nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		field, value, ok := strings.Cut(part, "=")
+		if !ok {
+			field, value = "", part
+		} else if !index.IsField(field) {
+			return fmt.Errorf("-min-term-freq: unknown field %q", field)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("-min-term-freq: bad threshold %q", value)
+		}
+		idx.SetMinTermFreq(field, n)
+	}
+	return nil
+}
+
+// parseScorer is index.ParseScorer, with nil for "" to keep the default.
+func parseScorer(spec string) (index.Scorer, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	return index.ParseScorer(spec)
+}
+
+// snippet highlights the text of document id with the offsets idx has stored for
+// it, or by analyzing it if there are none.
+func snippet(h *search.Highlighter, idx *index.Index, id int, text string, terms []string) string {
+	if offsets, ok := idx.Offsets(id, index.FieldText, terms); ok {
+		return h.SnippetOffsets(text, offsets)
+	}
+	return h.Snippet(text, terms)
+}
+
+// fts serve -index dir|-indices root [-port N] [-restore snapshot] [-wal] [-query-log] [-percolator] [server flags]
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dir := fs.String("index", "", "index directory written by fts index")
+	indices := fs.String("indices", "", "directory of index directories to serve under /indices/{name} instead, where PUT /indices/{name} creates more")
+	port := fs.Int("port", 8080, "port to listen on")
+	restore := fs.String("restore", "", "snapshot directory or tarball to replace the index directory's contents with first")
+	useWAL := fs.Bool("wal", false, "log changes to a write-ahead log in the index directory and replay it on startup")
+	queryLog := fs.Bool("query-log", false, "log the queries that find something in the index directory and suggest them with GET /complete?queries=1")
+	percolate := fs.Bool("percolator", false, "match new documents against standing queries kept in the index directory, see PUT /percolator/{id}")
+	flags := serving.Register(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if ((*dir == "") == (*indices == "") && flags.Nodes == "") || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fts serve -index dir|-indices root|-nodes list [-port N] [-restore snapshot] [-wal [-checkpoint D]] [-query-log] [-percolator] [-grpc addr] [-watch dir] [server flags, see -h]")
+	}
+	s, err := flags.Setup()
+	if err != nil {
+		return err
+	}
+	addr := fmt.Sprintf(":%d", *port)
+	if flags.Nodes != "" {
+		return s.Coordinate(addr)
+	}
+
+	// reopen loads the index directory dir again for a reload. An index with a
+	// storage has every change committed already, and a second BoltDB handle
+	// would wait for the first one's lock, so those aren't reloaded.
+	reopen := func(srv *server.Server, idx *index.Index, dir string) {
+		if idx.Storage() != nil {
+			return
+		}
+		srv.SetReload(func() (*index.Index, store.Store, error) {
+			idx, docs, err := openIndexDir(dir)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := s.Index(idx); err != nil {
+				idx.Close()
+				docs.Close()
+				return nil, nil, err
+			}
+			return idx, docs, nil
+		})
+	}
+	// The refreshes and checkpoints stop before the last flush of a shutdown.
+	stop := make(chan struct{})
+
+	if *indices != "" {
+		if *restore != "" || *useWAL || *queryLog || *percolate {
+			return fmt.Errorf("-restore, -wal, -query-log and -percolator are for a single -index")
+		}
+		m, closeAll, err := openIndices(*indices, func(srv *server.Server, idx *index.Index, name string) error {
+			if err := s.Index(idx); err != nil {
+				return err
+			}
+			reopen(srv, idx, filepath.Join(*indices, name))
+			s.Server(srv, name, stop)
+			if s.Snapshots != "" {
+				srv.SetSnapshotDir(filepath.Join(s.Snapshots, name))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		defer closeAll()
+		s.Guard(m)
+		servers := func() []*server.Server {
+			var servers []*server.Server
+			for _, name := range m.Names() {
+				if srv := m.Index(name); srv != nil {
+					servers = append(servers, srv)
+				}
+			}
+			return servers
+		}
+		s.Logger.Info("serving", "indices", len(m.Names()), "addr", addr)
+		return s.Serve(addr, m, nil, servers, func(context.Context) error {
+			close(stop)
+			var errs []error
+			for _, name := range m.Names() {
+				if srv := m.Index(name); srv != nil {
+					if err := srv.Flush(filepath.Join(*indices, name, indexFile)); err != nil {
+						errs = append(errs, fmt.Errorf("%s: %w", name, err))
+					}
+				}
+			}
+			return errors.Join(errs...)
+		})
+	}
+
+	if *restore != "" {
+		if err := os.MkdirAll(*dir, 0o755); err != nil {
+			return err
+		}
+		if err := server.Restore(*restore, filepath.Join(*dir, indexFile), filepath.Join(*dir, storeFile)); err != nil {
+			return err
+		}
+		// Changes logged before are not for the snapshot, and a snapshot is a
+		// saved index.
+		for _, file := range []string{walFile, postingsFile, mappedFile} {
+			if err := os.Remove(filepath.Join(*dir, file)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	idx, docs, err := openIndexDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+	defer idx.Close()
+	if idx.Storage() != nil && *useWAL {
+		return fmt.Errorf("-wal: an index with -storage bolt commits every change already")
+	}
+	if idx.Writable() != nil && *useWAL {
+		return fmt.Errorf("-wal: an index with -storage mapped can't change")
+	}
+	if err := s.Index(idx); err != nil {
+		return err
+	}
+
+	srv := server.New(idx, docs)
+	s.Server(srv, "", stop)
+	s.Guard(srv)
+	srv.SetSnapshotDir(s.Snapshots)
+	if !*useWAL {
+		reopen(srv, idx, *dir)
+	}
+	if *queryLog {
+		l, err := search.OpenQueryLog(filepath.Join(*dir, queryLogFile))
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		srv.SetQueryLog(l)
+	}
+	if *percolate {
+		p, err := search.OpenPercolator(filepath.Join(*dir, percolatorFile), idx)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		srv.SetPercolator(p)
+	}
+	if *useWAL {
+		l, err := wal.Open(filepath.Join(*dir, walFile))
+		if err != nil {
+			return err
+		}
+		defer l.Close()
+		n, err := srv.SetWAL(l)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			s.Logger.Info("replayed the write-ahead log", "changes", n)
+		}
+		go srv.CheckpointEvery(filepath.Join(*dir, indexFile), s.Checkpoint, stop, func(err error) { s.Logger.Error("checkpoint", "error", err) })
+	}
+	s.Logger.Info("serving", "documents", docs.Len(), "addr", addr)
+	return s.Serve(addr, srv, srv, func() []*server.Server { return []*server.Server{srv} }, func(context.Context) error {
+		close(stop)
+		return srv.Flush(filepath.Join(*dir, indexFile))
+	})
+}
+
+// openIndices serves every index directory in root under its name. New indexes
+// are created as directories in root, with the posting lists in memory like fts
+// index writes them or in BoltDB with "storage": "bolt", and dropped ones are
+// deleted.
+func openIndices(root string, configure func(*server.Server, *index.Index, string) error) (*server.Multi, func(), error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, nil, err
+	}
+	var mu sync.Mutex
+	open := make(map[string]func())
+	closeAll := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, close := range open {
+			close()
+		}
+	}
+	serve := func(name string, idx *index.Index, docs *store.File) (*server.Server, error) {
+		mu.Lock()
+		open[name] = func() { idx.Close(); docs.Close() }
+		mu.Unlock()
+		srv := server.New(idx, docs)
+		return srv, configure(srv, idx, name)
+	}
+
+	m := server.NewMulti()
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		idx, docs, err := openIndexDir(filepath.Join(root, e.Name()))
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		srv, err := serve(e.Name(), idx, docs)
+		if err == nil {
+			err = m.Add(e.Name(), srv)
+		}
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+	}
+
+	m.SetCreate(func(name string, settings server.IndexSettings) (*server.Server, error) {
+		analyzer, err := settings.Analyzer()
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(root, name)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			return nil, err
+		}
+		var idx *index.Index
+		switch settings.Storage {
+		case "", "memory":
+			idx = index.New(analyzer)
+			err = idx.Save(filepath.Join(dir, indexFile))
+		case "bolt":
+			var bs *bolt.Storage
+			if bs, err = bolt.Open(filepath.Join(dir, postingsFile)); err == nil {
+				if idx, err = index.NewWithStorage(analyzer, bs); err == nil {
+					err = idx.Commit()
+				} else {
+					bs.Close()
+				}
+			}
+		default:
+			err = fmt.Errorf("%w %q", server.ErrIndexStorage, settings.Storage)
+		}
+		var docs *store.File
+		if err == nil {
+			docs, err = store.Open(filepath.Join(dir, storeFile))
+		}
+		if err != nil {
+			if idx != nil {
+				idx.Close()
+			}
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		srv, err := serve(name, idx, docs)
+		if err != nil {
+			mu.Lock()
+			open[name]()
+			delete(open, name)
+			mu.Unlock()
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		return srv, nil
+	})
+	m.SetDrop(func(name string, srv *server.Server) error {
+		mu.Lock()
+		if close, ok := open[name]; ok {
+			close()
+			delete(open, name)
+		}
+		mu.Unlock()
+		return os.RemoveAll(filepath.Join(root, name))
+	})
+	return m, closeAll, nil
+}
+
+// fts stats -index dir [-top N] [-json]
+func runStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	dir := fs.String("index", "", "index directory written by fts index, or a saved index file")
+	top := fs.Int("top", index.StatsTopTerms, "most frequent terms to list")
+	asJSON := fs.Bool("json", false, "print the statistics as JSON")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dir == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fts stats -index dir [-top N] [-json]")
+	}
+
+	var idx *index.Index
+	var err error
+	if fi, statErr := os.Stat(*dir); statErr == nil && fi.IsDir() {
+		idx, err = loadIndexDir(*dir)
+	} else {
+		idx, err = index.Load(*dir)
+	}
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	st := idx.Stats()
+	if *top != index.StatsTopTerms {
+		st.TopTerms = idx.TopTerms(*top)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+
+	fmt.Printf("documents       %d (%d deleted)\n", st.Documents, st.Deleted)
+	fmt.Printf("terms           %d\n", st.Terms)
+	fmt.Printf("postings        %d\n", st.Postings)
+	fmt.Printf("avg doc length  %.1f\n", st.AvgDocLength)
+	fmt.Printf("memory          %.1f MB (postings %.1f, dictionary %.1f, fields %.1f)\n", megabytes(st.MemoryBytes), megabytes(st.Memory.Postings), megabytes(st.Memory.Dictionary), megabytes(st.Memory.Fields))
+	if len(st.TopTerms) > 0 {
+		fmt.Println("top terms:")
+		for _, t := range st.TopTerms {
+			fmt.Printf("  %8d  %s:%s\n", t.Docs, t.Field, t.Term)
+		}
+	}
+	return nil
+}
+
+func megabytes(n int) float64 {
+	return float64(n) / (1 << 20)
+}
+
+// fts check -index dir [-repair]
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	dir := fs.String("index", "", "index directory written by fts index")
+	repair := fs.Bool("repair", false, "rebuild a damaged index from the stored documents")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dir == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fts check -index dir [-repair]")
+	}
+	docs, err := store.Open(filepath.Join(*dir, storeFile))
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+
+	// An index that doesn't load, because its checksum doesn't match or it's cut
+	// short, is damaged as a whole.
+	var problems []string
+	idx, err := loadIndexDir(*dir)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		report := idx.Check()
+		for _, p := range report.Problems {
+			problems = append(problems, p.String())
+		}
+		for _, id := range idx.AllIDs() {
+			if _, err := docs.Get(id); errors.Is(err, store.ErrNotFound) {
+				problems = append(problems, fmt.Sprintf("document %d is indexed but not stored", id))
+			} else if err != nil {
+				problems = append(problems, fmt.Sprintf("document %d: %v", id, err))
+			}
+		}
+		fmt.Printf("checked %d documents, %d terms and %d postings\n", report.Documents, report.Terms, report.Postings)
+	}
+	for _, p := range problems {
+		fmt.Println("  " + p)
+	}
+	if len(problems) == 0 {
+		fmt.Println("no problems found")
+		return idx.Close()
+	}
+	if !*repair {
+		if idx != nil {
+			idx.Close()
+		}
+		return fmt.Errorf("%d problems, fts check -repair rebuilds the index from the stored documents", len(problems))
+	}
+	return repairIndexDir(*dir, idx, docs)
+}
+
+// repairIndexDir indexes the stored documents of dir again, those idx has if it
+// could be loaded, with its settings, and replaces the index, which it closes.
+func repairIndexDir(dir string, idx *index.Index, docs *store.File) error {
+	var ids []int
+	var analyzer analysis.Analyzer
+	if idx != nil {
+		ids, analyzer = idx.AllIDs(), idx.Analyzer()
+	} else {
+		fmt.Println("the index can't be read, so every stored document is indexed with the default analyzer")
+		for id := 0; id < docs.Len(); id++ {
+			ids = append(ids, id)
+		}
+	}
+	var rebuilt []index.Document
+	lost := 0
+	for _, id := range ids {
+		doc, err := docs.Get(id)
+		if errors.Is(err, store.ErrNotFound) && idx == nil {
+			continue // deleted
+		}
+		if err != nil {
+			lost++
+			continue
+		}
+		rebuilt = append(rebuilt, doc)
+	}
+
+	fresh := index.New(analyzer)
+	bolted := exists(filepath.Join(dir, postingsFile))
+	mapped := exists(filepath.Join(dir, mappedFile))
+	// Written next to the old index and moved over it once it's complete.
+	path := filepath.Join(dir, indexFile)
+	switch {
+	case bolted:
+		path = filepath.Join(dir, postingsFile)
+	case mapped:
+		path = filepath.Join(dir, mappedFile)
+	}
+	tmp := path + ".repair"
+	os.Remove(tmp)
+	if bolted {
+		bs, err := bolt.Open(tmp)
+		if err != nil {
+			return err
+		}
+		if fresh, err = index.NewWithStorage(analyzer, bs); err != nil {
+			bs.Close()
+			return err
+		}
+	}
+	if idx != nil {
+		idx.CopySettings(fresh)
+		idx.Close()
+	}
+	fresh.Add(rebuilt)
+	var err error
+	if bolted {
+		if err = fresh.Commit(); err == nil {
+			err = fresh.Close()
+		}
+	} else if mapped {
+		err = fresh.SaveDisk(tmp)
+	} else {
+		err = fresh.Save(tmp)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	fmt.Printf("rebuilt the index from %d stored documents\n", len(rebuilt))
+	if lost > 0 {
+		fmt.Printf("%d indexed documents weren't stored and are gone\n", lost)
+	}
+	return nil
+}
+
+// fts export -index dir -out file
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dir := fs.String("index", "", "index directory written by fts index")
+	out := fs.String("out", "", "file to write the index and its documents to in the portable format")
+	fs.Parse(args)
+	if *dir == "" || *out == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fts export -index dir -out file")
+	}
+
+	idx, docs, err := openIndexDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+	defer idx.Close()
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := idx.ExportPortable(f, docs); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("exported %d documents to %s\n", len(idx.AllIDs()), *out)
+	return nil
+}
+
+// fts vectors -index dir -out file [-vocab file] [-fields text,title] [-min-df N] [-max-df F] [-label field] [-raw]
+func runVectors(args []string) error {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	dir := fs.String("index", "", "index directory written by fts index")
+	out := fs.String("out", "", "file to write the TF-IDF vectors of the documents to in libsvm format")
+	vocab := fs.String("vocab", "", "file to write the features to, one per line")
+	fields := fs.String("fields", "", "fields whose terms are features, comma-separated (default text,title)")
+	minDF := fs.Int("min-df", 0, "documents a term has to be in to be a feature")
+	maxDF := fs.Float64("max-df", 0, "fraction of the documents a term may be in at most, 0 for any")
+	label := fs.String("label", "", "numeric field to label the vectors with")
+	raw := fs.Bool("raw", false, "don't scale the vectors to length 1")
+	fs.Parse(args)
+	if *dir == "" || *out == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fts vectors -index dir -out file [-vocab file] [-fields names] [-min-df N] [-max-df F] [-label field] [-raw]")
+	}
+
+	idx, err := loadIndexDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var vw io.Writer
+	var vf *os.File
+	if *vocab != "" {
+		if vf, err = os.Create(*vocab); err != nil {
+			return err
+		}
+		defer vf.Close()
+		vw = vf
+	}
+	n, err := idx.ExportVectors(f, vw, index.VectorOptions{Fields: analysis.ParseFilters(*fields), MinDocFreq: *minDF, MaxDocFreq: *maxDF, Label: *label, Raw: *raw})
+	if err != nil {
+		return err
+	}
+	if vf != nil {
+		if err := vf.Close(); err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d documents with %d features to %s\n", len(idx.AllIDs()), n, *out)
+	return nil
+}
+
+// fts import -in file -out dir
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	in := fs.String("in", "", "file written by fts export")
+	out := fs.String("out", "", "index directory to write")
+	fs.Parse(args)
+	if *in == "" || *out == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fts import -in file -out dir")
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	storePath := filepath.Join(*out, storeFile)
+	if err := os.Remove(storePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	docs, err := store.Open(storePath)
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+
+	idx, err := index.ImportPortable(f, nil, docs)
+	if err != nil {
+		return err
+	}
+	if err := idx.Save(filepath.Join(*out, indexFile)); err != nil {
+		return err
+	}
+	fmt.Printf("imported %d documents into %s\n", len(idx.AllIDs()), *out)
+	return nil
+}
+
+// fts merge -out dir dir...
+func runMerge(args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("out", "", "index directory to write")
+	fs.Parse(args)
+	if *out == "" || fs.NArg() < 2 {
+		return fmt.Errorf("usage: fts merge -out dir dir dir...")
+	}
+
+	parts := make([]*index.Index, fs.NArg())
+	stores := make([]*store.File, fs.NArg())
+	for i, dir := range fs.Args() {
+		idx, docs, err := openIndexDir(dir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+		defer docs.Close()
+		if idx.Storage() != nil {
+			defer idx.Close()
+		}
+		parts[i], stores[i] = idx, docs
+	}
+	merged, bases, err := index.Merge(parts...)
+	if err != nil {
+		return err
+	}
+	// A document stored past the last one indexed would land in the next part's IDs.
+	for i := range bases[:len(bases)-1] {
+		if stores[i].Len() > bases[i+1]-bases[i] {
+			return fmt.Errorf("%s: documents stored past the last one indexed", fs.Arg(i))
+		}
+	}
+
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	storePath := filepath.Join(*out, storeFile)
+	for _, path := range []string{storePath, filepath.Join(*out, indexFile), filepath.Join(*out, postingsFile), filepath.Join(*out, mappedFile)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	docs, err := store.Open(storePath)
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+	n := 0
+	for i, src := range stores {
+		for id := 0; id < src.Len(); id++ {
+			doc, err := src.Get(id)
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			doc.ID = bases[i] + id
+			if err := docs.Put(doc); err != nil {
+				return err
+			}
+			n++
+		}
+	}
+	if err := merged.Save(filepath.Join(*out, indexFile)); err != nil {
+		return err
+	}
+	fmt.Printf("merged %d documents from %d indexes into %s\n", n, len(parts), *out)
+	return nil
+}
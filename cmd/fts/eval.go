@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/leoashish/FullTextSearchApp/eval"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+)
+
+// Evaluation
+// fts eval -index dir -qrels judgments.tsv runs every judged query against the
+// index with the scoring and query options of fts search and prints P@k, R@k,
+// MRR and nDCG@k, the means and with -v every query's. Running it before and
+// after a change, say -similarity bm25(k1=2) against the default, shows whether
+// the change made the rankings better.
+func runEval(args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	dir := fs.String("index", "", "index directory written by fts index")
+	qrels := fs.String("qrels", "", "file of queries and their relevant document IDs, query<TAB>id id:grade ...")
+	k := fs.Int("k", 10, "hits of each query to measure")
+	perQuery := fs.Bool("v", false, "print the measures of every query too")
+	asJSON := fs.Bool("json", false, "write the report as JSON")
+	decay := fs.String("decay", "", "rank newer documents higher, like date:gauss(30d)")
+	diversify := fs.String("diversify", "", "let at most so many of the best results share a value of a field, like host:2")
+	var match search.MatchOptions
+	fs.StringVar(&match.MinimumShouldMatch, "min-match", "", "how many of the query's terms have to match, like 2, -1 or 75%")
+	fs.BoolVar(&match.Relax, "relax", false, "match fewer of the terms, down to any one, if all of them find nothing")
+	similarity := fs.String("similarity", "", "score with bm25(k1=1.2,b=0.75), tfidf, dfr or constant, per field like title=constant,bm25")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *dir == "" || *qrels == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: fts eval -index dir -qrels file [-k N] [-v] [-json] [-decay spec] [-diversify spec] [-min-match spec] [-relax] [-similarity spec]")
+	}
+
+	var opts index.SearchOptions
+	if *decay != "" {
+		d, err := index.ParseDecay(*decay)
+		if err != nil {
+			return err
+		}
+		opts.Decay = &d
+	}
+	if *diversify != "" {
+		d, err := index.ParseDiversify(*diversify)
+		if err != nil {
+			return err
+		}
+		opts.Diversify = &d
+	}
+	scorer, err := parseScorer(*similarity)
+	if err != nil {
+		return err
+	}
+	judgments, err := eval.Load(*qrels)
+	if err != nil {
+		return err
+	}
+
+	idx, docs, err := openIndexDir(*dir)
+	if err != nil {
+		return err
+	}
+	defer docs.Close()
+	defer idx.Close()
+	idx.SetScorer(scorer)
+	if err := idx.CheckDecay(opts.Decay); err != nil {
+		return err
+	}
+	if err := idx.CheckDiversify(opts.Diversify); err != nil {
+		return err
+	}
+
+	report, err := eval.Run(context.Background(), judgments, *k, eval.IndexSearcher(idx, match, opts))
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return report.WriteJSON(os.Stdout)
+	}
+	return report.Write(os.Stdout, *perQuery)
+}
@@ -0,0 +1,177 @@
+// Command fts builds, searches and serves indexes:
+//
+//	fts index -input dump.xml -out dir     index a dump into an index directory
+//	fts index -input app.db -sql query -out dir  or the rows of a SQLite query
+//	fts search -index dir "query"          print the best hits of a query
+//	fts serve -index dir -port 8080        serve the directory over HTTP
+//	fts stats -index dir                   sizes and the most frequent terms
+//	fts check -index dir [-repair]         look for damage, and rebuild a damaged index
+//	fts export -index dir -out file        write the directory in the portable format
+//	fts import -in file -out dir           read it back into an index directory
+//	fts vectors -index dir -out file       TF-IDF vectors of the documents for ML tools
+//	fts repl index.idx                     read queries interactively
+//	fts eval -index dir -qrels file        measure the rankings against relevance judgments
+//
+// -cpuprofile and -memprofile, given before the subcommand, write pprof profiles
+// of whatever runs. index, search, serve, stats, check and eval take the flags they
+// aren't given from a -config file (see package config).
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/config"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/sqlite"
+)
+
+const usage = `usage: fts [-cpuprofile file] [-memprofile file] command [flags]
+
+commands: index, search, serve, stats, check, export, import, merge, vectors, repl, eval
+run "fts command -h" for the flags of a command`
+
+func main() {
+	cpuProfile := flag.String("cpuprofile", "", "write a CPU profile to this file")
+	memProfile := flag.String("memprofile", "", "write a heap profile to this file on exit")
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fail(err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fail(err)
+		}
+		defer pprof.StopCPUProfile()
+	}
+	if *memProfile != "" {
+		defer func() {
+			f, err := os.Create(*memProfile)
+			if err != nil {
+				fail(err)
+			}
+			runtime.GC()
+			if err := pprof.WriteHeapProfile(f); err != nil {
+				fail(err)
+			}
+			f.Close()
+		}()
+	}
+
+	commands := map[string]func([]string) error{
+		"index":   runIndex,
+		"search":  runSearch,
+		"serve":   runServe,
+		"stats":   runStats,
+		"check":   runCheck,
+		"export":  runExport,
+		"import":  runImport,
+		"merge":   runMerge,
+		"vectors": runVectors,
+		"repl":    runREPL,
+		"eval":    runEval,
+	}
+	run, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "fts: unknown command %q\n%s\n", flag.Arg(0), usage)
+		os.Exit(2)
+	}
+	err := run(flag.Args()[1:])
+	if err != nil {
+		pprof.StopCPUProfile()
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// loadDocuments loads path, telling on stderr about the bad records it skipped.
+// loadDocuments reads the documents in path, with their fields where mapping says,
+// or if query isn't empty the rows of a query of the SQLite database there,
+// reporting bad records and leaving them out.
+func loadDocuments(path string, mapping index.FieldMapping, query string) ([]index.Document, error) {
+	l := index.Loader{Format: index.FormatOf(path), Mapping: mapping, Lenient: true}
+	var docs []index.Document
+	var err error
+	if query != "" {
+		docs, err = sqlite.Load(path, query, l)
+	} else {
+		docs, err = l.Load(path)
+	}
+	var bad index.ParseErrors
+	if !errors.As(err, &bad) {
+		return docs, err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: skipped %d bad records\n", path, len(bad))
+	for i, e := range bad {
+		if i == maxReportedRecords {
+			fmt.Fprintf(os.Stderr, "  and %d more\n", len(bad)-i)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %v\n", e.Error())
+	}
+	return docs, nil
+}
+
+const maxReportedRecords = 10
+
+// parseFlags parses args with a -config flag added to fs, and then sets the flags
+// that weren't given to the settings of the file (see package config).
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	path := fs.String("config", "", "YAML, TOML or JSON file of settings for the flags not given, "+config.Env+" if empty")
+	fs.Parse(args)
+	return config.ApplyFile(fs, *path)
+}
+
+// progressBar reports indexing progress on f: a bar redrawn in place on a
+// terminal, or a line every progressLogEvery when f is a file or a pipe. It
+// returns how often it wants to be called.
+func progressBar(f *os.File) (func(index.Progress), time.Duration) {
+	fi, err := f.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return func(p index.Progress) { fmt.Fprintln(f, progressLine(p)) }, progressLogEvery
+	}
+	return func(p index.Progress) {
+		fmt.Fprintf(f, "\r%s\x1b[K", progressLine(p))
+		if p.Done {
+			fmt.Fprintln(f)
+		}
+	}, 200 * time.Millisecond
+}
+
+const progressLogEvery = 10 * time.Second
+
+func progressLine(p index.Progress) string {
+	const width = 30
+	var b strings.Builder
+	if f, ok := p.Fraction(); ok {
+		n := int(f * width)
+		fmt.Fprintf(&b, "[%s%s] %3.0f%% ", strings.Repeat("=", n), strings.Repeat(" ", width-n), f*100)
+	}
+	fmt.Fprintf(&b, "%d", p.Documents)
+	if p.Total > 0 {
+		fmt.Fprintf(&b, "/%d", p.Total)
+	}
+	fmt.Fprintf(&b, " documents, %d tokens, %.0f docs/s", p.Tokens, p.Rate())
+	if eta, ok := p.ETA(); ok && !p.Done {
+		fmt.Fprintf(&b, ", ETA %s", eta.Round(time.Second))
+	}
+	return b.String()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+)
+
+// Interactive mode
+// fts repl [-docs dump] index.idx loads a saved index and reads queries from
+// stdin, one per line, in the syntax of search.Query. A few words are commands
+// instead of queries; quote them ("next") to search for them.
+const replHelp = `commands:
+  next       show the next page of the last query
+  limit N    show N results per page
+  explain N  how the score of result N of the last query came about
+  help       this text
+  quit       leave (so does end of input)
+anything else is a query, e.g. "wild cat" AND title:cat`
+
+type repl struct {
+	idx  *index.Index
+	docs []index.Document
+	out  io.Writer
+	h    *search.Highlighter
+
+	limit   int
+	results []index.Result
+	scoring index.Scoring
+	terms   []string
+	offset  int
+}
+
+func runREPL(args []string) error {
+	fs := flag.NewFlagSet("repl", flag.ExitOnError)
+	docsPath := fs.String("docs", "enwiki-latest-abstract1.xml", "documents the index was built from")
+	limit := fs.Int("limit", 10, "results per page")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: fts repl [-docs file] [-limit N] index.idx")
+	}
+
+	idx, err := index.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	docs, err := loadDocuments(*docsPath, index.FieldMapping{}, "")
+	if err != nil {
+		return err
+	}
+
+	r := &repl{
+		idx:   idx,
+		docs:  docs,
+		out:   os.Stdout,
+		h:     &search.Highlighter{Analyzer: idx.FieldAnalyzer(index.FieldText), Pre: "[", Post: "]"},
+		limit: *limit,
+	}
+	return r.run(os.Stdin)
+}
+
+func (r *repl) run(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(r.out, "fts> ")
+		if !sc.Scan() {
+			fmt.Fprintln(r.out)
+			return sc.Err()
+		}
+
+		line := strings.TrimSpace(sc.Text())
+		fields := strings.Fields(line)
+		switch {
+		case line == "":
+		case line == "quit" || line == "exit":
+			return nil
+		case line == "help":
+			fmt.Fprintln(r.out, replHelp)
+		case line == "next":
+			r.page()
+		case len(fields) == 2 && fields[0] == "limit":
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(r.out, "limit must be a positive number")
+				continue
+			}
+			r.limit = n
+		case len(fields) == 2 && fields[0] == "explain":
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 || n > len(r.results) {
+				fmt.Fprintln(r.out, "no such result")
+				continue
+			}
+			r.explain(r.results[n-1].ID)
+		default:
+			r.query(line)
+		}
+	}
+}
+
+func (r *repl) query(q string) {
+	start := time.Now()
+	ids, scoring, err := search.Evaluate(r.idx, q)
+	if err != nil {
+		fmt.Fprintln(r.out, "error:", err)
+		return
+	}
+	results := r.idx.RankPage(ids, scoring, index.SearchOptions{})
+	took := time.Since(start)
+
+	r.results, r.scoring, r.offset = results, scoring, 0
+	r.terms, _ = search.QueryTerms(r.idx, q, index.FieldText)
+	fmt.Fprintf(r.out, "%d results in %s\n", len(results), took)
+	if len(results) == 0 {
+		if corrected, ok := search.DidYouMean(r.idx, q); ok {
+			fmt.Fprintf(r.out, "did you mean: %s?\n", corrected)
+		}
+		return
+	}
+	r.page()
+}
+
+func (r *repl) page() {
+	if r.offset >= len(r.results) {
+		fmt.Fprintln(r.out, "no more results")
+		return
+	}
+
+	end := min(r.offset+r.limit, len(r.results))
+	for i, res := range r.results[r.offset:end] {
+		var doc index.Document
+		if res.ID < len(r.docs) {
+			doc = r.docs[res.ID]
+		}
+		fmt.Fprintf(r.out, "%3d. [%d] %.3f %s\n     %s\n", r.offset+i+1, res.ID, res.Score, doc.Title, snippet(r.h, r.idx, res.ID, doc.Text, r.terms))
+	}
+	r.offset = end
+
+	if end < len(r.results) {
+		fmt.Fprintf(r.out, "-- %d more, type next --\n", len(r.results)-end)
+	}
+}
+
+func (r *repl) explain(id int) {
+	e := r.idx.Explain(id, r.scoring)
+	for _, t := range e.Terms {
+		if t.Proximity {
+			fmt.Fprintf(r.out, "  %.3f  %s:\"%s\"~%d  windows=%.2f idf=%.2f", t.Score, t.Field, t.Term, t.Slop, t.Windows, t.IDF)
+		} else {
+			fmt.Fprintf(r.out, "  %.3f  %s:%s  tf=%d df=%d idf=%.2f", t.Score, t.Field, t.Term, t.Freq, t.DocFreq, t.IDF)
+		}
+		fmt.Fprintf(r.out, " len=%d avg=%.1f field boost=%g\n", t.FieldLength, t.AvgFieldLength, t.FieldBoost)
+	}
+	fmt.Fprintf(r.out, "  x %g document boost", e.Boost)
+	if e.Unadjusted != 0 {
+		fmt.Fprintf(r.out, ", %.3f adjusted by the scorer", e.Unadjusted)
+	}
+	fmt.Fprintf(r.out, " = %.3f\n", e.Score)
+}
@@ -0,0 +1,295 @@
+// Package serving is what fts serve and fts-server have in common: the flags of
+// a search server and how they set one up. The two only differ in where the
+// index comes from, an index directory or a saved index and a store file, and
+// take the rest from here, so a setting added to one is there in the other.
+package serving
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/cluster"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/rpc"
+	"github.com/leoashish/FullTextSearchApp/server"
+	"github.com/leoashish/FullTextSearchApp/watch"
+)
+
+// Flags are the settings Register defines.
+type Flags struct {
+	Cache            int
+	Timeout          time.Duration
+	Detect           bool
+	Host             bool
+	Snapshots        string
+	Checkpoint       time.Duration
+	Refresh          time.Duration
+	Rate             float64
+	Burst            int
+	MaxQueries       int
+	MaxClientQueries int
+	APIKeys          string
+	Private          bool
+	Warmup           string
+	Similarity       string
+	Synonyms         string
+	MemoryLimit      string
+	ACLHeader        string
+	SlowQuery        time.Duration
+	LogFormat        string
+	LogLevel         string
+	ShutdownTimeout  time.Duration
+	GRPC             string
+	Watch            string
+	Nodes            string
+	Shards           int
+}
+
+// Register defines the flags of a server on fs.
+func Register(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	fs.IntVar(&f.Cache, "cache", 1000, "number of search responses to cache, 0 to turn the cache off")
+	fs.DurationVar(&f.Timeout, "timeout", 0, "default time limit of a search, 0 for none")
+	fs.BoolVar(&f.Detect, "detect-language", false, "detect the language of new documents that don't declare one")
+	fs.BoolVar(&f.Host, "host", false, "index the host of the URL of new documents as the keyword field "+index.HostField)
+	fs.StringVar(&f.Snapshots, "snapshots", "", "directory for POST /snapshot to write snapshots to")
+	fs.DurationVar(&f.Checkpoint, "checkpoint", 5*time.Minute, "with a write-ahead log, how often to save the index and empty the log")
+	fs.DurationVar(&f.Refresh, "refresh", 0, "acknowledge changes at once and make them searchable this often, in one batch; 0 indexes each as it's made")
+	fs.Float64Var(&f.Rate, "rate", 0, "requests a second each client (API key or IP) may send, 0 for no limit")
+	fs.IntVar(&f.Burst, "burst", 20, "with -rate, requests a client may send at once")
+	fs.IntVar(&f.MaxQueries, "max-queries", 0, "queries running at once, 0 for no limit")
+	fs.IntVar(&f.MaxClientQueries, "max-client-queries", 0, "queries running at once per client, 0 for no limit")
+	fs.StringVar(&f.APIKeys, "api-keys", "", "file of API keys that changes need, one per line, :read after a key for a read-only one; "+server.APIKeysEnv+" adds more")
+	fs.BoolVar(&f.Private, "private", false, "with API keys, make searches need a key too")
+	fs.StringVar(&f.Warmup, "warmup", "", "file of hot terms, separated by white space, to read into memory before serving")
+	fs.StringVar(&f.Similarity, "similarity", "", "score with bm25(k1=1.2,b=0.75), tfidf, dfr or constant, per field like title=constant,bm25")
+	fs.StringVar(&f.Synonyms, "synonyms", "", "file of comma-separated synonym groups to expand queries with")
+	fs.StringVar(&f.MemoryLimit, "memory-limit", "", "memory each index may take with its stored documents, like 2GB, refusing adds and updates with 503 once it's reached")
+	fs.StringVar(&f.ACLHeader, "acl-header", "", "header the proxy in front puts the user's principals in, comma-separated, to only show them the documents whose "+index.ACLField+" field names one or none")
+	fs.DurationVar(&f.SlowQuery, "slow-query", 0, "log the searches that take this long or longer with what they parsed into, 0 for none")
+	fs.StringVar(&f.LogFormat, "log-format", "text", "log as text or json")
+	fs.StringVar(&f.LogLevel, "log-level", "info", "log debug, info, warn or error messages and up; debug logs every change and search")
+	fs.DurationVar(&f.ShutdownTimeout, "shutdown-timeout", server.DefaultShutdownTimeout, "on SIGTERM or SIGINT, how long to wait for the requests running before saving the changes and exiting")
+	fs.StringVar(&f.GRPC, "grpc", "", "address to serve the gRPC API on as well, e.g. :9090")
+	fs.StringVar(&f.Watch, "watch", "", "directory of .txt, .md and .json files to keep indexed as they change")
+	fs.StringVar(&f.Nodes, "nodes", "", "comma-separated fts-server addresses to coordinate instead of serving an index here")
+	fs.IntVar(&f.Shards, "shards", 0, "with -nodes, the number of shards the documents are spread over, to refuse to start with more or fewer nodes, which would renumber the documents; 0 not to check")
+	return f
+}
+
+// Settings are the flags read and checked, by Setup.
+type Settings struct {
+	*Flags
+	Logger *slog.Logger
+
+	keys     map[string]server.Access
+	scorer   index.Scorer
+	memLimit int
+	hot      []string
+}
+
+// Setup checks the flags, reads the files they name and makes the logger the
+// default one.
+func (f *Flags) Setup() (*Settings, error) {
+	logger, err := server.NewLogger(os.Stderr, f.LogFormat, f.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	s := &Settings{Flags: f, Logger: logger}
+
+	if s.keys, err = server.ConfiguredAPIKeys(f.APIKeys); err != nil {
+		return nil, err
+	}
+	if s.keys == nil && f.Private {
+		return nil, fmt.Errorf("-private needs API keys")
+	}
+	if f.Shards > 0 {
+		if err := checkShards(f.Nodes, f.Shards); err != nil {
+			return nil, err
+		}
+	}
+	if f.Similarity != "" {
+		if s.scorer, err = index.ParseScorer(f.Similarity); err != nil {
+			return nil, err
+		}
+	}
+	if f.MemoryLimit != "" {
+		if s.memLimit, err = index.ParseBytes(f.MemoryLimit); err != nil {
+			return nil, fmt.Errorf("-memory-limit: %w", err)
+		}
+	}
+	if f.Warmup != "" {
+		data, err := os.ReadFile(f.Warmup)
+		if err != nil {
+			return nil, err
+		}
+		s.hot = strings.Fields(string(data))
+	}
+	return s, nil
+}
+
+// checkShards checks that there's a node for each of the shards, and no more: the
+// coordinator's document IDs interleave those of the nodes, see package cluster,
+// so a node added or left out would give every document another ID.
+func checkShards(list string, shards int) error {
+	if list == "" {
+		return fmt.Errorf("-shards needs -nodes")
+	}
+	nodes, err := cluster.ParseNodes(list)
+	if err != nil {
+		return err
+	}
+	if len(nodes) != shards {
+		return fmt.Errorf("%d nodes for %d shards: the documents would be numbered differently", len(nodes), shards)
+	}
+	return nil
+}
+
+// Index sets up idx for serving: its scorer, memory limit and synonyms, and its
+// hot terms read in.
+func (s *Settings) Index(idx *index.Index) error {
+	idx.SetScorer(s.scorer)
+	idx.SetMemoryLimit(s.memLimit)
+	if s.Synonyms != "" {
+		synonyms, err := analysis.LoadSynonyms(s.Synonyms, idx.Analyzer())
+		if err != nil {
+			return err
+		}
+		idx.SetSynonyms(synonyms)
+	}
+	if len(s.hot) > 0 {
+		start := time.Now()
+		n := idx.Warmup(s.hot)
+		s.Logger.Info("warmed up", "posting_lists", n, "took", time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// Server sets srv up with the flags that are per index; name is that of the index
+// in a server.Multi, "" for a server of its own. The refreshes run until stop is
+// closed.
+func (s *Settings) Server(srv *server.Server, name string, stop <-chan struct{}) {
+	logger := s.Logger
+	if name != "" {
+		logger = logger.With("index", name)
+		srv.SetLogger(logger)
+	}
+	srv.SetCacheSize(s.Cache)
+	srv.SetSearchTimeout(s.Timeout)
+	srv.SetDetectLanguage(s.Detect)
+	srv.SetIndexHost(s.Host)
+	srv.SetRefreshInterval(s.Refresh)
+	srv.SetSlowQueryThreshold(s.SlowQuery)
+	if s.ACLHeader != "" {
+		srv.SetACL(server.HeaderPrincipals(s.ACLHeader))
+	}
+	go srv.RefreshEvery(stop, func(err error) { logger.Error("refresh", "error", err) })
+}
+
+// Guard sets the API keys and rate limits of h, a Server or a Multi.
+func (s *Settings) Guard(h interface {
+	SetAuth(server.Auth)
+	SetRateLimit(server.RateLimit)
+}) {
+	h.SetRateLimit(server.RateLimit{Rate: s.Rate, Burst: s.Burst, MaxQueries: s.MaxQueries, MaxClientQueries: s.MaxClientQueries})
+	if s.keys != nil {
+		h.SetAuth(server.Auth{Keys: s.keys, Private: s.Private})
+	}
+}
+
+// Coordinate serves a coordinator of the -nodes on addr, see package cluster.
+func (s *Settings) Coordinate(addr string) error {
+	nodes, err := cluster.ParseNodes(s.Nodes)
+	if err != nil {
+		return err
+	}
+	c := cluster.NewCoordinator(nodes)
+	if s.keys != nil {
+		c.SetAuth(server.Auth{Keys: s.keys, Private: s.Private})
+	}
+	if s.ACLHeader != "" {
+		c.SetForwardHeaders(s.ACLHeader)
+	}
+	s.Logger.Info("coordinating", "nodes", len(nodes), "addr", addr)
+	return server.ListenAndServe(addr, c, s.ShutdownTimeout, nil)
+}
+
+// Serve serves h on addr until a shutdown (see server.ListenAndServe) and reloads
+// the servers returned by servers on every SIGHUP. srv, if h serves a single
+// index, is kept in sync with the -watch directory and served over gRPC on -grpc
+// as well; those are stopped before flush is called.
+func (s *Settings) Serve(addr string, h http.Handler, srv *server.Server, servers func() []*server.Server, flush func(ctx context.Context) error) error {
+	if srv == nil && (s.GRPC != "" || s.Watch != "") {
+		return fmt.Errorf("-grpc and -watch are for a single index")
+	}
+	go reloadOnHangup(servers)
+
+	var w *watch.Watcher
+	if s.Watch != "" {
+		var err error
+		if w, err = watch.New(srv); err != nil {
+			return err
+		}
+		if err := w.Add(s.Watch); err != nil {
+			w.Close()
+			return err
+		}
+		go w.Run()
+	}
+	var g *grpc.Server
+	if s.GRPC != "" {
+		lis, err := net.Listen("tcp", s.GRPC)
+		if err != nil {
+			return err
+		}
+		g = grpc.NewServer()
+		rpc.New(srv).Register(g)
+		go func() {
+			if err := g.Serve(lis); err != nil {
+				s.Logger.Error("gRPC", "error", err)
+			}
+		}()
+		s.Logger.Info("serving gRPC", "addr", s.GRPC)
+	}
+
+	return server.ListenAndServe(addr, h, s.ShutdownTimeout, func(ctx context.Context) error {
+		if g != nil {
+			stopped := make(chan struct{})
+			go func() { g.GracefulStop(); close(stopped) }()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				g.Stop()
+			}
+		}
+		if w != nil {
+			w.Close()
+		}
+		return flush(ctx)
+	})
+}
+
+// reloadOnHangup reloads the servers returned by servers on every SIGHUP. They
+// log how it went.
+func reloadOnHangup(servers func() []*server.Server) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		for _, srv := range servers() {
+			srv.Reload()
+		}
+	}
+}
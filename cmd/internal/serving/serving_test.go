@@ -0,0 +1,62 @@
+package serving
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/server"
+)
+
+func TestSetup(t *testing.T) {
+	dir := t.TempDir()
+	synonyms := filepath.Join(dir, "synonyms.txt")
+	if err := os.WriteFile(synonyms, []byte("cat,feline\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(server.APIKeysEnv, "")
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		query   string // found with the index set up, if not ""
+	}{
+		{"defaults", nil, false, "cat"},
+		{"synonyms", []string{"-synonyms", synonyms}, false, "feline"},
+		{"similarity", []string{"-similarity", "tfidf"}, false, "cat"},
+		{"bad similarity", []string{"-similarity", "nope"}, true, ""},
+		{"bad memory limit", []string{"-memory-limit", "lots"}, true, ""},
+		{"private without keys", []string{"-private"}, true, ""},
+		{"missing synonyms", []string{"-synonyms", filepath.Join(dir, "none.txt")}, true, ""},
+		{"shards", []string{"-nodes", "node1:8080,node2:8080", "-shards", "2"}, false, "cat"},
+		{"node missing", []string{"-nodes", "node1:8080", "-shards", "2"}, true, ""},
+		{"node too many", []string{"-nodes", "node1:8080,node2:8080,node3:8080", "-shards", "2"}, true, ""},
+		{"shards without nodes", []string{"-shards", "2"}, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			f := Register(fs)
+			if err := fs.Parse(append([]string{"-log-level", "error"}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+			s, err := f.Setup()
+			if err == nil {
+				idx := index.New(nil)
+				idx.Add([]index.Document{{Title: "Cat", Text: "a wild cat"}})
+				err = s.Index(idx)
+				if err == nil && tt.query != "" {
+					if n := len(idx.Search(tt.query)); n != 1 {
+						t.Errorf("%q finds %d documents, want 1", tt.query, n)
+					}
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
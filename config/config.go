@@ -0,0 +1,256 @@
+// Package config reads the settings of a deployment from a YAML, TOML or JSON
+// file, so fts and fts-server can start from one file instead of a long list of
+// flags:
+//
+//	input: posts.db
+//	sql: SELECT name AS title, body AS text, tag FROM posts
+//	mapping:
+//	  keywords: [tag]
+//	index: idx/
+//	analyzer:
+//	  filters: [lowercase, stopwords, stem]
+//	  keywords: keywords.txt
+//	server:
+//	  port: 8080
+//	  cache: 5000
+//	  timeout: 500ms
+//	  nodes: [node1:8080, node2:8080]
+//	  shards: 2
+//
+// Every setting is the default of the flag of the same name (see Apply), so a
+// flag given on the command line wins over the file. A binary only takes the
+// settings it has flags for: fts serve has no use for the mapping, fts-server
+// none for the analyzer of fts index. The format is told by the extension, and
+// unknown settings are errors rather than typos that are silently ignored.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Env names the config file when there's no -config flag.
+const Env = "FTS_CONFIG"
+
+type Config struct {
+	Input   string             `json:"input"`   // documents to index: a dump, JSON lines, CSV or a SQLite database
+	SQL     string             `json:"sql"`     // the query of a SQLite Input
+	Mapping index.FieldMapping `json:"mapping"` // the properties or columns of the fields
+	Index   string             `json:"index"`   // the index directory, or fts-server's saved index
+	Indices string             `json:"indices"` // a directory of index directories to serve
+	Store   string             `json:"store"`   // fts-server's document store
+	Storage string             `json:"storage"` // memory or bolt
+	Workers int                `json:"workers"`
+
+	Analyzer Analyzer `json:"analyzer"`
+	Server   Server   `json:"server"`
+}
+
+// Analyzer is the analysis.Standard of a new index, as fts index's flags build it.
+type Analyzer struct {
+	CharFilters []string `json:"char_filters"`
+	Filters     []string `json:"filters"`
+	MinLength   int      `json:"min_length"`
+	MaxLength   int      `json:"max_length"`
+	DropPattern string   `json:"drop_pattern"`
+	Decompound  string   `json:"decompound"` // a dictionary file
+	Keywords    string   `json:"keywords"`   // a file of keywords
+	Normalize   string   `json:"normalize"`
+	Fold        bool     `json:"fold"`
+}
+
+// Server holds the settings of fts serve and fts-server. Durations are written
+// like "500ms" or "5m".
+type Server struct {
+	Port        int    `json:"port"`
+	Addr        string `json:"addr"` // fts-server listens on an address instead of a port
+	GRPC        string `json:"grpc"`
+	Cache       *int   `json:"cache"` // search responses cached, 0 for none
+	Timeout     string `json:"timeout"`
+	Refresh     string `json:"refresh"`
+	SlowQuery   string `json:"slow_query"`
+	MemoryLimit string `json:"memory_limit"`
+	Snapshots   string `json:"snapshots"`
+	Checkpoint  string `json:"checkpoint"` // how often a server with a write-ahead log saves the index
+	Host        bool   `json:"host"`
+	Similarity  string `json:"similarity"`
+	Synonyms    string `json:"synonyms"` // a file of synonym groups
+	Warmup      string `json:"warmup"`   // a file of hot terms
+	Watch       string `json:"watch"`    // a directory to keep indexed
+	ACLHeader   string `json:"acl_header"`
+
+	ShutdownTimeout string `json:"shutdown_timeout"` // how long a shutdown waits for the requests running
+
+	Rate             float64 `json:"rate"`
+	Burst            int     `json:"burst"`
+	MaxQueries       int     `json:"max_queries"`
+	MaxClientQueries int     `json:"max_client_queries"`
+	APIKeys          string  `json:"api_keys"`
+	Private          bool    `json:"private"`
+
+	LogFormat string `json:"log_format"`
+	LogLevel  string `json:"log_level"`
+
+	// The fts-server nodes holding a shard of the documents each, for a
+	// coordinator in front of them, and how many shards there are, so a node
+	// missing from the list or one too many is an error.
+	Nodes  []string `json:"nodes"`
+	Shards int      `json:"shards"`
+}
+
+// Load reads the file at path, YAML if it ends in .yaml or .yml, TOML if in
+// .toml and JSON if in .json.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// YAML and TOML are read into maps and then decoded like JSON, so every
+	// format has the same names and the same checks.
+	var raw map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("%s: unknown config format %q, want .yaml, .toml or .json", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if data, err = json.Marshal(raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	c := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		// Which decoder says so is no news to someone writing YAML.
+		msg := strings.TrimPrefix(err.Error(), "json: ")
+		return nil, fmt.Errorf("%s: %s", path, strings.Replace(msg, "unknown field", "unknown setting", 1))
+	}
+	return c, nil
+}
+
+// Flags returns the settings that are set by the names of their flags. The index
+// directory is also the -out of fts index.
+func (c *Config) Flags() map[string]string {
+	f := make(map[string]string)
+	set := func(name, v string) {
+		if v != "" {
+			f[name] = v
+		}
+	}
+	number := func(name string, n int) {
+		if n != 0 {
+			f[name] = strconv.Itoa(n)
+		}
+	}
+	yes := func(name string, b bool) {
+		if b {
+			f[name] = "true"
+		}
+	}
+
+	set("input", c.Input)
+	set("sql", c.SQL)
+	set("map", c.Mapping.String())
+	set("index", c.Index)
+	set("out", c.Index)
+	set("indices", c.Indices)
+	set("store", c.Store)
+	set("storage", c.Storage)
+	number("workers", c.Workers)
+
+	a := c.Analyzer
+	set("char-filters", strings.Join(a.CharFilters, ","))
+	set("filters", strings.Join(a.Filters, ","))
+	number("min-length", a.MinLength)
+	number("max-length", a.MaxLength)
+	set("drop-pattern", a.DropPattern)
+	set("decompound", a.Decompound)
+	set("keywords", a.Keywords)
+	set("normalize", a.Normalize)
+	yes("fold", a.Fold)
+
+	s := c.Server
+	number("port", s.Port)
+	set("addr", s.Addr)
+	set("grpc", s.GRPC)
+	if s.Cache != nil {
+		f["cache"] = strconv.Itoa(*s.Cache)
+	}
+	set("timeout", s.Timeout)
+	set("refresh", s.Refresh)
+	set("slow-query", s.SlowQuery)
+	set("memory-limit", s.MemoryLimit)
+	set("snapshots", s.Snapshots)
+	set("checkpoint", s.Checkpoint)
+	yes("host", s.Host)
+	set("similarity", s.Similarity)
+	set("synonyms", s.Synonyms)
+	set("warmup", s.Warmup)
+	set("watch", s.Watch)
+	set("acl-header", s.ACLHeader)
+	set("shutdown-timeout", s.ShutdownTimeout)
+	if s.Rate != 0 {
+		f["rate"] = strconv.FormatFloat(s.Rate, 'g', -1, 64)
+	}
+	number("burst", s.Burst)
+	number("max-queries", s.MaxQueries)
+	number("max-client-queries", s.MaxClientQueries)
+	set("api-keys", s.APIKeys)
+	yes("private", s.Private)
+	set("log-format", s.LogFormat)
+	set("log-level", s.LogLevel)
+	set("nodes", strings.Join(s.Nodes, ","))
+	number("shards", s.Shards)
+	return f
+}
+
+// Apply sets the flags of fs that weren't given on the command line to the
+// settings of c, leaving out those fs doesn't have. Call it after fs.Parse.
+func (c *Config) Apply(fs *flag.FlagSet) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, v := range c.Flags() {
+		if given[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("config %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ApplyFile loads the config file at path, or the one Env names if path is
+// empty, and applies it to fs. Without either it does nothing.
+func ApplyFile(fs *flag.FlagSet, path string) error {
+	if path == "" {
+		path = os.Getenv(Env)
+	}
+	if path == "" {
+		return nil
+	}
+	c, err := Load(path)
+	if err != nil {
+		return err
+	}
+	return c.Apply(fs)
+}
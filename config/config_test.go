@@ -0,0 +1,46 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShards(t *testing.T) {
+	tests := []struct {
+		name, file, data string
+		args             []string // given on the command line
+		shards           int      // after Apply
+		wantErr          bool
+	}{
+		{"yaml", "fts.yaml", "server:\n  nodes: [node1:8080, node2:8080]\n  shards: 2\n", nil, 2, false},
+		{"toml", "fts.toml", "[server]\nnodes = [\"node1:8080\"]\nshards = 1\n", nil, 1, false},
+		{"json", "fts.json", `{"server": {"shards": 3}}`, nil, 3, false},
+		{"flag wins", "fts.yaml", "server:\n  shards: 2\n", []string{"-shards", "4"}, 4, false},
+		{"not set", "fts.yaml", "server:\n  port: 8080\n", nil, 0, false},
+		{"not a number", "fts.yaml", "server:\n  shards: two\n", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			shards := fs.Int("shards", 0, "")
+			fs.String("nodes", "", "")
+			fs.Int("port", 0, "")
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			err := ApplyFile(fs, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+			if err == nil && *shards != tt.shards {
+				t.Errorf("-shards %d, want %d", *shards, tt.shards)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Package eval measures how good an index's rankings are against relevance
+// judgments, so a change to the analyzer, the Scorer or the query options can be
+// judged by numbers rather than by looking at a few result lists. "fts eval"
+// runs it over an index directory.
+//
+// The judgments are queries with the IDs of the documents relevant to them (the
+// qrels), one query per line, a tab and the IDs separated by spaces, each with
+// a grade of relevance after a colon if it's more relevant than others:
+//
+//	# query	relevant documents
+//	wild cat	12 40:2 7
+//	big cats roar	93:3 5
+//
+// An ID without a grade has grade 1. Empty lines and lines starting with # are
+// left out.
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+)
+
+// Judgment is a query and the documents relevant to it, by ID, with their
+// grades, all above 0.
+type Judgment struct {
+	Query    string
+	Relevant map[int]int
+}
+
+// Read reads judgments in the format of the package comment.
+func Read(r io.Reader) ([]Judgment, error) {
+	var judgments []Judgment
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		query, ids, ok := strings.Cut(text, "\t")
+		if !ok || strings.TrimSpace(query) == "" {
+			return nil, fmt.Errorf("line %d: want a query, a tab and the relevant document IDs", line)
+		}
+		j := Judgment{Query: strings.TrimSpace(query), Relevant: make(map[int]int)}
+		for _, f := range strings.Fields(ids) {
+			id, grade, graded := strings.Cut(f, ":")
+			n, err := strconv.Atoi(id)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("line %d: bad document ID %q", line, id)
+			}
+			g := 1
+			if graded {
+				if g, err = strconv.Atoi(grade); err != nil || g < 1 {
+					return nil, fmt.Errorf("line %d: bad grade %q of document %d, want a whole number from 1", line, grade, n)
+				}
+			}
+			j.Relevant[n] = g
+		}
+		if len(j.Relevant) == 0 {
+			return nil, fmt.Errorf("line %d: no relevant documents for %q", line, j.Query)
+		}
+		judgments = append(judgments, j)
+	}
+	return judgments, sc.Err()
+}
+
+// Load reads the judgments in the file at path.
+func Load(path string) ([]Judgment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	judgments, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return judgments, nil
+}
+
+// Metrics are the measures of one ranking, or their means over all queries.
+// They look at the first K hits:
+//
+//   - Precision is the share of them that are relevant, P@K.
+//   - Recall is the share of the relevant documents among them.
+//   - MRR is 1 over the rank of the first relevant hit, 0 without one among them;
+//     its mean is the mean reciprocal rank.
+//   - NDCG is the discounted cumulative gain of the hits, each worth 2^grade-1
+//     divided by log2(rank+1), over that of the best ranking possible. It's the
+//     one that tells grades apart.
+type Metrics struct {
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+	MRR       float64 `json:"mrr"`
+	NDCG      float64 `json:"ndcg"`
+}
+
+// Measure rates the ranking hits, best first, by relevant, looking at the first
+// k of them.
+func Measure(hits []int, relevant map[int]int, k int) Metrics {
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	var m Metrics
+	found := 0
+	dcg := 0.0
+	for i, id := range hits {
+		g, ok := relevant[id]
+		if !ok {
+			continue
+		}
+		found++
+		if m.MRR == 0 {
+			m.MRR = 1 / float64(i+1)
+		}
+		dcg += gain(g, i)
+	}
+
+	grades := make([]int, 0, len(relevant))
+	for _, g := range relevant {
+		grades = append(grades, g)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(grades)))
+	ideal := 0.0
+	for i := 0; i < len(grades) && i < k; i++ {
+		ideal += gain(grades[i], i)
+	}
+
+	if k > 0 {
+		m.Precision = float64(found) / float64(k)
+	}
+	if len(relevant) > 0 {
+		m.Recall = float64(found) / float64(len(relevant))
+	}
+	if ideal > 0 {
+		m.NDCG = dcg / ideal
+	}
+	return m
+}
+
+// gain is what a document of grade g is worth at the 0-based rank i.
+func gain(g, i int) float64 {
+	return (math.Exp2(float64(g)) - 1) / math.Log2(float64(i+2))
+}
+
+// QueryResult is how the ranking of one judged query did.
+type QueryResult struct {
+	Query    string `json:"query"`
+	Relevant int    `json:"relevant"` // relevant documents judged
+	Found    int    `json:"found"`    // of them in the first K hits
+	Metrics
+}
+
+// Report is the outcome of Run.
+type Report struct {
+	K       int           `json:"k"`
+	Queries []QueryResult `json:"queries"`
+	Mean    Metrics       `json:"mean"`
+}
+
+// A Searcher returns the IDs of the best k hits of a query, best first.
+type Searcher func(ctx context.Context, query string, k int) ([]int, error)
+
+// Run ranks the query of every judgment with s and measures its first k hits.
+// The means count every query, those that found nothing with zeros.
+func Run(ctx context.Context, judgments []Judgment, k int, s Searcher) (*Report, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("k is %d, want at least 1", k)
+	}
+	r := &Report{K: k, Queries: make([]QueryResult, 0, len(judgments))}
+	for _, j := range judgments {
+		hits, err := s(ctx, j.Query, k)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", j.Query, err)
+		}
+		if len(hits) > k {
+			hits = hits[:k]
+		}
+		m := Measure(hits, j.Relevant, k)
+		found := 0
+		for _, id := range hits {
+			if _, ok := j.Relevant[id]; ok {
+				found++
+			}
+		}
+		r.Queries = append(r.Queries, QueryResult{Query: j.Query, Relevant: len(j.Relevant), Found: found, Metrics: m})
+		r.Mean.Precision += m.Precision
+		r.Mean.Recall += m.Recall
+		r.Mean.MRR += m.MRR
+		r.Mean.NDCG += m.NDCG
+	}
+	if n := float64(len(r.Queries)); n > 0 {
+		r.Mean.Precision /= n
+		r.Mean.Recall /= n
+		r.Mean.MRR /= n
+		r.Mean.NDCG /= n
+	}
+	return r, nil
+}
+
+// IndexSearcher searches idx the way fts search does, its queries loosened by
+// match and its hits ranked by opts, whose Limit and Offset it sets itself.
+func IndexSearcher(idx *index.Index, match search.MatchOptions, opts index.SearchOptions) Searcher {
+	return func(ctx context.Context, query string, k int) ([]int, error) {
+		ids, scoring, _, err := search.EvaluateMatch(ctx, idx, query, match)
+		if err != nil {
+			return nil, err
+		}
+		opts.Limit, opts.Offset = k, 0
+		results, err := idx.RankPageContext(ctx, ids, scoring, opts)
+		if err != nil {
+			return nil, err
+		}
+		hits := make([]int, len(results))
+		for i, res := range results {
+			hits[i] = res.ID
+		}
+		return hits, nil
+	}
+}
+
+// Write prints the report as a table, with a line for every query if perQuery
+// is set and the means at the end.
+func (r *Report) Write(w io.Writer, perQuery bool) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-40s %8s %8s %8s %8s\n", "query", fmt.Sprintf("P@%d", r.K), fmt.Sprintf("R@%d", r.K), "MRR", fmt.Sprintf("nDCG@%d", r.K))
+	if perQuery {
+		for _, q := range r.Queries {
+			query := q.Query
+			if len([]rune(query)) > 40 {
+				query = string([]rune(query)[:39]) + "…"
+			}
+			fmt.Fprintf(bw, "%-40s %8.4f %8.4f %8.4f %8.4f\n", query, q.Precision, q.Recall, q.MRR, q.NDCG)
+		}
+	}
+	m := r.Mean
+	fmt.Fprintf(bw, "%-40s %8.4f %8.4f %8.4f %8.4f\n", fmt.Sprintf("mean of %d queries", len(r.Queries)), m.Precision, m.Recall, m.MRR, m.NDCG)
+	return bw.Flush()
+}
+
+// WriteJSON writes the report as JSON, for comparing runs with other tools.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
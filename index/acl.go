@@ -0,0 +1,64 @@
+package index
+
+import (
+	"slices"
+	"strings"
+)
+
+// Access control
+// A document can say who may see it: the principals, users and groups, in its
+// keyword field acl, like "user:alice" and "group:eng" (what they look like is up
+// to whoever hands them out, they're compared as they are). A document without
+// any is public. Allowed works out the documents a set of principals may see,
+// those naming one of them and the public ones, once, as a Bitset kept in the
+// filter cache under the principals until the index changes, so restricting the
+// hits of every query costs a lookup per hit.
+const ACLField = "acl"
+
+// WithACL returns doc allowed to principals, and only them.
+func WithACL(doc Document, principals ...string) Document {
+	keywords := make(map[string][]string, len(doc.Keywords)+1)
+	for field, values := range doc.Keywords {
+		keywords[field] = values
+	}
+	keywords[ACLField] = principals
+	doc.Keywords = keywords
+	return doc
+}
+
+// Allowed returns the documents principals may see.
+func (idx *Index) Allowed(principals []string) *Bitset {
+	principals = slices.Clone(principals)
+	slices.Sort(principals)
+	principals = slices.Compact(principals)
+	b, _ := idx.CachedFilter(ACLField+"\x00"+strings.Join(principals, "\x00"), func() ([]int, error) {
+		return idx.AllowedIDs(principals), nil
+	})
+	return b
+}
+
+// AllowedIDs is Allowed without the cache, in ascending order.
+func (idx *Index) AllowedIDs(principals []string) []int {
+	acls := idx.keywords[ACLField]
+	var r []int
+	for _, id := range idx.AllIDs() {
+		if _, gone := idx.deleted[id]; gone {
+			continue
+		}
+		acl := acls[id]
+		if len(acl) == 0 || slices.ContainsFunc(principals, func(p string) bool {
+			_, found := slices.BinarySearch(acl, p)
+			return found
+		}) {
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// Allows reports whether doc may be seen by one of principals, before it's
+// indexed.
+func (doc Document) Allows(principals []string) bool {
+	acl := doc.Keywords[ACLField]
+	return len(acl) == 0 || slices.ContainsFunc(acl, func(p string) bool { return slices.Contains(principals, p) })
+}
@@ -0,0 +1,46 @@
+package index
+
+// All fields at once
+// Every field keeps its own positions, so a phrase or proximity query never runs
+// from the end of the abstract into the title (see FieldPhraseMatches). A query
+// over all the words of a document at once, all:"wild cat" or all:"wild cat"~5,
+// needs them in one field, and that field needs room between what comes from one
+// field and what from the next, or the last word of the abstract would be right
+// before the first of the title. SetFieldGap indexes the default fields once more
+// as FieldAll, one after the other with gap positions in between: a phrase can't
+// match across two of them, and neither can a proximity query with a slop below
+// the gap. It's off by default, being a second copy of the default fields.
+const FieldAll = "all"
+
+// DefaultFieldGap is a gap no proximity query is going to reach over.
+const DefaultFieldGap = 100
+
+// SetFieldGap indexes FieldAll for the documents added from now on, with gap
+// positions between the fields, or stops with 0.
+func (idx *Index) SetFieldGap(gap int) {
+	idx.fieldGap = max(gap, 0)
+}
+
+// FieldGap is the gap set with SetFieldGap, 0 if FieldAll isn't indexed.
+func (idx *Index) FieldGap() int {
+	return idx.fieldGap
+}
+
+// addAll indexes the tokens of the default fields of document id as FieldAll.
+func (b *batch) addAll(id int, fields [][]string) {
+	idx := b.idx
+	positions := make(map[string][]int)
+	start, n := 0, 0
+	for _, tokens := range fields {
+		for pos, token := range tokens {
+			key := FieldKey(FieldAll, token)
+			positions[key] = append(positions[key], start+pos)
+		}
+		start += len(tokens) + idx.fieldGap
+		n += len(tokens)
+	}
+	idx.addFieldLength(FieldAll, id, n)
+	for key, pos := range positions {
+		idx.addPosting(key, id, pos)
+	}
+}
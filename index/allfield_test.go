@@ -0,0 +1,60 @@
+package index
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFieldGap(t *testing.T) {
+	docs := []Document{{ID: 0, Title: "wild fox", Text: "the black cat"}}
+	tests := []struct {
+		name    string
+		gap     int
+		phrase  string
+		slop    int // a proximity query with this slop if > 0, else a phrase
+		matches int
+	}{
+		{"off", 0, "black cat", 0, 0},
+		{"phrase in the text", DefaultFieldGap, "black cat", 0, 1},
+		{"phrase in the title", DefaultFieldGap, "wild fox", 0, 1},
+		{"phrase across the fields", DefaultFieldGap, "cat wild", 0, 0},
+		{"phrase across without a gap", 1, "cat wild", 0, 0},
+		{"near across the fields", DefaultFieldGap, "cat wild", 10, 0},
+		{"near reaching over the gap", DefaultFieldGap, "cat wild", 2 * DefaultFieldGap, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := New(nil)
+			idx.SetFieldGap(tt.gap)
+			if err := idx.Add(docs); err != nil {
+				t.Fatal(err)
+			}
+			// the default fields never match across, whatever the gap
+			if n := len(idx.FieldPhraseMatches("", idx.Analyzer().Analyze("cat wild"))); n != 0 {
+				t.Errorf("\"cat wild\" matches %d documents in the default fields, want 0", n)
+			}
+			for _, saved := range []bool{false, true} {
+				if saved {
+					path := filepath.Join(t.TempDir(), "index.fts")
+					if err := idx.Save(path); err != nil {
+						t.Fatal(err)
+					}
+					var err error
+					if idx, err = Load(path); err != nil {
+						t.Fatal(err)
+					}
+				}
+				tokens := idx.Analyzer().Analyze(tt.phrase)
+				var got []int
+				if tt.slop > 0 {
+					got = idx.FieldProximityMatches(FieldAll, tokens, tt.slop)
+				} else {
+					got = idx.FieldPhraseMatches(FieldAll, tokens)
+				}
+				if len(got) != tt.matches {
+					t.Errorf("saved %v: %s:%q matches %d documents, want %d", saved, FieldAll, tt.phrase, len(got), tt.matches)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package index
+
+import (
+	"encoding/binary"
+	"slices"
+	"sort"
+)
+
+// Compressed posting lists
+// As plain ints every document ID, frequency and position takes eight bytes,
+// which for a full Wikipedia dump adds up to many gigabytes. So a posting list is
+// a run of blocks of up to blockSize entries, each packed as varints: the gaps
+// between the IDs, the frequencies, then for every entry its positions as gaps too.
+// Gaps are small (most of them fit a byte), so a list shrinks to a fraction of its
+// size. Each block remembers its highest ID, which lets a cursor jump over whole
+// blocks without decoding them, the block-level twin of the skip pointers in
+// Intersection. Only the block a cursor stops in is decoded, and its positions
+// only when they are asked for.
+//
+// Entries are appended to an uncompressed tail that is packed once it holds
+// blockSize entries. An entry for an older document (an update) re-packs only the
+// block it falls into. An entry's number of positions is its frequency.
+const blockSize = 128
+
+type postingBlock struct {
+	Last      int // highest ID in the block
+	N         int
+	Positions bool // false for postings read back from a CSV export
+	Data      []byte
+}
+
+// newPostings packs already sorted entries; positions is nil if there are none.
+func newPostings(ids, freqs []int, positions [][]int) *postings {
+	p := &postings{}
+	for lo := 0; lo < len(ids); lo += blockSize {
+		hi := min(lo+blockSize, len(ids))
+		var ps [][]int
+		if positions != nil {
+			ps = positions[lo:hi]
+		}
+		p.Blocks = append(p.Blocks, packBlock(ids[lo:hi], freqs[lo:hi], ps))
+	}
+	return p
+}
+
+func packBlock(ids, freqs []int, positions [][]int) postingBlock {
+	b := postingBlock{Last: ids[len(ids)-1], N: len(ids), Positions: positions != nil}
+
+	var data []byte
+	prev := 0
+	for _, id := range ids {
+		data = binary.AppendUvarint(data, uint64(id-prev))
+		prev = id
+	}
+	for _, f := range freqs {
+		data = binary.AppendUvarint(data, uint64(f))
+	}
+	for _, ps := range positions {
+		prev := 0
+		for _, pos := range ps {
+			data = binary.AppendVarint(data, int64(pos-prev))
+			prev = pos
+		}
+	}
+	b.Data = slices.Clip(data)
+	return b
+}
+
+// unpack decodes the IDs and frequencies of b; rest is the encoded positions.
+func (b postingBlock) unpack() (ids, freqs []int, rest []byte) {
+	ids, freqs = make([]int, b.N), make([]int, b.N)
+	data := b.Data
+
+	prev := 0
+	for i := range ids {
+		gap, n := binary.Uvarint(data)
+		data = data[n:]
+		prev += int(gap)
+		ids[i] = prev
+	}
+	for i := range freqs {
+		f, n := binary.Uvarint(data)
+		data = data[n:]
+		freqs[i] = int(f)
+	}
+	return ids, freqs, data
+}
+
+func unpackPositions(freqs []int, data []byte) [][]int {
+	r := make([][]int, len(freqs))
+	for i, f := range freqs {
+		ps := make([]int, f)
+		prev := 0
+		for k := range ps {
+			gap, n := binary.Varint(data)
+			data = data[n:]
+			prev += int(gap)
+			ps[k] = prev
+		}
+		r[i] = ps
+	}
+	return r
+}
+
+// len counts the entries, deleted documents included.
+func (p *postings) len() int {
+	n := len(p.IDs)
+	for _, b := range p.Blocks {
+		n += b.N
+	}
+	return n
+}
+
+func (p *postings) last() int {
+	if n := len(p.IDs); n > 0 {
+		return p.IDs[n-1]
+	}
+	if n := len(p.Blocks); n > 0 {
+		return p.Blocks[n-1].Last
+	}
+	return -1
+}
+
+func (p *postings) hasPositions() bool {
+	for _, b := range p.Blocks {
+		if !b.Positions {
+			return false
+		}
+	}
+	return len(p.Positions) == len(p.IDs)
+}
+
+// ids decodes every document ID.
+func (p *postings) ids() []int {
+	r := make([]int, 0, p.len())
+	for _, b := range p.Blocks {
+		ids, _, _ := b.unpack()
+		r = append(r, ids...)
+	}
+	return append(r, p.IDs...)
+}
+
+// idsFreqs decodes the IDs and frequencies, leaving positions alone.
+func (p *postings) idsFreqs() (ids, freqs []int) {
+	for _, b := range p.Blocks {
+		bids, bfreqs, _ := b.unpack()
+		ids, freqs = append(ids, bids...), append(freqs, bfreqs...)
+	}
+	return append(ids, p.IDs...), append(freqs, p.Freqs...)
+}
+
+// entries decodes everything; positions is nil if the postings have none.
+func (p *postings) entries() (ids, freqs []int, positions [][]int) {
+	withPositions := p.hasPositions()
+	for _, b := range p.Blocks {
+		bids, bfreqs, rest := b.unpack()
+		ids, freqs = append(ids, bids...), append(freqs, bfreqs...)
+		if withPositions {
+			positions = append(positions, unpackPositions(bfreqs, rest)...)
+		}
+	}
+	ids, freqs = append(ids, p.IDs...), append(freqs, p.Freqs...)
+	if withPositions {
+		positions = append(positions, p.Positions...)
+	}
+	return ids, freqs, positions
+}
+
+// add records positions for document id.
+func (p *postings) add(id int, positions []int) {
+	if id > p.last() {
+		p.IDs = append(p.IDs, id)
+		p.Freqs = append(p.Freqs, len(positions))
+		p.Positions = append(p.Positions, positions)
+		if len(p.IDs) == blockSize {
+			p.pack()
+		}
+		return
+	}
+
+	i := sort.Search(len(p.Blocks), func(i int) bool { return p.Blocks[i].Last >= id })
+	if i == len(p.Blocks) {
+		insertEntry(&p.IDs, &p.Freqs, &p.Positions, id, positions)
+		return
+	}
+
+	b := p.Blocks[i]
+	ids, freqs, rest := b.unpack()
+	var ps [][]int
+	if b.Positions {
+		ps = unpackPositions(freqs, rest)
+	}
+	insertEntry(&ids, &freqs, &ps, id, positions)
+	p.Blocks[i] = packBlock(ids, freqs, ps)
+}
+
+// insertEntry adds an entry to decoded postings; ps is only kept up to date if
+// it holds the positions of every entry.
+func insertEntry(ids, freqs *[]int, ps *[][]int, id int, positions []int) {
+	withPositions := len(*ps) == len(*ids)
+	i := sort.SearchInts(*ids, id)
+	if i < len(*ids) && (*ids)[i] == id {
+		(*freqs)[i] += len(positions)
+		if withPositions {
+			(*ps)[i] = append((*ps)[i], positions...)
+		}
+		return
+	}
+	*ids = slices.Insert(*ids, i, id)
+	*freqs = slices.Insert(*freqs, i, len(positions))
+	if withPositions {
+		*ps = slices.Insert(*ps, i, positions)
+	}
+}
+
+// pack turns the tail into a block.
+func (p *postings) pack() {
+	if len(p.IDs) == 0 {
+		return
+	}
+	var ps [][]int
+	if len(p.Positions) == len(p.IDs) {
+		ps = p.Positions
+	}
+	p.Blocks = append(p.Blocks, packBlock(p.IDs, p.Freqs, ps))
+	p.IDs, p.Freqs, p.Positions = nil, nil, nil
+}
+
+// without drops the entries of the given documents, re-packing only the blocks
+// that had any. It returns the remaining number of entries.
+func (p *postings) without(drop map[int]struct{}) int {
+	keep := func(ids []int) bool {
+		for _, id := range ids {
+			if _, ok := drop[id]; ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	blocks := p.Blocks[:0]
+	for _, b := range p.Blocks {
+		ids, freqs, rest := b.unpack()
+		if keep(ids) {
+			blocks = append(blocks, b)
+			continue
+		}
+		var ps [][]int
+		if b.Positions {
+			ps = unpackPositions(freqs, rest)
+		}
+		ids, freqs, ps = filterEntries(ids, freqs, ps, drop)
+		if len(ids) > 0 {
+			blocks = append(blocks, packBlock(ids, freqs, ps))
+		}
+	}
+	clear(p.Blocks[len(blocks):])
+	p.Blocks = blocks
+
+	if !keep(p.IDs) {
+		ps := p.Positions
+		if len(ps) != len(p.IDs) {
+			ps = nil
+		}
+		p.IDs, p.Freqs, p.Positions = filterEntries(p.IDs, p.Freqs, ps, drop)
+	}
+	return p.len()
+}
+
+func filterEntries(ids, freqs []int, ps [][]int, drop map[int]struct{}) ([]int, []int, [][]int) {
+	j := 0
+	for i, id := range ids {
+		if _, ok := drop[id]; ok {
+			continue
+		}
+		ids[j], freqs[j] = id, freqs[i]
+		if ps != nil {
+			ps[j] = ps[i]
+		}
+		j++
+	}
+	if ps != nil {
+		clear(ps[j:])
+		ps = ps[:j]
+	}
+	return ids[:j], freqs[:j], ps
+}
+
+// Cursors
+// A cursor walks a posting list once, in ascending ID order.
+type postingCursor struct {
+	p     *postings
+	b     int // block being looked at, len(p.Blocks) for the tail
+	ids   []int
+	freqs []int
+	rest  []byte  // undecoded positions of the block
+	ps    [][]int // decoded positions, nil until asked for
+	j     int
+}
+
+func (p *postings) cursor() *postingCursor {
+	return &postingCursor{p: p, b: -1}
+}
+
+// seek moves to the first entry whose ID is not below target and reports whether
+// it is target. Targets must not decrease.
+func (c *postingCursor) seek(target int) bool {
+	// Blocks ending below target are passed over without being decoded.
+	if c.b < 0 || c.b < len(c.p.Blocks) && c.p.Blocks[c.b].Last < target {
+		b := max(c.b, 0)
+		for b < len(c.p.Blocks) && c.p.Blocks[b].Last < target {
+			b++
+		}
+		c.load(b)
+	}
+
+	c.j = advance(c.ids, c.j, target, skipLength(len(c.ids)))
+	return c.j < len(c.ids) && c.ids[c.j] == target
+}
+
+func (c *postingCursor) load(b int) {
+	c.b, c.j, c.ps = b, 0, nil
+	if b < len(c.p.Blocks) {
+		c.ids, c.freqs, c.rest = c.p.Blocks[b].unpack()
+		return
+	}
+	c.ids, c.freqs, c.rest = c.p.IDs, c.p.Freqs, nil
+	if len(c.p.Positions) == len(c.p.IDs) {
+		c.ps = c.p.Positions
+	}
+}
+
+func (c *postingCursor) freq() int {
+	return c.freqs[c.j]
+}
+
+// positions of the current entry; the postings must have them.
+func (c *postingCursor) positions() []int {
+	if c.ps == nil {
+		c.ps = unpackPositions(c.freqs, c.rest)
+	}
+	return c.ps[c.j]
+}
@@ -0,0 +1,103 @@
+package index
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// Ranking
+// BM25 with the usual parameters, unless SetScorer says otherwise. k1 controls how
+// quickly repeated occurrences of a term stop adding to the score, b how strongly
+// long documents are penalized.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type Result struct {
+	ID    int
+	Score float64
+
+	Collapsed int // hits with the same value left out, with SearchOptions.Collapse
+
+	Explanation *Explanation // with SearchOptions.Explain
+}
+
+// Collection statistics
+// What BM25 needs to know about the collection as a whole. An Index knows it for
+// its own documents; the segments of a Segmented index are ranked with the numbers
+// of all segments together, so a document scores the same in whichever segment it
+// happens to be.
+type collectionStats interface {
+	docCount() int
+	docFreq(term string) int
+	avgFieldLength(field string) float64
+}
+
+func (idx *Index) docCount() int {
+	return len(idx.docLen)
+}
+
+func idf(st collectionStats, term string) float64 {
+	return bm25IDF(st.docFreq(term), st.docCount())
+}
+
+func bm25IDF(docFreq, docCount int) float64 {
+	n, df := float64(docCount), float64(docFreq)
+	return math.Log(1 + (n-df+0.5)/(df+0.5))
+}
+
+// Rank scores the given documents (ascending IDs) against the query terms and
+// returns them best first. Terms are dictionary keys, so each is scored against
+// the lengths of its own field and weighted with that field's boost. Each
+// document's static boost multiplies its score.
+func (idx *Index) Rank(ids []int, terms []string) []Result {
+	return idx.rank(ids, Scoring{Terms: terms})
+}
+
+// rank is Rank for all of s.
+func (idx *Index) rank(ids []int, s Scoring) []Result {
+	r, _ := idx.rankContext(context.Background(), ids, s)
+	return r
+}
+
+func (idx *Index) rankContext(ctx context.Context, ids []int, s Scoring) ([]Result, error) {
+	r := make([]Result, len(ids))
+	for i, id := range ids {
+		r[i].ID = id
+	}
+	if len(ids) == 0 {
+		return r, nil
+	}
+
+	// Both lists are sorted, so each cursor walks its postings alongside the hits.
+	for _, c := range idx.cursors(s, idx) {
+		for i, id := range ids {
+			if i%checkEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			r[i].Score += c.score(idx, id)
+		}
+	}
+
+	ds, _ := idx.scorer.(DocumentScorer)
+	m := idx.matcher(s)
+	for i := range r {
+		boost := idx.decayFactor(s, r[i].ID) * m.factor(r[i].ID)
+		if b, ok := idx.boost[r[i].ID]; ok {
+			boost *= b
+		}
+		r[i].Score *= boost
+		if ds != nil {
+			r[i].Score = ds.ScoreDocument(r[i].ID, r[i].Score)
+		}
+	}
+
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Score > r[j].Score
+	})
+	return r, nil
+}
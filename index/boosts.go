@@ -0,0 +1,238 @@
+package index
+
+import (
+	"slices"
+	"strings"
+)
+
+// Match boosts
+// BM25 scores the terms of a query one by one, so beyond what their frequencies
+// add up to it can't tell a document with the words next to each other from one
+// with them pages apart, one with all the words of an OR query from one with
+// half of them, one with a word in its title and text from one with it in the
+// text only, or one with the words as they were typed from one with their stems
+// only. The boosts of SearchOptions look at how a document matches the
+// query as a whole and multiply its score by 1 plus the boost times how close it
+// comes to the best match, from 0 to 1:
+//
+//   - ProximityBoost by the shortest span of a field holding all the query terms,
+//     1/(1+gap) for gap other words in it, like a window of a proximity clause:
+//     1 for the terms next to each other, 1/2 with a word between them.
+//   - CoverageBoost by the share of the query terms the document has.
+//   - CrossFieldBoost by the share of the query terms it has in more than one
+//     field.
+//   - ExactBoost by the share of the query terms with an exact form (see exact.go)
+//     that the document has in that form.
+//
+// The query terms are the distinct ones of Scoring.Query. The factors are known before a
+// document is scored and never below 1, so RankTop can still skip the documents
+// that can't make it.
+type matchBoosts struct {
+	proximity  float64
+	coverage   float64
+	crossField float64
+	exact      float64
+}
+
+func (opts SearchOptions) matchBoosts() *matchBoosts {
+	b := matchBoosts{
+		proximity:  max(opts.ProximityBoost, 0),
+		coverage:   max(opts.CoverageBoost, 0),
+		crossField: max(opts.CrossFieldBoost, 0),
+		exact:      max(opts.ExactBoost, 0),
+	}
+	if b == (matchBoosts{}) {
+		return nil
+	}
+	return &b
+}
+
+// matcher works out the match boosts of one ranking. It walks the postings of
+// every query term along with the documents, so the IDs it's given must not go
+// down.
+type matcher struct {
+	matchBoosts
+	terms      [][]matchKey // per query term
+	exactTerms [][]matchKey // the exact forms of those with one
+}
+
+type matchKey struct {
+	field string
+	c     *postingCursor
+}
+
+// matcher returns nil if s has no match boosts.
+func (idx *Index) matcher(s Scoring) *matcher {
+	if s.boosts == nil {
+		return nil
+	}
+	m := &matcher{matchBoosts: *s.boosts}
+	seen := make(map[string]struct{})
+	for _, term := range s.queryTerms() {
+		key := strings.Join(term.Keys, "\x00")
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		m.terms = append(m.terms, idx.matchKeys(term.Keys))
+		if len(term.Exact) > 0 {
+			m.exactTerms = append(m.exactTerms, idx.matchKeys(term.Exact))
+		}
+	}
+	return m
+}
+
+func (idx *Index) matchKeys(keys []string) []matchKey {
+	var r []matchKey
+	for _, key := range keys {
+		if p, ok := idx.lookup(key); ok {
+			field, _ := SplitKey(key)
+			r = append(r, matchKey{field, p.cursor()})
+		}
+	}
+	return r
+}
+
+// queryTerms is s.Query, or else the keys of s grouped by their terms.
+func (s Scoring) queryTerms() []QueryTerm {
+	if s.Query != nil {
+		return s.Query
+	}
+	keys := slices.Clone(s.Terms)
+	for _, g := range s.Groups {
+		for _, k := range g.Keys {
+			keys = append(keys, k...)
+		}
+	}
+	var r []QueryTerm
+	at := make(map[string]int)
+	for _, key := range keys {
+		_, term := SplitKey(key)
+		i, ok := at[term]
+		if !ok {
+			i = len(r)
+			at[term] = i
+			r = append(r, QueryTerm{})
+		}
+		if !slices.Contains(r[i].Keys, key) {
+			r[i].Keys = append(r[i].Keys, key)
+		}
+	}
+	return r
+}
+
+// factor is what the match boosts multiply the score of document id with.
+func (m *matcher) factor(id int) float64 {
+	if m == nil {
+		return 1
+	}
+	f := 1.0
+	if m.proximity > 0 && len(m.terms) > 1 {
+		f *= 1 + m.proximity*closeness(m.positions(id))
+	}
+	if m.coverage > 0 && len(m.terms) > 0 {
+		f *= 1 + m.coverage*float64(matched(m.terms, id))/float64(len(m.terms))
+	}
+	if m.crossField > 0 && len(m.terms) > 0 {
+		f *= 1 + m.crossField*float64(crossField(m.terms, id))/float64(len(m.terms))
+	}
+	if m.exact > 0 && len(m.exactTerms) > 0 {
+		f *= 1 + m.exact*float64(matched(m.exactTerms, id))/float64(len(m.exactTerms))
+	}
+	return f
+}
+
+// crossField counts the terms with keys of more than one field in document id.
+func crossField(terms [][]matchKey, id int) int {
+	n := 0
+	for _, term := range terms {
+		field := ""
+		for _, k := range term {
+			if !k.c.seek(id) || k.field == field {
+				continue
+			}
+			if field != "" {
+				n++
+				break
+			}
+			field = k.field
+		}
+	}
+	return n
+}
+
+// positions returns the positions of the query terms in document id by field:
+// positions[field][i] are those of the i-th term in field.
+func (m *matcher) positions(id int) map[string][][]int {
+	positions := make(map[string][][]int)
+	for i, term := range m.terms {
+		for _, k := range term {
+			if !k.c.seek(id) {
+				continue
+			}
+			byTerm, ok := positions[k.field]
+			if !ok {
+				byTerm = make([][]int, len(m.terms))
+				positions[k.field] = byTerm
+			}
+			if byTerm[i] == nil {
+				byTerm[i] = k.c.positions()
+			} else {
+				// a synonym in the same field
+				byTerm[i] = append(slices.Clone(byTerm[i]), k.c.positions()...)
+				slices.Sort(byTerm[i])
+			}
+		}
+	}
+	return positions
+}
+
+// matched counts the terms with a key in document id.
+func matched(terms [][]matchKey, id int) int {
+	n := 0
+	for _, term := range terms {
+		for _, k := range term {
+			if k.c.seek(id) {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// closeness is 1/(1+gap) for the smallest gap of any field holding all the query
+// terms, 0 if none does.
+func closeness(positions map[string][][]int) float64 {
+	best := 0.0
+	for _, byTerm := range positions {
+		if slices.ContainsFunc(byTerm, func(p []int) bool { return len(p) == 0 }) {
+			continue
+		}
+		best = max(best, 1/float64(1+max(minGap(byTerm), 0)))
+	}
+	return best
+}
+
+// minGap is the smallest number of other positions in a window holding one
+// position of every list (all sorted and none empty), walking them the way
+// windows does.
+func minGap(positions [][]int) int {
+	at := make([]int, len(positions))
+	best := -1
+	for {
+		lo, hi := 0, positions[0][at[0]]
+		for i, p := range positions {
+			if p[at[i]] < positions[lo][at[lo]] {
+				lo = i
+			}
+			hi = max(hi, p[at[i]])
+		}
+		if gap := hi - positions[lo][at[lo]] + 1 - len(positions); best < 0 || gap < best {
+			best = gap
+		}
+		if at[lo]++; at[lo] == len(positions[lo]) {
+			return best
+		}
+	}
+}
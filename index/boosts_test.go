@@ -0,0 +1,127 @@
+package index
+
+import "testing"
+
+func TestProximityBoost(t *testing.T) {
+	idx := New(nil)
+	idx.Add([]Document{
+		{ID: 0, Text: "black dogs chase a cat"},
+		{ID: 1, Text: "dogs chase a black cat"},
+	})
+	tests := []struct {
+		name  string
+		boost float64
+		opts  SearchOptions
+		first int
+	}{
+		{"off", 0, SearchOptions{}, 0},
+		{"all ranked", 1, SearchOptions{}, 1},
+		{"top", 1, SearchOptions{Limit: 1}, 1},
+		{"explained", 1, SearchOptions{Limit: 2, Explain: true}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.ProximityBoost = tt.boost
+			r, total := idx.SearchWithOptions("black cat", tt.opts)
+			if total != 2 {
+				t.Fatalf("%d matches, want 2", total)
+			}
+			if r[0].ID != tt.first {
+				t.Errorf("%v first, want %d", r[0].ID, tt.first)
+			}
+			if tt.boost == 0 && r[0].Score != r[1].Score {
+				t.Errorf("scores %v and %v differ without the boost", r[0].Score, r[1].Score)
+			}
+			if e := r[0].Explanation; e != nil && (e.Score != r[0].Score || e.Match != 2) {
+				t.Errorf("explained a score of %v with a match factor of %v, want %v and 2", e.Score, e.Match, r[0].Score)
+			}
+		})
+	}
+}
+
+func TestMinGap(t *testing.T) {
+	tests := []struct {
+		positions [][]int
+		want      int
+	}{
+		{[][]int{{0}, {1}}, 0},
+		{[][]int{{1}, {0}}, 0},
+		{[][]int{{0, 9}, {4, 10}}, 0},
+		{[][]int{{0}, {5}, {2}}, 3},
+		{[][]int{{3}, {3}}, -1},
+	}
+	for _, tt := range tests {
+		if got := minGap(tt.positions); got != tt.want {
+			t.Errorf("minGap(%v) = %d, want %d", tt.positions, got, tt.want)
+		}
+	}
+}
+
+func TestExactBoost(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts [2]string // of documents 0 and 1, the same but for the form of a word
+		exact bool      // SetExactForms
+		boost float64
+		query string
+		first int
+	}{
+		{"off", [2]string{"a black cat", "black cats"}, true, 0, "cats", 0},
+		{"no exact forms", [2]string{"a black cat", "black cats"}, false, 1, "cats", 0},
+		{"exact plural", [2]string{"a black cat", "black cats"}, true, 1, "cats", 1},
+		{"exact singular", [2]string{"black cats", "a black cat"}, true, 1, "cat", 1},
+		{"exact with another word", [2]string{"a black cat", "black cats"}, true, 1, "black cats", 1},
+		{"exact of an inflected word", [2]string{"cats running", "cats run"}, true, 1, "cats run", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := New(nil)
+			idx.SetExactForms(tt.exact)
+			if err := idx.Add([]Document{{ID: 0, Text: tt.texts[0]}, {ID: 1, Text: tt.texts[1]}}); err != nil {
+				t.Fatal(err)
+			}
+			for _, limit := range []int{0, 1} {
+				r, total := idx.SearchWithOptions(tt.query, SearchOptions{Limit: limit, ExactBoost: tt.boost})
+				if total != 2 {
+					t.Fatalf("%d matches, want 2", total)
+				}
+				if r[0].ID != tt.first {
+					t.Errorf("limit %d: %d first, want %d", limit, r[0].ID, tt.first)
+				}
+			}
+		})
+	}
+}
+
+func TestCrossFieldBoost(t *testing.T) {
+	idx := New(nil)
+	idx.Add([]Document{
+		{ID: 0, Title: "Pets", Text: "a cat and a cat sleep"},
+		{ID: 1, Title: "Cats", Text: "a cat and a dog sleep"},
+		{ID: 2, Title: "Pets", Text: "a dog and a dog sleep"},
+	})
+	// The title weighs little, so one in the title doesn't make up for two in the
+	// text without the boost.
+	idx.SetFieldBoost(FieldTitle, 0.1)
+	tests := []struct {
+		name  string
+		boost float64
+		query string
+		first int
+	}{
+		{"off", 0, "cat", 0},
+		{"title and text", 1, "cat", 1},
+		{"one of two terms", 1, "cat sleeps", 1},
+		{"in one field only", 1, "dog", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, limit := range []int{0, 1} {
+				r, _ := idx.SearchWithOptions(tt.query, SearchOptions{Limit: limit, CrossFieldBoost: tt.boost})
+				if len(r) == 0 || r[0].ID != tt.first {
+					t.Errorf("limit %d: hits %v, want %d first", limit, r, tt.first)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package index
+
+import "errors"
+
+// Bulk changes
+// A Bulk collects many adds, updates and deletes and applies them in one go.
+// Every operation is checked when it's queued, against the index as it will be
+// after the operations before it, and one that can't work (updating a document
+// that isn't there, adding one under an ID that is taken) is left out without
+// holding up the others. Apply then runs the rest in order, handing runs of adds
+// to a single Add, and returns one result per operation.
+//
+// Nothing checks for changes made directly to the index between queuing and
+// Apply, so don't make any. A Bulk from Shared.Bulk takes the write lock for all
+// of Apply: searches see either none of the batch or all of it.
+type Bulk struct {
+	idx    *Index
+	shared *Shared // nil if not locked
+	ops    []bulkOp
+	live   map[int]bool // documents the queued operations add or delete
+}
+
+type BulkOp string
+
+const (
+	BulkAdd    BulkOp = "add"
+	BulkUpdate BulkOp = "update"
+	BulkDelete BulkOp = "delete"
+)
+
+type BulkResult struct {
+	Op  BulkOp
+	ID  int
+	Err error // nil if the operation was applied
+}
+
+type bulkOp struct {
+	op  BulkOp
+	doc Document
+	err error
+}
+
+var (
+	ErrDocumentExists = errors.New("document already in index")
+	ErrEmptyDocument  = errors.New("document has no title or text")
+)
+
+func (idx *Index) Bulk() *Bulk {
+	return &Bulk{idx: idx, live: make(map[int]bool)}
+}
+
+// Bulk starts a batch for the shared index; Apply takes the write lock.
+func (s *Shared) Bulk() *Bulk {
+	b := s.idx.Bulk()
+	b.shared = s
+	return b
+}
+
+// Add queues doc as a new document under its ID.
+func (b *Bulk) Add(doc Document) error {
+	err := b.check(doc)
+	if err == nil && b.Has(doc.ID) {
+		err = ErrDocumentExists
+	}
+	return b.queue(BulkAdd, doc, err, true)
+}
+
+// Update queues replacing the document with doc's ID.
+func (b *Bulk) Update(doc Document) error {
+	err := b.check(doc)
+	if err == nil && !b.Has(doc.ID) {
+		err = ErrNoDocument
+	}
+	return b.queue(BulkUpdate, doc, err, true)
+}
+
+func (b *Bulk) Delete(id int) error {
+	var err error
+	if b.idx.disk != nil {
+		err = ErrReadOnly
+	} else if !b.Has(id) {
+		err = ErrNoDocument
+	}
+	return b.queue(BulkDelete, Document{ID: id}, err, false)
+}
+
+// Has reports whether id will be a live document once the queued operations are
+// applied.
+func (b *Bulk) Has(id int) bool {
+	if live, ok := b.live[id]; ok {
+		return live
+	}
+	return b.idx.Has(id)
+}
+
+// Len is the number of operations queued, including the ones that failed.
+func (b *Bulk) Len() int {
+	return len(b.ops)
+}
+
+func (b *Bulk) check(doc Document) error {
+	switch {
+	case b.idx.disk != nil:
+		return ErrReadOnly
+	case doc.Title == "" && doc.Text == "":
+		return ErrEmptyDocument
+	}
+	return nil
+}
+
+func (b *Bulk) queue(op BulkOp, doc Document, err error, live bool) error {
+	b.ops = append(b.ops, bulkOp{op, doc, err})
+	if err == nil {
+		b.live[doc.ID] = live
+	}
+	return err
+}
+
+// Apply runs the queued operations and empties the batch. The results are in the
+// order the operations were queued.
+func (b *Bulk) Apply() []BulkResult {
+	if b.shared != nil {
+		_, done := b.shared.Write()
+		defer done()
+	}
+
+	r := make([]BulkResult, len(b.ops))
+	var adds []Document
+	flush := func() {
+		if len(adds) > 0 {
+			b.idx.Add(adds)
+			adds = adds[:0]
+		}
+	}
+
+	for i, op := range b.ops {
+		r[i] = BulkResult{op.op, op.doc.ID, op.err}
+		if op.err != nil {
+			continue
+		}
+		switch op.op {
+		case BulkAdd:
+			adds = append(adds, op.doc)
+		case BulkUpdate:
+			flush()
+			b.idx.Update(op.doc)
+		case BulkDelete:
+			flush()
+			r[i].Err = b.idx.Delete(op.doc.ID)
+		}
+	}
+	flush()
+
+	b.ops, b.live = nil, make(map[int]bool)
+	return r
+}
@@ -0,0 +1,219 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+)
+
+// Checking an index
+// Checksums catch a file damaged on disk, but not one written wrong, by a bug or
+// by hand. Check reads every posting list through and reports what can't be
+// right: a dictionary out of order or naming a list that can't be read, IDs out
+// of order or twice in a list, block headers that don't agree with their data,
+// frequencies that don't agree with the positions, and postings of documents the
+// index doesn't have (deleted ones stay in the lists until they're rewritten).
+// An index opened with OpenDisk has its checksum verified first. Nothing is
+// changed; `fts check -repair` rebuilds a damaged index from its stored documents
+// (see CopySettings).
+type CheckReport struct {
+	Terms     int       `json:"terms"`
+	Postings  int       `json:"postings"`
+	Documents int       `json:"documents"`
+	Problems  []Problem `json:"problems,omitempty"`
+}
+
+// Problem is something Check found, in the list of Term if it's set.
+type Problem struct {
+	Term    string `json:"term,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Term == "" {
+		return p.Message
+	}
+	return fmt.Sprintf("%q: %s", p.Term, p.Message)
+}
+
+func (idx *Index) Check() CheckReport {
+	r := CheckReport{Documents: len(idx.docLen)}
+	if err := idx.Verify(); err != nil {
+		r.Problems = append(r.Problems, Problem{Message: err.Error()})
+	}
+
+	terms := idx.Terms()
+	r.Terms = len(terms)
+	for i, term := range terms {
+		if i > 0 && terms[i-1] >= term {
+			r.Problems = append(r.Problems, Problem{term, fmt.Sprintf("dictionary out of order after %q", terms[i-1])})
+		}
+		p, ok := idx.lookup(term)
+		if !ok {
+			r.Problems = append(r.Problems, Problem{term, "in the dictionary but its posting list can't be read"})
+			continue
+		}
+		ids, err := checkPostings(p)
+		r.Postings += len(ids)
+		if err != nil {
+			r.Problems = append(r.Problems, Problem{term, err.Error()})
+		}
+		for _, id := range ids {
+			_, live := idx.docLen[id]
+			_, deleted := idx.deleted[id]
+			if !live && !deleted {
+				r.Problems = append(r.Problems, Problem{term, fmt.Sprintf("posting for document %d, which isn't indexed", id)})
+				break
+			}
+		}
+	}
+	if idx.storage != nil {
+		idx.storageMu.Lock()
+		if idx.storageErr != nil {
+			r.Problems = append(r.Problems, Problem{Message: idx.storageErr.Error()})
+		}
+		idx.storageMu.Unlock()
+	}
+	return r
+}
+
+// checkPostings decodes p without trusting it, returning the IDs read up to the
+// first problem.
+func checkPostings(p *postings) ([]int, error) {
+	var ids []int
+	last := -1
+	for i, b := range p.Blocks {
+		bids, err := checkBlock(b, last)
+		ids = append(ids, bids...)
+		if err != nil {
+			return ids, fmt.Errorf("block %d: %w", i, err)
+		}
+		last = b.Last
+	}
+
+	if len(p.Freqs) != len(p.IDs) || (p.Positions != nil && len(p.Positions) != len(p.IDs)) {
+		return ids, errors.New("unpacked entries with frequencies or positions missing")
+	}
+	for i, id := range p.IDs {
+		if err := checkEntry(id, last, p.Freqs[i]); err != nil {
+			return ids, err
+		}
+		if p.Positions != nil {
+			if err := checkPositions(p.Positions[i], p.Freqs[i]); err != nil {
+				return ids, fmt.Errorf("document %d: %w", id, err)
+			}
+		}
+		ids, last = append(ids, id), id
+	}
+	return ids, nil
+}
+
+func checkEntry(id, last, freq int) error {
+	switch {
+	case id == last:
+		return fmt.Errorf("document %d twice", id)
+	case id < last:
+		return fmt.Errorf("document %d after %d", id, last)
+	case freq < 1:
+		return fmt.Errorf("document %d with a frequency of %d", id, freq)
+	}
+	return nil
+}
+
+func checkPositions(positions []int, freq int) error {
+	if len(positions) != freq {
+		return fmt.Errorf("%d positions for a frequency of %d", len(positions), freq)
+	}
+	for i, pos := range positions {
+		if pos < 0 || (i > 0 && pos < positions[i-1]) {
+			return fmt.Errorf("positions out of order")
+		}
+	}
+	return nil
+}
+
+// checkBlock is unpack and unpackPositions checking as they go.
+func checkBlock(b postingBlock, last int) ([]int, error) {
+	// Every number takes a byte at least, which keeps a bad count from
+	// allocating much.
+	if b.N <= 0 || 2*b.N > len(b.Data) {
+		return nil, fmt.Errorf("%d entries in %d bytes", b.N, len(b.Data))
+	}
+	data := b.Data
+	uvarint := func() (int, bool) {
+		x, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, false
+		}
+		data = data[n:]
+		return int(x), true
+	}
+
+	ids := make([]int, 0, b.N)
+	prev := 0
+	for range b.N {
+		gap, ok := uvarint()
+		if !ok {
+			return ids, errors.New("truncated IDs")
+		}
+		prev += gap
+		if len(ids) > 0 && gap == 0 {
+			return ids, fmt.Errorf("document %d twice", prev)
+		}
+		if prev <= last {
+			return ids, checkEntry(prev, last, 1)
+		}
+		ids = append(ids, prev)
+	}
+	if ids[len(ids)-1] != b.Last {
+		return ids, fmt.Errorf("header says the last document is %d, data says %d", b.Last, ids[len(ids)-1])
+	}
+	freqs := make([]int, b.N)
+	for i := range freqs {
+		f, ok := uvarint()
+		if !ok {
+			return ids, errors.New("truncated frequencies")
+		}
+		if f < 1 {
+			return ids, fmt.Errorf("document %d with a frequency of %d", ids[i], f)
+		}
+		freqs[i] = f
+	}
+	if b.Positions {
+		for i, f := range freqs {
+			if f > len(data) {
+				return ids, errors.New("truncated positions")
+			}
+			positions := make([]int, f)
+			pos := 0
+			for k := range positions {
+				gap, n := binary.Varint(data)
+				if n <= 0 {
+					return ids, errors.New("truncated positions")
+				}
+				data = data[n:]
+				pos += int(gap)
+				positions[k] = pos
+			}
+			if err := checkPositions(positions, f); err != nil {
+				return ids, fmt.Errorf("document %d: %w", ids[i], err)
+			}
+		}
+	}
+	if len(data) > 0 {
+		return ids, fmt.Errorf("%d bytes after the entries", len(data))
+	}
+	return ids, nil
+}
+
+// CopySettings gives to what idx is saved with besides its analyzer, the field
+// boosts, SetStoreOffsets, SetFieldGap, SetExactForms and SetMinTermFreq, so an
+// index rebuilt from the same documents into to is searched the same way.
+func (idx *Index) CopySettings(to *Index) {
+	maps.Copy(to.fieldBoost, idx.fieldBoost)
+	to.storeOffsets = idx.storeOffsets
+	to.fieldGap = idx.fieldGap
+	to.exactForms = idx.exactForms
+	to.minTermFreq = maps.Clone(idx.minTermFreq)
+}
@@ -0,0 +1,115 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// File headers and checksums
+// A saved index cut short by a full disk or with a flipped bit used to fail
+// somewhere inside gob, or not at all, and one from a newer build would decode
+// into something subtly wrong. So every file Save and SaveDisk write, and the
+// metadata Commit puts in a storage, starts with a magic naming its kind and the
+// format version, and has CRC-32C checksums of what follows: Load and
+// NewWithStorage check all of it, OpenDisk the dictionary and the metadata, which
+// are read on opening anyway, and LoadEager and Verify the posting lists too. A
+// mismatch is an ErrCorrupt and a version newer than FormatVersion an
+// ErrFormatVersion, both with the path in front. Files from before the header,
+// version 1, still load, unchecked.
+//
+//	magic (8 bytes), version (4 bytes)
+//	the contents
+//	CRC-32C of the contents (4 bytes), or for SaveDisk the footer, see disk.go
+const FormatVersion = 2
+
+var (
+	ErrCorrupt       = errors.New("index file is corrupt")
+	ErrFormatVersion = errors.New("index file format is newer than this build")
+)
+
+const (
+	indexMagic = "FTSINDEX" // Save
+	metaMagic  = "FTSMETA2" // the metadata in a storage
+	headerLen  = 8 + 4
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func appendHeader(b []byte, magic string) []byte {
+	b = append(b, magic...)
+	return binary.LittleEndian.AppendUint32(b, FormatVersion)
+}
+
+// headerVersion returns the version in the header at the start of data, 0 if
+// data doesn't start with magic.
+func headerVersion(data []byte, magic string) (uint32, error) {
+	if len(data) < headerLen || string(data[:len(magic)]) != magic {
+		return 0, nil
+	}
+	v := binary.LittleEndian.Uint32(data[len(magic):headerLen])
+	if v > FormatVersion {
+		return v, fmt.Errorf("%w: version %d, this build reads up to %d", ErrFormatVersion, v, FormatVersion)
+	}
+	return v, nil
+}
+
+// seal puts a header in front of data and its checksum after it.
+func seal(magic string, data []byte) []byte {
+	b := appendHeader(make([]byte, 0, headerLen+len(data)+4), magic)
+	b = append(b, data...)
+	return binary.LittleEndian.AppendUint32(b, crc32.Checksum(data, castagnoli))
+}
+
+// unseal checks what seal wrote and returns the contents. Data without a header
+// is returned as it is.
+func unseal(magic string, data []byte) ([]byte, error) {
+	v, err := headerVersion(data, magic)
+	if err != nil || v == 0 {
+		return data, err
+	}
+	if len(data) < headerLen+4 {
+		return nil, fmt.Errorf("%w: truncated", ErrCorrupt)
+	}
+	body, sum := data[headerLen:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+	return body, nil
+}
+
+// checksumWriter writes through to w and sums what it wrote.
+type checksumWriter struct {
+	w   io.Writer
+	sum uint32
+}
+
+func (c *checksumWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.sum = crc32.Update(c.sum, castagnoli, b[:n])
+	return n, err
+}
+
+// checksumReader reads from r and sums what it read. It reads no further than
+// asked, so what follows can be read from r afterwards.
+type checksumReader struct {
+	r   *bufio.Reader
+	sum uint32
+}
+
+func (c *checksumReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.sum = crc32.Update(c.sum, castagnoli, b[:n])
+	return n, err
+}
+
+func (c *checksumReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.sum = crc32.Update(c.sum, castagnoli, []byte{b})
+	}
+	return b, err
+}
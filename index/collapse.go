@@ -0,0 +1,82 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+)
+
+// Field collapsing
+// A query like "golang tutorial" can fill the first page with ten articles of
+// one site, or with ten copies of a title. SearchOptions.Collapse keeps only the
+// first hit of each value of a field, in the order the hits come in, relevance
+// or Sort, and Result.Collapsed says how many more hits had that value. The
+// field is a keyword field (by its first value, case-insensitively), a numeric
+// one or the title, grouped through the same columns sorting reads. A hit with
+// no value isn't grouped with anything. Since every match has to be ranked to
+// know which hits are left, a collapsed search costs what a sorted one does.
+//
+// The index doesn't keep URLs, so a site to collapse on has to be indexed as a
+// keyword field: WithHost puts the host of the URL in HostField.
+const HostField = "host"
+
+// WithHost returns doc with the host of its URL, lowercased and without "www.",
+// in the keyword field host, unless it has one already or no URL with a host.
+func WithHost(doc Document) Document {
+	if len(doc.Keywords[HostField]) > 0 {
+		return doc
+	}
+	u, err := url.Parse(doc.URL)
+	if err != nil || u.Hostname() == "" {
+		return doc
+	}
+	keywords := make(map[string][]string, len(doc.Keywords)+1)
+	for field, values := range doc.Keywords {
+		keywords[field] = values
+	}
+	keywords[HostField] = []string{strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")}
+	doc.Keywords = keywords
+	return doc
+}
+
+// CheckCollapse reports an error for a field the index can't collapse on.
+func (idx *Index) CheckCollapse(field string) error {
+	if field != "" && field != FieldTitle && !idx.IsNumericField(field) && !idx.IsKeywordField(field) {
+		return fmt.Errorf("can't collapse on %s: not a numeric or keyword field", field)
+	}
+	return nil
+}
+
+// collapse keeps the first result of each value of field in r, ranked already,
+// counting the others in it.
+func (idx *Index) collapse(r []Result, field string) []Result {
+	c := idx.column(field)
+	first := make(map[string]int) // by value, the position in the kept results
+	kept := r[:0]
+	for _, res := range r {
+		value := c.value(res.ID)
+		if value == "" {
+			kept = append(kept, res)
+			continue
+		}
+		if i, ok := first[value]; ok {
+			kept[i].Collapsed++
+			continue
+		}
+		first[value] = len(kept)
+		kept = append(kept, res)
+	}
+	return kept
+}
+
+// value is what hits are grouped by, "" for a document without one.
+func (c *column) value(id int) string {
+	if c.numbers == nil {
+		return c.string(id)
+	}
+	if v := c.number(id); !math.IsNaN(v) {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+)
+
+// Compressed input
+// Dumps ship as .xml.gz or .xml.bz2. Rather than trusting the extension we peek at
+// the first bytes: gzip starts with 1f 8b and bzip2 with "BZh". Anything else is
+// read as it is. Decompression streams, nothing is unpacked to disk.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), nil
+	}
+	return br, nil
+}
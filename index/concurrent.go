@@ -0,0 +1,131 @@
+package index
+
+import "sync"
+
+// Concurrent building
+// Analysis and stemming dominate indexing time, and documents don't depend on each
+// other, so AddConcurrent cuts docs into one contiguous chunk per worker, builds a
+// partial index per chunk in parallel and then appends the partial posting lists
+// in chunk order. docs must be in ascending ID order, like for Add.
+func (idx *Index) AddConcurrent(docs []Document, workers int) error {
+	_, err := idx.AddConcurrentWithOptions(docs, workers, Options{})
+	return err
+}
+
+// AddConcurrentWithOptions is AddConcurrent reporting Progress and calling
+// TraceDoc, from the workers. Whether a document is a duplicate depends on the
+// documents before, so with DedupBy the documents are added one by one with
+// AddWithOptions instead. It returns the number of duplicates found.
+func (idx *Index) AddConcurrentWithOptions(docs []Document, workers int, opts Options) (int, error) {
+	if err := idx.Writable(); err != nil {
+		return 0, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	workers = min(workers, len(docs))
+	if workers <= 1 || opts.DedupBy != DedupNone {
+		return idx.AddWithOptions(docs, opts)
+	}
+	p, ownProgress := opts.progress, false
+	if p == nil {
+		p = newProgress(opts, len(docs))
+		ownProgress = p != nil
+	}
+	partOpts := Options{TraceDoc: opts.TraceDoc, progress: p}
+
+	parts := make([]*Index, workers)
+	size := (len(docs) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for w := range parts {
+		lo, hi := w*size, min((w+1)*size, len(docs))
+		parts[w] = New(idx.analyzer)
+		parts[w].storeOffsets = idx.storeOffsets
+		parts[w].fieldGap = idx.fieldGap
+		parts[w].exactForms = idx.exactForms
+
+		wg.Add(1)
+		go func(part *Index, chunk []Document) {
+			defer wg.Done()
+			part.AddWithOptions(chunk, partOpts)
+		}(parts[w], docs[lo:hi])
+	}
+	wg.Wait()
+
+	for _, part := range parts {
+		if idx.memLimit > 0 {
+			idx.account(part.MemoryUsage().Index())
+		}
+		idx.merge(part)
+	}
+	if ownProgress {
+		p.done()
+	}
+	return 0, nil
+}
+
+// merge appends other to idx. Every document in other must have a higher ID than
+// any document already in idx.
+func (idx *Index) merge(other *Index) {
+	idx.dropColumns()
+	idx.dropFilters()
+	for term, op := range other.terms {
+		p, ok := idx.changing(term)
+		if !ok {
+			idx.terms[term] = op
+			idx.termsDirty = true
+			continue
+		}
+		// Every ID in op is higher, so its blocks simply follow ours.
+		p.pack()
+		p.Blocks = append(p.Blocks, op.Blocks...)
+		p.IDs, p.Freqs, p.Positions = op.IDs, op.Freqs, op.Positions
+	}
+
+	for id, n := range other.docLen {
+		idx.docLen[id] = n
+	}
+	for id, boost := range other.boost {
+		idx.boost[id] = boost
+	}
+	for id, title := range other.titles {
+		idx.titles[id] = title
+	}
+	for id, byKey := range other.offsets {
+		idx.offsets[id] = byKey
+	}
+	idx.totalLen += other.totalLen
+
+	for field, byDoc := range other.keywords {
+		if _, ok := idx.keywords[field]; !ok {
+			idx.keywords[field] = make(map[int][]string)
+		}
+		for id, values := range byDoc {
+			idx.keywords[field][id] = values
+		}
+	}
+	for lang := range other.languages {
+		idx.languages[lang] = struct{}{}
+	}
+	for field, byDoc := range other.numbers {
+		for id, value := range byDoc {
+			idx.addNumber(field, value, id)
+		}
+	}
+	for field, byDoc := range other.geo {
+		for id, p := range byDoc {
+			idx.addGeoPoint(field, p, id)
+		}
+	}
+	for field, byDoc := range other.vectors {
+		for id, v := range byDoc {
+			idx.addVector(field, v, id)
+		}
+	}
+	for field, lens := range other.fieldLen {
+		for id, n := range lens {
+			idx.addFieldLength(field, id, n)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package index
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// corpus returns n documents drawn from a small vocabulary, so that terms repeat
+// across the chunks AddConcurrent cuts.
+func corpus(n int) []Document {
+	words := []string{"cat", "dog", "wild", "garden", "fox", "lynx", "forest", "river", "mountain", "tiger"}
+	docs := make([]Document, n)
+	for i := range docs {
+		text := ""
+		for j := 0; j < 12; j++ {
+			text += words[(i*7+j*j)%len(words)] + " "
+		}
+		docs[i] = Document{ID: i, Text: text}
+	}
+	return docs
+}
+
+func TestAddConcurrent(t *testing.T) {
+	docs := corpus(100)
+	want := New(nil)
+	want.Add(docs)
+
+	for _, workers := range []int{0, 1, 3, 8, 200} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			idx := New(nil)
+			idx.AddConcurrent(docs, workers)
+			for _, q := range []string{"cat", "wild fox", "lynx river tiger", "unicorn"} {
+				if got, want := idx.Search(q), want.Search(q); !slices.Equal(got, want) {
+					t.Errorf("Search(%q) = %v, want %v", q, got, want)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBuildConcurrent builds the same corpus with a growing number of
+// workers, up to the CPUs there are.
+func BenchmarkBuildConcurrent(b *testing.B) {
+	docs := corpus(10000)
+	for workers := 1; workers <= runtime.NumCPU(); workers *= 2 {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				New(nil).AddConcurrent(docs, workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decay
+// For news and the like a fresh article should beat an old one that matches a bit
+// better. SearchOptions.Decay multiplies every score with a factor that falls the
+// further a numeric field of the document is from Origin: 1 up to Offset away,
+// Decay at Offset+Scale, and on from there along a bell curve (DecayGauss), an
+// exponential (DecayExp) or a straight line down to 0 (DecayLinear). Dates are
+// numbers of seconds (see ParseNumber), so a date field with the origin left at 0,
+// the time of the search, and a scale of a month halves the score of what's a
+// month old with the default Decay. Documents without the field keep their score.
+//
+// The factor is never above 1, so RankTop can still skip documents that can't
+// make it whatever their factor.
+type Decay struct {
+	Field  string
+	Func   string  // DecayGauss, DecayExp or DecayLinear
+	Origin float64 // where nothing decays, the time of the search if 0
+	Scale  float64
+	Offset float64
+	Decay  float64 // the factor at Offset+Scale, DefaultDecay if 0
+}
+
+const (
+	DecayGauss  = "gauss"
+	DecayExp    = "exp"
+	DecayLinear = "linear"
+
+	DefaultDecay = 0.5
+)
+
+// ParseDecay reads a decay like "date:gauss(30d)": the field, the function and its
+// scale, and optionally the offset and the decay after it, "date:exp(7d,1d,0.3)".
+// Scale and offset are numbers or spans of time, in seconds, that end in s, m, h,
+// d or w. An origin other than now goes after an @: "year:linear(10)@2000", a
+// number or a date.
+func ParseDecay(spec string) (Decay, error) {
+	field, rest, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	fn, rest, ok := strings.Cut(rest, "(")
+	args, origin, ok2 := strings.Cut(rest, ")")
+	if field == "" || !ok || !ok2 {
+		return Decay{}, fmt.Errorf("bad decay %q, want field:func(scale)", spec)
+	}
+	d := Decay{Field: field, Func: fn}
+	if origin != "" {
+		v, ok := strings.CutPrefix(origin, "@")
+		if d.Origin, ok2 = ParseNumber(v); !ok || !ok2 {
+			return Decay{}, fmt.Errorf("bad decay origin %q", origin)
+		}
+	}
+	parts := strings.Split(args, ",")
+	if len(parts) > 3 {
+		return Decay{}, fmt.Errorf("bad decay %q: too many arguments", spec)
+	}
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		var v float64
+		var err error
+		if i == 2 {
+			v, err = strconv.ParseFloat(part, 64)
+		} else {
+			v, err = parseSpan(part)
+		}
+		if err != nil {
+			return Decay{}, fmt.Errorf("bad decay %q: %s", spec, err)
+		}
+		switch i {
+		case 0:
+			d.Scale = v
+		case 1:
+			d.Offset = v
+		case 2:
+			d.Decay = v
+		}
+	}
+	return d, d.check()
+}
+
+// parseSpan reads a number, or a span of time as seconds.
+func parseSpan(s string) (float64, error) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, nil
+	}
+	days := map[string]float64{"d": 24 * 3600, "w": 7 * 24 * 3600}
+	for suffix, seconds := range days {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			if v, err := strconv.ParseFloat(n, 64); err == nil {
+				return v * seconds, nil
+			}
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad span %q", s)
+	}
+	return d.Seconds(), nil
+}
+
+func (d Decay) check() error {
+	switch {
+	case d.Func != DecayGauss && d.Func != DecayExp && d.Func != DecayLinear:
+		return fmt.Errorf("unknown decay function %q, want gauss, exp or linear", d.Func)
+	case !(d.Scale > 0):
+		return fmt.Errorf("decay scale must be positive")
+	case d.Offset < 0:
+		return fmt.Errorf("decay offset can't be negative")
+	case d.Decay < 0 || d.Decay >= 1:
+		return fmt.Errorf("decay must be between 0 and 1")
+	}
+	return nil
+}
+
+// CheckDecay returns an error if d isn't a decay on a numeric field.
+func (idx *Index) CheckDecay(d *Decay) error {
+	if d == nil {
+		return nil
+	}
+	if !idx.IsNumericField(d.Field) {
+		return fmt.Errorf("can't decay on %s: not a numeric field", d.Field)
+	}
+	return d.check()
+}
+
+// Factor is what the score of a document with value is multiplied with.
+func (d Decay) Factor(value float64) float64 {
+	decay := d.Decay
+	if decay == 0 {
+		decay = DefaultDecay
+	}
+	dist := max(0, math.Abs(value-d.Origin)-d.Offset)
+	switch d.Func {
+	case DecayExp:
+		return math.Exp(math.Log(decay) * dist / d.Scale)
+	case DecayLinear:
+		s := d.Scale / (1 - decay)
+		return max(0, (s-dist)/s)
+	}
+	return math.Exp(math.Log(decay) * dist * dist / (d.Scale * d.Scale))
+}
+
+// scoring is s with the decay of opts, if it has one, its origin set, and its
+// match boosts.
+func (opts SearchOptions) scoring(s Scoring) Scoring {
+	s.boosts = opts.matchBoosts()
+	if opts.Decay != nil {
+		d := *opts.Decay
+		if d.Origin == 0 {
+			d.Origin = float64(time.Now().Unix())
+		}
+		s.decay = &d
+	}
+	return s
+}
+
+// decayFactor is what the decay of s multiplies the score of document id with, 1
+// without one or a value of its field.
+func (idx *Index) decayFactor(s Scoring, id int) float64 {
+	if s.decay == nil {
+		return 1
+	}
+	v, ok := idx.Number(s.decay.Field, id)
+	if !ok {
+		return 1
+	}
+	return s.decay.Factor(v)
+}
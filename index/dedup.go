@@ -0,0 +1,216 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Duplicates
+// Dumps are full of documents indexed twice: the same URL, the same abstract, or
+// an abstract that differs in a word or some punctuation. DedupURL and
+// DedupContentHash find the first two by an exact key. DedupNear finds the third by
+// a SimHash of the text's word shingles: near-identical texts get hashes that
+// differ in only a few bits, and two documents whose hashes are at most the Seen's
+// distance apart are taken for the same one.
+//
+// A duplicate is skipped, replaces the document it duplicates (which is deleted),
+// or is indexed with DuplicateField set to the ID of the first one, so searches
+// and facets can tell them apart.
+type DedupMode int
+
+const (
+	DedupNone DedupMode = iota
+	DedupURL
+	DedupContentHash
+	DedupNear
+)
+
+type DuplicatePolicy int
+
+const (
+	DuplicateSkip DuplicatePolicy = iota
+	DuplicateReplace
+	DuplicateTag
+)
+
+// DuplicateField is the keyword field DuplicateTag sets.
+const DuplicateField = "duplicate_of"
+
+// DefaultNearDistance is the number of bits SimHashes of near-duplicates may
+// differ in. An abstract has few shingles, so a changed word moves its hash more
+// than it would a web page's; six of 64 bits catches a word or two, and unrelated
+// texts, some 32 bits apart, practically never get that close.
+const DefaultNearDistance = 6
+
+// shingleSize is the number of words hashed together.
+const shingleSize = 3
+
+// Seen remembers the documents indexed with dedup on. A near-duplicate is looked
+// up by bands of its hash: with distance+1 bands, two hashes at most distance
+// bits apart have at least one band in common, so only documents sharing a band
+// are compared.
+type Seen struct {
+	distance int
+	keys     map[string]int // exact key to document ID
+
+	bandBits int
+	bands    []map[uint64][]simDoc
+
+	// Documents replaced by a later duplicate, see resolve.
+	replaced map[int]int
+}
+
+type simDoc struct {
+	hash uint64
+	id   int
+}
+
+// NewSeen returns a Seen for near-duplicates at most distance bits apart.
+func NewSeen(distance int) *Seen {
+	distance = min(max(distance, 0), 63)
+	s := &Seen{distance: distance, keys: make(map[string]int), replaced: make(map[int]int)}
+	s.bandBits = 64 / (distance + 1)
+	s.bands = make([]map[uint64][]simDoc, distance+1)
+	for i := range s.bands {
+		s.bands[i] = make(map[uint64][]simDoc)
+	}
+	return s
+}
+
+func (s *Seen) band(hash uint64, i int) uint64 {
+	return hash >> (i * s.bandBits) & (1<<s.bandBits - 1)
+}
+
+func (s *Seen) near(hash uint64) (int, bool) {
+	for i, band := range s.bands {
+		for _, d := range band[s.band(hash, i)] {
+			if bits.OnesCount64(d.hash^hash) <= s.distance {
+				return s.resolve(d.id), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func (s *Seen) addNear(hash uint64, id int) {
+	for i, band := range s.bands {
+		b := s.band(hash, i)
+		band[b] = append(band[b], simDoc{hash, id})
+	}
+}
+
+// resolve follows id to the document that replaced it, if any.
+func (s *Seen) resolve(id int) int {
+	for {
+		next, ok := s.replaced[id]
+		if !ok {
+			return id
+		}
+		id = next
+	}
+}
+
+// SimHash hashes the word shingles of tokens into 64 bits such that similar token
+// lists get hashes differing in few bits.
+func SimHash(tokens []string) uint64 {
+	var weights [64]int
+	n := max(len(tokens)-shingleSize+1, 1)
+	for i := 0; i < n; i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(tokens[i:min(i+shingleSize, len(tokens))], " ")))
+		sum := h.Sum64()
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var r uint64
+	for bit, w := range weights {
+		if w > 0 {
+			r |= 1 << bit
+		}
+	}
+	return r
+}
+
+// dedupKey is the exact key of doc, "" if it has no URL or no text to tell it by:
+// documents without one aren't duplicates of each other.
+func dedupKey(doc Document, mode DedupMode) string {
+	switch mode {
+	case DedupURL:
+		return doc.URL
+	case DedupContentHash:
+		if strings.TrimSpace(doc.Text) == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(doc.Text))
+		return hex.EncodeToString(sum[:])
+	}
+	return ""
+}
+
+// dedup checks doc against the documents seen so far and applies the policy. It
+// returns the document to index, tagged maybe, and false if it's to be skipped.
+func (b *batch) dedup(doc Document) (Document, bool) {
+	seen := b.opts.Seen
+
+	var hash uint64
+	first, dup := 0, false
+	if b.opts.DedupBy == DedupNear {
+		tokens := b.idx.FieldAnalyzer(FieldText).Analyze(doc.Text)
+		if len(tokens) == 0 {
+			return doc, true
+		}
+		hash = SimHash(tokens)
+		first, dup = seen.near(hash)
+	} else {
+		key := dedupKey(doc, b.opts.DedupBy)
+		if key == "" {
+			return doc, true
+		}
+		if first, dup = seen.keys[key]; dup {
+			first = seen.resolve(first)
+		}
+		if !dup || b.opts.Duplicates == DuplicateReplace {
+			seen.keys[key] = doc.ID
+		}
+	}
+
+	remember := func() {
+		if b.opts.DedupBy == DedupNear {
+			seen.addNear(hash, doc.ID)
+		}
+	}
+	if !dup {
+		remember()
+		return doc, true
+	}
+
+	b.dups++
+	switch b.opts.Duplicates {
+	case DuplicateReplace:
+		if first != doc.ID {
+			b.idx.Delete(first)
+			seen.replaced[first] = doc.ID
+		}
+		remember()
+	case DuplicateTag:
+		keywords := make(map[string][]string, len(doc.Keywords)+1)
+		for field, values := range doc.Keywords {
+			keywords[field] = values
+		}
+		keywords[DuplicateField] = []string{strconv.Itoa(first)}
+		doc.Keywords = keywords
+	default:
+		return doc, false
+	}
+	return doc, true
+}
@@ -0,0 +1,74 @@
+package index
+
+import "testing"
+
+func TestDedup(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     DedupMode
+		docs     []Document
+		dups     int
+		indexed  int
+		findable string // a term of every document that has to be found
+	}{
+		{
+			name:    "same URL twice",
+			mode:    DedupURL,
+			docs:    []Document{{URL: "https://a", Text: "wild cat"}, {URL: "https://a", Text: "wild cat"}},
+			dups:    1,
+			indexed: 1,
+		},
+		{
+			name:    "different URLs",
+			mode:    DedupURL,
+			docs:    []Document{{URL: "https://a", Text: "wild cat"}, {URL: "https://b", Text: "wild cat"}},
+			indexed: 2,
+		},
+		{
+			name: "no URLs",
+			mode: DedupURL,
+			docs: []Document{
+				{Title: "Lion", Text: "lion"},
+				{Title: "Tiger", Text: "tiger"},
+				{Title: "Lynx", Text: "lynx"},
+			},
+			indexed:  3,
+			findable: "tiger",
+		},
+		{
+			name:    "same text twice",
+			mode:    DedupContentHash,
+			docs:    []Document{{URL: "https://a", Text: "wild cat"}, {URL: "https://b", Text: "wild cat"}},
+			dups:    1,
+			indexed: 1,
+		},
+		{
+			name:     "no texts",
+			mode:     DedupContentHash,
+			docs:     []Document{{Title: "Lion"}, {Title: "Tiger"}, {Title: "Lynx", Text: " "}},
+			indexed:  3,
+			findable: "tiger",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.docs {
+				tt.docs[i].ID = i
+			}
+			idx := New(nil)
+			dups, err := idx.AddWithOptions(tt.docs, Options{DedupBy: tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dups != tt.dups {
+				t.Errorf("got %d duplicates, want %d", dups, tt.dups)
+			}
+			if n := idx.Len(); n != tt.indexed {
+				t.Errorf("indexed %d documents, want %d", n, tt.indexed)
+			}
+			if tt.findable != "" && len(idx.Search(tt.findable)) == 0 {
+				t.Errorf("%q isn't found", tt.findable)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package index
+
+import "errors"
+
+// Deleting and updating
+// Delete only marks a document as gone: it disappears from every lookup at once,
+// but its entries are left in the posting lists. Removing them means touching every
+// term, so that's done in bulk by Compact, which runs by itself once the tombstones
+// reach compactRatio of the live documents.
+const compactRatio = 0.1
+
+var ErrNoDocument = errors.New("document not in index")
+
+func (idx *Index) Delete(id int) error {
+	if err := idx.Writable(); err != nil {
+		return err
+	}
+	if !idx.forget(id) {
+		return ErrNoDocument
+	}
+	idx.deleted[id] = struct{}{}
+
+	if float64(len(idx.deleted)) > compactRatio*float64(len(idx.docLen)) {
+		idx.Compact()
+	}
+	return nil
+}
+
+// Update re-indexes doc under its ID, replacing whatever was indexed for it before.
+// The old postings have to go right away since the new ones share the ID, which
+// costs a pass over the term dictionary.
+func (idx *Index) Update(doc Document) error {
+	if err := idx.Writable(); err != nil {
+		return err
+	}
+	idx.forget(doc.ID)
+	delete(idx.deleted, doc.ID)
+	idx.purge(map[int]struct{}{doc.ID: {}})
+
+	return idx.Add([]Document{doc})
+}
+
+// Compact drops the postings of deleted documents. An index opened from disk
+// keeps its tombstones.
+func (idx *Index) Compact() {
+	if len(idx.deleted) == 0 || idx.disk != nil {
+		return
+	}
+	idx.purge(idx.deleted)
+	idx.deleted = make(map[int]struct{})
+}
+
+func (idx *Index) purge(ids map[int]struct{}) {
+	if idx.storage != nil {
+		idx.purgeStored(ids)
+		return
+	}
+	for term, p := range idx.terms {
+		if p.without(ids) == 0 {
+			delete(idx.terms, term)
+			idx.termsDirty = true
+		}
+	}
+}
+
+// purgeStored is purge for an index with a storage, which reads every list but
+// only keeps the changed ones in memory.
+func (idx *Index) purgeStored(ids map[int]struct{}) {
+	for _, term := range append([]string(nil), idx.Terms()...) {
+		_, loaded := idx.terms[term]
+		p, _ := idx.changing(term)
+		n := p.len()
+		switch left := p.without(ids); {
+		case left == 0:
+			idx.drop(term)
+		case left == n && !loaded:
+			delete(idx.terms, term)
+		}
+	}
+}
+
+// live filters deleted documents out of a posting list. With no tombstones it
+// returns ids itself.
+func (idx *Index) live(ids []int) []int {
+	if len(idx.deleted) == 0 {
+		return ids
+	}
+
+	r := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := idx.deleted[id]; !ok {
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// Has reports whether a live document with this ID is indexed.
+func (idx *Index) Has(id int) bool {
+	_, ok := idx.docLen[id]
+	return ok
+}
@@ -0,0 +1,351 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// On-disk index
+// Even packed, the posting lists of a full Wikipedia dump don't fit the memory of
+// a small machine. SaveDisk writes an index in a format that OpenDisk maps into
+// memory instead of reading it: only the term dictionary and the per-document
+// numbers are loaded, a posting list is looked up when a query needs it and its
+// blocks point straight into the mapping, so the operating system pages them in
+// and out as it likes. The file is
+//
+//	magic, version (see checksum.go)
+//	the posting lists, in term order, each a block count and per block its
+//	  highest ID, entry count, positions flag, data length and data
+//	the dictionary: the term count, then each term with the offset of its list
+//	everything else, gob-encoded like Save does
+//	footer: offsets of dictionary and gob (8 bytes each), CRC-32C of the posting
+//	  lists and of dictionary and gob (4 bytes each), magic
+//
+// Files of version 1 start with diskMagicV1 and have neither the version nor the
+// checksums.
+//
+// An index opened this way is read-only: adding, updating and deleting documents
+// returns ErrReadOnly. Close unmaps the file, after which neither the index
+// nor anything it returned may be used.
+const (
+	diskMagic   = "FTSDISKV"
+	diskMagicV1 = "FTSDISK1"
+)
+
+var ErrReadOnly = errors.New("index opened from disk is read-only")
+
+type diskTerms struct {
+	data    []byte
+	sorted  []string
+	offsets map[string]int
+	unmap   func() error
+
+	lists    []byte // all of the posting lists
+	listsSum uint32
+	summed   bool // whether the file has listsSum
+
+	// The lists decoded so far, see Warmup; warm marks the ones copied out of
+	// the mapping.
+	mu    sync.Mutex
+	cache map[string]*postings
+	warm  map[string]bool
+}
+
+func (idx *Index) SaveDisk(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	w.Write(appendHeader(nil, diskMagic))
+	at := headerLen
+	var sums [2]uint32 // of the lists, and of what follows them
+	section := 0
+	write := func(b []byte) {
+		w.Write(b)
+		at += len(b)
+		sums[section] = crc32.Update(sums[section], castagnoli, b)
+	}
+	var buf []byte
+	uvarint := func(x int) {
+		buf = binary.AppendUvarint(buf[:0], uint64(x))
+		write(buf)
+	}
+
+	terms := idx.Terms()
+	if idx.pruning() {
+		// Left out, not dropped, like Save does.
+		kept := make([]string, 0, len(terms))
+		for _, term := range terms {
+			if !idx.rare(term) {
+				kept = append(kept, term)
+			}
+		}
+		terms = kept
+	}
+	offsets := make([]int, len(terms))
+	for i, term := range terms {
+		offsets[i] = at
+		p, _ := idx.lookup(term)
+		ids, freqs, positions := p.entries()
+		buf = appendBlocks(buf[:0], newPostings(ids, freqs, positions).Blocks)
+		write(buf)
+	}
+
+	dictAt := at
+	section = 1
+	uvarint(len(terms))
+	for i, term := range terms {
+		uvarint(len(term))
+		write([]byte(term))
+		uvarint(offsets[i])
+	}
+
+	metaAt := at
+	var meta bytes.Buffer
+	if err := gob.NewEncoder(&meta).Encode(idx.file(nil)); err != nil {
+		return err
+	}
+	write(meta.Bytes())
+
+	footer := binary.LittleEndian.AppendUint64(nil, uint64(dictAt))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(metaAt))
+	footer = binary.LittleEndian.AppendUint32(footer, sums[0])
+	footer = binary.LittleEndian.AppendUint32(footer, sums[1])
+	w.Write(append(footer, diskMagic...))
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// OpenDisk maps an index written by SaveDisk. Like LoadWithAnalyzer it uses the
+// saved standard analyzer if analyzer is nil.
+func OpenDisk(path string, analyzer analysis.Analyzer) (*Index, error) {
+	data, unmap, err := mmapFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := openDisk(data, analyzer)
+	if err != nil {
+		unmap()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	idx.disk.unmap = unmap
+	return idx, nil
+}
+
+func openDisk(data []byte, analyzer analysis.Analyzer) (*Index, error) {
+	magic, start, footerLen := diskMagic, headerLen, 24+len(diskMagic)
+	if len(data) >= len(diskMagicV1) && string(data[:len(diskMagicV1)]) == diskMagicV1 {
+		magic, start, footerLen = diskMagicV1, len(diskMagicV1), 16+len(diskMagicV1)
+	}
+	if len(data) < start+footerLen || string(data[:len(magic)]) != magic || string(data[len(data)-len(magic):]) != magic {
+		return nil, errors.New("not an on-disk index")
+	}
+	if _, err := headerVersion(data, diskMagic); err != nil {
+		return nil, err
+	}
+	footer := data[len(data)-footerLen:]
+	dictAt := int(binary.LittleEndian.Uint64(footer))
+	metaAt := int(binary.LittleEndian.Uint64(footer[8:]))
+	if dictAt < start || dictAt > metaAt || metaAt > len(data)-footerLen {
+		return nil, fmt.Errorf("%w: bad footer", ErrCorrupt)
+	}
+	d := &diskTerms{data: data, lists: data[start:dictAt], offsets: make(map[string]int), cache: make(map[string]*postings), warm: make(map[string]bool)}
+	if magic == diskMagic {
+		d.listsSum, d.summed = binary.LittleEndian.Uint32(footer[16:]), true
+		if crc32.Checksum(data[dictAt:len(data)-footerLen], castagnoli) != binary.LittleEndian.Uint32(footer[20:]) {
+			return nil, fmt.Errorf("%w: checksum mismatch in the dictionary or metadata", ErrCorrupt)
+		}
+	}
+
+	var file indexFile
+	if err := gob.NewDecoder(bytes.NewReader(data[metaAt : len(data)-footerLen])).Decode(&file); err != nil {
+		return nil, err
+	}
+	if analyzer == nil && file.Analyzer != nil {
+		analyzer = file.Analyzer
+	}
+
+	r := diskReader{data: data[dictAt:metaAt]}
+	n := r.uvarint()
+	if n > len(r.data) {
+		return nil, errors.New("dictionary: truncated")
+	}
+	d.sorted = make([]string, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		term := string(r.bytes(r.uvarint()))
+		d.sorted = append(d.sorted, term)
+		d.offsets[term] = r.uvarint()
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("dictionary: %w", r.err)
+	}
+	if !sort.StringsAreSorted(d.sorted) {
+		return nil, errors.New("dictionary: terms out of order")
+	}
+
+	idx := New(analyzer)
+	idx.disk = d
+	idx.restore(file)
+	return idx, nil
+}
+
+// Verify checks the posting lists of an index opened with OpenDisk against their
+// checksum, which reads all of them. Any other index was checked as it was loaded,
+// and so are files from before checksums, which it can't check.
+func (idx *Index) Verify() error {
+	if idx.disk == nil || !idx.disk.summed {
+		return nil
+	}
+	if crc32.Checksum(idx.disk.lists, castagnoli) != idx.disk.listsSum {
+		return fmt.Errorf("%w: checksum mismatch in the posting lists", ErrCorrupt)
+	}
+	return nil
+}
+
+// Close releases the mapping of an index opened with OpenDisk, or closes the
+// storage of one opened with NewWithStorage without committing.
+func (idx *Index) Close() error {
+	if idx.storage != nil {
+		return idx.storage.Close()
+	}
+	if idx.disk == nil || idx.disk.unmap == nil {
+		return nil
+	}
+	err := idx.disk.unmap()
+	idx.disk.unmap = nil
+	return err
+}
+
+// postings returns term's list, decoding its block headers the first time.
+func (d *diskTerms) postings(term string) (*postings, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if p, ok := d.cache[term]; ok {
+		return p, true
+	}
+	p, ok := d.parse(term)
+	if ok {
+		d.cache[term] = p
+	}
+	return p, ok
+}
+
+// parse decodes the block headers of term's list; the block data stays in the
+// mapping.
+func (d *diskTerms) parse(term string) (*postings, bool) {
+	off, ok := d.offsets[term]
+	if !ok || off >= len(d.data) {
+		return nil, false
+	}
+
+	p, err := parseBlocks(d.data[off:])
+	return p, err == nil
+}
+
+// appendBlocks encodes blocks the way SaveDisk writes a posting list: the block
+// count, then per block its highest ID, entry count, positions flag, data length
+// and data.
+func appendBlocks(buf []byte, blocks []postingBlock) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(blocks)))
+	for _, b := range blocks {
+		flag := uint64(0)
+		if b.Positions {
+			flag = 1
+		}
+		buf = binary.AppendUvarint(buf, uint64(b.Last))
+		buf = binary.AppendUvarint(buf, uint64(b.N))
+		buf = binary.AppendUvarint(buf, flag)
+		buf = binary.AppendUvarint(buf, uint64(len(b.Data)))
+		buf = append(buf, b.Data...)
+	}
+	return buf
+}
+
+// parseBlocks decodes what appendBlocks wrote; the block data points into data.
+func parseBlocks(data []byte) (*postings, error) {
+	r := diskReader{data: data}
+	n := r.uvarint()
+	if n > len(r.data) {
+		return nil, errors.New("truncated")
+	}
+	p := &postings{Blocks: make([]postingBlock, n)}
+	for i := range p.Blocks {
+		b := &p.Blocks[i]
+		b.Last, b.N, b.Positions = r.uvarint(), r.uvarint(), r.uvarint() == 1
+		b.Data = r.bytes(r.uvarint())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return p, nil
+}
+
+type diskReader struct {
+	data []byte
+	err  error
+}
+
+func (r *diskReader) uvarint() int {
+	if r.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errors.New("truncated")
+		return 0
+	}
+	r.data = r.data[n:]
+	return int(x)
+}
+
+func (r *diskReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errors.New("truncated")
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// lookup finds the posting list of a dictionary key, in memory, on disk or in the
+// index's storage.
+func (idx *Index) lookup(term string) (*postings, bool) {
+	if idx.disk != nil {
+		return idx.disk.postings(term)
+	}
+	p, ok := idx.terms[term]
+	if ok || idx.storage == nil {
+		return p, ok
+	}
+	return idx.stored(term)
+}
+
+// Writable returns ErrReadOnly for an index opened with OpenDisk, nil for one that
+// can change.
+func (idx *Index) Writable() error {
+	if idx.disk != nil {
+		return ErrReadOnly
+	}
+	return nil
+}
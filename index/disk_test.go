@@ -0,0 +1,61 @@
+package index
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenDiskReadOnly(t *testing.T) {
+	idx := New(nil)
+	if err := idx.Add([]Document{{ID: 0, Title: "Cat", Text: "a wild cat"}, {ID: 1, Title: "Dog", Text: "a dog"}}); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "index.ftsd")
+	if err := idx.SaveDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := OpenDisk(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+
+	tests := []struct {
+		name   string
+		change func() error
+	}{
+		{"add", func() error { return mapped.Add([]Document{{ID: 2, Text: "a fox"}}) }},
+		{"add with options", func() error {
+			_, err := mapped.AddWithOptions([]Document{{ID: 2, Text: "a fox"}}, Options{})
+			return err
+		}},
+		{"add concurrent", func() error {
+			return mapped.AddConcurrent([]Document{{ID: 2, Text: "a fox"}, {ID: 3, Text: "an owl"}}, 2)
+		}},
+		{"add within limit", func() error {
+			_, _, err := mapped.AddWithinLimit([]Document{{ID: 2, Text: "a fox"}}, 1, Options{})
+			return err
+		}},
+		{"add stream", func() error {
+			_, err := mapped.AddStream(strings.NewReader("<feed><doc><title>Fox</title><abstract>a fox</abstract></doc></feed>"), Options{})
+			return err
+		}},
+		{"update", func() error { return mapped.Update(Document{ID: 0, Text: "a tame cat"}) }},
+		{"delete", func() error { return mapped.Delete(0) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); !errors.Is(err, ErrReadOnly) {
+				t.Fatalf("err = %v, want ErrReadOnly", err)
+			}
+			if n := len(mapped.Search("cat")); n != 1 {
+				t.Errorf("cat finds %d documents after the refused change, want 1", n)
+			}
+			if n := mapped.Len(); n != 2 {
+				t.Errorf("%d documents after the refused change, want 2", n)
+			}
+		})
+	}
+}
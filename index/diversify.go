@@ -0,0 +1,102 @@
+package index
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Diversifying
+// Collapsing keeps one hit of each site; when one site has most of the good
+// answers to a topic that's too few, and without it the first page is all that
+// site. SearchOptions.Diversify lets Max hits of a value of Field through among
+// the best Window and moves the others behind the rest of them, where they stay in
+// order: with a Max of 2, the third hit of a site comes after every hit of the
+// window that's within its site's 2. Hits past the window aren't moved, so a
+// document can only be demoted, never make it onto the first page from far down.
+// The field is one collapse takes; a hit without a value isn't counted.
+//
+// The window is DefaultDiversifyWindow, or Offset+Limit if that's more, and only
+// that many hits are ranked, as RankTop does for a page.
+type Diversify struct {
+	Field  string
+	Max    int // hits of a value in the window before the others are moved back
+	Window int // the best hits that are reordered, DefaultDiversifyWindow if 0
+}
+
+const DefaultDiversifyWindow = 100
+
+// ParseDiversify reads "host:2", at most 2 hits of a host, with the window after
+// another colon if it isn't the default: "host:2:500".
+func ParseDiversify(spec string) (Diversify, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return Diversify{}, fmt.Errorf("bad diversify %q, want field:max or field:max:window", spec)
+	}
+	d := Diversify{Field: parts[0]}
+	var err error
+	if d.Max, err = strconv.Atoi(parts[1]); err != nil {
+		return Diversify{}, fmt.Errorf("bad diversify max %q", parts[1])
+	}
+	if len(parts) == 3 {
+		if d.Window, err = strconv.Atoi(parts[2]); err != nil {
+			return Diversify{}, fmt.Errorf("bad diversify window %q", parts[2])
+		}
+	}
+	return d, d.check()
+}
+
+func (d Diversify) check() error {
+	switch {
+	case d.Max < 1:
+		return fmt.Errorf("diversify max must be at least 1")
+	case d.Window < 0:
+		return fmt.Errorf("diversify window can't be negative")
+	}
+	return nil
+}
+
+// CheckDiversify returns an error if d isn't on a field the index can collapse on.
+func (idx *Index) CheckDiversify(d *Diversify) error {
+	if d == nil {
+		return nil
+	}
+	if d.Field == "" {
+		return fmt.Errorf("diversify without a field")
+	}
+	if err := idx.CheckCollapse(d.Field); err != nil {
+		return fmt.Errorf("can't diversify on %s: not a numeric or keyword field", d.Field)
+	}
+	return d.check()
+}
+
+// window is how many of the best hits are ranked for a page ending at end.
+func (d Diversify) window(end int) int {
+	if d.Window == 0 {
+		return max(DefaultDiversifyWindow, end)
+	}
+	return max(d.Window, end)
+}
+
+// diversify moves the hits of r, ranked already, past d.Max of their value in
+// the window for a page ending at end behind the others of the window.
+func (idx *Index) diversify(r []Result, d Diversify, end int) []Result {
+	n := min(d.window(end), len(r))
+	c := idx.column(d.Field)
+	seen := make(map[string]int)
+	kept := make([]Result, 0, len(r))
+	var moved []Result
+	for _, res := range r[:n] {
+		value := c.value(res.ID)
+		if value != "" {
+			seen[value]++
+			if seen[value] > d.Max {
+				moved = append(moved, res)
+				continue
+			}
+		}
+		kept = append(kept, res)
+	}
+	kept = append(kept, moved...)
+	return append(kept, r[n:]...)
+}
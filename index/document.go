@@ -0,0 +1,72 @@
+package index
+
+import "io"
+
+// Documents
+// One <doc> element of the Wikipedia abstract dump. IDs are assigned in load order.
+// Keywords holds keyword fields like category, see facets.go, Numbers numeric
+// fields like year, see numeric.go, Geo places, see geo.go, and Vectors
+// embeddings, see knn.go; the dump has none of them. Language is the ISO
+// 639-1 code of the text if it isn't the analyzer's, see analysis.ForLanguage and
+// language.go.
+type Document struct {
+	Title    string               `xml:"title" json:"title"`
+	URL      string               `xml:"url" json:"url"`
+	Text     string               `xml:"abstract" json:"text"`
+	Boost    float64              `xml:"boost" json:"boost,omitempty"`
+	Keywords map[string][]string  `xml:"-" json:"keywords,omitempty"`
+	Numbers  map[string]float64   `xml:"-" json:"numbers,omitempty"`
+	Geo      map[string]GeoPoint  `xml:"-" json:"geo,omitempty"`
+	Vectors  map[string][]float32 `xml:"-" json:"vectors,omitempty"`
+	Nested   map[string][]Nested  `xml:"-" json:"nested,omitempty"`
+	Language string               `xml:"-" json:"language,omitempty"`
+	ID       int                  `xml:"-" json:"id"`
+}
+
+// Documents without an explicit boost are treated as neutral.
+const DefaultBoost = 1.0
+
+// Loading documents
+// The full dump is several gigabytes, so instead of decoding it in one go we walk
+// the XML stream and decode one <doc> element at a time. EachDocument hands every
+// document to fn as soon as it is read; nothing else is kept in memory. Documents
+// are numbered in the order they appear, starting at 0. A malformed record stops
+// the walk with a *ParseError (see records.go), and so does an error from fn,
+// which is returned as it is.
+func EachDocument(r io.Reader, fn func(Document) error) error {
+	return eachXMLDocument(r, false, fn)
+}
+
+// LoadDocuments reads a dump, or JSON lines or CSV with the default field
+// mapping if the extension says so (see FormatOf). It's lenient: bad records are
+// left out and reported in a ParseErrors that comes with the rest.
+func LoadDocuments(path string) ([]Document, error) {
+	return Loader{Format: FormatOf(path), Lenient: true}.Load(path)
+}
+
+// AddStream indexes documents straight from a dump as they are decoded, so memory
+// only grows with the index, never with the raw text. A gzip or bzip2 compressed
+// dump is decompressed on the fly. It returns the number of duplicates found.
+func (idx *Index) AddStream(r io.Reader, opts Options) (int, error) {
+	if err := idx.Writable(); err != nil {
+		return 0, err
+	}
+	counted := &countingReader{r: r}
+	r, err := Decompress(counted)
+	if err != nil {
+		return 0, err
+	}
+
+	b := idx.newBatch(opts, 0)
+	if b.progress != nil {
+		b.progress.read = counted
+	}
+	err = EachDocument(r, func(doc Document) error {
+		if err := idx.makeRoom(); err != nil {
+			return err
+		}
+		b.add(doc)
+		return nil
+	})
+	return b.finish(), err
+}
@@ -0,0 +1,35 @@
+package index
+
+import "testing"
+
+func TestBoostOrdersEqualMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		boosts []float64 // of documents 0, 1, 2 with the same text
+		want   []int
+	}{
+		{"ascending", []float64{1, 2, 3}, []int{2, 1, 0}},
+		{"descending", []float64{3, 2, 1}, []int{0, 1, 2}},
+		{"default is 1", []float64{0, 0.5, 1.5}, []int{2, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := New(nil)
+			var docs []Document
+			for i, b := range tt.boosts {
+				docs = append(docs, Document{ID: i, Text: "wild cats of europe", Boost: b})
+			}
+			idx.Add(docs)
+
+			results := idx.Search("wild cat")
+			if len(results) != len(tt.want) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.want))
+			}
+			for i, id := range tt.want {
+				if results[i].ID != id {
+					t.Errorf("result %d is document %d, want %d (%v)", i, results[i].ID, id, results)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package index
+
+import "github.com/leoashish/FullTextSearchApp/analysis"
+
+// Exact forms
+// Stemming finds "cats" for "cat", but then a document that says "cats" ranks as
+// high for "cat" as one that says "cat". With SetExactForms the default fields
+// are indexed a second time without the stemmer, as ExactField(field), and
+// SearchOptions.ExactBoost (see boosts.go) raises the documents that have the
+// words of the query in the form they were typed. That takes an analyzer that
+// can do without its stemmer (analysis.Unstemmer), like analysis.Standard; with
+// another one there are no exact forms.
+const exactSuffix = ".exact"
+
+// ExactField is the field the exact forms of field are indexed as.
+func ExactField(field string) string {
+	return field + exactSuffix
+}
+
+// SetExactForms indexes the exact forms of the documents added from now on, or
+// stops.
+func (idx *Index) SetExactForms(on bool) {
+	idx.exactForms = on
+}
+
+// ExactForms reports whether SetExactForms is on.
+func (idx *Index) ExactForms() bool {
+	return idx.exactForms
+}
+
+// unstemmed is the analyzer of field without its stemmer, nil if it can't leave
+// it out.
+func (idx *Index) unstemmed(field string) analysis.Analyzer {
+	if u, ok := idx.FieldAnalyzer(field).(analysis.Unstemmer); ok {
+		return u.Unstemmed()
+	}
+	return nil
+}
+
+// addExact indexes the exact forms of text, field of document id.
+func (b *batch) addExact(id int, field, text, lang string) {
+	a := b.idx.unstemmed(field)
+	if a == nil {
+		return
+	}
+	positions := make(map[string][]int)
+	for pos, token := range analysis.ForLanguage(a, lang).Analyze(text) {
+		key := FieldKey(ExactField(field), token)
+		positions[key] = append(positions[key], pos)
+	}
+	for key, pos := range positions {
+		b.idx.addPosting(key, id, pos)
+	}
+}
+
+// ExactKeys returns the keys of the exact forms of the words of text in field, or
+// the default fields if field is "", one list for each of the n tokens text
+// analyzes into. It's nil without SetExactForms or if they don't line up with
+// the tokens, the stemmer having dropped or added some.
+func (idx *Index) ExactKeys(field, text string, n int) [][]string {
+	if !idx.exactForms {
+		return nil
+	}
+	var r [][]string
+	for _, f := range searchFields(field) {
+		a := idx.unstemmed(f)
+		if a == nil || !isDefaultField(f) {
+			continue
+		}
+		tokens := a.Analyze(text)
+		if len(tokens) != n {
+			return nil
+		}
+		if r == nil {
+			r = make([][]string, n)
+		}
+		for i, token := range tokens {
+			r[i] = append(r[i], FieldKey(ExactField(f), token))
+		}
+	}
+	return r
+}
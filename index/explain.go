@@ -0,0 +1,142 @@
+package index
+
+import "strings"
+
+// Explaining scores
+// Explain takes a document's score apart: for every query term that occurs in it
+// (and every proximity clause it satisfies) the numbers the scorer was given and
+// what the term added, field boost included, the same field by field for a term
+// group (see TermGroup), then the document's own boost, the factor of a decay
+// (see SearchOptions.Decay) and that of the match boosts (see boosts.go). The
+// parts add up to Score the same way Rank adds them, so it's what to look at when
+// a hit ranks higher or lower than it should. IDF is BM25's, whatever the scorer,
+// and a proximity clause has no DocFreq of its own.
+type Explanation struct {
+	Score  float64            `json:"score"`
+	Terms  []TermExplanation  `json:"terms"`
+	Groups []GroupExplanation `json:"groups,omitempty"`
+	Boost  float64            `json:"boost"` // the document's
+	Decay  float64            `json:"decay,omitempty"`
+	Match  float64            `json:"match,omitempty"`
+	Hybrid *HybridExplanation `json:"hybrid,omitempty"`
+	// Set if a DocumentScorer changed the score, to what it was before.
+	Unadjusted float64 `json:"unadjusted,omitempty"`
+}
+
+type TermExplanation struct {
+	Field string `json:"field"`
+	Term  string `json:"term"` // the terms of a proximity clause, space-separated
+
+	// For a proximity clause Slop, and Windows instead of Freq (see Proximity).
+	Proximity bool    `json:"proximity,omitempty"`
+	Slop      int     `json:"slop,omitempty"`
+	Windows   float64 `json:"windows,omitempty"`
+
+	Freq           int     `json:"freq,omitempty"`
+	FieldLength    int     `json:"field_length"`
+	AvgFieldLength float64 `json:"avg_field_length"`
+	DocFreq        int     `json:"doc_freq,omitempty"`
+	IDF            float64 `json:"idf"`
+	FieldBoost     float64 `json:"field_boost"`
+	Score          float64 `json:"score"`
+}
+
+// Explain explains the score of document id for s, 0 with no terms if it doesn't
+// match any of them.
+func (idx *Index) Explain(id int, s Scoring) Explanation {
+	e := Explanation{Terms: []TermExplanation{}, Boost: 1}
+	if b, ok := idx.boost[id]; ok {
+		e.Boost = b
+	}
+
+	for _, c := range idx.cursors(s, idx) {
+		score := c.score(idx, id)
+		if score == 0 {
+			continue
+		}
+		if c.group != nil {
+			e.Groups = append(e.Groups, idx.explainGroup(c, id, score))
+		} else {
+			e.Terms = append(e.Terms, idx.explainTerm(c, id, score))
+		}
+		e.Score += score
+	}
+
+	boost := e.Boost
+	if s.decay != nil {
+		e.Decay = idx.decayFactor(s, id)
+		boost *= e.Decay
+	}
+	if s.boosts != nil {
+		e.Match = idx.matcher(s).factor(id)
+		boost *= e.Match
+	}
+	e.Score *= boost
+	if ds, ok := idx.scorer.(DocumentScorer); ok {
+		e.Unadjusted = e.Score
+		e.Score = ds.ScoreDocument(id, e.Score)
+	}
+	return e
+}
+
+// explainTerm explains what the cursor of a term or proximity clause added to
+// the score of id.
+func (idx *Index) explainTerm(c *termCursor, id int, score float64) TermExplanation {
+	field := c.stats.Field
+	t := TermExplanation{
+		Field:          field,
+		FieldLength:    idx.fieldLength(field, id),
+		AvgFieldLength: idx.avgFieldLength(field),
+		FieldBoost:     idx.FieldBoost(field),
+		Score:          score,
+	}
+
+	if c.near != nil {
+		terms := make([]string, len(c.keys))
+		for i, key := range c.keys {
+			_, terms[i] = SplitKey(key)
+		}
+		t.Term, t.Proximity, t.Slop = strings.Join(terms, " "), true, c.slop
+		t.Windows = c.windows
+		t.IDF = c.weight / t.FieldBoost // of the terms together
+	} else {
+		_, t.Term = SplitKey(c.stats.Term)
+		t.Freq = c.stats.Freq
+		t.DocFreq = c.stats.DocFreq
+		t.IDF = bm25IDF(c.stats.DocFreq, c.stats.DocCount)
+		t.FieldBoost = c.weight // a group's weight, if it has one
+	}
+	return t
+}
+
+// GroupExplanation is what a TermGroup added to a score: the score of each field
+// with its terms, put together as the group says.
+type GroupExplanation struct {
+	Best       bool               `json:"best,omitempty"`
+	TieBreaker float64            `json:"tie_breaker,omitempty"`
+	Fields     []FieldExplanation `json:"fields"`
+	Score      float64            `json:"score"`
+}
+
+type FieldExplanation struct {
+	Field string            `json:"field"`
+	Score float64           `json:"score"`
+	Terms []TermExplanation `json:"terms"`
+}
+
+func (idx *Index) explainGroup(c *termCursor, id int, score float64) GroupExplanation {
+	g := GroupExplanation{Best: c.best, TieBreaker: c.tie, Fields: []FieldExplanation{}, Score: score}
+	for i, field := range c.group {
+		if c.fieldScores[i] == 0 {
+			continue
+		}
+		f := FieldExplanation{Field: c.fields[i], Score: c.fieldScores[i], Terms: []TermExplanation{}}
+		for j, tc := range field {
+			if c.groupScores[i][j] != 0 {
+				f.Terms = append(f.Terms, idx.explainTerm(tc, id, c.groupScores[i][j]))
+			}
+		}
+		g.Fields = append(g.Fields, f)
+	}
+	return g
+}
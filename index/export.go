@@ -0,0 +1,173 @@
+package index
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Exporting the index
+// Postings are written as CSV, one term per row, sorted by field and term:
+//
+//	field,term,df,docs,freqs
+//	text,cat,3,"1,7,42","2,1,1"
+//
+// df is the number of documents containing the term, docs the comma-separated list
+// of their IDs in ascending order and freqs how often the term occurs in each of
+// them. Positions are left out, so an imported index can't answer phrase queries.
+// Rows are written as we go, so only the term list is held in memory, not a copy
+// of the postings.
+var csvHeader = []string{"field", "term", "df", "docs", "freqs"}
+
+// Exports from before fields were indexed have no field column; every term is in
+// the text field.
+var csvHeaderTextOnly = csvHeader[1:]
+
+func (idx *Index) ExportCSV(w io.Writer) error {
+	terms := slices.Clone(idx.Terms())
+	sort.Slice(terms, func(i, j int) bool {
+		fi, ti := SplitKey(terms[i])
+		fj, tj := SplitKey(terms[j])
+		if fi != fj {
+			return fi < fj
+		}
+		return ti < tj
+	})
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, term := range terms {
+		p, _ := idx.lookup(term)
+		ids, freqs := idx.livePostings(p)
+		if len(ids) == 0 {
+			continue
+		}
+
+		field, t := SplitKey(term)
+		record := []string{field, t, strconv.Itoa(len(ids)), joinInts(ids), joinInts(freqs)}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// livePostings is the part of p that belongs to documents that aren't deleted.
+func (idx *Index) livePostings(p *postings) ([]int, []int) {
+	all, allFreqs := p.idsFreqs()
+	if len(idx.deleted) == 0 {
+		return all, allFreqs
+	}
+
+	var ids, freqs []int
+	for i, id := range all {
+		if _, ok := idx.deleted[id]; !ok {
+			ids = append(ids, id)
+			freqs = append(freqs, allFreqs[i])
+		}
+	}
+	return ids, freqs
+}
+
+func joinInts(xs []int) string {
+	var b strings.Builder
+	for i, x := range xs {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(x))
+	}
+	return b.String()
+}
+
+func splitInts(s string) ([]int, error) {
+	fields := strings.Split(s, ",")
+	r := make([]int, len(fields))
+	for i, field := range fields {
+		x, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		r[i] = x
+	}
+	return r, nil
+}
+
+// Reading an export back into an index
+// The export has no stored document lengths, so they are rebuilt as the sum of a
+// document's term frequencies in each field. That's exact unless terms were
+// pruned at index time. Any other field is a keyword field, whose values per
+// document are rebuilt from the postings. The export doesn't record the analyzer
+// either; pass the one it was built with.
+func ImportCSV(r io.Reader, analyzer analysis.Analyzer) (*Index, error) {
+	// Every record has as many columns as the header.
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	textOnly := strings.Join(header, ",") == strings.Join(csvHeaderTextOnly, ",")
+	if !textOnly && strings.Join(header, ",") != strings.Join(csvHeader, ",") {
+		return nil, fmt.Errorf("unexpected csv header %q", header)
+	}
+
+	idx := New(analyzer)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if textOnly {
+			record = append([]string{FieldText}, record...)
+		}
+		if record[0] == "" {
+			return nil, fmt.Errorf("term %q: no field", record[1])
+		}
+
+		df, err := strconv.Atoi(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("term %q: bad df: %w", record[1], err)
+		}
+		ids, err := splitInts(record[3])
+		if err != nil {
+			return nil, fmt.Errorf("term %q: bad doc id: %w", record[1], err)
+		}
+		freqs, err := splitInts(record[4])
+		if err != nil {
+			return nil, fmt.Errorf("term %q: bad freq: %w", record[1], err)
+		}
+
+		if len(ids) != df || len(freqs) != df {
+			return nil, fmt.Errorf("term %q: df is %d but %d ids and %d freqs listed", record[1], df, len(ids), len(freqs))
+		}
+
+		idx.terms[FieldKey(record[0], record[1])] = newPostings(ids, freqs, nil)
+		for i, id := range ids {
+			if IsField(record[0]) {
+				idx.addFieldLength(record[0], id, freqs[i])
+			} else {
+				idx.addKeyword(record[0], record[1], id)
+			}
+			if _, ok := idx.docLen[id]; !ok {
+				idx.docLen[id] = 0
+			}
+		}
+	}
+
+	return idx, nil
+}
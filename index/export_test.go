@@ -0,0 +1,129 @@
+package index
+
+import (
+	"bytes"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExportCSVRoundTrip(t *testing.T) {
+	idx := New(nil)
+	idx.Add([]Document{
+		{ID: 0, Title: "Wild cats", URL: "https://example.com/cats", Text: "a wild cat and another wild cat", Keywords: map[string][]string{"tag": {"animal", "cat"}}},
+		{ID: 1, Title: "Dogs", Text: "a dog chasing a cat", Keywords: map[string][]string{"tag": {"animal"}}},
+		{ID: 2, Text: "the garden, with a dog, in spring"},
+	})
+
+	var out bytes.Buffer
+	if err := idx.ExportCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportCSV(bytes.NewReader(out.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var again bytes.Buffer
+	if err := imported.ExportCSV(&again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != out.String() {
+		t.Errorf("exported again:\n%s\nwant:\n%s", &again, &out)
+	}
+	for term, p := range idx.terms {
+		if got := imported.IDs(term); !slices.Equal(got, p.IDs) {
+			t.Errorf("%q: IDs %v, want %v", term, got, p.IDs)
+		}
+	}
+	for _, query := range []string{"cat", "wild cat", "dog", "garden spring"} {
+		got, want := imported.Search(query), idx.Search(query)
+		if len(got) != len(want) {
+			t.Errorf("%q: %d results, want %d", query, len(got), len(want))
+			continue
+		}
+		for i := range want {
+			if got[i].ID != want[i].ID || math.Abs(got[i].Score-want[i].Score) > 1e-9 {
+				t.Errorf("%q: result %d is %d scoring %v, want %d scoring %v", query, i, got[i].ID, got[i].Score, want[i].ID, want[i].Score)
+			}
+		}
+	}
+	if got, want := imported.Facets(imported.AllIDs(), "tag", 10), idx.Facets(idx.AllIDs(), "tag", 10); !slices.Equal(got, want) {
+		t.Errorf("facets %v, want %v", got, want)
+	}
+}
+
+func TestExportCSVSkipsDeleted(t *testing.T) {
+	// Enough other documents that the deletion leaves a tombstone instead of
+	// compacting the posting lists.
+	docs := []Document{{ID: 0, Title: "Gone", Text: "a deleted cat"}}
+	for id := 1; id <= 20; id++ {
+		docs = append(docs, Document{ID: id, Text: "a wild cat"})
+	}
+	idx := New(nil)
+	idx.Add(docs)
+	if err := idx.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := idx.ExportCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "delet") {
+		t.Errorf("the deleted document's terms are exported:\n%s", &out)
+	}
+	imported, err := ImportCSV(bytes.NewReader(out.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range []string{"cat", "wild cat", "deleted"} {
+		t.Run(query, func(t *testing.T) {
+			got, want := imported.Search(query), idx.Search(query)
+			if len(got) != len(want) {
+				t.Fatalf("%d results, want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i].ID != want[i].ID || math.Abs(got[i].Score-want[i].Score) > 1e-9 {
+					t.Errorf("result %d is %d scoring %v, want %d scoring %v", i, got[i].ID, got[i].Score, want[i].ID, want[i].Score)
+				}
+			}
+		})
+	}
+	t.Run("keywords", func(t *testing.T) {
+		if got, want := imported.Facets(imported.AllIDs(), "tag", 10), idx.Facets(idx.AllIDs(), "tag", 10); !slices.Equal(got, want) {
+			t.Errorf("facets %v, want %v", got, want)
+		}
+	})
+}
+
+func TestImportCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr bool
+		key     string
+		ids     []int
+	}{
+		{"fields", "field,term,df,docs,freqs\ntext,cat,2,\"0,3\",\"1,2\"\ntitle,cat,1,3,1\n", false, FieldKey(FieldTitle, "cat"), []int{3}},
+		{"text only", "term,df,docs,freqs\ncat,2,\"0,3\",\"1,2\"\ndog,1,3,1\n", false, "cat", []int{0, 3}},
+		{"bad header", "word,count\ncat,2\n", true, "", nil},
+		{"no field", "field,term,df,docs,freqs\n,cat,1,0,1\n", true, "", nil},
+		{"bad df", "field,term,df,docs,freqs\ntext,cat,two,0,1\n", true, "", nil},
+		{"df doesn't match", "term,df,docs,freqs\ncat,3,\"0,3\",\"1,2\"\n", true, "", nil},
+		{"bad id", "term,df,docs,freqs\ncat,1,x,1\n", true, "", nil},
+		{"bad freq", "term,df,docs,freqs\ncat,1,0,x\n", true, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx, err := ImportCSV(strings.NewReader(tt.csv), nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+			if err == nil && !slices.Equal(idx.IDs(tt.key), tt.ids) {
+				t.Errorf("%q: IDs %v, want %v", tt.key, idx.IDs(tt.key), tt.ids)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package index
+
+import (
+	"slices"
+	"sort"
+)
+
+// Keyword fields and facets
+// Besides the text fields a document can carry keyword fields like category or
+// language (Document.Keywords). Their values aren't analyzed: each one goes into
+// the dictionary as it is, keyed like any field term (FieldKey("category",
+// "Science")), so FieldIDs filters on it. For counting facets we also keep, per
+// field, the values of every document, which turns counting into one lookup per
+// hit. Keyword fields named like a text field (see Fields) are ignored.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+func (idx *Index) addKeywords(doc Document) {
+	for field, values := range doc.Keywords {
+		if IsField(field) || len(values) == 0 {
+			continue
+		}
+
+		for _, value := range values {
+			idx.addKeyword(field, value, doc.ID)
+		}
+		for _, value := range idx.keywords[field][doc.ID] {
+			idx.addPosting(FieldKey(field, value), doc.ID, []int{0})
+		}
+	}
+}
+
+// addKeyword records one value of a keyword field for document id, keeping them
+// sorted.
+func (idx *Index) addKeyword(field, value string, id int) {
+	byDoc, ok := idx.keywords[field]
+	if !ok {
+		byDoc = make(map[int][]string)
+		idx.keywords[field] = byDoc
+	}
+	values := byDoc[id]
+	if i, found := slices.BinarySearch(values, value); !found {
+		byDoc[id] = slices.Insert(values, i, value)
+	}
+}
+
+func (idx *Index) dropKeywords(id int) {
+	for _, byDoc := range idx.keywords {
+		delete(byDoc, id)
+	}
+}
+
+// KeywordFields lists the keyword fields of the indexed documents, sorted.
+func (idx *Index) KeywordFields() []string {
+	r := make([]string, 0, len(idx.keywords))
+	for field := range idx.keywords {
+		r = append(r, field)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (idx *Index) IsKeywordField(field string) bool {
+	_, ok := idx.keywords[field]
+	return ok
+}
+
+// Facets counts the values of a keyword field over ids, most frequent first and
+// alphabetically among equals. n limits the number of values, 0 means all.
+func (idx *Index) Facets(ids []int, field string, n int) []FacetCount {
+	if len(idx.keywords[field]) == 0 {
+		return nil
+	}
+	return rankFacets(idx.countFacets(ids, []string{field})[field], n)
+}
+
+// FieldFacets is Facets for several fields at once, counted in one pass over ids.
+// A field without values gets an empty list.
+func (idx *Index) FieldFacets(ids []int, fields []string, n int) map[string][]FacetCount {
+	r := make(map[string][]FacetCount, len(fields))
+	for field, counts := range idx.countFacets(ids, fields) {
+		r[field] = rankFacets(counts, n)
+	}
+	return r
+}
+
+// SearchWithFacets returns the documents matching text, by ID, like Search
+// before ranking, with the counts of the values of each of fields over them: the
+// results and the facets of a faceted search page in one pass over the matches.
+func (idx *Index) SearchWithFacets(text string, fields []string) ([]int, map[string]map[string]int) {
+	ids, _ := idx.match(text)
+	return ids, idx.countFacets(ids, fields)
+}
+
+// countFacets counts the values of each of fields over ids, looking every
+// document up once for all of them.
+func (idx *Index) countFacets(ids []int, fields []string) map[string]map[string]int {
+	counts := make(map[string]map[string]int, len(fields))
+	byDoc := make([]map[int][]string, len(fields))
+	for i, field := range fields {
+		counts[field] = make(map[string]int)
+		byDoc[i] = idx.keywords[field]
+	}
+	for _, id := range ids {
+		for i, field := range fields {
+			for _, value := range byDoc[i][id] {
+				counts[field][value]++
+			}
+		}
+	}
+	return counts
+}
+
+// rankFacets sorts counts for Facets and keeps the first n, 0 for all.
+func rankFacets(counts map[string]int, n int) []FacetCount {
+	r := make([]FacetCount, 0, len(counts))
+	for value, count := range counts {
+		r = append(r, FacetCount{value, count})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Count != r[j].Count {
+			return r[i].Count > r[j].Count
+		}
+		return r[i].Value < r[j].Value
+	})
+
+	if n > 0 && len(r) > n {
+		r = r[:n]
+	}
+	return r
+}
@@ -0,0 +1,56 @@
+package index
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestSearchWithFacets(t *testing.T) {
+	idx := New(nil)
+	idx.Add([]Document{
+		{ID: 0, Text: "a red car", Keywords: map[string][]string{"color": {"red"}, "kind": {"car"}}},
+		{ID: 1, Text: "a red bicycle", Keywords: map[string][]string{"color": {"red"}, "kind": {"bicycle"}}},
+		{ID: 2, Text: "a blue car", Keywords: map[string][]string{"color": {"blue"}, "kind": {"car", "toy"}}},
+		{ID: 3, Text: "a green car"},
+	})
+	tests := []struct {
+		query  string
+		fields []string
+	}{
+		{"car", []string{"color", "kind"}},
+		{"red", []string{"kind"}},
+		{"bicycle", []string{"color", "kind", "size"}},
+		{"boat", []string{"color"}},
+		{"car", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			ids, facets := idx.SearchWithFacets(tt.query, tt.fields)
+			var want []int
+			for _, r := range idx.Search(tt.query) {
+				want = append(want, r.ID)
+			}
+			slices.Sort(want)
+			if !slices.Equal(ids, want) {
+				t.Errorf("results %v, want %v", ids, want)
+			}
+			if len(facets) != len(tt.fields) {
+				t.Errorf("facets for %d fields, want %d", len(facets), len(tt.fields))
+			}
+			all := idx.FieldFacets(ids, tt.fields, 0)
+			for _, field := range tt.fields {
+				counts := make(map[string]int)
+				for _, f := range idx.Facets(ids, field, 0) {
+					counts[f.Value] = f.Count
+				}
+				if !maps.Equal(facets[field], counts) {
+					t.Errorf("%s: %v, want what Facets counts, %v", field, facets[field], counts)
+				}
+				if got := all[field]; len(got) != len(counts) {
+					t.Errorf("%s: FieldFacets %v, want the %d values Facets counts", field, got, len(counts))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Fields
+// Title, URL and abstract are indexed separately. The abstract is the main field
+// and its terms go into the dictionary as they are; the terms of the other fields
+// are keyed as field + "\x00" + term (see FieldKey). That keeps one dictionary, and
+// lookups, phrases and wildcards work on any field just by qualifying the term.
+// Every field has its own lengths for BM25 and its own boost, so a title match
+// counts for more than the same word somewhere in the abstract.
+const (
+	FieldText  = "text"
+	FieldTitle = "title"
+	FieldURL   = "url"
+)
+
+// Fields lists the indexed fields.
+var Fields = []string{FieldText, FieldTitle, FieldURL}
+
+// DefaultFields are searched by terms that don't name a field. The URL is left
+// out: nearly every URL contains "wikipedia".
+var DefaultFields = []string{FieldText, FieldTitle}
+
+var defaultFieldBoosts = map[string]float64{FieldTitle: 2.0}
+
+const fieldSep = "\x00"
+
+// IsField reports whether name is an indexed field, nested ones included (see
+// NestedField).
+func IsField(name string) bool {
+	for _, f := range Fields {
+		if f == name {
+			return true
+		}
+	}
+	if name == FieldAll {
+		return true
+	}
+	_, _, nested := SplitNestedField(name)
+	return nested
+}
+
+// FieldKey is the dictionary key of an analyzed term in field.
+func FieldKey(field, term string) string {
+	if field == FieldText {
+		return term
+	}
+	return field + fieldSep + term
+}
+
+// SplitKey is the inverse of FieldKey.
+func SplitKey(key string) (field, term string) {
+	if i := strings.Index(key, fieldSep); i >= 0 {
+		return key[:i], key[i+len(fieldSep):]
+	}
+	return FieldText, key
+}
+
+func isDefaultField(field string) bool {
+	for _, f := range DefaultFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// searchFields resolves the field of a query; "" means the default fields.
+func searchFields(field string) []string {
+	if field == "" {
+		return DefaultFields
+	}
+	return []string{field}
+}
+
+func documentField(doc Document, field string) string {
+	switch field {
+	case FieldTitle:
+		return doc.Title
+	case FieldURL:
+		return doc.URL
+	}
+	return doc.Text
+}
+
+// FieldAnalyzer is the analyzer for field; it differs from Analyzer only when
+// that is an analysis.PerField. A nested field is analyzed like its BaseField.
+func (idx *Index) FieldAnalyzer(field string) analysis.Analyzer {
+	return analysis.ForField(idx.analyzer, BaseField(field))
+}
+
+// FieldBoost is the factor a field's BM25 score is multiplied with.
+func (idx *Index) FieldBoost(field string) float64 {
+	if boost, ok := idx.fieldBoost[field]; ok {
+		return boost
+	}
+	if boost, ok := defaultFieldBoosts[field]; ok {
+		return boost
+	}
+	return 1
+}
+
+func (idx *Index) SetFieldBoost(field string, boost float64) {
+	idx.fieldBoost[field] = boost
+}
+
+// FieldTerms is the dictionary keys an analyzed term stands for in field, one
+// per default field if field is "".
+func (idx *Index) FieldTerms(field, term string) []string {
+	fields := searchFields(field)
+	r := make([]string, len(fields))
+	for i, f := range fields {
+		r[i] = FieldKey(f, term)
+	}
+	return r
+}
+
+// FieldIDs is the posting list of an analyzed term in field, or the union over
+// the default fields if field is "".
+func (idx *Index) FieldIDs(field, term string) []int {
+	if field != "" {
+		return idx.IDs(FieldKey(field, term))
+	}
+
+	var r []int
+	for _, key := range idx.FieldTerms(field, term) {
+		r = Union(r, idx.IDs(key))
+	}
+	return r
+}
+
+// fieldLength is the analyzed length of field in document id, and avgFieldLength
+// its average over the live documents.
+func (idx *Index) fieldLength(field string, id int) int {
+	if field == FieldText {
+		return idx.docLen[id]
+	}
+	return idx.fieldLen[field][id]
+}
+
+func (idx *Index) avgFieldLength(field string) float64 {
+	total := idx.fieldTotalLength(field)
+	if total == 0 || len(idx.docLen) == 0 {
+		return 1
+	}
+	return float64(total) / float64(len(idx.docLen))
+}
+
+func (idx *Index) fieldTotalLength(field string) int {
+	if field == FieldText {
+		return idx.totalLen
+	}
+	return idx.fieldTotal[field]
+}
+
+func (idx *Index) addFieldLength(field string, id, n int) {
+	if field == FieldText {
+		idx.docLen[id] += n
+		idx.totalLen += n
+		return
+	}
+
+	lens, ok := idx.fieldLen[field]
+	if !ok {
+		lens = make(map[int]int)
+		idx.fieldLen[field] = lens
+	}
+	if n > 0 {
+		lens[id] += n
+		idx.fieldTotal[field] += n
+	}
+}
+
+// forget drops the lengths, boost, keywords, numbers and points of document id,
+// reporting whether it was indexed.
+func (idx *Index) forget(id int) bool {
+	n, ok := idx.docLen[id]
+	if !ok {
+		return false
+	}
+
+	idx.totalLen -= n
+	delete(idx.docLen, id)
+	delete(idx.boost, id)
+	delete(idx.titles, id)
+	delete(idx.offsets, id)
+	for field, lens := range idx.fieldLen {
+		idx.fieldTotal[field] -= lens[id]
+		delete(lens, id)
+	}
+	idx.dropKeywords(id)
+	idx.dropNumbers(id)
+	idx.dropGeo(id)
+	idx.dropVectors(id)
+	idx.dropColumns()
+	idx.dropFilters()
+	return true
+}
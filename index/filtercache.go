@@ -0,0 +1,159 @@
+package index
+
+import (
+	"container/list"
+	"math/bits"
+)
+
+// Filter cache
+// The same few constraints, language:en, a category, a range of years, come
+// with query after query, and every time they're worked out again from the
+// posting lists or the numeric columns. Since a filter doesn't score, its
+// documents are all there is to it: CachedFilter works them out once, as a
+// Bitset with a bit per document ID, and hands out the same set again until the
+// index changes, which drops every cached filter like it drops the sort columns.
+// Intersecting with a Bitset costs a lookup per candidate, however many
+// documents the filter matches. The FilterCacheSize filters used last are kept.
+type Bitset struct {
+	words []uint64
+	count int
+}
+
+const FilterCacheSize = 256
+
+type FilterCacheStats struct {
+	Size   int `json:"size"`
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+type filterCache struct {
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+	gen     int // of the index, counting the drops
+	hits    int
+	misses  int
+}
+
+type filterEntry struct {
+	key  string
+	bits *Bitset
+}
+
+func NewBitset(ids []int) *Bitset {
+	n := 0
+	for _, id := range ids {
+		n = max(n, id+1)
+	}
+	b := &Bitset{words: make([]uint64, (n+63)/64)}
+	for _, id := range ids {
+		if id < 0 {
+			continue
+		}
+		if b.words[id/64]&(1<<(id%64)) == 0 {
+			b.words[id/64] |= 1 << (id % 64)
+			b.count++
+		}
+	}
+	return b
+}
+
+func (b *Bitset) Has(id int) bool {
+	return id >= 0 && id/64 < len(b.words) && b.words[id/64]&(1<<(id%64)) != 0
+}
+
+// Len is the number of IDs in b.
+func (b *Bitset) Len() int {
+	return b.count
+}
+
+// IDs returns the IDs in b in ascending order.
+func (b *Bitset) IDs() []int {
+	r := make([]int, 0, b.count)
+	for i, w := range b.words {
+		for w != 0 {
+			r = append(r, i*64+bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+	return r
+}
+
+// Filter returns the IDs of ids that are in b, in the same order.
+func (b *Bitset) Filter(ids []int) []int {
+	r := make([]int, 0, min(len(ids), b.count))
+	for _, id := range ids {
+		if b.Has(id) {
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// CachedFilter returns the documents of the filter key, building them with build
+// if they aren't cached. An error from build, like a search that was cancelled,
+// is returned and nothing is cached.
+func (idx *Index) CachedFilter(key string, build func() ([]int, error)) (*Bitset, error) {
+	idx.filtersMu.Lock()
+	c := idx.cachedFilters()
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		c.hits++
+		idx.filtersMu.Unlock()
+		return e.Value.(*filterEntry).bits, nil
+	}
+	c.misses++
+	gen := c.gen
+	idx.filtersMu.Unlock()
+
+	// Built unlocked; two searches missing the same filter at once both build it.
+	ids, err := build()
+	if err != nil {
+		return nil, err
+	}
+	b := NewBitset(ids)
+
+	idx.filtersMu.Lock()
+	defer idx.filtersMu.Unlock()
+	if c.gen != gen {
+		// The index changed while building, so b may be out of date.
+		return b, nil
+	}
+	if e, ok := c.entries[key]; ok {
+		c.order.MoveToFront(e)
+		return b, nil
+	}
+	c.entries[key] = c.order.PushFront(&filterEntry{key, b})
+	if c.order.Len() > FilterCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*filterEntry).key)
+	}
+	return b, nil
+}
+
+func (idx *Index) FilterCacheStats() FilterCacheStats {
+	idx.filtersMu.Lock()
+	defer idx.filtersMu.Unlock()
+	c := idx.cachedFilters()
+	return FilterCacheStats{Size: c.order.Len(), Hits: c.hits, Misses: c.misses}
+}
+
+// cachedFilters returns the cache, creating it if need be. The caller must hold
+// filtersMu.
+func (idx *Index) cachedFilters() *filterCache {
+	if idx.filters == nil {
+		idx.filters = &filterCache{order: list.New(), entries: make(map[string]*list.Element)}
+	}
+	return idx.filters
+}
+
+func (idx *Index) dropFilters() {
+	idx.filtersMu.Lock()
+	defer idx.filtersMu.Unlock()
+	if c := idx.filters; c != nil {
+		c.order.Init()
+		clear(c.entries)
+		c.gen++
+	}
+}
@@ -0,0 +1,176 @@
+package index
+
+import (
+	"sort"
+	"unicode/utf8"
+)
+
+// Fuzzy matching
+// Typos like "catpuma" should still find "catopuma". Candidates come from a bigram
+// index over the term dictionary: two strings within k edits share at least
+// len+1-2k of their padded bigrams, so only terms passing that count are checked
+// with a real (bounded) Levenshtein distance.
+const maxFuzzyEdits = 2
+
+// FuzzyTerms returns the terms within maxEdits edits of term, closest first.
+// term is analyzed first, the way a query term would be. maxEdits is capped at 2;
+// beyond that almost everything matches short words.
+func (idx *Index) FuzzyTerms(term string, maxEdits int) []string {
+	return idx.FuzzyFieldTerms(FieldText, term, maxEdits)
+}
+
+// FuzzyFieldTerms is FuzzyTerms for the keys of field, or of each default field
+// if field is "".
+func (idx *Index) FuzzyFieldTerms(field, term string, maxEdits int) []string {
+	var r []string
+	for _, f := range searchFields(field) {
+		r = append(r, idx.fuzzyTerms(f, term, maxEdits)...)
+	}
+	return r
+}
+
+func (idx *Index) fuzzyTerms(field, term string, maxEdits int) []string {
+	var r []string
+	for _, ts := range idx.fuzzyByDistance(field, term, maxEdits) {
+		sort.Strings(ts)
+		r = append(r, ts...)
+	}
+	return r
+}
+
+// fuzzyByDistance returns the keys of field within maxEdits of the analyzed term,
+// those d edits away in the d-th slice. Keys of one field share their prefix, so
+// the distance between two keys is the distance between their terms.
+func (idx *Index) fuzzyByDistance(field, term string, maxEdits int) [][]string {
+	maxEdits = min(max(maxEdits, 0), maxFuzzyEdits)
+	if tokens := idx.FieldAnalyzer(field).Analyze(term); len(tokens) > 0 {
+		term = tokens[0]
+	}
+	term = FieldKey(field, term)
+
+	terms, grams := idx.bigramIndex()
+	qgrams := bigrams(term)
+	need := len(qgrams) - 2*maxEdits
+
+	var candidates []int
+	if need <= 0 {
+		candidates = make([]int, len(terms))
+		for i := range terms {
+			candidates[i] = i
+		}
+	} else {
+		counts := make(map[int]int)
+		for _, g := range qgrams {
+			for _, i := range grams[g] {
+				counts[i]++
+			}
+		}
+		for i, n := range counts {
+			if n >= need {
+				candidates = append(candidates, i)
+			}
+		}
+	}
+
+	byDist := make([][]string, maxEdits+1)
+	n := utf8.RuneCountInString(term)
+	for _, i := range candidates {
+		t := terms[i]
+		if f, _ := SplitKey(t); f != field {
+			continue
+		}
+		if d := utf8.RuneCountInString(t) - n; d > maxEdits || -d > maxEdits {
+			continue
+		}
+		if d, ok := levenshtein(term, t, maxEdits); ok {
+			byDist[d] = append(byDist[d], t)
+		}
+	}
+	return byDist
+}
+
+// SearchFuzzy finds the documents containing any term within maxEdits of term in
+// one of the default fields.
+func (idx *Index) SearchFuzzy(term string, maxEdits int) []Result {
+	terms := idx.FuzzyFieldTerms("", term, maxEdits)
+
+	var ids []int
+	for _, t := range terms {
+		ids = Union(ids, idx.IDs(t))
+	}
+	return idx.Rank(ids, terms)
+}
+
+// bigramIndex maps each padded bigram to the positions in Terms() of the terms
+// containing it. Like the sorted dictionary it's rebuilt after the vocabulary
+// changes.
+func (idx *Index) bigramIndex() ([]string, map[string][]int) {
+	idx.termsMu.Lock()
+	defer idx.termsMu.Unlock()
+
+	terms := idx.termsLocked()
+	if idx.gramTerms == nil || idx.gramGen != idx.termsGen {
+		idx.gramTerms = make(map[string][]int)
+		for i, t := range terms {
+			for _, g := range uniqueBigrams(t) {
+				idx.gramTerms[g] = append(idx.gramTerms[g], i)
+			}
+		}
+		idx.gramGen = idx.termsGen
+	}
+	return terms, idx.gramTerms
+}
+
+// Bigrams of "^term$", so the first and last letters count as much as the rest.
+func bigrams(s string) []string {
+	rs := []rune("^" + s + "$")
+	r := make([]string, 0, len(rs)-1)
+	for i := 0; i+1 < len(rs); i++ {
+		r = append(r, string(rs[i:i+2]))
+	}
+	return r
+}
+
+func uniqueBigrams(s string) []string {
+	seen := make(map[string]struct{})
+	var r []string
+	for _, g := range bigrams(s) {
+		if _, ok := seen[g]; !ok {
+			seen[g] = struct{}{}
+			r = append(r, g)
+		}
+	}
+	return r
+}
+
+// levenshtein returns the edit distance between a and b if it is at most k.
+// Rows stop being computed as soon as every cell exceeds k.
+func levenshtein(a, b string, k int) (int, bool) {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			best = min(best, cur[j])
+		}
+		if best > k {
+			return 0, false
+		}
+		prev, cur = cur, prev
+	}
+
+	d := prev[len(rb)]
+	return d, d <= k
+}
@@ -0,0 +1,258 @@
+package index
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Geo points
+// A document can have places (Document.Geo), a latitude and longitude in degrees
+// per geo field, for queries like "cafes within 2 km of here" and for sorting
+// the hits nearest first. Like numbers they stay out of the term dictionary: we
+// keep each field's points by document and, built lazily after the field
+// changed, all of them sorted by cell, the two coordinates' bits interleaved
+// the way a geohash does. A cell of a coarser grid is then a run of that order,
+// so GeoDistanceIDs picks the finest grid whose cells, a few of them, cover the
+// circle, looks up the runs of those cells with binary searches and checks every
+// point in them for its great-circle distance. A document has at most one point
+// per field. Like ranges, geo filters don't score.
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// The mean radius of the Earth, in meters.
+const earthRadius = 6371008.8
+
+// Bits of each coordinate in a cell, the finest grid being about 60 cm.
+const geoBits = 26
+
+type geoEntry struct {
+	cell  uint64
+	point GeoPoint
+	id    int
+}
+
+func (p GeoPoint) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// ParseGeoPoint reads a point written as "lat,lon" or as a JSON object with lat
+// and lon.
+func ParseGeoPoint(s string) (GeoPoint, bool) {
+	s = strings.TrimSpace(s)
+	var p GeoPoint
+	if strings.HasPrefix(s, "{") {
+		if err := json.Unmarshal([]byte(s), &p); err != nil {
+			return GeoPoint{}, false
+		}
+		return p, p.Valid()
+	}
+	lat, lon, ok := strings.Cut(s, ",")
+	if !ok {
+		return GeoPoint{}, false
+	}
+	var err1, err2 error
+	p.Lat, err1 = strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	p.Lon, err2 = strconv.ParseFloat(strings.TrimSpace(lon), 64)
+	return p, err1 == nil && err2 == nil && p.Valid()
+}
+
+// Distance returns the great-circle distance between a and b in meters.
+func Distance(a, b GeoPoint) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat, dLon := lat2-lat1, (b.Lon-a.Lon)*math.Pi/180
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+var distanceUnits = []struct {
+	suffix string
+	meters float64
+}{{"km", 1000}, {"mi", 1609.344}, {"m", 1}}
+
+// ParseDistance reads a distance like 500m, 2.5km or 3mi into meters. A bare
+// number is meters.
+func ParseDistance(s string) (float64, bool) {
+	scale := 1.0
+	for _, u := range distanceUnits {
+		if v, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, scale = v, u.meters
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, false
+	}
+	return v * scale, true
+}
+
+func (idx *Index) addGeo(doc Document) {
+	for field, p := range doc.Geo {
+		if IsField(field) || !p.Valid() {
+			continue
+		}
+		idx.addGeoPoint(field, p, doc.ID)
+	}
+}
+
+func (idx *Index) addGeoPoint(field string, p GeoPoint, id int) {
+	byDoc, ok := idx.geo[field]
+	if !ok {
+		byDoc = make(map[int]GeoPoint)
+		idx.geo[field] = byDoc
+	}
+	byDoc[id] = p
+
+	idx.numbersMu.Lock()
+	delete(idx.sortedGeo, field)
+	idx.numbersMu.Unlock()
+}
+
+func (idx *Index) dropGeo(id int) {
+	idx.numbersMu.Lock()
+	defer idx.numbersMu.Unlock()
+
+	for field, byDoc := range idx.geo {
+		if _, ok := byDoc[id]; ok {
+			delete(byDoc, id)
+			delete(idx.sortedGeo, field)
+		}
+	}
+}
+
+// GeoFields lists the geo fields of the indexed documents, sorted.
+func (idx *Index) GeoFields() []string {
+	r := make([]string, 0, len(idx.geo))
+	for field := range idx.geo {
+		r = append(r, field)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (idx *Index) IsGeoField(field string) bool {
+	_, ok := idx.geo[field]
+	return ok
+}
+
+// GeoPoint returns the point of a geo field for document id.
+func (idx *Index) GeoPoint(field string, id int) (GeoPoint, bool) {
+	p, ok := idx.geo[field][id]
+	return p, ok
+}
+
+// GeoDistanceIDs returns the living documents whose point in field is at most
+// meters away from center, in ascending order.
+func (idx *Index) GeoDistanceIDs(field string, center GeoPoint, meters float64) []int {
+	entries := idx.sortedGeoField(field)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// The box around the circle, in degrees, and the longitudes all around if
+	// it reaches a pole.
+	angle := meters / earthRadius
+	dLat := angle * 180 / math.Pi
+	dLon := 360.0
+	if s := math.Sin(angle); angle < math.Pi/2 && s < math.Cos(center.Lat*math.Pi/180) {
+		dLon = math.Asin(s/math.Cos(center.Lat*math.Pi/180)) * 180 / math.Pi
+	}
+	minLat, maxLat := math.Max(center.Lat-dLat, -90), math.Min(center.Lat+dLat, 90)
+
+	// The finest grid that covers the box with at most 16 cells.
+	bits := geoBits
+	var lats, lons int
+	for ; ; bits-- {
+		lats = geoIndex(maxLat, 90, bits) - geoIndex(minLat, 90, bits) + 1
+		lons = min(int((2*dLon)/360*float64(uint64(1)<<bits))+2, 1<<bits)
+		if lats*lons <= 16 || bits == 0 {
+			break
+		}
+	}
+	shift := 2 * (geoBits - bits)
+	lat0 := geoIndex(minLat, 90, bits)
+	lon0 := geoIndex(center.Lon-dLon, 180, bits)
+	if dLon >= 180 {
+		lon0 = 0
+	}
+
+	var ids []int
+	for i := 0; i < lats; i++ {
+		for j := 0; j < lons; j++ {
+			lon := (lon0 + j) & (1<<bits - 1)
+			cell := interleave(uint64(lon), uint64(lat0+i)) << shift
+			lo := sort.Search(len(entries), func(k int) bool { return entries[k].cell >= cell })
+			hi := sort.Search(len(entries), func(k int) bool { return entries[k].cell >= cell+1<<shift })
+			for _, e := range entries[lo:hi] {
+				if Distance(center, e.point) <= meters {
+					ids = append(ids, e.id)
+				}
+			}
+		}
+	}
+	sort.Ints(ids)
+	return idx.live(ids)
+}
+
+// geoIndex numbers the cells of one coordinate, ranging from -limit to limit,
+// on a grid of 2^bits cells. Longitudes beyond ±180 wrap around.
+func geoIndex(v, limit float64, bits int) int {
+	n := 1 << bits
+	i := int(math.Floor((v + limit) / (2 * limit) * float64(n)))
+	if limit == 180 {
+		return ((i % n) + n) % n
+	}
+	return min(max(i, 0), n-1)
+}
+
+// geoCell is the cell of p on the finest grid.
+func geoCell(p GeoPoint) uint64 {
+	return interleave(uint64(geoIndex(p.Lon, 180, geoBits)), uint64(geoIndex(p.Lat, 90, geoBits)))
+}
+
+// interleave puts the bits of lon and lat in turns, lon first.
+func interleave(lon, lat uint64) uint64 {
+	return spread(lon)<<1 | spread(lat)
+}
+
+func spread(v uint64) uint64 {
+	v &= 0xffffffff
+	v = (v | v<<16) & 0x0000ffff0000ffff
+	v = (v | v<<8) & 0x00ff00ff00ff00ff
+	v = (v | v<<4) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+func (idx *Index) sortedGeoField(field string) []geoEntry {
+	idx.numbersMu.Lock()
+	defer idx.numbersMu.Unlock()
+
+	if entries, ok := idx.sortedGeo[field]; ok {
+		return entries
+	}
+
+	byDoc := idx.geo[field]
+	entries := make([]geoEntry, 0, len(byDoc))
+	for id, p := range byDoc {
+		entries = append(entries, geoEntry{geoCell(p), p, id})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].cell != entries[j].cell {
+			return entries[i].cell < entries[j].cell
+		}
+		return entries[i].id < entries[j].id
+	})
+
+	if idx.sortedGeo == nil {
+		idx.sortedGeo = make(map[string][]geoEntry)
+	}
+	idx.sortedGeo[field] = entries
+	return entries
+}
@@ -0,0 +1,77 @@
+package index
+
+// Term groups
+// A TermGroup scores a query over several fields as a whole, for multi-match
+// queries (search.MultiMatchQuery): Keys[i] are its dictionary keys in Fields[i],
+// whose scores add up to that field's, weighted by Weights[i] instead of the
+// field's boost unless that's 0. With Best a document gets the score of its best
+// field plus TieBreaker times those of the others, the way Elasticsearch's
+// best_fields does, so a title with both words beats a text that has them too,
+// without it counting twice; otherwise the fields add up (most_fields), for a
+// document that has the words everywhere.
+type TermGroup struct {
+	Fields     []string
+	Keys       [][]string
+	Weights    []float64
+	Best       bool
+	TieBreaker float64
+}
+
+// groupCursor returns a cursor for g, nil if none of its keys are in the index.
+func (idx *Index) groupCursor(g TermGroup, scorer Scorer, st collectionStats) *termCursor {
+	c := &termCursor{best: g.Best, tie: g.TieBreaker}
+	bounds := make([]float64, len(g.Keys))
+	found := false
+	for i, keys := range g.Keys {
+		weight := 0.0
+		if i < len(g.Weights) {
+			weight = g.Weights[i]
+		}
+		var field []*termCursor
+		seen := make(map[string]struct{}, len(keys))
+		for _, key := range keys {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			if tc := idx.termCursor(key, weight, scorer, st); tc != nil {
+				field = append(field, tc)
+				bounds[i] += tc.bound
+			}
+		}
+		found = found || len(field) > 0
+		c.group = append(c.group, field)
+		c.groupScores = append(c.groupScores, make([]float64, len(field)))
+	}
+	c.fieldScores = make([]float64, len(g.Keys))
+	if !found {
+		return nil
+	}
+	c.fields = g.Fields
+	c.bound = c.combine(bounds)
+	return c
+}
+
+func (c *termCursor) scoreGroup(idx *Index, id int) float64 {
+	for i, field := range c.group {
+		c.fieldScores[i] = 0
+		for j, tc := range field {
+			c.groupScores[i][j] = tc.score(idx, id)
+			c.fieldScores[i] += c.groupScores[i][j]
+		}
+	}
+	return c.combine(c.fieldScores)
+}
+
+// combine puts the scores of the fields of a group together.
+func (c *termCursor) combine(fields []float64) float64 {
+	sum, best := 0.0, 0.0
+	for _, s := range fields {
+		sum += s
+		best = max(best, s)
+	}
+	if !c.best {
+		return sum
+	}
+	return best + c.tie*(sum-best)
+}
@@ -0,0 +1,317 @@
+package index
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// HNSW
+// Comparing a query vector with every document's is exact but takes a pass over
+// all of them. A hierarchical navigable small world graph (Malkov and Yashunin)
+// links every vector to a few of its nearest ones, on level 0 for all of them and
+// on each level above for a random fraction of those below, a skip list of
+// graphs. A search walks greedily from the top towards the query and then looks
+// at the best ef candidates on level 0, which finds nearly all of the nearest
+// neighbours in a small part of the comparisons. The distance is 1 minus the
+// cosine similarity; vectors are normalized when they're indexed, so that's a
+// dot product.
+//
+// The graph of a field is built when an approximate search first needs it and
+// then kept up to date as vectors are added. A vector whose document is deleted or
+// replaced stays in it to route through and is left out of the results; when
+// those are half of it, the graph is built again.
+const (
+	hnswM              = 16 // links of a node on the levels above 0, twice as many on 0
+	hnswEfConstruction = 100
+)
+
+type hnsw struct {
+	ids      []int       // document of each node
+	vecs     [][]float32 // vector of each node
+	links    [][][]int32 // of each node, by level
+	dead     []bool      // nodes whose document is gone or has another vector
+	removed  int
+	nodeOf   map[int]int32
+	entry    int32
+	maxLevel int
+	rng      *rand.Rand
+}
+
+type hnswCandidate struct {
+	node int32
+	dist float32
+}
+
+func newHNSW() *hnsw {
+	return &hnsw{nodeOf: make(map[int]int32), entry: -1, rng: rand.New(rand.NewSource(1))}
+}
+
+func dot(a, b []float32) float32 {
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+func (g *hnsw) dist(q []float32, node int32) float32 {
+	return 1 - dot(q, g.vecs[node])
+}
+
+func maxLinks(level int) int {
+	if level == 0 {
+		return 2 * hnswM
+	}
+	return hnswM
+}
+
+func (g *hnsw) live() int {
+	return len(g.ids) - g.removed
+}
+
+// remove marks the node of document id dead.
+func (g *hnsw) remove(id int) {
+	if n, ok := g.nodeOf[id]; ok {
+		g.dead[n] = true
+		g.removed++
+		delete(g.nodeOf, id)
+	}
+}
+
+func (g *hnsw) insert(id int, v []float32) {
+	g.remove(id)
+	n := int32(len(g.ids))
+	level := int(-math.Log(1-g.rng.Float64()) / math.Log(hnswM))
+	g.ids = append(g.ids, id)
+	g.vecs = append(g.vecs, v)
+	g.links = append(g.links, make([][]int32, level+1))
+	g.dead = append(g.dead, false)
+	g.nodeOf[id] = n
+	if g.entry < 0 {
+		g.entry, g.maxLevel = n, level
+		return
+	}
+
+	ep := g.entry
+	for l := g.maxLevel; l > level; l-- {
+		ep = g.greedy(v, ep, l)
+	}
+	eps := []int32{ep}
+	for l := min(level, g.maxLevel); l >= 0; l-- {
+		candidates := g.searchLayer(v, eps, hnswEfConstruction, l)
+		neighbours := g.selectNeighbours(candidates, maxLinks(l))
+		g.links[n][l] = neighbours
+		for _, m := range neighbours {
+			// Pruning picks the links again, so it waits for a few extra.
+			g.links[m][l] = append(g.links[m][l], n)
+			if len(g.links[m][l]) > maxLinks(l)*3/2 {
+				g.prune(m, l)
+			}
+		}
+		eps = eps[:0]
+		for _, c := range candidates {
+			eps = append(eps, c.node)
+		}
+	}
+	if level > g.maxLevel {
+		g.entry, g.maxLevel = n, level
+	}
+}
+
+// prune cuts the links of node on level back to the most it may have.
+func (g *hnsw) prune(node int32, level int) {
+	links := g.links[node][level]
+	candidates := make([]hnswCandidate, len(links))
+	for i, m := range links {
+		candidates[i] = hnswCandidate{m, g.dist(g.vecs[node], m)}
+	}
+	slices.SortFunc(candidates, compareCandidates)
+	g.links[node][level] = g.selectNeighbours(candidates, maxLinks(level))
+}
+
+func compareCandidates(a, b hnswCandidate) int {
+	switch {
+	case a.dist < b.dist:
+		return -1
+	case a.dist > b.dist:
+		return 1
+	}
+	return int(a.node - b.node)
+}
+
+// selectNeighbours picks up to m of candidates, nearest first, skipping those
+// nearer to one picked already than to the node, so the links go in different
+// directions instead of into one cluster; the skipped ones fill up what's left.
+func (g *hnsw) selectNeighbours(candidates []hnswCandidate, m int) []int32 {
+	r := make([]int32, 0, m)
+	var skipped []int32
+	for _, c := range candidates {
+		if len(r) == m {
+			break
+		}
+		diverse := true
+		for _, s := range r {
+			if g.dist(g.vecs[c.node], s) < c.dist {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			r = append(r, c.node)
+		} else {
+			skipped = append(skipped, c.node)
+		}
+	}
+	for _, s := range skipped {
+		if len(r) == m {
+			break
+		}
+		r = append(r, s)
+	}
+	return r
+}
+
+// greedy walks from ep to the node nearest to q on level.
+func (g *hnsw) greedy(q []float32, ep int32, level int) int32 {
+	best := g.dist(q, ep)
+	for moved := true; moved; {
+		moved = false
+		for _, m := range g.links[ep][level] {
+			if d := g.dist(q, m); d < best {
+				ep, best, moved = m, d, true
+			}
+		}
+	}
+	return ep
+}
+
+// searchLayer returns the ef nodes nearest to q it finds on level from eps,
+// nearest first.
+func (g *hnsw) searchLayer(q []float32, eps []int32, ef, level int) []hnswCandidate {
+	visited := make([]uint64, (len(g.ids)+63)/64)
+	near := candidateHeap{less: func(a, b float32) bool { return a < b }}
+	far := candidateHeap{less: func(a, b float32) bool { return a > b }}
+	for _, e := range eps {
+		visited[e/64] |= 1 << (e % 64)
+		c := hnswCandidate{e, g.dist(q, e)}
+		near.push(c)
+		far.push(c)
+	}
+	for len(near.c) > 0 {
+		c := near.pop()
+		if len(far.c) >= ef && c.dist > far.c[0].dist {
+			break
+		}
+		for _, m := range g.links[c.node][level] {
+			if visited[m/64]&(1<<(m%64)) != 0 {
+				continue
+			}
+			visited[m/64] |= 1 << (m % 64)
+			d := g.dist(q, m)
+			if len(far.c) < ef || d < far.c[0].dist {
+				near.push(hnswCandidate{m, d})
+				far.push(hnswCandidate{m, d})
+				if len(far.c) > ef {
+					far.pop()
+				}
+			}
+		}
+	}
+	r := make([]hnswCandidate, len(far.c))
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i] = far.pop()
+	}
+	return r
+}
+
+// search returns the nodes nearest to q among the ef it looks at, nearest first,
+// leaving out the dead ones and those accept turns down.
+func (g *hnsw) search(q []float32, ef int, accept func(id int) bool) []hnswCandidate {
+	if g.entry < 0 {
+		return nil
+	}
+	ep := g.entry
+	for l := g.maxLevel; l > 0; l-- {
+		ep = g.greedy(q, ep, l)
+	}
+	candidates := g.searchLayer(q, []int32{ep}, ef, 0)
+	r := candidates[:0]
+	for _, c := range candidates {
+		if !g.dead[c.node] && (accept == nil || accept(g.ids[c.node])) {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// clone copies g so inserting into it leaves g alone; the vectors are never
+// changed, so they're shared.
+func (g *hnsw) clone() *hnsw {
+	c := *g
+	c.ids = slices.Clone(g.ids)
+	c.vecs = slices.Clone(g.vecs)
+	c.dead = slices.Clone(g.dead)
+	c.nodeOf = make(map[int]int32, len(g.nodeOf))
+	for id, n := range g.nodeOf {
+		c.nodeOf[id] = n
+	}
+	c.links = make([][][]int32, len(g.links))
+	for i, levels := range g.links {
+		c.links[i] = make([][]int32, len(levels))
+		for l, links := range levels {
+			c.links[i][l] = slices.Clone(links)
+		}
+	}
+	c.rng = rand.New(rand.NewSource(int64(len(g.ids))))
+	return &c
+}
+
+// candidateHeap has the candidate on top that less puts first, the nearest or the
+// farthest. It's a heap without container/heap, which would allocate for every
+// candidate pushed.
+type candidateHeap struct {
+	c    []hnswCandidate
+	less func(a, b float32) bool
+}
+
+func (h *candidateHeap) push(x hnswCandidate) {
+	h.c = append(h.c, x)
+	for i := len(h.c) - 1; i > 0; {
+		parent := (i - 1) / 2
+		if !h.less(h.c[i].dist, h.c[parent].dist) {
+			break
+		}
+		h.c[i], h.c[parent] = h.c[parent], h.c[i]
+		i = parent
+	}
+}
+
+func (h *candidateHeap) pop() hnswCandidate {
+	top := h.c[0]
+	last := len(h.c) - 1
+	h.c[0] = h.c[last]
+	h.c = h.c[:last]
+	for i := 0; ; {
+		first, l, r := i, 2*i+1, 2*i+2
+		if l < last && h.less(h.c[l].dist, h.c[first].dist) {
+			first = l
+		}
+		if r < last && h.less(h.c[r].dist, h.c[first].dist) {
+			first = r
+		}
+		if first == i {
+			break
+		}
+		h.c[i], h.c[first] = h.c[first], h.c[i]
+		i = first
+	}
+	return top
+}
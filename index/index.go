@@ -0,0 +1,501 @@
+// Package index is the inverted index: postings with term frequencies and
+// positions, BM25 ranking, and saving the whole thing to disk.
+package index
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Building the index
+// For every term we keep the IDs of the documents containing it, in ascending
+// order, and next to each ID the number of times the term occurs there. Together
+// with the analyzed length of every document that's all BM25 needs. Positions
+// holds, per document, where in its analyzed token stream the term occurs, which
+// is what phrase queries check adjacency against.
+// Packed into blocks, see blocks.go. IDs, Freqs and Positions are the tail of
+// entries not packed yet.
+type postings struct {
+	Blocks    []postingBlock
+	IDs       []int
+	Freqs     []int
+	Positions [][]int
+}
+
+type Index struct {
+	analyzer analysis.Analyzer
+	synonyms *analysis.Synonyms
+
+	terms    map[string]*postings
+	docLen   map[int]int     // lengths of the text field; every indexed document has one
+	boost    map[int]float64 // only documents with a boost other than 1.0
+	totalLen int
+
+	// Lengths of the other fields, see fields.go. fieldBoost only holds boosts set
+	// with SetFieldBoost.
+	fieldLen   map[string]map[int]int
+	fieldTotal map[string]int
+	fieldBoost map[string]float64
+
+	fieldGap   int  // between the fields of FieldAll, 0 without it, see allfield.go
+	exactForms bool // see exact.go
+
+	minTermFreq map[string]int // by field, "" for the rest, see prune.go
+
+	// Values of the keyword fields by field and document.
+	keywords map[string]map[int][]string
+
+	// Values of the numeric fields by field and document, see numeric.go, and
+	// the sorted ones built from them.
+	numbers       map[string]map[int]float64
+	numbersMu     sync.Mutex
+	sortedNumbers map[string][]numericEntry
+
+	// The points of the geo fields, see geo.go, sorted lazily like the numbers
+	// and under the same lock.
+	geo       map[string]map[int]GeoPoint
+	sortedGeo map[string][]geoEntry
+
+	// The normalized vectors of the vector fields, see knn.go, and the HNSW
+	// graphs built from them.
+	vectors   map[string]map[int][]float32
+	vectorsMu sync.Mutex
+	graphs    map[string]*hnsw
+
+	// The languages documents declared, which queries are analyzed for as well.
+	languages map[string]struct{}
+
+	// Lowercased titles to sort by, and the sort columns built from the
+	// fields, see sort.go.
+	titles    map[int]string
+	columnsMu sync.Mutex
+	columns   map[string]*column
+
+	// Filters cached with CachedFilter, see filtercache.go.
+	filtersMu sync.Mutex
+	filters   *filterCache
+
+	// Where the words of each term are in the documents indexed with
+	// storeOffsets on, by document and key, see offsets.go.
+	offsets      map[int]map[string][]analysis.Offset
+	storeOffsets bool
+
+	scorer Scorer // nil for DefaultScorer
+
+	// Deleted documents stay in the posting lists until the next compaction.
+	deleted map[int]struct{}
+
+	// Posting lists of an index opened with OpenDisk, terms is empty then.
+	disk *diskTerms
+
+	// The storage of an index opened with NewWithStorage, see storage.go: terms
+	// holds the lists changed since the last Commit, dropped the ones removed
+	// and warmed the ones Warmup read.
+	storage     Storage
+	storedTerms []string
+	dropped     map[string]struct{}
+	warmed      map[string]*postings
+	storageMu   sync.Mutex
+	storageErr  error
+
+	// The sorted term dictionary, see Terms. termsMu lets concurrent searches
+	// share the lazy rebuild.
+	termsMu     sync.Mutex
+	sortedTerms []string
+	termsDirty  bool
+	termsGen    int
+
+	// Bigrams of the sorted terms for fuzzy matching, built for termsGen gramGen.
+	gramTerms map[string][]int
+	gramGen   int
+
+	// The memory limit set with SetMemoryLimit and the bytes in use as of the
+	// last measurement plus estimates since, see memory.go.
+	memLimit int
+	memUsed  atomic.Int64
+}
+
+// New returns an empty index that analyzes text with analyzer, or with
+// analysis.Default when analyzer is nil.
+func New(analyzer analysis.Analyzer) *Index {
+	if analyzer == nil {
+		analyzer = analysis.Default
+	}
+
+	return &Index{
+		analyzer:   analyzer,
+		terms:      make(map[string]*postings),
+		docLen:     make(map[int]int),
+		boost:      make(map[int]float64),
+		fieldLen:   make(map[string]map[int]int),
+		fieldTotal: make(map[string]int),
+		fieldBoost: make(map[string]float64),
+		keywords:   make(map[string]map[int][]string),
+		numbers:    make(map[string]map[int]float64),
+		geo:        make(map[string]map[int]GeoPoint),
+		vectors:    make(map[string]map[int][]float32),
+		languages:  make(map[string]struct{}),
+		titles:     make(map[int]string),
+		offsets:    make(map[int]map[string][]analysis.Offset),
+		deleted:    make(map[int]struct{}),
+	}
+}
+
+func (idx *Index) Analyzer() analysis.Analyzer {
+	return idx.analyzer
+}
+
+// Languages lists the languages documents declared, sorted.
+func (idx *Index) Languages() []string {
+	r := make([]string, 0, len(idx.languages))
+	for lang := range idx.languages {
+		r = append(r, lang)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// SetSynonyms makes searches expand every query term into its synonym group, see
+// analysis.Synonyms. They aren't saved with the index.
+func (idx *Index) SetSynonyms(s *analysis.Synonyms) {
+	idx.synonyms = s
+}
+
+func (idx *Index) Synonyms() *analysis.Synonyms {
+	return idx.synonyms
+}
+
+// SynonymIDs is FieldIDs for term or any of its synonyms.
+func (idx *Index) SynonymIDs(field, term string) []int {
+	group := idx.synonyms.Expand(term)
+	if len(group) == 1 {
+		return idx.FieldIDs(field, term)
+	}
+
+	var r []int
+	for _, t := range group {
+		r = Union(r, idx.FieldIDs(field, t))
+	}
+	return r
+}
+
+// IDs returns the posting list of a dictionary key, i.e. an analyzed term of the
+// text field or one qualified with FieldKey, decoded into a new slice.
+func (idx *Index) IDs(term string) []int {
+	if p, ok := idx.lookup(term); ok {
+		return idx.live(p.ids())
+	}
+	return nil
+}
+
+// docFreq is the number of live documents containing a dictionary key; unlike IDs
+// it only decodes anything if there are deleted documents.
+func (idx *Index) docFreq(term string) int {
+	p, ok := idx.lookup(term)
+	if !ok {
+		return 0
+	}
+	if len(idx.deleted) == 0 {
+		return p.len()
+	}
+	return len(idx.IDs(term))
+}
+
+// Indexing options
+type Options struct {
+	// TraceDoc is called for every document with the final analyzed tokens of its
+	// text.
+	// Handy for finding out why a particular document doesn't match.
+	TraceDoc func(doc Document, tokens []string)
+
+	// DedupBy finds documents whose URL or content was indexed already, and
+	// Duplicates says what to do with them, see dedup.go. Seen remembers what was
+	// indexed; pass the same one to dedup across several add calls.
+	DedupBy    DedupMode
+	Duplicates DuplicatePolicy
+	Seen       *Seen
+
+	// Progress is called with how far indexing got, see progress.go, every
+	// ProgressEvery. Size is the length of the input of AddStream, for the ETA.
+	Progress      func(Progress)
+	ProgressEvery time.Duration
+	Size          int64
+
+	// Of the parallel batches of AddConcurrentWithOptions, reported together.
+	progress *progress
+}
+
+func (idx *Index) Add(docs []Document) error {
+	_, err := idx.AddWithOptions(docs, Options{})
+	return err
+}
+
+// Returns the number of duplicates found.
+func (idx *Index) AddWithOptions(docs []Document, opts Options) (int, error) {
+	if err := idx.Writable(); err != nil {
+		return 0, err
+	}
+	b := idx.newBatch(opts, len(docs))
+	for _, doc := range docs {
+		b.add(doc)
+	}
+	return b.finish(), nil
+}
+
+// A batch is one AddWithOptions call (or one streamed dump): the options plus the
+// state that has to live until the end, like the duplicates found.
+type batch struct {
+	idx  *Index
+	opts Options
+	dups int
+
+	progress    *progress // nil if not reported
+	ownProgress bool      // reported as done by finish
+}
+
+// newBatch starts a batch of total documents, 0 if not known.
+func (idx *Index) newBatch(opts Options, total int) *batch {
+	if opts.DedupBy != DedupNone && opts.Seen == nil {
+		opts.Seen = NewSeen(DefaultNearDistance)
+	}
+
+	b := &batch{idx: idx, opts: opts, progress: opts.progress}
+	if b.progress == nil {
+		b.progress = newProgress(opts, total)
+		b.ownProgress = b.progress != nil
+	}
+	return b
+}
+
+func (b *batch) add(doc Document) {
+	idx, opts := b.idx, b.opts
+	tokenCount := 0
+	if b.progress != nil {
+		defer func() { b.progress.add(tokenCount) }()
+	}
+
+	if opts.DedupBy != DedupNone {
+		var ok bool
+		if doc, ok = b.dedup(doc); !ok {
+			return
+		}
+	}
+
+	if doc.Boost != 0 && doc.Boost != DefaultBoost {
+		idx.boost[doc.ID] = doc.Boost
+	}
+	if doc.Title != "" {
+		idx.titles[doc.ID] = strings.ToLower(doc.Title)
+	}
+	idx.account(len(Fields)*(2*intSize+mapEntryOverhead) + len(doc.Title))
+	idx.dropColumns()
+	idx.dropFilters()
+
+	lang := idx.language(&doc)
+	var all [][]string // the tokens of the default fields, for FieldAll
+	for _, field := range Fields {
+		tokens := analysis.ForLanguage(idx.FieldAnalyzer(field), lang).Analyze(documentField(doc, field))
+		if field == FieldText && opts.TraceDoc != nil {
+			opts.TraceDoc(doc, tokens)
+		}
+		idx.addFieldLength(field, doc.ID, len(tokens))
+		tokenCount += len(tokens)
+		if idx.fieldGap > 0 && isDefaultField(field) {
+			all = append(all, tokens)
+		}
+		if idx.exactForms && isDefaultField(field) {
+			b.addExact(doc.ID, field, documentField(doc, field), lang)
+		}
+
+		positions := make(map[string][]int)
+		for pos, token := range tokens {
+			key := FieldKey(field, token)
+			positions[key] = append(positions[key], pos)
+		}
+
+		for key, pos := range positions {
+			idx.addPosting(key, doc.ID, pos)
+		}
+	}
+	if all != nil {
+		b.addAll(doc.ID, all)
+	}
+	tokenCount += b.addNested(doc, lang)
+	if idx.storeOffsets {
+		idx.addOffsets(doc, lang)
+	}
+	idx.addKeywords(doc)
+	idx.addNumbers(doc)
+	idx.addGeo(doc)
+	idx.addVectors(doc)
+}
+
+// addPosting records that term occurs in document id at the given positions.
+func (idx *Index) addPosting(term string, id int, positions []int) {
+	p, ok := idx.changing(term)
+	if !ok {
+		p = &postings{}
+		idx.terms[term] = p
+		idx.termsDirty = true
+		idx.account(len(term) + stringHeaderSize + mapEntryOverhead + 4*sliceHeaderSize)
+	}
+	p.add(id, positions)
+	idx.account((len(positions)+2)*intSize + sliceHeaderSize)
+}
+
+func (b *batch) finish() int {
+	if b.ownProgress {
+		b.progress.done()
+	}
+	return b.dups
+}
+
+// Searching
+// Every query term that is in the index has to match in one of the default
+// fields, the hits come back ranked by BM25.
+func (idx *Index) Search(text string) []Result {
+	ids, s := idx.match(text)
+	return idx.rank(ids, s)
+}
+
+// SearchWithOptions is Search for one page of the results. It also returns the
+// total number of matches.
+func (idx *Index) SearchWithOptions(text string, opts SearchOptions) ([]Result, int) {
+	ids, s := idx.match(text)
+	return idx.RankPage(ids, s, opts), len(ids)
+}
+
+// SearchContext is SearchWithOptions that stops ranking once ctx is done,
+// returning the best hits found so far along with ctx's error. SearchPage can
+// stop matching as well, see partial.go.
+func (idx *Index) SearchContext(ctx context.Context, text string, opts SearchOptions) ([]Result, int, error) {
+	ids, s := idx.match(text)
+	r, err := idx.RankPageContext(ctx, ids, s, opts)
+	return r, len(ids), err
+}
+
+// match returns the documents matching all terms of text and what to score them
+// with.
+func (idx *Index) match(text string) ([]int, Scoring) {
+	lists, s := idx.matchLists(text)
+	return IntersectAll(lists), s
+}
+
+// matchLists returns the lists match intersects, the documents of each term of
+// text, and what to score them with.
+func (idx *Index) matchLists(text string) ([][]int, Scoring) {
+	var lists [][]int
+	var s Scoring
+
+	tokens := idx.analyzer.Analyze(text)
+	exact := idx.ExactKeys("", text, len(tokens))
+	for i, token := range tokens {
+		var keys []string
+		for _, t := range idx.synonyms.Expand(token) {
+			keys = append(keys, idx.FieldTerms("", t)...)
+		}
+		s.Terms = append(s.Terms, keys...)
+		term := QueryTerm{Keys: keys}
+		if exact != nil {
+			term.Exact = exact[i]
+		}
+		s.Query = append(s.Query, term)
+		if ids := idx.SynonymIDs("", token); ids != nil {
+			lists = append(lists, ids)
+		}
+	}
+	return lists, s
+}
+
+// Estimating selectivity
+// The result of an AND query can never be longer than its shortest posting list,
+// so the smallest document frequency is a cheap upper bound on the result count.
+// A term's list is the one match intersects, with the documents of its synonyms.
+func (idx *Index) EstimateSelectivity(text string) int {
+	estimate := -1
+
+	for _, token := range idx.analyzer.Analyze(text) {
+		if ids := idx.SynonymIDs("", token); ids != nil {
+			if estimate < 0 || len(ids) < estimate {
+				estimate = len(ids)
+			}
+		}
+	}
+
+	if estimate < 0 {
+		return 0
+	}
+	return estimate
+}
+
+// Very common terms
+// A single-term query for something like "the" (if it slips past the stopwords)
+// matches nearly the whole corpus. When the term's document frequency is above
+// maxFraction of the indexed documents we only rank the first limit of them and
+// flag the query instead of passing millions of hits along. A limit of 0 or
+// below ranks none, the flag is all there is.
+func (idx *Index) SearchCommonGuarded(text string, maxFraction float64, limit int) ([]Result, bool) {
+	tokens := idx.analyzer.Analyze(text)
+	numDocs := len(idx.docLen)
+	if len(tokens) != 1 || numDocs == 0 {
+		return idx.Search(text), false
+	}
+	limit = max(limit, 0)
+
+	var keys []string
+	for _, t := range idx.synonyms.Expand(tokens[0]) {
+		keys = append(keys, idx.FieldTerms("", t)...)
+	}
+	// The longest list is a lower bound on the matches. Past the fraction
+	// already, only as many documents as are ranked are read.
+	longest := 0
+	for _, key := range keys {
+		longest = max(longest, idx.docFreq(key))
+	}
+	if float64(longest)/float64(numDocs) > maxFraction {
+		return idx.Rank(idx.firstIDs(keys, limit), keys), true
+	}
+
+	ids := idx.SynonymIDs("", tokens[0])
+	if float64(len(ids))/float64(numDocs) <= maxFraction {
+		return idx.Rank(ids, keys), false
+	}
+
+	if len(ids) > limit {
+		ids = ids[:limit:limit]
+	}
+	return idx.Rank(ids, keys), true
+}
+
+// firstIDs is the union of the posting lists of keys up to its first n
+// documents, reading each list only as far as that.
+func (idx *Index) firstIDs(keys []string, n int) []int {
+	var its []PostingsIterator
+	for _, key := range keys {
+		if it, ok := idx.Postings(key); ok && it.Next() {
+			its = append(its, it)
+		}
+	}
+	r := make([]int, 0, n)
+	for len(r) < n && len(its) > 0 {
+		next := its[0].Doc()
+		for _, it := range its[1:] {
+			next = min(next, it.Doc())
+		}
+		r = append(r, next)
+		live := its[:0]
+		for _, it := range its {
+			if it.Doc() > next || it.Next() {
+				live = append(live, it)
+			}
+		}
+		its = live
+	}
+	return r
+}
@@ -0,0 +1,282 @@
+package index
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+func synonymIndex() *Index {
+	idx := New(nil)
+	idx.Add([]Document{
+		{ID: 0, Text: "a red car"},
+		{ID: 1, Text: "an old automobile"},
+		{ID: 2, Text: "a fast car and a fast automobile"},
+		{ID: 3, Text: "a red bicycle"},
+	})
+	idx.SetSynonyms(analysis.NewSynonyms([][]string{{"car", "automobile"}}, idx.Analyzer()))
+	return idx
+}
+
+func TestEstimateSelectivitySynonyms(t *testing.T) {
+	idx := synonymIndex()
+	for _, q := range []string{"car", "automobile", "red car", "fast automobile", "old car"} {
+		t.Run(q, func(t *testing.T) {
+			got, want := idx.EstimateSelectivity(q), len(idx.Search(q))
+			if got < want {
+				t.Errorf("estimate %d is below the %d results", got, want)
+			}
+		})
+	}
+}
+
+func TestSearchCommonGuardedSynonyms(t *testing.T) {
+	idx := synonymIndex()
+	// "car" is in 2 of 4 documents, with "automobile" in 3.
+	results, capped := idx.SearchCommonGuarded("car", 0.6, 1)
+	if !capped {
+		t.Error("not capped although the term and its synonym are in 3 of 4 documents")
+	}
+	if len(results) != 1 {
+		t.Errorf("got %d results, want the cap of 1", len(results))
+	}
+	if results, capped = idx.SearchCommonGuarded("car", 0.8, 1); capped || len(results) != 3 {
+		t.Errorf("got %d results, capped %v, want all 3, not capped", len(results), capped)
+	}
+}
+
+func TestEstimateSelectivity(t *testing.T) {
+	idx := New(nil)
+	idx.Add([]Document{
+		{ID: 0, Text: "a wild cat in the garden"},
+		{ID: 1, Text: "a tame cat and a dog"},
+		{ID: 2, Text: "a dog in the garden"},
+		{ID: 3, Text: "a wild dog"},
+		{ID: 4, Text: "a cat, a dog and a wild fox"},
+	})
+
+	tests := []struct {
+		query    string
+		estimate int // the lowest document frequency of the terms
+	}{
+		{"cat", 3},
+		{"dog", 4},
+		{"cat dog", 3},
+		{"wild cat", 3},
+		{"wild dog garden", 2},
+		{"cat dog garden", 2},
+		{"fox", 1},
+		{"wild fox", 1},
+		{"unicorn", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, results := idx.EstimateSelectivity(tt.query), len(idx.Search(tt.query))
+			if got < results {
+				t.Errorf("estimate %d is below the %d results", got, results)
+			}
+			if got != tt.estimate {
+				t.Errorf("estimate %d, want %d", got, tt.estimate)
+			}
+		})
+	}
+}
+
+func TestEstimateSelectivityDeleted(t *testing.T) {
+	// Enough other documents that the deletion leaves a tombstone instead of
+	// compacting the posting lists.
+	docs := []Document{
+		{ID: 0, Text: "a wild cat in the garden"},
+		{ID: 1, Text: "a tame cat and a dog"},
+		{ID: 2, Text: "a cat, a dog and a wild fox"},
+	}
+	for id := 3; id < 20; id++ {
+		docs = append(docs, Document{ID: id, Text: "a bird"})
+	}
+	idx := New(nil)
+	idx.Add(docs)
+	if err := idx.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query    string
+		estimate int // the lowest document frequency of the terms, without document 2
+	}{
+		{"cat", 2},
+		{"dog", 1},
+		{"cat dog", 1},
+		{"wild cat", 1},
+		{"fox", 0},
+		{"wild fox", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, results := idx.EstimateSelectivity(tt.query), len(idx.Search(tt.query))
+			if got < results {
+				t.Errorf("estimate %d is below the %d results", got, results)
+			}
+			if got != tt.estimate {
+				t.Errorf("estimate %d, want %d", got, tt.estimate)
+			}
+		})
+	}
+}
+
+func TestTraceDoc(t *testing.T) {
+	docs := []Document{
+		{ID: 0, Title: "Cats", Text: "The wild cats are running"},
+		{ID: 1, Title: "Dogs", Text: "A dog barks at the cats"},
+		{ID: 2, Text: ""},
+	}
+	tests := []struct {
+		name    string
+		workers int // 0 for AddWithOptions
+		id      int
+		want    []string
+	}{
+		{"stemmed without stopwords", 0, 0, []string{"wild", "cat", "are", "run"}},
+		{"another document", 0, 1, []string{"dog", "bark", "at", "cat"}},
+		{"empty text", 0, 2, []string{}},
+		{"from the workers", 2, 1, []string{"dog", "bark", "at", "cat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			traced := make(map[int][]string)
+			opts := Options{TraceDoc: func(doc Document, tokens []string) {
+				mu.Lock()
+				defer mu.Unlock()
+				traced[doc.ID] = append([]string{}, tokens...)
+			}}
+			idx := New(nil)
+			var err error
+			if tt.workers > 0 {
+				_, err = idx.AddConcurrentWithOptions(docs, tt.workers, opts)
+			} else {
+				_, err = idx.AddWithOptions(docs, opts)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(traced) != len(docs) {
+				t.Errorf("traced %d documents, want %d", len(traced), len(docs))
+			}
+			got, ok := traced[tt.id]
+			if !ok {
+				t.Fatalf("document %d not traced", tt.id)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tokens %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailSearchable(t *testing.T) {
+	idx := New(&analysis.Standard{KeepEmailsAndURLs: true})
+	idx.Add([]Document{
+		{ID: 0, Text: "write to user@example.com for a copy"},
+		{ID: 1, Text: "the example user has a copy"},
+	})
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"user@example.com", []int{0}},
+		{"USER@example.com", []int{0}},
+		{"other@example.com", nil},
+		{"example user", []int{1}},
+		{"copy", []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got []int
+			for _, r := range idx.Search(tt.query) {
+				got = append(got, r.ID)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matches %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// the email is where it was in the text
+	if got := idx.FieldPhraseMatches("", idx.Analyzer().Analyze("user@example.com for")); !slices.Equal(got, []int{0}) {
+		t.Errorf("the phrase \"user@example.com for\" matches %v, want [0]", got)
+	}
+}
+
+func TestIndexLongToken(t *testing.T) {
+	long := strings.Repeat("a", 10000)
+	idx := New(nil)
+	if err := idx.Add([]Document{{ID: 0, Title: "Long", Text: "a wild cat " + long}, {ID: 1, Text: "a dog"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		query   string
+		matches int
+	}{
+		{long, 1},
+		{"cat", 1},
+		{"dog", 1},
+	} {
+		if n := len(idx.Search(tt.query)); n != tt.matches {
+			t.Errorf("%.20q matches %d documents, want %d", tt.query, n, tt.matches)
+		}
+	}
+}
+
+func TestSearchCommonGuarded(t *testing.T) {
+	idx := New(nil)
+	var docs []Document
+	for id := 0; id < 10; id++ {
+		text := "a cat"
+		switch {
+		case id == 9:
+			text = "a rare lynx"
+		case id%3 == 0:
+			text = "a cat and a dog"
+		}
+		docs = append(docs, Document{ID: id, Text: text})
+	}
+	idx.Add(docs)
+
+	tests := []struct {
+		name        string
+		query       string
+		maxFraction float64
+		limit       int
+		ids         []int // of the results, in any order
+		capped      bool
+	}{
+		{"common term capped", "cat", 0.5, 3, []int{0, 1, 2}, true},
+		{"limit above the matches", "cat", 0.5, 20, []int{0, 1, 2, 3, 4, 5, 6, 7, 8}, true},
+		{"below the fraction", "cat", 0.95, 3, []int{0, 1, 2, 3, 4, 5, 6, 7, 8}, false},
+		{"rare term", "lynx", 0.5, 3, []int{9}, false},
+		{"several terms", "cat dog", 0.1, 1, []int{0, 3, 6}, false},
+		{"no match", "unicorn", 0.1, 1, nil, false},
+		{"no limit", "cat", 0.5, 0, nil, true},
+		{"negative limit", "cat", 0.5, -1, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, capped := idx.SearchCommonGuarded(tt.query, tt.maxFraction, tt.limit)
+			if capped != tt.capped {
+				t.Errorf("capped %v, want %v", capped, tt.capped)
+			}
+			var ids []int
+			for _, r := range results {
+				ids = append(ids, r.ID)
+			}
+			slices.Sort(ids)
+			if !slices.Equal(ids, tt.ids) {
+				t.Errorf("results %v, want %v", ids, tt.ids)
+			}
+		})
+	}
+}
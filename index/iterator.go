@@ -0,0 +1,154 @@
+package index
+
+// Posting iterators
+// Postings and IDs decode a whole list into slices, which is wasted on an
+// operator that only looks at a few of its documents. A PostingsIterator walks
+// one from the compressed blocks instead, decoding only the blocks it stops in,
+// and Advance jumps over the blocks in between like a conjunction of the
+// engine's own does, so custom query operators and scorers can be built on the
+// same cursors. A conjunction of two terms, for one:
+//
+//	a, _ := idx.Postings(index.FieldKey("text", "wild"))
+//	b, _ := idx.Postings(index.FieldKey("text", "cat"))
+//	for ok := a.Next(); ok && b.Advance(a.Doc()); {
+//		if b.Doc() == a.Doc() {
+//			score := index.DefaultScorer.Score(a.Stats()) + index.DefaultScorer.Score(b.Stats())
+//			...
+//			ok = a.Next()
+//		} else {
+//			ok = a.Advance(b.Doc())
+//		}
+//	}
+//
+// Deleted documents are skipped. An iterator reads the index as it was when it
+// was made and can't be used once the index changes; the Index of a Reader
+// keeps still while changes go on. It's for one goroutine.
+type PostingsIterator interface {
+	// Next moves to the next document, the first one when called first, and
+	// reports whether there was one.
+	Next() bool
+
+	// Advance moves to the first document not below target and reports whether
+	// there is one. On a document not below target already it stays there.
+	Advance(target int) bool
+
+	// Doc is the document the iterator is on.
+	Doc() int
+
+	// Freq is how often the term occurs in it.
+	Freq() int
+
+	// Positions are where, nil for lists without positions (read back from a CSV
+	// export). They mustn't be changed.
+	Positions() []int
+
+	// Len is how many documents the list holds, deleted ones included, an upper
+	// bound for ordering iterators cheapest first.
+	Len() int
+
+	// Stats are the term's statistics for a Scorer, with the frequency and the
+	// field length of the document the iterator is on.
+	Stats() TermStats
+}
+
+// Postings returns an iterator over the posting list of a dictionary key (see
+// FieldKey), false if the key isn't in the index.
+func (idx *Index) Postings(key string) (PostingsIterator, bool) {
+	p, ok := idx.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	field, _ := SplitKey(key)
+	return &postingsIterator{idx: idx, c: p.cursor(), field: field, key: key}, true
+}
+
+type postingsIterator struct {
+	idx   *Index
+	c     *postingCursor
+	field string
+	key   string
+	doc   int
+	done  bool
+	stats *TermStats // the collection statistics, once asked for
+}
+
+func (it *postingsIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	if it.c.b < 0 {
+		it.c.load(0)
+	} else {
+		it.c.j++
+	}
+	return it.settle()
+}
+
+func (it *postingsIterator) Advance(target int) bool {
+	if it.done {
+		return false
+	}
+	if it.c.b >= 0 && it.doc >= target {
+		return true
+	}
+	it.c.seek(target)
+	return it.settle()
+}
+
+// settle moves from the cursor's entry on to the first of a live document,
+// decoding the blocks after it as needed.
+func (it *postingsIterator) settle() bool {
+	c := it.c
+	for {
+		for c.j >= len(c.ids) {
+			if c.b >= len(c.p.Blocks) {
+				it.done = true
+				return false
+			}
+			c.load(c.b + 1)
+		}
+		if _, gone := it.idx.deleted[c.ids[c.j]]; !gone {
+			it.doc = c.ids[c.j]
+			return true
+		}
+		c.j++
+	}
+}
+
+func (it *postingsIterator) Doc() int {
+	return it.doc
+}
+
+func (it *postingsIterator) Freq() int {
+	return it.c.freq()
+}
+
+func (it *postingsIterator) Positions() []int {
+	c := it.c
+	if c.b < len(c.p.Blocks) && !c.p.Blocks[c.b].Positions {
+		return nil
+	}
+	if c.b == len(c.p.Blocks) && c.ps == nil {
+		return nil
+	}
+	return c.positions()
+}
+
+func (it *postingsIterator) Len() int {
+	return it.c.p.len()
+}
+
+func (it *postingsIterator) Stats() TermStats {
+	if it.stats == nil {
+		it.stats = &TermStats{
+			Term:           it.key,
+			Field:          it.field,
+			AvgFieldLength: it.idx.avgFieldLength(it.field),
+			DocFreq:        it.idx.docFreq(it.key),
+			DocCount:       it.idx.docCount(),
+		}
+	}
+	s := *it.stats
+	s.Freq, s.FieldLength = it.Freq(), it.idx.fieldLength(it.field, it.doc)
+	return s
+}
@@ -0,0 +1,348 @@
+package index
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Embeddings
+// A document can have embeddings (Document.Vectors), a float32 vector per vector
+// field from a model outside the index, to find documents by what they mean
+// rather than by their words. KNN returns the K documents whose vectors in a field
+// are nearest to a query vector by cosine similarity: by comparing the query with
+// every one of them if it's Exact, otherwise through the field's HNSW graph (see
+// hnsw.go), which finds nearly all of them in a fraction of the time. Fields with
+// fewer than exactVectorsBelow vectors and filters down to a tenth of them or
+// less are searched exactly anyway. All the vectors of a field have the length of
+// the first one; others are left out, and so are zero vectors and those with NaN
+// or infinities. The index keeps them normalized.
+//
+// SearchOptions.Vector makes a ranking hybrid: the hits of the text query are
+// ranked by BM25 and by their similarity to the vector, and the ranks are fused
+// without looking at the scores, each adding 1/(RRFRankConstant+rank) (reciprocal
+// rank fusion), so a hit that's high in both lists beats one that tops only one of
+// them, whatever the scales of the two. The best K of each count, at least as many
+// as the page needs. Ranking every document with an empty Scoring ranks by the
+// vector alone.
+type VectorQuery struct {
+	Field  string
+	Vector []float32
+	K      int  // neighbours to find, DefaultK if 0
+	Ef     int  // candidates the graph search keeps, DefaultEf if 0, at least K
+	Exact  bool // compare with every vector instead of searching the graph
+	Filter []int
+}
+
+const (
+	DefaultK          = 10
+	DefaultEf         = 100
+	RRFRankConstant   = 60
+	exactVectorsBelow = 1000
+)
+
+// HybridExplanation is where a hit of a hybrid ranking was in each list, 1 for the
+// first and 0 if it wasn't among them, and its similarity to the vector. The
+// Explanation's Score is its text score then, the hit's the fused one.
+type HybridExplanation struct {
+	TextRank   int     `json:"text_rank"`
+	VectorRank int     `json:"vector_rank"`
+	Similarity float64 `json:"similarity,omitempty"`
+}
+
+// ParseVector reads numbers separated by commas, in square brackets or not.
+func ParseVector(s string) ([]float32, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	parts := strings.Split(s, ",")
+	v := make([]float32, len(parts))
+	for i, part := range parts {
+		x, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad vector component %q", part)
+		}
+		v[i] = float32(x)
+	}
+	return v, nil
+}
+
+// ParseVectorQuery reads a query like "embedding:0.12,-0.5,0.33": the field and
+// the vector.
+func ParseVectorQuery(spec string) (VectorQuery, error) {
+	field, vector, ok := strings.Cut(spec, ":")
+	if !ok || field == "" {
+		return VectorQuery{}, fmt.Errorf("bad vector query %q, want field:numbers", spec)
+	}
+	v, err := ParseVector(vector)
+	if err != nil {
+		return VectorQuery{}, err
+	}
+	return VectorQuery{Field: field, Vector: v}, nil
+}
+
+// normalize returns v scaled to a length of 1, false if it can't be.
+func normalize(v []float32) ([]float32, bool) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	norm := math.Sqrt(sum)
+	if len(v) == 0 || norm == 0 || math.IsNaN(norm) || math.IsInf(norm, 0) {
+		return nil, false
+	}
+	r := make([]float32, len(v))
+	for i, x := range v {
+		r[i] = float32(float64(x) / norm)
+	}
+	return r, true
+}
+
+func (idx *Index) addVectors(doc Document) {
+	for field, v := range doc.Vectors {
+		if IsField(field) {
+			continue
+		}
+		if dims := idx.vectorDims(field); dims != 0 && len(v) != dims {
+			continue
+		}
+		if n, ok := normalize(v); ok {
+			idx.addVector(field, n, doc.ID)
+		}
+	}
+}
+
+// addVector records the normalized vector v of document id.
+func (idx *Index) addVector(field string, v []float32, id int) {
+	byDoc, ok := idx.vectors[field]
+	if !ok {
+		byDoc = make(map[int][]float32)
+		idx.vectors[field] = byDoc
+	}
+	byDoc[id] = v
+
+	idx.vectorsMu.Lock()
+	if g := idx.graphs[field]; g != nil {
+		g.insert(id, v)
+	}
+	idx.vectorsMu.Unlock()
+}
+
+func (idx *Index) dropVectors(id int) {
+	idx.vectorsMu.Lock()
+	defer idx.vectorsMu.Unlock()
+
+	for field, byDoc := range idx.vectors {
+		if _, ok := byDoc[id]; ok {
+			delete(byDoc, id)
+			if g := idx.graphs[field]; g != nil {
+				g.remove(id)
+			}
+		}
+	}
+}
+
+// VectorFields lists the vector fields of the indexed documents, sorted.
+func (idx *Index) VectorFields() []string {
+	r := make([]string, 0, len(idx.vectors))
+	for field := range idx.vectors {
+		r = append(r, field)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (idx *Index) IsVectorField(field string) bool {
+	_, ok := idx.vectors[field]
+	return ok
+}
+
+// vectorDims is the length of the vectors of field, 0 if it has none.
+func (idx *Index) vectorDims(field string) int {
+	for _, v := range idx.vectors[field] {
+		return len(v)
+	}
+	return 0
+}
+
+// graph returns the HNSW graph of field, building it if there's none or half of
+// it is dead.
+func (idx *Index) graph(field string) *hnsw {
+	idx.vectorsMu.Lock()
+	defer idx.vectorsMu.Unlock()
+
+	g := idx.graphs[field]
+	if g != nil && g.removed <= g.live() {
+		return g
+	}
+	byDoc := idx.vectors[field]
+	ids := make([]int, 0, len(byDoc))
+	for id := range byDoc {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	g = newHNSW()
+	for _, id := range ids {
+		g.insert(id, byDoc[id])
+	}
+	if idx.graphs == nil {
+		idx.graphs = make(map[string]*hnsw)
+	}
+	idx.graphs[field] = g
+	return g
+}
+
+// CheckVector returns an error if q isn't a query of a vector field with
+// vectors as long as the field's.
+func (idx *Index) CheckVector(q *VectorQuery) error {
+	if q == nil {
+		return nil
+	}
+	if !idx.IsVectorField(q.Field) {
+		return fmt.Errorf("can't search %s for neighbours: not a vector field", q.Field)
+	}
+	if dims := idx.vectorDims(q.Field); len(q.Vector) != dims {
+		return fmt.Errorf("vector of %d dimensions for %s, which has %d", len(q.Vector), q.Field, dims)
+	}
+	if q.K < 0 || q.Ef < 0 {
+		return fmt.Errorf("negative k or ef")
+	}
+	return nil
+}
+
+// KNN returns the K documents nearest to q.Vector, among those of q.Filter if it
+// isn't nil, most similar first, with their cosine similarity as the score.
+func (idx *Index) KNN(q VectorQuery) ([]Result, error) {
+	if err := idx.CheckVector(&q); err != nil {
+		return nil, err
+	}
+	v, ok := normalize(q.Vector)
+	if !ok {
+		return nil, fmt.Errorf("can't search with a zero vector")
+	}
+	k := q.K
+	if k == 0 {
+		k = DefaultK
+	}
+	byDoc := idx.vectors[q.Field]
+	if q.Exact || len(byDoc) < exactVectorsBelow || (q.Filter != nil && 10*len(q.Filter) <= len(byDoc)) {
+		return idx.exactKNN(byDoc, v, k, q.Filter), nil
+	}
+
+	ef := q.Ef
+	if ef == 0 {
+		ef = DefaultEf
+	}
+	ef = max(ef, k)
+	var accept func(id int) bool
+	if q.Filter != nil {
+		// Fewer of the candidates pass, so it takes more of them.
+		ef = min(len(byDoc), ef*len(byDoc)/max(len(q.Filter), 1))
+		accept = func(id int) bool {
+			i := sort.SearchInts(q.Filter, id)
+			return i < len(q.Filter) && q.Filter[i] == id
+		}
+	}
+	g := idx.graph(q.Field)
+	found := g.search(v, ef, accept)
+	if q.Filter != nil && len(found) < k {
+		return idx.exactKNN(byDoc, v, k, q.Filter), nil
+	}
+	r := make([]Result, min(k, len(found)))
+	for i := range r {
+		r[i] = Result{ID: g.ids[found[i].node], Score: float64(1 - found[i].dist)}
+	}
+	return r, nil
+}
+
+// exactKNN compares v with the vectors of the documents of filter, or all of them.
+func (idx *Index) exactKNN(byDoc map[int][]float32, v []float32, k int, filter []int) []Result {
+	var h resultHeap
+	consider := func(id int, w []float32) {
+		res := Result{ID: id, Score: float64(dot(v, w))}
+		if len(h) < k {
+			heap.Push(&h, res)
+		} else if (resultHeap{h[0], res}).Less(0, 1) {
+			h[0] = res
+			heap.Fix(&h, 0)
+		}
+	}
+	if filter != nil {
+		for _, id := range filter {
+			if w, ok := byDoc[id]; ok {
+				consider(id, w)
+			}
+		}
+	} else {
+		for id, w := range byDoc {
+			consider(id, w)
+		}
+	}
+	r := make([]Result, len(h))
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i] = heap.Pop(&h).(Result)
+	}
+	return r
+}
+
+// rankHybrid fuses the BM25 ranking of ids with their ranking by q, for a page
+// ending at end or, if that's 0, all of them.
+func (idx *Index) rankHybrid(ctx context.Context, ids []int, s Scoring, q VectorQuery, end int) ([]Result, map[int]HybridExplanation, error) {
+	k := q.K
+	if k == 0 {
+		k = DefaultK
+	}
+	k = max(k, end)
+	if end == 0 {
+		k = len(ids)
+	}
+	text, err := idx.rankTopContext(ctx, ids, s, k, idx)
+	if err != nil {
+		return nil, nil, err
+	}
+	q.K, q.Filter = k, ids
+	near, err := idx.KNN(q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fused := make(map[int]HybridExplanation, len(text)+len(near))
+	for i, res := range text {
+		// Documents the text doesn't score, every one for "*", aren't ranked by it.
+		if res.Score > 0 {
+			e := fused[res.ID]
+			e.TextRank = i + 1
+			fused[res.ID] = e
+		}
+	}
+	for i, res := range near {
+		e := fused[res.ID]
+		e.VectorRank, e.Similarity = i+1, res.Score
+		fused[res.ID] = e
+	}
+	r := make([]Result, 0, len(fused))
+	for id, e := range fused {
+		r = append(r, Result{ID: id, Score: e.score()})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Score != r[j].Score {
+			return r[i].Score > r[j].Score
+		}
+		return r[i].ID < r[j].ID
+	})
+	return r[:min(k, len(r))], fused, nil
+}
+
+func (e HybridExplanation) score() float64 {
+	var s float64
+	if e.TextRank > 0 {
+		s += 1 / float64(RRFRankConstant+e.TextRank)
+	}
+	if e.VectorRank > 0 {
+		s += 1 / float64(RRFRankConstant+e.VectorRank)
+	}
+	return s
+}
@@ -0,0 +1,62 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Languages of documents
+// A document's language picks the analyzer variant its fields are analyzed with,
+// and it's indexed as the keyword field LanguageField, so searches can filter on
+// it (language:de) and facets can count it. Documents that don't say can have it
+// detected from their title and text first, see analysis.DetectLanguage; a
+// language that's the analyzer's own, like English for the standard one, is
+// analyzed with the analyzer itself and doesn't need a variant at query time.
+const LanguageField = "language"
+
+// DetectLanguage returns doc with the language of its title and text, unless it
+// has a language already or none can be detected.
+func DetectLanguage(doc Document) Document {
+	if doc.Language == "" {
+		doc.Language = analysis.DetectLanguage(doc.Title + "\n" + doc.Text)
+	}
+	return doc
+}
+
+// DetectLanguages runs DetectLanguage on every document and returns the number
+// that got a language.
+func DetectLanguages(docs []Document) int {
+	n := 0
+	for i, doc := range docs {
+		if doc.Language != "" {
+			continue
+		}
+		if docs[i] = DetectLanguage(doc); docs[i].Language != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// language returns the language to analyze doc with, "" for the analyzer itself,
+// and records it.
+func (idx *Index) language(doc *Document) string {
+	lang := strings.ToLower(doc.Language)
+	if lang == "" {
+		return ""
+	}
+
+	keywords := make(map[string][]string, len(doc.Keywords)+1)
+	for field, values := range doc.Keywords {
+		keywords[field] = values
+	}
+	keywords[LanguageField] = []string{lang}
+	doc.Keywords = keywords
+
+	if lang == analysis.Language(idx.analyzer) {
+		return ""
+	}
+	idx.languages[lang] = struct{}{}
+	return lang
+}
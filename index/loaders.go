@@ -0,0 +1,402 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Other document formats
+// Besides the abstract dump, documents can come as JSON lines (one object per
+// line) or as CSV with a header row. FieldMapping says which property or column
+// holds each field of a Document; a field left empty falls back to its JSON name
+// (title, url, text, boost, id, language) and is simply missing if the data has no such
+// property or column. Without an ID mapping documents are numbered in load order
+// like the dump; a mapped ID has to be a non-negative integer, and callers that
+// look documents up by position (the server, the CLI) should leave it unmapped.
+// Keywords names the properties or columns to keep as keyword fields under their
+// own names; a JSON array gives a field several values. Numbers does the same for
+// numeric fields, whose values have to be numbers or dates (see ParseNumber), and
+// Geo for geo fields, "lat,lon" or a JSON object with lat and lon, and Vectors
+// for vector fields, JSON arrays of numbers or those numbers separated by commas
+// (see ParseVector); a vectors property is read like Document.Vectors. Nested names
+// JSON properties holding arrays of objects with a title and a text, kept as
+// nested documents under their names (CSV has none), and a nested property is
+// read like Document.Nested. The acl property or column is always kept, as the
+// keyword field ACLField.
+type FieldMapping struct {
+	Title    string
+	URL      string
+	Text     string
+	Boost    string
+	ID       string
+	Language string
+	Keywords []string
+	Numbers  []string
+	Geo      []string
+	Vectors  []string
+	Nested   []string
+}
+
+type Format int
+
+const (
+	FormatXML Format = iota
+	FormatJSONL
+	FormatCSV
+)
+
+// FormatOf guesses the format from the file extension, the dump being the default.
+// A compression extension (.gz, .bz2) is looked past.
+func FormatOf(path string) Format {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".gz" || ext == ".bz2" {
+		ext = strings.ToLower(filepath.Ext(strings.TrimSuffix(path, filepath.Ext(path))))
+	}
+
+	switch ext {
+	case ".jsonl", ".ndjson", ".json":
+		return FormatJSONL
+	case ".csv":
+		return FormatCSV
+	}
+	return FormatXML
+}
+
+// A Lenient loader skips bad records instead of stopping at the first one and
+// returns them as ParseErrors once it's through.
+type Loader struct {
+	Format  Format
+	Mapping FieldMapping
+	Lenient bool
+}
+
+func (m FieldMapping) withDefaults() FieldMapping {
+	or := func(name, def string) string {
+		if name == "" {
+			return def
+		}
+		return name
+	}
+	return FieldMapping{
+		Title:    or(m.Title, "title"),
+		URL:      or(m.URL, "url"),
+		Text:     or(m.Text, "text"),
+		Boost:    or(m.Boost, "boost"),
+		ID:       or(m.ID, "id"),
+		Language: or(m.Language, "language"),
+		Keywords: keywordsWithACL(m.Keywords),
+		Numbers:  m.Numbers,
+		Geo:      m.Geo,
+		Vectors:  m.Vectors,
+		Nested:   m.Nested,
+	}
+}
+
+func keywordsWithACL(keywords []string) []string {
+	if slices.Contains(keywords, ACLField) {
+		return keywords
+	}
+	return append(keywords[:len(keywords):len(keywords)], ACLField)
+}
+
+// Each hands every document in r to fn, like EachDocument does for the dump. r
+// must already be decompressed, see Decompress.
+func (l Loader) Each(r io.Reader, fn func(Document) error) error {
+	switch l.Format {
+	case FormatJSONL:
+		return eachJSONDocument(r, l.Mapping, l.Lenient, fn)
+	case FormatCSV:
+		return eachCSVDocument(r, l.Mapping, l.Lenient, fn)
+	}
+	return eachXMLDocument(r, l.Lenient, fn)
+}
+
+// Load reads all documents in path, decompressing it if it's gzip or bzip2. If
+// the loader is lenient and some records were bad, the documents come with a
+// ParseErrors.
+func (l Loader) Load(path string) ([]Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := Decompress(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []Document
+	err = l.Each(r, func(doc Document) error {
+		docs = append(docs, doc)
+		return nil
+	})
+	if _, ok := err.(ParseErrors); err != nil && !ok {
+		return nil, err
+	}
+	return docs, err
+}
+
+// newDocument fills a document from a lookup of raw values by property or column
+// name. n is the position of the document in the input.
+func newDocument(m FieldMapping, n int, value func(name string) (string, bool)) (Document, error) {
+	doc := Document{ID: n, Boost: DefaultBoost}
+	doc.Title, _ = value(m.Title)
+	doc.URL, _ = value(m.URL)
+	doc.Text, _ = value(m.Text)
+	doc.Language, _ = value(m.Language)
+
+	if v, ok := value(m.Boost); ok && v != "" {
+		boost, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return doc, fmt.Errorf("bad boost %q", v)
+		}
+		doc.Boost = boost
+	}
+	if v, ok := value(m.ID); ok {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 0 {
+			return doc, fmt.Errorf("bad id %q", v)
+		}
+		doc.ID = id
+	}
+
+	for _, name := range m.Keywords {
+		if v, ok := value(name); ok && v != "" {
+			if doc.Keywords == nil {
+				doc.Keywords = make(map[string][]string)
+			}
+			doc.Keywords[name] = []string{v}
+		}
+	}
+	for _, name := range m.Numbers {
+		if v, ok := value(name); ok && v != "" {
+			number, ok := ParseNumber(v)
+			if !ok {
+				return doc, fmt.Errorf("bad %s %q", name, v)
+			}
+			if doc.Numbers == nil {
+				doc.Numbers = make(map[string]float64)
+			}
+			doc.Numbers[name] = number
+		}
+	}
+	for _, name := range m.Geo {
+		if v, ok := value(name); ok && v != "" {
+			p, ok := ParseGeoPoint(v)
+			if !ok {
+				return doc, fmt.Errorf("bad %s %q", name, v)
+			}
+			if doc.Geo == nil {
+				doc.Geo = make(map[string]GeoPoint)
+			}
+			doc.Geo[name] = p
+		}
+	}
+	for _, name := range m.Vectors {
+		if v, ok := value(name); ok && v != "" {
+			vector, err := ParseVector(v)
+			if err != nil {
+				return doc, fmt.Errorf("bad %s: %s", name, err)
+			}
+			doc.Vectors = setVector(doc.Vectors, name, vector)
+		}
+	}
+	return doc, nil
+}
+
+func eachJSONDocument(r io.Reader, m FieldMapping, lenient bool, fn func(Document) error) error {
+	m = m.withDefaults()
+	bad := &badRecords{lenient: lenient}
+	br := bufio.NewReader(r)
+
+	for n, line := 0, 0; ; {
+		raw, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(raw) == 0 && err == io.EOF {
+			return bad.err()
+		}
+		line++
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+
+		var obj map[string]any
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&obj); err != nil {
+			if err := bad.add(line, string(raw), err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		doc, err := newDocument(m, n, func(name string) (string, bool) {
+			return jsonString(obj[name])
+		})
+		if err == nil {
+			err = jsonVectors(&doc, obj["vectors"])
+		}
+		if err != nil {
+			if err := bad.add(line, string(raw), err); err != nil {
+				return err
+			}
+			continue
+		}
+		n++
+		for _, name := range m.Keywords {
+			if list, ok := obj[name].([]any); ok {
+				delete(doc.Keywords, name)
+				for _, item := range list {
+					if v, ok := jsonString(item); ok {
+						if doc.Keywords == nil {
+							doc.Keywords = make(map[string][]string)
+						}
+						doc.Keywords[name] = append(doc.Keywords[name], v)
+					}
+				}
+			}
+		}
+		nested, _ := obj["nested"].(map[string]any)
+		for _, name := range m.Nested {
+			if nested == nil {
+				nested = make(map[string]any)
+			}
+			nested[name] = obj[name]
+		}
+		for name, v := range nested {
+			list, _ := v.([]any)
+			for _, item := range list {
+				if o, ok := item.(map[string]any); ok {
+					var n Nested
+					n.Title, _ = jsonString(o[FieldTitle])
+					n.Text, _ = jsonString(o[FieldText])
+					if doc.Nested == nil {
+						doc.Nested = make(map[string][]Nested)
+					}
+					doc.Nested[name] = append(doc.Nested[name], n)
+				}
+			}
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// jsonVectors reads a vectors property into doc.
+func jsonVectors(doc *Document, v any) error {
+	vectors, _ := v.(map[string]any)
+	for name, v := range vectors {
+		s, _ := jsonString(v)
+		vector, err := ParseVector(s)
+		if err != nil {
+			return fmt.Errorf("bad vector %s: %s", name, err)
+		}
+		doc.Vectors = setVector(doc.Vectors, name, vector)
+	}
+	return nil
+}
+
+func jsonString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case nil:
+		return "", false
+	default:
+		b, _ := json.Marshal(v)
+		return string(b), true
+	}
+}
+
+func eachCSVDocument(r io.Reader, m FieldMapping, lenient bool, fn func(Document) error) error {
+	bad := &badRecords{lenient: lenient}
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	// Columns named explicitly have to be there.
+	names := append([]string{m.Title, m.URL, m.Text, m.Boost, m.ID, m.Language}, m.Keywords...)
+	for _, name := range append(names, m.Numbers...) {
+		if _, ok := columns[name]; name != "" && !ok {
+			return fmt.Errorf("no column %q in csv header", name)
+		}
+	}
+	m = m.withDefaults()
+	if _, ok := columns[m.Text]; !ok {
+		if _, ok := columns[m.Title]; !ok {
+			return errors.New("csv has neither a text nor a title column")
+		}
+	}
+
+	for n := 0; ; {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return bad.err()
+		}
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			if err := bad.add(pe.StartLine, csvRecord(record), pe.Err); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		doc, err := newDocument(m, n, func(name string) (string, bool) {
+			if i, ok := columns[name]; ok {
+				return record[i], true
+			}
+			return "", false
+		})
+		if err != nil {
+			line, _ := cr.FieldPos(0)
+			if err := bad.add(line, csvRecord(record), err); err != nil {
+				return err
+			}
+			continue
+		}
+		n++
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// csvRecord writes the fields of a record back out as a line of CSV.
+func csvRecord(record []string) string {
+	if record == nil {
+		return ""
+	}
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(record)
+	w.Flush()
+	return b.String()
+}
@@ -0,0 +1,212 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Memory accounting
+// An in-memory index grows with every document until the process is killed for
+// it, so it can be given a ceiling with SetMemoryLimit. What it holds is measured
+// the way Stats does, split into the posting lists, the term dictionary and the
+// per-document field data (lengths, keyword, numeric and geo values, vectors,
+// titles, offsets), and between measurements every document added counts with an
+// estimate of what it added. The estimate is on the high side, so the index is
+// measured again once it says the limit is reached, and only that measurement
+// decides.
+//
+// CheckMemory is the admission check: ErrMemoryLimit if the index is at its limit.
+// AddStream and AddWithinLimit check before each document or round of them; an
+// index with a storage is flushed to it then (Commit frees the posting lists), any
+// other one stops with the error and keeps what was added before. A server
+// counts the documents its store keeps in memory against the limit as well
+// (CheckMemoryWith), and refuses changes with 503 Service Unavailable while the
+// two together are at it.
+var ErrMemoryLimit = errors.New("index memory limit reached")
+
+// MemoryUsage is the estimated heap size of an index by what holds it. Stored is
+// filled in by the server, for the documents its store keeps in memory.
+type MemoryUsage struct {
+	Postings   int `json:"postings"`
+	Dictionary int `json:"dictionary"`
+	Fields     int `json:"fields"`
+	Stored     int `json:"stored,omitempty"`
+}
+
+// Index is what the index itself holds, without Stored.
+func (m MemoryUsage) Index() int {
+	return m.Postings + m.Dictionary + m.Fields
+}
+
+// memoryCheckDocs is the round of documents AddWithinLimit adds between checks.
+const memoryCheckDocs = 1000
+
+// SetMemoryLimit caps the memory of the index at bytes, 0 for no limit.
+func (idx *Index) SetMemoryLimit(bytes int) {
+	idx.memLimit = bytes
+	if bytes > 0 {
+		idx.memUsed.Store(int64(idx.MemoryUsage().Index()))
+	}
+}
+
+func (idx *Index) MemoryLimit() int {
+	return idx.memLimit
+}
+
+// MemoryUsage measures the index.
+func (idx *Index) MemoryUsage() MemoryUsage {
+	return idx.memoryUsage(idx.Terms())
+}
+
+// CheckMemory returns an ErrMemoryLimit if the index has a memory limit and is at
+// it. It only reads the index.
+func (idx *Index) CheckMemory() error {
+	return idx.CheckMemoryWith(0)
+}
+
+// CheckMemoryWith is CheckMemory with extra bytes held for the index elsewhere,
+// like stored documents, counted against the limit too.
+func (idx *Index) CheckMemoryWith(extra int) error {
+	if idx.memLimit <= 0 || idx.memUsed.Load()+int64(extra) < int64(idx.memLimit) {
+		return nil
+	}
+	used := idx.MemoryUsage().Index()
+	idx.memUsed.Store(int64(used))
+	if used+extra < idx.memLimit {
+		return nil
+	}
+	return fmt.Errorf("%w: %d of %d bytes in use", ErrMemoryLimit, used+extra, idx.memLimit)
+}
+
+// makeRoom is CheckMemory, after flushing an index with a storage at its limit.
+func (idx *Index) makeRoom() error {
+	err := idx.CheckMemory()
+	if err != nil && idx.storage != nil {
+		if err := idx.Commit(); err != nil {
+			return err
+		}
+		err = idx.CheckMemory()
+	}
+	return err
+}
+
+// account adds an estimate of bytes added to the memory in use, if it's limited.
+func (idx *Index) account(bytes int) {
+	if idx.memLimit > 0 {
+		idx.memUsed.Add(int64(bytes))
+	}
+}
+
+// AddWithinLimit is AddConcurrentWithOptions a round of documents at a time,
+// checking the memory limit before each round like AddStream does. It returns the
+// number of documents added, all of docs unless there's an error, and of
+// duplicates.
+func (idx *Index) AddWithinLimit(docs []Document, workers int, opts Options) (added, dups int, err error) {
+	if err := idx.Writable(); err != nil {
+		return 0, 0, err
+	}
+	if opts.DedupBy != DedupNone && opts.Seen == nil {
+		opts.Seen = NewSeen(DefaultNearDistance)
+	}
+	p := newProgress(opts, len(docs))
+	opts.progress = p
+	for added < len(docs) {
+		if err = idx.makeRoom(); err != nil {
+			break
+		}
+		n := min(memoryCheckDocs, len(docs)-added)
+		d, _ := idx.AddConcurrentWithOptions(docs[added:added+n], workers, opts)
+		dups += d
+		added += n
+	}
+	if p != nil {
+		p.done()
+	}
+	return added, dups, err
+}
+
+// memoryUsage measures the index with the sorted terms terms.
+func (idx *Index) memoryUsage(terms []string) MemoryUsage {
+	var m MemoryUsage
+	for _, term := range terms {
+		m.Dictionary += len(term) + stringHeaderSize + mapEntryOverhead
+		if idx.disk == nil && idx.storage == nil {
+			p, _ := idx.lookup(term)
+			m.Postings += p.memory()
+		}
+	}
+	if idx.storage != nil {
+		// Only the lists changed since the last Commit and the warmed ones are in
+		// memory.
+		for _, p := range idx.terms {
+			m.Postings += p.memory()
+		}
+		for term, p := range idx.warmed {
+			if _, ok := idx.terms[term]; !ok {
+				m.Postings += p.memory()
+			}
+		}
+	}
+
+	perDoc := 2*intSize + mapEntryOverhead
+	m.Fields += (len(idx.docLen) + len(idx.boost) + len(idx.deleted)) * perDoc
+	for _, lens := range idx.fieldLen {
+		m.Fields += len(lens) * perDoc
+	}
+	for _, byDoc := range idx.keywords {
+		for _, values := range byDoc {
+			m.Fields += perDoc + sliceHeaderSize
+			for _, v := range values {
+				m.Fields += len(v) + stringHeaderSize
+			}
+		}
+	}
+	for _, byDoc := range idx.numbers {
+		// Counting the sorted copy too, which a range query builds.
+		m.Fields += len(byDoc) * (perDoc + 2*intSize)
+	}
+	for _, byDoc := range idx.geo {
+		// Two coordinates each, in the map and in the sorted copy with its cell.
+		m.Fields += len(byDoc) * (perDoc + 16 + 32)
+	}
+	for field, byDoc := range idx.vectors {
+		// The components, and the links of the graph if it's built.
+		m.Fields += len(byDoc) * (perDoc + sliceHeaderSize + 4*idx.vectorDims(field))
+	}
+	idx.vectorsMu.Lock()
+	for _, g := range idx.graphs {
+		m.Fields += len(g.ids) * (2*intSize + 3*hnswM*4)
+	}
+	idx.vectorsMu.Unlock()
+	for _, title := range idx.titles {
+		m.Fields += perDoc + len(title)
+	}
+	for _, byKey := range idx.offsets {
+		m.Fields += perDoc
+		for _, offsets := range byKey {
+			m.Fields += perDoc + sliceHeaderSize + len(offsets)*2*intSize
+		}
+	}
+	return m
+}
+
+// ParseBytes reads a size like 512MB, 2GiB or 1000000, in bytes. K, M, G and T
+// are powers of 1024 either way.
+func ParseBytes(s string) (int, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+	shift := 0
+	if t != "" {
+		if i := strings.IndexByte("KMGT", t[len(t)-1]); i >= 0 {
+			shift = 10 * (i + 1)
+			t = strings.TrimSpace(t[:len(t)-1])
+		}
+	}
+	n, err := strconv.ParseFloat(t, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int(n * float64(int64(1)<<shift)), nil
+}
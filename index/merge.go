@@ -0,0 +1,173 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+)
+
+var ErrAnalyzerMismatch = errors.New("indexes were analyzed differently")
+
+// Merging indexes
+// A dump too big to index on one machine can be split and its parts indexed on
+// several, or in parallel jobs. Merge puts the parts back together into a new
+// index: the documents of each part come after those of the one before, with
+// their IDs moved up by the part's base, so document id of part i is bases[i]+id
+// in the result. A part's base leaves room for every ID it used, deleted ones
+// included, and the documents stored beside it can be moved up by the same
+// base. Deleted documents are left out, as are the synonyms and scorer, which
+// aren't saved either.
+//
+// The parts have to be analyzed the same way, or their terms wouldn't meet the
+// same queries, so their analyzers must be equal; the result gets the first
+// one's. MergeIndexes does the same for index files written by Save, all of which
+// are read into memory.
+func Merge(parts ...*Index) (*Index, []int, error) {
+	if len(parts) == 0 {
+		return nil, nil, errors.New("nothing to merge")
+	}
+	for i, part := range parts[1:] {
+		if !reflect.DeepEqual(part.analyzer, parts[0].analyzer) {
+			return nil, nil, fmt.Errorf("index %d: %w", i+1, ErrAnalyzerMismatch)
+		}
+	}
+
+	idx := New(parts[0].analyzer)
+	idx.storeOffsets = parts[0].storeOffsets
+	idx.fieldGap = parts[0].fieldGap
+	idx.exactForms = parts[0].exactForms
+	idx.minTermFreq = maps.Clone(parts[0].minTermFreq)
+	bases := make([]int, len(parts))
+	base := 0
+	for i, part := range parts {
+		bases[i] = base
+		idx.mergePart(part, base)
+		base += part.idSpan()
+	}
+	idx.mergeTerms(parts, bases)
+	idx.prune()
+	return idx, bases, nil
+}
+
+// MergeIndexes merges the index files in into one, saved to out, and returns the
+// bases of the inputs' IDs.
+func MergeIndexes(out string, in ...string) ([]int, error) {
+	parts := make([]*Index, len(in))
+	for i, path := range in {
+		var err error
+		if parts[i], err = Load(path); err != nil {
+			return nil, err
+		}
+	}
+	idx, bases, err := Merge(parts...)
+	if err != nil {
+		return nil, err
+	}
+	return bases, idx.Save(out)
+}
+
+// idSpan is one more than the highest ID idx has used, 0 if it has none.
+func (idx *Index) idSpan() int {
+	n := 0
+	for id := range idx.docLen {
+		n = max(n, id+1)
+	}
+	for id := range idx.deleted {
+		n = max(n, id+1)
+	}
+	return n
+}
+
+// mergePart adds what idx keeps per document, but the postings, for the live
+// documents of part, moved up by base.
+func (idx *Index) mergePart(part *Index, base int) {
+	for field, boost := range part.fieldBoost {
+		idx.fieldBoost[field] = boost
+	}
+	for lang := range part.languages {
+		idx.languages[lang] = struct{}{}
+	}
+	for id, n := range part.docLen {
+		if _, gone := part.deleted[id]; gone {
+			continue
+		}
+		to := base + id
+		idx.addFieldLength(FieldText, to, n)
+		if boost, ok := part.boost[id]; ok {
+			idx.boost[to] = boost
+		}
+		if title, ok := part.titles[id]; ok {
+			idx.titles[to] = title
+		}
+		for field, lens := range part.fieldLen {
+			idx.addFieldLength(field, to, lens[id])
+		}
+		for field, byDoc := range part.keywords {
+			for _, value := range byDoc[id] {
+				idx.addKeyword(field, value, to)
+			}
+		}
+		for field, byDoc := range part.numbers {
+			if value, ok := byDoc[id]; ok {
+				idx.addNumber(field, value, to)
+			}
+		}
+		for field, byDoc := range part.geo {
+			if p, ok := byDoc[id]; ok {
+				idx.addGeoPoint(field, p, to)
+			}
+		}
+		for field, byDoc := range part.vectors {
+			if v, ok := byDoc[id]; ok {
+				idx.addVector(field, v, to)
+			}
+		}
+		if byKey, ok := part.offsets[id]; ok {
+			idx.offsets[to] = byKey
+		}
+	}
+}
+
+// mergeTerms joins the posting lists of parts. The bases go up, so each part's
+// entries follow those of the one before.
+func (idx *Index) mergeTerms(parts []*Index, bases []int) {
+	terms := make(map[string]struct{})
+	for _, part := range parts {
+		for _, term := range part.Terms() {
+			terms[term] = struct{}{}
+		}
+	}
+	for term := range terms {
+		var ids, freqs []int
+		var positions [][]int
+		withPositions := true
+		for i, part := range parts {
+			p, ok := part.lookup(term)
+			if !ok {
+				continue
+			}
+			pids, pfreqs, ppositions := p.entries()
+			withPositions = withPositions && ppositions != nil
+			for j, id := range pids {
+				if _, gone := part.deleted[id]; gone || !part.Has(id) {
+					continue
+				}
+				ids, freqs = append(ids, bases[i]+id), append(freqs, pfreqs[j])
+				if ppositions != nil {
+					positions = append(positions, ppositions[j])
+				} else {
+					positions = append(positions, nil)
+				}
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if !withPositions {
+			positions = nil
+		}
+		idx.terms[term] = newPostings(ids, freqs, positions)
+	}
+	idx.termsDirty = true
+}
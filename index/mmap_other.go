@@ -0,0 +1,15 @@
+//go:build !unix
+
+package index
+
+import "os"
+
+// Without mmap the file is simply read; the index still works, just not with
+// less memory.
+func mmapFile(path string) ([]byte, func() error, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
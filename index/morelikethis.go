@@ -0,0 +1,93 @@
+package index
+
+import (
+	"slices"
+	"sort"
+)
+
+// More like this
+// MoreLikeThis finds documents similar to one in the index: it picks the terms
+// that say the most about it, the ones weighing most by TF-IDF (how often they
+// occur in it times their BM25 IDF), and ranks the documents containing any of
+// them as if they had been searched for. Terms that occur in too few documents
+// can't find anything else and terms in too many say nothing, so both can be
+// cut off. The document itself is left out of the results.
+type MoreLikeThisOptions struct {
+	MaxTerms    int     // terms to query with, DefaultMoreLikeThisTerms if 0
+	MinTermFreq int     // times a term has to occur in the document
+	MinDocFreq  int     // documents a term has to be in, DefaultMinDocFreq if 0
+	MaxDocFreq  float64 // fraction of the documents a term may be in at most, 0 for any
+	Fields      []string
+	Filter      *Bitset // the documents to find among, all if nil
+
+	SearchOptions
+}
+
+const (
+	DefaultMoreLikeThisTerms = 25
+	DefaultMinDocFreq        = 2
+)
+
+// MoreLikeThis returns a page of the documents most like document id, from the
+// terms of opts.Fields (DefaultFields if empty), and the number of them.
+func (idx *Index) MoreLikeThis(id int, opts MoreLikeThisOptions) ([]Result, int, error) {
+	keys, err := idx.MoreLikeThisTerms(id, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ids []int
+	for _, key := range keys {
+		ids = Union(ids, idx.IDs(key))
+	}
+	if i, ok := slices.BinarySearch(ids, id); ok {
+		ids = slices.Delete(ids, i, i+1)
+	}
+	if opts.Filter != nil {
+		ids = opts.Filter.Filter(ids)
+	}
+	return idx.RankPage(ids, Scoring{Terms: keys}, opts.SearchOptions), len(ids), nil
+}
+
+// MoreLikeThisTerms returns the dictionary keys MoreLikeThis queries with for
+// document id, heaviest first.
+func (idx *Index) MoreLikeThisTerms(id int, opts MoreLikeThisOptions) ([]string, error) {
+	vector, err := idx.TermVector(id)
+	if err != nil {
+		return nil, err
+	}
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	maxTerms := opts.MaxTerms
+	if maxTerms <= 0 {
+		maxTerms = DefaultMoreLikeThisTerms
+	}
+	minDocs := opts.MinDocFreq
+	if minDocs <= 0 {
+		minDocs = DefaultMinDocFreq
+	}
+	maxDocs := idx.docCount()
+	if opts.MaxDocFreq > 0 {
+		maxDocs = int(opts.MaxDocFreq * float64(idx.docCount()))
+	}
+
+	type weighted struct {
+		key    string
+		weight float64
+	}
+	var terms []weighted
+	for _, e := range vector {
+		if !slices.Contains(fields, e.Field) || e.Freq < opts.MinTermFreq || e.Docs < minDocs || e.Docs > maxDocs {
+			continue
+		}
+		terms = append(terms, weighted{FieldKey(e.Field, e.Term), float64(e.Freq) * bm25IDF(e.Docs, idx.docCount())})
+	}
+	sort.SliceStable(terms, func(i, j int) bool { return terms[i].weight > terms[j].weight })
+
+	keys := make([]string, 0, min(len(terms), maxTerms))
+	for _, t := range terms[:min(len(terms), maxTerms)] {
+		keys = append(keys, t.key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,185 @@
+package index
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Nested documents
+// A document can hold lists of sub-objects with a title and a text of their own,
+// like the sections of an article, under a path: Nested["sections"]. They're
+// indexed into the document, in the fields path.title and path.text (see
+// NestedField), so sections.title:intro finds the articles with a section titled
+// so, and the hits are the articles. What a nested query (search.NestedQuery,
+// sections:(title:x AND text:y)) adds is matching within one of them: a section
+// whose title has x and whose text has y, not x in one and y in another.
+//
+// For that the positions of the i-th object start at i*NestedGap, which
+// Element turns back into i. Phrases and proximity never reach from one object
+// into the next that way, and an object longer than NestedGap tokens keeps only
+// its first ones.
+type Nested struct {
+	Title string `json:"title,omitempty"`
+	Text  string `json:"text,omitempty"`
+}
+
+const NestedGap = 1 << 16
+
+// NestedFields are the fields of a nested object, under its path.
+var NestedFields = []string{FieldTitle, FieldText}
+
+const nestedSep = "."
+
+// NestedField is the field of path indexing field of its objects.
+func NestedField(path, field string) string {
+	return path + nestedSep + field
+}
+
+// SplitNestedField is the inverse of NestedField, false for a field that isn't
+// nested.
+func SplitNestedField(name string) (path, field string, ok bool) {
+	i := strings.LastIndex(name, nestedSep)
+	if i <= 0 {
+		return "", "", false
+	}
+	path, field = name[:i], name[i+len(nestedSep):]
+	return path, field, field == FieldTitle || field == FieldText
+}
+
+// BaseField is the field a nested field indexes, field itself otherwise. Nested
+// fields are analyzed like it.
+func BaseField(field string) string {
+	if _, f, ok := SplitNestedField(field); ok {
+		return f
+	}
+	return field
+}
+
+// Element is the index of the nested object a position is in.
+func Element(pos int) int {
+	return pos / NestedGap
+}
+
+func nestedText(n Nested, field string) string {
+	if field == FieldTitle {
+		return n.Title
+	}
+	return n.Text
+}
+
+// addNested indexes the nested objects of doc, returning the number of tokens.
+func (b *batch) addNested(doc Document, lang string) int {
+	idx := b.idx
+	paths := make([]string, 0, len(doc.Nested))
+	for path := range doc.Nested {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	count := 0
+	for _, path := range paths {
+		for _, f := range NestedFields {
+			field := NestedField(path, f)
+			analyzer := analysis.ForLanguage(idx.FieldAnalyzer(f), lang)
+			positions := make(map[string][]int)
+			n := 0
+			for i, obj := range doc.Nested[path] {
+				tokens := analyzer.Analyze(nestedText(obj, f))
+				tokens = tokens[:min(len(tokens), NestedGap)]
+				for pos, token := range tokens {
+					key := FieldKey(field, token)
+					positions[key] = append(positions[key], i*NestedGap+pos)
+				}
+				n += len(tokens)
+			}
+			idx.addFieldLength(field, doc.ID, n)
+			count += n
+			for key, pos := range positions {
+				idx.addPosting(key, doc.ID, pos)
+			}
+		}
+	}
+	return count
+}
+
+// Positions returns the positions of a dictionary key in document id, nil if it
+// doesn't occur there.
+func (idx *Index) Positions(key string, id int) []int {
+	p, ok := idx.lookup(key)
+	if !ok || !p.hasPositions() {
+		return nil
+	}
+	c := p.cursor()
+	if !c.seek(id) {
+		return nil
+	}
+	return c.positions()
+}
+
+// Elements returns the nested objects of document id a key occurs in.
+func (idx *Index) Elements(key string, id int) []int {
+	return elements(idx.Positions(key, id))
+}
+
+// PhraseElements returns the nested objects of document id the keys occur in as
+// a phrase.
+func (idx *Index) PhraseElements(keys []string, id int) []int {
+	positions, ok := idx.positionsOf(keys, id)
+	if !ok {
+		return nil
+	}
+	var starts []int
+	for _, start := range positions[0] {
+		if phraseAt(append([][]int{{start}}, positions[1:]...)) {
+			starts = append(starts, start)
+		}
+	}
+	return elements(starts)
+}
+
+// ProximityElements returns the nested objects of document id the keys occur in
+// within slop of each other.
+func (idx *Index) ProximityElements(keys []string, slop, id int) []int {
+	positions, ok := idx.positionsOf(keys, id)
+	if !ok {
+		return nil
+	}
+	var r []int
+	for _, e := range elements(positions[0]) {
+		within := make([][]int, len(positions))
+		for i, p := range positions {
+			lo := sort.SearchInts(p, e*NestedGap)
+			hi := sort.SearchInts(p, (e+1)*NestedGap)
+			within[i] = p[lo:hi]
+		}
+		if windows(within, slop) > 0 {
+			r = append(r, e)
+		}
+	}
+	return r
+}
+
+// positionsOf returns the positions of every key in document id, false if one
+// doesn't occur there.
+func (idx *Index) positionsOf(keys []string, id int) ([][]int, bool) {
+	r := make([][]int, len(keys))
+	for i, key := range keys {
+		if r[i] = idx.Positions(key, id); r[i] == nil {
+			return nil, false
+		}
+	}
+	return r, len(keys) > 0
+}
+
+// elements maps sorted positions to their objects, without repeats.
+func elements(positions []int) []int {
+	var r []int
+	for _, pos := range positions {
+		if e := Element(pos); len(r) == 0 || r[len(r)-1] != e {
+			r = append(r, e)
+		}
+	}
+	return r
+}
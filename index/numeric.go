@@ -0,0 +1,154 @@
+package index
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Numeric fields and ranges
+// Numbers like a year or a view count (Document.Numbers) don't go into the term
+// dictionary: a range like year:[1990 TO 2000] would have to visit every term in
+// between. Instead we keep each field's values by document and, built lazily
+// after the field changed, all of its (value, ID) pairs sorted by value, so a
+// range is two binary searches and a copy. A document has at most one value per
+// field. Dates are numbers too, seconds since the Unix epoch, see ParseNumber.
+// Like keyword fields, ranges filter and don't score.
+type Range struct {
+	Min, Max               float64 // -Inf or +Inf for an open end
+	ExcludeMin, ExcludeMax bool
+}
+
+type numericEntry struct {
+	value float64
+	id    int
+}
+
+// The date layouts ParseNumber accepts, dates without a zone being UTC.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "2006-01"}
+
+// ParseNumber reads the value of a numeric field: a number, or a date that it
+// turns into seconds since the epoch.
+func ParseNumber(s string) (float64, bool) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(v) {
+		return v, true
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return float64(t.Unix()), true
+		}
+	}
+	return 0, false
+}
+
+func (idx *Index) addNumbers(doc Document) {
+	for field, value := range doc.Numbers {
+		if IsField(field) || math.IsNaN(value) {
+			continue
+		}
+		idx.addNumber(field, value, doc.ID)
+	}
+}
+
+func (idx *Index) addNumber(field string, value float64, id int) {
+	byDoc, ok := idx.numbers[field]
+	if !ok {
+		byDoc = make(map[int]float64)
+		idx.numbers[field] = byDoc
+	}
+	byDoc[id] = value
+
+	idx.numbersMu.Lock()
+	delete(idx.sortedNumbers, field)
+	idx.numbersMu.Unlock()
+}
+
+func (idx *Index) dropNumbers(id int) {
+	idx.numbersMu.Lock()
+	defer idx.numbersMu.Unlock()
+
+	for field, byDoc := range idx.numbers {
+		if _, ok := byDoc[id]; ok {
+			delete(byDoc, id)
+			delete(idx.sortedNumbers, field)
+		}
+	}
+}
+
+// NumericFields lists the numeric fields of the indexed documents, sorted.
+func (idx *Index) NumericFields() []string {
+	r := make([]string, 0, len(idx.numbers))
+	for field := range idx.numbers {
+		r = append(r, field)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (idx *Index) IsNumericField(field string) bool {
+	_, ok := idx.numbers[field]
+	return ok
+}
+
+// Number returns the value of a numeric field for document id.
+func (idx *Index) Number(field string, id int) (float64, bool) {
+	v, ok := idx.numbers[field][id]
+	return v, ok
+}
+
+// RangeIDs returns the living documents whose value of field falls into r, in
+// ascending order.
+func (idx *Index) RangeIDs(field string, r Range) []int {
+	entries := idx.sortedField(field)
+
+	lo := sort.Search(len(entries), func(i int) bool {
+		if r.ExcludeMin {
+			return entries[i].value > r.Min
+		}
+		return entries[i].value >= r.Min
+	})
+	hi := sort.Search(len(entries), func(i int) bool {
+		if r.ExcludeMax {
+			return entries[i].value >= r.Max
+		}
+		return entries[i].value > r.Max
+	})
+	if lo >= hi {
+		return nil
+	}
+
+	ids := make([]int, 0, hi-lo)
+	for _, e := range entries[lo:hi] {
+		ids = append(ids, e.id)
+	}
+	sort.Ints(ids)
+	return idx.live(ids)
+}
+
+func (idx *Index) sortedField(field string) []numericEntry {
+	idx.numbersMu.Lock()
+	defer idx.numbersMu.Unlock()
+
+	if entries, ok := idx.sortedNumbers[field]; ok {
+		return entries
+	}
+
+	byDoc := idx.numbers[field]
+	entries := make([]numericEntry, 0, len(byDoc))
+	for id, value := range byDoc {
+		entries = append(entries, numericEntry{value, id})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].value != entries[j].value {
+			return entries[i].value < entries[j].value
+		}
+		return entries[i].id < entries[j].id
+	})
+
+	if idx.sortedNumbers == nil {
+		idx.sortedNumbers = make(map[string][]numericEntry)
+	}
+	idx.sortedNumbers[field] = entries
+	return entries
+}
@@ -0,0 +1,71 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Term offsets
+// To mark the matching words of a hit, search.Highlighter runs every word of its
+// text through the analyzer again, which for a long document can take longer
+// than the search did. With SetStoreOffsets on, indexing does that once instead:
+// for each document added from then on it records where in the text and the
+// title the words of every term are, and Offsets hands them to the highlighter
+// (HighlightOffsets, SnippetOffsets), which then only has to find the word
+// boundaries. That's a second pass of analysis at index time and about as much
+// memory again as the positions take. The offsets are saved with the index, but
+// ExportPortable leaves them out.
+type TermOffset struct {
+	Term string
+	analysis.Offset
+}
+
+// The fields highlighted.
+var offsetFields = []string{FieldText, FieldTitle}
+
+// SetStoreOffsets turns recording term offsets for the documents added from now
+// on on or off. Documents indexed before keep theirs, or go without.
+func (idx *Index) SetStoreOffsets(on bool) {
+	idx.storeOffsets = on
+}
+
+func (idx *Index) StoresOffsets() bool {
+	return idx.storeOffsets
+}
+
+// Offsets returns where the words of document id matching terms are in field, by
+// where they start, and false if the document has no offsets stored.
+func (idx *Index) Offsets(id int, field string, terms []string) ([]TermOffset, bool) {
+	byKey, ok := idx.offsets[id]
+	if !ok {
+		return nil, false
+	}
+	var r []TermOffset
+	for _, term := range terms {
+		for _, o := range byKey[FieldKey(field, term)] {
+			r = append(r, TermOffset{term, o})
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool { return r[i].Start < r[j].Start })
+	return r, true
+}
+
+// addOffsets analyzes the words of doc one at a time, the way the highlighter
+// would, and records where each term came from.
+func (idx *Index) addOffsets(doc Document, lang string) {
+	byKey := make(map[string][]analysis.Offset)
+	for _, field := range offsetFields {
+		a := analysis.ForLanguage(idx.FieldAnalyzer(field), lang)
+		text := documentField(doc, field)
+		for _, w := range analysis.WordOffsets(text) {
+			for _, token := range a.Analyze(text[w.Start:w.End]) {
+				key := FieldKey(field, token)
+				if l := byKey[key]; len(l) == 0 || l[len(l)-1] != w {
+					byKey[key] = append(l, w)
+				}
+			}
+		}
+	}
+	idx.offsets[doc.ID] = byKey
+}
@@ -0,0 +1,71 @@
+package index
+
+import (
+	"context"
+	"sort"
+)
+
+// Partial results
+// SearchContext only gives up while ranking, so a query whose terms are in
+// millions of documents still takes as long as intersecting them does. With
+// SearchOptions.ReturnPartialOnTimeout SearchPage intersects them a document at
+// a time, in ID order, checking ctx every checkEvery candidates. If it's done
+// the matches found by then are all those below some ID, so they're the right
+// hits of part of the index: they're ranked, without a deadline, as there
+// aren't many of them, and come back with TimedOut set instead of an error.
+type SearchPage struct {
+	Results  []Result
+	Total    int  // of the matches found
+	TimedOut bool // ctx was done before all the matches were found and ranked
+}
+
+// SearchPage is SearchContext returning what's been found and TimedOut, not an
+// error, once ctx is done if opts.ReturnPartialOnTimeout.
+func (idx *Index) SearchPage(ctx context.Context, text string, opts SearchOptions) (SearchPage, error) {
+	if !opts.ReturnPartialOnTimeout {
+		r, total, err := idx.SearchContext(ctx, text, opts)
+		if err != nil {
+			return SearchPage{}, err
+		}
+		return SearchPage{Results: r, Total: total}, nil
+	}
+
+	ids, s, err := idx.matchContext(ctx, text)
+	if err != nil {
+		return SearchPage{Results: idx.RankPage(ids, s, opts), Total: len(ids), TimedOut: true}, nil
+	}
+	r, err := idx.RankPageContext(ctx, ids, s, opts)
+	return SearchPage{Results: r, Total: len(ids), TimedOut: err != nil}, nil
+}
+
+// matchContext is match intersecting a candidate at a time. Once ctx is done it
+// returns the matches below the candidate it got to with ctx's error.
+func (idx *Index) matchContext(ctx context.Context, text string) ([]int, Scoring, error) {
+	lists, s := idx.matchLists(text)
+	if len(lists) == 0 {
+		return nil, s, nil
+	}
+
+	sort.SliceStable(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	at := make([]int, len(lists))
+	var r []int
+candidates:
+	for n, id := range lists[0] {
+		if n > 0 && n%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return r, s, err
+			}
+		}
+		for i, ids := range lists[1:] {
+			at[i+1] = advance(ids, at[i+1], id, skipLength(len(ids)))
+			if at[i+1] == len(ids) {
+				break candidates
+			}
+			if ids[at[i+1]] != id {
+				continue candidates
+			}
+		}
+		r = append(r, id)
+	}
+	return r, s, nil
+}
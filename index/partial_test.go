@@ -0,0 +1,76 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSearchPagePartial(t *testing.T) {
+	const n = 3 * checkEvery
+	docs := make([]Document, n)
+	for i := range docs {
+		docs[i] = Document{ID: i, Text: "a black cat"}
+		if i%2 == 1 {
+			docs[i].Text = "a black dog"
+		}
+	}
+	idx := New(nil)
+	if err := idx.Add(docs); err != nil {
+		t.Fatal(err)
+	}
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		partial  bool // ReturnPartialOnTimeout
+		query    string
+		err      bool
+		timedOut bool
+		total    int // -1 for fewer than all, but some
+	}{
+		{"in time", context.Background(), true, "black cat", false, false, n / 2},
+		{"timed out", expired, true, "black cat", false, true, -1},
+		{"timed out on one term", expired, true, "black", false, true, -1},
+		{"timed out without partial results", expired, false, "black cat", true, false, 0},
+		{"no matches", expired, true, "bird", false, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := idx.SearchPage(tt.ctx, tt.query, SearchOptions{Limit: 10, ReturnPartialOnTimeout: tt.partial})
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want an error: %v", err, tt.err)
+			}
+			if tt.err {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("err = %v, want the deadline's", err)
+				}
+				return
+			}
+			if page.TimedOut != tt.timedOut {
+				t.Errorf("TimedOut = %v, want %v", page.TimedOut, tt.timedOut)
+			}
+			if tt.total >= 0 && page.Total != tt.total {
+				t.Errorf("total %d, want %d", page.Total, tt.total)
+			}
+			if tt.total < 0 && (page.Total == 0 || page.Total >= len(idx.Search(tt.query))) {
+				t.Errorf("total %d, want some of the %d matches", page.Total, len(idx.Search(tt.query)))
+			}
+			if page.Total > 0 && len(page.Results) != 10 {
+				t.Errorf("%d results, want a page of 10", len(page.Results))
+			}
+			matches := make(map[int]bool)
+			for _, r := range idx.Search(tt.query) {
+				matches[r.ID] = true
+			}
+			for _, r := range page.Results {
+				if !matches[r.ID] {
+					t.Errorf("%d doesn't match %q", r.ID, tt.query)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Persisting the index
+// Building the index from the dump takes minutes, so we build it once and keep it
+// on disk as gob, between a header and a checksum (see checksum.go). Loading it
+// back is a single decode.
+type indexFile struct {
+	Analyzer *analysis.Standard // nil for custom analyzers, they can't be saved
+	Terms    map[string]*postings
+	DocLen   map[int]int
+	Boost    map[int]float64
+	TotalLen int
+	Deleted  map[int]struct{}
+
+	FieldLen   map[string]map[int]int
+	FieldTotal map[string]int
+	FieldBoost map[string]float64
+	Keywords   map[string]map[int][]string
+	Numbers    map[string]map[int]float64
+	Languages  map[string]struct{}
+	Titles     map[int]string
+	Geo        map[string]map[int]GeoPoint
+
+	Offsets      map[int]map[string][]analysis.Offset
+	StoreOffsets bool
+	FieldGap     int
+	ExactForms   bool
+	MinTermFreq  map[string]int
+
+	Vectors map[string]map[int][]float32
+}
+
+// file is what Save writes of idx, with terms as the posting lists; the other
+// formats keep those apart and pass nil.
+func (idx *Index) file(terms map[string]*postings) indexFile {
+	std, _ := idx.analyzer.(*analysis.Standard)
+	return indexFile{
+		Analyzer:     std,
+		Terms:        terms,
+		DocLen:       idx.docLen,
+		Boost:        idx.boost,
+		TotalLen:     idx.totalLen,
+		Deleted:      idx.deleted,
+		FieldLen:     idx.fieldLen,
+		FieldTotal:   idx.fieldTotal,
+		FieldBoost:   idx.fieldBoost,
+		Keywords:     idx.keywords,
+		Numbers:      idx.numbers,
+		Languages:    idx.languages,
+		Titles:       idx.titles,
+		Geo:          idx.geo,
+		Offsets:      idx.offsets,
+		StoreOffsets: idx.storeOffsets,
+		FieldGap:     idx.fieldGap,
+		ExactForms:   idx.exactForms,
+		MinTermFreq:  idx.minTermFreq,
+		Vectors:      idx.vectors,
+	}
+}
+
+func (idx *Index) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// An index opened from disk or kept in a storage is read into memory as a
+	// whole. The rare terms (see SetMinTermFreq) are left out.
+	terms := idx.terms
+	switch {
+	case idx.disk != nil || idx.storage != nil:
+		sorted := idx.Terms()
+		terms = make(map[string]*postings, len(sorted))
+		for _, term := range sorted {
+			if idx.pruning() && idx.rare(term) {
+				continue
+			}
+			p, _ := idx.lookup(term)
+			ids, freqs, positions := p.entries()
+			terms[term] = newPostings(ids, freqs, positions)
+		}
+	case idx.pruning():
+		terms = make(map[string]*postings, len(idx.terms))
+		for term, p := range idx.terms {
+			if !idx.rare(term) {
+				terms[term] = p
+			}
+		}
+	}
+
+	w := bufio.NewWriter(f)
+	w.Write(appendHeader(nil, indexMagic))
+	cw := &checksumWriter{w: w}
+	if err := gob.NewEncoder(cw).Encode(idx.file(terms)); err != nil {
+		return err
+	}
+	w.Write(binary.LittleEndian.AppendUint32(nil, cw.sum))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// On disk before it's renamed over an older one, see server.Checkpoint.
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads an index written by Save, including the settings of the standard
+// analyzer it was built with. An index built with a custom analyzer has to be
+// loaded with LoadWithAnalyzer.
+func Load(path string) (*Index, error) {
+	return LoadWithAnalyzer(path, nil)
+}
+
+// LoadWithAnalyzer reads an index written by Save and analyzes with analyzer, or
+// the saved standard analyzer if analyzer is nil.
+func LoadWithAnalyzer(path string, analyzer analysis.Analyzer) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	header, _ := br.Peek(headerLen)
+	version, err := headerVersion(header, indexMagic)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var file indexFile
+	if version == 0 {
+		if err := gob.NewDecoder(br).Decode(&file); err != nil {
+			return nil, err
+		}
+	} else {
+		br.Discard(headerLen)
+		cr := &checksumReader{r: br}
+		if err := gob.NewDecoder(cr).Decode(&file); err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", path, ErrCorrupt, err)
+		}
+		var sum [4]byte
+		if _, err := io.ReadFull(br, sum[:]); err != nil || binary.LittleEndian.Uint32(sum[:]) != cr.sum {
+			return nil, fmt.Errorf("%s: %w: checksum mismatch", path, ErrCorrupt)
+		}
+	}
+
+	if analyzer == nil && file.Analyzer != nil {
+		analyzer = file.Analyzer
+	}
+
+	idx := New(analyzer)
+	if file.Terms != nil {
+		idx.terms = file.Terms
+		// Files from before posting lists were packed have everything in the tail.
+		for term, p := range idx.terms {
+			if len(p.Blocks) == 0 && len(p.IDs) > blockSize {
+				ids, freqs, positions := p.entries()
+				idx.terms[term] = newPostings(ids, freqs, positions)
+			}
+		}
+	}
+	idx.restore(file)
+	return idx, nil
+}
+
+// restore takes over everything but the terms from a decoded file.
+func (idx *Index) restore(file indexFile) {
+	idx.totalLen = file.TotalLen
+	if file.DocLen != nil {
+		idx.docLen = file.DocLen
+	}
+	if file.Boost != nil {
+		idx.boost = file.Boost
+	}
+	if file.Deleted != nil {
+		idx.deleted = file.Deleted
+	}
+	if file.FieldLen != nil {
+		idx.fieldLen = file.FieldLen
+	}
+	if file.FieldTotal != nil {
+		idx.fieldTotal = file.FieldTotal
+	}
+	if file.FieldBoost != nil {
+		idx.fieldBoost = file.FieldBoost
+	}
+	if file.Keywords != nil {
+		idx.keywords = file.Keywords
+	}
+	if file.Numbers != nil {
+		idx.numbers = file.Numbers
+	}
+	if file.Languages != nil {
+		idx.languages = file.Languages
+	}
+	if file.Titles != nil {
+		idx.titles = file.Titles
+	}
+	if file.Geo != nil {
+		idx.geo = file.Geo
+	}
+	if file.Offsets != nil {
+		idx.offsets = file.Offsets
+	}
+	if file.Vectors != nil {
+		idx.vectors = file.Vectors
+	}
+	idx.storeOffsets = file.StoreOffsets
+	idx.fieldGap = file.FieldGap
+	idx.exactForms = file.ExactForms
+	idx.minTermFreq = file.MinTermFreq
+}
@@ -0,0 +1,74 @@
+package index
+
+import "sort"
+
+// Phrase matching
+// A document matches a phrase when, for some start position p, the i-th phrase
+// term occurs at position p+i. We intersect the documents first and only look at
+// positions for the survivors.
+func (idx *Index) PhraseMatches(tokens []string) []int {
+	lists := make([]*postings, len(tokens))
+	for i, token := range tokens {
+		// Postings without positions (e.g. read back from a CSV export) can't
+		// answer a phrase query.
+		p, ok := idx.lookup(token)
+		if !ok || !p.hasPositions() {
+			return nil
+		}
+		lists[i] = p
+	}
+
+	cursors := make([]*postingCursor, len(lists))
+	for i, p := range lists {
+		cursors[i] = p.cursor()
+	}
+
+	var r []int
+	positions := make([][]int, len(lists))
+next:
+	for _, id := range idx.live(lists[0].ids()) {
+		for i, c := range cursors {
+			if !c.seek(id) {
+				continue next
+			}
+			positions[i] = c.positions()
+		}
+		if phraseAt(positions) {
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// FieldPhraseMatches matches analyzed tokens as a phrase in field, or in any of
+// the default fields if field is "". Fields keep their own positions, so a phrase
+// never runs from the end of a title into the abstract.
+func (idx *Index) FieldPhraseMatches(field string, tokens []string) []int {
+	var r []int
+	for _, f := range searchFields(field) {
+		keys := make([]string, len(tokens))
+		for i, token := range tokens {
+			keys[i] = FieldKey(f, token)
+		}
+		r = Union(r, idx.PhraseMatches(keys))
+	}
+	return r
+}
+
+// positions[i] holds the sorted positions of the i-th phrase term in one document.
+func phraseAt(positions [][]int) bool {
+	for _, start := range positions[0] {
+		found := true
+		for i := 1; i < len(positions); i++ {
+			j := sort.SearchInts(positions[i], start+i)
+			if j == len(positions[i]) || positions[i][j] != start+i {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
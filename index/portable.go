@@ -0,0 +1,782 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Portable format
+// Save writes whatever the index looks like inside, so a file only loads into a
+// program with the same internals, and ExportCSV leaves out positions and
+// documents. ExportPortable writes the index and its
+// stored documents as length-prefixed protobuf records instead, as described in
+// portable.proto: the analyzer settings, every document with its field lengths,
+// keywords, numbers and points, and every term with its postings and positions. The
+// format is versioned and extended only by adding fields, so a file written
+// today can be read by later versions, however the index changes, and by
+// anything else that speaks protobuf.
+//
+// ImportPortable builds the same index again. The documents go into a store as
+// well, if one is given, under their old IDs; deleted documents stay gaps.
+const portableVersion = 1
+
+var portableMagic = []byte("ftsx")
+
+// A DocumentStore holds the documents behind an index; store.Store is one.
+type DocumentStore interface {
+	Len() int
+	Get(id int) (Document, error)
+	Put(doc Document) error
+	Delete(id int) error
+}
+
+// Record and message field numbers, see portable.proto.
+const (
+	recordHeader   protowire.Number = 1
+	recordDocument protowire.Number = 2
+	recordTerm     protowire.Number = 3
+)
+
+// ExportPortable writes idx and the documents of docs, which may be nil, to w.
+func (idx *Index) ExportPortable(w io.Writer, docs DocumentStore) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(portableMagic); err != nil {
+		return err
+	}
+	record := func(num protowire.Number, msg []byte) error {
+		rec := protowire.AppendBytes(protowire.AppendTag(nil, num, protowire.BytesType), msg)
+		if _, err := bw.Write(binary.AppendUvarint(nil, uint64(len(rec)))); err != nil {
+			return err
+		}
+		_, err := bw.Write(rec)
+		return err
+	}
+
+	n := 0
+	for id := range idx.docLen {
+		n = max(n, id+1)
+	}
+	if docs != nil {
+		n = max(n, docs.Len())
+	}
+	if err := record(recordHeader, idx.portableHeader(n)); err != nil {
+		return err
+	}
+
+	for id := 0; id < n; id++ {
+		indexed := idx.Has(id)
+		doc := Document{ID: id}
+		if docs != nil {
+			var err error
+			if doc, err = docs.Get(id); err != nil {
+				if indexed {
+					return fmt.Errorf("document %d: %w", id, err)
+				}
+				continue
+			}
+		} else if !indexed {
+			continue
+		}
+		if err := record(recordDocument, idx.portableDocument(doc, indexed)); err != nil {
+			return err
+		}
+	}
+
+	terms := slices.Clone(idx.Terms())
+	sort.Slice(terms, func(i, j int) bool {
+		fi, ti := SplitKey(terms[i])
+		fj, tj := SplitKey(terms[j])
+		if fi != fj {
+			return fi < fj
+		}
+		return ti < tj
+	})
+	for _, key := range terms {
+		p, _ := idx.lookup(key)
+		ids, freqs, positions := p.entries()
+		if len(idx.deleted) > 0 {
+			ids, freqs, positions = filterEntries(ids, freqs, positions, idx.deleted)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		field, term := SplitKey(key)
+		if err := record(recordTerm, portableTerm(field, term, ids, freqs, positions)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (idx *Index) portableHeader(nextID int) []byte {
+	b := protowire.AppendTag(nil, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, portableVersion)
+	if std, ok := idx.analyzer.(*analysis.Standard); ok {
+		b = appendMessage(b, 2, portableAnalyzer(std))
+	}
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(nextID))
+	for field, boost := range idx.fieldBoost {
+		b = appendMessage(b, 4, appendFloatEntry(nil, field, boost))
+	}
+	return b
+}
+
+func portableAnalyzer(a *analysis.Standard) []byte {
+	var b []byte
+	b = appendBool(b, 1, a.KeepEmailsAndURLs)
+	b = appendBool(b, 2, a.EmailURLParts)
+	if a.Segmentation != 0 {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(a.Segmentation))
+	}
+	b = appendBool(b, 4, a.SplitScriptBoundaries)
+	words := make([]string, 0, len(a.Stopwords))
+	for w := range a.Stopwords {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	for _, w := range words {
+		b = appendString(b, 5, w)
+	}
+	b = appendBool(b, 6, a.Stopwords != nil)
+	b = appendBool(b, 7, a.NoStopwords)
+	b = appendString(b, 8, a.Language)
+	b = appendString(b, 9, a.Stemmer)
+	for _, f := range a.Filters {
+		b = appendString(b, 10, f)
+	}
+	for _, f := range a.CharFilters {
+		b = appendString(b, 11, f)
+	}
+	b = appendInt(b, 12, a.MinTokenLength)
+	b = appendInt(b, 13, a.MaxTokenLength)
+	b = appendString(b, 14, a.DropPattern)
+	if d := a.Decompound; d != nil {
+		var m []byte
+		for _, w := range sortedKeys(d.Words) {
+			m = appendString(m, 1, w)
+		}
+		m = appendInt(m, 2, d.MinWordSize)
+		m = appendInt(m, 3, d.MinSubwordSize)
+		m = appendInt(m, 4, d.MaxSubwordSize)
+		m = appendBool(m, 5, d.OnlyLongestMatch)
+		b = appendMessage(b, 15, m)
+	}
+	b = appendString(b, 16, a.Normalization)
+	b = appendBool(b, 17, a.FoldAccents)
+	for _, k := range a.Keywords {
+		b = appendString(b, 18, k)
+	}
+	return b
+}
+
+// portableDocument encodes doc with what the index has on it if it's indexed:
+// its field lengths, boost, keywords, numbers, points and vectors.
+func (idx *Index) portableDocument(doc Document, indexed bool) []byte {
+	keywords, numbers, geo, vectors, boost := doc.Keywords, doc.Numbers, doc.Geo, doc.Vectors, doc.Boost
+	if indexed {
+		keywords, numbers, geo, vectors, boost = nil, nil, nil, nil, DefaultBoost
+		for field, byDoc := range idx.keywords {
+			if values, ok := byDoc[doc.ID]; ok {
+				keywords = setKeywords(keywords, field, values)
+			}
+		}
+		for field, byDoc := range idx.numbers {
+			if v, ok := byDoc[doc.ID]; ok {
+				numbers = setNumber(numbers, field, v)
+			}
+		}
+		for field, byDoc := range idx.geo {
+			if p, ok := byDoc[doc.ID]; ok {
+				geo = setGeo(geo, field, p)
+			}
+		}
+		for field, byDoc := range idx.vectors {
+			if v, ok := byDoc[doc.ID]; ok {
+				vectors = setVector(vectors, field, v)
+			}
+		}
+		if b, ok := idx.boost[doc.ID]; ok {
+			boost = b
+		}
+	}
+
+	b := protowire.AppendTag(nil, 1, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(doc.ID))
+	b = appendString(b, 2, doc.Title)
+	b = appendString(b, 3, doc.URL)
+	b = appendString(b, 4, doc.Text)
+	if boost != 0 {
+		b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(boost))
+	}
+	for _, field := range sortedKeys(keywords) {
+		var values []byte
+		for _, v := range keywords[field] {
+			values = appendString(values, 1, v)
+		}
+		b = appendMessage(b, 6, appendMessage(appendString(nil, 1, field), 2, values))
+	}
+	for _, field := range sortedKeys(numbers) {
+		b = appendMessage(b, 7, appendFloatEntry(nil, field, numbers[field]))
+	}
+	b = appendString(b, 8, doc.Language)
+	if indexed {
+		lengths := map[string]int{FieldText: idx.docLen[doc.ID]}
+		for field, lens := range idx.fieldLen {
+			if n, ok := lens[doc.ID]; ok {
+				lengths[field] = n
+			}
+		}
+		for _, field := range sortedKeys(lengths) {
+			entry := appendString(nil, 1, field)
+			entry = protowire.AppendTag(entry, 2, protowire.VarintType)
+			entry = protowire.AppendVarint(entry, uint64(lengths[field]))
+			b = appendMessage(b, 9, entry)
+		}
+	}
+	b = appendBool(b, 10, indexed)
+	for _, field := range sortedKeys(geo) {
+		point := protowire.AppendTag(nil, 1, protowire.Fixed64Type)
+		point = protowire.AppendFixed64(point, math.Float64bits(geo[field].Lat))
+		point = protowire.AppendTag(point, 2, protowire.Fixed64Type)
+		point = protowire.AppendFixed64(point, math.Float64bits(geo[field].Lon))
+		b = appendMessage(b, 11, appendMessage(appendString(nil, 1, field), 2, point))
+	}
+	for _, field := range sortedKeys(vectors) {
+		var packed []byte
+		for _, x := range vectors[field] {
+			packed = protowire.AppendFixed32(packed, math.Float32bits(x))
+		}
+		b = appendMessage(b, 12, appendMessage(appendString(nil, 1, field), 2, appendMessage(nil, 1, packed)))
+	}
+	return b
+}
+
+func portableTerm(field, term string, ids, freqs []int, positions [][]int) []byte {
+	b := appendString(nil, 1, field)
+	b = appendString(b, 2, term)
+
+	var packed []byte
+	prev := 0
+	for _, id := range ids {
+		packed = protowire.AppendVarint(packed, uint64(id-prev))
+		prev = id
+	}
+	b = appendMessage(b, 3, packed)
+
+	packed = packed[:0]
+	for _, f := range freqs {
+		packed = protowire.AppendVarint(packed, uint64(f))
+	}
+	b = appendMessage(b, 4, packed)
+
+	if positions != nil {
+		packed = packed[:0]
+		for _, ps := range positions {
+			prev := 0
+			for _, p := range ps {
+				packed = protowire.AppendVarint(packed, uint64(p-prev))
+				prev = p
+			}
+		}
+		b = appendMessage(b, 5, packed)
+	}
+	return b
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	return protowire.AppendBytes(protowire.AppendTag(b, num, protowire.BytesType), msg)
+}
+
+// appendString, appendBool and appendInt leave out the default values, like
+// protobuf does.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	return protowire.AppendString(protowire.AppendTag(b, num, protowire.BytesType), s)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	return protowire.AppendVarint(protowire.AppendTag(b, num, protowire.VarintType), 1)
+}
+
+func appendInt(b []byte, num protowire.Number, n int) []byte {
+	if n == 0 {
+		return b
+	}
+	return protowire.AppendVarint(protowire.AppendTag(b, num, protowire.VarintType), uint64(n))
+}
+
+func appendFloatEntry(b []byte, key string, v float64) []byte {
+	b = appendString(b, 1, key)
+	b = protowire.AppendTag(b, 2, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	r := make([]string, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+	sort.Strings(r)
+	return r
+}
+
+// Reading the portable format
+// A file whose analyzer was custom has to be imported with that analyzer;
+// without one it gets the default.
+
+// ImportPortable reads an index written by ExportPortable and puts its documents
+// into docs, if it isn't nil. It analyzes with analyzer, or the saved standard
+// analyzer if analyzer is nil.
+func ImportPortable(r io.Reader, analyzer analysis.Analyzer, docs DocumentStore) (*Index, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(portableMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != string(portableMagic) {
+		return nil, errors.New("not a portable index")
+	}
+
+	var idx *Index
+	nextID := 0
+	for n := 0; ; n++ {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rec := make([]byte, size)
+		if _, err := io.ReadFull(br, rec); err != nil {
+			return nil, fmt.Errorf("record %d: %w", n, err)
+		}
+
+		err = eachField(rec, func(num protowire.Number, _ protowire.Type, _ uint64, msg []byte) error {
+			switch {
+			case num == recordHeader && idx == nil:
+				var err error
+				idx, nextID, err = importHeader(msg, analyzer)
+				return err
+			case idx == nil:
+				return errors.New("no header")
+			case num == recordDocument:
+				return idx.importDocument(msg, docs)
+			case num == recordTerm:
+				return idx.importTerm(msg)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", n, err)
+		}
+	}
+	if idx == nil {
+		return nil, errors.New("no header")
+	}
+
+	// Deleted documents at the end still took their IDs.
+	if docs != nil && docs.Len() < nextID {
+		if err := docs.Put(Document{ID: nextID - 1}); err != nil {
+			return nil, err
+		}
+		if err := docs.Delete(nextID - 1); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+func importHeader(msg []byte, analyzer analysis.Analyzer) (*Index, int, error) {
+	var version uint64
+	var std *analysis.Standard
+	nextID := 0
+	boosts := make(map[string]float64)
+	err := eachField(msg, func(num protowire.Number, _ protowire.Type, x uint64, v []byte) error {
+		switch num {
+		case 1:
+			version = x
+		case 2:
+			var err error
+			std, err = importAnalyzer(v)
+			return err
+		case 3:
+			nextID = int(x)
+		case 4:
+			key, value, err := floatEntry(v)
+			boosts[key] = value
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if version > portableVersion {
+		return nil, 0, fmt.Errorf("portable format version %d is newer than this program's %d", version, portableVersion)
+	}
+
+	if analyzer == nil && std != nil {
+		analyzer = std
+	}
+	idx := New(analyzer)
+	for field, boost := range boosts {
+		idx.fieldBoost[field] = boost
+	}
+	return idx, nextID, nil
+}
+
+func importAnalyzer(msg []byte) (*analysis.Standard, error) {
+	a := &analysis.Standard{}
+	var stopwords []string
+	custom := false
+	err := eachField(msg, func(num protowire.Number, _ protowire.Type, x uint64, v []byte) error {
+		switch num {
+		case 1:
+			a.KeepEmailsAndURLs = x != 0
+		case 2:
+			a.EmailURLParts = x != 0
+		case 3:
+			a.Segmentation = analysis.Segmentation(x)
+		case 4:
+			a.SplitScriptBoundaries = x != 0
+		case 5:
+			stopwords = append(stopwords, string(v))
+		case 6:
+			custom = x != 0
+		case 7:
+			a.NoStopwords = x != 0
+		case 8:
+			a.Language = string(v)
+		case 9:
+			a.Stemmer = string(v)
+		case 10:
+			a.Filters = append(a.Filters, string(v))
+		case 11:
+			a.CharFilters = append(a.CharFilters, string(v))
+		case 12:
+			a.MinTokenLength = int(x)
+		case 13:
+			a.MaxTokenLength = int(x)
+		case 14:
+			a.DropPattern = string(v)
+		case 15:
+			d, err := importDecompounder(v)
+			if err != nil {
+				return err
+			}
+			a.Decompound = d
+		case 16:
+			a.Normalization = string(v)
+		case 17:
+			a.FoldAccents = x != 0
+		case 18:
+			a.Keywords = append(a.Keywords, string(v))
+		}
+		return nil
+	})
+	if custom {
+		a.Stopwords = analysis.NewStopwordSet(stopwords...)
+	}
+	return a, err
+}
+
+func importDecompounder(msg []byte) (*analysis.Decompounder, error) {
+	d := analysis.NewDecompounder()
+	err := eachField(msg, func(num protowire.Number, _ protowire.Type, x uint64, v []byte) error {
+		switch num {
+		case 1:
+			d.Words[string(v)] = struct{}{}
+		case 2:
+			d.MinWordSize = int(x)
+		case 3:
+			d.MinSubwordSize = int(x)
+		case 4:
+			d.MaxSubwordSize = int(x)
+		case 5:
+			d.OnlyLongestMatch = x != 0
+		}
+		return nil
+	})
+	return d, err
+}
+
+func (idx *Index) importDocument(msg []byte, docs DocumentStore) error {
+	var doc Document
+	lengths := make(map[string]int)
+	indexed := false
+	err := eachField(msg, func(num protowire.Number, _ protowire.Type, x uint64, v []byte) error {
+		switch num {
+		case 1:
+			doc.ID = int(x)
+		case 2:
+			doc.Title = string(v)
+		case 3:
+			doc.URL = string(v)
+		case 4:
+			doc.Text = string(v)
+		case 5:
+			doc.Boost = math.Float64frombits(x)
+		case 6:
+			var field string
+			var values []string
+			err := eachField(v, func(num protowire.Number, _ protowire.Type, _ uint64, v []byte) error {
+				switch num {
+				case 1:
+					field = string(v)
+				case 2:
+					return eachField(v, func(num protowire.Number, _ protowire.Type, _ uint64, v []byte) error {
+						if num == 1 {
+							values = append(values, string(v))
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			doc.Keywords = setKeywords(doc.Keywords, field, values)
+			return err
+		case 7:
+			field, value, err := floatEntry(v)
+			doc.Numbers = setNumber(doc.Numbers, field, value)
+			return err
+		case 8:
+			doc.Language = string(v)
+		case 9:
+			var field string
+			var n uint64
+			err := eachField(v, func(num protowire.Number, _ protowire.Type, x uint64, v []byte) error {
+				switch num {
+				case 1:
+					field = string(v)
+				case 2:
+					n = x
+				}
+				return nil
+			})
+			lengths[field] = int(n)
+			return err
+		case 10:
+			indexed = x != 0
+		case 11:
+			var field string
+			var p GeoPoint
+			err := eachField(v, func(num protowire.Number, _ protowire.Type, _ uint64, v []byte) error {
+				switch num {
+				case 1:
+					field = string(v)
+				case 2:
+					return eachField(v, func(num protowire.Number, _ protowire.Type, x uint64, _ []byte) error {
+						switch num {
+						case 1:
+							p.Lat = math.Float64frombits(x)
+						case 2:
+							p.Lon = math.Float64frombits(x)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			doc.Geo = setGeo(doc.Geo, field, p)
+			return err
+		case 12:
+			var field string
+			var vector []float32
+			err := eachField(v, func(num protowire.Number, _ protowire.Type, _ uint64, v []byte) error {
+				switch num {
+				case 1:
+					field = string(v)
+				case 2:
+					return eachField(v, func(num protowire.Number, typ protowire.Type, x uint64, v []byte) error {
+						if num != 1 {
+							return nil
+						}
+						if typ == protowire.Fixed32Type {
+							vector = append(vector, math.Float32frombits(uint32(x)))
+							return nil
+						}
+						for len(v) > 0 {
+							x, n := protowire.ConsumeFixed32(v)
+							if n < 0 {
+								return protowire.ParseError(n)
+							}
+							vector, v = append(vector, math.Float32frombits(x)), v[n:]
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+			doc.Vectors = setVector(doc.Vectors, field, vector)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("document: %w", err)
+	}
+
+	if indexed {
+		for field, n := range lengths {
+			idx.addFieldLength(field, doc.ID, n)
+		}
+		if _, ok := idx.docLen[doc.ID]; !ok {
+			idx.docLen[doc.ID] = 0
+		}
+		if doc.Boost != 0 && doc.Boost != DefaultBoost {
+			idx.boost[doc.ID] = doc.Boost
+		}
+		if doc.Title != "" {
+			idx.titles[doc.ID] = strings.ToLower(doc.Title)
+		}
+		for field, values := range doc.Keywords {
+			for _, v := range values {
+				idx.addKeyword(field, v, doc.ID)
+			}
+		}
+		for field, v := range doc.Numbers {
+			idx.addNumber(field, v, doc.ID)
+		}
+		for field, p := range doc.Geo {
+			idx.addGeoPoint(field, p, doc.ID)
+		}
+		idx.addVectors(doc)
+		if lang := strings.ToLower(doc.Language); lang != "" && lang != analysis.Language(idx.analyzer) {
+			idx.languages[lang] = struct{}{}
+		}
+	}
+	if docs == nil {
+		return nil
+	}
+	return docs.Put(doc)
+}
+
+func (idx *Index) importTerm(msg []byte) error {
+	var field, term string
+	var gaps, freqs, posGaps []int
+	err := eachField(msg, func(num protowire.Number, typ protowire.Type, x uint64, v []byte) error {
+		switch num {
+		case 1:
+			field = string(v)
+		case 2:
+			term = string(v)
+		case 3:
+			return appendVarints(&gaps, typ, x, v)
+		case 4:
+			return appendVarints(&freqs, typ, x, v)
+		case 5:
+			return appendVarints(&posGaps, typ, x, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("term %q: %w", term, err)
+	}
+	if len(gaps) != len(freqs) {
+		return fmt.Errorf("term %q: %d documents but %d frequencies", term, len(gaps), len(freqs))
+	}
+
+	ids := gaps
+	for i := 1; i < len(ids); i++ {
+		ids[i] += ids[i-1]
+	}
+	var positions [][]int
+	if len(posGaps) > 0 {
+		positions = make([][]int, len(ids))
+		for i, f := range freqs {
+			if f > len(posGaps) {
+				return fmt.Errorf("term %q: too few positions", term)
+			}
+			ps := posGaps[:f:f]
+			for j := 1; j < len(ps); j++ {
+				ps[j] += ps[j-1]
+			}
+			positions[i], posGaps = ps, posGaps[f:]
+		}
+	}
+	idx.terms[FieldKey(field, term)] = newPostings(ids, freqs, positions)
+	idx.termsDirty = true
+	return nil
+}
+
+// eachField calls fn with every field of a message: its varint or fixed value
+// as x or its bytes as v.
+func eachField(b []byte, fn func(num protowire.Number, typ protowire.Type, x uint64, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var x uint64
+		var v []byte
+		switch typ {
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			x, n = protowire.ConsumeFixed64(b)
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, typ, x, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendVarints adds a repeated integer field to dst, packed or not.
+func appendVarints(dst *[]int, typ protowire.Type, x uint64, v []byte) error {
+	if typ != protowire.BytesType {
+		*dst = append(*dst, int(x))
+		return nil
+	}
+	for len(v) > 0 {
+		x, n := protowire.ConsumeVarint(v)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		*dst = append(*dst, int(x))
+		v = v[n:]
+	}
+	return nil
+}
+
+func floatEntry(msg []byte) (string, float64, error) {
+	var key string
+	var value float64
+	err := eachField(msg, func(num protowire.Number, _ protowire.Type, x uint64, v []byte) error {
+		switch num {
+		case 1:
+			key = string(v)
+		case 2:
+			value = math.Float64frombits(x)
+		}
+		return nil
+	})
+	return key, value, err
+}
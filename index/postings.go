@@ -0,0 +1,183 @@
+package index
+
+import (
+	"math"
+	"sort"
+)
+
+// Operations on posting lists
+// All of them take and return document IDs in ascending order.
+
+// Intersection
+// A plain merge costs len(a)+len(b) steps even when one list is tiny and the other
+// holds half the corpus. So every skip-th entry of a list doubles as a skip
+// pointer, with skip about the square root of its length: while the entry a skip
+// ahead is still below the ID we are looking for, the whole block in between is
+// jumped over. The lists are slices, so the pointers are just index arithmetic and
+// nothing extra has to be stored.
+//
+// When one list is more than gallopRatio times longer than the other, even the
+// skips are too many: the short list is walked and each of its IDs looked up in
+// the long one by galloping, probing 1, 2, 4, ... entries ahead of the last match
+// and binary searching the last step, which costs the log of the distance instead
+// of its square root.
+func Intersection(a []int, b []int) []int {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a)*gallopRatio < len(b) {
+		return gallopIntersection(a, b)
+	}
+
+	// The result can never be longer than the shorter input.
+	r := make([]int, 0, len(a))
+
+	skipA, skipB := skipLength(len(a)), skipLength(len(b))
+	i := 0
+	j := 0
+
+	for i < len(a) && j < len(b) {
+		if a[i] < b[j] {
+			i = advance(a, i, b[j], skipA)
+		} else if b[j] < a[i] {
+			j = advance(b, j, a[i], skipB)
+		} else {
+			r = append(r, a[i])
+			i++
+			j++
+		}
+	}
+
+	return r
+}
+
+const gallopRatio = 32
+
+// gallopIntersection is Intersection for a short and much longer b.
+func gallopIntersection(a, b []int) []int {
+	r := make([]int, 0, len(a))
+	j := 0
+	for _, id := range a {
+		if j = gallop(b, j, id); j == len(b) {
+			break
+		}
+		if b[j] == id {
+			r = append(r, id)
+			j++
+		}
+	}
+	return r
+}
+
+// gallop returns the first position from i on of an entry of ids that is not
+// below target.
+func gallop(ids []int, i, target int) int {
+	step := 1
+	for i+step < len(ids) && ids[i+step] < target {
+		i += step
+		step *= 2
+	}
+	hi := min(i+step, len(ids))
+	return i + sort.SearchInts(ids[i:hi], target)
+}
+
+// IntersectAll intersects lists shortest first, the order that keeps every step
+// cheapest: the result shrinks to the shortest list at once, and an empty one ends
+// it. It doesn't change lists, and returns nil for none.
+func IntersectAll(lists [][]int) []int {
+	if len(lists) == 0 {
+		return nil
+	}
+	sorted := make([][]int, len(lists))
+	copy(sorted, lists)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) < len(sorted[j]) })
+	r := sorted[0]
+	for _, ids := range sorted[1:] {
+		if len(r) == 0 {
+			break
+		}
+		r = Intersection(r, ids)
+	}
+	return r
+}
+
+// Below this length skipping doesn't pay for the extra comparisons.
+const minSkipLength = 64
+
+func skipLength(n int) int {
+	if n < minSkipLength {
+		return 0
+	}
+	return int(math.Sqrt(float64(n)))
+}
+
+// advance moves i forward to the first entry of ids that is not below target,
+// following skip pointers as far as they go.
+func advance(ids []int, i, target, skip int) int {
+	if skip > 0 {
+		for i+skip < len(ids) && ids[i+skip] <= target {
+			i += skip
+		}
+	}
+	for i < len(ids) && ids[i] < target {
+		i++
+	}
+	return i
+}
+
+// Union
+func Union(a []int, b []int) []int {
+	r := make([]int, 0, max(len(a), len(b)))
+
+	i := 0
+	j := 0
+
+	for i < len(a) && j < len(b) {
+		if a[i] < b[j] {
+			r = append(r, a[i])
+			i++
+		} else if b[j] < a[i] {
+			r = append(r, b[j])
+			j++
+		} else {
+			r = append(r, a[i])
+			i++
+			j++
+		}
+	}
+
+	r = append(r, a[i:]...)
+	return append(r, b[j:]...)
+}
+
+// Difference returns the IDs in a that are not in b.
+func Difference(a []int, b []int) []int {
+	r := make([]int, 0, len(a))
+
+	skip := skipLength(len(b))
+	j := 0
+	for _, id := range a {
+		j = advance(b, j, id, skip)
+		if j < len(b) && b[j] == id {
+			continue
+		}
+		r = append(r, id)
+	}
+
+	return r
+}
+
+// AllIDs returns every indexed document ID in ascending order.
+func (idx *Index) AllIDs() []int {
+	r := make([]int, 0, len(idx.docLen))
+	for id := range idx.docLen {
+		r = append(r, id)
+	}
+	sort.Ints(r)
+	return r
+}
+
+// Len is the number of documents in the index, not counting deleted ones.
+func (idx *Index) Len() int {
+	return len(idx.docLen)
+}
@@ -0,0 +1,115 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// span is the IDs from lo up to hi, step apart.
+func span(lo, hi, step int) []int {
+	var r []int
+	for id := lo; id < hi; id += step {
+		r = append(r, id)
+	}
+	return r
+}
+
+func TestIntersection(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []int
+		want []int
+	}{
+		{"empty", nil, span(0, 100, 1), []int{}},
+		{"both empty", nil, nil, []int{}},
+		{"equal", span(0, 50, 1), span(0, 50, 1), span(0, 50, 1)},
+		{"disjoint", span(0, 100, 2), span(1, 100, 2), []int{}},
+		{"short lists", []int{1, 3, 5, 7}, []int{2, 3, 4, 7, 9}, []int{3, 7}},
+		{"long lists", span(0, 10000, 3), span(0, 10000, 7), span(0, 10000, 21)},
+		{"skewed", span(0, 100000, 1), []int{5, 5000, 99999, 200000}, []int{5, 5000, 99999}},
+		{"skewed, none shared", span(0, 100000, 2), []int{1, 3, 50001}, []int{}},
+		{"skewed, just under galloping", span(0, 31*40, 1), span(0, 31*40, 31), span(0, 31*40, 31)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, args := range [][2][]int{{tt.a, tt.b}, {tt.b, tt.a}} {
+				got := Intersection(args[0], args[1])
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("Intersection of %d and %d IDs = %d IDs, want %d", len(args[0]), len(args[1]), len(got), len(tt.want))
+				}
+				// The result is sized for the shorter list, never the longer.
+				if n := min(len(tt.a), len(tt.b)); cap(got) > n {
+					t.Errorf("capacity %d, more than the %d IDs of the shorter list", cap(got), n)
+				}
+			}
+			if n := testing.AllocsPerRun(10, func() { Intersection(tt.a, tt.b) }); n > 1 {
+				t.Errorf("%v allocations, want at most 1", n)
+			}
+		})
+	}
+}
+
+// BenchmarkIntersectionSkewed intersects a common term's list with a rare one's,
+// the usual AND query, reporting the bytes allocated for the result.
+func BenchmarkIntersectionSkewed(b *testing.B) {
+	long := span(0, 1000000, 1)
+	for _, n := range []int{10, 1000, 100000} {
+		short := span(0, 1000000, 1000000/n)
+		b.Run(fmt.Sprintf("short=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Intersection(long, short)
+			}
+		})
+	}
+}
+
+// BenchmarkIntersection runs Intersection, with its skip pointers, against a
+// plain merge of the lists: a long list against a short one, where skipping pays
+// off, and against long ones, where it mustn't cost anything.
+func BenchmarkIntersection(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	// n distinct random IDs below 2M, sorted
+	ids := func(n int) []int {
+		r := rng.Perm(2000000)[:n]
+		slices.Sort(r)
+		return r
+	}
+	long := ids(500000)
+	for _, n := range []int{100, 50000, 500000} {
+		other := ids(n)
+		for _, bm := range []struct {
+			name      string
+			intersect func(a, b []int) []int
+		}{
+			{"skip", Intersection},
+			{"merge", merge},
+		} {
+			b.Run(fmt.Sprintf("%dx%d/%s", len(long), n, bm.name), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					bm.intersect(long, other)
+				}
+			})
+		}
+	}
+}
+
+// merge intersects two sorted lists a posting at a time.
+func merge(a, b []int) []int {
+	var r []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case b[j] < a[i]:
+			j++
+		default:
+			r = append(r, a[i])
+			i++
+			j++
+		}
+	}
+	return r
+}
@@ -0,0 +1,125 @@
+package index
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Progress
+// Indexing the whole dump takes minutes with nothing to show for it until the
+// end. Options.Progress is called every ProgressEvery while a batch is indexed,
+// a second by default, and once more when it's done, with how far it got: the
+// documents and tokens indexed, and what they're out of if that's known, the
+// number of documents for AddWithOptions and AddConcurrentWithOptions and, for
+// AddStream, the bytes of the input read out of Options.Size. The callback runs
+// on an indexing goroutine, in turns, so it should be quick.
+type Progress struct {
+	Documents int
+	Tokens    int
+	Total     int   // documents to index, 0 if not known
+	Bytes     int64 // of the stream read so far
+	Size      int64 // of the whole stream, 0 if not known
+	Elapsed   time.Duration
+	Done      bool
+}
+
+const DefaultProgressEvery = time.Second
+
+// Rate is the number of documents indexed a second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Documents) / p.Elapsed.Seconds()
+}
+
+// Fraction is how much of the work is done, from 0 to 1, and false if that isn't
+// known.
+func (p Progress) Fraction() (float64, bool) {
+	switch {
+	case p.Done:
+		return 1, true
+	case p.Total > 0:
+		return min(float64(p.Documents)/float64(p.Total), 1), true
+	case p.Size > 0:
+		return min(float64(p.Bytes)/float64(p.Size), 1), true
+	}
+	return 0, false
+}
+
+// ETA is how much longer it should take at the rate so far, and false if that
+// isn't known yet.
+func (p Progress) ETA() (time.Duration, bool) {
+	f, ok := p.Fraction()
+	if !ok || f == 0 {
+		return 0, false
+	}
+	return time.Duration(float64(p.Elapsed) * (1 - f) / f), true
+}
+
+// progress counts for one batch, or for the parallel batches of
+// AddConcurrentWithOptions together.
+type progress struct {
+	fn    func(Progress)
+	every time.Duration
+	start time.Time
+	total int
+	size  int64
+	read  *countingReader // nil unless it's a stream
+
+	mu     sync.Mutex
+	docs   int
+	tokens int
+	last   time.Time
+}
+
+func newProgress(opts Options, total int) *progress {
+	if opts.Progress == nil {
+		return nil
+	}
+	every := opts.ProgressEvery
+	if every <= 0 {
+		every = DefaultProgressEvery
+	}
+	now := time.Now()
+	return &progress{fn: opts.Progress, every: every, start: now, total: total, size: opts.Size, last: now}
+}
+
+// add counts a document of so many tokens.
+func (p *progress) add(tokens int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.docs++
+	p.tokens += tokens
+	if now := time.Now(); now.Sub(p.last) >= p.every {
+		p.last = now
+		p.fn(p.report(now, false))
+	}
+}
+
+func (p *progress) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fn(p.report(time.Now(), true))
+}
+
+func (p *progress) report(now time.Time, done bool) Progress {
+	r := Progress{Documents: p.docs, Tokens: p.tokens, Total: p.total, Size: p.size, Elapsed: now.Sub(p.start), Done: done}
+	if p.read != nil {
+		r.Bytes = p.read.n.Load()
+	}
+	return r
+}
+
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,151 @@
+package index
+
+import (
+	"math"
+	"slices"
+)
+
+// Proximity
+// A proximity clause matches documents where its terms occur close together, in
+// any order: within a window of positions that holds every term and no more than
+// Slop other positions. With a slop of 0 the terms are next to each other, like a
+// phrase that doesn't care about order.
+//
+// Besides the BM25 of its terms, a clause adds to the score the closer the terms
+// are. Every window counts 1/(1+gap), gap being the other positions in it, and
+// that sum saturates like a term frequency and is weighted with the idf of the
+// terms together, so a tight match of rare terms counts most.
+type Proximity struct {
+	Keys []string // dictionary keys, all of one field
+	Slop int
+}
+
+// Scoring is what a query's hits are ranked with: the dictionary keys whose BM25
+// scores add up, the proximity clauses and the term groups on top. Query lists
+// the words of the query for the match boosts (see boosts.go); without it the
+// keys of Terms and Groups count as one word per term.
+type Scoring struct {
+	Terms     []string
+	Proximity []Proximity
+	Groups    []TermGroup
+	Query     []QueryTerm
+
+	decay  *Decay       // see SearchOptions.Decay
+	boosts *matchBoosts // see boosts.go
+}
+
+// A QueryTerm is a word of a query: the keys that match it, in every field and
+// with its synonyms, and those of its exact form (see ExactKeys).
+type QueryTerm struct {
+	Keys  []string
+	Exact []string
+}
+
+// FieldProximity returns the clauses for analyzed tokens in field, one per field
+// if field is "" for the default fields. Positions are per field, like phrases.
+func (idx *Index) FieldProximity(field string, tokens []string, slop int) []Proximity {
+	var r []Proximity
+	for _, f := range searchFields(field) {
+		keys := make([]string, 0, len(tokens))
+		for _, token := range tokens {
+			if key := FieldKey(f, token); !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+		r = append(r, Proximity{keys, slop})
+	}
+	return r
+}
+
+// ProximityMatches returns the living documents that match p.
+func (idx *Index) ProximityMatches(p Proximity) []int {
+	cursors := idx.proximityCursors(p.Keys)
+	if len(cursors) == 0 {
+		return nil
+	}
+
+	var r []int
+	positions := make([][]int, len(cursors))
+next:
+	for _, id := range idx.IDs(p.Keys[0]) {
+		for i, c := range cursors {
+			if !c.seek(id) {
+				continue next
+			}
+			positions[i] = c.positions()
+		}
+		if windows(positions, p.Slop) > 0 {
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// FieldProximityMatches is ProximityMatches over the clauses of FieldProximity.
+func (idx *Index) FieldProximityMatches(field string, tokens []string, slop int) []int {
+	var r []int
+	for _, p := range idx.FieldProximity(field, tokens, slop) {
+		r = Union(r, idx.ProximityMatches(p))
+	}
+	return r
+}
+
+// proximityCursors returns a cursor per key, or nil if a key is missing or has no
+// positions.
+func (idx *Index) proximityCursors(keys []string) []*postingCursor {
+	if len(keys) == 0 {
+		return nil
+	}
+	cursors := make([]*postingCursor, len(keys))
+	for i, key := range keys {
+		p, ok := idx.lookup(key)
+		if !ok || !p.hasPositions() {
+			return nil
+		}
+		cursors[i] = p.cursor()
+	}
+	return cursors
+}
+
+// proximityScorer scores p like a term: its weight is the field boost times the
+// idf of all its terms.
+func (idx *Index) proximityScorer(p Proximity, st collectionStats) *termCursor {
+	cursors := idx.proximityCursors(p.Keys)
+	if cursors == nil {
+		return nil
+	}
+
+	field, _ := SplitKey(p.Keys[0])
+	weight := 0.0
+	for _, key := range p.Keys {
+		weight += idf(st, key)
+	}
+	weight *= idx.FieldBoost(field)
+	return &termCursor{near: cursors, keys: p.Keys, slop: p.Slop, stats: TermStats{Field: field}, weight: weight, bound: weight * (bm25K1 + 1)}
+}
+
+// windows sums 1/(1+gap) over the windows that hold one position of every list
+// (all sorted) with a gap of at most slop. It walks the lists together, each time
+// moving past the lowest position, so every window ends up being the smallest one
+// starting there.
+func windows(positions [][]int, slop int) float64 {
+	at := make([]int, len(positions))
+	sum := 0.0
+	for {
+		lo, hi := 0, math.MinInt
+		for i, p := range positions {
+			if at[i] == len(p) {
+				return sum
+			}
+			if p[at[i]] < positions[lo][at[lo]] {
+				lo = i
+			}
+			hi = max(hi, p[at[i]])
+		}
+
+		if gap := hi - positions[lo][at[lo]] + 1 - len(positions); gap <= slop {
+			sum += 1 / float64(1+gap)
+		}
+		at[lo]++
+	}
+}
@@ -0,0 +1,66 @@
+package index
+
+import "strings"
+
+// Pruning rare terms
+// On noisy text most of the dictionary is typos, IDs and other words found in a
+// single document. SetMinTermFreq drops the terms found in fewer than n
+// documents, which shrinks the index a lot, but the price is recall: a pruned
+// term can't be searched for at all, so a typo and a rare name are treated the
+// same, and neither of the documents it was in can be found by it any more.
+//
+// A term is only rare once all of its documents are in, so the terms are pruned
+// by their document frequency in the whole index on Commit and in the result of
+// Merge, not batch by batch: a term in one document of each of two
+// AddWithinLimit rounds is kept. Save and SaveDisk leave the rare terms out of
+// the file but not out of the index, they only hold the read lock. The postings
+// pruned are gone for good, though, so a term that comes back after a Commit
+// counts its documents from there, which makes it a setting for indexing a dump
+// at once more than for an index kept up to date a document at a time.
+
+// SetMinTermFreq prunes the terms of field found in fewer than n documents from
+// now on, or every field without a threshold of its own if field is "". 0 or 1
+// keeps them all. The exact forms of a field, see SetExactForms, go with it.
+func (idx *Index) SetMinTermFreq(field string, n int) {
+	if idx.minTermFreq == nil {
+		idx.minTermFreq = make(map[string]int)
+	}
+	idx.minTermFreq[field] = max(n, 0)
+}
+
+// MinTermFreq is the threshold of field set with SetMinTermFreq, that of "" if
+// field has none of its own.
+func (idx *Index) MinTermFreq(field string) int {
+	if n, ok := idx.minTermFreq[field]; ok {
+		return n
+	}
+	return idx.minTermFreq[""]
+}
+
+// prune drops the rare terms among the posting lists in memory: all of them,
+// but for an index with a storage, whose lists in memory are those changed since
+// the last Commit, the rest having been pruned then.
+func (idx *Index) prune() {
+	if !idx.pruning() {
+		return
+	}
+	for key := range idx.terms {
+		if idx.rare(key) {
+			idx.drop(key)
+		}
+	}
+}
+
+// pruning reports whether idx has rare terms to prune at all.
+func (idx *Index) pruning() bool {
+	return len(idx.minTermFreq) > 0 && idx.Writable() == nil
+}
+
+// rare reports whether key is found in fewer documents than its field's
+// threshold.
+func (idx *Index) rare(key string) bool {
+	field, _ := SplitKey(key)
+	field = strings.TrimSuffix(field, exactSuffix)
+	n := idx.MinTermFreq(field)
+	return n > 1 && idx.docFreq(key) < n
+}
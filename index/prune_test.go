@@ -0,0 +1,89 @@
+package index
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMinTermFreq(t *testing.T) {
+	batches := [][]Document{
+		{{ID: 0, Title: "Zebra", Text: "a wild cat and a zebra"}},
+		{{ID: 1, Title: "Cat", Text: "a tame cat"}, {ID: 2, Title: "Dog", Text: "a dog"}},
+	}
+	tests := []struct {
+		name    string
+		min     map[string]int // thresholds by field
+		merge   bool           // each batch indexed apart and merged, instead of Commit
+		field   string
+		term    string
+		matches int
+	}{
+		{"off", nil, false, FieldText, "zebra", 1},
+		{"rare term pruned", map[string]int{"": 2}, false, FieldText, "zebra", 0},
+		{"term in two batches kept", map[string]int{"": 2}, false, FieldText, "cat", 2},
+		{"rare title pruned", map[string]int{"": 2}, false, FieldTitle, "zebra", 0},
+		{"field of its own", map[string]int{"": 2, FieldTitle: 1}, false, FieldTitle, "zebra", 1},
+		{"other fields still pruned", map[string]int{"": 2, FieldTitle: 1}, false, FieldText, "zebra", 0},
+		{"merged, rare term pruned", map[string]int{"": 2}, true, FieldText, "zebra", 0},
+		{"merged, term in two parts kept", map[string]int{"": 2}, true, FieldText, "cat", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := FieldKey(tt.field, tt.term)
+			newIndex := func() *Index {
+				idx := New(nil)
+				for field, n := range tt.min {
+					idx.SetMinTermFreq(field, n)
+				}
+				return idx
+			}
+			var idx *Index
+			if tt.merge {
+				parts := make([]*Index, len(batches))
+				for i, docs := range batches {
+					parts[i] = newIndex()
+					if _, err := parts[i].AddWithOptions(docs, Options{}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				var err error
+				if idx, _, err = Merge(parts...); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				idx = newIndex()
+				for _, docs := range batches {
+					if _, err := idx.AddWithOptions(docs, Options{}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if len(idx.IDs(key)) == 0 {
+					t.Fatalf("%s:%s matches nothing before the Commit", tt.field, tt.term)
+				}
+				if err := idx.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if n := len(idx.IDs(key)); n != tt.matches {
+				t.Errorf("%s:%s matches %d documents, want %d", tt.field, tt.term, n, tt.matches)
+			}
+
+			path := filepath.Join(t.TempDir(), "index.fts")
+			if err := idx.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			loaded, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for field, n := range tt.min {
+				if got := loaded.MinTermFreq(field); got != n {
+					t.Errorf("MinTermFreq(%q) = %d after Load, want %d", field, got, n)
+				}
+			}
+			if n := len(loaded.IDs(key)); n != tt.matches {
+				t.Errorf("%s:%s matches %d documents after Load, want %d", tt.field, tt.term, n, tt.matches)
+			}
+		})
+	}
+}
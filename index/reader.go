@@ -0,0 +1,171 @@
+package index
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// Point-in-time readers
+// The lock of a Shared index only keeps one call consistent. Paging through the
+// results of a query takes several, and a document added in between moves every
+// hit after it to the next page, so one shows up twice and another never. A
+// Reader sees the index as it was when it was opened, for as long as it's open,
+// without holding off changes: the first change after a reader is opened copies
+// the index and goes to the copy, and the readers keep the old one, which nothing
+// changes again. Changes while no reader is open copy nothing, and a copy is
+// dropped with its last reader.
+//
+// Copying takes as long as every posting list, so readers are for query
+// sequences, not for every single search. The lists of an index opened with
+// NewWithStorage are shared by the copies until a Commit rewrites them, so its
+// readers see what is committed after they were opened; indexes opened with
+// OpenDisk never change and are never copied.
+type Reader struct {
+	s       *Shared
+	idx     *Index
+	readers *sync.WaitGroup // of the Shared when it was opened
+	once    sync.Once
+}
+
+// Reader opens a point-in-time reader. It has to be closed.
+func (s *Shared) Reader() *Reader {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	s.pinMu.Lock()
+	s.pinned++
+	s.pinMu.Unlock()
+	s.readers.Add(1)
+	return &Reader{s: s, idx: s.idx, readers: s.readers}
+}
+
+// unpin is called with s.mu held by Write, so the index can't be copied while
+// readers are counted.
+func (s *Shared) unpin() {
+	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
+	if s.pinned > 0 && s.idx.disk == nil {
+		s.idx = s.idx.clone()
+	}
+	s.pinned = 0
+}
+
+// Index returns the index as of when the reader was opened. It may be searched
+// from any number of goroutines, but not changed.
+func (r *Reader) Index() *Index {
+	return r.idx
+}
+
+func (r *Reader) Search(text string) []Result {
+	return r.idx.Search(text)
+}
+
+func (r *Reader) SearchWithOptions(text string, opts SearchOptions) ([]Result, int) {
+	return r.idx.SearchWithOptions(text, opts)
+}
+
+func (r *Reader) SearchContext(ctx context.Context, text string, opts SearchOptions) ([]Result, int, error) {
+	return r.idx.SearchContext(ctx, text, opts)
+}
+
+// Close releases the reader; closing it again does nothing.
+func (r *Reader) Close() {
+	r.once.Do(func() {
+		s := r.s
+		s.pinMu.Lock()
+		defer s.pinMu.Unlock()
+		// Readers of an older copy aren't counted any more.
+		if r.idx == s.idx && s.pinned > 0 {
+			s.pinned--
+		}
+		r.readers.Done()
+	})
+}
+
+// clone copies everything a change could touch. The caches are rebuilt when
+// they're needed.
+func (idx *Index) clone() *Index {
+	c := &Index{
+		analyzer:     idx.analyzer,
+		synonyms:     idx.synonyms,
+		terms:        make(map[string]*postings, len(idx.terms)),
+		docLen:       maps.Clone(idx.docLen),
+		boost:        maps.Clone(idx.boost),
+		totalLen:     idx.totalLen,
+		fieldLen:     make(map[string]map[int]int, len(idx.fieldLen)),
+		fieldTotal:   maps.Clone(idx.fieldTotal),
+		fieldBoost:   maps.Clone(idx.fieldBoost),
+		keywords:     make(map[string]map[int][]string, len(idx.keywords)),
+		numbers:      make(map[string]map[int]float64, len(idx.numbers)),
+		geo:          make(map[string]map[int]GeoPoint, len(idx.geo)),
+		vectors:      make(map[string]map[int][]float32, len(idx.vectors)),
+		languages:    maps.Clone(idx.languages),
+		titles:       maps.Clone(idx.titles),
+		offsets:      maps.Clone(idx.offsets),
+		storeOffsets: idx.storeOffsets,
+		fieldGap:     idx.fieldGap,
+		exactForms:   idx.exactForms,
+		minTermFreq:  maps.Clone(idx.minTermFreq),
+		memLimit:     idx.memLimit,
+		scorer:       idx.scorer,
+		deleted:      maps.Clone(idx.deleted),
+		storage:      idx.storage,
+		storedTerms:  idx.storedTerms,
+		dropped:      maps.Clone(idx.dropped),
+		warmed:       make(map[string]*postings, len(idx.warmed)),
+		termsDirty:   true,
+	}
+	c.memUsed.Store(idx.memUsed.Load())
+	for term, p := range idx.terms {
+		c.terms[term] = p.clone()
+	}
+	for term, p := range idx.warmed {
+		c.warmed[term] = p.clone()
+	}
+	for field, lens := range idx.fieldLen {
+		c.fieldLen[field] = maps.Clone(lens)
+	}
+	for field, byDoc := range idx.keywords {
+		values := make(map[int][]string, len(byDoc))
+		for id, v := range byDoc {
+			values[id] = slices.Clone(v)
+		}
+		c.keywords[field] = values
+	}
+	for field, byDoc := range idx.numbers {
+		c.numbers[field] = maps.Clone(byDoc)
+	}
+	for field, byDoc := range idx.geo {
+		c.geo[field] = maps.Clone(byDoc)
+	}
+	// Vectors are never changed in place, and a graph is kept up to date rather
+	// than rebuilt, so it's copied too.
+	for field, byDoc := range idx.vectors {
+		c.vectors[field] = maps.Clone(byDoc)
+	}
+	idx.vectorsMu.Lock()
+	for field, g := range idx.graphs {
+		if c.graphs == nil {
+			c.graphs = make(map[string]*hnsw, len(idx.graphs))
+		}
+		c.graphs[field] = g.clone()
+	}
+	idx.vectorsMu.Unlock()
+	idx.storageMu.Lock()
+	c.storageErr = idx.storageErr
+	idx.storageMu.Unlock()
+	return c
+}
+
+// clone copies a list so adding to it leaves p alone. Packed block data is never
+// changed in place and positions are only ever replaced, so they're shared.
+func (p *postings) clone() *postings {
+	return &postings{
+		Blocks:    slices.Clone(p.Blocks),
+		IDs:       slices.Clone(p.IDs),
+		Freqs:     slices.Clone(p.Freqs),
+		Positions: slices.Clone(p.Positions),
+	}
+}
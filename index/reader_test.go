@@ -0,0 +1,34 @@
+package index
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReaderCopyKeepsMemoryLimit(t *testing.T) {
+	idx := New(nil)
+	idx.Add([]Document{{ID: 0, Text: "a wild cat"}})
+	idx.SetMemoryLimit(1) // already over it
+	s := NewShared(idx)
+
+	r := s.Reader()
+	defer r.Close()
+	if err := s.Add([]Document{{ID: 1, Text: "a tame cat"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, done := s.Read()
+	defer done()
+	if copied == r.Index() {
+		t.Fatal("changed the index of an open reader instead of a copy")
+	}
+	if got := copied.MemoryLimit(); got != 1 {
+		t.Errorf("MemoryLimit() = %d after a change with a reader open, want 1", got)
+	}
+	if err := copied.CheckMemory(); !errors.Is(err, ErrMemoryLimit) {
+		t.Errorf("CheckMemory() = %v on the copy, want %v", err, ErrMemoryLimit)
+	}
+	if n := len(r.Search("cat")); n != 1 {
+		t.Errorf("the reader finds %d documents, want the 1 there was when it was opened", n)
+	}
+}
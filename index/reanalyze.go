@@ -0,0 +1,36 @@
+package index
+
+import (
+	"fmt"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Reanalyzing
+// The terms in the dictionary are what the analyzer made of the text, so adding
+// a stopword or folding accents means indexing the documents again. The index
+// doesn't keep the text, but the store behind it does, so Reanalyze builds the
+// postings again from the stored documents with another analyzer, without going
+// back to the dump they came from. The new index has the same documents under
+// the same IDs and the settings CopySettings gives, and ranks them with the same
+// scorer; synonyms, analyzed with the old analyzer, have to be set again.
+func (idx *Index) Reanalyze(a analysis.Analyzer, docs DocumentStore) (*Index, error) {
+	fresh := New(a)
+	idx.CopySettings(fresh)
+	fresh.scorer = idx.scorer
+
+	ids := idx.AllIDs()
+	batch := make([]Document, 0, len(ids))
+	for _, id := range ids {
+		doc, err := docs.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", id, err)
+		}
+		doc.ID = id
+		batch = append(batch, doc)
+	}
+	if err := fresh.Add(batch); err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
@@ -0,0 +1,70 @@
+package index
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// documents is a DocumentStore over a slice, with nil for a gap.
+type documents []*Document
+
+func (d documents) Len() int { return len(d) }
+
+func (d documents) Get(id int) (Document, error) {
+	if id >= len(d) || d[id] == nil {
+		return Document{}, errors.New("not stored")
+	}
+	return *d[id], nil
+}
+
+func (d documents) Put(doc Document) error { return errors.New("read-only") }
+func (d documents) Delete(id int) error    { return errors.New("read-only") }
+
+func TestReanalyze(t *testing.T) {
+	stored := documents{
+		{ID: 0, Title: "Café", Text: "a café in Paris"},
+		{ID: 1, Title: "Tea", Text: "the tea rooms of London"},
+		{ID: 2, Title: "Gone", Text: "a cafe that closed"},
+	}
+	idx := New(nil)
+	for _, doc := range stored {
+		idx.Add([]Document{*doc})
+	}
+	idx.Delete(2)
+
+	tests := []struct {
+		name     string
+		analyzer analysis.Analyzer
+		query    string
+		before   int
+		after    int
+	}{
+		{"folding accents", &analysis.Standard{FoldAccents: true}, "cafe", 0, 1},
+		{"folding keeps the accented", &analysis.Standard{FoldAccents: true}, "café", 1, 1},
+		{"another stopword", &analysis.Standard{Stopwords: analysis.NewStopwordSet("the", "a", "of", "rooms")}, "rooms", 1, 0},
+		{"the same analyzer", nil, "tea", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n := len(idx.Search(tt.query)); n != tt.before {
+				t.Fatalf("%q finds %d documents before, want %d", tt.query, n, tt.before)
+			}
+			fresh, err := idx.Reanalyze(tt.analyzer, stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(fresh.Search(tt.query)); n != tt.after {
+				t.Errorf("%q finds %d documents after, want %d", tt.query, n, tt.after)
+			}
+			if fresh.Len() != 2 {
+				t.Errorf("%d documents after, want the 2 not deleted", fresh.Len())
+			}
+		})
+	}
+
+	if _, err := idx.Reanalyze(nil, stored[:1]); err == nil {
+		t.Error("no error with a document missing from the store")
+	}
+}
@@ -0,0 +1,156 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Bad records
+// Real dumps have the odd broken record: a bare & in a title, a truncated <doc>, a
+// line of JSON cut off halfway. A ParseError says where such a record starts and
+// holds its raw text, so it can be fixed or set aside somewhere. Strict readers
+// (EachDocument, a Loader by default) stop at the first one and return it; a
+// lenient Loader leaves bad records out and returns all of them as ParseErrors at
+// the end, next to the documents that were fine. Records that are left out don't
+// use up a document number.
+type ParseError struct {
+	Line   int    // where the record starts, from 1
+	Record string // its raw text, empty if it can't be told apart (CSV syntax)
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+type ParseErrors []ParseError
+
+func (errs ParseErrors) Error() string {
+	if len(errs) == 1 {
+		return errs[0].Error()
+	}
+	return fmt.Sprintf("%d bad records, the first at %v", len(errs), errs[0].Error())
+}
+
+// badRecords collects ParseErrors for a lenient reader and hands the first one
+// back to a strict one.
+type badRecords struct {
+	lenient bool
+	errs    ParseErrors
+}
+
+func (b *badRecords) add(line int, record string, err error) error {
+	e := ParseError{line, record, err}
+	if !b.lenient {
+		return &e
+	}
+	b.errs = append(b.errs, e)
+	return nil
+}
+
+func (b *badRecords) err() error {
+	if len(b.errs) == 0 {
+		return nil
+	}
+	return b.errs
+}
+
+// XML records
+// The decoder of encoding/xml gives up for good at the first syntax error, so
+// every <doc> element is cut out of the stream first and decoded on its own. A
+// record runs from <doc> to the next </doc>, or up to the next <doc> if it never
+// gets closed; whatever is around the records (the <feed> wrapper) is skipped.
+const maxXMLRecord = 64 << 20
+
+func eachXMLDocument(r io.Reader, lenient bool, fn func(Document) error) error {
+	bad := &badRecords{lenient: lenient}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxXMLRecord)
+
+	line := 1  // of the start of what the scanner holds
+	start := 0 // line of the record the split function returned last
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		open := docStart(data)
+		if open < 0 {
+			// Keep the tail in case a <doc starts there.
+			skip := max(len(data)-len("<doc "), 0)
+			if atEOF {
+				skip = len(data)
+			}
+			line += bytes.Count(data[:skip], []byte("\n"))
+			return skip, nil, nil
+		}
+
+		end := -1
+		if i := bytes.Index(data[open:], []byte("</doc>")); i >= 0 {
+			end = open + i + len("</doc>")
+		}
+		if next := docStart(data[open+1:]); next >= 0 && (end < 0 || open+1+next < end) {
+			end = open + 1 + next
+		}
+		if end < 0 {
+			if !atEOF {
+				return 0, nil, nil
+			}
+			end = len(data)
+		}
+
+		start = line + bytes.Count(data[:open], []byte("\n"))
+		line += bytes.Count(data[:end], []byte("\n"))
+		return end, data[open:end], nil
+	})
+
+	id := 0
+	for sc.Scan() {
+		record := sc.Bytes()
+
+		var doc Document
+		if err := xml.NewDecoder(bytes.NewReader(record)).Decode(&doc); err != nil {
+			var se *xml.SyntaxError
+			if errors.As(err, &se) {
+				err = fmt.Errorf("XML syntax error on line %d: %s", start+se.Line-1, se.Msg)
+			}
+			if err := bad.add(start, string(record), err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		doc.ID = id
+		id++
+		if doc.Boost == 0 {
+			doc.Boost = DefaultBoost
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return bad.err()
+}
+
+// docStart returns where the first <doc> tag in data begins, or -1.
+func docStart(data []byte) int {
+	for at := 0; ; {
+		i := bytes.Index(data[at:], []byte("<doc"))
+		if i < 0 {
+			return -1
+		}
+		i += at
+		if rest := data[i+len("<doc"):]; len(rest) > 0 && strings.ContainsRune("> \t\r\n/", rune(rest[0])) {
+			return i
+		}
+		at = i + 1
+	}
+}
@@ -0,0 +1,77 @@
+package index
+
+import "math"
+
+// Custom scoring
+// BM25 is only the default. A Scorer decides what one query term adds to the
+// score of a document from the statistics of the term, there and in the whole
+// collection, and how much it can add at most: RankTop skips documents that can't
+// make it into the top k using those bounds, so a bound that's too low loses hits
+// and one that's too high only costs time (math.Inf(1) turns skipping off).
+//
+// Whatever the scorer returns, a term's score is multiplied with its field's
+// boost (SetFieldBoost) and the sum for a document with the document's static
+// boost (Document.Boost, say its popularity). A Scorer that is also a
+// DocumentScorer then gets the final say over every document's score, for
+// example to mix in a numeric field like views; RankTop can't skip anything then.
+// Proximity clauses score the same way with any scorer.
+type TermStats struct {
+	Term  string // dictionary key
+	Field string
+
+	// For the document being scored; both 0 when asking for a bound.
+	Freq        int
+	FieldLength int
+
+	AvgFieldLength float64
+	DocFreq        int
+	DocCount       int
+}
+
+type Scorer interface {
+	Score(t TermStats) float64
+	// Bound is at least what Score returns for the term in any document.
+	Bound(t TermStats) float64
+}
+
+type DocumentScorer interface {
+	Scorer
+	ScoreDocument(id int, score float64) float64
+}
+
+// BM25 scores with the given k1 and b, see bm25.go.
+type BM25 struct {
+	K1, B float64
+}
+
+var DefaultScorer Scorer = BM25{bm25K1, bm25B}
+
+func (s BM25) Score(t TermStats) float64 {
+	tf := float64(t.Freq)
+	norm := 1 - s.B + s.B*float64(t.FieldLength)/t.AvgFieldLength
+	return bm25IDF(t.DocFreq, t.DocCount) * tf * (s.K1 + 1) / (tf + s.K1*norm)
+}
+
+// BM25 saturates: however often a term occurs, it adds less than k1+1 times its idf.
+func (s BM25) Bound(t TermStats) float64 {
+	return bm25IDF(t.DocFreq, t.DocCount) * (s.K1 + 1)
+}
+
+// ScorerFunc turns a function into a Scorer with no useful bound.
+type ScorerFunc func(t TermStats) float64
+
+func (f ScorerFunc) Score(t TermStats) float64 { return f(t) }
+func (f ScorerFunc) Bound(TermStats) float64   { return math.Inf(1) }
+
+// SetScorer ranks with s from now on, nil going back to BM25. Like synonyms it
+// isn't saved with the index.
+func (idx *Index) SetScorer(s Scorer) {
+	idx.scorer = s
+}
+
+func (idx *Index) currentScorer() Scorer {
+	if idx.scorer == nil {
+		return DefaultScorer
+	}
+	return idx.scorer
+}
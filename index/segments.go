@@ -0,0 +1,422 @@
+package index
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Segments
+// A Segmented index is a list of segments, each an ordinary Index that is never
+// changed again once it's sealed, plus an in-memory buffer taking new documents.
+// The buffer is searched along with the segments, so a document can be found as
+// soon as Add returns. Deleting a document in a sealed segment only records a
+// tombstone next to it; searches skip tombstoned documents and the next merge of
+// their segment drops them. Updating is deleting plus adding, so the new version
+// goes into the buffer.
+//
+// The buffer is sealed once it holds flushDocs documents, or by Flush. Segments
+// are merged in the background, mergeFactor at a time, as soon as that many of
+// about the same size have piled up at the end of the list. Sizes go by powers of
+// mergeFactor, so a document is rewritten a logarithmic number of times, and
+// searches never wait for a merge: its result replaces the merged segments when
+// it's done. Document frequencies count tombstoned documents until the merge, like
+// Lucene does.
+//
+// Only the plain searches are supported; the query language, phrases and the rest
+// need an Index.
+const (
+	flushDocs   = 1000
+	mergeFactor = 10
+)
+
+type segment struct {
+	idx     *Index
+	deleted map[int]struct{} // tombstones, guarded by Segmented.mu
+}
+
+type Segmented struct {
+	mu       sync.RWMutex
+	analyzer analysis.Analyzer
+	segments []*segment // sealed, oldest first
+	buffer   *segment
+	merging  bool
+	merges   sync.WaitGroup
+}
+
+func NewSegmented(analyzer analysis.Analyzer) *Segmented {
+	if analyzer == nil {
+		analyzer = analysis.Default
+	}
+	return &Segmented{analyzer: analyzer, buffer: newSegment(analyzer)}
+}
+
+func newSegment(analyzer analysis.Analyzer) *segment {
+	return &segment{idx: New(analyzer), deleted: make(map[int]struct{})}
+}
+
+func (seg *segment) has(id int) bool {
+	_, gone := seg.deleted[id]
+	return !gone && seg.idx.Has(id)
+}
+
+// Add indexes docs. A document with the ID of one already indexed replaces it.
+func (s *Segmented) Add(docs []Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, doc := range docs {
+		if s.buffer.idx.Has(doc.ID) {
+			s.buffer.idx.Update(doc)
+			continue
+		}
+		s.tombstone(doc.ID)
+		s.buffer.idx.Add([]Document{doc})
+		if s.buffer.idx.docCount() >= flushDocs {
+			s.flush()
+		}
+	}
+}
+
+func (s *Segmented) Update(doc Document) {
+	s.Add([]Document{doc})
+}
+
+func (s *Segmented) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buffer.idx.Has(id) {
+		return s.buffer.idx.Delete(id)
+	}
+	if !s.tombstone(id) {
+		return ErrNoDocument
+	}
+	return nil
+}
+
+// tombstone marks id deleted in the sealed segment holding it.
+func (s *Segmented) tombstone(id int) bool {
+	for _, seg := range s.segments {
+		if seg.has(id) {
+			seg.deleted[id] = struct{}{}
+			return true
+		}
+	}
+	return false
+}
+
+// Flush seals the buffer into a segment.
+func (s *Segmented) Flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+}
+
+func (s *Segmented) flush() {
+	if s.buffer.idx.docCount() == 0 {
+		return
+	}
+	s.segments = append(s.segments, s.buffer)
+	s.buffer = newSegment(s.analyzer)
+	s.maybeMerge()
+}
+
+// Wait blocks until no merge is running.
+func (s *Segmented) Wait() {
+	s.merges.Wait()
+}
+
+// Segments returns the number of sealed segments.
+func (s *Segmented) Segments() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.segments)
+}
+
+// Len returns the number of live documents.
+func (s *Segmented) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := s.buffer.idx.docCount()
+	for _, seg := range s.segments {
+		n += seg.idx.docCount() - len(seg.deleted)
+	}
+	return n
+}
+
+// Merging
+
+// level is the size class of a segment: 0 up to mergeFactor flushes, 1 up to
+// mergeFactor² and so on.
+func (seg *segment) level() int {
+	n := float64(seg.idx.docCount()-len(seg.deleted)) / flushDocs
+	if n <= 1 {
+		return 0
+	}
+	return int(math.Log(n) / math.Log(mergeFactor))
+}
+
+// maybeMerge starts a merge of the last mergeFactor segments if they're all of
+// the same level. The caller must hold s.mu for writing.
+func (s *Segmented) maybeMerge() {
+	if s.merging || len(s.segments) < mergeFactor {
+		return
+	}
+	run := s.segments[len(s.segments)-mergeFactor:]
+	for _, seg := range run {
+		if seg.level() != run[0].level() {
+			return
+		}
+	}
+
+	// The merge works on a copy of the tombstones; deletes that come in meanwhile
+	// are carried over to the result when it's swapped in.
+	run = slices.Clone(run)
+	deleted := make([]map[int]struct{}, len(run))
+	for i, seg := range run {
+		deleted[i] = make(map[int]struct{}, len(seg.deleted))
+		for id := range seg.deleted {
+			deleted[i][id] = struct{}{}
+		}
+	}
+
+	s.merging = true
+	s.merges.Add(1)
+	go func() {
+		defer s.merges.Done()
+		merged := mergeSegments(s.analyzer, run, deleted)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for i, seg := range run {
+			for id := range seg.deleted {
+				if _, ok := deleted[i][id]; !ok {
+					merged.deleted[id] = struct{}{}
+				}
+			}
+		}
+		at := slices.Index(s.segments, run[0])
+		s.segments = slices.Replace(slices.Clone(s.segments), at, at+len(run), merged)
+
+		s.merging = false
+		s.maybeMerge()
+	}()
+}
+
+// mergeSegments builds one segment out of the live documents of segs, whose
+// tombstones are in deleted. It only reads the segments.
+func mergeSegments(analyzer analysis.Analyzer, segs []*segment, deleted []map[int]struct{}) *segment {
+	out := newSegment(analyzer)
+	idx := out.idx
+
+	live := func(i, id int) bool {
+		_, gone := deleted[i][id]
+		return !gone && segs[i].idx.Has(id)
+	}
+
+	terms := make(map[string]struct{})
+	for i, seg := range segs {
+		for field, boost := range seg.idx.fieldBoost {
+			idx.fieldBoost[field] = boost
+		}
+		for lang := range seg.idx.languages {
+			idx.languages[lang] = struct{}{}
+		}
+		for id, n := range seg.idx.docLen {
+			if !live(i, id) {
+				continue
+			}
+			idx.addFieldLength(FieldText, id, n)
+			if boost, ok := seg.idx.boost[id]; ok {
+				idx.boost[id] = boost
+			}
+			if title, ok := seg.idx.titles[id]; ok {
+				idx.titles[id] = title
+			}
+			for field, lens := range seg.idx.fieldLen {
+				idx.addFieldLength(field, id, lens[id])
+			}
+			for field, byDoc := range seg.idx.keywords {
+				for _, value := range byDoc[id] {
+					idx.addKeyword(field, value, id)
+				}
+			}
+			for field, byDoc := range seg.idx.numbers {
+				if value, ok := byDoc[id]; ok {
+					idx.addNumber(field, value, id)
+				}
+			}
+			for field, byDoc := range seg.idx.geo {
+				if p, ok := byDoc[id]; ok {
+					idx.addGeoPoint(field, p, id)
+				}
+			}
+			for field, byDoc := range seg.idx.vectors {
+				if v, ok := byDoc[id]; ok {
+					idx.addVector(field, v, id)
+				}
+			}
+			if byKey, ok := seg.idx.offsets[id]; ok {
+				idx.offsets[id] = byKey
+			}
+		}
+		for term := range seg.idx.terms {
+			terms[term] = struct{}{}
+		}
+	}
+
+	// Segments mostly hold ascending ranges of IDs, but an updated document can
+	// sit in a later segment with a lower ID, so the entries are sorted again.
+	type entry struct {
+		id, freq  int
+		positions []int
+	}
+	for term := range terms {
+		var entries []entry
+		withPositions := true
+		for i, seg := range segs {
+			p, ok := seg.idx.terms[term]
+			if !ok {
+				continue
+			}
+			ids, freqs, positions := p.entries()
+			withPositions = withPositions && positions != nil
+			for j, id := range ids {
+				if !live(i, id) {
+					continue
+				}
+				e := entry{id: id, freq: freqs[j]}
+				if positions != nil {
+					e.positions = positions[j]
+				}
+				entries = append(entries, e)
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+
+		ids, freqs := make([]int, len(entries)), make([]int, len(entries))
+		var positions [][]int
+		if withPositions {
+			positions = make([][]int, len(entries))
+		}
+		for j, e := range entries {
+			ids[j], freqs[j] = e.id, e.freq
+			if withPositions {
+				positions[j] = e.positions
+			}
+		}
+		idx.terms[term] = newPostings(ids, freqs, positions)
+	}
+	idx.termsDirty = true
+	return out
+}
+
+// Searching
+
+// segmentStats are the collection statistics over several segments.
+type segmentStats []*segment
+
+func (st segmentStats) docCount() int {
+	n := 0
+	for _, seg := range st {
+		n += seg.idx.docCount() - len(seg.deleted)
+	}
+	return n
+}
+
+func (st segmentStats) docFreq(term string) int {
+	n := 0
+	for _, seg := range st {
+		n += seg.idx.docFreq(term)
+	}
+	return n
+}
+
+func (st segmentStats) avgFieldLength(field string) float64 {
+	total, docs := 0, 0
+	for _, seg := range st {
+		total += seg.idx.fieldTotalLength(field)
+		docs += seg.idx.docCount()
+	}
+	if total == 0 || docs == 0 {
+		return 1
+	}
+	return float64(total) / float64(docs)
+}
+
+func (s *Segmented) Search(text string) []Result {
+	r, _ := s.SearchWithOptions(text, SearchOptions{})
+	return r
+}
+
+// SearchWithOptions is Index.SearchWithOptions over all segments.
+func (s *Segmented) SearchWithOptions(text string, opts SearchOptions) ([]Result, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	segs := append(slices.Clip(s.segments), s.buffer)
+	tokens := s.analyzer.Analyze(text)
+
+	// A term that's in no segment at all is ignored as it is by Index.Search, but
+	// one missing from a single segment rules out that segment's documents.
+	lists := make([][][]int, len(segs))
+	present := make([]bool, len(tokens))
+	for i, seg := range segs {
+		lists[i] = make([][]int, len(tokens))
+		for t, token := range tokens {
+			lists[i][t] = seg.idx.SynonymIDs("", token)
+			present[t] = present[t] || lists[i][t] != nil
+		}
+	}
+
+	var keys []string
+	for t, token := range tokens {
+		if present[t] {
+			keys = append(keys, segs[len(segs)-1].idx.FieldTerms("", token)...)
+		}
+	}
+
+	var r []Result
+	total := 0
+	for i, seg := range segs {
+		var matched [][]int
+		for t := range tokens {
+			if present[t] {
+				matched = append(matched, lists[i][t])
+			}
+		}
+		ids := IntersectAll(matched)
+		ids = slices.DeleteFunc(ids, func(id int) bool {
+			_, gone := seg.deleted[id]
+			return gone
+		})
+
+		total += len(ids)
+		k := opts.Offset + opts.Limit
+		if opts.Limit <= 0 {
+			k = len(ids)
+		}
+		r = append(r, seg.idx.rankTop(ids, Scoring{Terms: keys}, k, segmentStats(segs))...)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Score != r[j].Score {
+			return r[i].Score > r[j].Score
+		}
+		return r[i].ID < r[j].ID
+	})
+	r = r[min(max(opts.Offset, 0), len(r)):]
+	if opts.Limit > 0 && len(r) > opts.Limit {
+		r = r[:opts.Limit]
+	}
+	return r, total
+}
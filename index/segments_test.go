@@ -0,0 +1,109 @@
+package index
+
+import (
+	"slices"
+	"testing"
+)
+
+// segmentedIDs returns the sorted IDs s finds for q.
+func segmentedIDs(s *Segmented, q string) []int {
+	var ids []int
+	for _, r := range s.Search(q) {
+		ids = append(ids, r.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// indexIDs returns the sorted IDs idx finds for q.
+func indexIDs(idx *Index, q string) []int {
+	var ids []int
+	for _, r := range idx.Search(q) {
+		ids = append(ids, r.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestSegmentedFlush(t *testing.T) {
+	docs := corpus(flushDocs + 5)
+	s := NewSegmented(nil)
+	s.Add(docs)
+	want := New(nil)
+	want.Add(docs)
+
+	if n := s.Segments(); n != 1 {
+		t.Errorf("%d sealed segments, want 1", n)
+	}
+	if n := s.Len(); n != len(docs) {
+		t.Errorf("Len() = %d, want %d", n, len(docs))
+	}
+	for _, q := range []string{"cat", "wild fox", "lynx river tiger", "unicorn"} {
+		if got, want := segmentedIDs(s, q), indexIDs(want, q); !slices.Equal(got, want) {
+			t.Errorf("Search(%q) finds %d documents, want %d", q, len(got), len(want))
+		}
+	}
+}
+
+func TestSegmentedUpdateSealed(t *testing.T) {
+	s := NewSegmented(nil)
+	s.Add([]Document{{ID: 0, Text: "wild cat"}, {ID: 1, Text: "wild dog"}, {ID: 2, Text: "tame cat"}})
+	s.Flush()
+	s.Update(Document{ID: 1, Text: "tame fox"})
+
+	tests := []struct {
+		q    string
+		want []int
+	}{
+		{"wild", []int{0}},
+		{"dog", nil},
+		{"fox", []int{1}},
+		{"tame", []int{1, 2}},
+	}
+	for _, tt := range tests {
+		if got := segmentedIDs(s, tt.q); !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+	if n := s.Len(); n != 3 {
+		t.Errorf("Len() = %d, want 3", n)
+	}
+	if err := s.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := segmentedIDs(s, "tame"); !slices.Equal(got, []int{2}) {
+		t.Errorf("Search(tame) after deleting the update = %v, want [2]", got)
+	}
+}
+
+func TestSegmentedDeleteWhileMerging(t *testing.T) {
+	docs := corpus(mergeFactor * flushDocs)
+	s := NewSegmented(nil)
+	want := New(nil)
+	want.Add(docs)
+
+	// The last flush starts a merge of all the segments; the deletes and the
+	// update come in while it runs and have to survive it.
+	s.Add(docs)
+	for id := 0; id < len(docs); id += 7 {
+		if err := s.Delete(id); err != nil {
+			t.Fatal(err)
+		}
+		want.Delete(id)
+	}
+	s.Update(Document{ID: 3, Text: "unicorn"})
+	want.Update(Document{ID: 3, Text: "unicorn"})
+	s.Wait()
+
+	if n := s.Segments(); n != 1 {
+		t.Errorf("%d sealed segments after the merge, want 1", n)
+	}
+	if got, want := s.Len(), want.Len(); got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+	for _, q := range []string{"cat", "wild fox", "lynx river tiger", "unicorn"} {
+		if got, want := segmentedIDs(s, q), indexIDs(want, q); !slices.Equal(got, want) {
+			t.Errorf("Search(%q) finds %d documents, want %d", q, len(got), len(want))
+		}
+	}
+}
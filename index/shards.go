@@ -0,0 +1,237 @@
+package index
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Shards
+// A Sharded index splits the documents by ID over n ordinary indexes, document id
+// going to shard id mod n (counted up from 0 for negative IDs too), and gives each shard a goroutine of its own that all
+// work on it goes through. Adding a batch hands every shard its part at once, so
+// the analysis runs on n cores; a search runs on every shard at once and the
+// ranked hits are merged. Scores use the statistics of all shards together, so a
+// hit scores the same as it would in one index.
+//
+// Adds and deletes wait for running searches and the other way round, like
+// Shared. Like a Segmented index only the plain searches are built in;
+// SearchFunc runs anything else that works on an Index, the query language
+// among them (see search.QuerySharded). Sorting by fields and Explain need an
+// Index.
+type Sharded struct {
+	mu     sync.RWMutex
+	shards []*shard
+	stats  segmentStats // all shards, for the collection statistics
+}
+
+type shard struct {
+	idx  *Index
+	work chan func(*Index)
+}
+
+func NewSharded(analyzer analysis.Analyzer, n int) *Sharded {
+	s := &Sharded{}
+	for i := 0; i < max(n, 1); i++ {
+		sh := &shard{idx: New(analyzer), work: make(chan func(*Index))}
+		go sh.run()
+		s.shards = append(s.shards, sh)
+		s.stats = append(s.stats, &segment{idx: sh.idx})
+	}
+	return s
+}
+
+func (sh *shard) run() {
+	for fn := range sh.work {
+		fn(sh.idx)
+	}
+}
+
+// Close stops the shards' goroutines. The index can't be used afterwards.
+func (s *Sharded) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sh := range s.shards {
+		close(sh.work)
+	}
+}
+
+func (s *Sharded) Shards() int {
+	return len(s.shards)
+}
+
+func (s *Sharded) shardOf(id int) *shard {
+	return s.shards[s.shardIndex(id)]
+}
+
+// shardIndex is id mod the number of shards, which unlike % isn't negative.
+func (s *Sharded) shardIndex(id int) int {
+	n := len(s.shards)
+	return (id%n + n) % n
+}
+
+// on runs fn in the goroutine of sh and waits for it.
+func (sh *shard) on(fn func(idx *Index)) {
+	done := make(chan struct{})
+	sh.work <- func(idx *Index) {
+		fn(idx)
+		close(done)
+	}
+	<-done
+}
+
+// each runs fn on every shard at once and waits for all of them.
+func (s *Sharded) each(fn func(i int, idx *Index)) {
+	var wg sync.WaitGroup
+	for i, sh := range s.shards {
+		wg.Add(1)
+		sh.work <- func(idx *Index) {
+			defer wg.Done()
+			fn(i, idx)
+		}
+	}
+	wg.Wait()
+}
+
+func (s *Sharded) Add(docs []Document) {
+	parts := make([][]Document, len(s.shards))
+	for _, doc := range docs {
+		i := s.shardIndex(doc.ID)
+		parts[i] = append(parts[i], doc)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.each(func(i int, idx *Index) {
+		if len(parts[i]) > 0 {
+			idx.Add(parts[i])
+		}
+	})
+}
+
+func (s *Sharded) Update(doc Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shardOf(doc.ID).on(func(idx *Index) { idx.Update(doc) })
+}
+
+func (s *Sharded) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	s.shardOf(id).on(func(idx *Index) { err = idx.Delete(id) })
+	return err
+}
+
+func (s *Sharded) Has(id int) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ok bool
+	s.shardOf(id).on(func(idx *Index) { ok = idx.Has(id) })
+	return ok
+}
+
+// Len is the number of live documents.
+func (s *Sharded) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stats.docCount()
+}
+
+func (s *Sharded) Search(text string) []Result {
+	r, _ := s.SearchWithOptions(text, SearchOptions{})
+	return r
+}
+
+// SearchWithOptions is Index.SearchWithOptions over all shards.
+func (s *Sharded) SearchWithOptions(text string, opts SearchOptions) ([]Result, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := s.shards[0].idx.analyzer.Analyze(text)
+
+	// As with segments, a term no shard has is ignored, one that's only missing
+	// from some rules out their documents.
+	lists := make([][][]int, len(s.shards))
+	s.each(func(i int, idx *Index) {
+		lists[i] = make([][]int, len(tokens))
+		for t, token := range tokens {
+			lists[i][t] = idx.SynonymIDs("", token)
+		}
+	})
+	present := make([]bool, len(tokens))
+	var keys []string
+	for t, token := range tokens {
+		for i := range s.shards {
+			present[t] = present[t] || lists[i][t] != nil
+		}
+		if present[t] {
+			keys = append(keys, s.shards[0].idx.FieldTerms("", token)...)
+		}
+	}
+
+	r, total, _ := s.search(func(i int, idx *Index) ([]int, Scoring, error) {
+		var matched [][]int
+		for t := range tokens {
+			if present[t] {
+				matched = append(matched, lists[i][t])
+			}
+		}
+		return IntersectAll(matched), Scoring{Terms: keys}, nil
+	}, opts)
+	return r, total
+}
+
+// SearchFunc runs match on every shard and ranks what it returns like RankPage
+// does, returning the page and the total number of matches. The first error of a
+// shard is returned.
+func (s *Sharded) SearchFunc(match func(idx *Index) ([]int, Scoring, error), opts SearchOptions) ([]Result, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.search(func(_ int, idx *Index) ([]int, Scoring, error) { return match(idx) }, opts)
+}
+
+func (s *Sharded) search(match func(i int, idx *Index) ([]int, Scoring, error), opts SearchOptions) ([]Result, int, error) {
+	decay := opts.scoring(Scoring{}).decay // one origin for every shard
+	results := make([][]Result, len(s.shards))
+	totals := make([]int, len(s.shards))
+	errs := make([]error, len(s.shards))
+	s.each(func(i int, idx *Index) {
+		ids, scoring, err := match(i, idx)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		totals[i] = len(ids)
+		scoring.decay = decay
+		// Every shard's best offset+limit are enough to make up the page.
+		k := opts.Offset + opts.Limit
+		if opts.Limit <= 0 {
+			k = len(ids)
+		}
+		results[i] = idx.rankTop(ids, scoring, k, s.stats)
+	})
+
+	var r []Result
+	total := 0
+	for i := range s.shards {
+		if errs[i] != nil {
+			return nil, 0, errs[i]
+		}
+		r = append(r, results[i]...)
+		total += totals[i]
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Score != r[j].Score {
+			return r[i].Score > r[j].Score
+		}
+		return r[i].ID < r[j].ID
+	})
+	r = r[min(max(opts.Offset, 0), len(r)):]
+	if opts.Limit > 0 && len(r) > opts.Limit {
+		r = r[:opts.Limit]
+	}
+	return r, total, nil
+}
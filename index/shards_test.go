@@ -0,0 +1,61 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestShardedRanking(t *testing.T) {
+	docs := corpus(200)
+	// Negative IDs have to land on a shard like any other.
+	docs = append(docs, Document{ID: -1, Text: "wild cat"}, Document{ID: -7, Text: "unicorn forest"}, Document{ID: -12, Text: "cat river"})
+	want := New(nil)
+	want.Add(docs)
+
+	for _, n := range []int{1, 3, 8} {
+		t.Run(fmt.Sprintf("shards=%d", n), func(t *testing.T) {
+			s := NewSharded(nil, n)
+			defer s.Close()
+			s.Add(docs)
+
+			for _, q := range []string{"cat", "wild fox", "lynx river tiger", "unicorn", "nothing"} {
+				got, want := s.Search(q), want.Search(q)
+				if len(got) != len(want) {
+					t.Fatalf("Search(%q) finds %d documents, want %d", q, len(got), len(want))
+				}
+				for i := range got {
+					if got[i].ID != want[i].ID || math.Abs(got[i].Score-want[i].Score) > 1e-9 {
+						t.Errorf("Search(%q)[%d] = %v, want %v", q, i, got[i], want[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestShardedNegativeIDs(t *testing.T) {
+	s := NewSharded(nil, 3)
+	defer s.Close()
+	s.Add([]Document{{ID: -1, Text: "wild cat"}, {ID: -2, Text: "wild dog"}, {ID: -4, Text: "tame cat"}})
+
+	for _, id := range []int{-1, -2, -4} {
+		if !s.Has(id) {
+			t.Errorf("Has(%d) = false", id)
+		}
+	}
+	if err := s.Delete(-2); err != nil {
+		t.Fatal(err)
+	}
+	s.Update(Document{ID: -4, Text: "tame fox"})
+	if s.Has(-2) {
+		t.Error("Has(-2) after Delete")
+	}
+	if r := s.Search("fox"); len(r) != 1 || r[0].ID != -4 {
+		t.Errorf("Search(fox) = %v, want document -4", r)
+	}
+	if n := s.Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
+	}
+}
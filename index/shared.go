@@ -0,0 +1,101 @@
+package index
+
+import "sync"
+
+// Sharing an index
+// Any number of goroutines may search an Index at once, but not while another one
+// adds, updates or deletes documents: those rewrite the maps a search walks. Shared
+// puts a read-write lock around an index so a server can index and search at the
+// same time. Searches run in parallel, a change waits for them to finish and holds
+// off new ones until it's done.
+//
+// The methods below take the lock for one call. For several calls that have to
+// see the same state (evaluate, rank, count facets) take it with Read or Write and
+// release it with the function they return. For query sequences that have to
+// see the same state without holding off changes, open a Reader.
+//
+// Swap puts another index in place of the shared one, a newly built one say,
+// once the searches running are done, like a change does. A search that comes
+// after sees the new index only. Readers opened before keep the old one, which
+// can't be closed until they are: the function Swap returns waits for that.
+type Shared struct {
+	mu  sync.RWMutex
+	idx *Index
+
+	// The number of open readers of idx, see reader.go.
+	pinMu  sync.Mutex
+	pinned int
+
+	readers *sync.WaitGroup // opened since the last swap
+}
+
+func NewShared(idx *Index) *Shared {
+	return &Shared{idx: idx, readers: new(sync.WaitGroup)}
+}
+
+// Swap replaces the index with idx and returns the old one. also runs with the
+// write lock held, to swap what goes with the index. drained waits until the
+// readers of the old index are closed.
+func (s *Shared) Swap(idx *Index, also func()) (old *Index, drained func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pinMu.Lock()
+	old, readers := s.idx, s.readers
+	s.idx, s.pinned, s.readers = idx, 0, new(sync.WaitGroup)
+	s.pinMu.Unlock()
+	if also != nil {
+		also()
+	}
+	return old, readers.Wait
+}
+
+// Read locks the index for reading. Nothing may change it until done is called.
+func (s *Shared) Read() (idx *Index, done func()) {
+	s.mu.RLock()
+	return s.idx, s.mu.RUnlock
+}
+
+// Write locks the index for changing it. With readers open the index is a copy.
+func (s *Shared) Write() (idx *Index, done func()) {
+	s.mu.Lock()
+	s.unpin()
+	return s.idx, s.mu.Unlock
+}
+
+func (s *Shared) Search(text string) []Result {
+	idx, done := s.Read()
+	defer done()
+	return idx.Search(text)
+}
+
+func (s *Shared) SearchWithOptions(text string, opts SearchOptions) ([]Result, int) {
+	idx, done := s.Read()
+	defer done()
+	return idx.SearchWithOptions(text, opts)
+}
+
+func (s *Shared) Add(docs []Document) error {
+	idx, done := s.Write()
+	defer done()
+	return idx.Add(docs)
+}
+
+func (s *Shared) Update(doc Document) error {
+	idx, done := s.Write()
+	defer done()
+	return idx.Update(doc)
+}
+
+func (s *Shared) Delete(id int) error {
+	idx, done := s.Write()
+	defer done()
+	return idx.Delete(id)
+}
+
+// Save writes the index while holding off changes, searches go on.
+func (s *Shared) Save(path string) error {
+	idx, done := s.Read()
+	defer done()
+	return idx.Save(path)
+}
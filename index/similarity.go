@@ -0,0 +1,186 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Similarities
+// Besides BM25 there are the classic Lucene TF-IDF, the square root of the term's
+// frequency times its idf squared, divided by the square root of the field's
+// length; DFR, divergence from randomness with the InL2 model; and ConstantScore,
+// the same for every document a term occurs in, for matching without ranking.
+// How a field is best scored depends on what's in it, so PerFieldScorer picks a
+// scorer by the field of the term. ParseScorer reads all of them from a spec for
+// trying them out from the command line.
+type TFIDF struct{}
+
+func (TFIDF) Score(t TermStats) float64 {
+	idf := tfidfIDF(t.DocFreq, t.DocCount)
+	norm := 1.0
+	if t.FieldLength > 0 {
+		norm = 1 / math.Sqrt(float64(t.FieldLength))
+	}
+	return math.Sqrt(float64(t.Freq)) * idf * idf * norm
+}
+
+// A term occurs at most as often as its field is long, so the square root of the
+// frequency times the norm is at most 1.
+func (TFIDF) Bound(t TermStats) float64 {
+	idf := tfidfIDF(t.DocFreq, t.DocCount)
+	return idf * idf
+}
+
+func tfidfIDF(docFreq, docCount int) float64 {
+	return 1 + math.Log(float64(docCount)/float64(docFreq+1))
+}
+
+// DFR scores with the InL2 model: the frequency normalized by the field length
+// against the average (normalization 2), weighed by how rare the term is in the
+// collection (inverse document frequency) and the Laplace law of succession for
+// the risk of the term occurring once more.
+type DFR struct {
+	C float64 // of the length normalization, 0 for 1
+}
+
+func (s DFR) Score(t TermStats) float64 {
+	c := s.C
+	if c == 0 {
+		c = 1
+	}
+	tfn := float64(t.Freq)
+	if t.FieldLength > 0 {
+		tfn *= math.Log2(1 + c*t.AvgFieldLength/float64(t.FieldLength))
+	}
+	return tfn / (tfn + 1) * dfrIDF(t.DocFreq, t.DocCount)
+}
+
+// The Laplace after-effect keeps a term under its idf.
+func (s DFR) Bound(t TermStats) float64 {
+	return dfrIDF(t.DocFreq, t.DocCount)
+}
+
+func dfrIDF(docFreq, docCount int) float64 {
+	return math.Log2((float64(docCount) + 1) / (float64(docFreq) + 0.5))
+}
+
+// ConstantScore is what a term adds to every document it occurs in.
+type ConstantScore float64
+
+func (s ConstantScore) Score(TermStats) float64 { return float64(s) }
+func (s ConstantScore) Bound(TermStats) float64 { return float64(s) }
+
+// PerFieldScorer scores the terms of the fields it lists with their own scorer,
+// the others with Default (or DefaultScorer). Only its own ScoreDocument would
+// count, so a DocumentScorer in it is just a Scorer.
+type PerFieldScorer struct {
+	Default Scorer
+	Fields  map[string]Scorer
+}
+
+func (p PerFieldScorer) For(field string) Scorer {
+	if s, ok := p.Fields[field]; ok {
+		return s
+	}
+	if p.Default != nil {
+		return p.Default
+	}
+	return DefaultScorer
+}
+
+func (p PerFieldScorer) Score(t TermStats) float64 { return p.For(t.Field).Score(t) }
+func (p PerFieldScorer) Bound(t TermStats) float64 { return p.For(t.Field).Bound(t) }
+
+// ParseScorer reads a scorer like "bm25", "bm25(k1=2,b=0.5)", "tfidf", "dfr",
+// "dfr(c=2)" or "constant(1)". A list of them gives fields their own, with the
+// one without a field for the rest: "title=constant,text=tfidf,bm25(k1=1.5)".
+func ParseScorer(spec string) (Scorer, error) {
+	per := PerFieldScorer{Fields: make(map[string]Scorer)}
+	for _, part := range splitSort(spec) {
+		part = strings.TrimSpace(part)
+		field := ""
+		if i := strings.IndexAny(part, "=("); i >= 0 && part[i] == '=' {
+			field, part = part[:i], part[i+1:]
+		}
+		s, err := parseSimilarity(part)
+		if err != nil {
+			return nil, err
+		}
+		if field == "" {
+			per.Default = s
+		} else {
+			per.Fields[field] = s
+		}
+	}
+	if len(per.Fields) == 0 {
+		if per.Default == nil {
+			return nil, fmt.Errorf("empty scorer %q", spec)
+		}
+		return per.Default, nil
+	}
+	return per, nil
+}
+
+// parseSimilarity reads one scorer of a ParseScorer spec.
+func parseSimilarity(spec string) (Scorer, error) {
+	name, args, hasArgs := strings.Cut(spec, "(")
+	if hasArgs {
+		var ok bool
+		if args, ok = strings.CutSuffix(args, ")"); !ok {
+			return nil, fmt.Errorf("missing ) in %q", spec)
+		}
+	}
+	params := make(map[string]float64)
+	for _, arg := range strings.Split(args, ",") {
+		if arg = strings.TrimSpace(arg); arg == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			key, value = "", key
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad parameter %q of %s", arg, name)
+		}
+		params[strings.TrimSpace(key)] = v
+	}
+
+	var s Scorer
+	var known []string
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "bm25":
+		bm := BM25{bm25K1, bm25B}
+		if k1, ok := params["k1"]; ok {
+			bm.K1 = k1
+		}
+		if b, ok := params["b"]; ok {
+			bm.B = b
+		}
+		s, known = bm, []string{"k1", "b"}
+	case "tfidf":
+		s = TFIDF{}
+	case "dfr":
+		s, known = DFR{C: params["c"]}, []string{"c"}
+	case "constant":
+		// constant(2) as well as constant(score=2).
+		score := 1.0
+		if v, ok := params[""]; ok {
+			score = v
+		} else if v, ok := params["score"]; ok {
+			score = v
+		}
+		s, known = ConstantScore(score), []string{"", "score"}
+	default:
+		return nil, fmt.Errorf("unknown similarity %q", name)
+	}
+	for key := range params {
+		if !slices.Contains(known, key) {
+			return nil, fmt.Errorf("bad parameter %q of %s", key, name)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,278 @@
+package index
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Sorting
+// Hits come best first unless SearchOptions.Sort orders them by field values: a
+// numeric field (dates too), a keyword field (by its first value) or the title,
+// each ascending or descending, later fields breaking the ties of earlier ones.
+// SortScore sorts by relevance, and relevance also breaks whatever ties are left,
+// then the lower ID. A document without a value comes after all that have one,
+// in either direction. Strings compare case-insensitively. A geo field sorts by
+// the distance of its point to Near, nearest first unless Desc is set.
+//
+// Comparing values through the per-document maps would cost a map lookup or two
+// per comparison, so sorting reads columns instead, doc values style: one dense
+// slice per field indexed by document ID, built on first use and dropped whenever
+// a document changes. Titles are kept for nothing else. Distances are worked out
+// for the hits of each query instead.
+type SortField struct {
+	Field string
+	Desc  bool
+	Near  *GeoPoint // for a geo field
+}
+
+const SortScore = "_score"
+
+// ParseSort reads a list of sort fields like "year:desc,title". ":asc" is the
+// default, but for _score, which sorts best first unless it says ":asc". A geo
+// field names its point: "place:near(52.52,13.40)", or with ":desc" after it.
+func ParseSort(spec string) ([]SortField, error) {
+	var r []SortField
+	for _, part := range splitSort(spec) {
+		field, dir, _ := strings.Cut(strings.TrimSpace(part), ":")
+		if field == "" {
+			return nil, fmt.Errorf("empty sort field in %q", spec)
+		}
+		f := SortField{Field: field}
+		if rest, ok := strings.CutPrefix(dir, "near("); ok {
+			point, after, ok := strings.Cut(rest, ")")
+			p, valid := ParseGeoPoint(point)
+			if !ok || !valid {
+				return nil, fmt.Errorf("bad point %q for %s", point, field)
+			}
+			f.Near, dir = &p, strings.TrimPrefix(after, ":")
+		}
+		switch dir {
+		case "":
+			f.Desc = field == SortScore
+		case "asc":
+		case "desc":
+			f.Desc = true
+		default:
+			return nil, fmt.Errorf("bad sort direction %q for %s", dir, field)
+		}
+		r = append(r, f)
+	}
+	return r, nil
+}
+
+// splitSort splits spec at the commas that aren't inside parentheses.
+func splitSort(spec string) []string {
+	var r []string
+	depth, start := 0, 0
+	for i, c := range spec {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				r = append(r, spec[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(r, spec[start:])
+}
+
+// String writes f the way ParseSort reads it.
+func (f SortField) String() string {
+	s := f.Field
+	if f.Near != nil {
+		s += fmt.Sprintf(":near(%g,%g)", f.Near.Lat, f.Near.Lon)
+	}
+	if f.Desc != (f.Field == SortScore) {
+		if f.Desc {
+			return s + ":desc"
+		}
+		return s + ":asc"
+	}
+	return s
+}
+
+// CheckSort reports an error for a sort field the index can't sort by.
+func (idx *Index) CheckSort(fields []SortField) error {
+	for _, f := range fields {
+		switch {
+		case f.Near != nil:
+			if !idx.IsGeoField(f.Field) {
+				return fmt.Errorf("can't sort by the distance of %s: not a geo field", f.Field)
+			}
+		case idx.IsGeoField(f.Field):
+			return fmt.Errorf("can't sort by %s without a point, use %s:near(lat,lon)", f.Field, f.Field)
+		case f.Field != SortScore && f.Field != FieldTitle && !idx.IsNumericField(f.Field) && !idx.IsKeywordField(f.Field):
+			return fmt.Errorf("can't sort by %s: not a numeric or keyword field", f.Field)
+		}
+	}
+	return nil
+}
+
+// A column holds the values of one field by document ID: numbers for a numeric
+// field, NaN where there is none, or strings, "" where there is none. The
+// distances of a geo sort are only there for the hits.
+type column struct {
+	numbers   []float64
+	strings   []string
+	distances map[int]float64
+}
+
+func (idx *Index) column(field string) *column {
+	idx.columnsMu.Lock()
+	defer idx.columnsMu.Unlock()
+
+	if c, ok := idx.columns[field]; ok {
+		return c
+	}
+
+	n := 0
+	for id := range idx.docLen {
+		n = max(n, id+1)
+	}
+	c := &column{}
+	switch {
+	case field == FieldTitle:
+		c.strings = make([]string, n)
+		for id, title := range idx.titles {
+			if id < n {
+				c.strings[id] = title
+			}
+		}
+	case idx.IsNumericField(field):
+		c.numbers = make([]float64, n)
+		for i := range c.numbers {
+			c.numbers[i] = math.NaN()
+		}
+		for id, v := range idx.numbers[field] {
+			if id < n {
+				c.numbers[id] = v
+			}
+		}
+	default:
+		c.strings = make([]string, n)
+		for id, values := range idx.keywords[field] {
+			if id < n && len(values) > 0 {
+				c.strings[id] = strings.ToLower(values[0])
+			}
+		}
+	}
+
+	if idx.columns == nil {
+		idx.columns = make(map[string]*column)
+	}
+	idx.columns[field] = c
+	return c
+}
+
+func (idx *Index) dropColumns() {
+	idx.columnsMu.Lock()
+	idx.columns = nil
+	idx.columnsMu.Unlock()
+}
+
+// distanceColumn holds the distances of the points of the hits r to near.
+func (idx *Index) distanceColumn(field string, near GeoPoint, r []Result) *column {
+	c := &column{distances: make(map[int]float64, len(r))}
+	for _, res := range r {
+		if p, ok := idx.geo[field][res.ID]; ok {
+			c.distances[res.ID] = Distance(near, p)
+		}
+	}
+	return c
+}
+
+func (c *column) number(id int) float64 {
+	if c.distances != nil {
+		if d, ok := c.distances[id]; ok {
+			return d
+		}
+		return math.NaN()
+	}
+	if id < 0 || id >= len(c.numbers) {
+		return math.NaN()
+	}
+	return c.numbers[id]
+}
+
+func (c *column) string(id int) string {
+	if id < 0 || id >= len(c.strings) {
+		return ""
+	}
+	return c.strings[id]
+}
+
+// compare orders documents a and b by the column, a missing value last. ok is
+// false if neither has one.
+func (c *column) compare(a, b int) (r int, ok bool) {
+	if c.numbers != nil || c.distances != nil {
+		va, vb := c.number(a), c.number(b)
+		switch na, nb := math.IsNaN(va), math.IsNaN(vb); {
+		case na && nb:
+			return 0, false
+		case na:
+			return 1, false
+		case nb:
+			return -1, false
+		}
+		return cmp.Compare(va, vb), true
+	}
+
+	va, vb := c.string(a), c.string(b)
+	switch {
+	case va == "" && vb == "":
+		return 0, false
+	case va == "":
+		return 1, false
+	case vb == "":
+		return -1, false
+	}
+	return strings.Compare(va, vb), true
+}
+
+// sortResults orders r, scored already, by fields.
+func (idx *Index) sortResults(r []Result, fields []SortField) {
+	columns := make([]*column, len(fields))
+	for i, f := range fields {
+		switch {
+		case f.Near != nil:
+			columns[i] = idx.distanceColumn(f.Field, *f.Near, r)
+		case f.Field != SortScore:
+			columns[i] = idx.column(f.Field)
+		}
+	}
+
+	slices.SortStableFunc(r, func(a, b Result) int {
+		for i, f := range fields {
+			var c int
+			if columns[i] == nil {
+				c = cmp.Compare(a.Score, b.Score)
+			} else {
+				var ok bool
+				// Missing values stay last, so they don't turn around with Desc.
+				if c, ok = columns[i].compare(a.ID, b.ID); !ok {
+					if c != 0 {
+						return c
+					}
+					continue
+				}
+			}
+			if f.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
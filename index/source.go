@@ -0,0 +1,134 @@
+package index
+
+import "fmt"
+
+// Source filtering
+// A hit usually needs a few fields of its document, not the whole abstract, so
+// callers name the ones they want and Select copies just those. The names are
+// the document's fields (title, url, text, language), keywords, numbers, geo and
+// vectors for all the keyword, numeric, geo or vector values, the name of one
+// such field, nested
+// for the nested objects, or
+// SourceAll for everything. The ID is always kept; asking for nothing but "id"
+// leaves only it.
+const (
+	SourceLanguage = "language"
+	SourceKeywords = "keywords"
+	SourceNumbers  = "numbers"
+	SourceGeo      = "geo"
+	SourceVectors  = "vectors"
+	SourceNested   = "nested"
+	SourceID       = "id"
+	SourceAll      = "*"
+)
+
+// DefaultSource is what hits return when nobody asks.
+var DefaultSource = []string{FieldTitle, FieldURL}
+
+// CheckSource reports an error for a field name Select wouldn't know.
+func (idx *Index) CheckSource(fields []string) error {
+	for _, f := range fields {
+		switch f {
+		case FieldTitle, FieldURL, FieldText, SourceLanguage, SourceKeywords, SourceNumbers, SourceGeo, SourceVectors, SourceNested, SourceID, SourceAll:
+			continue
+		}
+		if !idx.IsKeywordField(f) && !idx.IsNumericField(f) && !idx.IsGeoField(f) && !idx.IsVectorField(f) {
+			return fmt.Errorf("unknown field %q", f)
+		}
+	}
+	return nil
+}
+
+// Select returns doc with only the named fields.
+func (doc Document) Select(fields []string) Document {
+	r := Document{ID: doc.ID}
+	for _, f := range fields {
+		switch f {
+		case SourceAll:
+			return doc
+		case FieldTitle:
+			r.Title = doc.Title
+		case FieldURL:
+			r.URL = doc.URL
+		case FieldText:
+			r.Text = doc.Text
+		case SourceLanguage:
+			r.Language = doc.Language
+		case SourceKeywords:
+			for field, values := range doc.Keywords {
+				r.Keywords = setKeywords(r.Keywords, field, values)
+			}
+		case SourceNumbers:
+			for field, v := range doc.Numbers {
+				r.Numbers = setNumber(r.Numbers, field, v)
+			}
+		case SourceGeo:
+			for field, p := range doc.Geo {
+				r.Geo = setGeo(r.Geo, field, p)
+			}
+		case SourceVectors:
+			for field, v := range doc.Vectors {
+				r.Vectors = setVector(r.Vectors, field, v)
+			}
+		case SourceNested:
+			r.Nested = doc.Nested
+		default:
+			if values, ok := doc.Keywords[f]; ok {
+				r.Keywords = setKeywords(r.Keywords, f, values)
+			}
+			if v, ok := doc.Numbers[f]; ok {
+				r.Numbers = setNumber(r.Numbers, f, v)
+			}
+			if p, ok := doc.Geo[f]; ok {
+				r.Geo = setGeo(r.Geo, f, p)
+			}
+			if v, ok := doc.Vectors[f]; ok {
+				r.Vectors = setVector(r.Vectors, f, v)
+			}
+		}
+	}
+	return r
+}
+
+// NeedsSource is false if fields asks for nothing but the ID, which needs no
+// document.
+func NeedsSource(fields []string) bool {
+	for _, f := range fields {
+		if f != SourceID {
+			return true
+		}
+	}
+	return false
+}
+
+func setKeywords(m map[string][]string, field string, values []string) map[string][]string {
+	if m == nil {
+		m = make(map[string][]string)
+	}
+	m[field] = values
+	return m
+}
+
+func setNumber(m map[string]float64, field string, v float64) map[string]float64 {
+	if m == nil {
+		m = make(map[string]float64)
+	}
+	m[field] = v
+	return m
+}
+
+func setGeo(m map[string]GeoPoint, field string, p GeoPoint) map[string]GeoPoint {
+	if m == nil {
+		m = make(map[string]GeoPoint)
+	}
+	m[field] = p
+	return m
+}
+
+func setVector(m map[string][]float32, field string, v []float32) map[string][]float32 {
+	if m == nil {
+		m = make(map[string][]float32)
+	}
+	m[field] = v
+	return m
+}
@@ -0,0 +1,302 @@
+package index
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+)
+
+// Span queries
+// Phrases and proximity clauses check positions in one fixed way each. Span
+// queries put such checks together out of parts: a SpanTerm matches the
+// positions of a dictionary key, each a span one position long, and the others
+// match spans made of the spans of their clauses, so they nest. SpanNear matches
+// where there is a span of every clause with at most Slop positions between them
+// that are in none, in the order of the clauses and without overlapping if
+// InOrder is set; SpanOr matches the spans of any of its clauses, SpanNot the
+// spans of Include that overlap none of Exclude, and SpanFirst the spans of Match
+// that end by position End. A document matches if it has a span.
+//
+//	// "quick" followed by "fox" within 3, near "dog" in any order
+//	SpanNear{Clauses: []SpanQuery{
+//		SpanNear{Clauses: []SpanQuery{SpanTerm{"quick"}, SpanTerm{"fox"}}, Slop: 3, InOrder: true},
+//		SpanTerm{"text:dog"},
+//	}, Slop: 10}
+//
+// Positions are per field, so all the terms of a query are keys of one field (see
+// FieldKey).
+// Like PhraseMatches, SpanMatches narrows the documents down by their terms
+// first and works out the spans only for the ones that are left.
+type SpanQuery interface {
+	// spanDocs returns the documents that may have spans, in ascending order.
+	spanDocs(idx *Index) []int
+	// spanner returns the spans of documents asked for in ascending order.
+	spanner(idx *Index) func(id int) []Span
+	appendKeys(keys []string) []string
+}
+
+// Span covers positions Start up to, not including, End.
+type Span struct {
+	Start, End int
+}
+
+type SpanTerm struct {
+	Key string
+}
+
+type SpanNear struct {
+	Clauses []SpanQuery
+	Slop    int
+	InOrder bool
+}
+
+type SpanOr struct {
+	Clauses []SpanQuery
+}
+
+type SpanNot struct {
+	Include, Exclude SpanQuery
+}
+
+type SpanFirst struct {
+	Match SpanQuery
+	End   int
+}
+
+// SpanMatches returns the living documents where q has a span.
+func (idx *Index) SpanMatches(q SpanQuery) []int {
+	spans := q.spanner(idx)
+	var r []int
+	for _, id := range idx.live(q.spanDocs(idx)) {
+		if len(spans(id)) > 0 {
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// Spans returns the spans of q in document id, ordered by where they start.
+func (idx *Index) Spans(q SpanQuery, id int) []Span {
+	return q.spanner(idx)(id)
+}
+
+// SpanKeys returns the keys of the terms of q, which is what it scores with.
+func SpanKeys(q SpanQuery) []string {
+	keys := q.appendKeys(nil)
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+func (q SpanTerm) spanDocs(idx *Index) []int {
+	p, ok := idx.lookup(q.Key)
+	if !ok || !p.hasPositions() {
+		return nil
+	}
+	return p.ids()
+}
+
+func (q SpanTerm) spanner(idx *Index) func(int) []Span {
+	p, ok := idx.lookup(q.Key)
+	if !ok || !p.hasPositions() {
+		return func(int) []Span { return nil }
+	}
+	c := p.cursor()
+	return func(id int) []Span {
+		if !c.seek(id) {
+			return nil
+		}
+		positions := c.positions()
+		r := make([]Span, len(positions))
+		for i, pos := range positions {
+			r[i] = Span{pos, pos + 1}
+		}
+		return r
+	}
+}
+
+func (q SpanTerm) appendKeys(keys []string) []string {
+	return append(keys, q.Key)
+}
+
+func (q SpanNear) spanDocs(idx *Index) []int {
+	if len(q.Clauses) == 0 {
+		return nil
+	}
+	r := q.Clauses[0].spanDocs(idx)
+	for _, c := range q.Clauses[1:] {
+		r = Intersection(r, c.spanDocs(idx))
+	}
+	return r
+}
+
+func (q SpanNear) spanner(idx *Index) func(int) []Span {
+	children := spanners(idx, q.Clauses)
+	return func(id int) []Span {
+		if len(children) == 0 {
+			return nil
+		}
+		lists := make([][]Span, len(children))
+		for i, spans := range children {
+			if lists[i] = spans(id); len(lists[i]) == 0 {
+				return nil
+			}
+		}
+		if q.InOrder {
+			return nearOrdered(lists, q.Slop)
+		}
+		return nearUnordered(lists, q.Slop)
+	}
+}
+
+func (q SpanNear) appendKeys(keys []string) []string {
+	for _, c := range q.Clauses {
+		keys = c.appendKeys(keys)
+	}
+	return keys
+}
+
+// nearOrdered finds, from every span of the first list, the chain of spans of
+// the other lists each starting at or after the end of the one before and ending
+// as early as it can, and keeps it if its gaps add up to at most slop.
+func nearOrdered(lists [][]Span, slop int) []Span {
+	var r []Span
+next:
+	for _, first := range lists[0] {
+		end, length := first.End, first.End-first.Start
+		for _, spans := range lists[1:] {
+			best := -1
+			for j := sort.Search(len(spans), func(j int) bool { return spans[j].Start >= end }); j < len(spans); j++ {
+				if best < 0 || spans[j].End < spans[best].End {
+					best = j
+				}
+			}
+			if best < 0 {
+				continue next
+			}
+			end, length = spans[best].End, length+spans[best].End-spans[best].Start
+		}
+		if end-first.Start-length <= slop {
+			r = append(r, Span{first.Start, end})
+		}
+	}
+	return sortSpans(r)
+}
+
+// nearUnordered walks the lists together like windows does, each time moving
+// past the span that starts first, and keeps every window holding a span of each
+// list whose positions not taken by one add up to at most slop.
+func nearUnordered(lists [][]Span, slop int) []Span {
+	var r []Span
+	at := make([]int, len(lists))
+	for {
+		lo, start, end, length := 0, 0, 0, 0
+		for i, spans := range lists {
+			if at[i] == len(spans) {
+				return sortSpans(r)
+			}
+			s := spans[at[i]]
+			if i == 0 || s.Start < start || s.Start == start && s.End < lists[lo][at[lo]].End {
+				lo, start = i, s.Start
+			}
+			end = max(end, s.End)
+			length += s.End - s.Start
+		}
+		if end-start-length <= slop {
+			r = append(r, Span{start, end})
+		}
+		at[lo]++
+	}
+}
+
+func (q SpanOr) spanDocs(idx *Index) []int {
+	var r []int
+	for _, c := range q.Clauses {
+		r = Union(r, c.spanDocs(idx))
+	}
+	return r
+}
+
+func (q SpanOr) spanner(idx *Index) func(int) []Span {
+	children := spanners(idx, q.Clauses)
+	return func(id int) []Span {
+		var r []Span
+		for _, spans := range children {
+			r = append(r, spans(id)...)
+		}
+		return sortSpans(r)
+	}
+}
+
+func (q SpanOr) appendKeys(keys []string) []string {
+	for _, c := range q.Clauses {
+		keys = c.appendKeys(keys)
+	}
+	return keys
+}
+
+func (q SpanNot) spanDocs(idx *Index) []int {
+	return q.Include.spanDocs(idx)
+}
+
+func (q SpanNot) spanner(idx *Index) func(int) []Span {
+	include, exclude := q.Include.spanner(idx), q.Exclude.spanner(idx)
+	return func(id int) []Span {
+		spans, excluded := include(id), exclude(id)
+		r := spans[:0:0]
+	next:
+		for _, s := range spans {
+			for _, e := range excluded {
+				if s.Start < e.End && e.Start < s.End {
+					continue next
+				}
+			}
+			r = append(r, s)
+		}
+		return r
+	}
+}
+
+// Exclude doesn't score: it only takes matches away.
+func (q SpanNot) appendKeys(keys []string) []string {
+	return q.Include.appendKeys(keys)
+}
+
+func (q SpanFirst) spanDocs(idx *Index) []int {
+	return q.Match.spanDocs(idx)
+}
+
+func (q SpanFirst) spanner(idx *Index) func(int) []Span {
+	match := q.Match.spanner(idx)
+	return func(id int) []Span {
+		var r []Span
+		for _, s := range match(id) {
+			if s.End <= q.End {
+				r = append(r, s)
+			}
+		}
+		return r
+	}
+}
+
+func (q SpanFirst) appendKeys(keys []string) []string {
+	return q.Match.appendKeys(keys)
+}
+
+func spanners(idx *Index, clauses []SpanQuery) []func(int) []Span {
+	r := make([]func(int) []Span, len(clauses))
+	for i, c := range clauses {
+		r[i] = c.spanner(idx)
+	}
+	return r
+}
+
+// sortSpans orders spans by start, then end, without repeats.
+func sortSpans(spans []Span) []Span {
+	slices.SortFunc(spans, func(a, b Span) int {
+		if c := cmp.Compare(a.Start, b.Start); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.End, b.End)
+	})
+	return slices.Compact(spans)
+}
@@ -0,0 +1,166 @@
+package index
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SQL rows
+// Documents can come straight out of an application's database: EachSQL runs a
+// query and maps the columns of every row to fields like a CSV header, by the
+// Loader's Mapping, so "SELECT name AS title, body AS text FROM posts" needs no
+// mapping and "SELECT * FROM posts" one naming the columns. A NULL is a missing
+// value; numbers, blobs and times are read as the text database/sql turns them
+// into. A row number takes the place of the line of a ParseError, counted from 1,
+// and its record is the row written as CSV. The database/sql driver is whatever
+// the caller opened db with, see package sqlite for SQLite.
+func (l Loader) EachSQL(ctx context.Context, db *sql.DB, query string, fn func(Document) error) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	header, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+	m := l.Mapping
+	names := append([]string{m.Title, m.URL, m.Text, m.Boost, m.ID, m.Language}, m.Keywords...)
+	names = append(append(append(names, m.Numbers...), m.Geo...), m.Vectors...)
+	for _, name := range names {
+		if _, ok := columns[name]; name != "" && !ok {
+			return fmt.Errorf("no column %q in the rows of the query", name)
+		}
+	}
+	m = m.withDefaults()
+	if _, ok := columns[m.Text]; !ok {
+		if _, ok := columns[m.Title]; !ok {
+			return errors.New("the query has neither a text nor a title column")
+		}
+	}
+
+	bad := &badRecords{lenient: l.Lenient}
+	values := make([]sql.NullString, len(header))
+	dest := make([]any, len(header))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(header))
+	for n, row := 0, 0; rows.Next(); {
+		row++
+		if err := rows.Scan(dest...); err != nil {
+			if err := bad.add(row, "", err); err != nil {
+				return err
+			}
+			continue
+		}
+		for i, v := range values {
+			record[i] = v.String
+		}
+
+		doc, err := newDocument(m, n, func(name string) (string, bool) {
+			if i, ok := columns[name]; ok && values[i].Valid {
+				return values[i].String, true
+			}
+			return "", false
+		})
+		if err != nil {
+			if err := bad.add(row, csvRecord(record), err); err != nil {
+				return err
+			}
+			continue
+		}
+		n++
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return bad.err()
+}
+
+// LoadSQL returns all documents of the rows of query, like Load.
+func (l Loader) LoadSQL(ctx context.Context, db *sql.DB, query string) ([]Document, error) {
+	var docs []Document
+	err := l.EachSQL(ctx, db, query, func(doc Document) error {
+		docs = append(docs, doc)
+		return nil
+	})
+	if _, ok := err.(ParseErrors); err != nil && !ok {
+		return nil, err
+	}
+	return docs, err
+}
+
+// ParseFieldMapping reads a FieldMapping from fields and the properties or
+// columns they're in, separated by commas: "title=name,text=body,keywords=tag".
+// The lists name one column at a time and can be given again,
+// "numbers=price,numbers=year".
+func ParseFieldMapping(spec string) (FieldMapping, error) {
+	var m FieldMapping
+	if spec == "" {
+		return m, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		field, column, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || column == "" {
+			return FieldMapping{}, fmt.Errorf("bad mapping %q, want field=column", part)
+		}
+		switch field {
+		case "title":
+			m.Title = column
+		case "url":
+			m.URL = column
+		case "text":
+			m.Text = column
+		case "boost":
+			m.Boost = column
+		case "id":
+			m.ID = column
+		case "language":
+			m.Language = column
+		case "keywords":
+			m.Keywords = append(m.Keywords, column)
+		case "numbers":
+			m.Numbers = append(m.Numbers, column)
+		case "geo":
+			m.Geo = append(m.Geo, column)
+		case "vectors":
+			m.Vectors = append(m.Vectors, column)
+		case "nested":
+			m.Nested = append(m.Nested, column)
+		default:
+			return FieldMapping{}, fmt.Errorf("can't map %q: not a field of a document", field)
+		}
+	}
+	return m, nil
+}
+
+// String writes m the way ParseFieldMapping reads it.
+func (m FieldMapping) String() string {
+	var parts []string
+	for _, f := range []struct{ field, column string }{{"title", m.Title}, {"url", m.URL}, {"text", m.Text}, {"boost", m.Boost}, {"id", m.ID}, {"language", m.Language}} {
+		if f.column != "" {
+			parts = append(parts, f.field+"="+f.column)
+		}
+	}
+	for _, f := range []struct {
+		field   string
+		columns []string
+	}{{"keywords", m.Keywords}, {"numbers", m.Numbers}, {"geo", m.Geo}, {"vectors", m.Vectors}, {"nested", m.Nested}} {
+		for _, column := range f.columns {
+			parts = append(parts, f.field+"="+column)
+		}
+	}
+	return strings.Join(parts, ",")
+}
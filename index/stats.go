@@ -0,0 +1,124 @@
+package index
+
+import (
+	"container/heap"
+	"unsafe"
+)
+
+// Statistics
+// A summary of what's in an index, for debugging relevance (which terms dominate
+// the collection, how long documents are) and for capacity planning. Memory is an
+// estimate of what the index holds on the heap: payloads plus a guess at the
+// overhead of slices and map entries, not what the runtime actually allocated,
+// split up by what holds it in Memory and measured against MemoryLimit, if any
+// (see memory.go). An index opened with OpenDisk keeps its posting lists in the mapping, which
+// MappedBytes counts instead. Posting counts and term frequencies include
+// deleted documents until the next Compact.
+type Stats struct {
+	Documents    int         `json:"documents"`
+	Deleted      int         `json:"deleted"`
+	Terms        int         `json:"terms"`
+	Postings     int         `json:"postings"`
+	AvgDocLength float64     `json:"avg_doc_length"`
+	MemoryBytes  int         `json:"memory_bytes"`
+	MappedBytes  int         `json:"mapped_bytes,omitempty"`
+	Memory       MemoryUsage `json:"memory"`
+	MemoryLimit  int         `json:"memory_limit,omitempty"`
+	TopTerms     []TermCount `json:"top_terms"`
+
+	KeywordFields []string `json:"keyword_fields,omitempty"`
+
+	FilterCache FilterCacheStats `json:"filter_cache"`
+}
+
+// TermCount is a term of a field with the number of documents it occurs in.
+type TermCount struct {
+	Field string `json:"field"`
+	Term  string `json:"term"`
+	Docs  int    `json:"docs"`
+}
+
+// StatsTopTerms is the number of terms Stats lists.
+const StatsTopTerms = 20
+
+// Rough per-entry overheads of the maps and slices the index is made of.
+const (
+	mapEntryOverhead = 16
+	sliceHeaderSize  = int(unsafe.Sizeof([]int(nil)))
+	stringHeaderSize = int(unsafe.Sizeof(""))
+	blockHeaderSize  = int(unsafe.Sizeof(postingBlock{}))
+	intSize          = int(unsafe.Sizeof(0))
+)
+
+func (idx *Index) Stats() Stats {
+	st := Stats{
+		Documents:   len(idx.docLen),
+		Deleted:     len(idx.deleted),
+		MemoryLimit: idx.memLimit,
+		TopTerms:    idx.TopTerms(StatsTopTerms),
+
+		KeywordFields: idx.KeywordFields(),
+
+		FilterCache: idx.FilterCacheStats(),
+	}
+	if st.Documents > 0 {
+		st.AvgDocLength = float64(idx.totalLen) / float64(st.Documents)
+	}
+
+	terms := idx.Terms()
+	st.Terms = len(terms)
+	for _, term := range terms {
+		p, _ := idx.lookup(term)
+		st.Postings += p.len()
+	}
+	if idx.disk != nil {
+		st.MappedBytes = len(idx.disk.data)
+	}
+	st.Memory = idx.memoryUsage(terms)
+	st.MemoryBytes = st.Memory.Index()
+	return st
+}
+
+// TopTerms returns the n terms of all fields that occur in the most documents, most
+// first and alphabetically among equals.
+func (idx *Index) TopTerms(n int) []TermCount {
+	if n <= 0 {
+		return nil
+	}
+
+	// resultHeap keeps the best n, with the term's position in the dictionary as
+	// the ID so that ties go to the term first in order.
+	terms := idx.Terms()
+	h := make(resultHeap, 0, min(n, len(terms)))
+	for i, term := range terms {
+		p, _ := idx.lookup(term)
+		r := Result{ID: i, Score: float64(p.len())}
+		if len(h) < n {
+			heap.Push(&h, r)
+		} else if r.Score > h[0].Score {
+			h[0] = r
+			heap.Fix(&h, 0)
+		}
+	}
+
+	r := make([]TermCount, len(h))
+	for i := len(r) - 1; i >= 0; i-- {
+		res := heap.Pop(&h).(Result)
+		field, term := SplitKey(terms[res.ID])
+		r[i] = TermCount{field, term, int(res.Score)}
+	}
+	return r
+}
+
+// memory estimates the heap size of p.
+func (p *postings) memory() int {
+	n := sliceHeaderSize * 4
+	for _, b := range p.Blocks {
+		n += blockHeaderSize + len(b.Data)
+	}
+	n += (len(p.IDs) + len(p.Freqs)) * intSize
+	for _, ps := range p.Positions {
+		n += sliceHeaderSize + len(ps)*intSize
+	}
+	return n
+}
@@ -0,0 +1,273 @@
+package index
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Posting storage
+// An index keeps its posting lists in memory, where they are fastest to search
+// and add to, and Save writes all of them out at once. An index opened with
+// NewWithStorage keeps them in a Storage instead: a list is read from it when a
+// query or a new document needs it, changed lists are held in memory, and Commit
+// writes them along with everything else about the index in one transaction, so
+// a crash loses the changes since the last Commit and nothing else. Reading a
+// list back costs a lookup in the storage and a copy, which makes queries slower
+// than in memory; the per-document numbers stay in memory either way, like with
+// OpenDisk. The query code doesn't notice the difference.
+//
+// MemoryStorage is a Storage in a map, for tests and for indexes that are only
+// committed to be copied; package bolt has one in a BoltDB file.
+type Storage interface {
+	// Get returns a copy of the value of key, nil if there is none.
+	Get(key string) ([]byte, error)
+	// Keys returns every key in ascending order.
+	Keys() ([]string, error)
+	// Write sets and deletes keys all at once or not at all.
+	Write(puts map[string][]byte, deletes []string) error
+	Close() error
+}
+
+// metaKey holds everything but the posting lists, gob-encoded like Save does and
+// sealed with a header and checksum. No dictionary key starts with a NUL byte.
+const metaKey = "\x00index"
+
+// NewWithStorage opens the index kept in s, or a new one if s is empty, analyzing
+// with analyzer or, if that's nil, the standard analyzer it was built with.
+func NewWithStorage(analyzer analysis.Analyzer, s Storage) (*Index, error) {
+	keys, err := s.Keys()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := s.Get(metaKey)
+	if err != nil {
+		return nil, err
+	}
+	var file indexFile
+	if meta != nil {
+		if meta, err = unseal(metaMagic, meta); err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+		if err := gob.NewDecoder(bytes.NewReader(meta)).Decode(&file); err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+	}
+	if analyzer == nil && file.Analyzer != nil {
+		analyzer = file.Analyzer
+	}
+
+	idx := New(analyzer)
+	idx.restore(file)
+	idx.storage = s
+	idx.dropped = make(map[string]struct{})
+	idx.warmed = make(map[string]*postings)
+	for _, key := range keys {
+		if key != metaKey {
+			idx.storedTerms = append(idx.storedTerms, key)
+		}
+	}
+	idx.termsDirty = true
+	return idx, nil
+}
+
+// Storage returns the storage of an index opened with NewWithStorage, or nil.
+func (idx *Index) Storage() Storage {
+	return idx.storage
+}
+
+// stored reads a posting list from the storage.
+func (idx *Index) stored(term string) (*postings, bool) {
+	if _, ok := idx.dropped[term]; ok {
+		return nil, false
+	}
+	if p, ok := idx.warmed[term]; ok {
+		return p, true
+	}
+	data, err := idx.storage.Get(term)
+	if err == nil && data == nil {
+		return nil, false
+	}
+	var p *postings
+	if err == nil {
+		p, err = parseBlocks(data)
+	}
+	if err != nil {
+		// Queries can't fail, so the error waits for the next Commit.
+		idx.storageMu.Lock()
+		if idx.storageErr == nil {
+			idx.storageErr = fmt.Errorf("reading %q: %w", term, err)
+		}
+		idx.storageMu.Unlock()
+		return nil, false
+	}
+	return p, true
+}
+
+// changing returns the posting list of term to be changed, reading it from the
+// storage if it isn't in memory yet; ok is false if there's no such list.
+func (idx *Index) changing(term string) (p *postings, ok bool) {
+	if p, ok = idx.terms[term]; ok || idx.storage == nil {
+		return p, ok
+	}
+	if p, ok = idx.stored(term); ok {
+		idx.terms[term] = p
+	}
+	return p, ok
+}
+
+// drop removes the posting list of term.
+func (idx *Index) drop(term string) {
+	delete(idx.terms, term)
+	delete(idx.warmed, term)
+	if idx.storage != nil {
+		idx.dropped[term] = struct{}{}
+	}
+	idx.termsDirty = true
+}
+
+// Commit prunes the rare terms (see SetMinTermFreq), writes the posting lists
+// changed since the last Commit and the rest of the index to its storage, then
+// frees the lists. It does nothing more for an index without a storage. An
+// error while reading a list since the last Commit is returned too, without
+// writing anything.
+func (idx *Index) Commit() error {
+	idx.prune()
+	if idx.storage == nil {
+		return nil
+	}
+	idx.storageMu.Lock()
+	err := idx.storageErr
+	idx.storageErr = nil
+	idx.storageMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	puts := make(map[string][]byte, len(idx.terms)+1)
+	for term, p := range idx.terms {
+		blocks := p.Blocks
+		if len(p.IDs) > 0 {
+			var ps [][]int
+			if len(p.Positions) == len(p.IDs) {
+				ps = p.Positions
+			}
+			blocks = append(blocks[:len(blocks):len(blocks)], packBlock(p.IDs, p.Freqs, ps))
+		}
+		puts[term] = appendBlocks(nil, blocks)
+	}
+	var meta bytes.Buffer
+	if err := gob.NewEncoder(&meta).Encode(idx.file(nil)); err != nil {
+		return err
+	}
+	puts[metaKey] = seal(metaMagic, meta.Bytes())
+	deletes := make([]string, 0, len(idx.dropped))
+	for term := range idx.dropped {
+		deletes = append(deletes, term)
+	}
+	if err := idx.storage.Write(puts, deletes); err != nil {
+		return err
+	}
+
+	idx.termsMu.Lock()
+	idx.storedTerms = append([]string(nil), idx.termsLocked()...)
+	idx.termsMu.Unlock()
+	for term, p := range idx.terms {
+		if _, ok := idx.warmed[term]; ok {
+			idx.warmed[term] = p
+		}
+	}
+	idx.terms = make(map[string]*postings)
+	idx.dropped = make(map[string]struct{})
+	return nil
+}
+
+// storageTerms is the dictionary of an index with a storage: the stored terms
+// and the new ones in memory, without the dropped ones.
+func (idx *Index) storageTerms() []string {
+	r := make([]string, 0, len(idx.storedTerms)+len(idx.terms))
+	for _, term := range idx.storedTerms {
+		if _, ok := idx.dropped[term]; !ok {
+			r = append(r, term)
+		}
+	}
+	for term := range idx.terms {
+		r = append(r, term)
+	}
+	sort.Strings(r)
+	// Changed lists are both stored and in memory.
+	out := r[:0]
+	for i, term := range r {
+		if i == 0 || term != r[i-1] {
+			out = append(out, term)
+		}
+	}
+	return out
+}
+
+// Memory storage
+type MemoryStorage struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+	closed bool
+}
+
+var errStorageClosed = errors.New("storage closed")
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{values: make(map[string][]byte)}
+}
+
+func (m *MemoryStorage) Get(key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, errStorageClosed
+	}
+	v, ok := m.values[key]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, v...), nil
+}
+
+func (m *MemoryStorage) Keys() ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return nil, errStorageClosed
+	}
+	r := make([]string, 0, len(m.values))
+	for key := range m.values {
+		r = append(r, key)
+	}
+	sort.Strings(r)
+	return r, nil
+}
+
+func (m *MemoryStorage) Write(puts map[string][]byte, deletes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return errStorageClosed
+	}
+	for _, key := range deletes {
+		delete(m.values, key)
+	}
+	for key, v := range puts {
+		m.values[key] = append([]byte{}, v...)
+	}
+	return nil
+}
+
+func (m *MemoryStorage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
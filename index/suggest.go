@@ -0,0 +1,43 @@
+package index
+
+import "sort"
+
+// Spelling suggestions
+// A term that matches nothing is probably misspelled. The candidates are the text
+// terms within two edits of it, fewer edits first and, among equally close ones,
+// the terms found in more documents, since a correction is likelier to be a common
+// word than a rare one. Suggestions are dictionary terms, i.e. stemmed.
+const maxSuggestions = 5
+
+// Suggest returns up to five corrections for term, best first, or nothing if
+// term (analyzed) is found in one of the default fields.
+func (idx *Index) Suggest(term string) []string {
+	tokens := idx.FieldAnalyzer(FieldText).Analyze(term)
+	if len(tokens) == 0 || len(idx.FieldIDs("", tokens[0])) > 0 {
+		return nil
+	}
+
+	var r []string
+	for _, ts := range idx.fuzzyByDistance(FieldText, term, maxFuzzyEdits) {
+		df := make(map[string]int, len(ts))
+		var live []string
+		for _, t := range ts {
+			if n := len(idx.IDs(t)); n > 0 {
+				df[t] = n
+				live = append(live, t)
+			}
+		}
+		sort.Slice(live, func(i, j int) bool {
+			if df[live[i]] != df[live[j]] {
+				return df[live[i]] > df[live[j]]
+			}
+			return live[i] < live[j]
+		})
+
+		r = append(r, live...)
+		if len(r) >= maxSuggestions {
+			return r[:maxSuggestions]
+		}
+	}
+	return r
+}
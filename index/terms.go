@@ -0,0 +1,163 @@
+package index
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Term dictionary
+// The postings map can't answer "which terms start with cat", so next to it we
+// keep the terms in sorted order. These are dictionary keys: terms of fields
+// other than the text are qualified with FieldKey. It's rebuilt lazily the first time it's needed
+// after the vocabulary changed.
+func (idx *Index) Terms() []string {
+	idx.termsMu.Lock()
+	defer idx.termsMu.Unlock()
+
+	return idx.termsLocked()
+}
+
+func (idx *Index) termsLocked() []string {
+	if idx.disk != nil {
+		return idx.disk.sorted
+	}
+	if idx.sortedTerms == nil || idx.termsDirty {
+		if idx.storage != nil {
+			idx.sortedTerms = idx.storageTerms()
+		} else {
+			idx.sortedTerms = make([]string, 0, len(idx.terms))
+			for term := range idx.terms {
+				idx.sortedTerms = append(idx.sortedTerms, term)
+			}
+			sort.Strings(idx.sortedTerms)
+		}
+		idx.termsDirty = false
+		idx.termsGen++
+	}
+	return idx.sortedTerms
+}
+
+// PrefixTerms returns all terms starting with prefix, in order.
+func (idx *Index) PrefixTerms(prefix string) []string {
+	terms := idx.Terms()
+	lo := sort.SearchStrings(terms, prefix)
+	hi := lo
+	for hi < len(terms) && strings.HasPrefix(terms[hi], prefix) {
+		hi++
+	}
+	return terms[lo:hi]
+}
+
+// Wildcards
+// * matches any run of characters (including none) and ? exactly one. Only the
+// part of the pattern before the first wildcard narrows the dictionary down, so
+// patterns with a leading wildcard scan every term of the field.
+func (idx *Index) ExpandWildcard(pattern string) []string {
+	return idx.ExpandFieldWildcard(FieldText, pattern)
+}
+
+// ExpandFieldWildcard returns the dictionary keys in field matching pattern, or
+// in any of the default fields if field is "".
+func (idx *Index) ExpandFieldWildcard(field, pattern string) []string {
+	var r []string
+	for _, f := range searchFields(field) {
+		literal := pattern
+		if i := strings.IndexAny(pattern, "*?"); i >= 0 {
+			literal = pattern[:i]
+		}
+
+		for _, key := range idx.PrefixTerms(FieldKey(f, literal)) {
+			if keyField, term := SplitKey(key); keyField == f && wildcardMatch(pattern, term) {
+				r = append(r, key)
+			}
+		}
+	}
+	return r
+}
+
+// WildcardIDs is the union of the posting lists of every term matching pattern.
+func (idx *Index) WildcardIDs(pattern string) []int {
+	return idx.FieldWildcardIDs(FieldText, pattern)
+}
+
+func (idx *Index) FieldWildcardIDs(field, pattern string) []int {
+	var r []int
+	for _, key := range idx.ExpandFieldWildcard(field, pattern) {
+		r = Union(r, idx.IDs(key))
+	}
+	return r
+}
+
+// Regular expressions
+// A regular expression (RE2 syntax, see regexp/syntax) has to match a whole
+// term, as the analyzer made it, so it usually has to be lowercase. Like with a
+// wildcard, the literal the pattern starts with narrows the dictionary down, and
+// every term after that is matched against the compiled pattern: a scan of the
+// terms, never of the documents.
+func CompileTermRegexp(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// ExpandFieldRegexp returns the dictionary keys in field matching pattern, or in
+// any of the default fields if field is "".
+func (idx *Index) ExpandFieldRegexp(field, pattern string) ([]string, error) {
+	re, err := CompileTermRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+	literal, _ := re.LiteralPrefix()
+
+	var r []string
+	for _, f := range searchFields(field) {
+		for _, key := range idx.PrefixTerms(FieldKey(f, literal)) {
+			if keyField, term := SplitKey(key); keyField == f && re.MatchString(term) {
+				r = append(r, key)
+			}
+		}
+	}
+	return r, nil
+}
+
+// FieldRegexpIDs is the union of the posting lists of every term matching
+// pattern.
+func (idx *Index) FieldRegexpIDs(field, pattern string) ([]int, error) {
+	keys, err := idx.ExpandFieldRegexp(field, pattern)
+	if err != nil {
+		return nil, err
+	}
+	var r []int
+	for _, key := range keys {
+		r = Union(r, idx.IDs(key))
+	}
+	return r, nil
+}
+
+func wildcardMatch(pattern, s string) bool {
+	p, t := []rune(pattern), []rune(s)
+
+	// Classic greedy matching with backtracking to the last star.
+	pi, ti := 0, 0
+	star, mark := -1, 0
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ti
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ti = mark
+		default:
+			return false
+		}
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
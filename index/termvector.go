@@ -0,0 +1,51 @@
+package index
+
+import "sort"
+
+// Term vectors
+// The index only maps terms to documents, so the terms of one document means
+// looking the document up in every posting list. Cursors jump over the blocks
+// that end before it without decoding them, which makes that a pass over the
+// block headers of the dictionary: fine for one document at a time, like for
+// "more like this", explaining a score or exporting features, not for the whole
+// corpus.
+type TermVectorEntry struct {
+	Field     string `json:"field"`
+	Term      string `json:"term"`
+	Freq      int    `json:"freq"`
+	Docs      int    `json:"docs"` // live documents containing the term
+	Positions []int  `json:"positions,omitempty"`
+}
+
+// TermVector returns the analyzed terms of document id, sorted by field and term,
+// with their frequencies and positions in it.
+func (idx *Index) TermVector(id int) ([]TermVectorEntry, error) {
+	if !idx.Has(id) {
+		return nil, ErrNoDocument
+	}
+
+	var r []TermVectorEntry
+	for _, key := range idx.Terms() {
+		p, _ := idx.lookup(key)
+		if p.last() < id {
+			continue
+		}
+		c := p.cursor()
+		if !c.seek(id) {
+			continue
+		}
+		field, term := SplitKey(key)
+		e := TermVectorEntry{Field: field, Term: term, Freq: c.freq(), Docs: idx.docFreq(key)}
+		if p.hasPositions() {
+			e.Positions = append([]int(nil), c.positions()...)
+		}
+		r = append(r, e)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Field != r[j].Field {
+			return r[i].Field < r[j].Field
+		}
+		return r[i].Term < r[j].Term
+	})
+	return r, nil
+}
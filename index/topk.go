@@ -0,0 +1,337 @@
+package index
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sort"
+)
+
+// Top K
+// Most callers only show the first page, yet Rank scores and sorts every match.
+// RankTop keeps the best k in a heap and scores document at a time, with the terms
+// in order of the most they can add to a score: BM25 saturates, so a term never
+// contributes more than its weight times k1+1. Once the heap is full, a document
+// whose partial score plus the bounds of the terms still to come can't beat the
+// worst of the k is dropped without looking at those terms.
+type SearchOptions struct {
+	Limit   int  // results to return, 0 for all
+	Offset  int  // results to skip first
+	Explain bool // fill in Result.Explanation, see Explain
+
+	// Fields to order the results by instead of relevance, see SortField.
+	Sort []SortField
+
+	// A field to keep only the first hit of each value of, see collapse.go.
+	Collapse string
+
+	// A factor for the scores by how far a field is from a value, see decay.go.
+	Decay *Decay
+
+	// A field to have at most so many of the best hits share a value of, see
+	// diversify.go.
+	Diversify *Diversify
+
+	// An embedding to rank the hits by along with the text, see knn.go.
+	Vector *VectorQuery
+
+	// Factors for the scores by how a document matches the query as a whole, see
+	// boosts.go.
+	ProximityBoost  float64
+	CoverageBoost   float64
+	CrossFieldBoost float64
+	ExactBoost      float64
+
+	// Once the context of SearchPage is done, return the hits found so far
+	// flagged as such, see partial.go.
+	ReturnPartialOnTimeout bool
+}
+
+// termCursor scores one term, or one proximity clause if near is set. stats is
+// filled in for every document the term occurs in.
+type termCursor struct {
+	c       *postingCursor
+	near    []*postingCursor
+	keys    []string // of the proximity clause
+	slop    int
+	windows float64 // of the last document scored
+	scorer  Scorer
+	stats   TermStats
+	weight  float64 // the field boost, times the idf sum for proximity
+	bound   float64
+
+	// For a TermGroup, the cursors of each field and their scores of the last
+	// document.
+	fields      []string
+	group       [][]*termCursor
+	groupScores [][]float64
+	fieldScores []float64
+	best        bool
+	tie         float64
+}
+
+// score returns what the cursor adds to the score of id, which must not be lower
+// than the previous one.
+func (c *termCursor) score(idx *Index, id int) float64 {
+	if c.group != nil {
+		return c.scoreGroup(idx, id)
+	}
+	if c.near != nil {
+		positions := make([][]int, len(c.near))
+		for i, nc := range c.near {
+			if !nc.seek(id) {
+				return 0
+			}
+			positions[i] = nc.positions()
+		}
+		sf := windows(positions, c.slop)
+		c.windows = sf
+		return c.weight * sf * (bm25K1 + 1) / (sf + bm25K1)
+	}
+
+	if !c.c.seek(id) {
+		return 0
+	}
+	c.stats.Freq = c.c.freq()
+	c.stats.FieldLength = idx.fieldLength(c.stats.Field, id)
+	return c.weight * c.scorer.Score(c.stats)
+}
+
+// cursors returns a cursor for every distinct term of s and every proximity
+// clause, leaving out terms that aren't in the index.
+func (idx *Index) cursors(s Scoring, st collectionStats) []*termCursor {
+	scorer := idx.currentScorer()
+
+	var r []*termCursor
+	seen := make(map[string]struct{}, len(s.Terms))
+	for _, term := range s.Terms {
+		if _, ok := seen[term]; ok {
+			continue
+		}
+		seen[term] = struct{}{}
+		if c := idx.termCursor(term, 0, scorer, st); c != nil {
+			r = append(r, c)
+		}
+	}
+	for _, p := range s.Proximity {
+		if c := idx.proximityScorer(p, st); c != nil {
+			r = append(r, c)
+		}
+	}
+	for _, g := range s.Groups {
+		if c := idx.groupCursor(g, scorer, st); c != nil {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// termCursor returns a cursor for a dictionary key weighted with weight, or the
+// field boost if that's 0, nil if the key isn't in the index.
+func (idx *Index) termCursor(term string, weight float64, scorer Scorer, st collectionStats) *termCursor {
+	p, ok := idx.lookup(term)
+	if !ok {
+		return nil
+	}
+	field, _ := SplitKey(term)
+	if weight == 0 {
+		weight = idx.FieldBoost(field)
+	}
+	c := &termCursor{
+		c:      p.cursor(),
+		scorer: scorer,
+		stats: TermStats{
+			Term:           term,
+			Field:          field,
+			AvgFieldLength: st.avgFieldLength(field),
+			DocFreq:        st.docFreq(term),
+			DocCount:       st.docCount(),
+		},
+		weight: weight,
+	}
+	c.bound = c.weight * scorer.Bound(c.stats)
+	return c
+}
+
+// RankTop returns the k best of ids (ascending) for terms, best first, ranked the
+// way Rank ranks them.
+func (idx *Index) RankTop(ids []int, terms []string, k int) []Result {
+	return idx.rankTop(ids, Scoring{Terms: terms}, k, idx)
+}
+
+// rankTop is RankTop for all of s with the collection statistics of st.
+func (idx *Index) rankTop(ids []int, s Scoring, k int, st collectionStats) []Result {
+	r, _ := idx.rankTopContext(context.Background(), ids, s, k, st)
+	return r
+}
+
+// Cancelling
+// Ranking checks its context every checkEvery documents. Documents are scored one
+// at a time by rankTop, so when it's cut short the best of the documents scored
+// so far come back with the context's error; rank scores a term at a time, so all
+// it can return then is the error.
+const checkEvery = 1024
+
+func (idx *Index) rankTopContext(ctx context.Context, ids []int, s Scoring, k int, st collectionStats) ([]Result, error) {
+	if k <= 0 || len(ids) == 0 {
+		return nil, nil
+	}
+
+	cursors := idx.cursors(s, st)
+	sort.SliceStable(cursors, func(i, j int) bool {
+		return cursors[i].bound > cursors[j].bound
+	})
+
+	// rest[i] is the most the terms from i on can still add.
+	rest := make([]float64, len(cursors)+1)
+	for i := len(cursors) - 1; i >= 0; i-- {
+		rest[i] = rest[i+1] + cursors[i].bound
+	}
+
+	// A document scorer can do anything with a score, so nothing can be skipped.
+	ds, _ := idx.scorer.(DocumentScorer)
+
+	m := idx.matcher(s)
+	var err error
+	h := make(resultHeap, 0, min(k, len(ids)))
+	for n, id := range ids {
+		if n%checkEvery == 0 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+		}
+		boost := idx.decayFactor(s, id) * m.factor(id)
+		if b, ok := idx.boost[id]; ok {
+			boost *= b
+		}
+		full := len(h) == k
+		threshold := math.Inf(-1)
+		if full {
+			threshold = h[0].Score
+		}
+
+		score, dropped := 0.0, false
+		for i, c := range cursors {
+			// IDs come in ascending order and ties go to the lower ID, so a document
+			// that can at best draw with the heap's worst is out as well.
+			if full && ds == nil && (score+rest[i])*boost <= threshold {
+				dropped = true
+				break
+			}
+			score += c.score(idx, id)
+		}
+		if dropped {
+			continue
+		}
+
+		score *= boost
+		if ds != nil {
+			score = ds.ScoreDocument(id, score)
+		}
+		if !full {
+			heap.Push(&h, Result{ID: id, Score: score})
+		} else if score > threshold {
+			h[0] = Result{ID: id, Score: score}
+			heap.Fix(&h, 0)
+		}
+	}
+
+	r := make([]Result, len(h))
+	for i := len(r) - 1; i >= 0; i-- {
+		r[i] = heap.Pop(&h).(Result)
+	}
+	return r, err
+}
+
+// RankPage ranks ids with s and returns the page opts selects.
+func (idx *Index) RankPage(ids []int, s Scoring, opts SearchOptions) []Result {
+	r, _ := idx.RankPageContext(context.Background(), ids, s, opts)
+	return r
+}
+
+// RankPageContext is RankPage giving up once ctx is done. It then returns the
+// context's error, with the best hits of those ranked so far if there are any.
+func (idx *Index) RankPageContext(ctx context.Context, ids []int, s Scoring, opts SearchOptions) ([]Result, error) {
+	s = opts.scoring(s)
+	var r []Result
+	var err error
+	end := max(opts.Offset, 0) + opts.Limit
+	var fused map[int]HybridExplanation
+	if opts.Vector != nil && len(opts.Sort) == 0 {
+		// Ranked by the text and the vector together, see knn.go.
+		window := end
+		if opts.Diversify != nil && opts.Limit > 0 {
+			window = opts.Diversify.window(end)
+		}
+		if r, fused, err = idx.rankHybrid(ctx, ids, s, *opts.Vector, window); err != nil {
+			return nil, err
+		}
+		r = idx.regroup(r, opts, end)
+	} else if len(opts.Sort) > 0 || opts.Collapse != "" {
+		// Every match has to be scored and sorted to know the first page.
+		if r, err = idx.rankContext(ctx, ids, s); err != nil {
+			return nil, err
+		}
+		if len(opts.Sort) > 0 {
+			idx.sortResults(r, opts.Sort)
+		}
+		r = idx.regroup(r, opts, end)
+	} else if opts.Diversify != nil {
+		if opts.Limit > 0 {
+			r, err = idx.rankTopContext(ctx, ids, s, opts.Diversify.window(end), idx)
+		} else if r, err = idx.rankContext(ctx, ids, s); err != nil {
+			return nil, err
+		}
+		r = idx.regroup(r, opts, end)
+	} else if opts.Limit > 0 {
+		r, err = idx.rankTopContext(ctx, ids, s, opts.Offset+opts.Limit, idx)
+	} else if r, err = idx.rankContext(ctx, ids, s); err != nil {
+		return nil, err
+	}
+	r = r[min(max(opts.Offset, 0), len(r)):]
+	if opts.Explain {
+		for i := range r {
+			e := idx.Explain(r[i].ID, s)
+			if h, ok := fused[r[i].ID]; ok {
+				e.Hybrid = &h
+			}
+			r[i].Explanation = &e
+		}
+	}
+	return r, err
+}
+
+// regroup collapses and diversifies r, ranked already, as opts says, and cuts it
+// at the end of the page.
+func (idx *Index) regroup(r []Result, opts SearchOptions, end int) []Result {
+	if opts.Collapse != "" {
+		r = idx.collapse(r, opts.Collapse)
+	}
+	if opts.Diversify != nil {
+		r = idx.diversify(r, *opts.Diversify, end)
+	}
+	if opts.Limit > 0 {
+		r = r[:min(end, len(r))]
+	}
+	return r
+}
+
+// resultHeap is a min-heap with the worst result on top: the lowest score, and of
+// equal scores the higher ID.
+type resultHeap []Result
+
+func (h resultHeap) Len() int { return len(h) }
+func (h resultHeap) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score < h[j].Score
+	}
+	return h[i].ID > h[j].ID
+}
+func (h resultHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)   { *h = append(*h, x.(Result)) }
+func (h *resultHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,114 @@
+package index
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Document vectors
+// ExportVectors writes every document as a sparse TF-IDF vector in the libsvm
+// (svmlight) format that scikit-learn, LIBLINEAR, XGBoost and most other ML tools
+// read, so the index can be the feature extraction step of a classifier or a
+// clustering job:
+//
+//	label feature:weight feature:weight ... # id
+//
+// A feature is a dictionary key of one of the fields, numbered from 1 in
+// dictionary order, and its weight in a document is weighed like MoreLikeThis
+// does, the times it occurs there times its BM25 IDF; each vector is scaled to
+// length 1 unless Raw is set. The label is the value of the numeric field Label,
+// 0 for documents without one or if there is no Label. The ID after the # is a
+// comment to the tools that tells which document a line is.
+//
+// If vocab isn't nil it gets the features, one per line: number, field, term and
+// document frequency, separated by tabs.
+type VectorOptions struct {
+	Fields     []string // DefaultFields if empty
+	MinDocFreq int      // documents a term has to be in to be a feature
+	MaxDocFreq float64  // fraction of the documents a term may be in at most, 0 for any
+	Label      string
+	Raw        bool
+}
+
+// ExportVectors returns the number of features.
+func (idx *Index) ExportVectors(w, vocab io.Writer, opts VectorOptions) (int, error) {
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	docs := idx.docCount()
+	maxDocs := docs
+	if opts.MaxDocFreq > 0 {
+		maxDocs = int(opts.MaxDocFreq * float64(docs))
+	}
+
+	type feature struct {
+		n      int
+		weight float64
+	}
+	vectors := make(map[int][]feature)
+	var vw *bufio.Writer
+	if vocab != nil {
+		vw = bufio.NewWriter(vocab)
+	}
+	n := 0
+	for _, key := range idx.Terms() {
+		field, term := SplitKey(key)
+		if !slices.Contains(fields, field) {
+			continue
+		}
+		p, _ := idx.lookup(key)
+		ids, freqs := idx.livePostings(p)
+		if len(ids) == 0 || len(ids) < opts.MinDocFreq || len(ids) > maxDocs {
+			continue
+		}
+		n++
+		idf := bm25IDF(len(ids), docs)
+		for i, id := range ids {
+			vectors[id] = append(vectors[id], feature{n, float64(freqs[i]) * idf})
+		}
+		if vw != nil {
+			fmt.Fprintf(vw, "%d\t%s\t%s\t%d\n", n, field, term, len(ids))
+		}
+	}
+	if vw != nil {
+		if err := vw.Flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	var line []byte
+	for _, id := range idx.AllIDs() {
+		v := vectors[id]
+		scale := 1.0
+		if !opts.Raw {
+			sum := 0.0
+			for _, f := range v {
+				sum += f.weight * f.weight
+			}
+			if sum > 0 {
+				scale = 1 / math.Sqrt(sum)
+			}
+		}
+
+		line = strconv.AppendFloat(line[:0], idx.numbers[opts.Label][id], 'g', -1, 64)
+		for _, f := range v {
+			line = append(line, ' ')
+			line = strconv.AppendInt(line, int64(f.n), 10)
+			line = append(line, ':')
+			line = strconv.AppendFloat(line, f.weight*scale, 'g', 6, 64)
+		}
+		line = append(line, " # "...)
+		line = strconv.AppendInt(line, int64(id), 10)
+		line = append(line, '\n')
+		if _, err := bw.Write(line); err != nil {
+			return 0, err
+		}
+	}
+	return n, bw.Flush()
+}
@@ -0,0 +1,138 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+)
+
+// Loading and warming up
+// Load reads every posting list of a saved index before the first query, which
+// makes the queries fast and the startup slow. OpenDisk and NewWithStorage do the
+// opposite: they start at once and read a list when a query first needs it, the
+// mapped index keeping what it read, the stored one reading it again each time.
+// OpenDiskMode lets the caller pick for a file written by SaveDisk: LoadEager
+// reads all of it into an ordinary in-memory index, which can be changed, and
+// LoadLazy maps it like OpenDisk.
+//
+// Either way the first queries for the common terms of a lazy index pay for
+// reading them. Warmup reads those ahead of time, for example at startup from a
+// list of the most searched terms, and keeps them in memory from then on.
+type LoadMode int
+
+const (
+	LoadLazy LoadMode = iota
+	LoadEager
+)
+
+// OpenDiskMode opens an index written by SaveDisk with the given loading mode.
+func OpenDiskMode(path string, analyzer analysis.Analyzer, mode LoadMode) (*Index, error) {
+	idx, err := OpenDisk(path, analyzer)
+	if err != nil || mode == LoadLazy {
+		return idx, err
+	}
+	if err := idx.Verify(); err != nil {
+		idx.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	terms := make(map[string]*postings, len(idx.disk.sorted))
+	for _, term := range idx.disk.sorted {
+		p, ok := idx.disk.parse(term)
+		if !ok {
+			idx.Close()
+			return nil, fmt.Errorf("%s: posting list of %q: truncated", path, term)
+		}
+		terms[term] = p.copyBlocks()
+	}
+	idx.terms = terms
+	idx.termsDirty = true
+	if err := idx.Close(); err != nil {
+		return nil, err
+	}
+	idx.disk = nil
+	return idx, nil
+}
+
+// copyBlocks copies block data that points into a mapping or a storage buffer.
+func (p *postings) copyBlocks() *postings {
+	r := &postings{Blocks: make([]postingBlock, len(p.Blocks))}
+	for i, b := range p.Blocks {
+		b.Data = append([]byte(nil), b.Data...)
+		r.Blocks[i] = b
+	}
+	return r
+}
+
+// Warmup reads the posting lists of terms in every field into memory and returns
+// how many it read. The terms are analyzed like query text, so "Running" warms
+// up the list of "run" with the stemmer on. Lists that are in memory already,
+// which is all of them for an index built or loaded in memory, don't count.
+//
+// Warmup changes the index, so it can't run alongside searches of a Shared index
+// unless it has the write lock.
+func (idx *Index) Warmup(terms []string) int {
+	if idx.disk == nil && idx.storage == nil {
+		return 0
+	}
+
+	fields := make([]string, 0, len(idx.fieldTotal)+1)
+	fields = append(fields, FieldText)
+	for field := range idx.fieldTotal {
+		if field != FieldText {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	n := 0
+	seen := make(map[string]struct{})
+	for _, term := range terms {
+		for _, field := range fields {
+			for _, token := range idx.FieldAnalyzer(field).Analyze(term) {
+				key := FieldKey(field, token)
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+				if idx.warm(key) {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// warm reads one list into memory, reporting whether it wasn't there yet.
+func (idx *Index) warm(key string) bool {
+	if d := idx.disk; d != nil {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.warm[key] {
+			return false
+		}
+		p, ok := d.parse(key)
+		if !ok {
+			return false
+		}
+		// Copying the data out of the mapping keeps the operating system
+		// from paging it out again.
+		d.cache[key] = p.copyBlocks()
+		d.warm[key] = true
+		return true
+	}
+
+	if _, ok := idx.terms[key]; ok {
+		return false
+	}
+	if _, ok := idx.warmed[key]; ok {
+		return false
+	}
+	p, ok := idx.stored(key)
+	if ok {
+		idx.warmed[key] = p
+	}
+	return ok
+}
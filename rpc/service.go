@@ -0,0 +1,199 @@
+// Package rpc serves a server.Server over gRPC, see ftspb/fts.proto.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/rpc/ftspb"
+	"github.com/leoashish/FullTextSearchApp/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Service
+// The same operations as the JSON API: every call goes through the server, so
+// both see the same documents and take the same locks. A missing document is
+// NotFound, a query that doesn't parse InvalidArgument. API keys (see
+// server.Auth) go in the x-api-key or authorization metadata; a missing one is
+// Unauthenticated, a read-only one PermissionDenied for a change.
+type Service struct {
+	ftspb.UnimplementedSearchServer
+	srv *server.Server
+}
+
+func New(srv *server.Server) *Service {
+	return &Service{srv: srv}
+}
+
+// Register adds the service to a gRPC server.
+func (s *Service) Register(g *grpc.Server) {
+	ftspb.RegisterSearchServer(g, s)
+}
+
+func (s *Service) IndexDocument(ctx context.Context, req *ftspb.IndexDocumentRequest) (*ftspb.IndexDocumentResponse, error) {
+	if err := s.authorize(ctx, true); err != nil {
+		return nil, err
+	}
+	pb := req.GetDocument()
+	if pb.GetText() == "" && pb.GetTitle() == "" {
+		return nil, status.Error(codes.InvalidArgument, "document has no title or text")
+	}
+
+	doc := index.Document{Title: pb.GetTitle(), URL: pb.GetUrl(), Text: pb.GetText(), Boost: pb.GetBoost(), Language: pb.GetLanguage()}
+	if doc.Boost == 0 {
+		doc.Boost = index.DefaultBoost
+	}
+	for field, values := range pb.GetKeywords() {
+		if doc.Keywords == nil {
+			doc.Keywords = make(map[string][]string)
+		}
+		doc.Keywords[field] = values.GetValues()
+	}
+	if len(pb.GetNumbers()) > 0 {
+		doc.Numbers = pb.GetNumbers()
+	}
+
+	if pb.Id == nil {
+		id, err := s.srv.Add(doc)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &ftspb.IndexDocumentResponse{Id: int64(id)}, nil
+	}
+
+	doc.ID = int(pb.GetId())
+	if err := s.srv.Update(doc); err != nil {
+		return nil, statusOf(err)
+	}
+	return &ftspb.IndexDocumentResponse{Id: pb.GetId()}, nil
+}
+
+func (s *Service) DeleteDocument(ctx context.Context, req *ftspb.DeleteDocumentRequest) (*ftspb.DeleteDocumentResponse, error) {
+	if err := s.authorize(ctx, true); err != nil {
+		return nil, err
+	}
+	if err := s.srv.Delete(int(req.GetId())); err != nil {
+		return nil, statusOf(err)
+	}
+	return &ftspb.DeleteDocumentResponse{}, nil
+}
+
+func (s *Service) Search(ctx context.Context, req *ftspb.SearchRequest) (*ftspb.SearchResponse, error) {
+	if err := s.authorize(ctx, false); err != nil {
+		return nil, err
+	}
+	sreq, err := searchRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if sreq.Limit == 0 {
+		sreq.Limit = server.DefaultLimit
+	}
+
+	resp, err := s.srv.Search(sreq)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	r := &ftspb.SearchResponse{Total: int64(resp.Total), DidYouMean: resp.DidYouMean}
+	for _, h := range resp.Hits {
+		r.Hits = append(r.Hits, hitOf(h))
+	}
+	for field, counts := range resp.Facets {
+		if r.Facets == nil {
+			r.Facets = make(map[string]*ftspb.FacetCounts)
+		}
+		fc := &ftspb.FacetCounts{}
+		for _, c := range counts {
+			fc.Counts = append(fc.Counts, &ftspb.FacetCount{Value: c.Value, Count: int64(c.Count)})
+		}
+		r.Facets[field] = fc
+	}
+	return r, nil
+}
+
+// SearchStream ranks once and then sends the hits one by one, stopping early if
+// the client goes away.
+func (s *Service) SearchStream(req *ftspb.SearchRequest, stream grpc.ServerStreamingServer[ftspb.Hit]) error {
+	if err := s.authorize(stream.Context(), false); err != nil {
+		return err
+	}
+	sreq, err := searchRequest(req)
+	if err != nil {
+		return err
+	}
+	sreq.All = sreq.Limit == 0
+	sreq.Facets = nil
+
+	resp, err := s.srv.Search(sreq)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	for _, h := range resp.Hits {
+		if err := stream.Context().Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if err := stream.Send(hitOf(h)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) authorize(ctx context.Context, write bool) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	key := ""
+	if v := md.Get("x-api-key"); len(v) > 0 {
+		key = v[0]
+	} else if v := md.Get("authorization"); len(v) > 0 {
+		key = strings.TrimPrefix(v[0], "Bearer ")
+	}
+	switch err := s.srv.Authorize(key, write); err {
+	case nil:
+		return nil
+	case server.ErrUnauthenticated:
+		return status.Error(codes.Unauthenticated, err.Error())
+	default:
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+}
+
+func searchRequest(req *ftspb.SearchRequest) (server.SearchRequest, error) {
+	if req.GetQuery() == "" {
+		return server.SearchRequest{}, status.Error(codes.InvalidArgument, "missing query")
+	}
+	if req.GetLimit() < 0 || req.GetOffset() < 0 || req.GetFacetSize() < 0 {
+		return server.SearchRequest{}, status.Error(codes.InvalidArgument, "negative limit, offset or facet_size")
+	}
+
+	r := server.SearchRequest{
+		Query:     req.GetQuery(),
+		Limit:     int(req.GetLimit()),
+		Offset:    int(req.GetOffset()),
+		Facets:    req.GetFacets(),
+		FacetSize: int(req.GetFacetSize()),
+	}
+	if r.FacetSize == 0 {
+		r.FacetSize = server.DefaultFacetSize
+	}
+	return r, nil
+}
+
+func hitOf(h server.Hit) *ftspb.Hit {
+	return &ftspb.Hit{Id: int64(h.ID), Score: h.Score, Title: h.Title, Url: h.URL}
+}
+
+func statusOf(err error) error {
+	if errors.Is(err, index.ErrNoDocument) {
+		return status.Error(codes.NotFound, "document not found")
+	}
+	if errors.Is(err, index.ErrMemoryLimit) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+func TestProximityBoost(t *testing.T) {
+	idx := index.New(nil)
+	idx.Add([]index.Document{
+		{ID: 0, Text: "black dogs chase a red car"},
+		{ID: 1, Text: "dogs chase a red black automobile"},
+	})
+	idx.SetSynonyms(analysis.NewSynonyms([][]string{{"car", "automobile"}}, idx.Analyzer()))
+	tests := []struct {
+		query string
+		first int
+	}{
+		{"black car", 1},
+		{"black automobile", 1},
+		{"black OR car", 1},
+		{"+black +car", 1},
+		{`"red car" OR black`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r, _, err := QueryWithOptions(idx, tt.query, index.SearchOptions{ProximityBoost: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r) != 2 {
+				t.Fatalf("%d hits, want 2", len(r))
+			}
+			if r[0].ID != tt.first {
+				t.Errorf("%d first, want %d", r[0].ID, tt.first)
+			}
+		})
+	}
+}
+
+func TestExactBoost(t *testing.T) {
+	idx := index.New(nil)
+	idx.SetExactForms(true)
+	idx.Add([]index.Document{
+		{ID: 0, Title: "Cat", Text: "a black cat"},
+		{ID: 1, Title: "Cat", Text: "black cats"},
+	})
+	for _, query := range []string{"cats", "text:cats", "black cats", "cats OR dogs", "+black cats"} {
+		t.Run(query, func(t *testing.T) {
+			r, _, err := QueryWithOptions(idx, query, index.SearchOptions{ExactBoost: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(r) != 2 || r[0].ID != 1 {
+				t.Errorf("hits %v, want 1 first of 2", r)
+			}
+		})
+	}
+}
+
+func TestCoverageBoost(t *testing.T) {
+	idx := index.New(nil)
+	idx.Add([]index.Document{
+		{ID: 0, Text: "a zebra in a field"},
+		{ID: 1, Text: "a cat and a dog"},
+		{ID: 2, Text: "a cat"},
+		{ID: 3, Text: "a dog"},
+		{ID: 4, Text: "a cat and a bird"},
+		{ID: 5, Text: "a dog and a bird"},
+	})
+	tests := []struct {
+		query string
+		boost float64
+		first int
+	}{
+		// The rare zebra outscores the two common words without the boost.
+		{"zebra OR cat OR dog", 0, 0},
+		{"zebra OR cat OR dog", 1, 1},
+		{"zebra OR zebra OR cat OR dog", 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			for _, limit := range []int{0, 1} {
+				r, _, err := QueryWithOptions(idx, tt.query, index.SearchOptions{Limit: limit, CoverageBoost: tt.boost})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(r) == 0 || r[0].ID != tt.first {
+					t.Errorf("limit %d, boost %v: hits %v, want %d first", limit, tt.boost, r, tt.first)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Structured queries
+// Go code that puts queries together doesn't have to write them out as strings
+// and get the quoting right: a Clause is the same query as a tree of values. Text
+// in a clause is taken as it is, never as query syntax, so Term("", "C++ AND")
+// looks for those words and nothing else. Terms and phrases are still analyzed
+// like in a query string, with the field's analyzer and for every language of the
+// index, and a term or phrase on a keyword field filters on the exact value.
+//
+//	q := search.BoolQuery{
+//		Must:   []search.Clause{search.Phrase("title", "wild cat")},
+//		Should: []search.Clause{search.Term("", "small")},
+//		Filter: []search.Clause{search.Range("year").From(1990), search.Term("category", "Animals")},
+//	}
+//	results, total, err := search.Run(idx, q, index.SearchOptions{Limit: 10})
+//
+// A field of "" means the default fields. Naming a field the index doesn't have is
+// an error, unlike in a query string where "foo:bar" is just a term.
+type Clause interface {
+	node(c *compiler) (Node, error)
+}
+
+// TermQuery matches documents with every token the analyzer makes of Term.
+type TermQuery struct {
+	Field string
+	Term  string
+}
+
+// PhraseQuery matches the words of Text next to each other and in order, or with
+// a Slop above 0 in any order with at most Slop other words among them, like
+// "..."~N.
+type PhraseQuery struct {
+	Field string
+	Text  string
+	Slop  int
+}
+
+// RangeQuery filters a numeric or date field, see index.Range.
+type RangeQuery struct {
+	Field string
+	Range index.Range
+}
+
+// GeoDistanceQuery filters a geo field on the points at most Meters away from
+// Center, see index.GeoDistanceIDs.
+type GeoDistanceQuery struct {
+	Field  string
+	Center index.GeoPoint
+	Meters float64
+}
+
+type WildcardQuery struct {
+	Field   string
+	Pattern string // with * and ?
+}
+
+// RegexpQuery matches the terms of a text field matching Pattern as a whole, see
+// index.CompileTermRegexp.
+type RegexpQuery struct {
+	Field   string
+	Pattern string
+}
+
+type FuzzyQuery struct {
+	Field    string
+	Term     string
+	MaxEdits int
+}
+
+// BoolQuery combines clauses. Every Must and Filter clause has to match and no
+// MustNot clause may. Should clauses add to the score; without Must and Filter
+// clauses at least one of them has to match, and with MinimumShouldMatch above 0
+// that many of them do whatever else there is. Filter clauses don't score, nor do
+// MustNot ones, and what Filter clauses match is cached (see Filters). A
+// BoolQuery with only MustNot clauses matches everything else, and an empty one
+// everything.
+type BoolQuery struct {
+	Must    []Clause
+	Should  []Clause
+	MustNot []Clause
+	Filter  []Clause
+
+	MinimumShouldMatch int
+}
+
+func Term(field, term string) TermQuery {
+	return TermQuery{field, term}
+}
+
+func Phrase(field, text string) PhraseQuery {
+	return PhraseQuery{Field: field, Text: text}
+}
+
+// Within turns the phrase into a proximity query with the given slop.
+func (q PhraseQuery) Within(slop int) PhraseQuery {
+	q.Slop = slop
+	return q
+}
+
+// Range starts a range on field that is open at both ends; From, Above, To and
+// Below close it.
+func Range(field string) RangeQuery {
+	return RangeQuery{field, index.Range{Min: math.Inf(-1), Max: math.Inf(1)}}
+}
+
+func (q RangeQuery) From(min float64) RangeQuery {
+	q.Range.Min, q.Range.ExcludeMin = min, false
+	return q
+}
+
+func (q RangeQuery) Above(min float64) RangeQuery {
+	q.Range.Min, q.Range.ExcludeMin = min, true
+	return q
+}
+
+func (q RangeQuery) To(max float64) RangeQuery {
+	q.Range.Max, q.Range.ExcludeMax = max, false
+	return q
+}
+
+func (q RangeQuery) Below(max float64) RangeQuery {
+	q.Range.Max, q.Range.ExcludeMax = max, true
+	return q
+}
+
+func GeoDistance(field string, lat, lon, meters float64) GeoDistanceQuery {
+	return GeoDistanceQuery{field, index.GeoPoint{Lat: lat, Lon: lon}, meters}
+}
+
+func Wildcard(field, pattern string) WildcardQuery {
+	return WildcardQuery{field, pattern}
+}
+
+func Regexp(field, pattern string) RegexpQuery {
+	return RegexpQuery{field, pattern}
+}
+
+func Fuzzy(field, term string, maxEdits int) FuzzyQuery {
+	return FuzzyQuery{field, term, maxEdits}
+}
+
+// And, Or and Not are the BoolQuery of only Must, Should or MustNot clauses.
+func And(clauses ...Clause) BoolQuery {
+	return BoolQuery{Must: clauses}
+}
+
+func Or(clauses ...Clause) BoolQuery {
+	return BoolQuery{Should: clauses}
+}
+
+func Not(clauses ...Clause) BoolQuery {
+	return BoolQuery{MustNot: clauses}
+}
+
+// Run is QueryWithOptions for a clause.
+func Run(idx *index.Index, q Clause, opts index.SearchOptions) ([]index.Result, int, error) {
+	return RunContext(context.Background(), idx, q, opts)
+}
+
+// RunContext is QueryContext for a clause.
+func RunContext(ctx context.Context, idx *index.Index, q Clause, opts index.SearchOptions) ([]index.Result, int, error) {
+	node, err := Compile(idx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, scoring, err := evaluate(ctx, idx, node)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := idx.RankPageContext(ctx, ids, scoring, opts)
+	return r, len(ids), err
+}
+
+// EvaluateClause is Evaluate for a clause.
+func EvaluateClause(idx *index.Index, q Clause) ([]int, index.Scoring, error) {
+	node, err := Compile(idx, q)
+	if err != nil {
+		return nil, index.Scoring{}, err
+	}
+	return evaluate(context.Background(), idx, node)
+}
+
+// Compile turns a clause into the tree a query string parses into.
+func Compile(idx *index.Index, q Clause) (Node, error) {
+	c := &compiler{&queryParser{analyzer: idx.Analyzer(), isKeyword: idx.IsKeywordField, languages: idx.Languages()}, idx}
+	return q.node(c)
+}
+
+type compiler struct {
+	*queryParser
+	idx *index.Index
+}
+
+// text checks that field can be searched for words and returns its analyzer.
+// keyword is true for a keyword field.
+func (c *compiler) text(field string) (a analysis.Analyzer, keyword bool, err error) {
+	switch {
+	case field == "":
+		return c.analyzer, false, nil
+	case c.isKeyword(field):
+		return nil, true, nil
+	case index.IsField(field):
+		return analysis.ForField(c.analyzer, field), false, nil
+	case c.idx.IsNumericField(field):
+		return nil, false, fmt.Errorf("%s is a numeric field, use a RangeQuery", field)
+	case c.idx.IsGeoField(field):
+		return nil, false, fmt.Errorf("%s is a geo field, use a GeoDistanceQuery", field)
+	}
+	return nil, false, fmt.Errorf("unknown field %q", field)
+}
+
+func (q TermQuery) node(c *compiler) (Node, error) {
+	a, keyword, err := c.text(q.Field)
+	if err != nil {
+		return nil, err
+	}
+	if keyword {
+		return keywordNode{q.Field, q.Term}, nil
+	}
+	return c.anyLanguage(a, q.Term, func(tokens []string) Node {
+		return termNode{q.Field, tokens, q.Term}
+	}), nil
+}
+
+func (q PhraseQuery) node(c *compiler) (Node, error) {
+	a, keyword, err := c.text(q.Field)
+	if err != nil {
+		return nil, err
+	}
+	if keyword {
+		return keywordNode{q.Field, q.Text}, nil
+	}
+	slop := -1
+	if q.Slop > 0 {
+		slop = q.Slop
+	}
+	return c.phrase(q.Field, queryToken{text: q.Text, phrase: true, slop: slop}, a), nil
+}
+
+func (q RangeQuery) node(c *compiler) (Node, error) {
+	if q.Field == "" || index.IsField(q.Field) || c.isKeyword(q.Field) {
+		return nil, fmt.Errorf("%q is not a numeric field", q.Field)
+	}
+	return rangeNode{q.Field, q.Range}, nil
+}
+
+func (q GeoDistanceQuery) node(c *compiler) (Node, error) {
+	if q.Field == "" || index.IsField(q.Field) || c.isKeyword(q.Field) {
+		return nil, fmt.Errorf("%q is not a geo field", q.Field)
+	}
+	if !q.Center.Valid() || q.Meters < 0 || math.IsNaN(q.Meters) {
+		return nil, fmt.Errorf("bad distance %v from %v", q.Meters, q.Center)
+	}
+	return geoNode{q.Field, q.Center, q.Meters}, nil
+}
+
+func (q WildcardQuery) node(c *compiler) (Node, error) {
+	if _, keyword, err := c.text(q.Field); err != nil {
+		return nil, err
+	} else if keyword {
+		return nil, fmt.Errorf("%s is a keyword field, wildcards only work on text", q.Field)
+	}
+	return wildcardNode{q.Field, strings.ToLower(q.Pattern)}, nil
+}
+
+func (q RegexpQuery) node(c *compiler) (Node, error) {
+	if _, keyword, err := c.text(q.Field); err != nil {
+		return nil, err
+	} else if keyword {
+		return nil, fmt.Errorf("%s is a keyword field, regular expressions only work on text", q.Field)
+	}
+	if _, err := index.CompileTermRegexp(q.Pattern); err != nil {
+		return nil, err
+	}
+	return regexpNode{q.Field, q.Pattern}, nil
+}
+
+func (q FuzzyQuery) node(c *compiler) (Node, error) {
+	if _, keyword, err := c.text(q.Field); err != nil {
+		return nil, err
+	} else if keyword {
+		return nil, fmt.Errorf("%s is a keyword field, fuzzy terms only work on text", q.Field)
+	}
+	if q.MaxEdits < 0 {
+		return nil, fmt.Errorf("negative edit distance %d", q.MaxEdits)
+	}
+	return fuzzyNode{q.Field, q.Term, q.MaxEdits}, nil
+}
+
+func (q BoolQuery) node(c *compiler) (Node, error) {
+	var n boolNode
+	for _, group := range []struct {
+		clauses []Clause
+		nodes   *[]Node
+	}{{q.Must, &n.must}, {q.Should, &n.should}, {q.MustNot, &n.mustNot}, {q.Filter, &n.filter}} {
+		for _, clause := range group.clauses {
+			child, err := clause.node(c)
+			if err != nil {
+				return nil, err
+			}
+			if group.nodes == &n.filter {
+				child = filterNode{child}
+			}
+			*group.nodes = append(*group.nodes, child)
+		}
+	}
+	if q.MinimumShouldMatch < 0 {
+		return nil, fmt.Errorf("negative minimum should match %d", q.MinimumShouldMatch)
+	}
+	n.minShould = min(q.MinimumShouldMatch, len(q.Should))
+	return n, nil
+}
+
+// boolNode is a BoolQuery; the query language has no optional clauses, so it
+// needs a node of its own.
+type boolNode struct {
+	must, should, mustNot, filter []Node
+	minShould                     int
+}
+
+func (n boolNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	children := append(slices.Clip(n.must), n.filter...)
+	if n.minShould > 0 {
+		children = append(children, minShouldNode{children: n.should, min: n.minShould})
+	} else if len(children) == 0 && len(n.should) > 0 {
+		children = append(children, orNode{n.should})
+	}
+	for _, child := range n.mustNot {
+		children = append(children, notNode{child})
+	}
+	return andNode{children}.eval(ctx, idx)
+}
+
+// scoring is what of n adds to the score.
+func (n boolNode) scoring() []Node {
+	return append(slices.Clip(n.must), n.should...)
+}
@@ -0,0 +1,179 @@
+package search
+
+import (
+	"container/heap"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Completion
+// Autocomplete gets its own structure instead of going through the inverted index:
+// a trie over normalized phrases where every node remembers the best weight found
+// below it. Complete walks down to the prefix and then expands the most promising
+// nodes first, so it can stop as soon as it has enough completions.
+type WeightedPhrase struct {
+	Phrase string
+	Weight float64
+}
+
+type completionNode struct {
+	children map[rune]*completionNode
+	phrase   int // index into phrases, -1 if no phrase ends here
+	best     float64
+}
+
+type CompletionIndex struct {
+	root    *completionNode
+	phrases []WeightedPhrase
+}
+
+func newCompletionNode() *completionNode {
+	return &completionNode{children: make(map[rune]*completionNode), phrase: -1}
+}
+
+// Phrases are normalized the way the tokenizer sees them: lowercased words joined
+// by single spaces, so "Wild  Cat!" and "wild cat" complete the same way.
+func normalizePhrase(phrase string) string {
+	return strings.Join(analysis.LowercaseFilter(analysis.Tokenize(phrase)), " ")
+}
+
+func BuildCompletionIndex(phrases []WeightedPhrase) *CompletionIndex {
+	ci := &CompletionIndex{root: newCompletionNode()}
+
+	for _, p := range phrases {
+		key := normalizePhrase(p.Phrase)
+		if key == "" {
+			continue
+		}
+
+		node := ci.root
+		path := []*completionNode{node}
+		for _, r := range key {
+			child, ok := node.children[r]
+			if !ok {
+				child = newCompletionNode()
+				node.children[r] = child
+			}
+			node = child
+			path = append(path, node)
+		}
+
+		// The same phrase seen twice keeps its highest weight.
+		if node.phrase >= 0 {
+			if p.Weight <= ci.phrases[node.phrase].Weight {
+				continue
+			}
+			ci.phrases[node.phrase] = p
+		} else {
+			node.phrase = len(ci.phrases)
+			ci.phrases = append(ci.phrases, p)
+		}
+
+		for _, n := range path {
+			n.best = max(n.best, p.Weight)
+		}
+	}
+
+	return ci
+}
+
+// TitlePhrases makes completions out of document titles, weighted by boost.
+func TitlePhrases(docs []index.Document) []WeightedPhrase {
+	r := make([]WeightedPhrase, 0, len(docs))
+	for _, doc := range docs {
+		if doc.Title != "" {
+			r = append(r, WeightedPhrase{Phrase: doc.Title, Weight: doc.Boost})
+		}
+	}
+	return r
+}
+
+// TermPhrases makes completions out of the indexed text terms, weighted by the
+// number of live documents they're in. The terms are what the analyzer made of the
+// words, so with a stemmer "conne" completes to "connect", not "connection"; titles
+// read better when that matters.
+func TermPhrases(idx *index.Index) []WeightedPhrase {
+	var r []WeightedPhrase
+	for _, key := range idx.Terms() {
+		if field, _ := index.SplitKey(key); field != index.FieldText {
+			continue
+		}
+		if df := len(idx.IDs(key)); df > 0 {
+			r = append(r, WeightedPhrase{Phrase: key, Weight: float64(df)})
+		}
+	}
+	return r
+}
+
+// Complete returns up to limit phrases starting with prefix, heaviest first.
+func (ci *CompletionIndex) Complete(prefix string, limit int) []string {
+	if limit <= 0 {
+		return nil
+	}
+
+	// Keep a trailing space so "wild " only completes phrases with a following word.
+	key := normalizePhrase(prefix)
+	if key != "" && strings.HasSuffix(prefix, " ") {
+		key += " "
+	}
+
+	node := ci.root
+	for _, r := range key {
+		child, ok := node.children[r]
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+
+	var r []string
+	q := &completionQueue{{node: node, weight: node.best}}
+	for q.Len() > 0 && len(r) < limit {
+		item := heap.Pop(q).(completionItem)
+		if item.node == nil {
+			r = append(r, ci.phrases[item.phrase].Phrase)
+			continue
+		}
+
+		if item.node.phrase >= 0 {
+			heap.Push(q, completionItem{phrase: item.node.phrase, weight: ci.phrases[item.node.phrase].Weight})
+		}
+		for _, child := range item.node.children {
+			heap.Push(q, completionItem{node: child, weight: child.best})
+		}
+	}
+
+	return r
+}
+
+// A max-heap of trie nodes still to expand and phrases ready to be returned.
+// A phrase beats a node of equal weight, a node can't hold anything better.
+type completionItem struct {
+	node   *completionNode
+	phrase int
+	weight float64
+}
+
+type completionQueue []completionItem
+
+func (q completionQueue) Len() int { return len(q) }
+
+func (q completionQueue) Less(i, j int) bool {
+	if q[i].weight != q[j].weight {
+		return q[i].weight > q[j].weight
+	}
+	return q[i].node == nil && q[j].node != nil
+}
+
+func (q completionQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *completionQueue) Push(x any) { *q = append(*q, x.(completionItem)) }
+
+func (q *completionQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,44 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	ci := BuildCompletionIndex([]WeightedPhrase{
+		{"Wild cat", 5},
+		{"wild cats of europe", 9},
+		{"Wildlife", 7},
+		{"wind", 8},
+		{"window cleaner", 1},
+		{"Dog", 3},
+		{"wild cat", 2}, // the lighter copy of a phrase is left out
+		{"dog show", 6}, // heavier than the phrase it extends
+		{"", 10},
+	})
+	tests := []struct {
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{"wi", 10, []string{"wild cats of europe", "wind", "Wildlife", "Wild cat", "window cleaner"}},
+		{"wil", 10, []string{"wild cats of europe", "Wildlife", "Wild cat"}},
+		{"wild", 2, []string{"wild cats of europe", "Wildlife"}},
+		{"wild ", 10, []string{"wild cats of europe", "Wild cat"}},
+		{"WILD  CA", 10, []string{"wild cats of europe", "Wild cat"}},
+		{"win", 1, []string{"wind"}},
+		{"d", 10, []string{"dog show", "Dog"}},
+		{"dog", 10, []string{"dog show", "Dog"}},
+		{"cat", 10, nil},
+		{"wi", 0, nil},
+		{"", 3, []string{"wild cats of europe", "wind", "Wildlife"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			if got := ci.Complete(tt.prefix, tt.limit); !slices.Equal(got, tt.want) {
+				t.Errorf("Complete(%q, %d) = %q, want %q", tt.prefix, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"context"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Counting
+// A caller after the number of hits, or whether there are any, needn't have
+// them ranked: Count and Exists match the query without working out what it's
+// scored with, rank nothing and fetch no documents, and a query that matches
+// everything is counted without listing the IDs. Exists also stops at the first
+// alternative of an OR that matches instead of merging them all.
+
+// Count parses query and returns how many documents it matches.
+func Count(idx *index.Index, query string) (int, error) {
+	return CountContext(context.Background(), idx, query)
+}
+
+// CountContext is Count giving up once ctx is done.
+func CountContext(ctx context.Context, idx *index.Index, query string) (int, error) {
+	node, err := parse(query, idx.Analyzer(), idx.IsKeywordField, idx.Languages())
+	if err != nil {
+		return 0, err
+	}
+	ids, all := node.eval(ctx, idx)
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if all {
+		return idx.Len(), nil
+	}
+	return len(ids), nil
+}
+
+// Exists parses query and reports whether it matches any document.
+func Exists(idx *index.Index, query string) (bool, error) {
+	return ExistsContext(context.Background(), idx, query)
+}
+
+// ExistsContext is Exists giving up once ctx is done.
+func ExistsContext(ctx context.Context, idx *index.Index, query string) (bool, error) {
+	node, err := parse(query, idx.Analyzer(), idx.IsKeywordField, idx.Languages())
+	if err != nil {
+		return false, err
+	}
+	found := exists(ctx, idx, node)
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return found, nil
+}
+
+func exists(ctx context.Context, idx *index.Index, n Node) bool {
+	switch n := n.(type) {
+	case orNode:
+		for _, child := range n.children {
+			if ctx.Err() != nil || exists(ctx, idx, child) {
+				return ctx.Err() == nil
+			}
+		}
+		return false
+	case multiMatchNode:
+		return exists(ctx, idx, orNode{n.children})
+	}
+	ids, all := n.eval(ctx, idx)
+	return len(ids) > 0 || (all && idx.Len() > 0)
+}
@@ -0,0 +1,92 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Syntax errors
+// A SyntaxError says where in the query string the parser gave up, as a byte
+// offset, so a frontend can point at it.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+func syntaxError(pos int, format string, args ...any) error {
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Escaping
+// Escape makes text search for its words and nothing else: every character the
+// query syntax means something by gets a backslash, and so do the operators, so
+// whatever a user typed can go into a query without breaking it, like
+//
+//	search.Query(idx, "title:" + search.Escape(userInput))
+//
+// Whitespace still separates the words, which are ANDed.
+const special = `\"()[]{}:*?~/`
+
+func Escape(text string) string {
+	var b strings.Builder
+	word := 0 // where the current word starts
+	for i, c := range text {
+		if unicode.IsSpace(c) {
+			word = i + utf8.RuneLen(c)
+		} else if i == word {
+			w := text[i:]
+			if end := strings.IndexFunc(w, unicode.IsSpace); end >= 0 {
+				w = w[:end]
+			}
+			if w == "AND" || w == "OR" || w == "NOT" {
+				b.WriteByte('\\')
+			}
+		}
+		if strings.ContainsRune(special, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// unescape drops the backslashes in front of escaped characters.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	escaped := false
+	for _, c := range s {
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// indexUnescaped is the offset of the first c in s without a backslash in front,
+// -1 if there is none.
+func indexUnescaped(s, c string) int {
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case strings.HasPrefix(s[i:], c):
+			return i
+		}
+	}
+	return -1
+}
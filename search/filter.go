@@ -0,0 +1,114 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Filters
+// A filter narrows the hits down without scoring, so what it matches depends on
+// the index alone and can be kept for the next query with the same constraint:
+// ANDed with the rest of a query, a filter is looked up with
+// index.CachedFilter and the other hits are checked against its bitset. The
+// keyword, range and geo terms of a query are filters (`cat language:en`), and
+// so are the Filter clauses of a BoolQuery and a FilterQuery, which makes one of
+// any clause:
+//
+//	search.And(search.Term("", "cat"), search.Filter(search.Or(search.Term("tag", "a"), search.Term("tag", "b"))))
+type FilterQuery struct {
+	Clause Clause
+}
+
+func Filter(c Clause) FilterQuery {
+	return FilterQuery{c}
+}
+
+type filterNode struct {
+	child Node
+}
+
+func (q FilterQuery) node(c *compiler) (Node, error) {
+	if q.Clause == nil {
+		return nil, fmt.Errorf("missing filter clause")
+	}
+	child, err := q.Clause.node(c)
+	if err != nil {
+		return nil, err
+	}
+	return filterNode{child}, nil
+}
+
+func (n filterNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	b, ok := cachedFilter(ctx, idx, n.child)
+	if !ok {
+		return nil, false
+	}
+	return b.IDs(), false
+}
+
+// ACLQuery is the security filter, the documents Principals may see (see
+// index.Allowed):
+//
+//	search.And(query, search.ACL("user:alice", "group:eng"))
+type ACLQuery struct {
+	Principals []string
+}
+
+func ACL(principals ...string) ACLQuery {
+	return ACLQuery{principals}
+}
+
+type aclNode struct {
+	principals []string
+}
+
+func (q ACLQuery) node(c *compiler) (Node, error) {
+	return aclNode{q.Principals}, nil
+}
+
+func (n aclNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	return idx.Allowed(n.principals).IDs(), false
+}
+
+// filter returns what to cache of n if it's a filter.
+func filter(n Node) (Node, bool) {
+	switch n := n.(type) {
+	case filterNode:
+		return n.child, true
+	case keywordNode, rangeNode, geoNode, aclNode:
+		return n, true
+	}
+	return nil, false
+}
+
+// cachedFilter returns the documents of the filter n, from the cache if they're
+// there, and false if ctx was done before they were found.
+func cachedFilter(ctx context.Context, idx *index.Index, n Node) (*index.Bitset, bool) {
+	if n, ok := n.(aclNode); ok {
+		return idx.Allowed(n.principals), true
+	}
+	b, err := idx.CachedFilter(fmt.Sprintf("%#v", n), func() ([]int, error) {
+		ids, all := n.eval(ctx, idx)
+		if all {
+			ids = idx.AllIDs()
+		}
+		return ids, ctx.Err()
+	})
+	return b, err == nil
+}
+
+// applyFilters keeps the IDs of r in every one of filters; all means r is
+// everything so far. The smallest filter goes first.
+func applyFilters(r []int, all bool, filters []*index.Bitset) []int {
+	slices.SortFunc(filters, func(a, b *index.Bitset) int { return a.Len() - b.Len() })
+	if all {
+		r, filters = filters[0].IDs(), filters[1:]
+	}
+	for _, b := range filters {
+		r = b.Filter(r)
+	}
+	return r
+}
@@ -0,0 +1,221 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Formatting a query
+// Format writes out what a query parsed into, in query syntax with its terms as
+// they were analyzed, so a log shows what a query actually asked the index for:
+// `Running Cats` becomes `(run AND cat)`, stopwords disappear (a term that was
+// nothing but is a `*`) and fields and languages show up. Parts without a syntax
+// of their own are written Lucene style: `+` for a must, `-` for a must not and
+// `#` for a filter clause of a BoolQuery, `(...)~N` for a minimum number to
+// match, `span(...)` for spans and `(title:x^3 | text:x)~0.3` for a multi-match
+// by the best field with a tie breaker.
+func Format(n Node) string {
+	var b strings.Builder
+	format(&b, n)
+	return b.String()
+}
+
+// ParseIndex is Parse with the keyword fields and languages of idx, the way a
+// query string is parsed to run against it.
+func ParseIndex(idx *index.Index, query string) (Node, error) {
+	return parse(query, idx.Analyzer(), idx.IsKeywordField, idx.Languages())
+}
+
+func format(b *strings.Builder, n Node) {
+	switch n := n.(type) {
+	case termNode:
+		formatField(b, n.field)
+		switch len(n.tokens) {
+		case 0:
+			b.WriteString("*") // only stopwords, it matches everything
+		case 1:
+			b.WriteString(n.tokens[0])
+		default:
+			fmt.Fprintf(b, "(%s)", strings.Join(n.tokens, " AND "))
+		}
+	case phraseNode:
+		formatField(b, n.field)
+		fmt.Fprintf(b, "%q", strings.Join(n.tokens, " "))
+	case nearNode:
+		formatField(b, n.field)
+		fmt.Fprintf(b, "%q~%d", strings.Join(n.tokens, " "), n.slop)
+	case wildcardNode:
+		formatField(b, n.field)
+		b.WriteString(n.pattern)
+	case regexpNode:
+		formatField(b, n.field)
+		fmt.Fprintf(b, "/%s/", n.pattern)
+	case keywordNode:
+		formatField(b, n.field)
+		b.WriteString(n.value)
+	case rangeNode:
+		formatField(b, n.field)
+		b.WriteString(formatRange(n.r))
+	case geoNode:
+		formatField(b, n.field)
+		fmt.Fprintf(b, "near(%g,%g,%gm)", n.center.Lat, n.center.Lon, n.meters)
+	case aclNode:
+		fmt.Fprintf(b, "acl(%s)", strings.Join(n.principals, ","))
+	case fuzzyNode:
+		formatField(b, n.field)
+		fmt.Fprintf(b, "%s~%d", n.term, n.maxEdits)
+	case andNode:
+		formatList(b, n.children, " AND ")
+	case orNode:
+		formatList(b, n.children, " OR ")
+	case notNode:
+		b.WriteString("NOT ")
+		format(b, n.child)
+	case filterNode:
+		b.WriteString("#")
+		format(b, n.child)
+	case nestedNode:
+		b.WriteString(n.path + ":")
+		switch n.child.(type) {
+		case andNode, orNode:
+			format(b, n.child) // in parentheses already
+		default:
+			b.WriteString("(")
+			format(b, n.child)
+			b.WriteString(")")
+		}
+	case multiMatchNode:
+		// Lucene's dis-max for the best field, its boosts for weights.
+		b.WriteString("(")
+		for i, child := range n.children {
+			if i > 0 && n.best {
+				b.WriteString(" | ")
+			} else if i > 0 {
+				b.WriteString(" ")
+			}
+			format(b, child)
+			if n.weights[i] != 0 {
+				b.WriteString("^" + strconv.FormatFloat(n.weights[i], 'g', -1, 64))
+			}
+		}
+		b.WriteString(")")
+		if n.best && n.tie != 0 {
+			b.WriteString("~" + strconv.FormatFloat(n.tie, 'g', -1, 64))
+		}
+	case minShouldNode:
+		children := n.children
+		for _, child := range n.excluded {
+			children = append(children[:len(children):len(children)], notNode{child})
+		}
+		formatList(b, children, " ")
+		fmt.Fprintf(b, "~%d", n.min)
+	case boolNode:
+		b.WriteString("(")
+		sep := ""
+		for _, group := range []struct {
+			prefix string
+			nodes  []Node
+		}{{"+", n.must}, {"", n.should}, {"-", n.mustNot}, {"#", n.filter}} {
+			for _, child := range group.nodes {
+				b.WriteString(sep + group.prefix)
+				if f, ok := child.(filterNode); ok {
+					child = f.child
+				}
+				format(b, child)
+				sep = " "
+			}
+		}
+		b.WriteString(")")
+		if n.minShould > 0 {
+			fmt.Fprintf(b, "~%d", n.minShould)
+		}
+	case spanNode:
+		for i, q := range n.queries {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			formatSpan(b, q)
+		}
+	default:
+		fmt.Fprintf(b, "%v", n)
+	}
+}
+
+func formatField(b *strings.Builder, field string) {
+	if field != "" {
+		b.WriteString(field + ":")
+	}
+}
+
+func formatList(b *strings.Builder, nodes []Node, sep string) {
+	b.WriteString("(")
+	for i, child := range nodes {
+		if i > 0 {
+			b.WriteString(sep)
+		}
+		format(b, child)
+	}
+	b.WriteString(")")
+}
+
+func formatRange(r index.Range) string {
+	open, end := "[", "]"
+	if r.ExcludeMin {
+		open = "{"
+	}
+	if r.ExcludeMax {
+		end = "}"
+	}
+	bound := func(v float64) string {
+		if math.IsInf(v, 0) {
+			return "*"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return open + bound(r.Min) + " TO " + bound(r.Max) + end
+}
+
+func formatSpan(b *strings.Builder, q index.SpanQuery) {
+	switch q := q.(type) {
+	case index.SpanTerm:
+		field, term := index.SplitKey(q.Key)
+		b.WriteString(field + ":" + term)
+	case index.SpanNear:
+		b.WriteString("span(")
+		for i, c := range q.Clauses {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			formatSpan(b, c)
+		}
+		fmt.Fprintf(b, ")~%d", q.Slop)
+		if q.InOrder {
+			b.WriteString(" in order")
+		}
+	case index.SpanOr:
+		b.WriteString("span(")
+		for i, c := range q.Clauses {
+			if i > 0 {
+				b.WriteString(" OR ")
+			}
+			formatSpan(b, c)
+		}
+		b.WriteString(")")
+	case index.SpanNot:
+		b.WriteString("span(")
+		formatSpan(b, q.Include)
+		b.WriteString(" NOT ")
+		formatSpan(b, q.Exclude)
+		b.WriteString(")")
+	case index.SpanFirst:
+		b.WriteString("span(")
+		formatSpan(b, q.Match)
+		fmt.Fprintf(b, " FIRST %d)", q.End)
+	default:
+		fmt.Fprintf(b, "%v", q)
+	}
+}
@@ -0,0 +1,209 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Highlighting
+// To know whether a word of the original text matches, each word is run through
+// the analyzer on its own and compared with the analyzed query terms, so "Cats"
+// lights up for a query for "cat". Words are split the way analysis.Tokenize
+// splits them. The text is not escaped; markers and text go out as they are.
+//
+// For a long document that re-analysis is slow. An index with
+// index.SetStoreOffsets on has done it at index time, and HighlightOffsets and
+// SnippetOffsets take what index.Offsets found instead, which leaves only finding
+// the word boundaries; the Analyzer isn't used.
+type Highlighter struct {
+	Analyzer analysis.Analyzer // analysis.Default if nil
+
+	// Pre and Post wrap every matching word, "<em>" and "</em>" if both are empty.
+	Pre, Post string
+
+	// Words is the length of a snippet in words, 30 if zero. Ellipsis marks text
+	// cut off before or after the snippet, "…" if empty.
+	Words    int
+	Ellipsis string
+}
+
+const defaultSnippetWords = 30
+
+type span struct {
+	start, end int
+	term       string // the matching query term, "" if none
+}
+
+func (h *Highlighter) markers() (string, string) {
+	if h.Pre == "" && h.Post == "" {
+		return "<em>", "</em>"
+	}
+	return h.Pre, h.Post
+}
+
+// words splits text into words and matches each against terms.
+func (h *Highlighter) words(text string, terms []string) []span {
+	analyzer := h.Analyzer
+	if analyzer == nil {
+		analyzer = analysis.Default
+	}
+
+	want := make(map[string]struct{}, len(terms))
+	for _, term := range terms {
+		want[term] = struct{}{}
+	}
+
+	offsets := analysis.WordOffsets(text)
+	r := make([]span, len(offsets))
+	for i, o := range offsets {
+		r[i] = span{start: o.Start, end: o.End}
+		for _, token := range analyzer.Analyze(text[o.Start:o.End]) {
+			if _, ok := want[token]; ok {
+				r[i].term = token
+				break
+			}
+		}
+	}
+	return r
+}
+
+// wordsAt splits text into words and takes the ones matching from offsets,
+// which are ordered by where they start. Offsets of another version of the text
+// just don't match.
+func wordsAt(text string, offsets []index.TermOffset) []span {
+	words := analysis.WordOffsets(text)
+	r := make([]span, len(words))
+	j := 0
+	for i, w := range words {
+		r[i] = span{start: w.Start, end: w.End}
+		for j < len(offsets) && offsets[j].Start < w.Start {
+			j++
+		}
+		if j < len(offsets) && offsets[j].Offset == w {
+			r[i].term = offsets[j].Term
+		}
+	}
+	return r
+}
+
+// Highlight returns all of text with the words matching the analyzed terms marked.
+func (h *Highlighter) Highlight(text string, terms []string) string {
+	return h.mark(text, h.words(text, terms), 0, len(text))
+}
+
+// HighlightOffsets is Highlight with the matches index.Offsets stored.
+func (h *Highlighter) HighlightOffsets(text string, offsets []index.TermOffset) string {
+	return h.mark(text, wordsAt(text, offsets), 0, len(text))
+}
+
+// Snippet returns the window of Words words with the most distinct query terms in
+// it (the most matches on a tie, the earliest on the next), marked up. Without any
+// match it's the start of the text.
+func (h *Highlighter) Snippet(text string, terms []string) string {
+	return h.snippet(text, h.words(text, terms))
+}
+
+// SnippetOffsets is Snippet with the matches index.Offsets stored.
+func (h *Highlighter) SnippetOffsets(text string, offsets []index.TermOffset) string {
+	return h.snippet(text, wordsAt(text, offsets))
+}
+
+func (h *Highlighter) snippet(text string, words []span) string {
+	if len(words) == 0 {
+		return ""
+	}
+
+	n := h.Words
+	if n <= 0 {
+		n = defaultSnippetWords
+	}
+	n = min(n, len(words))
+
+	// Slide the window one word at a time, counting the terms inside it.
+	counts := make(map[string]int)
+	distinct, matches := 0, 0
+	add := func(s span, delta int) {
+		if s.term == "" {
+			return
+		}
+		matches += delta
+		counts[s.term] += delta
+		switch {
+		case delta > 0 && counts[s.term] == 1:
+			distinct++
+		case delta < 0 && counts[s.term] == 0:
+			distinct--
+		}
+	}
+
+	for _, s := range words[:n] {
+		add(s, 1)
+	}
+	best, bestDistinct, bestMatches := 0, distinct, matches
+	for lo := 1; lo+n <= len(words); lo++ {
+		add(words[lo-1], -1)
+		add(words[lo+n-1], 1)
+		if distinct > bestDistinct || (distinct == bestDistinct && matches > bestMatches) {
+			best, bestDistinct, bestMatches = lo, distinct, matches
+		}
+	}
+
+	window := words[best : best+n]
+	snippet := h.mark(text, window, window[0].start, window[n-1].end)
+
+	ellipsis := h.Ellipsis
+	if ellipsis == "" {
+		ellipsis = "…"
+	}
+	if best > 0 {
+		snippet = ellipsis + snippet
+	}
+	if best+n < len(words) {
+		snippet += ellipsis
+	}
+	return snippet
+}
+
+// mark copies text[from:to] with the matching words in it wrapped in the markers.
+func (h *Highlighter) mark(text string, words []span, from, to int) string {
+	pre, post := h.markers()
+
+	var b strings.Builder
+	at := from
+	for _, s := range words {
+		if s.term == "" || s.start < from || s.end > to {
+			continue
+		}
+		b.WriteString(text[at:s.start])
+		b.WriteString(pre)
+		b.WriteString(text[s.start:s.end])
+		b.WriteString(post)
+		at = s.end
+	}
+	b.WriteString(text[at:to])
+	return b.String()
+}
+
+// QueryTerms returns the analyzed terms of query that count for field, in the
+// form Highlighter wants them: terms searched in the default fields belong to
+// each of them, and wildcards and fuzzy terms come expanded against idx.
+func QueryTerms(idx *index.Index, query, field string) ([]string, error) {
+	node, err := Parse(query, idx.Analyzer())
+	if err != nil {
+		return nil, err
+	}
+
+	var r []string
+	seen := make(map[string]struct{})
+	for _, key := range scoringTerms(idx, node) {
+		f, term := index.SplitKey(key)
+		if _, ok := seen[term]; ok || f != field {
+			continue
+		}
+		seen[term] = struct{}{}
+		r = append(r, term)
+	}
+	return r, nil
+}
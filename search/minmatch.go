@@ -0,0 +1,184 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Minimum should match
+// A query of several words needs all of them, which for a long query often
+// leaves nothing. MatchOptions loosen the words and phrases ANDed at the top of
+// a query string: MinimumShouldMatch lets a document miss some of them, and Relax
+// lowers the number needed as far as it takes to find something, down to any one
+// of them. Documents matching more of them score higher anyway, since every
+// term adds to the score. NOT clauses and anything in parentheses stay as strict
+// as they are.
+//
+// MinimumShouldMatch is a count, "2", the number that may be missing, "-1", or
+// either as a percentage of the clauses, rounded down: "75%", "-25%". Whatever it
+// works out to, at least one clause has to match and at most all of them.
+type MatchOptions struct {
+	MinimumShouldMatch string // "" for all of them
+	Relax              bool
+}
+
+// minShouldNode matches documents matching at least min of its children, or with
+// relax as many as any document does if that's fewer.
+type minShouldNode struct {
+	children []Node
+	excluded []Node // NOT children, subtracted like in an andNode
+	min      int
+	relax    bool
+}
+
+func (n minShouldNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	ids, _ := n.match(ctx, idx)
+	return ids, false
+}
+
+// match returns the matching IDs and the number of children they each match at
+// least.
+func (n minShouldNode) match(ctx context.Context, idx *index.Index) ([]int, int) {
+	// Children matching everything count for every document.
+	matchesAll := 0
+	var ids []int
+	for _, child := range n.children {
+		if ctx.Err() != nil {
+			return nil, 0
+		}
+		r, all := child.eval(ctx, idx)
+		if all {
+			matchesAll++
+			continue
+		}
+		ids = append(ids, r...)
+	}
+	need := n.min - matchesAll
+	r := n.atLeast(ids, &need)
+	if need <= 0 {
+		r = idx.AllIDs()
+	}
+	for _, child := range n.excluded {
+		ids, all := child.eval(ctx, idx)
+		if all {
+			return nil, 0
+		}
+		r = index.Difference(r, ids)
+	}
+	return r, need + matchesAll
+}
+
+// atLeast returns the IDs occurring at least need times in ids, lowering need
+// first if relaxing and no ID occurs that often.
+func (n minShouldNode) atLeast(ids []int, need *int) []int {
+	if *need <= 0 {
+		return nil
+	}
+
+	// Every child's list is free of duplicates, so the run of an ID in the sorted
+	// lists is the number of children matching it.
+	slices.Sort(ids)
+	counts := make([]int, 0, len(ids))
+	unique := ids[:0]
+	best := 0
+	for i := 0; i < len(ids); {
+		j := i + 1
+		for j < len(ids) && ids[j] == ids[i] {
+			j++
+		}
+		unique = append(unique, ids[i])
+		counts = append(counts, j-i)
+		best = max(best, j-i)
+		i = j
+	}
+	if n.relax && best > 0 && best < *need {
+		*need = best
+	}
+
+	var r []int
+	for i, id := range unique {
+		if counts[i] >= *need {
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// minimumShouldMatch works out spec for n clauses.
+func minimumShouldMatch(spec string, n int) (int, error) {
+	if spec == "" {
+		return n, nil
+	}
+	s, percent := strings.CutSuffix(spec, "%")
+	v, err := strconv.Atoi(s)
+	if err != nil || (percent && (v < -100 || v > 100)) {
+		return 0, fmt.Errorf("bad minimum_should_match %q", spec)
+	}
+	if percent {
+		v = v * n / 100
+	}
+	if strings.HasPrefix(s, "-") {
+		v = n + v
+	}
+	return min(max(v, 1), n), nil
+}
+
+// loosen applies m to the top of a parsed query.
+func loosen(node Node, m MatchOptions) (Node, error) {
+	and, ok := node.(andNode)
+	if !ok {
+		if m.MinimumShouldMatch == "" {
+			return node, nil
+		}
+		// Still check the spec.
+		_, err := minimumShouldMatch(m.MinimumShouldMatch, 1)
+		return node, err
+	}
+
+	var n minShouldNode
+	for _, child := range and.children {
+		if not, ok := child.(notNode); ok {
+			n.excluded = append(n.excluded, not.child)
+		} else {
+			n.children = append(n.children, child)
+		}
+	}
+	var err error
+	if n.min, err = minimumShouldMatch(m.MinimumShouldMatch, len(n.children)); err != nil {
+		return nil, err
+	}
+	if n.min == len(n.children) && !m.Relax || len(n.children) == 0 {
+		return node, nil
+	}
+	n.relax = m.Relax
+	return n, nil
+}
+
+// EvaluateMatch is EvaluateContext with the top of query loosened by m. relaxed
+// is true when Relax had to lower the number of clauses matched below the
+// minimum.
+func EvaluateMatch(ctx context.Context, idx *index.Index, query string, m MatchOptions) (ids []int, s index.Scoring, relaxed bool, err error) {
+	node, err := parse(query, idx.Analyzer(), idx.IsKeywordField, idx.Languages())
+	if err != nil {
+		return nil, index.Scoring{}, false, err
+	}
+	if node, err = loosen(node, m); err != nil {
+		return nil, index.Scoring{}, false, err
+	}
+	n, ok := node.(minShouldNode)
+	if !ok {
+		ids, s, err := evaluate(ctx, idx, node)
+		return ids, s, false, err
+	}
+
+	ids, matched := n.match(ctx, idx)
+	if err := ctx.Err(); err != nil {
+		return nil, index.Scoring{}, false, err
+	}
+	return ids, scoring(idx, n), matched < n.min, nil
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Multi-match queries
+// MultiMatchQuery looks for Text in several fields and scores them as one (see
+// index.TermGroup): by the best of them, with TieBreaker times the others on top,
+// or with MostFields by all of them added up. A field can have a weight after a
+// ^, MultiMatch("wild cat", "title^3", "text"), which takes the place of its
+// boost. A document matches if one of the fields has all of the words, the way
+// title:(wild AND cat) OR text:(wild AND cat) does; without Fields they're the
+// default ones.
+type MultiMatchQuery struct {
+	Text       string
+	Fields     []string
+	Type       string  // BestFields, the default, or MostFields
+	TieBreaker float64 // with BestFields, from 0 to 1
+}
+
+const (
+	BestFields = "best_fields"
+	MostFields = "most_fields"
+)
+
+func MultiMatch(text string, fields ...string) MultiMatchQuery {
+	return MultiMatchQuery{Text: text, Fields: fields}
+}
+
+type multiMatchNode struct {
+	fields   []string
+	weights  []float64 // 0 for the field's boost
+	children []Node    // what matches in each field
+	best     bool
+	tie      float64
+}
+
+func (q MultiMatchQuery) node(c *compiler) (Node, error) {
+	n := multiMatchNode{tie: q.TieBreaker}
+	switch q.Type {
+	case "", BestFields:
+		n.best = true
+	case MostFields:
+	default:
+		return nil, fmt.Errorf("unknown multi-match type %q, want %s or %s", q.Type, BestFields, MostFields)
+	}
+	if q.TieBreaker < 0 || q.TieBreaker > 1 {
+		return nil, fmt.Errorf("tie breaker %g isn't between 0 and 1", q.TieBreaker)
+	}
+
+	fields := q.Fields
+	if len(fields) == 0 {
+		fields = index.DefaultFields
+	}
+	for _, f := range fields {
+		field, w, weighted := strings.Cut(f, "^")
+		weight := 0.0
+		if weighted {
+			var err error
+			if weight, err = strconv.ParseFloat(w, 64); err != nil || !(weight > 0) {
+				return nil, fmt.Errorf("bad weight %q for %s", w, field)
+			}
+		}
+		if field == "" {
+			return nil, fmt.Errorf("multi-match without a field in %q", f)
+		}
+		a, keyword, err := c.text(field)
+		if err != nil {
+			return nil, err
+		}
+		var child Node
+		if keyword {
+			child = keywordNode{field, q.Text}
+		} else {
+			child = c.anyLanguage(a, q.Text, func(tokens []string) Node {
+				return termNode{field, tokens, q.Text}
+			})
+		}
+		n.fields = append(n.fields, field)
+		n.weights = append(n.weights, weight)
+		n.children = append(n.children, child)
+	}
+	return n, nil
+}
+
+func (n multiMatchNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	return orNode{n.children}.eval(ctx, idx)
+}
+
+func (n multiMatchNode) group(idx *index.Index) index.TermGroup {
+	g := index.TermGroup{Fields: n.fields, Weights: n.weights, Best: n.best, TieBreaker: n.tie}
+	for _, child := range n.children {
+		g.Keys = append(g.Keys, scoringTerms(idx, child))
+	}
+	return g
+}
@@ -0,0 +1,249 @@
+package search
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Nested queries
+// NestedQuery matches the documents with a nested object under Path that Query
+// matches on its own (see index.Nested): Nested("sections", BoolQuery{Must:
+// []Clause{Term("title", "x"), Term("text", "y")}}) finds the articles with a
+// section about x and y, not the ones that only have an x section and a y section.
+// In a query string that's sections:(title:x AND text:y). Fields in it are the
+// fields of the objects, title and text, or the nested fields themselves
+// (sections.title); a term without a field is looked for in both.
+//
+// Only terms, phrases and proximity can be matched against single objects, in
+// ANDs, ORs and NOTs or the Must, Should, MustNot and Filter clauses of a
+// BoolQuery. A NOT can only leave objects out of what the rest of its AND
+// matches, so a nested query of nothing but a NOT matches nothing.
+type NestedQuery struct {
+	Path  string
+	Query Clause
+}
+
+func Nested(path string, q Clause) NestedQuery {
+	return NestedQuery{path, q}
+}
+
+type nestedNode struct {
+	path  string
+	child Node
+}
+
+func (q NestedQuery) node(c *compiler) (Node, error) {
+	if q.Path == "" {
+		return nil, fmt.Errorf("nested query without a path")
+	}
+	child, err := q.Query.node(c)
+	if err != nil {
+		return nil, err
+	}
+	if child, err = scope(q.Path, child); err != nil {
+		return nil, err
+	}
+	return nestedNode{q.Path, child}, nil
+}
+
+func (n nestedNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	// The documents matching as a whole, with the objects checked one by one
+	// after.
+	ids, all := withoutNot(n.child).eval(ctx, idx)
+	if all {
+		return nil, false
+	}
+	var r []int
+	for i, id := range ids {
+		if i%64 == 0 && ctx.Err() != nil {
+			return nil, false
+		}
+		if e, all := elements(idx, n.child, id); all || len(e) > 0 {
+			r = append(r, id)
+		}
+	}
+	return r, false
+}
+
+// scope puts the fields of n under path, or returns an error for what can't be
+// matched against single objects.
+func scope(path string, n Node) (Node, error) {
+	var err error
+	field := func(f string) string {
+		if p, _, ok := index.SplitNestedField(f); ok && p == path {
+			return f
+		}
+		if f != index.FieldTitle && f != index.FieldText {
+			err = fmt.Errorf("%s is not a field of nested %s", f, path)
+		}
+		return index.NestedField(path, f)
+	}
+	all := func(f string, node func(field string) Node) Node {
+		if f != "" {
+			return node(field(f))
+		}
+		var children []Node
+		for _, f := range index.NestedFields {
+			children = append(children, node(index.NestedField(path, f)))
+		}
+		return orNode{children}
+	}
+	list := func(nodes []Node) []Node {
+		r := make([]Node, len(nodes))
+		for i, child := range nodes {
+			if err == nil {
+				r[i], err = scope(path, child)
+			}
+		}
+		return r
+	}
+
+	var r Node
+	switch n := n.(type) {
+	case termNode:
+		r = all(n.field, func(f string) Node { return termNode{f, n.tokens, n.text} })
+	case phraseNode:
+		r = all(n.field, func(f string) Node { return phraseNode{f, n.tokens} })
+	case nearNode:
+		r = all(n.field, func(f string) Node { return nearNode{f, n.tokens, n.slop} })
+	case andNode:
+		r = andNode{list(n.children)}
+	case orNode:
+		r = orNode{list(n.children)}
+	case notNode:
+		child, cerr := scope(path, n.child)
+		r, err = notNode{child}, cerr
+	case filterNode:
+		child, cerr := scope(path, n.child)
+		r, err = filterNode{child}, cerr
+	case boolNode:
+		if n.minShould > 0 {
+			return nil, fmt.Errorf("minimum should match isn't supported in a nested query")
+		}
+		r = boolNode{must: list(n.must), should: list(n.should), mustNot: list(n.mustNot), filter: list(n.filter)}
+	case nestedNode:
+		return nil, fmt.Errorf("nested %s in nested %s", n.path, path)
+	default:
+		return nil, fmt.Errorf("%s can't be matched in nested %s", Format(n), path)
+	}
+	return r, err
+}
+
+// withoutNot is n without the NOTs, which elements applies to the objects.
+func withoutNot(n Node) Node {
+	switch n := n.(type) {
+	case andNode:
+		var children []Node
+		for _, child := range n.children {
+			if _, ok := child.(notNode); !ok {
+				children = append(children, withoutNot(child))
+			}
+		}
+		return andNode{children}
+	case orNode:
+		children := make([]Node, len(n.children))
+		for i, child := range n.children {
+			children[i] = withoutNot(child)
+		}
+		return orNode{children}
+	case boolNode:
+		if len(n.must) == 0 && len(n.filter) == 0 && len(n.should) == 0 {
+			return andNode{}
+		}
+		return boolNode{must: n.must, should: n.should, filter: n.filter}
+	}
+	return n
+}
+
+// elements returns the objects of document id that the scoped n matches, all
+// true if it doesn't constrain them.
+func elements(idx *index.Index, n Node, id int) ([]int, bool) {
+	switch n := n.(type) {
+	case termNode:
+		if len(n.tokens) == 0 {
+			return nil, true
+		}
+		var r []int
+		for i, token := range n.tokens {
+			var e []int
+			for _, t := range idx.Synonyms().Expand(token) {
+				e = index.Union(e, idx.Elements(index.FieldKey(n.field, t), id))
+			}
+			if i == 0 {
+				r = e
+			} else {
+				r = index.Intersection(r, e)
+			}
+		}
+		return r, false
+	case phraseNode:
+		if len(n.tokens) == 0 {
+			return nil, true
+		}
+		return idx.PhraseElements(fieldTerms(idx, n.field, n.tokens), id), false
+	case nearNode:
+		if len(n.tokens) == 0 {
+			return nil, true
+		}
+		return idx.ProximityElements(fieldTerms(idx, n.field, n.tokens), n.slop, id), false
+	case filterNode:
+		return elements(idx, n.child, id)
+	case andNode:
+		return elementsAnd(idx, n.children, id)
+	case orNode:
+		var r []int
+		for _, child := range n.children {
+			e, all := elements(idx, child, id)
+			if all {
+				return nil, true
+			}
+			r = index.Union(r, e)
+		}
+		return r, false
+	case boolNode:
+		children := append(append([]Node{}, n.must...), n.filter...)
+		if len(children) == 0 && len(n.should) > 0 {
+			children = append(children, orNode{n.should})
+		}
+		for _, child := range n.mustNot {
+			children = append(children, notNode{child})
+		}
+		return elementsAnd(idx, children, id)
+	}
+	return nil, false
+}
+
+func elementsAnd(idx *index.Index, children []Node, id int) ([]int, bool) {
+	var r []int
+	all := true
+	var excluded []Node
+	for _, child := range children {
+		if not, ok := child.(notNode); ok {
+			excluded = append(excluded, not.child)
+			continue
+		}
+		e, childAll := elements(idx, child, id)
+		if childAll {
+			continue
+		}
+		if all {
+			r, all = e, false
+		} else {
+			r = index.Intersection(r, e)
+		}
+	}
+	if all {
+		// Nothing to leave objects out of.
+		return nil, len(excluded) == 0
+	}
+	for _, child := range excluded {
+		e, childAll := elements(idx, child, id)
+		if childAll {
+			return nil, false
+		}
+		r = index.Difference(r, e)
+	}
+	return r, false
+}
@@ -0,0 +1,308 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Percolator
+// Searching the other way round: queries are registered once and stay, and each
+// new document is matched against all of them, for "tell me when something about
+// X comes in". Match indexes the document alone in an index of its own, with the
+// analyzer and synonyms of the index it's for, and runs the queries on it as they
+// were parsed when they were registered. Most queries can't match a document
+// without one of a few terms, any one of the terms of an AND, the terms of every
+// part of an OR, so they're filed under those terms and only the ones filed under
+// a term of the document are run; the rest (a NOT alone, wildcards, ranges,...)
+// are run for every document.
+//
+// OpenPercolator keeps the queries in a file of JSON lines, appending a line for
+// every one registered or removed (with an empty query), and reads them back.
+type Percolator struct {
+	mu      sync.RWMutex
+	queries map[string]*percolatorQuery
+	byKey   map[string]map[string]struct{} // IDs of the queries filed under a dictionary key
+	always  map[string]struct{}            // IDs of the queries run for every document
+
+	f *os.File // nil if the queries aren't kept
+	w *bufio.Writer
+}
+
+// PercolatorQuery is a registered query, as a line of the file too.
+type PercolatorQuery struct {
+	ID    string `json:"id"`
+	Query string `json:"query"`
+}
+
+type percolatorQuery struct {
+	PercolatorQuery
+	node Node
+	keys []string // nil if it's run for every document
+}
+
+var ErrNoQuery = errors.New("no such query")
+
+func NewPercolator() *Percolator {
+	return &Percolator{queries: make(map[string]*percolatorQuery), byKey: make(map[string]map[string]struct{}), always: make(map[string]struct{})}
+}
+
+// OpenPercolator reads the queries kept at path, if there are any, parsed for
+// idx, and appends changes to it.
+func OpenPercolator(path string, idx *index.Index) (*Percolator, error) {
+	p := NewPercolator()
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var q PercolatorQuery
+			// A line cut off by a crash is skipped.
+			if json.Unmarshal(line, &q) == nil {
+				if q.Query == "" {
+					p.remove(q.ID)
+				} else if err := p.add(idx, q); err != nil {
+					f.Close()
+					return nil, fmt.Errorf("%s: query %q: %w", path, q.ID, err)
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	p.f, p.w = f, bufio.NewWriter(f)
+	return p, nil
+}
+
+// Register parses query for idx and matches documents against it from now on,
+// under id, replacing the query registered under id before, if any.
+func (p *Percolator) Register(idx *index.Index, id, query string) error {
+	if id == "" || query == "" {
+		return fmt.Errorf("a query needs an id and a query")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.add(idx, PercolatorQuery{id, query}); err != nil {
+		return err
+	}
+	return p.write(PercolatorQuery{id, query})
+}
+
+// Remove unregisters the query id, or returns ErrNoQuery.
+func (p *Percolator) Remove(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.remove(id) {
+		return ErrNoQuery
+	}
+	return p.write(PercolatorQuery{ID: id})
+}
+
+// Queries lists the registered queries by ID.
+func (p *Percolator) Queries() []PercolatorQuery {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	r := make([]PercolatorQuery, 0, len(p.queries))
+	for _, q := range p.queries {
+		r = append(r, q.PercolatorQuery)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].ID < r[j].ID })
+	return r
+}
+
+func (p *Percolator) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.queries)
+}
+
+// Match returns the IDs of the queries doc matches, sorted, analyzing it like idx
+// would.
+func (p *Percolator) Match(idx *index.Index, doc index.Document) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if len(p.queries) == 0 {
+		return nil
+	}
+
+	one := index.New(idx.Analyzer())
+	one.SetSynonyms(idx.Synonyms())
+	one.Add([]index.Document{doc})
+
+	candidates := make(map[string]struct{}, len(p.always))
+	for id := range p.always {
+		candidates[id] = struct{}{}
+	}
+	for _, key := range one.Terms() {
+		for id := range p.byKey[key] {
+			candidates[id] = struct{}{}
+		}
+	}
+
+	var r []string
+	for id := range candidates {
+		ids, all := p.queries[id].node.eval(context.Background(), one)
+		if all || len(ids) > 0 {
+			r = append(r, id)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (p *Percolator) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	err := p.w.Flush()
+	if cerr := p.f.Close(); err == nil {
+		err = cerr
+	}
+	p.f, p.w = nil, nil
+	return err
+}
+
+// add parses and files q. The caller must hold mu for writing.
+func (p *Percolator) add(idx *index.Index, q PercolatorQuery) error {
+	node, err := ParseIndex(idx, q.Query)
+	if err != nil {
+		return err
+	}
+	p.remove(q.ID)
+	keys, ok := requiredKeys(idx, node)
+	pq := &percolatorQuery{PercolatorQuery: q, node: node}
+	if !ok {
+		p.always[q.ID] = struct{}{}
+	} else {
+		pq.keys = keys
+		for _, key := range keys {
+			if p.byKey[key] == nil {
+				p.byKey[key] = make(map[string]struct{})
+			}
+			p.byKey[key][q.ID] = struct{}{}
+		}
+	}
+	p.queries[q.ID] = pq
+	return nil
+}
+
+// remove unfiles the query id. The caller must hold mu for writing.
+func (p *Percolator) remove(id string) bool {
+	q, ok := p.queries[id]
+	if !ok {
+		return false
+	}
+	delete(p.queries, id)
+	delete(p.always, id)
+	for _, key := range q.keys {
+		delete(p.byKey[key], id)
+		if len(p.byKey[key]) == 0 {
+			delete(p.byKey, key)
+		}
+	}
+	return true
+}
+
+// write appends q to the file, if there is one. The caller must hold mu for
+// writing.
+func (p *Percolator) write(q PercolatorQuery) error {
+	if p.w == nil {
+		return nil
+	}
+	line, _ := json.Marshal(q)
+	p.w.Write(append(line, '\n'))
+	return p.w.Flush()
+}
+
+// requiredKeys returns dictionary keys at least one of which a document needs to
+// match n, and false if there are no such keys.
+func requiredKeys(idx *index.Index, n Node) ([]string, bool) {
+	switch n := n.(type) {
+	case termNode:
+		return tokenKeys(idx, n.field, n.tokens)
+	case phraseNode:
+		return tokenKeys(idx, n.field, n.tokens)
+	case nearNode:
+		return tokenKeys(idx, n.field, n.tokens)
+	case keywordNode:
+		return []string{index.FieldKey(n.field, n.value)}, true
+	case filterNode:
+		return requiredKeys(idx, n.child)
+	case nestedNode:
+		return requiredKeys(idx, n.child)
+	case multiMatchNode:
+		return allRequired(idx, n.children)
+	case andNode:
+		return anyRequired(idx, n.children)
+	case orNode:
+		return allRequired(idx, n.children)
+	case minShouldNode:
+		if n.min <= 0 {
+			return nil, false
+		}
+		return allRequired(idx, n.children)
+	case boolNode:
+		if len(n.must) > 0 || len(n.filter) > 0 {
+			if keys, ok := anyRequired(idx, append(n.must[:len(n.must):len(n.must)], n.filter...)); ok {
+				return keys, true
+			}
+		}
+		if len(n.must) == 0 && len(n.filter) == 0 && len(n.should) > 0 {
+			return allRequired(idx, n.should)
+		}
+	}
+	return nil, false
+}
+
+// tokenKeys is the keys of the first of tokens in field, with its synonyms.
+func tokenKeys(idx *index.Index, field string, tokens []string) ([]string, bool) {
+	if len(tokens) == 0 {
+		return nil, false
+	}
+	var keys []string
+	for _, t := range idx.Synonyms().Expand(tokens[0]) {
+		keys = append(keys, idx.FieldTerms(field, t)...)
+	}
+	return keys, true
+}
+
+// anyRequired is the keys of the first of nodes that has some.
+func anyRequired(idx *index.Index, nodes []Node) ([]string, bool) {
+	for _, child := range nodes {
+		if keys, ok := requiredKeys(idx, child); ok {
+			return keys, true
+		}
+	}
+	return nil, false
+}
+
+// allRequired is the keys of all of nodes, if every one has some.
+func allRequired(idx *index.Index, nodes []Node) ([]string, bool) {
+	var keys []string
+	for _, child := range nodes {
+		k, ok := requiredKeys(idx, child)
+		if !ok {
+			return nil, false
+		}
+		keys = append(keys, k...)
+	}
+	return keys, len(keys) > 0
+}
@@ -0,0 +1,984 @@
+// Package search runs queries against an index: the boolean query language with
+// phrases, plus the older document-scanning searches and autocompletion.
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Boolean queries
+// Query understands AND, OR and NOT (upper case) and parentheses:
+//
+//	cat AND (wild OR feral) NOT domestic
+//
+// NOT binds tightest, then AND, then OR. Terms next to each other without an
+// operator are AND-ed, so "wild cat" means the same as "wild AND cat", and
+// "a NOT b" reads as "a AND NOT b". Double quotes make a phrase: "small wild cat"
+// only matches documents with those terms next to each other and in that order.
+// A distance after the closing quote turns a phrase into a proximity query:
+// "wild cat"~5 matches documents with both terms, in any order, and at most five
+// other words between them, and the closer they are the higher it scores.
+// A term with * or ? in it is a wildcard matched against the term dictionary:
+// cat* or wild?at. Wildcards are only lowercased, not stemmed. A trailing ~ makes a
+// term fuzzy, matching terms up to N edits away (catpuma~1); plain ~ allows 2.
+// Slashes make a regular expression that has to match whole terms, lowercase
+// like the analyzer makes them: /ca[tr]s?/ or title:/wild.*/, see
+// index.CompileTermRegexp.
+//
+// Terms, phrases, wildcards, regular expressions and fuzzy terms search the
+// default fields (the text and the title) unless they name a field: title:cat,
+// url:wiki*, title:"wild cat".
+// Terms also match their synonyms if the index has any; phrases, wildcards and
+// fuzzy terms don't. If documents declared languages of their own, terms and
+// phrases also match the way each of them analyzes the words.
+// A keyword field of the index filters on an exact value, category:Science or
+// category:"Computer science", without adding to the score.
+// A numeric field filters on a range, inclusive with square brackets and
+// exclusive with curly ones, * leaving an end open: year:[1990 TO 2000],
+// views:{1000 TO *]. Dates work the same way, published:[2020-01-01 TO *], see
+// index.ParseNumber. A geo field filters on the distance to a point, latitude
+// and longitude in degrees and the distance in m, km or mi:
+// place:near(52.52,13.40,2km).
+//
+// A backslash makes the character after it plain text: c\+\+, title\:cat,
+// \"quoted\", \AND or 2\*3 search for what they say instead of being syntax, see
+// Escape. Errors in the syntax are *SyntaxError with the position they're at.
+type Node interface {
+	// eval returns the matching IDs in ascending order. all is true when the
+	// node puts no constraint on the result, e.g. a term that is only stopwords.
+	eval(ctx context.Context, idx *index.Index) (ids []int, all bool)
+}
+
+// field is "" for the default fields.
+type termNode struct {
+	field  string
+	tokens []string
+	text   string // that tokens are of, for the exact forms
+}
+
+type phraseNode struct {
+	field  string
+	tokens []string
+}
+
+type nearNode struct {
+	field  string
+	tokens []string
+	slop   int
+}
+
+type wildcardNode struct{ field, pattern string }
+
+type regexpNode struct{ field, pattern string }
+
+type keywordNode struct{ field, value string }
+
+type rangeNode struct {
+	field string
+	r     index.Range
+}
+
+type geoNode struct {
+	field  string
+	center index.GeoPoint
+	meters float64
+}
+
+type fuzzyNode struct {
+	field    string
+	term     string
+	maxEdits int
+}
+
+type andNode struct{ children []Node }
+
+type orNode struct{ children []Node }
+
+type notNode struct{ child Node }
+
+func (n termNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	if len(n.tokens) == 0 {
+		return nil, true
+	}
+
+	lists := make([][]int, len(n.tokens))
+	for i, token := range n.tokens {
+		lists[i] = idx.SynonymIDs(n.field, token)
+	}
+	return index.IntersectAll(lists), false
+}
+
+func (n phraseNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	if len(n.tokens) == 0 {
+		return nil, true
+	}
+	return idx.FieldPhraseMatches(n.field, n.tokens), false
+}
+
+func (n nearNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	if len(n.tokens) == 0 {
+		return nil, true
+	}
+	return idx.FieldProximityMatches(n.field, n.tokens, n.slop), false
+}
+
+func (n wildcardNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	return union(ctx, idx, idx.ExpandFieldWildcard(n.field, n.pattern)), false
+}
+
+func (n regexpNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	keys, _ := idx.ExpandFieldRegexp(n.field, n.pattern)
+	return union(ctx, idx, keys), false
+}
+
+func (n keywordNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	return idx.FieldIDs(n.field, n.value), false
+}
+
+func (n rangeNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	return idx.RangeIDs(n.field, n.r), false
+}
+
+func (n geoNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	return idx.GeoDistanceIDs(n.field, n.center, n.meters), false
+}
+
+func (n fuzzyNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	return union(ctx, idx, idx.FuzzyFieldTerms(n.field, n.term, n.maxEdits)), false
+}
+
+// union merges the posting lists of keys, stopping early, with a wrong result,
+// once ctx is done.
+func union(ctx context.Context, idx *index.Index, keys []string) []int {
+	var r []int
+	for i, key := range keys {
+		if i%64 == 0 && ctx.Err() != nil {
+			return nil
+		}
+		r = index.Union(r, idx.IDs(key))
+	}
+	return r
+}
+
+func (n andNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	var r []int
+	all := true
+
+	// Negated children are subtracted once the positive ones are intersected,
+	// shortest first, and the hits checked against the filters in between. A
+	// child that matches nothing saves evaluating the rest.
+	var lists [][]int
+	var excluded []Node
+	var filters []*index.Bitset
+	for _, child := range n.children {
+		if not, ok := child.(notNode); ok {
+			excluded = append(excluded, not.child)
+			continue
+		}
+		if f, ok := filter(child); ok {
+			b, ok := cachedFilter(ctx, idx, f)
+			if !ok {
+				return nil, false
+			}
+			filters = append(filters, b)
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		ids, childAll := child.eval(ctx, idx)
+		if childAll {
+			continue
+		}
+		if len(ids) == 0 {
+			return nil, false
+		}
+		lists, all = append(lists, ids), false
+	}
+	r = index.IntersectAll(lists)
+
+	if len(filters) > 0 {
+		r, all = applyFilters(r, all, filters), false
+	}
+	if len(excluded) > 0 && all {
+		r, all = idx.AllIDs(), false
+	}
+	for _, child := range excluded {
+		ids, childAll := child.eval(ctx, idx)
+		if childAll {
+			return nil, false
+		}
+		r = index.Difference(r, ids)
+	}
+	return r, all
+}
+
+func (n orNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	var r []int
+	for _, child := range n.children {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		ids, all := child.eval(ctx, idx)
+		if all {
+			return nil, true
+		}
+		r = index.Union(r, ids)
+	}
+	return r, false
+}
+
+func (n notNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	return andNode{[]Node{n}}.eval(ctx, idx)
+}
+
+// The dictionary keys that can contribute to a score, i.e. everything not under a
+// NOT. Wildcards score as the terms they expand to.
+func scoringTerms(idx *index.Index, n Node) []string {
+	switch n := n.(type) {
+	case termNode:
+		var r []string
+		for _, token := range n.tokens {
+			r = append(r, fieldTerms(idx, n.field, idx.Synonyms().Expand(token))...)
+		}
+		return r
+	case phraseNode:
+		return fieldTerms(idx, n.field, n.tokens)
+	case nearNode:
+		return fieldTerms(idx, n.field, n.tokens)
+	case spanNode:
+		var r []string
+		for _, q := range n.queries {
+			r = append(r, index.SpanKeys(q)...)
+		}
+		return r
+	case wildcardNode:
+		return idx.ExpandFieldWildcard(n.field, n.pattern)
+	case regexpNode:
+		keys, _ := idx.ExpandFieldRegexp(n.field, n.pattern)
+		return keys
+	case fuzzyNode:
+		return idx.FuzzyFieldTerms(n.field, n.term, n.maxEdits)
+	case andNode:
+		var r []string
+		for _, child := range n.children {
+			r = append(r, scoringTerms(idx, child)...)
+		}
+		return r
+	case orNode:
+		var r []string
+		for _, child := range n.children {
+			r = append(r, scoringTerms(idx, child)...)
+		}
+		return r
+	case boolNode:
+		var r []string
+		for _, child := range n.scoring() {
+			r = append(r, scoringTerms(idx, child)...)
+		}
+		return r
+	case minShouldNode:
+		var r []string
+		for _, child := range n.children {
+			r = append(r, scoringTerms(idx, child)...)
+		}
+		return r
+	case nestedNode:
+		return scoringTerms(idx, n.child)
+	}
+	return nil
+}
+
+// The proximity clauses that add to a score, from the same nodes as scoringTerms.
+func scoringProximity(idx *index.Index, n Node) []index.Proximity {
+	switch n := n.(type) {
+	case nearNode:
+		if len(n.tokens) == 0 {
+			return nil
+		}
+		return idx.FieldProximity(n.field, n.tokens, n.slop)
+	case andNode:
+		var r []index.Proximity
+		for _, child := range n.children {
+			r = append(r, scoringProximity(idx, child)...)
+		}
+		return r
+	case orNode:
+		var r []index.Proximity
+		for _, child := range n.children {
+			r = append(r, scoringProximity(idx, child)...)
+		}
+		return r
+	case boolNode:
+		var r []index.Proximity
+		for _, child := range n.scoring() {
+			r = append(r, scoringProximity(idx, child)...)
+		}
+		return r
+	case minShouldNode:
+		var r []index.Proximity
+		for _, child := range n.children {
+			r = append(r, scoringProximity(idx, child)...)
+		}
+		return r
+	case nestedNode:
+		return scoringProximity(idx, n.child)
+	}
+	return nil
+}
+
+// The term groups of the multi-match queries that add to a score, from the same
+// nodes as scoringTerms.
+func scoringGroups(idx *index.Index, n Node) []index.TermGroup {
+	var children []Node
+	switch n := n.(type) {
+	case multiMatchNode:
+		return []index.TermGroup{n.group(idx)}
+	case andNode:
+		children = n.children
+	case orNode:
+		children = n.children
+	case boolNode:
+		children = n.scoring()
+	case minShouldNode:
+		children = n.children
+	}
+	var r []index.TermGroup
+	for _, child := range children {
+		r = append(r, scoringGroups(idx, child)...)
+	}
+	return r
+}
+
+// The words of the query n is, for the match boosts (see index.Scoring): the keys
+// of scoringTerms, and those of the term groups, per word. A wildcard, regular
+// expression, fuzzy term or span query counts as one word.
+func scoringQuery(idx *index.Index, n Node) []index.QueryTerm {
+	var children []Node
+	switch n := n.(type) {
+	case termNode:
+		exact := idx.ExactKeys(n.field, n.text, len(n.tokens))
+		r := make([]index.QueryTerm, len(n.tokens))
+		for i, token := range n.tokens {
+			r[i].Keys = fieldTerms(idx, n.field, idx.Synonyms().Expand(token))
+			if exact != nil {
+				r[i].Exact = exact[i]
+			}
+		}
+		return r
+	case phraseNode:
+		return splitTerms(idx, n.field, n.tokens)
+	case nearNode:
+		return splitTerms(idx, n.field, n.tokens)
+	case spanNode, wildcardNode, regexpNode, fuzzyNode:
+		if keys := scoringTerms(idx, n); len(keys) > 0 {
+			return []index.QueryTerm{{Keys: keys}}
+		}
+		return nil
+	case multiMatchNode:
+		// The same words in every field, the keys of each word together.
+		var r []index.QueryTerm
+		for _, child := range n.children {
+			for i, term := range scoringQuery(idx, child) {
+				if i < len(r) {
+					r[i].Keys = append(r[i].Keys, term.Keys...)
+					r[i].Exact = append(r[i].Exact, term.Exact...)
+				} else {
+					r = append(r, term)
+				}
+			}
+		}
+		return r
+	case andNode:
+		children = n.children
+	case orNode:
+		children = n.children
+	case boolNode:
+		children = n.scoring()
+	case minShouldNode:
+		children = n.children
+	case nestedNode:
+		return scoringQuery(idx, n.child)
+	}
+	var r []index.QueryTerm
+	for _, child := range children {
+		r = append(r, scoringQuery(idx, child)...)
+	}
+	return r
+}
+
+// scoring is what the hits of n are ranked with.
+func scoring(idx *index.Index, n Node) index.Scoring {
+	return index.Scoring{Terms: scoringTerms(idx, n), Proximity: scoringProximity(idx, n), Groups: scoringGroups(idx, n), Query: scoringQuery(idx, n)}
+}
+
+// splitTerms is fieldTerms for each of tokens on its own.
+func splitTerms(idx *index.Index, field string, tokens []string) []index.QueryTerm {
+	r := make([]index.QueryTerm, len(tokens))
+	for i, token := range tokens {
+		r[i].Keys = idx.FieldTerms(field, token)
+	}
+	return r
+}
+
+func fieldTerms(idx *index.Index, field string, tokens []string) []string {
+	var r []string
+	for _, token := range tokens {
+		r = append(r, idx.FieldTerms(field, token)...)
+	}
+	return r
+}
+
+// Query parses query and runs it against idx, best hits first.
+func Query(idx *index.Index, query string) ([]index.Result, error) {
+	r, _, err := QueryWithOptions(idx, query, index.SearchOptions{})
+	return r, err
+}
+
+// QueryWithOptions is Query for one page of the hits, see index.SearchOptions.
+// It also returns the total number of hits.
+func QueryWithOptions(idx *index.Index, query string, opts index.SearchOptions) ([]index.Result, int, error) {
+	return QueryContext(context.Background(), idx, query, opts)
+}
+
+// Timeouts
+// QueryContext and EvaluateContext stop once ctx is done, which bounds what a
+// query with a leading wildcard or a huge OR can cost. Matching is checked
+// between the parts of a query and while the posting lists of a wildcard or fuzzy
+// term are merged; a query cut short there returns nothing but the context's
+// error, since a partial match set would be wrong. Ranking cut short returns the
+// best hits among those it scored, with the error and the full total.
+
+// QueryContext is QueryWithOptions giving up once ctx is done.
+func QueryContext(ctx context.Context, idx *index.Index, query string, opts index.SearchOptions) ([]index.Result, int, error) {
+	ids, scoring, err := EvaluateContext(ctx, idx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := idx.RankPageContext(ctx, ids, scoring, opts)
+	return r, len(ids), err
+}
+
+// QuerySharded is QueryWithOptions over every shard of s at once.
+func QuerySharded(s *index.Sharded, query string, opts index.SearchOptions) ([]index.Result, int, error) {
+	return s.SearchFunc(func(idx *index.Index) ([]int, index.Scoring, error) {
+		return Evaluate(idx, query)
+	}, opts)
+}
+
+// Evaluate parses query and returns all of its hits unranked, in ascending order,
+// along with what to rank them with (see index.Index.RankPage). It's for callers
+// that need more than a page of hits, like facet counts.
+func Evaluate(idx *index.Index, query string) ([]int, index.Scoring, error) {
+	return EvaluateContext(context.Background(), idx, query)
+}
+
+// EvaluateContext is Evaluate giving up once ctx is done.
+func EvaluateContext(ctx context.Context, idx *index.Index, query string) ([]int, index.Scoring, error) {
+	node, err := parse(query, idx.Analyzer(), idx.IsKeywordField, idx.Languages())
+	if err != nil {
+		return nil, index.Scoring{}, err
+	}
+	return evaluate(ctx, idx, node)
+}
+
+func evaluate(ctx context.Context, idx *index.Index, node Node) ([]int, index.Scoring, error) {
+	ids, all := node.eval(ctx, idx)
+	if err := ctx.Err(); err != nil {
+		return nil, index.Scoring{}, err
+	}
+	if all {
+		ids = idx.AllIDs()
+	}
+	return ids, scoring(idx, node), nil
+}
+
+// CacheKey is the same for queries that are bound to have the same hits: it's the
+// parsed query, so case, spacing and the word forms the analyzer merges don't
+// matter.
+func CacheKey(idx *index.Index, query string) (string, error) {
+	node, err := parse(query, idx.Analyzer(), idx.IsKeywordField, idx.Languages())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%#v", node), nil
+}
+
+// Parsing
+// slop is -1 for a phrase without a distance. The text of a range keeps its
+// brackets, that of a geo filter is all of field:near(...) and that of a
+// regular expression is the pattern between the slashes.
+type queryToken struct {
+	text     string
+	pos      int
+	phrase   bool
+	slop     int
+	isRange  bool
+	isGeo    bool
+	isRegexp bool
+}
+
+type queryParser struct {
+	analyzer  analysis.Analyzer
+	isKeyword func(field string) bool
+	languages []string
+	tokens    []queryToken
+	pos       int
+	end       int // length of the query, where errors at its end are
+}
+
+var errEmptyQuery = errors.New("empty query")
+
+var fuzzyPattern = regexp.MustCompile(`^(.+)~([0-9])?$`)
+
+var slopPattern = regexp.MustCompile(`^~([0-9]*)`)
+
+func lexQuery(query string) ([]queryToken, error) {
+	var r []queryToken
+
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			r = append(r, queryToken{text: query[start:end], pos: start, slop: -1})
+			start = -1
+		}
+	}
+
+	quote, skip, escaped := -1, 0, false
+	for i, c := range query {
+		switch {
+		case i < skip:
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+			if quote < 0 && start < 0 {
+				start = i
+			}
+		case quote >= 0:
+			if c == '"' {
+				t := queryToken{text: unescape(query[quote+1 : i]), pos: quote, phrase: true, slop: -1}
+				if m := slopPattern.FindStringSubmatch(query[i+1:]); m != nil {
+					if m[1] == "" {
+						return nil, syntaxError(i+1, "missing distance after ~")
+					}
+					slop, err := strconv.Atoi(m[1])
+					if err != nil {
+						return nil, syntaxError(i+2, "bad distance %s", m[1])
+					}
+					t.slop, skip = slop, i+1+len(m[0])
+				}
+				r = append(r, t)
+				quote = -1
+			}
+		case c == '"':
+			flush(i)
+			quote = i
+		case c == '[' || c == '{':
+			flush(i)
+			end := strings.IndexAny(query[i:], "]}")
+			if end < 0 {
+				return nil, syntaxError(i, "unclosed range")
+			}
+			r = append(r, queryToken{text: query[i : i+end+1], pos: i, slop: -1, isRange: true})
+			skip = i + end + 1
+		case c == '/' && (start < 0 || isFieldPrefix(query[start:i])):
+			flush(i)
+			end := closingSlash(query, i+1)
+			if end < 0 {
+				return nil, syntaxError(i, "unclosed regular expression")
+			}
+			r = append(r, queryToken{text: strings.ReplaceAll(query[i+1:end], `\/`, "/"), pos: i, slop: -1, isRegexp: true})
+			skip = end + 1
+		case c == '(' && start >= 0 && strings.HasSuffix(query[start:i], ":near"):
+			end := strings.IndexByte(query[i:], ')')
+			if end < 0 {
+				return nil, syntaxError(i, "unclosed near(")
+			}
+			r = append(r, queryToken{text: query[start : i+end+1], pos: start, slop: -1, isGeo: true})
+			start, skip = -1, i+end+1
+		case c == '(' || c == ')':
+			flush(i)
+			r = append(r, queryToken{text: string(c), pos: i, slop: -1})
+		case unicode.IsSpace(c):
+			flush(i)
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if escaped {
+		return nil, syntaxError(len(query)-1, "nothing to escape after \\")
+	}
+	if quote >= 0 {
+		return nil, syntaxError(quote, "unclosed quote")
+	}
+	flush(len(query))
+
+	return r, nil
+}
+
+// isFieldPrefix tells a word like "title:" that a field value may follow.
+func isFieldPrefix(word string) bool {
+	return len(word) > 1 && indexUnescaped(word, ":") == len(word)-1
+}
+
+// closingSlash returns the index of the first / from i on without a backslash
+// before it, -1 if there is none.
+func closingSlash(query string, i int) int {
+	for escaped := false; i < len(query); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case query[i] == '\\':
+			escaped = true
+		case query[i] == '/':
+			return i
+		}
+	}
+	return -1
+}
+
+// Parse turns a query string into a tree that can be evaluated, analyzing its terms
+// with analyzer. Without an index it knows no keyword fields.
+func Parse(query string, analyzer analysis.Analyzer) (Node, error) {
+	return parse(query, analyzer, func(string) bool { return false }, nil)
+}
+
+func parse(query string, analyzer analysis.Analyzer, isKeyword func(field string) bool, languages []string) (Node, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{analyzer: analyzer, isKeyword: isKeyword, languages: languages, tokens: tokens, end: len(query)}
+	if len(p.tokens) == 0 {
+		return nil, errEmptyQuery
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, syntaxError(t.pos, "unexpected %q", t.text)
+	}
+	return node, nil
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return queryToken{}, false
+}
+
+func (p *queryParser) parseOr() (Node, error) {
+	var children []Node
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+
+		if t, ok := p.peek(); !ok || t.text != "OR" {
+			break
+		}
+		p.pos++
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return orNode{children}, nil
+}
+
+func (p *queryParser) parseAnd() (Node, error) {
+	var children []Node
+	for {
+		t, ok := p.peek()
+		if !ok || (!t.phrase && (t.text == "OR" || t.text == ")")) {
+			break
+		}
+		if !t.phrase && t.text == "AND" {
+			if len(children) == 0 {
+				return nil, syntaxError(t.pos, "AND without a left operand")
+			}
+			p.pos++
+			if next, ok := p.peek(); !ok || (!next.phrase && (next.text == "OR" || next.text == ")" || next.text == "AND")) {
+				return nil, syntaxError(t.pos, "AND without a right operand")
+			}
+			continue
+		}
+
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+
+	switch len(children) {
+	case 0:
+		if t, ok := p.peek(); ok {
+			return nil, syntaxError(t.pos, "unexpected %q", t.text)
+		}
+		return nil, syntaxError(p.end, "unexpected end of query")
+	case 1:
+		return children[0], nil
+	}
+	return andNode{children}, nil
+}
+
+func (p *queryParser) parseNot() (Node, error) {
+	t, _ := p.peek()
+	if t.phrase || t.text != "NOT" {
+		return p.parsePrimary()
+	}
+
+	p.pos++
+	child, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return notNode{child}, nil
+}
+
+func (p *queryParser) parsePrimary() (Node, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, syntaxError(p.end, "unexpected end of query")
+	}
+
+	if t.phrase {
+		p.pos++
+		return p.phrase("", t, p.analyzer), nil
+	}
+	if t.isRange {
+		return nil, syntaxError(t.pos, "range without a field")
+	}
+	if t.isGeo {
+		p.pos++
+		return parseGeo(t)
+	}
+	if t.isRegexp {
+		p.pos++
+		return parseRegexp("", t)
+	}
+
+	switch t.text {
+	case "(":
+		p.pos++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.text != ")" {
+			return nil, syntaxError(t.pos, "unclosed parenthesis")
+		}
+		p.pos++
+		return node, nil
+	case ")", "AND", "OR":
+		return nil, syntaxError(t.pos, "unexpected %q", t.text)
+	}
+
+	p.pos++
+
+	// year:[1990 TO 2000] lexes as "year:" and the range right after it. Fields
+	// without numbers simply have no documents in any range.
+	if next, ok := p.peek(); ok && next.isRange && next.pos == t.pos+len(t.text) && len(t.text) > 1 && indexUnescaped(t.text, ":") == len(t.text)-1 {
+		p.pos++
+		field := strings.TrimSuffix(t.text, ":")
+		if index.IsField(field) || p.isKeyword(field) {
+			return nil, syntaxError(t.pos, "%s is not a numeric field", field)
+		}
+		r, err := parseRange(next)
+		if err != nil {
+			return nil, err
+		}
+		return rangeNode{field, r}, nil
+	}
+
+	// sections:(title:x AND text:y) lexes as "sections:" and the parenthesis right
+	// after it, see NestedQuery.
+	if next, ok := p.peek(); ok && next.text == "(" && !next.phrase && next.pos == t.pos+len(t.text) && isFieldPrefix(t.text) {
+		if path := strings.TrimSuffix(t.text, ":"); !index.IsField(path) && !p.isKeyword(path) {
+			p.pos++
+			child, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if closing, ok := p.peek(); !ok || closing.text != ")" {
+				return nil, syntaxError(next.pos, "unclosed parenthesis")
+			}
+			p.pos++
+			if child, err = scope(path, child); err != nil {
+				return nil, syntaxError(t.pos, "%v", err)
+			}
+			return nestedNode{path, child}, nil
+		}
+	}
+
+	field, text := p.splitField(t.text)
+	if field == "" {
+		return p.parseTerm("", t.text, p.analyzer), nil
+	}
+
+	keyword := p.isKeyword(field)
+	analyzer := analysis.ForField(p.analyzer, field)
+	if text != "" {
+		if keyword {
+			return keywordNode{field, unescape(text)}, nil
+		}
+		return p.parseTerm(field, text, analyzer), nil
+	}
+
+	// title:/wild.*/ lexes as "title:" and the pattern right after it.
+	if next, ok := p.peek(); ok && next.isRegexp && next.pos == t.pos+len(t.text) {
+		p.pos++
+		if keyword {
+			return nil, syntaxError(next.pos, "%s is a keyword field, regular expressions only work on text", field)
+		}
+		return parseRegexp(field, next)
+	}
+
+	// title:"wild cat" lexes as "title:" and the phrase right after it.
+	if next, ok := p.peek(); ok && next.phrase && next.pos == t.pos+len(t.text) {
+		p.pos++
+		if keyword {
+			return keywordNode{field, next.text}, nil
+		}
+		return p.phrase(field, next, analyzer), nil
+	}
+	return nil, syntaxError(t.pos, "nothing to search for in field %s", field)
+}
+
+func parseRange(t queryToken) (index.Range, error) {
+	ends := strings.Fields(t.text[1 : len(t.text)-1])
+	if len(ends) != 3 || ends[1] != "TO" {
+		return index.Range{}, syntaxError(t.pos, "range isn't [from TO to]")
+	}
+
+	r := index.Range{Min: math.Inf(-1), Max: math.Inf(1), ExcludeMin: t.text[0] == '{', ExcludeMax: t.text[len(t.text)-1] == '}'}
+	for i, bound := range []*float64{&r.Min, &r.Max} {
+		end := ends[2*i]
+		if end == "*" {
+			continue
+		}
+		v, ok := index.ParseNumber(end)
+		if !ok {
+			return index.Range{}, syntaxError(t.pos, "bad range bound %q", end)
+		}
+		*bound = v
+	}
+	return r, nil
+}
+
+func parseRegexp(field string, t queryToken) (Node, error) {
+	if _, err := index.CompileTermRegexp(t.text); err != nil {
+		return nil, syntaxError(t.pos, "bad regular expression: %v", err)
+	}
+	return regexpNode{field, t.text}, nil
+}
+
+// parseGeo reads field:near(lat,lon,distance).
+func parseGeo(t queryToken) (Node, error) {
+	field, args, _ := strings.Cut(strings.TrimSuffix(t.text, ")"), ":near(")
+	switch {
+	case field == "":
+		return nil, syntaxError(t.pos, "near without a field")
+	case index.IsField(field):
+		return nil, syntaxError(t.pos, "%s is not a geo field", field)
+	}
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 {
+		return nil, syntaxError(t.pos, "near isn't near(lat,lon,distance)")
+	}
+	center, ok := index.ParseGeoPoint(parts[0] + "," + parts[1])
+	if !ok {
+		return nil, syntaxError(t.pos, "bad point %s,%s", parts[0], parts[1])
+	}
+	meters, ok := index.ParseDistance(strings.TrimSpace(parts[2]))
+	if !ok {
+		return nil, syntaxError(t.pos, "bad distance %q", parts[2])
+	}
+	return geoNode{field, center, meters}, nil
+}
+
+func (p *queryParser) phrase(field string, t queryToken, analyzer analysis.Analyzer) Node {
+	return p.anyLanguage(analyzer, t.text, func(tokens []string) Node {
+		if t.slop >= 0 {
+			return nearNode{field, tokens, t.slop}
+		}
+		return phraseNode{field, tokens}
+	})
+}
+
+// parseTerm gets text with its escapes still in it.
+func (p *queryParser) parseTerm(field, text string, analyzer analysis.Analyzer) Node {
+	if indexUnescaped(text, "*") >= 0 || indexUnescaped(text, "?") >= 0 {
+		return wildcardNode{field, strings.ToLower(unescape(text))}
+	}
+	if m := fuzzyPattern.FindStringSubmatch(text); m != nil && !strings.HasSuffix(m[1], "\\") {
+		edits := 2
+		if m[2] != "" {
+			edits = int(m[2][0] - '0')
+		}
+		return fuzzyNode{field, unescape(m[1]), edits}
+	}
+	text = unescape(text)
+	return p.anyLanguage(analyzer, text, func(tokens []string) Node {
+		return termNode{field, tokens, text}
+	})
+}
+
+// anyLanguage analyzes text with analyzer and its variant for every language of
+// the index, and ORs the nodes for the different outcomes. If a language drops
+// all of text as stopwords, it doesn't constrain the query at all.
+func (p *queryParser) anyLanguage(analyzer analysis.Analyzer, text string, node func(tokens []string) Node) Node {
+	var children []Node
+	var seen []string
+	for i := -1; i < len(p.languages); i++ {
+		a := analyzer
+		if i >= 0 {
+			a = analysis.ForLanguage(analyzer, p.languages[i])
+		}
+		tokens := a.Analyze(text)
+		key := strings.Join(tokens, "\x00")
+		if slices.Contains(seen, key) {
+			continue
+		}
+		seen = append(seen, key)
+		children = append(children, node(tokens))
+	}
+
+	if len(children) == 1 {
+		return children[0]
+	}
+	return orNode{children}
+}
+
+// splitField splits "title:cat" into the field and the rest. Anything before a
+// colon that isn't an indexed or keyword field, like the scheme of a URL, stays
+// part of the term.
+func (p *queryParser) splitField(text string) (field, rest string) {
+	i := indexUnescaped(text, ":")
+	if i <= 0 || !(index.IsField(text[:i]) || p.isKeyword(text[:i])) {
+		return "", text
+	}
+	return text[:i], text[i+1:]
+}
@@ -0,0 +1,212 @@
+package search
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Query suggestions
+// Completing terms or titles only knows what's in the index; what people search
+// for is a better guess at what the next one wants. A QueryLog records the
+// queries that found something and SuggestQueries completes a prefix with the
+// past queries starting with it, weighted by how often they were run, each run
+// counting half as much per HalfLife of age, so last week's trend fades behind
+// today's. Queries differing only in case and spacing are one, shown in the
+// case they were last written in.
+//
+// The suggester is a CompletionIndex over the log, rebuilt when it's asked for
+// at most every RebuildEvery after queries were recorded, so suggestions lag
+// a little behind. A log opened from a file appends every query to it as a JSON
+// line and reads the file back when it's opened again; it never shrinks, but
+// only MaxQueries distinct queries are kept in memory, the lightest going first.
+type QueryLog struct {
+	HalfLife     time.Duration
+	RebuildEvery time.Duration
+	MaxQueries   int
+
+	mu      sync.Mutex
+	queries map[string]*loggedQuery // by normalized query
+	w       *bufio.Writer
+	f       *os.File
+
+	suggester *CompletionIndex
+	dirty     bool
+	built     time.Time
+}
+
+const (
+	DefaultHalfLife   = 7 * 24 * time.Hour
+	DefaultMaxQueries = 100000
+)
+
+// weight is what the query was worth at last.
+type loggedQuery struct {
+	query  string
+	weight float64
+	last   time.Time
+}
+
+// logEntry is a line of the file.
+type logEntry struct {
+	Query string    `json:"query"`
+	Time  time.Time `json:"time"`
+}
+
+func NewQueryLog() *QueryLog {
+	return &QueryLog{HalfLife: DefaultHalfLife, RebuildEvery: 10 * time.Second, MaxQueries: DefaultMaxQueries, queries: make(map[string]*loggedQuery)}
+}
+
+// OpenQueryLog reads the log at path, if there is one, and appends to it.
+func OpenQueryLog(path string) (*QueryLog, error) {
+	l := NewQueryLog()
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			var e logEntry
+			// A line cut off by a crash is skipped.
+			if json.Unmarshal(line, &e) == nil {
+				l.add(e.Query, e.Time)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	l.f, l.w = f, bufio.NewWriter(f)
+	return l, nil
+}
+
+// Record logs a query that was run and found hits; one that found none is
+// more likely a typo than a suggestion and is left out.
+func (l *QueryLog) Record(query string, hits int) error {
+	query = strings.TrimSpace(query)
+	if query == "" || hits == 0 {
+		return nil
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.add(query, now)
+	if l.w == nil {
+		return nil
+	}
+	line, err := json.Marshal(logEntry{query, now})
+	if err != nil {
+		return err
+	}
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return l.w.Flush()
+}
+
+// add counts query as run at t. The caller must hold l.mu, or be OpenQueryLog.
+func (l *QueryLog) add(query string, t time.Time) {
+	query = strings.Join(strings.Fields(query), " ")
+	key := strings.ToLower(query)
+	if key == "" {
+		return
+	}
+	q, ok := l.queries[key]
+	switch {
+	case !ok:
+		l.queries[key] = &loggedQuery{query, 1, t}
+	case t.Before(q.last):
+		q.weight += l.decay(1, t, q.last)
+	default:
+		q.weight = l.decay(q.weight, q.last, t) + 1
+		q.query, q.last = query, t
+	}
+	l.dirty = true
+
+	if l.MaxQueries > 0 && len(l.queries) > l.MaxQueries {
+		l.forget(t)
+	}
+}
+
+// decay is what weight at from is worth at to, from being the earlier.
+func (l *QueryLog) decay(weight float64, from, to time.Time) float64 {
+	if l.HalfLife <= 0 || to.Before(from) {
+		return weight
+	}
+	return weight * math.Pow(0.5, to.Sub(from).Seconds()/l.HalfLife.Seconds())
+}
+
+// forget drops the lightest tenth of the queries.
+func (l *QueryLog) forget(now time.Time) {
+	type weighted struct {
+		key    string
+		weight float64
+	}
+	all := make([]weighted, 0, len(l.queries))
+	for key, q := range l.queries {
+		all = append(all, weighted{key, l.decay(q.weight, q.last, now)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].weight < all[j].weight })
+	for _, w := range all[:len(all)-l.MaxQueries*9/10] {
+		delete(l.queries, w.key)
+	}
+}
+
+// SuggestQueries returns up to n past queries starting with prefix, the most
+// often and recently run first.
+func (l *QueryLog) SuggestQueries(prefix string, n int) []string {
+	return l.completionIndex().Complete(prefix, n)
+}
+
+func (l *QueryLog) completionIndex() *CompletionIndex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.suggester != nil && (!l.dirty || now.Sub(l.built) < l.RebuildEvery) {
+		return l.suggester
+	}
+	phrases := make([]WeightedPhrase, 0, len(l.queries))
+	for _, q := range l.queries {
+		phrases = append(phrases, WeightedPhrase{Phrase: q.query, Weight: l.decay(q.weight, q.last, now)})
+	}
+	l.suggester = BuildCompletionIndex(phrases)
+	l.dirty, l.built = false, now
+	return l.suggester
+}
+
+// Len is the number of distinct queries kept.
+func (l *QueryLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queries)
+}
+
+// Close closes the file of a log opened with OpenQueryLog.
+func (l *QueryLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.w.Flush()
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f, l.w = nil, nil
+	return err
+}
@@ -0,0 +1,21 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Searching the content
+// Attempt one. Regular expressions go through the term dictionary instead, see
+// index.ExpandFieldRegexp.
+func Contains(docs []index.Document, text string) []index.Document {
+	var r []index.Document
+
+	for _, doc := range docs {
+		if strings.Contains(doc.Text, text) {
+			r = append(r, doc)
+		}
+	}
+	return r
+}
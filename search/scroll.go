@@ -0,0 +1,60 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Scrolling
+// A page of hits has to rank every match to know which are the best, which is
+// fine for ten of them and a waste for an export of all of them. A Scroll hands
+// out the matches in batches in ascending ID order instead, each batch scored on
+// its own when it's asked for, so an analytics job can walk a million hits while
+// only ever holding the IDs and one batch. The order doesn't depend on the scores,
+// so batches never overlap and never skip a hit as long as the index doesn't
+// change: scroll the Index of an index.Reader to get that without holding off
+// changes.
+type Scroll struct {
+	idx     *index.Index
+	ids     []int
+	scoring index.Scoring
+	next    int
+}
+
+// NewScroll walks ids, evaluated already, see Evaluate, scoring them with s.
+func NewScroll(idx *index.Index, ids []int, s index.Scoring) *Scroll {
+	return &Scroll{idx: idx, ids: ids, scoring: s}
+}
+
+// QueryScroll parses query and scrolls all of its hits.
+func QueryScroll(ctx context.Context, idx *index.Index, query string) (*Scroll, error) {
+	ids, s, err := EvaluateContext(ctx, idx, query)
+	if err != nil {
+		return nil, err
+	}
+	return NewScroll(idx, ids, s), nil
+}
+
+// Total is the number of hits, batched out or not.
+func (s *Scroll) Total() int {
+	return len(s.ids)
+}
+
+// Next returns the next n hits at most, none once all were returned. A batch cut
+// short by ctx isn't returned, so calling Next again gets it whole.
+func (s *Scroll) Next(ctx context.Context, n int) ([]index.Result, error) {
+	if n <= 0 || s.next >= len(s.ids) {
+		return nil, nil
+	}
+	ids := s.ids[s.next:min(s.next+n, len(s.ids))]
+	r, err := s.idx.RankPageContext(ctx, ids, s.scoring, index.SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(r, func(a, b index.Result) int { return cmp.Compare(a.ID, b.ID) })
+	s.next += len(ids)
+	return r, nil
+}
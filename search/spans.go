@@ -0,0 +1,226 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Span clauses
+// The clauses of index span queries (see index.SpanQuery), with their terms
+// analyzed like a TermQuery's, for every language of the index:
+//
+//	// "quick" then "fox" at most 3 words apart, within 10 of "dog" in any order
+//	search.SpanNear(10, false,
+//		search.SpanNear(3, true, search.SpanTerm("", "quick"), search.SpanTerm("", "fox")),
+//		search.SpanTerm("", "dog"))
+//
+// Positions are per field, so a span clause searches one: the one its terms name,
+// which has to be the same for all of them, or if they name none each of the
+// default fields on its own. A term the analyzer makes several tokens of is a
+// phrase of them, and one that's only stopwords never matches. Span clauses score
+// with the BM25 of their terms, but for the Exclude of a SpanNotQuery.
+type SpanClause interface {
+	Clause
+	span(c *compiler, field string) (index.SpanQuery, error)
+	fields(dst []string) []string
+}
+
+type SpanTermQuery struct {
+	Field string
+	Term  string
+}
+
+// SpanNearQuery matches where every clause matches at most Slop positions apart,
+// in order if InOrder is set.
+type SpanNearQuery struct {
+	Clauses []SpanClause
+	Slop    int
+	InOrder bool
+}
+
+type SpanOrQuery struct {
+	Clauses []SpanClause
+}
+
+// SpanNotQuery matches the spans of Include that don't overlap one of Exclude.
+type SpanNotQuery struct {
+	Include, Exclude SpanClause
+}
+
+// SpanFirstQuery matches the spans of Match that end within the first End
+// positions of the field.
+type SpanFirstQuery struct {
+	Match SpanClause
+	End   int
+}
+
+func SpanTerm(field, term string) SpanTermQuery {
+	return SpanTermQuery{field, term}
+}
+
+func SpanNear(slop int, inOrder bool, clauses ...SpanClause) SpanNearQuery {
+	return SpanNearQuery{clauses, slop, inOrder}
+}
+
+func SpanOr(clauses ...SpanClause) SpanOrQuery {
+	return SpanOrQuery{clauses}
+}
+
+func SpanNot(include, exclude SpanClause) SpanNotQuery {
+	return SpanNotQuery{include, exclude}
+}
+
+func SpanFirst(match SpanClause, end int) SpanFirstQuery {
+	return SpanFirstQuery{match, end}
+}
+
+// spanNode is a span query per field searched.
+type spanNode struct {
+	queries []index.SpanQuery
+}
+
+func (n spanNode) eval(ctx context.Context, idx *index.Index) ([]int, bool) {
+	var r []int
+	for _, q := range n.queries {
+		r = index.Union(r, idx.SpanMatches(q))
+	}
+	return r, false
+}
+
+// spanNode compiles the span clause q.
+func (c *compiler) spanNode(q SpanClause) (Node, error) {
+	named := q.fields(nil)
+	slices.Sort(named)
+	named = slices.Compact(named)
+	if len(named) > 1 {
+		return nil, fmt.Errorf("span clauses on different fields: %s", strings.Join(named, ", "))
+	}
+	fields := index.DefaultFields
+	if len(named) == 1 {
+		fields = named
+	}
+	var n spanNode
+	for _, field := range fields {
+		sq, err := q.span(c, field)
+		if err != nil {
+			return nil, err
+		}
+		n.queries = append(n.queries, sq)
+	}
+	return n, nil
+}
+
+func (q SpanTermQuery) node(c *compiler) (Node, error)  { return c.spanNode(q) }
+func (q SpanNearQuery) node(c *compiler) (Node, error)  { return c.spanNode(q) }
+func (q SpanOrQuery) node(c *compiler) (Node, error)    { return c.spanNode(q) }
+func (q SpanNotQuery) node(c *compiler) (Node, error)   { return c.spanNode(q) }
+func (q SpanFirstQuery) node(c *compiler) (Node, error) { return c.spanNode(q) }
+
+func (q SpanTermQuery) span(c *compiler, field string) (index.SpanQuery, error) {
+	a, keyword, err := c.text(field)
+	if err != nil {
+		return nil, err
+	}
+	if keyword {
+		return nil, fmt.Errorf("%s is a keyword field, span clauses only work on text", field)
+	}
+	// A clause per distinct analysis, like anyLanguage.
+	var variants []index.SpanQuery
+	var seen []string
+	for i := -1; i < len(c.languages); i++ {
+		la := a
+		if i >= 0 {
+			la = analysis.ForLanguage(a, c.languages[i])
+		}
+		tokens := la.Analyze(q.Term)
+		key := strings.Join(tokens, "\x00")
+		if len(tokens) == 0 || slices.Contains(seen, key) {
+			continue
+		}
+		seen = append(seen, key)
+		terms := make([]index.SpanQuery, len(tokens))
+		for j, token := range tokens {
+			terms[j] = index.SpanTerm{Key: index.FieldKey(field, token)}
+		}
+		if len(terms) == 1 {
+			variants = append(variants, terms[0])
+		} else {
+			variants = append(variants, index.SpanNear{Clauses: terms, InOrder: true})
+		}
+	}
+	if len(variants) == 1 {
+		return variants[0], nil
+	}
+	return index.SpanOr{Clauses: variants}, nil
+}
+
+func (q SpanNearQuery) span(c *compiler, field string) (index.SpanQuery, error) {
+	if q.Slop < 0 {
+		return nil, fmt.Errorf("negative slop %d", q.Slop)
+	}
+	clauses, err := spans(c, field, q.Clauses)
+	return index.SpanNear{Clauses: clauses, Slop: q.Slop, InOrder: q.InOrder}, err
+}
+
+func (q SpanOrQuery) span(c *compiler, field string) (index.SpanQuery, error) {
+	clauses, err := spans(c, field, q.Clauses)
+	return index.SpanOr{Clauses: clauses}, err
+}
+
+func (q SpanNotQuery) span(c *compiler, field string) (index.SpanQuery, error) {
+	clauses, err := spans(c, field, []SpanClause{q.Include, q.Exclude})
+	if err != nil {
+		return nil, err
+	}
+	return index.SpanNot{Include: clauses[0], Exclude: clauses[1]}, nil
+}
+
+func (q SpanFirstQuery) span(c *compiler, field string) (index.SpanQuery, error) {
+	clauses, err := spans(c, field, []SpanClause{q.Match})
+	if err != nil {
+		return nil, err
+	}
+	return index.SpanFirst{Match: clauses[0], End: q.End}, nil
+}
+
+func spans(c *compiler, field string, clauses []SpanClause) ([]index.SpanQuery, error) {
+	r := make([]index.SpanQuery, len(clauses))
+	for i, clause := range clauses {
+		if clause == nil {
+			return nil, fmt.Errorf("missing span clause")
+		}
+		var err error
+		if r[i], err = clause.span(c, field); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (q SpanTermQuery) fields(dst []string) []string {
+	if q.Field == "" {
+		return dst
+	}
+	return append(dst, q.Field)
+}
+
+func (q SpanNearQuery) fields(dst []string) []string { return spanFields(dst, q.Clauses...) }
+func (q SpanOrQuery) fields(dst []string) []string   { return spanFields(dst, q.Clauses...) }
+func (q SpanNotQuery) fields(dst []string) []string  { return spanFields(dst, q.Include, q.Exclude) }
+func (q SpanFirstQuery) fields(dst []string) []string {
+	return spanFields(dst, q.Match)
+}
+
+func spanFields(dst []string, clauses ...SpanClause) []string {
+	for _, c := range clauses {
+		if c != nil {
+			dst = c.fields(dst)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,40 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Did you mean
+// DidYouMean rewrites query with every plain term that matches nothing replaced
+// by its best suggestion (see index.Index.Suggest), leaving operators, phrases,
+// fields, ranges, wildcards and fuzzy terms alone. ok is false if there was nothing to
+// correct.
+func DidYouMean(idx *index.Index, query string) (string, bool) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return "", false
+	}
+
+	var b strings.Builder
+	at, ok := 0, false
+	for _, t := range tokens {
+		switch {
+		case t.phrase, t.isRange, t.text == "AND", t.text == "OR", t.text == "NOT", t.text == "(", t.text == ")":
+			continue
+		case strings.ContainsAny(t.text, ":*?~"):
+			continue
+		}
+
+		suggestions := idx.Suggest(t.text)
+		if len(suggestions) == 0 {
+			continue
+		}
+		b.WriteString(query[at:t.pos])
+		b.WriteString(suggestions[0])
+		at, ok = t.pos+len(t.text), true
+	}
+	b.WriteString(query[at:])
+	return b.String(), ok
+}
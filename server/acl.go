@@ -0,0 +1,51 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Access control
+// With SetACL a server only lets a request see the documents its principals may
+// see (see index.Allowed): searches and exports leave the others out of the hits,
+// the total and the facets, and GET /documents/{id}, its term vector and similar
+// documents answer 404 for them like for a document that isn't there. principals
+// says who a request is from; HeaderPrincipals trusts a header set by the proxy
+// in front, which authenticated the user. Searches from Go and gRPC are for
+// SearchRequest.Principals, public documents only if there are none.
+//
+// Restricted searches don't suggest a spelling, which could come from any
+// document. GET /complete still completes from the terms of all of them.
+func (s *Server) SetACL(principals func(r *http.Request) []string) {
+	s.acl = principals
+}
+
+// HeaderPrincipals reads the principals of a request from header, separated by
+// commas.
+func HeaderPrincipals(header string) func(r *http.Request) []string {
+	return func(r *http.Request) []string {
+		var ps []string
+		for _, p := range strings.Split(r.Header.Get(header), ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				ps = append(ps, p)
+			}
+		}
+		return ps
+	}
+}
+
+// principals is who r is from, nil without an ACL.
+func (s *Server) principals(r *http.Request) []string {
+	if s.acl == nil {
+		return nil
+	}
+	return s.acl(r)
+}
+
+// visible reports whether r may see document id. The caller must hold the index
+// lock.
+func (s *Server) visible(r *http.Request, idx *index.Index, id int) bool {
+	return s.acl == nil || idx.Allowed(s.acl(r)).Has(id)
+}
@@ -0,0 +1,101 @@
+// Package server exposes the engine over HTTP.
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// AnalyzeHandler serves GET /analyze?text=... with the tokens after every stage of
+// analyzer. It needs no index. A nil analyzer means analysis.Default.
+func AnalyzeHandler(analyzer analysis.Analyzer) http.HandlerFunc {
+	return analyzeHandler(func() analysis.Analyzer { return analyzer })
+}
+
+// analyzeHandler is AnalyzeHandler with the analyzer returned by current on every
+// request, which for a Server is that of the index it serves then.
+func analyzeHandler(current func() analysis.Analyzer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		text := r.URL.Query().Get("text")
+		if text == "" {
+			http.Error(w, "missing text parameter", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Text   string           `json:"text"`
+			Stages []analysis.Stage `json:"stages"`
+		}{text, analysis.Stages(orDefault(current()), text)})
+	}
+}
+
+// ExplainAnalysisHandler serves /_analyze with analysis.Explain: every token of
+// the text with its position and the steps that made it, and the ones dropped on
+// the way. GET takes text, analyzer (a registered name, analyzer by default),
+// field and language as parameters, POST the same as a JSON object.
+func ExplainAnalysisHandler(analyzer analysis.Analyzer) http.HandlerFunc {
+	return explainAnalysisHandler(func() analysis.Analyzer { return analyzer })
+}
+
+// explainAnalysisHandler is ExplainAnalysisHandler with the default analyzer
+// returned by current on every request, like analyzeHandler.
+func explainAnalysisHandler(current func() analysis.Analyzer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Text     string `json:"text"`
+			Analyzer string `json:"analyzer"`
+			Field    string `json:"field"`
+			Language string `json:"language"`
+		}
+		switch r.Method {
+		case http.MethodGet:
+			q := r.URL.Query()
+			req.Text, req.Analyzer, req.Field, req.Language = q.Get("text"), q.Get("analyzer"), q.Get("field"), q.Get("language")
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if req.Text == "" {
+			http.Error(w, "missing text", http.StatusBadRequest)
+			return
+		}
+
+		a := orDefault(current())
+		if req.Analyzer != "" {
+			var ok bool
+			if a, ok = analysis.Lookup(req.Analyzer); !ok {
+				http.Error(w, "unknown analyzer "+strconv.Quote(req.Analyzer), http.StatusBadRequest)
+				return
+			}
+		}
+		a = analysis.ForLanguage(analysis.ForField(a, index.BaseField(req.Field)), req.Language)
+
+		res := analysis.Explain(a, req.Text)
+		res.Analyzer = req.Analyzer
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// orDefault is a, or analysis.Default if it's nil.
+func orDefault(a analysis.Analyzer) analysis.Analyzer {
+	if a == nil {
+		return analysis.Default
+	}
+	return a
+}
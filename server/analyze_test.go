@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/store"
+)
+
+func TestAnalyzeCurrentIndex(t *testing.T) {
+	srv := New(index.New(nil), store.NewMemory(nil))
+	tests := []struct {
+		name     string
+		analyzer analysis.Analyzer // of the index swapped in first, nil to keep it
+		method   string
+		path     string
+		body     string
+		tokens   []string
+	}{
+		{"analyze before", nil, "GET", "/analyze?text=the+cats", "", []string{"cat"}},
+		{"explain before", nil, "GET", "/_analyze?text=the+cats", "", []string{"cat"}},
+		{"analyze after", &analysis.Standard{Filters: analysis.ParseFilters("lowercase")}, "GET", "/analyze?text=the+cats", "", []string{"the", "cats"}},
+		{"explain after", nil, "GET", "/_analyze?text=the+cats", "", []string{"the", "cats"}},
+		{"explain post after", nil, "POST", "/_analyze", `{"text":"the cats"}`, []string{"the", "cats"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.analyzer != nil {
+				srv.idx.Swap(index.New(tt.analyzer), nil)
+			}
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				Stages []analysis.Stage `json:"stages"`
+				Tokens []struct {
+					Token string `json:"token"`
+				} `json:"tokens"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			var tokens []string
+			if strings.HasPrefix(tt.path, "/analyze") {
+				tokens = resp.Stages[len(resp.Stages)-1].Tokens
+			} else {
+				for _, tok := range resp.Tokens {
+					tokens = append(tokens, tok.Token)
+				}
+			}
+			if !slices.Equal(tokens, tt.tokens) {
+				t.Errorf("tokens %q, want %q", tokens, tt.tokens)
+			}
+		})
+	}
+}
+
+func TestAnalyzeHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		stages []analysis.Stage
+	}{
+		{"stages", "GET", "/analyze?text=The+Running+Cats", http.StatusOK, []analysis.Stage{
+			{Stage: "tokenize", Tokens: []string{"The", "Running", "Cats"}},
+			{Stage: "lowercase", Tokens: []string{"the", "running", "cats"}},
+			{Stage: "stopwords", Tokens: []string{"running", "cats"}},
+			{Stage: "stem", Tokens: []string{"run", "cat"}},
+			{Stage: "final", Tokens: []string{"run", "cat"}},
+		}},
+		{"missing text", "GET", "/analyze", http.StatusBadRequest, nil},
+		{"empty text", "GET", "/analyze?text=", http.StatusBadRequest, nil},
+		{"post", "POST", "/analyze?text=cats", http.StatusMethodNotAllowed, nil},
+	}
+	h := AnalyzeHandler(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Text   string           `json:"text"`
+				Stages []analysis.Stage `json:"stages"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Stages) != len(tt.stages) {
+				t.Fatalf("stages %v, want %v", resp.Stages, tt.stages)
+			}
+			for i, s := range tt.stages {
+				if resp.Stages[i].Stage != s.Stage || !slices.Equal(resp.Stages[i].Tokens, s.Tokens) {
+					t.Errorf("stage %d is %v, want %v", i, resp.Stages[i], s)
+				}
+			}
+		})
+	}
+}
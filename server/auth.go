@@ -0,0 +1,208 @@
+package server
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// API keys
+// A server without keys trusts whoever can reach it, which is fine on localhost
+// and nowhere else. With SetAuth every request that changes something (adding,
+// updating and deleting documents, bulk requests, snapshots) needs a key with
+// write access, and with Auth.Private so does everything else; searches are open
+// otherwise. A key goes in the X-API-Key header, as a bearer token or as the
+// password of basic auth (curl -u :key), the user name being ignored. A request
+// without a key gets 401, one whose key can only read gets 403 for a change.
+//
+// ParseAPIKeys reads keys as the fts-server -api-keys file and the FTS_API_KEYS
+// variable have them: separated by commas or new lines, each optionally followed
+// by :read for a read-only key (or :write, the default), with # starting a
+// comment. Only hashes of the keys are kept.
+type Access int
+
+const (
+	AccessNone Access = iota
+	AccessRead
+	AccessWrite
+)
+
+type Auth struct {
+	Keys    map[string]Access
+	Private bool // searches need a key too
+}
+
+type auth struct {
+	keys    map[[sha256.Size]byte]Access
+	private bool
+}
+
+var (
+	ErrUnauthenticated = errors.New("missing or unknown API key")
+	ErrForbidden       = errors.New("API key is read-only")
+)
+
+// SetAuth turns on API keys. Call it before serving.
+func (s *Server) SetAuth(a Auth) {
+	s.auth = newAuth(a)
+}
+
+func newAuth(a Auth) *auth {
+	r := &auth{keys: make(map[[sha256.Size]byte]Access, len(a.Keys)), private: a.Private}
+	for key, access := range a.Keys {
+		r.keys[sha256.Sum256([]byte(key))] = access
+	}
+	return r
+}
+
+func ParseAPIKeys(text string) (map[string]Access, error) {
+	keys := make(map[string]Access)
+	for _, line := range strings.Split(text, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			key, access := entry, AccessWrite
+			if k, ok := strings.CutSuffix(entry, ":read"); ok {
+				key, access = k, AccessRead
+			} else if k, ok := strings.CutSuffix(entry, ":write"); ok {
+				key = k
+			}
+			if key == "" {
+				return nil, fmt.Errorf("API key %q: empty key", entry)
+			}
+			keys[key] = access
+		}
+	}
+	return keys, nil
+}
+
+func LoadAPIKeys(path string) (map[string]Access, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseAPIKeys(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// APIKeysEnv is the environment variable ConfiguredAPIKeys reads.
+const APIKeysEnv = "FTS_API_KEYS"
+
+// ConfiguredAPIKeys returns the keys of the file at path, unless that's "", and
+// of the APIKeysEnv variable, nil if there are none.
+func ConfiguredAPIKeys(path string) (map[string]Access, error) {
+	keys, err := ParseAPIKeys(os.Getenv(APIKeysEnv))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", APIKeysEnv, err)
+	}
+	if path != "" {
+		fromFile, err := LoadAPIKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		for key, access := range fromFile {
+			keys[key] = access
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+// requestKey is the API key r was sent with, "" if none.
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+// Authorize checks a key for a change (write) or a read, for the HTTP handlers
+// and the gRPC service alike. It returns ErrUnauthenticated or ErrForbidden.
+func (s *Server) Authorize(key string, write bool) error {
+	return s.auth.check(key, write)
+}
+
+func (a *auth) check(key string, write bool) error {
+	if a == nil || (!write && !a.private) {
+		return nil
+	}
+	access := AccessNone
+	if key != "" {
+		access = a.keys[sha256.Sum256([]byte(key))]
+	}
+	switch {
+	case access == AccessNone:
+		return ErrUnauthenticated
+	case write && access < AccessWrite:
+		return ErrForbidden
+	}
+	return nil
+}
+
+// valid tells whether key is one of a's and may make a change (write) or a
+// read. Unlike check it is false for every key when there are none.
+func (a *auth) valid(key string, write bool) bool {
+	if a == nil || key == "" || a.keys[sha256.Sum256([]byte(key))] == AccessNone {
+		return false
+	}
+	return a.check(key, write) == nil
+}
+
+// isWrite tells the requests that change the index or read all of it at once.
+// POST /_analyze and /msearch only read.
+func isWrite(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/snapshot":
+		return true
+	case "/_analyze", "/msearch":
+		return false
+	}
+	return r.Method != http.MethodGet && r.Method != http.MethodHead
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	return s.auth.authorize(w, r)
+}
+
+// Protect puts h behind the keys of a the way SetAuth puts a Server's endpoints,
+// for handlers of their own like a cluster coordinator.
+func Protect(h http.Handler, a Auth) http.Handler {
+	au := newAuth(a)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if au.authorize(w, r) {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (a *auth) authorize(w http.ResponseWriter, r *http.Request) bool {
+	switch err := a.check(requestKey(r), isWrite(r)); err {
+	case nil:
+		return true
+	case ErrUnauthenticated:
+		w.Header().Set("WWW-Authenticate", `Basic realm="fts"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	default:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	}
+	return false
+}
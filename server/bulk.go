@@ -0,0 +1,218 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/wal"
+)
+
+// Bulk indexing
+// POST /bulk takes newline-delimited JSON, one operation per line:
+//
+//	{"op": "add", "document": {...}}
+//	{"op": "update", "id": 3, "document": {...}}
+//	{"op": "delete", "id": 3}
+//
+// and applies them all under one write lock (see index.Bulk), so searches see
+// none of a request or all of it. An operation that fails doesn't stop the others;
+// the response lists the ID and error of every item, in order.
+//
+// A request holds the index for as long as it takes, so clients get pushed back
+// instead of queued without end: a request with more than MaxBulkOps operations is
+// refused with 413, and once BulkQueue requests are running or waiting a new one
+// gets 429 and should be retried after a moment.
+const (
+	MaxBulkOps = 10000
+	BulkQueue  = 4
+)
+
+type BulkItem struct {
+	Op       index.BulkOp    `json:"op"`
+	ID       int             `json:"id,omitempty"`
+	Document *index.Document `json:"document,omitempty"`
+}
+
+type BulkItemResult struct {
+	Op    index.BulkOp `json:"op"`
+	ID    int          `json:"id"`
+	Error string       `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Took   string           `json:"took"`
+	Errors int              `json:"errors"`
+	Items  []BulkItemResult `json:"items"`
+}
+
+var errUnknownOp = errors.New("unknown op")
+
+// Bulk stores and indexes the items in one batch, after the changes queued for a
+// refresh; adds get the next free IDs in order. The results line up with items.
+func (s *Server) Bulk(items []BulkItem) []index.BulkResult {
+	s.pendMu.Lock()
+	defer s.pendMu.Unlock()
+	err := s.writable()
+	if err == nil {
+		_, err = s.refresh()
+	}
+	if err != nil {
+		r := make([]index.BulkResult, len(items))
+		for i, item := range items {
+			r[i] = index.BulkResult{Op: item.Op, ID: item.ID, Err: err}
+		}
+		return r
+	}
+
+	idx, done := s.idx.Write()
+	defer done()
+
+	start := time.Now()
+	r := make([]index.BulkResult, len(items))
+	b := idx.Bulk()
+	full := s.checkMemoryOf(idx) // deletes go on, adds and updates wait
+
+	queued := make([]int, 0, len(items)) // item of every operation handed to b
+	docs := make([]index.Document, len(items))
+	var logged []wal.Entry
+
+	for i, item := range items {
+		r[i].Op, r[i].ID = item.Op, item.ID
+		var doc index.Document
+		if item.Document != nil {
+			doc = *item.Document
+		}
+		doc = s.prepare(doc)
+		docs[i] = doc
+		empty := doc.Title == "" && doc.Text == ""
+
+		switch item.Op {
+		case index.BulkAdd:
+			if empty {
+				r[i].Err = index.ErrEmptyDocument
+				continue
+			}
+			if full != nil {
+				r[i].Err = full
+				continue
+			}
+			doc.ID = s.docs.Len()
+			r[i].ID, docs[i].ID = doc.ID, doc.ID
+			if r[i].Err = s.docs.Put(doc); r[i].Err == nil {
+				b.Add(doc)
+				logged = append(logged, wal.Entry{Op: item.Op, ID: doc.ID, Document: &doc})
+			}
+		case index.BulkUpdate:
+			doc.ID = item.ID
+			docs[i].ID = doc.ID
+			if empty {
+				r[i].Err = index.ErrEmptyDocument
+			} else if full != nil {
+				r[i].Err = full
+			} else if !b.Has(doc.ID) {
+				r[i].Err = index.ErrNoDocument
+			} else if r[i].Err = s.docs.Put(doc); r[i].Err == nil {
+				b.Update(doc)
+				logged = append(logged, wal.Entry{Op: item.Op, ID: doc.ID, Document: &doc})
+			}
+		case index.BulkDelete:
+			if b.Delete(item.ID) == nil {
+				logged = append(logged, wal.Entry{Op: item.Op, ID: item.ID})
+			}
+		default:
+			r[i].Err = errUnknownOp
+		}
+		if b.Len() > len(queued) {
+			queued = append(queued, i)
+		}
+	}
+
+	// Nothing is indexed unless all of it is logged.
+	if err := s.logChanges(logged...); err != nil {
+		for i := range r {
+			if r[i].Err == nil {
+				r[i].Err = err
+			}
+		}
+		s.metrics.wrote(start)
+		s.log().Error("bulk not logged", "items", len(r), "error", err)
+		return r
+	}
+
+	for j, res := range b.Apply() {
+		i := queued[j]
+		r[i].Err = res.Err
+		if res.Err == nil && res.Op == index.BulkDelete {
+			r[i].Err = s.docs.Delete(res.ID)
+		}
+	}
+	s.changed()
+	if err := idx.Commit(); err != nil {
+		for i := range r {
+			if r[i].Err == nil {
+				r[i].Err = err
+			}
+		}
+	}
+
+	failed := 0
+	for i, res := range r {
+		if res.Err == nil {
+			s.metrics.changed(res.Op, 1)
+			if res.Op != index.BulkDelete {
+				s.percolate(idx, docs[i])
+			}
+		} else {
+			failed++
+		}
+	}
+	s.metrics.wrote(start)
+	s.log().Info("bulk", "items", len(r), "failed", failed, "took", time.Since(start))
+	return r
+}
+
+func (s *Server) handleBulk(w http.ResponseWriter, r *http.Request) {
+	select {
+	case s.bulkQueue <- struct{}{}:
+		defer func() { <-s.bulkQueue }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many bulk requests", http.StatusTooManyRequests)
+		return
+	}
+
+	var items []BulkItem
+	dec := json.NewDecoder(r.Body)
+	for {
+		var item BulkItem
+		if err := dec.Decode(&item); err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("bad item %d: %v", len(items), err), http.StatusBadRequest)
+			return
+		}
+		if len(items) == MaxBulkOps {
+			http.Error(w, "more than "+strconv.Itoa(MaxBulkOps)+" operations", http.StatusRequestEntityTooLarge)
+			return
+		}
+		items = append(items, item)
+	}
+
+	start := time.Now()
+	resp := BulkResponse{Items: make([]BulkItemResult, len(items))}
+	for i, res := range s.Bulk(items) {
+		resp.Items[i] = BulkItemResult{Op: res.Op, ID: res.ID}
+		if res.Err != nil {
+			resp.Items[i].Error = res.Err.Error()
+			resp.Errors++
+		}
+	}
+	resp.Took = time.Since(start).String()
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// Query cache
+// Popular queries tend to come back, so the responses of the last few distinct
+// searches can be kept and handed out again. The key is the parsed query (see
+// search.CacheKey) plus everything else in the request, and any change to the
+// documents empties the cache. Off unless SetCacheSize is called.
+type CacheStats struct {
+	Size   int `json:"size"`
+	Limit  int `json:"limit"`
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+type cache struct {
+	mu      sync.Mutex
+	limit   int
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+	hits    int
+	misses  int
+}
+
+type cacheEntry struct {
+	key  string
+	resp SearchResponse
+}
+
+func newCache(limit int) *cache {
+	return &cache{limit: limit, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *cache) get(key string) (SearchResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return SearchResponse{}, false
+	}
+	c.hits++
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).resp, true
+}
+
+func (c *cache) put(key string, resp SearchResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).resp = resp
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, resp})
+	if c.order.Len() > c.limit {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.entries, last.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *cache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	clear(c.entries)
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Size: c.order.Len(), Limit: c.limit, Hits: c.hits, Misses: c.misses}
+}
+
+func (req SearchRequest) cacheKey(query string) string {
+	var decay any
+	if req.Decay != nil {
+		decay = *req.Decay
+	}
+	var diversify any
+	if req.Diversify != nil {
+		diversify = *req.Diversify
+	}
+	var vector any
+	if req.Vector != nil {
+		vector = *req.Vector
+	}
+	return fmt.Sprintf("%s\x00%d\x00%d\x00%t\x00%q\x00%d\x00%t\x00%v\x00%q\x00%v\x00%s\x00%q\x00%v\x00%v\x00%v\x00%t", query, req.Limit, req.Offset, req.All, req.Facets, req.FacetSize, req.Explain, req.Sort, req.Fields, req.Match, req.Collapse, req.Principals, decay, diversify, vector, req.Highlight)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+)
+
+// Exporting every hit
+// GET /export streams all the hits of a query as JSON lines, one Hit each, in
+// ascending ID order (see search.Scroll), for jobs that want every match rather
+// than the best ones:
+//
+//	GET /export?q=...           the hits, the number of them in X-Total-Hits
+//	     &fields=title,text     with these fields of the documents
+//	     &batch=N               scored and sent N at a time, DefaultExportBatch
+//	     &minimum_should_match=2&relax=1  like /search
+//
+// The export sees the index as it was when it started, however long it takes,
+// through an index.Reader, and only locks it while it fetches the documents of a
+// batch, so changes go on meanwhile. A document deleted since then is left out.
+// Export does the same from Go.
+type ExportRequest struct {
+	Query  string
+	Fields []string // index.DefaultSource if nil
+	Match  search.MatchOptions
+	Batch  int // DefaultExportBatch if 0
+
+	Principals []string // with SetACL, who's exporting
+}
+
+const DefaultExportBatch = 1000
+
+// Export hands the hits of req to fn a batch at a time, along with the number of
+// them all, and stops at the first error from fn or once ctx is done. An error of
+// the query itself comes before fn is first called.
+func (s *Server) Export(ctx context.Context, req ExportRequest, fn func(total int, hits []Hit) error) error {
+	reader := s.idx.Reader()
+	defer reader.Close()
+	idx := reader.Index()
+
+	fields := req.Fields
+	if fields == nil {
+		fields = index.DefaultSource
+	}
+	if err := idx.CheckSource(fields); err != nil {
+		return err
+	}
+	batch := req.Batch
+	if batch <= 0 {
+		batch = DefaultExportBatch
+	}
+	ids, terms, _, err := search.EvaluateMatch(ctx, idx, req.Query, req.Match)
+	if err != nil {
+		return err
+	}
+	if s.acl != nil {
+		ids = idx.Allowed(req.Principals).Filter(ids)
+	}
+
+	scroll := search.NewScroll(idx, ids, terms)
+	for {
+		results, err := scroll.Next(ctx, batch)
+		if err != nil || len(results) == 0 {
+			return err
+		}
+
+		hits := make([]Hit, 0, len(results))
+		now, done := s.idx.Read()
+		for _, res := range results {
+			if now.Has(res.ID) {
+				hits = append(hits, s.hit(res, fields))
+			}
+		}
+		done()
+		if err := fn(scroll.Total(), hits); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := ExportRequest{Query: q.Get("q")}
+	if req.Query == "" {
+		http.Error(w, "missing q parameter", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("batch"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "bad batch parameter", http.StatusBadRequest)
+			return
+		}
+		req.Batch = n
+	}
+	if v := q.Get("fields"); v != "" {
+		req.Fields = strings.Split(v, ",")
+	}
+	req.Match.MinimumShouldMatch = q.Get("minimum_should_match")
+	req.Match.Relax = q.Get("relax") != ""
+	req.Principals = s.principals(r)
+
+	started := false
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	flusher, _ := w.(http.Flusher)
+	err := s.Export(r.Context(), req, func(total int, hits []Hit) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("X-Total-Hits", strconv.Itoa(total))
+			started = true
+		}
+		for _, hit := range hits {
+			if err := enc.Encode(hit); err != nil {
+				return err
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	switch {
+	case started:
+		// Too late for a status, the client sees the stream end early.
+	case err != nil:
+		if r.Context().Err() == nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	default:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Total-Hits", "0")
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+)
+
+// Logging
+// A server logs to the slog.Logger set with SetLogger, slog.Default() if none:
+// changes, bulk requests, refreshes and reloads, and every search at debug level
+// with its hits and how long it took. A search that takes at least the threshold
+// set with SetSlowQueryThreshold is logged at warn level instead, as "slow
+// query", along with the page asked for and what the query parsed into (see
+// search.Format), which is the first thing to look at when one is slow.
+//
+// NewLogger returns a logger writing to w in format, "text" (or "") or "json",
+// the messages at level and above: "debug", "info" (or ""), "warn" or "error".
+func NewLogger(w io.Writer, format, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("unknown log level %q", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (have text, json)", format)
+}
+
+func (s *Server) SetLogger(l *slog.Logger) {
+	s.logger = l
+}
+
+// SetSlowQueryThreshold logs the searches that take d or longer, 0 for none.
+func (s *Server) SetSlowQueryThreshold(d time.Duration) {
+	s.slowQuery = d
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.logger != nil {
+		return s.logger
+	}
+	return slog.Default()
+}
+
+// logSearch logs a search that took took.
+func (s *Server) logSearch(req SearchRequest, resp SearchResponse, err error, took time.Duration) {
+	l := s.log()
+	if s.slowQuery <= 0 || took < s.slowQuery {
+		if err != nil {
+			l.Debug("search failed", "query", req.Query, "took", took, "error", err)
+		} else {
+			l.Debug("search", "query", req.Query, "hits", resp.Total, "took", took)
+		}
+		return
+	}
+
+	idx, done := s.idx.Read()
+	parsed := ""
+	if node, err := search.ParseIndex(idx, req.Query); err == nil {
+		parsed = search.Format(node)
+	}
+	done()
+	attrs := []any{"query", req.Query, "parsed", parsed, "hits", resp.Total, "took", took, "limit", req.Limit, "offset", req.Offset}
+	if len(req.Facets) > 0 {
+		attrs = append(attrs, "facets", strings.Join(req.Facets, ","))
+	}
+	if req.Match.MinimumShouldMatch != "" {
+		attrs = append(attrs, "minimum_should_match", req.Match.MinimumShouldMatch)
+	}
+	if resp.TimedOut {
+		attrs = append(attrs, "timed_out", true)
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	l.Warn("slow query", attrs...)
+}
+
+// logChange logs a change to document id, made or queued for the next refresh.
+func (s *Server) logChange(op index.BulkOp, id int, queued bool) {
+	if queued {
+		s.log().Debug("change queued", "op", op, "id", id)
+	} else {
+		s.log().Debug("change", "op", op, "id", id)
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Metrics
+// GET /metrics serves counters and latency histograms in the Prometheus text
+// format, along with the size of the index and the query cache at the time of
+// the scrape. Rates like queries or documents per second are for Prometheus to
+// work out from the totals (rate(fts_searches_total[1m])). The few metric types
+// needed are written by hand rather than pulling in the Prometheus client.
+type metrics struct {
+	searches      atomic.Int64
+	searchErrors  atomic.Int64
+	searchSeconds *histogram
+	limited       atomic.Int64
+
+	// Documents by operation (add, update, delete) and the time the index was
+	// locked for writing them.
+	documents    map[index.BulkOp]*atomic.Int64
+	writeSeconds *histogram
+}
+
+var bulkOps = []index.BulkOp{index.BulkAdd, index.BulkUpdate, index.BulkDelete}
+
+// Latency buckets in seconds, from half a millisecond up.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+func newMetrics() *metrics {
+	m := &metrics{searchSeconds: newHistogram(latencyBuckets), writeSeconds: newHistogram(latencyBuckets)}
+	m.documents = make(map[index.BulkOp]*atomic.Int64)
+	for _, op := range bulkOps {
+		m.documents[op] = new(atomic.Int64)
+	}
+	return m
+}
+
+func (m *metrics) search(start time.Time, err error) {
+	m.searches.Add(1)
+	if err != nil {
+		m.searchErrors.Add(1)
+	}
+	m.searchSeconds.observe(time.Since(start).Seconds())
+}
+
+// changed counts n documents changed with op.
+func (m *metrics) changed(op index.BulkOp, n int) {
+	m.documents[op].Add(int64(n))
+}
+
+// wrote records a change that started at start.
+func (m *metrics) wrote(start time.Time) {
+	m.writeSeconds.observe(time.Since(start).Seconds())
+}
+
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, h.sum, name, h.count)
+}
+
+func writeMetric(w io.Writer, name, kind, help string, v float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, v)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m := s.metrics
+
+	writeMetric(w, "fts_searches_total", "counter", "Searches run, including the ones answered from the cache.", float64(m.searches.Load()))
+	writeMetric(w, "fts_search_errors_total", "counter", "Searches that failed, mostly on bad queries.", float64(m.searchErrors.Load()))
+	m.searchSeconds.write(w, "fts_search_duration_seconds", "Time taken by searches.")
+	writeMetric(w, "fts_rate_limited_total", "counter", "Requests refused with 429 by the rate limit or the query slots.", float64(m.limited.Load()))
+
+	fmt.Fprintf(w, "# HELP fts_documents_total Documents added, updated or deleted.\n# TYPE fts_documents_total counter\n")
+	for _, op := range bulkOps {
+		fmt.Fprintf(w, "fts_documents_total{op=%q} %d\n", op, m.documents[op].Load())
+	}
+	m.writeSeconds.write(w, "fts_write_duration_seconds", "Time the index was locked for a change, a bulk request being one change.")
+
+	st := s.Stats()
+	writeMetric(w, "fts_index_documents", "gauge", "Live documents in the index.", float64(st.Documents))
+	writeMetric(w, "fts_index_deleted_documents", "gauge", "Deleted documents whose postings haven't been compacted away.", float64(st.Deleted))
+	writeMetric(w, "fts_index_terms", "gauge", "Terms in the dictionary.", float64(st.Terms))
+	writeMetric(w, "fts_index_postings", "gauge", "Entries in all posting lists.", float64(st.Postings))
+	writeMetric(w, "fts_index_memory_bytes", "gauge", "Estimated heap size of the index.", float64(st.MemoryBytes))
+	writeMetric(w, "fts_index_memory_limit_bytes", "gauge", "Memory limit of the index, 0 for none.", float64(st.MemoryLimit))
+	writeMetric(w, "fts_store_memory_bytes", "gauge", "Estimated heap size of the stored documents.", float64(st.Memory.Stored))
+	writeMetric(w, "fts_index_mapped_bytes", "gauge", "Size of the memory-mapped index file, if any.", float64(st.MappedBytes))
+
+	cs := s.CacheStats()
+	writeMetric(w, "fts_cache_entries", "gauge", "Responses in the query cache.", float64(cs.Size))
+	writeMetric(w, "fts_cache_hits_total", "counter", "Searches answered from the query cache.", float64(cs.Hits))
+	writeMetric(w, "fts_cache_misses_total", "counter", "Searches the query cache didn't have.", float64(cs.Misses))
+}
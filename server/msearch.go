@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Multi-search
+// POST /msearch runs several searches in one request, for a dashboard that shows
+// a dozen small result lists and would otherwise make a round trip for each:
+//
+//	{"searches": [{"q": "cat", "limit": 5}, {"q": "dog", "facets": "lang", "limit": 0}]}
+//
+// Every search takes the parameters of GET /search, as strings, numbers or
+// booleans, and the responses come back in the same order: each the
+// SearchResponse that search alone would have got, or its error and status. They
+// run on a few goroutines at a time, GOMAXPROCS by default or "workers" if that's
+// lower, and take one slot of the rate limits (see RateLimit) between them. A
+// request with more than MaxMultiSearch searches is refused with 413.
+const MaxMultiSearch = 100
+
+type MultiSearchResult struct {
+	Response SearchResponse
+	Err      error
+}
+
+// MultiSearch runs reqs like SearchContext on up to workers goroutines,
+// GOMAXPROCS if workers is 0, each limited by the server's search timeout.
+func (s *Server) MultiSearch(ctx context.Context, reqs []SearchRequest, workers int) []MultiSearchResult {
+	timeouts := make([]time.Duration, len(reqs))
+	for i := range timeouts {
+		timeouts[i] = s.searchTimeout
+	}
+	return s.multiSearch(ctx, reqs, timeouts, workers)
+}
+
+func (s *Server) multiSearch(ctx context.Context, reqs []SearchRequest, timeouts []time.Duration, workers int) []MultiSearchResult {
+	if workers <= 0 || workers > runtime.GOMAXPROCS(0) {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	r := make([]MultiSearchResult, len(reqs))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(reqs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				ctx, cancel := ctx, context.CancelFunc(func() {})
+				if timeouts[i] > 0 {
+					ctx, cancel = context.WithTimeout(ctx, timeouts[i])
+				}
+				r[i].Response, r[i].Err = s.SearchContext(ctx, reqs[i])
+				cancel()
+			}
+		}()
+	}
+	for i := range reqs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return r
+}
+
+type multiSearchItem struct {
+	*SearchResponse
+	Error  string `json:"error,omitempty"`
+	Status int    `json:"status"`
+}
+
+func (s *Server) handleMultiSearch(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Searches []map[string]any `json:"searches"`
+		Workers  int              `json:"workers"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body.Searches) > MaxMultiSearch {
+		http.Error(w, "more than "+strconv.Itoa(MaxMultiSearch)+" searches", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	start := time.Now()
+	items := make([]multiSearchItem, len(body.Searches))
+	var reqs []SearchRequest
+	var timeouts []time.Duration
+	var queued []int // item of every search in reqs
+	for i, params := range body.Searches {
+		req, timeout, err := s.searchRequest(searchParams(params))
+		if err != nil {
+			items[i] = multiSearchItem{Error: err.Error(), Status: http.StatusBadRequest}
+			continue
+		}
+		req.Principals = s.principals(r)
+		reqs, timeouts, queued = append(reqs, req), append(timeouts, timeout), append(queued, i)
+	}
+
+	for j, res := range s.multiSearch(r.Context(), reqs, timeouts, body.Workers) {
+		item := &items[queued[j]]
+		switch {
+		case errors.Is(res.Err, context.DeadlineExceeded) || errors.Is(res.Err, context.Canceled):
+			item.Error, item.Status = "search timed out", http.StatusServiceUnavailable
+		case res.Err != nil:
+			item.Error, item.Status = res.Err.Error(), http.StatusBadRequest
+		default:
+			item.SearchResponse, item.Status = &res.Response, http.StatusOK
+		}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Took      string            `json:"took"`
+		Responses []multiSearchItem `json:"responses"`
+	}{time.Since(start).String(), items})
+}
+
+// searchParams turns the JSON object of a search into GET /search parameters.
+func searchParams(obj map[string]any) url.Values {
+	params := make(url.Values, len(obj))
+	for name, v := range obj {
+		switch v := v.(type) {
+		case string:
+			params.Set(name, v)
+		case json.Number:
+			params.Set(name, v.String())
+		case bool:
+			if v {
+				params.Set(name, "1")
+			}
+		case []any:
+			// "facets": ["lang", "year"] for "lang,year".
+			values := make([]string, len(v))
+			for i, item := range v {
+				values[i] = fmt.Sprint(item)
+			}
+			params.Set(name, strings.Join(values, ","))
+		}
+	}
+	return params
+}
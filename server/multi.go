@@ -0,0 +1,296 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/store"
+)
+
+// Several indexes
+// A Multi hosts any number of independent indexes under names like wikipedia,
+// docs or logs, each a Server of its own with its own analyzer, documents and
+// storage. Its API is the one of each Server under /indices/{name}:
+//
+//	GET    /indices                    the names and sizes of the indexes
+//	PUT    /indices/{name}             create an empty one (see IndexSettings)
+//	DELETE /indices/{name}             drop one
+//	GET    /indices/{name}/search?q=   and every other endpoint of a Server
+//
+// Add, Remove, Index and Names do the same from Go. How PUT makes an index and
+// what DELETE does with it can be set with SetCreate and SetDrop; by default the
+// new index is kept in memory and a dropped one is only forgotten. API keys and
+// the rate limit of a Multi apply to all of its indexes together.
+type Multi struct {
+	mu      sync.RWMutex
+	servers map[string]*Server
+	mux     *http.ServeMux
+
+	createMu sync.Mutex // one Create at a time
+	create   func(name string, settings IndexSettings) (*Server, error)
+	drop     func(name string, srv *Server) error
+
+	auth    *auth
+	limiter *limiter
+}
+
+// IndexSettings is the body of PUT /indices/{name}: the settings of its
+// analysis.Standard analyzer and where to keep the posting lists.
+type IndexSettings struct {
+	CharFilters []string `json:"char_filters,omitempty"`
+	Filters     []string `json:"filters,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Stemmer     string   `json:"stemmer,omitempty"`
+	Stopwords   []string `json:"stopwords,omitempty"`
+	NoStopwords bool     `json:"no_stopwords,omitempty"`
+
+	MinTokenLength int    `json:"min_token_length,omitempty"`
+	MaxTokenLength int    `json:"max_token_length,omitempty"`
+	DropPattern    string `json:"drop_pattern,omitempty"`
+
+	// The dictionary of an analysis.Decompounder.
+	DecompoundWords []string `json:"decompound_words,omitempty"`
+
+	Normalization string `json:"normalization,omitempty"` // nfc or nfkc
+	FoldAccents   bool   `json:"fold_accents,omitempty"`
+
+	// Words kept from stopword removal and stemming, see analysis.Standard.
+	Keywords []string `json:"keywords,omitempty"`
+
+	// "memory" (or empty) by default; SetCreate may know others.
+	Storage string `json:"storage,omitempty"`
+}
+
+// Analyzer builds the analyzer of the settings and checks it.
+func (st IndexSettings) Analyzer() (*analysis.Standard, error) {
+	a := &analysis.Standard{CharFilters: st.CharFilters, Filters: st.Filters, Language: st.Language, Stemmer: st.Stemmer, NoStopwords: st.NoStopwords,
+		MinTokenLength: st.MinTokenLength, MaxTokenLength: st.MaxTokenLength, DropPattern: st.DropPattern,
+		Normalization: st.Normalization, FoldAccents: st.FoldAccents, Keywords: st.Keywords}
+	if st.DecompoundWords != nil {
+		a.Decompound = analysis.NewDecompounder(st.DecompoundWords...)
+	}
+	if st.Stopwords != nil {
+		a.Stopwords = make(analysis.StopwordSet, len(st.Stopwords))
+		for _, w := range st.Stopwords {
+			a.Stopwords[w] = struct{}{}
+		}
+	}
+	if err := a.Validate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+var (
+	ErrIndexExists  = errors.New("index exists already")
+	ErrNoIndex      = errors.New("no such index")
+	ErrIndexName    = errors.New("index names are lowercase letters, digits, '.', '_' and '-', starting with a letter or digit")
+	ErrIndexStorage = errors.New("unknown storage")
+)
+
+var indexName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+func NewMulti() *Multi {
+	m := &Multi{servers: make(map[string]*Server), mux: http.NewServeMux(), create: createInMemory}
+	m.mux.HandleFunc("GET /indices", m.handleList)
+	m.mux.HandleFunc("PUT /indices/{name}", m.handleCreate)
+	m.mux.HandleFunc("DELETE /indices/{name}", m.handleDrop)
+	m.mux.HandleFunc("/indices/{name}/", m.handleIndex)
+	return m
+}
+
+func createInMemory(name string, settings IndexSettings) (*Server, error) {
+	if settings.Storage != "" && settings.Storage != "memory" {
+		return nil, fmt.Errorf("%w %q", ErrIndexStorage, settings.Storage)
+	}
+	a, err := settings.Analyzer()
+	if err != nil {
+		return nil, err
+	}
+	return New(index.New(a), store.NewMemory(nil)), nil
+}
+
+// SetCreate makes PUT /indices/{name} create indexes with fn. Call it before
+// serving.
+func (m *Multi) SetCreate(fn func(name string, settings IndexSettings) (*Server, error)) {
+	m.create = fn
+}
+
+// SetDrop makes DELETE /indices/{name} call fn on the index after removing it,
+// to close and delete its files. Call it before serving.
+func (m *Multi) SetDrop(fn func(name string, srv *Server) error) {
+	m.drop = fn
+}
+
+// SetAuth turns on API keys for every index, see Auth. Creating and dropping
+// indexes are changes. Call it before serving.
+func (m *Multi) SetAuth(a Auth) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.auth = newAuth(a)
+	for _, srv := range m.servers {
+		srv.auth = m.auth
+	}
+}
+
+// SetRateLimit limits the requests of each client to all the indexes together,
+// see RateLimit. Call it before serving.
+func (m *Multi) SetRateLimit(l RateLimit) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limiter = newLimiter(l)
+	for _, srv := range m.servers {
+		srv.limiter = m.limiter
+	}
+}
+
+// Add hosts srv under name.
+func (m *Multi) Add(name string, srv *Server) error {
+	if !indexName.MatchString(name) {
+		return ErrIndexName
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.servers[name]; ok {
+		return ErrIndexExists
+	}
+	if m.auth != nil {
+		srv.auth = m.auth
+	}
+	if m.limiter != nil {
+		srv.limiter = m.limiter
+	}
+	m.servers[name] = srv
+	return nil
+}
+
+// Create makes a new index the way PUT /indices/{name} does and adds it.
+func (m *Multi) Create(name string, settings IndexSettings) (*Server, error) {
+	if !indexName.MatchString(name) {
+		return nil, ErrIndexName
+	}
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+	if m.Index(name) != nil {
+		return nil, ErrIndexExists
+	}
+	srv, err := m.create(name, settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Add(name, srv); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// Remove stops hosting an index and returns it, nil if there was none.
+func (m *Multi) Remove(name string) *Server {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	srv := m.servers[name]
+	delete(m.servers, name)
+	return srv
+}
+
+// Index returns the index called name, nil if there is none.
+func (m *Multi) Index(name string) *Server {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.servers[name]
+}
+
+func (m *Multi) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r := make([]string, 0, len(m.servers))
+	for name := range m.servers {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func (m *Multi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mux.ServeHTTP(w, r)
+}
+
+type IndexInfo struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Terms     int    `json:"terms"`
+}
+
+func (m *Multi) handleList(w http.ResponseWriter, r *http.Request) {
+	if !m.auth.authorize(w, r) {
+		return
+	}
+	infos := []IndexInfo{}
+	for _, name := range m.Names() {
+		if srv := m.Index(name); srv != nil {
+			st := srv.Stats()
+			infos = append(infos, IndexInfo{name, st.Documents, st.Terms})
+		}
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (m *Multi) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if !m.auth.authorize(w, r) {
+		return
+	}
+	var settings IndexSettings
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "bad settings: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	name := r.PathValue("name")
+	switch _, err := m.Create(name, settings); {
+	case errors.Is(err, ErrIndexExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeJSON(w, http.StatusCreated, IndexInfo{Name: name})
+	}
+}
+
+func (m *Multi) handleDrop(w http.ResponseWriter, r *http.Request) {
+	if !m.auth.authorize(w, r) {
+		return
+	}
+	name := r.PathValue("name")
+	srv := m.Remove(name)
+	if srv == nil {
+		http.Error(w, ErrNoIndex.Error(), http.StatusNotFound)
+		return
+	}
+	if m.drop != nil {
+		if err := m.drop(name, srv); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleIndex hands the request to the index with the /indices/{name} prefix
+// taken off the path.
+func (m *Multi) handleIndex(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	srv := m.Index(name)
+	if srv == nil {
+		http.Error(w, ErrNoIndex.Error(), http.StatusNotFound)
+		return
+	}
+	http.StripPrefix("/indices/"+name, srv).ServeHTTP(w, r)
+}
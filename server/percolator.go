@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+)
+
+// Percolator
+// With SetPercolator a server matches every document added or updated, one at a
+// time or in bulk, against the standing queries of a search.Percolator, and
+// raises an Alert for every query it matches: logged, and sent to whoever is
+// following GET /percolator/alerts, a stream of server-sent events. A queued
+// change (see SetRefreshInterval) is matched when it's queued.
+//
+//	GET    /percolator              the registered queries
+//	PUT    /percolator/{id}         register {"query": "..."} under id
+//	DELETE /percolator/{id}         remove it
+//	POST   /percolate               the queries a document would match, without indexing it
+//	GET    /percolator/alerts       the alerts from now on, as text/event-stream
+//
+// A follower too slow to keep up misses alerts rather than holding up indexing.
+// With an ACL (see SetACL) followers only get alerts for documents their
+// principals may see.
+type Alert struct {
+	Query    string    `json:"query"`
+	Document int       `json:"document"`
+	Title    string    `json:"title,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	Time     time.Time `json:"time"`
+
+	acl []string
+}
+
+// alertBuffer is the alerts a follower may fall behind by.
+const alertBuffer = 64
+
+type alerts struct {
+	mu        sync.Mutex
+	followers map[chan Alert]struct{}
+}
+
+// SetPercolator matches changed documents against p. Call it before serving.
+func (s *Server) SetPercolator(p *search.Percolator) {
+	s.percolator = p
+}
+
+// Percolator is what SetPercolator set, nil if none.
+func (s *Server) Percolator() *search.Percolator {
+	return s.percolator
+}
+
+// Alerts follows the alerts until stop is called.
+func (s *Server) Alerts() (alerts <-chan Alert, stop func()) {
+	c := make(chan Alert, alertBuffer)
+	s.alerts.mu.Lock()
+	if s.alerts.followers == nil {
+		s.alerts.followers = make(map[chan Alert]struct{})
+	}
+	s.alerts.followers[c] = struct{}{}
+	s.alerts.mu.Unlock()
+	return c, func() {
+		s.alerts.mu.Lock()
+		delete(s.alerts.followers, c)
+		s.alerts.mu.Unlock()
+	}
+}
+
+// percolate raises the alerts for doc. The caller must hold the index lock.
+func (s *Server) percolate(idx *index.Index, doc index.Document) {
+	if s.percolator == nil {
+		return
+	}
+	now := time.Now()
+	for _, q := range s.percolator.Match(idx, doc) {
+		s.log().Info("percolator match", "query", q, "id", doc.ID)
+		a := Alert{Query: q, Document: doc.ID, Title: doc.Title, URL: doc.URL, Time: now, acl: doc.Keywords[index.ACLField]}
+		s.alerts.mu.Lock()
+		for c := range s.alerts.followers {
+			select {
+			case c <- a:
+			default:
+			}
+		}
+		s.alerts.mu.Unlock()
+	}
+}
+
+// percolateQueued is percolate for a queued change, which doesn't hold the index.
+func (s *Server) percolateQueued(doc index.Document) {
+	if s.percolator == nil {
+		return
+	}
+	idx, done := s.idx.Read()
+	defer done()
+	s.percolate(idx, doc)
+}
+
+// percolatorOff answers 404 if there's no percolator.
+func (s *Server) percolatorOff(w http.ResponseWriter) bool {
+	if s.percolator == nil {
+		http.Error(w, "percolator is off", http.StatusNotFound)
+		return true
+	}
+	return false
+}
+
+func (s *Server) handlePercolatorQueries(w http.ResponseWriter, r *http.Request) {
+	if s.percolatorOff(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.percolator.Queries())
+}
+
+func (s *Server) handleRegisterQuery(w http.ResponseWriter, r *http.Request) {
+	if s.percolatorOff(w) {
+		return
+	}
+	var req struct {
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	idx, done := s.idx.Read()
+	defer done()
+	if _, err := search.ParseIndex(idx, req.Query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.percolator.Register(idx, r.PathValue("id"), req.Query); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, search.PercolatorQuery{ID: r.PathValue("id"), Query: req.Query})
+}
+
+func (s *Server) handleRemoveQuery(w http.ResponseWriter, r *http.Request) {
+	if s.percolatorOff(w) {
+		return
+	}
+	switch err := s.percolator.Remove(r.PathValue("id")); {
+	case errors.Is(err, search.ErrNoQuery):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handlePercolate(w http.ResponseWriter, r *http.Request) {
+	if s.percolatorOff(w) {
+		return
+	}
+	doc, ok := decodeDocument(w, r)
+	if !ok {
+		return
+	}
+	idx, done := s.idx.Read()
+	matches := s.percolator.Match(idx, s.prepare(doc))
+	done()
+	writeJSON(w, http.StatusOK, struct {
+		Matches []string `json:"matches"`
+	}{append([]string{}, matches...)})
+}
+
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if s.percolatorOff(w) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	principals := s.principals(r)
+	alerts, stop := s.Alerts()
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.draining:
+			return
+		case a := <-alerts:
+			if s.acl != nil && !(index.Document{Keywords: map[string][]string{index.ACLField: a.acl}}).Allows(principals) {
+				continue
+			}
+			data, _ := json.Marshal(a)
+			if _, err := fmt.Fprintf(w, "event: alert\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rate limiting
+// One client sending queries in a loop would otherwise get as much of the index
+// as all the others together. With SetRateLimit each client gets a token bucket
+// that fills at Rate requests a second up to Burst; a request finding it empty is
+// refused with 429 and a Retry-After of when the next token is due. Queries
+// (search, similar, complete) also need one of MaxQueries slots, at most
+// MaxClientQueries of them per client, and get 429 if there is none free, so
+// slow queries can't pile up either.
+//
+// A client is its API key (see auth.go) if it sends one the server knows and
+// that may make the request, or else its IP address, so made-up keys can't get a
+// bucket each. The address is the one the connection comes from, so behind a proxy every
+// client is the proxy unless it forwards keys.
+type RateLimit struct {
+	Rate             float64 // requests a second per client, 0 for no limit
+	Burst            int     // requests a client may send at once, at least 1
+	MaxQueries       int     // queries running at once over all clients, 0 for no limit
+	MaxClientQueries int     // queries running at once per client, 0 for no limit
+}
+
+type limiter struct {
+	RateLimit
+
+	mu      sync.Mutex
+	clients map[string]*client
+	swept   time.Time
+	running int
+}
+
+type client struct {
+	tokens  float64
+	at      time.Time // when tokens was last brought up to date
+	seen    time.Time
+	running int
+}
+
+// Clients idle for longer than this (and so with a full bucket) are forgotten.
+const clientIdle = 10 * time.Minute
+
+// SetRateLimit limits the requests of each client, see RateLimit. Call it before
+// serving.
+func (s *Server) SetRateLimit(l RateLimit) {
+	s.limiter = newLimiter(l)
+}
+
+// newLimiter returns nil if l doesn't limit anything.
+func newLimiter(l RateLimit) *limiter {
+	if l.Rate <= 0 && l.MaxQueries <= 0 && l.MaxClientQueries <= 0 {
+		return nil
+	}
+	l.Burst = max(l.Burst, 1)
+	return &limiter{RateLimit: l, clients: make(map[string]*client)}
+}
+
+// clientKey identifies who sent r.
+func (s *Server) clientKey(r *http.Request) string {
+	if key := requestKey(r); s.auth.valid(key, isWrite(r)) {
+		return "key:" + key
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// allow takes a token from the bucket of key, or returns how long until there
+// is one.
+func (l *limiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l.Rate <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.client(key, now)
+	c.tokens = math.Min(float64(l.Burst), c.tokens+now.Sub(c.at).Seconds()*l.Rate)
+	c.at = now
+	if c.tokens < 1 {
+		return false, time.Duration((1 - c.tokens) / l.Rate * float64(time.Second))
+	}
+	c.tokens--
+	return true, 0
+}
+
+// client returns the state of key, forgetting idle clients now and then. The
+// caller must hold l.mu.
+func (l *limiter) client(key string, now time.Time) *client {
+	if now.Sub(l.swept) > clientIdle {
+		for k, c := range l.clients {
+			if c.running == 0 && now.Sub(c.seen) > clientIdle {
+				delete(l.clients, k)
+			}
+		}
+		l.swept = now
+	}
+	c, ok := l.clients[key]
+	if !ok {
+		c = &client{tokens: float64(l.Burst), at: now}
+		l.clients[key] = c
+	}
+	c.seen = now
+	return c
+}
+
+// acquire takes a query slot for key; done gives it back.
+func (l *limiter) acquire(key string) (done func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c := l.client(key, time.Now())
+	if (l.MaxQueries > 0 && l.running >= l.MaxQueries) || (l.MaxClientQueries > 0 && c.running >= l.MaxClientQueries) {
+		return nil, false
+	}
+	l.running++
+	c.running++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.running--
+		c.running--
+	}, true
+}
+
+// limit refuses r if its client has run out of requests.
+func (s *Server) limit(w http.ResponseWriter, r *http.Request) bool {
+	if s.limiter == nil {
+		return true
+	}
+	ok, wait := s.limiter.allow(s.clientKey(r), time.Now())
+	if !ok {
+		s.metrics.limited.Add(1)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+	}
+	return ok
+}
+
+// query wraps the handler of a query endpoint to take a query slot.
+func (s *Server) query(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil {
+			h(w, r)
+			return
+		}
+		done, ok := s.limiter.acquire(s.clientKey(r))
+		if !ok {
+			s.metrics.limited.Add(1)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many queries running", http.StatusTooManyRequests)
+			return
+		}
+		defer done()
+		h(w, r)
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/store"
+)
+
+func TestRateLimitKeys(t *testing.T) {
+	srv := New(index.New(nil), store.NewMemory(nil))
+	srv.SetAuth(Auth{Keys: map[string]Access{"reader": AccessRead}})
+	srv.SetRateLimit(RateLimit{Rate: 0.001, Burst: 2})
+
+	search := func(key string) int {
+		r := httptest.NewRequest("GET", "/search?q=cat", nil)
+		if key != "" {
+			r.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	// Keys the server doesn't know all count against the one address.
+	for i := range 2 {
+		if code := search(fmt.Sprintf("bogus-%d", i)); code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want %d", i, code, http.StatusOK)
+		}
+	}
+	if code := search("bogus-2"); code != http.StatusTooManyRequests {
+		t.Errorf("third bogus key: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := search(""); code != http.StatusTooManyRequests {
+		t.Errorf("no key: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	// A real key has a bucket of its own.
+	if code := search("reader"); code != http.StatusOK {
+		t.Errorf("known key: status %d, want %d", code, http.StatusOK)
+	}
+}
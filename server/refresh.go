@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/wal"
+)
+
+// Refreshing
+// By default a change is indexed before it's acknowledged, which means waiting
+// for the searches running to finish, throwing the query cache away and, for an
+// index with a storage, a Commit, all for one document. With a refresh interval
+// set, adds, updates and deletes are logged (see SetWAL) and queued instead and
+// acknowledged at once, and RefreshEvery applies the queue as one batch every
+// interval: a burst of writes then costs one index change, and searches find a
+// new document within the interval rather than right away. GET /documents/{id}
+// sees queued changes already, and they can be updated or deleted again before
+// they're applied.
+//
+// POST /refresh, or Refresh, applies the queue now. A bulk request, a checkpoint
+// and a snapshot apply it first, so they include every change acknowledged before
+// them. Queued changes are only as safe as the log: without one they're lost in a
+// crash, like every change since the index was last saved.
+
+// SetRefreshInterval queues changes until the next refresh, d apart, instead of
+// indexing each as it's made; 0 turns that off. RefreshEvery does the refreshing.
+// Call it before serving.
+func (s *Server) SetRefreshInterval(d time.Duration) {
+	s.refreshInterval = d
+	if s.pendingDocs == nil {
+		s.pendingDocs = make(map[int]*index.Document)
+	}
+}
+
+// RefreshEvery refreshes at the refresh interval until stop is closed. Errors go
+// to fail.
+func (s *Server) RefreshEvery(stop <-chan struct{}, fail func(error)) {
+	if s.refreshInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(s.refreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if _, err := s.Refresh(); err != nil {
+				fail(err)
+			}
+		}
+	}
+}
+
+// Refresh indexes the queued changes and returns how many there were.
+func (s *Server) Refresh() (int, error) {
+	s.pendMu.Lock()
+	defer s.pendMu.Unlock()
+	return s.refresh()
+}
+
+// refresh is Refresh with pendMu held. A change the store refuses stays queued,
+// and so do the ones after it.
+func (s *Server) refresh() (int, error) {
+	if len(s.pending) == 0 {
+		return 0, nil
+	}
+	idx, done := s.idx.Write()
+	defer done()
+
+	start := time.Now()
+	b := idx.Bulk()
+	n := 0
+	var err error
+	for _, e := range s.pending {
+		switch e.Op {
+		case index.BulkAdd, index.BulkUpdate:
+			if err = s.docs.Put(*e.Document); err == nil && b.Has(e.ID) {
+				b.Update(*e.Document)
+			} else if err == nil {
+				b.Add(*e.Document)
+			}
+		case index.BulkDelete:
+			if err = s.docs.Delete(e.ID); err == nil {
+				b.Delete(e.ID)
+			}
+		}
+		if err != nil {
+			break
+		}
+		n++
+	}
+
+	for _, res := range b.Apply() {
+		if res.Err == nil {
+			s.metrics.changed(res.Op, 1)
+		}
+	}
+	s.changed()
+	if cerr := idx.Commit(); err == nil {
+		err = cerr
+	}
+
+	s.pending = s.pending[n:]
+	clear(s.pendingDocs)
+	for _, e := range s.pending {
+		s.pendingDocs[e.ID] = e.Document
+	}
+	s.log().Debug("refresh", "changes", n, "left", len(s.pending), "took", time.Since(start))
+	return n, err
+}
+
+// queue logs e and queues it for the next refresh. The caller must hold pendMu.
+func (s *Server) queue(e wal.Entry) error {
+	if err := s.logChanges(e); err != nil {
+		return err
+	}
+	s.pending = append(s.pending, e)
+	s.pendingDocs[e.ID] = e.Document
+	return nil
+}
+
+// queuedHas is has for the index with the queued changes applied. The caller
+// must hold pendMu.
+func (s *Server) queuedHas(id int) bool {
+	if doc, ok := s.pendingDocs[id]; ok {
+		return doc != nil
+	}
+	idx, done := s.idx.Read()
+	defer done()
+	return s.has(idx, id)
+}
+
+// nextID is the ID of the next new document. The caller must hold pendMu.
+func (s *Server) nextID() int {
+	id := s.docs.Len()
+	for _, e := range s.pending {
+		if e.Op == index.BulkAdd {
+			id = max(id, e.ID+1)
+		}
+	}
+	return id
+}
+
+// queued returns the queued version of document id, nil if it's queued to be
+// deleted, and whether there is one.
+func (s *Server) queued(id int) (*index.Document, bool) {
+	if s.refreshInterval <= 0 {
+		return nil, false
+	}
+	s.pendMu.Lock()
+	defer s.pendMu.Unlock()
+	doc, ok := s.pendingDocs[id]
+	return doc, ok
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	n, err := s.Refresh()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Refreshed int `json:"refreshed"`
+	}{n})
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/store"
+)
+
+// Reloading
+// An index rebuilt from scratch elsewhere (fts index into a new directory, then
+// moved over the old one) can replace the one being served without a restart,
+// blue/green style. POST /reload, or Reload, loads the new index and store with
+// the function set by SetReload while searches go on against the old ones, then
+// swaps them in once the searches running are done, which is as long as any
+// change waits. No request fails or sees half of one and half of the other.
+// Exports that started before go on with the old index; the old index and store
+// are closed after the last of them.
+//
+// The new index is all there is afterwards: changes queued for a refresh are
+// dropped, and a server with a write-ahead log can't reload, since the log's
+// changes are to the old index.
+var (
+	ErrReloadOff = errors.New("reloading is off")
+	ErrReloadWAL = errors.New("can't reload an index with a write-ahead log")
+)
+
+// SetReload lets Reload replace the index and store with those load returns.
+func (s *Server) SetReload(load func() (*index.Index, store.Store, error)) {
+	s.reload = load
+}
+
+// Reload loads the index and store anew and serves them from now on. On error
+// the old ones are served on.
+func (s *Server) Reload() (index.Stats, error) {
+	if s.reload == nil {
+		return index.Stats{}, ErrReloadOff
+	}
+	if s.wal != nil {
+		return index.Stats{}, ErrReloadWAL
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	start := time.Now()
+	idx, docs, err := s.reload()
+	if err != nil {
+		s.log().Error("reload", "error", err)
+		return index.Stats{}, err
+	}
+	stats := idx.Stats()
+
+	s.pendMu.Lock()
+	defer s.pendMu.Unlock()
+	var oldDocs store.Store
+	old, drained := s.idx.Swap(idx, func() {
+		oldDocs, s.docs = s.docs, docs
+		s.pending = nil
+		if s.pendingDocs != nil {
+			s.pendingDocs = make(map[int]*index.Document)
+		}
+		s.changed()
+		s.unsaved.Store(false)
+	})
+	go func() {
+		drained()
+		if err := old.Close(); err != nil {
+			s.log().Error("closing the old index after a reload", "error", err)
+		}
+		if c, ok := oldDocs.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				s.log().Error("closing the old store after a reload", "error", err)
+			}
+		}
+	}()
+	s.log().Info("reload", "documents", stats.Documents, "took", time.Since(start))
+	return stats, nil
+}
+
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	stats, err := s.Reload()
+	switch {
+	case errors.Is(err, ErrReloadOff):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrReloadWAL):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Documents int    `json:"documents"`
+		Took      string `json:"took"`
+	}{stats.Documents, time.Since(start).String()})
+}
@@ -0,0 +1,971 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/analysis"
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+	"github.com/leoashish/FullTextSearchApp/store"
+	"github.com/leoashish/FullTextSearchApp/wal"
+)
+
+// Server
+// A small JSON API over one index and the documents it was built from:
+//
+//	GET  /                       a page to search from in a browser (see ui.go)
+//	GET  /search?q=...&limit=N&offset=M   a page of ranked hits (see search.Query)
+//	     &facets=category,lang&facet_size=K   plus the top K values of keyword fields
+//	     &explain=1                   plus how every hit's score came about
+//	     &sort=year:desc,title        ordered by fields instead (see index.SortField)
+//	     &sort=place:near(52.5,13.4)  nearest first, with the distance of every hit
+//	     &collapse=host               one hit per value of a field (see index.SearchOptions)
+//	     &decay=date:gauss(30d)       newer documents first, by how much (see index.Decay)
+//	     &diversify=host:2            at most 2 of the best hits per value of a field (see index.Diversify)
+//	     &knn=embedding:0.1,0.3,...&knn_k=20  also by nearness to a vector, fused
+//	     with the text ranking, or by it alone without q (see index.VectorQuery)
+//	     &knn_exact=1                 comparing with every vector instead of the graph
+//	     &fields=title,text,year      with these fields of the documents (see index.Document.Select)
+//	     &highlight=1                 with a snippet of the text, matches highlighted
+//	     &timeout=500ms               giving up after this long (see SearchContext)
+//	     &minimum_should_match=2&relax=1  with fewer of the terms (see search.MatchOptions)
+//	GET  /export?q=...           every hit as JSON lines, in batches (see Export)
+//	POST /msearch                several searches at once (see MultiSearch)
+//	POST /documents              index a new document, returns its ID
+//	GET  /documents/{id}         fetch a stored document
+//	GET  /documents/{id}/termvector  its indexed terms with frequencies and positions
+//	GET  /documents/{id}/similar?limit=N  the documents most like it (see SimilarRequest)
+//	PUT  /documents/{id}         replace a document and re-index it
+//	DELETE /documents/{id}       remove a document from the index
+//	POST /bulk                   many adds, updates and deletes at once (see Bulk)
+//	POST /refresh                make queued changes searchable now (see SetRefreshInterval)
+//	POST /reload                 swap in a newly built index and store (see SetReload)
+//	GET  /analyze?text=...       the analysis stages for some text
+//	GET  /_analyze?text=...&analyzer=name&field=title  every token with its position
+//	     and the steps that made it (see ExplainAnalysisHandler), or POST them as JSON
+//	GET  /complete?q=...&n=N     the N most frequent terms starting with q,
+//	     &titles=1                    or the heaviest titles
+//	     &queries=1                   or past queries (see SetQueryLog)
+//	GET  /cache                  hit and miss counts of the query cache
+//	GET  /stats                  size of the index and its most frequent terms
+//	GET  /metrics                Prometheus metrics (see metrics.go)
+//	POST /snapshot               write a copy of the index and documents (see Snapshot)
+//	GET  /snapshot               download such a copy as a tarball
+//	GET  /percolator/alerts      documents matching standing queries (see SetPercolator)
+//
+// SetAuth makes changes, and optionally searches, need an API key (see Auth), and
+// SetRateLimit makes clients that send too much get 429 (see RateLimit).
+//
+// Documents are kept in a store.Store next to the index; new ones get the next
+// free ID of the store.
+type Server struct {
+	idx  *index.Shared // guards docs as well
+	docs store.Store
+	mux  *http.ServeMux
+
+	// Completion tries, built on first use and dropped whenever a document changes.
+	compMu      sync.Mutex
+	completions map[bool]*search.CompletionIndex // by titles
+
+	cache *cache // nil when off
+
+	bulkQueue chan struct{} // a slot per bulk request running or waiting
+
+	snapshotDir string // "" if POST /snapshot is off
+
+	wal *wal.Log // nil if changes aren't logged, see wal.go
+
+	// What POST /reload loads, see reload.go; one reload at a time.
+	reload   func() (*index.Index, store.Store, error)
+	reloadMu sync.Mutex
+
+	searchTimeout time.Duration // 0 for none
+
+	detectLanguage bool // of documents without one, see SetDetectLanguage
+	indexHost      bool // of documents' URLs, see SetIndexHost
+
+	limiter *limiter // nil for no limits, see ratelimit.go
+	auth    *auth    // nil if anyone may do anything, see auth.go
+
+	queryLog *search.QueryLog // nil unless queries are logged, see SetQueryLog
+
+	// Changes waiting for the next refresh, see refresh.go.
+	refreshInterval time.Duration // 0 to index changes as they're made
+	pendMu          sync.Mutex
+	pending         []wal.Entry
+	pendingDocs     map[int]*index.Document // the latest queued version, nil if deleted
+
+	metrics *metrics
+
+	logger    *slog.Logger  // slog.Default() if nil, see logging.go
+	slowQuery time.Duration // 0 for no slow query log
+
+	acl func(r *http.Request) []string // nil for no access control, see acl.go
+
+	percolator *search.Percolator // nil if documents aren't percolated, see percolator.go
+	alerts     alerts
+
+	// Closed by Drain, see shutdown.go.
+	draining  chan struct{}
+	drainOnce sync.Once
+	unsaved   atomic.Bool // changes since the index was loaded or last checkpointed
+}
+
+const DefaultLimit = 10
+
+func New(idx *index.Index, docs store.Store) *Server {
+	s := &Server{idx: index.NewShared(idx), docs: docs, mux: http.NewServeMux(), bulkQueue: make(chan struct{}, BulkQueue), metrics: newMetrics(), draining: make(chan struct{})}
+
+	s.mux.HandleFunc("GET /search", s.query(s.handleSearch))
+	s.mux.HandleFunc("GET /export", s.query(s.handleExport))
+	s.mux.HandleFunc("POST /msearch", s.query(s.handleMultiSearch))
+	s.mux.HandleFunc("POST /documents", s.handleAddDocument)
+	s.mux.HandleFunc("GET /documents/{id}", s.handleGetDocument)
+	s.mux.HandleFunc("GET /documents/{id}/termvector", s.handleTermVector)
+	s.mux.HandleFunc("GET /documents/{id}/similar", s.query(s.handleSimilar))
+	s.mux.HandleFunc("PUT /documents/{id}", s.handleUpdateDocument)
+	s.mux.HandleFunc("DELETE /documents/{id}", s.handleDeleteDocument)
+	s.mux.HandleFunc("POST /bulk", s.handleBulk)
+	s.mux.HandleFunc("POST /refresh", s.handleRefresh)
+	s.mux.HandleFunc("POST /reload", s.handleReload)
+	s.mux.HandleFunc("GET /complete", s.query(s.handleComplete))
+	s.mux.HandleFunc("GET /cache", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.CacheStats())
+	})
+	s.mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Stats())
+	})
+	s.mux.HandleFunc("GET /metrics", s.handleMetrics)
+	s.mux.HandleFunc("POST /snapshot", s.handleSnapshot)
+	s.mux.HandleFunc("GET /snapshot", s.handleSnapshotTar)
+	s.mux.HandleFunc("GET /percolator", s.handlePercolatorQueries)
+	s.mux.HandleFunc("PUT /percolator/{id}", s.handleRegisterQuery)
+	s.mux.HandleFunc("DELETE /percolator/{id}", s.handleRemoveQuery)
+	s.mux.HandleFunc("POST /percolate", s.handlePercolate)
+	s.mux.HandleFunc("GET /percolator/alerts", s.handleAlerts)
+	s.mux.HandleFunc("GET /{$}", handleUI)
+	s.mux.Handle("GET /analyze", analyzeHandler(s.analyzer))
+	s.mux.Handle("/_analyze", explainAnalysisHandler(s.analyzer))
+
+	return s
+}
+
+// analyzer is that of the index served now, which a reload may have replaced.
+func (s *Server) analyzer() analysis.Analyzer {
+	idx, done := s.idx.Read()
+	defer done()
+	return idx.Analyzer()
+}
+
+// SetCacheSize keeps the responses of the last n distinct searches, 0 turns the
+// cache off. Call it before serving.
+func (s *Server) SetCacheSize(n int) {
+	s.cache = nil
+	if n > 0 {
+		s.cache = newCache(n)
+	}
+}
+
+// SetSearchTimeout limits searches that don't ask for a timeout of their own to
+// d, 0 for no limit. Call it before serving.
+func (s *Server) SetSearchTimeout(d time.Duration) {
+	s.searchTimeout = d
+}
+
+// SetQueryLog records the queries that find something, other than later pages, in
+// l and makes GET /complete?queries=1 suggest them, see search.QueryLog. Call it
+// before serving.
+func (s *Server) SetQueryLog(l *search.QueryLog) {
+	s.queryLog = l
+}
+
+// SetDetectLanguage makes documents added or updated without a language get
+// the one detected from their text, see index.DetectLanguage. Call it before
+// serving.
+func (s *Server) SetDetectLanguage(on bool) {
+	s.detectLanguage = on
+}
+
+// SetIndexHost makes documents added or updated get the host of their URL in
+// the keyword field host, to collapse on, see index.WithHost. Call it before
+// serving.
+func (s *Server) SetIndexHost(on bool) {
+	s.indexHost = on
+}
+
+// prepare fills in what a new or updated document gets by default.
+func (s *Server) prepare(doc index.Document) index.Document {
+	if doc.Boost == 0 {
+		doc.Boost = index.DefaultBoost
+	}
+	if s.detectLanguage {
+		doc = index.DetectLanguage(doc)
+	}
+	if s.indexHost {
+		doc = index.WithHost(doc)
+	}
+	return doc
+}
+
+func (s *Server) CacheStats() CacheStats {
+	if s.cache == nil {
+		return CacheStats{}
+	}
+	return s.cache.stats()
+}
+
+// Stats is the index's, with the memory of the documents stored in it.
+func (s *Server) Stats() index.Stats {
+	idx, done := s.idx.Read()
+	defer done()
+	st := idx.Stats()
+	st.Memory.Stored = store.MemoryBytes(s.docs)
+	return st
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.limit(w, r) || !s.authorize(w, r) {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Hit is a result with the fields of its document that were asked for, the
+// title and URL unless the request says otherwise.
+type Hit struct {
+	ID       int                       `json:"id"`
+	Score    float64                   `json:"score"`
+	Title    string                    `json:"title,omitempty"`
+	URL      string                    `json:"url,omitempty"`
+	Text     string                    `json:"text,omitempty"`
+	Language string                    `json:"language,omitempty"`
+	Keywords map[string][]string       `json:"keywords,omitempty"`
+	Numbers  map[string]float64        `json:"numbers,omitempty"`
+	Geo      map[string]index.GeoPoint `json:"geo,omitempty"`
+	Nested   map[string][]index.Nested `json:"nested,omitempty"`
+
+	// Hits left out for having the same value of the collapse field.
+	Collapsed int `json:"collapsed,omitempty"`
+
+	// Meters to the point of the first geo sort field, if there is one.
+	Distance *float64 `json:"distance,omitempty"`
+
+	// The best stretch of the text with the words that match in <em>, as HTML,
+	// if the request asked for it (see ui.go).
+	Snippet string `json:"snippet,omitempty"`
+
+	Explanation *index.Explanation `json:"explanation,omitempty"`
+}
+
+type SearchResponse struct {
+	Query  string                        `json:"query"`
+	Total  int                           `json:"total"`
+	Took   string                        `json:"took"`
+	Hits   []Hit                         `json:"hits"`
+	Facets map[string][]index.FacetCount `json:"facets,omitempty"`
+
+	// Set when nothing matched but a corrected query might.
+	DidYouMean string `json:"did_you_mean,omitempty"`
+
+	// Set when the search ran out of time while ranking; the hits are the best
+	// of the matches ranked until then.
+	TimedOut bool `json:"timed_out,omitempty"`
+
+	// Set when relaxing the query let hits match fewer terms than asked for.
+	Relaxed bool `json:"relaxed,omitempty"`
+}
+
+const DefaultFacetSize = 10
+
+// SearchRequest is what GET /search takes as parameters. A limit of 0 only asks
+// for the total (and facets) unless All is set, which returns every hit from the
+// offset on.
+type SearchRequest struct {
+	Query     string
+	Limit     int
+	Offset    int
+	All       bool
+	Facets    []string
+	FacetSize int
+	Explain   bool
+	Sort      []index.SortField // relevance if empty
+	Fields    []string          // of the documents in the hits, index.DefaultSource if nil
+	Match     search.MatchOptions
+	Collapse  string // a field to keep one hit per value of, see index.SearchOptions
+	Decay     *index.Decay
+	Diversify *index.Diversify
+	Vector    *index.VectorQuery // ranks the hits by nearness to it too
+	Highlight bool               // a snippet for every hit
+
+	// With SetACL, who's searching, see acl.go.
+	Principals []string
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	req, timeout, err := s.searchRequest(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Principals = s.principals(r)
+
+	// A client hanging up cancels the search too.
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	resp, err := s.SearchContext(ctx, req)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		http.Error(w, "search timed out", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// searchRequest reads the parameters of GET /search, and the timeout asked for or
+// the server's.
+func (s *Server) searchRequest(params url.Values) (SearchRequest, time.Duration, error) {
+	req := SearchRequest{Query: params.Get("q"), Limit: DefaultLimit, FacetSize: DefaultFacetSize}
+	if v := params.Get("knn"); v != "" {
+		q, err := index.ParseVectorQuery(v)
+		if err != nil {
+			return req, 0, errors.New("bad knn parameter: " + err.Error())
+		}
+		if v := params.Get("knn_k"); v != "" {
+			if q.K, err = strconv.Atoi(v); err != nil || q.K < 1 {
+				return req, 0, errors.New("bad knn_k parameter")
+			}
+		}
+		q.Exact = params.Get("knn_exact") != ""
+		req.Vector = &q
+	}
+	if req.Query == "" && req.Vector == nil {
+		return req, 0, errors.New("missing q parameter")
+	}
+
+	for _, param := range []struct {
+		name string
+		v    *int
+	}{{"limit", &req.Limit}, {"offset", &req.Offset}, {"facet_size", &req.FacetSize}} {
+		if v := params.Get(param.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return req, 0, errors.New("bad " + param.name + " parameter")
+			}
+			*param.v = n
+		}
+	}
+	if v := params.Get("facets"); v != "" {
+		req.Facets = strings.Split(v, ",")
+	}
+	req.Explain = params.Get("explain") != ""
+	req.Highlight = params.Get("highlight") != ""
+	req.Collapse = params.Get("collapse")
+	if v := params.Get("decay"); v != "" {
+		d, err := index.ParseDecay(v)
+		if err != nil {
+			return req, 0, errors.New("bad decay parameter: " + err.Error())
+		}
+		req.Decay = &d
+	}
+	if v := params.Get("diversify"); v != "" {
+		d, err := index.ParseDiversify(v)
+		if err != nil {
+			return req, 0, errors.New("bad diversify parameter: " + err.Error())
+		}
+		req.Diversify = &d
+	}
+	req.Match.MinimumShouldMatch = params.Get("minimum_should_match")
+	req.Match.Relax = params.Get("relax") != ""
+	if v := params.Get("fields"); v != "" {
+		req.Fields = strings.Split(v, ",")
+	}
+	if v := params.Get("sort"); v != "" {
+		var err error
+		if req.Sort, err = index.ParseSort(v); err != nil {
+			return req, 0, errors.New("bad sort parameter: " + err.Error())
+		}
+	}
+	timeout := s.searchTimeout
+	if v := params.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return req, 0, errors.New("bad timeout parameter")
+		}
+		timeout = d
+	}
+	return req, timeout, nil
+}
+
+// Search runs a query the way GET /search does. The error is one of the query.
+func (s *Server) Search(req SearchRequest) (SearchResponse, error) {
+	return s.SearchContext(context.Background(), req)
+}
+
+// SearchContext is Search giving up once ctx is done. If that happens while
+// the query is matched the error is ctx's; if it happens while the matches are
+// ranked the response has the hits ranked so far and TimedOut set. Either way it
+// isn't cached.
+func (s *Server) SearchContext(ctx context.Context, req SearchRequest) (SearchResponse, error) {
+	start := time.Now()
+	resp, err := s.search(ctx, req)
+	s.metrics.search(start, err)
+	s.logSearch(req, resp, err, time.Since(start))
+	if s.queryLog != nil && err == nil && req.Offset == 0 {
+		s.queryLog.Record(req.Query, resp.Total)
+	}
+	return resp, err
+}
+
+func (s *Server) search(ctx context.Context, req SearchRequest) (SearchResponse, error) {
+	idx, done := s.idx.Read()
+	defer done()
+
+	start := time.Now()
+	if err := idx.CheckSort(req.Sort); err != nil {
+		return SearchResponse{}, err
+	}
+	if err := idx.CheckCollapse(req.Collapse); err != nil {
+		return SearchResponse{}, err
+	}
+	if err := idx.CheckDecay(req.Decay); err != nil {
+		return SearchResponse{}, err
+	}
+	if err := idx.CheckDiversify(req.Diversify); err != nil {
+		return SearchResponse{}, err
+	}
+	if err := idx.CheckVector(req.Vector); err != nil {
+		return SearchResponse{}, err
+	}
+	fields := req.Fields
+	if fields == nil {
+		fields = index.DefaultSource
+	}
+	if err := idx.CheckSource(fields); err != nil {
+		return SearchResponse{}, err
+	}
+	var key string
+	if s.cache != nil {
+		var q string
+		if req.Query != "" {
+			var err error
+			if q, err = search.CacheKey(idx, req.Query); err != nil {
+				return SearchResponse{}, err
+			}
+		}
+		key = req.cacheKey(q)
+		if resp, ok := s.cache.get(key); ok {
+			resp.Query, resp.Took = req.Query, time.Since(start).String()
+			return resp, nil
+		}
+	}
+
+	// Without a query every document is a hit, ranked by its vector alone.
+	ids, terms, relaxed := idx.AllIDs(), index.Scoring{}, false
+	if req.Query != "" {
+		var err error
+		if ids, terms, relaxed, err = search.EvaluateMatch(ctx, idx, req.Query, req.Match); err != nil {
+			return SearchResponse{}, err
+		}
+	}
+	if s.acl != nil {
+		ids = idx.Allowed(req.Principals).Filter(ids)
+	}
+
+	var results []index.Result
+	var rankErr error
+	if req.All {
+		results, rankErr = idx.RankPageContext(ctx, ids, terms, index.SearchOptions{Offset: req.Offset, Explain: req.Explain, Sort: req.Sort, Collapse: req.Collapse, Decay: req.Decay, Diversify: req.Diversify, Vector: req.Vector})
+	} else if req.Limit > 0 {
+		results, rankErr = idx.RankPageContext(ctx, ids, terms, index.SearchOptions{Limit: req.Limit, Offset: req.Offset, Explain: req.Explain, Sort: req.Sort, Collapse: req.Collapse, Decay: req.Decay, Diversify: req.Diversify, Vector: req.Vector})
+	}
+
+	var facets map[string][]index.FacetCount
+	if len(req.Facets) > 0 {
+		facets = idx.FieldFacets(ids, req.Facets, req.FacetSize)
+	}
+	took := time.Since(start)
+
+	resp := SearchResponse{Query: req.Query, Total: len(ids), Took: took.String(), Hits: []Hit{}, Facets: facets, TimedOut: rankErr != nil, Relaxed: relaxed}
+	if len(ids) == 0 && s.acl == nil && req.Query != "" {
+		resp.DidYouMean, _ = search.DidYouMean(idx, req.Query)
+	}
+	var h *highlighter
+	if req.Highlight && req.Query != "" {
+		h = newHighlighter(idx, req.Query)
+	}
+	for _, res := range results {
+		hit := s.hit(res, fields)
+		hit.Distance = distance(idx, req.Sort, res.ID)
+		if h != nil {
+			doc, _ := s.docs.Get(res.ID)
+			hit.Snippet = h.snippet(idx, res.ID, doc.Text)
+		}
+		resp.Hits = append(resp.Hits, hit)
+	}
+	if s.cache != nil && !resp.TimedOut {
+		s.cache.put(key, resp)
+	}
+	return resp, nil
+}
+
+// hit fills in fields of the result's document. The caller must hold the index
+// lock.
+func (s *Server) hit(res index.Result, fields []string) Hit {
+	hit := Hit{ID: res.ID, Score: res.Score, Collapsed: res.Collapsed, Explanation: res.Explanation}
+	if index.NeedsSource(fields) {
+		doc, _ := s.docs.Get(res.ID)
+		doc = doc.Select(fields)
+		hit.Title, hit.URL, hit.Text, hit.Language = doc.Title, doc.URL, doc.Text, doc.Language
+		hit.Keywords, hit.Numbers, hit.Geo, hit.Nested = doc.Keywords, doc.Numbers, doc.Geo, doc.Nested
+	}
+	return hit
+}
+
+// distance is how far document id is from the point of the first geo sort
+// field, nil without one.
+func distance(idx *index.Index, sort []index.SortField, id int) *float64 {
+	for _, f := range sort {
+		if f.Near == nil {
+			continue
+		}
+		if p, ok := idx.GeoPoint(f.Field, id); ok {
+			d := index.Distance(*f.Near, p)
+			return &d
+		}
+		return nil
+	}
+	return nil
+}
+
+func decodeDocument(w http.ResponseWriter, r *http.Request) (index.Document, bool) {
+	var doc index.Document
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		http.Error(w, "bad document: "+err.Error(), http.StatusBadRequest)
+		return doc, false
+	}
+	if doc.Text == "" && doc.Title == "" {
+		http.Error(w, "document has no title or text", http.StatusBadRequest)
+		return doc, false
+	}
+	if doc.Boost == 0 {
+		doc.Boost = index.DefaultBoost
+	}
+	return doc, true
+}
+
+const defaultCompletions = 10
+
+func (s *Server) handleComplete(w http.ResponseWriter, r *http.Request) {
+	n := defaultCompletions
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 0 {
+			http.Error(w, "bad n parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	titles := r.URL.Query().Get("titles") != ""
+	if r.URL.Query().Get("queries") != "" {
+		if s.queryLog == nil {
+			http.Error(w, "queries aren't logged", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, append([]string{}, s.queryLog.SuggestQueries(r.URL.Query().Get("q"), n)...))
+		return
+	}
+
+	idx, done := s.idx.Read()
+	defer done()
+
+	completions := append([]string{}, s.completionIndex(idx, titles).Complete(r.URL.Query().Get("q"), n)...)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(completions)
+}
+
+// completionIndex returns the trie over terms or titles, building it if needed.
+// The caller must hold the index lock.
+func (s *Server) completionIndex(idx *index.Index, titles bool) *search.CompletionIndex {
+	s.compMu.Lock()
+	defer s.compMu.Unlock()
+
+	if ci, ok := s.completions[titles]; ok {
+		return ci
+	}
+
+	var phrases []search.WeightedPhrase
+	if titles {
+		var docs []index.Document
+		for id := 0; id < s.docs.Len(); id++ {
+			if !idx.Has(id) {
+				continue
+			}
+			if doc, err := s.docs.Get(id); err == nil {
+				docs = append(docs, doc)
+			}
+		}
+		phrases = search.TitlePhrases(docs)
+	} else {
+		phrases = search.TermPhrases(idx)
+	}
+
+	if s.completions == nil {
+		s.completions = make(map[bool]*search.CompletionIndex)
+	}
+	s.completions[titles] = search.BuildCompletionIndex(phrases)
+	return s.completions[titles]
+}
+
+// changed drops what was derived from the documents. The caller must hold the
+// index lock for writing, and commit the index if it's kept in a storage (see
+// index.Storage) once it's done.
+func (s *Server) changed() {
+	s.unsaved.Store(true)
+
+	s.compMu.Lock()
+	s.completions = nil
+	s.compMu.Unlock()
+
+	if s.cache != nil {
+		s.cache.clear()
+	}
+}
+
+// pathID reads {id} from the path.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "bad document id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// has reports whether a live document has this ID. The caller must hold the index
+// lock.
+func (s *Server) has(idx *index.Index, id int) bool {
+	return id >= 0 && id < s.docs.Len() && idx.Has(id)
+}
+
+// Changing documents
+// These are what the handlers below use, exported so documents can also be fed
+// in from elsewhere while the server runs, like a watched directory.
+
+// Add stores and indexes doc as a new document and returns the ID it was given.
+func (s *Server) Add(doc index.Document) (int, error) {
+	if err := s.writable(); err != nil {
+		return 0, err
+	}
+	if s.refreshInterval > 0 {
+		s.pendMu.Lock()
+		defer s.pendMu.Unlock()
+		if err := s.checkMemory(); err != nil {
+			return 0, err
+		}
+		start := time.Now()
+		doc = s.prepare(doc)
+		doc.ID = s.nextID()
+		if err := s.queue(wal.Entry{Op: index.BulkAdd, ID: doc.ID, Document: &doc}); err != nil {
+			return 0, err
+		}
+		s.metrics.wrote(start)
+		s.logChange(index.BulkAdd, doc.ID, true)
+		s.percolateQueued(doc)
+		return doc.ID, nil
+	}
+
+	idx, done := s.idx.Write()
+	defer done()
+
+	if err := s.checkMemoryOf(idx); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	doc = s.prepare(doc)
+	doc.ID = s.docs.Len()
+	if err := s.logChanges(wal.Entry{Op: index.BulkAdd, ID: doc.ID, Document: &doc}); err != nil {
+		return 0, err
+	}
+	if err := s.docs.Put(doc); err != nil {
+		return 0, err
+	}
+	if err := idx.Add([]index.Document{doc}); err != nil {
+		return 0, err
+	}
+	s.changed()
+	if err := idx.Commit(); err != nil {
+		return 0, err
+	}
+	s.metrics.changed(index.BulkAdd, 1)
+	s.metrics.wrote(start)
+	s.logChange(index.BulkAdd, doc.ID, false)
+	s.percolate(idx, doc)
+	return doc.ID, nil
+}
+
+// DocumentURLs returns the IDs of the indexed documents by URL, leaving out those
+// without one.
+func (s *Server) DocumentURLs() (map[string]int, error) {
+	idx, done := s.idx.Read()
+	defer done()
+
+	urls := make(map[string]int)
+	for _, id := range idx.AllIDs() {
+		doc, err := s.docs.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if doc.URL != "" {
+			urls[doc.URL] = id
+		}
+	}
+	return urls, nil
+}
+
+// Update replaces the document with doc's ID and re-indexes it.
+func (s *Server) Update(doc index.Document) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	if s.refreshInterval > 0 {
+		s.pendMu.Lock()
+		defer s.pendMu.Unlock()
+		if !s.queuedHas(doc.ID) {
+			return index.ErrNoDocument
+		}
+		if err := s.checkMemory(); err != nil {
+			return err
+		}
+		start := time.Now()
+		doc = s.prepare(doc)
+		if err := s.queue(wal.Entry{Op: index.BulkUpdate, ID: doc.ID, Document: &doc}); err != nil {
+			return err
+		}
+		s.metrics.wrote(start)
+		s.logChange(index.BulkUpdate, doc.ID, true)
+		s.percolateQueued(doc)
+		return nil
+	}
+
+	idx, done := s.idx.Write()
+	defer done()
+
+	if !s.has(idx, doc.ID) {
+		return index.ErrNoDocument
+	}
+	if err := s.checkMemoryOf(idx); err != nil {
+		return err
+	}
+	start := time.Now()
+	doc = s.prepare(doc)
+	if err := s.logChanges(wal.Entry{Op: index.BulkUpdate, ID: doc.ID, Document: &doc}); err != nil {
+		return err
+	}
+	if err := s.docs.Put(doc); err != nil {
+		return err
+	}
+	if err := idx.Update(doc); err != nil {
+		return err
+	}
+	s.changed()
+	if err := idx.Commit(); err != nil {
+		return err
+	}
+	s.metrics.changed(index.BulkUpdate, 1)
+	s.metrics.wrote(start)
+	s.logChange(index.BulkUpdate, doc.ID, false)
+	s.percolate(idx, doc)
+	return nil
+}
+
+func (s *Server) Delete(id int) error {
+	if err := s.writable(); err != nil {
+		return err
+	}
+	if s.refreshInterval > 0 {
+		s.pendMu.Lock()
+		defer s.pendMu.Unlock()
+		if !s.queuedHas(id) {
+			return index.ErrNoDocument
+		}
+		start := time.Now()
+		if err := s.queue(wal.Entry{Op: index.BulkDelete, ID: id}); err != nil {
+			return err
+		}
+		s.metrics.wrote(start)
+		s.logChange(index.BulkDelete, id, true)
+		return nil
+	}
+
+	idx, done := s.idx.Write()
+	defer done()
+
+	if !s.has(idx, id) {
+		return index.ErrNoDocument
+	}
+	start := time.Now()
+	if err := s.logChanges(wal.Entry{Op: index.BulkDelete, ID: id}); err != nil {
+		return err
+	}
+	idx.Delete(id)
+	s.changed()
+	if err := idx.Commit(); err != nil {
+		return err
+	}
+	s.metrics.changed(index.BulkDelete, 1)
+	s.metrics.wrote(start)
+	s.logChange(index.BulkDelete, id, false)
+	return s.docs.Delete(id)
+}
+
+func (s *Server) handleAddDocument(w http.ResponseWriter, r *http.Request) {
+	doc, ok := decodeDocument(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := s.Add(doc)
+	if err != nil {
+		changeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, struct {
+		ID int `json:"id"`
+	}{id})
+}
+
+func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if doc, ok := s.queued(id); ok {
+		if doc == nil || (s.acl != nil && !doc.Allows(s.acl(r))) {
+			http.Error(w, "document not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, doc)
+		return
+	}
+
+	idx, done := s.idx.Read()
+	defer done()
+
+	doc, err := s.docs.Get(id)
+	if !s.has(idx, id) || !s.visible(r, idx, id) || err != nil {
+		http.Error(w, "document not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+func (s *Server) handleTermVector(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	idx, done := s.idx.Read()
+	defer done()
+
+	terms, err := idx.TermVector(id)
+	if err != nil || !s.visible(r, idx, id) {
+		http.Error(w, "document not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		ID    int                     `json:"id"`
+		Terms []index.TermVectorEntry `json:"terms"`
+	}{id, terms})
+}
+
+func (s *Server) handleUpdateDocument(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	doc, ok := decodeDocument(w, r)
+	if !ok {
+		return
+	}
+
+	doc.ID = id
+	if err := s.Update(doc); err != nil {
+		changeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.Delete(id); err != nil {
+		changeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changeError answers a change that failed with err: 404 for a document that
+// isn't there, 403 for a read-only index, 503 for an index at its memory limit,
+// 500 for the rest.
+func changeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, index.ErrNoDocument):
+		http.Error(w, "document not found", http.StatusNotFound)
+	case errors.Is(err, index.ErrReadOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, index.ErrMemoryLimit):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writable is Writable of the index: a mapped one refuses every change.
+func (s *Server) writable() error {
+	idx, done := s.idx.Read()
+	defer done()
+	return idx.Writable()
+}
+
+// checkMemory is checkMemoryOf the index.
+func (s *Server) checkMemory() error {
+	idx, done := s.idx.Read()
+	defer done()
+	return s.checkMemoryOf(idx)
+}
+
+// checkMemoryOf is CheckMemory of idx with the documents the store keeps in
+// memory counted against the limit too. The caller must hold the index lock.
+func (s *Server) checkMemoryOf(idx *index.Index) error {
+	return idx.CheckMemoryWith(store.MemoryBytes(s.docs))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/store"
+)
+
+func TestReadOnlyIndex(t *testing.T) {
+	docs := []index.Document{{ID: 0, Title: "Cat", Text: "a wild cat"}}
+	idx := index.New(nil)
+	if err := idx.Add(docs); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "index.ftsd")
+	if err := idx.SaveDisk(path); err != nil {
+		t.Fatal(err)
+	}
+	mapped, err := index.OpenDisk(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+	srv := New(mapped, store.NewMemory(docs))
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		in                 string // in the response
+	}{
+		{"POST", "/documents", `{"title":"Fox","text":"a fox"}`, http.StatusForbidden, "read-only"},
+		{"PUT", "/documents/0", `{"title":"Cat","text":"a tame cat"}`, http.StatusForbidden, "read-only"},
+		{"DELETE", "/documents/0", "", http.StatusForbidden, "read-only"},
+		{"POST", "/bulk", `{"op":"add","document":{"text":"a fox"}}` + "\n", http.StatusOK, "read-only"},
+		{"GET", "/search?q=cat", "", http.StatusOK, `"total":1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.in) {
+				t.Errorf("response %s doesn't contain %s", rec.Body, tt.in)
+			}
+		})
+	}
+}
+
+func TestMemoryLimitCountsStore(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored string // text of the stored document
+		status int
+	}{
+		{"small store", "a wild cat", http.StatusCreated},
+		{"large store", strings.Repeat("a wild cat ", 1000), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := index.New(nil)
+			if err := idx.Add([]index.Document{{ID: 0, Text: "a wild cat"}}); err != nil {
+				t.Fatal(err)
+			}
+			// Room for the index and a little more, not for the stored text.
+			idx.SetMemoryLimit(idx.MemoryUsage().Index() + 2000)
+			srv := New(idx, store.NewMemory([]index.Document{{ID: 0, Text: tt.stored}}))
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest("POST", "/documents", strings.NewReader(`{"text":"a fox"}`)))
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Shutting down
+// A rolling deploy stops one server after the other, and none of them should
+// fail a request or lose a change on the way out. ListenAndServe serves until the
+// process gets SIGTERM or SIGINT, then stops accepting connections, waits for
+// the requests running, searches, bulk requests and exports, to finish, and
+// once they have, or the deadline has passed and the rest were cut off, calls
+// flush to make the changes they made durable, for a Server its Flush. Streams
+// that don't end on their own, the alerts of GET /percolator/alerts, are ended
+// by Drain as soon as the shutdown starts. A second signal kills the process
+// the usual way.
+
+// DefaultShutdownTimeout is how long ListenAndServe waits for the requests
+// running, unless told otherwise.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ListenAndServe serves h on addr until SIGTERM or SIGINT and then shuts down
+// gracefully, waiting up to timeout for the requests running. If h has a Drain
+// method, like a Server or a Multi, it's called when the shutdown starts. flush,
+// if not nil, is called afterwards with a context that ends at the deadline; its
+// error is returned. It returns nil after a clean shutdown, and the error of the
+// listener if it couldn't serve.
+func ListenAndServe(addr string, h http.Handler, timeout time.Duration, flush func(ctx context.Context) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hs := &http.Server{Addr: addr, Handler: h}
+	if d, ok := h.(interface{ Drain() }); ok {
+		hs.RegisterOnShutdown(d.Drain)
+	}
+	served := make(chan error, 1)
+	go func() { served <- hs.ListenAndServe() }()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("shutting down", "timeout", timeout)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := hs.Shutdown(ctx); errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("cut off the requests still running at the shutdown deadline")
+		hs.Close()
+	} else if err != nil {
+		return err
+	}
+	if flush != nil {
+		if err := flush(ctx); err != nil {
+			return err
+		}
+	}
+	slog.Info("shut down", "took", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// Drain ends the streams that wouldn't end by themselves, the followers of the
+// alerts, so a shutdown doesn't wait for them. The server goes on serving
+// everything else.
+func (s *Server) Drain() {
+	s.drainOnce.Do(func() { close(s.draining) })
+}
+
+// Flush makes every change acknowledged so far durable: it applies the queued
+// ones and, for an index without a storage, which they're committed to already,
+// checkpoints to path if anything changed since the index was loaded or last
+// saved (see Checkpoint). With path "" the index isn't saved. The store is
+// synced either way.
+func (s *Server) Flush(path string) error {
+	if _, err := s.Refresh(); err != nil {
+		return err
+	}
+	idx, done := s.idx.Read()
+	stored := idx.Storage() != nil
+	done()
+	if !stored && path != "" && s.unsaved.Load() {
+		return s.Checkpoint(path)
+	}
+	return s.syncDocs()
+}
+
+// Drain drains every index of m.
+func (m *Multi) Drain() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, srv := range m.servers {
+		srv.Drain()
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Similar documents
+// GET /documents/{id}/similar runs index.MoreLikeThis on a document:
+//
+//	&limit=N&offset=M           the page of hits, DefaultLimit of them
+//	&terms=N                    the number of its terms to query with
+//	&min_term_freq=N&min_doc_freq=N  how often a term has to occur in it, and in
+//	                            how many documents
+//	&max_doc_freq=0.3           the fraction of documents a term may be in at most
+//	&from=title                 the fields to take the terms from
+//	&fields=title,text          the fields of the documents in the hits
+//	&explain=1                  plus the terms queried with
+type SimilarResponse struct {
+	ID    int      `json:"id"`
+	Terms []string `json:"terms,omitempty"` // dictionary keys, with explain
+	Total int      `json:"total"`
+	Took  string   `json:"took"`
+	Hits  []Hit    `json:"hits"`
+}
+
+func (s *Server) handleSimilar(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	opts := index.MoreLikeThisOptions{SearchOptions: index.SearchOptions{Limit: DefaultLimit}}
+	for _, param := range []struct {
+		name string
+		v    *int
+	}{{"limit", &opts.Limit}, {"offset", &opts.Offset}, {"terms", &opts.MaxTerms}, {"min_term_freq", &opts.MinTermFreq}, {"min_doc_freq", &opts.MinDocFreq}} {
+		if v := q.Get(param.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "bad "+param.name+" parameter", http.StatusBadRequest)
+				return
+			}
+			*param.v = n
+		}
+	}
+	if v := q.Get("max_doc_freq"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			http.Error(w, "bad max_doc_freq parameter", http.StatusBadRequest)
+			return
+		}
+		opts.MaxDocFreq = f
+	}
+	if v := q.Get("from"); v != "" {
+		opts.Fields = strings.Split(v, ",")
+	}
+	fields := index.DefaultSource
+	if v := q.Get("fields"); v != "" {
+		fields = strings.Split(v, ",")
+	}
+
+	idx, done := s.idx.Read()
+	defer done()
+
+	start := time.Now()
+	if err := idx.CheckSource(fields); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.has(idx, id) || !s.visible(r, idx, id) {
+		http.Error(w, "document not found", http.StatusNotFound)
+		return
+	}
+	if s.acl != nil {
+		opts.Filter = idx.Allowed(s.acl(r))
+	}
+	results, total, err := idx.MoreLikeThis(id, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := SimilarResponse{ID: id, Total: total, Hits: []Hit{}}
+	if q.Get("explain") != "" {
+		resp.Terms, _ = idx.MoreLikeThisTerms(id, opts)
+	}
+	for _, res := range results {
+		resp.Hits = append(resp.Hits, s.hit(res, fields))
+	}
+	resp.Took = time.Since(start).String()
+	writeJSON(w, http.StatusOK, resp)
+}
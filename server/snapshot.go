@@ -0,0 +1,268 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/store"
+)
+
+// Snapshots
+// A snapshot is a copy of the index and the documents as they were at one moment.
+// It's taken under the read lock, so searches go on while it's written and
+// changes wait until it's done. A snapshot is a directory with the saved index and
+// a store file (the layout fts index writes, so one can be served as it is), or
+// the two files in a gzipped tarball:
+//
+//	POST /snapshot   write a snapshot directory under the one set with SetSnapshotDir
+//	GET  /snapshot   download a snapshot as a tarball
+//
+// Restore puts the files of either kind back where a server expects them on
+// startup.
+const (
+	SnapshotIndexFile = "index.idx"
+	SnapshotStoreFile = "docs.store"
+)
+
+// SetSnapshotDir lets POST /snapshot write snapshots to dir, each in a directory
+// named after the time it was taken. Without it POST /snapshot is refused.
+func (s *Server) SetSnapshotDir(dir string) {
+	s.snapshotDir = dir
+}
+
+// Snapshot writes a snapshot to dir, creating it if needed.
+func (s *Server) Snapshot(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if _, err := s.Refresh(); err != nil {
+		return err
+	}
+
+	idx, done := s.idx.Read()
+	defer done()
+
+	if err := idx.Save(filepath.Join(dir, SnapshotIndexFile)); err != nil {
+		return err
+	}
+	storePath := filepath.Join(dir, SnapshotStoreFile)
+	if err := os.Remove(storePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := store.Open(storePath)
+	if err != nil {
+		return err
+	}
+	if err := store.Copy(f, s.docs); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SnapshotTar writes a snapshot to w as a gzipped tarball. The files are written
+// to a temporary directory first, since a tar header needs their sizes.
+func (s *Server) SnapshotTar(w io.Writer) error {
+	tmp, err := os.MkdirTemp("", "fts-snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := s.Snapshot(tmp); err != nil {
+		return err
+	}
+	return writeTar(w, tmp)
+}
+
+func writeTar(w io.Writer, dir string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{SnapshotIndexFile, SnapshotStoreFile} {
+		if err := addToTar(tw, filepath.Join(dir, name), name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func addToTar(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{Name: name, Mode: 0o644, Size: fi.Size(), ModTime: fi.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Restore copies the index and the store of a snapshot, a directory or a
+// tarball, to indexPath and storePath. Both are copied next to their targets
+// and synced before either is renamed over its target, the store first, so a
+// failed or incomplete copy leaves the old files as they were. Only a crash
+// between the two renames leaves the new store with the old index.
+func Restore(snapshot, indexPath, storePath string) error {
+	targets := map[string]string{SnapshotIndexFile: indexPath, SnapshotStoreFile: storePath}
+	staged := make(map[string]string) // the copies, by name in the snapshot
+	defer func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}()
+	stage := func(name string, r io.Reader) error {
+		tmp, err := stageFile(targets[name], r)
+		if err != nil {
+			return err
+		}
+		if old, ok := staged[name]; ok {
+			os.Remove(old)
+		}
+		staged[name] = tmp
+		return nil
+	}
+
+	fi, err := os.Stat(snapshot)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		for name := range targets {
+			f, err := os.Open(filepath.Join(snapshot, name))
+			if err != nil {
+				return err
+			}
+			err = stage(name, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	} else if err := stageTar(snapshot, targets, stage); err != nil {
+		return err
+	}
+
+	order := []string{SnapshotStoreFile, SnapshotIndexFile}
+	for _, name := range order {
+		if _, ok := staged[name]; !ok {
+			return fmt.Errorf("%s: no %s in snapshot", snapshot, name)
+		}
+	}
+	for _, name := range order {
+		if err := os.Rename(staged[name], targets[name]); err != nil {
+			return err
+		}
+		delete(staged, name)
+	}
+	if err := syncDir(filepath.Dir(storePath)); err != nil {
+		return err
+	}
+	if filepath.Dir(indexPath) != filepath.Dir(storePath) {
+		return syncDir(filepath.Dir(indexPath))
+	}
+	return nil
+}
+
+// stageTar stages the files of a gzipped tarball that are among targets.
+func stageTar(path string, targets map[string]string, stage func(string, io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := targets[hdr.Name]; !ok {
+			continue
+		}
+		if err := stage(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// stageFile copies r to a synced temporary file next to path and returns its
+// name.
+func stageFile(path string, r io.Reader) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".restore")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if s.snapshotDir == "" {
+		http.Error(w, "snapshots are off", http.StatusNotFound)
+		return
+	}
+
+	dir := filepath.Join(s.snapshotDir, "snapshot-"+time.Now().UTC().Format("20060102-150405.000"))
+	start := time.Now()
+	if err := s.Snapshot(dir); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, struct {
+		Path string `json:"path"`
+		Took string `json:"took"`
+	}{dir, time.Since(start).String()})
+}
+
+func (s *Server) handleSnapshotTar(w http.ResponseWriter, r *http.Request) {
+	tmp, err := os.MkdirTemp("", "fts-snapshot")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmp)
+	if err := s.Snapshot(tmp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="snapshot.tar.gz"`)
+	if err := writeTar(w, tmp); err != nil {
+		// The headers are out already, all that's left is to cut the body short.
+		panic(http.ErrAbortHandler)
+	}
+}
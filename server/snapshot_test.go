@@ -0,0 +1,59 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string // in the snapshot
+		restored bool
+	}{
+		{"whole snapshot", []string{SnapshotIndexFile, SnapshotStoreFile}, true},
+		{"no store", []string{SnapshotIndexFile}, false},
+		{"no index", []string{SnapshotStoreFile}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, dir := t.TempDir(), t.TempDir()
+			for _, name := range tt.files {
+				if err := os.WriteFile(filepath.Join(snapshot, name), []byte("new "+name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			targets := map[string]string{
+				SnapshotIndexFile: filepath.Join(dir, "index.idx"),
+				SnapshotStoreFile: filepath.Join(dir, "docs.store"),
+			}
+			for name, path := range targets {
+				if err := os.WriteFile(path, []byte("old "+name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := Restore(snapshot, targets[SnapshotIndexFile], targets[SnapshotStoreFile])
+			if (err == nil) != tt.restored {
+				t.Fatalf("err = %v, want restored %v", err, tt.restored)
+			}
+			want := "old "
+			if tt.restored {
+				want = "new "
+			}
+			for name, path := range targets {
+				b, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != want+name {
+					t.Errorf("%s holds %q, want %q", name, b, want+name)
+				}
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != len(targets) {
+				t.Errorf("%d files left in the directory, want just the %d restored", len(entries), len(targets))
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	_ "embed"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/search"
+)
+
+// Web UI
+// GET / is a page to search the index from in a browser, for someone who has
+// just built one and isn't going to write curl commands: a search box, the hits
+// with snippets of their text, the values of the keyword fields to narrow them
+// down by and links to the next pages. It's one HTML file with its script and
+// styles, embedded in the binary, that asks GET /search with &highlight=1 like
+// any other client; with SetAuth's Private set it can't search without a key.
+//
+//go:embed ui/index.html
+var uiPage []byte
+
+func handleUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
+
+// The snippets are HTML: the text is escaped and the matches marked with
+// markers no text has, so escaping doesn't take the <em> apart.
+const (
+	snippetPre  = "\x00\x01"
+	snippetPost = "\x01\x00"
+)
+
+type highlighter struct {
+	h     *search.Highlighter
+	terms []string
+}
+
+func newHighlighter(idx *index.Index, query string) *highlighter {
+	terms, _ := search.QueryTerms(idx, query, index.FieldText)
+	return &highlighter{h: &search.Highlighter{Analyzer: idx.FieldAnalyzer(index.FieldText), Pre: snippetPre, Post: snippetPost}, terms: terms}
+}
+
+func (h *highlighter) snippet(idx *index.Index, id int, text string) string {
+	var s string
+	if offsets, ok := idx.Offsets(id, index.FieldText, h.terms); ok {
+		s = h.h.SnippetOffsets(text, offsets)
+	} else {
+		s = h.h.Snippet(text, h.terms)
+	}
+	s = html.EscapeString(s)
+	return strings.NewReplacer(snippetPre, "<em>", snippetPost, "</em>").Replace(s)
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/store"
+	"github.com/leoashish/FullTextSearchApp/wal"
+)
+
+// Write-ahead log
+// Changes are made in memory and the index is only saved now and then, so a
+// crash loses the changes since. With a log set, every add, update and delete is
+// appended to it and synced before it's applied and acknowledged; a bulk request
+// makes one append. SetWAL replays what the log has over the index and the store,
+// which brings back whatever they were missing, and Checkpoint saves the index and
+// empties the log. Replaying an entry the index already has changes nothing, so
+// a crash during a checkpoint is harmless too.
+//
+// The log only covers the index: documents kept in memory are lost in a crash
+// anyway, so the log is for servers with a store file.
+
+// SetWAL replays l and then logs every change to it. It returns the number of
+// entries replayed. Call it before serving.
+func (s *Server) SetWAL(l *wal.Log) (int, error) {
+	idx, done := s.idx.Write()
+	defer done()
+
+	n := 0
+	err := l.Replay(func(e wal.Entry) error {
+		n++
+		return s.redo(idx, e)
+	})
+	if n > 0 {
+		s.changed()
+	}
+	s.wal = l
+	return n, err
+}
+
+// redo applies a logged change again. The caller must hold the write lock.
+func (s *Server) redo(idx *index.Index, e wal.Entry) error {
+	switch e.Op {
+	case index.BulkAdd, index.BulkUpdate:
+		if e.Document == nil {
+			return nil
+		}
+		doc := *e.Document
+		doc.ID = e.ID
+		if err := s.docs.Put(doc); err != nil {
+			return err
+		}
+		if idx.Has(doc.ID) {
+			return idx.Update(doc)
+		}
+		return idx.Add([]index.Document{doc})
+	case index.BulkDelete:
+		if idx.Has(e.ID) {
+			idx.Delete(e.ID)
+		}
+		if err := s.docs.Delete(e.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckpointEvery checkpoints to path every interval, when anything was logged
+// since the last time, until stop is closed. Errors go to fail.
+func (s *Server) CheckpointEvery(path string, interval time.Duration, stop <-chan struct{}, fail func(error)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if s.wal != nil && s.wal.Size() == 0 {
+				continue
+			}
+			if err := s.Checkpoint(path); err != nil {
+				fail(err)
+			}
+		}
+	}
+}
+
+// logChanges appends entries to the log, if there is one. The caller must hold
+// the write lock, or pendMu.
+func (s *Server) logChanges(entries ...wal.Entry) error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.wal.Append(entries...)
+}
+
+// Checkpoint saves the index to path and empties the log. The index is written
+// next to path, synced and renamed over it, and the rename synced too before the
+// log is emptied, so a crash, even of the machine, leaves either the old index
+// and the log or the new one. Changes wait until it's done, and the queued ones
+// are made first.
+func (s *Server) Checkpoint(path string) error {
+	s.pendMu.Lock()
+	defer s.pendMu.Unlock()
+	if _, err := s.refresh(); err != nil {
+		return err
+	}
+
+	idx, done := s.idx.Read()
+	defer done()
+
+	tmp := path + ".checkpoint"
+	if err := idx.Save(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	s.unsaved.Store(false)
+	if s.wal == nil {
+		return nil
+	}
+	// The documents the log is about have to be on disk as well.
+	if err := s.syncDocs(); err != nil {
+		return err
+	}
+	return s.wal.Truncate()
+}
+
+// syncDir syncs the directory dir, which makes the files renamed into it stay
+// renamed.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// syncDocs syncs the store to disk if it's a file.
+func (s *Server) syncDocs() error {
+	if f, ok := s.docs.(interface{ Sync() error }); ok {
+		return f.Sync()
+	}
+	return nil
+}
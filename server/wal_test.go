@@ -0,0 +1,71 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/store"
+	"github.com/leoashish/FullTextSearchApp/wal"
+)
+
+func TestCheckpoint(t *testing.T) {
+	tests := []struct {
+		name    string
+		refresh bool // queue the changes for a refresh first
+		texts   []string
+	}{
+		{"indexed at once", false, []string{"wild cat", "big cat"}},
+		{"queued", true, []string{"wild cat", "big cat", "house cat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "index.idx")
+			docs, err := store.Open(filepath.Join(dir, "docs.store"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer docs.Close()
+			l, err := wal.Open(filepath.Join(dir, "changes.wal"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+
+			srv := New(index.New(nil), docs)
+			if tt.refresh {
+				srv.SetRefreshInterval(1 << 62)
+			}
+			if _, err := srv.SetWAL(l); err != nil {
+				t.Fatal(err)
+			}
+			for _, text := range tt.texts {
+				if _, err := srv.Add(index.Document{Text: text}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if l.Size() == 0 {
+				t.Fatal("nothing was logged")
+			}
+
+			if err := srv.Checkpoint(path); err != nil {
+				t.Fatal(err)
+			}
+			if n := l.Size(); n != 0 {
+				t.Errorf("the log has %d bytes left after the checkpoint", n)
+			}
+			if _, err := os.Stat(path + ".checkpoint"); !os.IsNotExist(err) {
+				t.Errorf("the temporary file is still there: %v", err)
+			}
+			saved, err := index.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(saved.Search("cat")); got != len(tt.texts) {
+				t.Errorf("the saved index finds %d documents, want %d", got, len(tt.texts))
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Package sqlite reads the documents to index from a SQLite database, the rows
+// of a query mapped to fields like the columns of a CSV file (see
+// index.Loader.EachSQL):
+//
+//	docs, err := sqlite.Load("app.db", "SELECT name AS title, body AS text, tag FROM posts",
+//		index.Loader{Mapping: index.FieldMapping{Keywords: []string{"tag"}}})
+//
+// The database is opened read-only, so indexing it can't change what the
+// application sees, with a pure Go driver that needs no cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Open opens the database file at path read-only. Unlike SQLite itself it
+// doesn't create a file that isn't there.
+func Open(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	// A relative path in a URI would be taken for a host.
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	dsn := (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: "mode=ro"}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Load returns the documents of the rows of query in the database at path. If
+// the loader is lenient and some rows were bad, they come with an
+// index.ParseErrors.
+func Load(path, query string, l index.Loader) ([]index.Document, error) {
+	return LoadContext(context.Background(), path, query, l)
+}
+
+// LoadContext is Load giving up once ctx is done.
+func LoadContext(ctx context.Context, path, query string, l index.Loader) ([]index.Document, error) {
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return l.LoadSQL(ctx, db, query)
+}
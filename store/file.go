@@ -0,0 +1,173 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// File store
+// Documents are appended to one file as records
+//
+//	uvarint id, uvarint size, size bytes of JSON
+//
+// and a record with size 0 deletes the ID. A later record for an ID replaces the
+// earlier ones, so updates are appends too and the file only ever grows. Only the
+// offset and size of each ID's current record are kept in memory; Open rebuilds
+// them by reading the record headers, skipping the JSON. A record cut short by a
+// crash is dropped from the end of the file.
+type File struct {
+	mu  sync.RWMutex
+	f   *os.File
+	end int64
+	loc []location // by ID, size 0 if not stored
+}
+
+type location struct {
+	off  int64
+	size int64
+}
+
+// Open opens the store in path, creating it if needed.
+func Open(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &File{f: f}
+	if err := s.scan(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *File) scan() error {
+	r := bufio.NewReader(s.f)
+	for {
+		id, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		var size uint64
+		if err == nil {
+			size, err = binary.ReadUvarint(r)
+		}
+		headerEnd := s.end + int64(uvarintLen(id)+uvarintLen(size))
+		if err == nil {
+			_, err = r.Discard(int(size))
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return s.f.Truncate(s.end)
+		}
+		if err != nil {
+			return err
+		}
+
+		s.set(int(id), location{headerEnd, int64(size)})
+		s.end = headerEnd + int64(size)
+	}
+}
+
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+func (s *File) set(id int, loc location) {
+	for len(s.loc) <= id {
+		s.loc = append(s.loc, location{})
+	}
+	s.loc[id] = loc
+}
+
+func (s *File) Get(id int) (index.Document, error) {
+	s.mu.RLock()
+	var loc location
+	if id >= 0 && id < len(s.loc) {
+		loc = s.loc[id]
+	}
+	s.mu.RUnlock()
+
+	var doc index.Document
+	if loc.size == 0 {
+		return doc, ErrNotFound
+	}
+
+	buf := make([]byte, loc.size)
+	if _, err := s.f.ReadAt(buf, loc.off); err != nil {
+		return doc, err
+	}
+	err := json.Unmarshal(buf, &doc)
+	doc.ID = id
+	return doc, err
+}
+
+func (s *File) Put(doc index.Document) error {
+	if doc.ID < 0 {
+		return ErrNotFound
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return s.append(doc.ID, data)
+}
+
+func (s *File) Delete(id int) error {
+	s.mu.RLock()
+	stored := id >= 0 && id < len(s.loc) && s.loc[id].size > 0
+	s.mu.RUnlock()
+	if !stored {
+		return ErrNotFound
+	}
+	return s.append(id, nil)
+}
+
+func (s *File) append(id int, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := binary.AppendUvarint(nil, uint64(id))
+	record = binary.AppendUvarint(record, uint64(len(data)))
+	off := s.end + int64(len(record))
+	record = append(record, data...)
+
+	if _, err := s.f.WriteAt(record, s.end); err != nil {
+		return err
+	}
+	s.end += int64(len(record))
+	s.set(id, location{off, int64(len(data))})
+	return nil
+}
+
+func (s *File) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.loc)
+}
+
+// MemoryBytes is what s keeps in memory, the location of every record.
+func (s *File) MemoryBytes() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return cap(s.loc) * int(unsafe.Sizeof(location{}))
+}
+
+// Sync commits the file to disk.
+func (s *File) Sync() error {
+	return s.f.Sync()
+}
+
+func (s *File) Close() error {
+	return s.f.Close()
+}
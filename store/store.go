@@ -0,0 +1,136 @@
+// Package store keeps the documents behind an index so hits can be turned back
+// into titles and text, either in memory or in a file on disk.
+package store
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+var ErrNotFound = errors.New("document not stored")
+
+// Store maps document IDs to documents. Put replaces whatever was stored under
+// the document's ID.
+type Store interface {
+	Get(id int) (index.Document, error)
+	Put(doc index.Document) error
+	Delete(id int) error
+
+	// Len is one more than the highest ID ever stored, i.e. the next free ID.
+	Len() int
+}
+
+// Memory is a Store over a slice, for when the documents fit in memory anyway.
+// It isn't safe for concurrent writes.
+type Memory struct {
+	docs    []index.Document
+	deleted map[int]struct{}
+	bytes   int // docBytes of docs, kept up to date for MemoryBytes
+}
+
+// NewMemory stores docs under their positions in the slice, which it takes over.
+func NewMemory(docs []index.Document) *Memory {
+	m := &Memory{docs: docs, deleted: make(map[int]struct{})}
+	for _, doc := range docs {
+		m.bytes += docBytes(doc)
+	}
+	return m
+}
+
+func (m *Memory) Get(id int) (index.Document, error) {
+	if id < 0 || id >= len(m.docs) {
+		return index.Document{}, ErrNotFound
+	}
+	if _, ok := m.deleted[id]; ok {
+		return index.Document{}, ErrNotFound
+	}
+	return m.docs[id], nil
+}
+
+func (m *Memory) Put(doc index.Document) error {
+	if doc.ID < 0 {
+		return ErrNotFound
+	}
+	for len(m.docs) <= doc.ID {
+		m.docs = append(m.docs, index.Document{ID: len(m.docs)})
+		m.deleted[len(m.docs)-1] = struct{}{}
+	}
+	m.bytes += docBytes(doc) - docBytes(m.docs[doc.ID])
+	m.docs[doc.ID] = doc
+	delete(m.deleted, doc.ID)
+	return nil
+}
+
+func (m *Memory) Delete(id int) error {
+	if _, err := m.Get(id); err != nil {
+		return err
+	}
+	m.bytes -= docBytes(m.docs[id])
+	m.docs[id] = index.Document{ID: id}
+	m.deleted[id] = struct{}{}
+	return nil
+}
+
+func (m *Memory) Len() int {
+	return len(m.docs)
+}
+
+// MemoryBytes estimates the heap size of the documents in m. It doesn't go over
+// them, so a server can ask before every change.
+func (m *Memory) MemoryBytes() int {
+	// An ID and a map entry for every deleted one.
+	return cap(m.docs)*int(unsafe.Sizeof(index.Document{})) + len(m.deleted)*24 + m.bytes
+}
+
+// docBytes is what doc holds beyond the Document itself.
+func docBytes(doc index.Document) int {
+	n := len(doc.Title) + len(doc.URL) + len(doc.Text) + len(doc.Language)
+	for field, values := range doc.Keywords {
+		n += len(field)
+		for _, v := range values {
+			n += len(v)
+		}
+	}
+	n += (len(doc.Keywords) + len(doc.Numbers) + len(doc.Geo) + len(doc.Vectors)) * 48
+	for _, v := range doc.Vectors {
+		n += 4 * len(v)
+	}
+	return n
+}
+
+// MemoryBytes estimates what s keeps on the heap, 0 for a store that doesn't say.
+func MemoryBytes(s Store) int {
+	if m, ok := s.(interface{ MemoryBytes() int }); ok {
+		return m.MemoryBytes()
+	}
+	return 0
+}
+
+// Copy puts every document of src into dst under the same ID. IDs deleted at the
+// end of src are deleted in dst as well, so both have the same Len and new
+// documents get the same IDs in either.
+func Copy(dst, src Store) error {
+	n := src.Len()
+	for id := 0; id < n; id++ {
+		doc, err := src.Get(id)
+		if errors.Is(err, ErrNotFound) {
+			if id < n-1 {
+				continue
+			}
+			// Only a stored document can be deleted.
+			if err := dst.Put(index.Document{ID: id}); err != nil {
+				return err
+			}
+			return dst.Delete(id)
+		}
+		if err != nil {
+			return err
+		}
+		if err := dst.Put(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
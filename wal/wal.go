@@ -0,0 +1,163 @@
+// Package wal is a write-ahead log of document changes, so changes a server
+// acknowledged survive a crash that comes before the index is saved again.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Log
+// Every change is appended to the log and synced to disk before it's applied,
+// as a record
+//
+//	uvarint size, 4 bytes CRC-32 of the JSON (Castagnoli, little endian), size bytes of JSON
+//
+// On startup the log is replayed over the index as it was last saved, and once
+// the index is saved with everything in the log the log is truncated (see
+// server.Checkpoint). A record cut short, or whose checksum doesn't match, is
+// where a crash interrupted a write that was never acknowledged; Open drops it
+// and everything after it.
+type Log struct {
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// An Entry is one change: the document of an add or update, the ID of a delete.
+type Entry struct {
+	Op       index.BulkOp    `json:"op"`
+	ID       int             `json:"id"`
+	Document *index.Document `json:"document,omitempty"`
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// maxRecord guards against reading a garbage size as a huge allocation.
+const maxRecord = 256 << 20
+
+// Open opens the log in path, creating it if needed.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{f: f}
+	if err := l.scan(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// scan finds the end of the last complete record and cuts off the rest.
+func (l *Log) scan() error {
+	end, err := l.each(func(Entry) error { return nil })
+	if err != nil {
+		return err
+	}
+	l.size = end
+	return l.f.Truncate(end)
+}
+
+// each reads the records from the start and returns the end of the last good
+// one.
+func (l *Log) each(fn func(Entry) error) (int64, error) {
+	r := bufio.NewReader(io.NewSectionReader(l.f, 0, 1<<62))
+	var off int64
+	for {
+		size, err := binary.ReadUvarint(r)
+		if err != nil || size > maxRecord {
+			return off, nil
+		}
+		record := make([]byte, 4+size)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return off, nil
+		}
+		data := record[4:]
+		if binary.LittleEndian.Uint32(record) != crc32.Checksum(data, crcTable) {
+			return off, nil
+		}
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return off, fmt.Errorf("wal record at %d: %v", off, err)
+		}
+		if err := fn(e); err != nil {
+			return off, err
+		}
+		off += int64(uvarintLen(size)) + int64(len(record))
+	}
+}
+
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+// Replay hands every entry to fn, oldest first. It stops at an error of fn.
+func (l *Log) Replay(fn func(Entry) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.each(fn)
+	return err
+}
+
+// Append writes entries and syncs the file once for all of them. Once it returns
+// without an error the entries survive a crash.
+func (l *Log) Append(entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var buf []byte
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(data)))
+		buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(data, crcTable))
+		buf = append(buf, data...)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.WriteAt(buf, l.size); err != nil {
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+	l.size += int64(len(buf))
+	return nil
+}
+
+// Truncate empties the log, once what's in it is safe elsewhere.
+func (l *Log) Truncate() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.f.Truncate(0); err != nil {
+		return err
+	}
+	l.size = 0
+	return l.f.Sync()
+}
+
+// Size is the length of the log in bytes.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+func (l *Log) Close() error {
+	return l.f.Close()
+}
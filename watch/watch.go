@@ -0,0 +1,231 @@
+// Package watch keeps an index in sync with a directory of text and JSON files:
+// new files are indexed, changed ones re-indexed and deleted ones removed.
+package watch
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/leoashish/FullTextSearchApp/index"
+)
+
+// Target is where the documents go; server.Server is one.
+type Target interface {
+	Add(doc index.Document) (int, error)
+	Update(doc index.Document) error
+	Delete(id int) error
+}
+
+// Indexed is a Target that can tell which documents it has already, their IDs by
+// URL; server.Server is one. A Watcher updates those of the files it finds rather
+// than adding them again, so a restart doesn't index the directory twice, and
+// deletes those of the files that went away in the meantime.
+type Indexed interface {
+	Target
+	DocumentURLs() (map[string]int, error)
+}
+
+// Watching
+// Every file becomes one document. A .txt or .md file is its own text with the
+// file name as title; a .json file holds a document object (title, url, text,
+// boost). The URL is the path unless the JSON sets one. Other files are ignored.
+// Directories are watched recursively.
+//
+// Editors tend to save a file in several writes, so events are collected until
+// the directory has been quiet for settle and each touched path is looked at once.
+const settle = 200 * time.Millisecond
+
+type Watcher struct {
+	target  Target
+	fsw     *fsnotify.Watcher
+	mu      sync.Mutex
+	ids     map[string]int // path -> document ID
+	indexed map[string]int // URL -> ID of the documents of an Indexed target not seen yet
+	pending map[string]struct{}
+}
+
+func New(target Target) (*Watcher, error) {
+	indexed := make(map[string]int)
+	if t, ok := target.(Indexed); ok {
+		urls, err := t.DocumentURLs()
+		if err != nil {
+			return nil, err
+		}
+		indexed = urls
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{target: target, fsw: fsw, ids: make(map[string]int), indexed: indexed, pending: make(map[string]struct{})}, nil
+}
+
+// Add watches dir and everything below it, indexing the files already there.
+// Documents of the target whose URL is the path of a file below dir that isn't
+// there anymore are deleted.
+func (w *Watcher) Add(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.fsw.Add(path)
+		}
+		w.sync(path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	for url, id := range w.indexed {
+		if strings.HasPrefix(url, prefix) {
+			w.target.Delete(id)
+			delete(w.indexed, url)
+		}
+	}
+	return nil
+}
+
+// Run handles events until Close is called.
+func (w *Watcher) Run() {
+	timer := time.NewTimer(settle)
+	timer.Stop()
+
+	for {
+		select {
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.mu.Lock()
+			w.pending[ev.Name] = struct{}{}
+			w.mu.Unlock()
+			timer.Reset(settle)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			slog.Error("watch", "error", err)
+		case <-timer.C:
+			w.mu.Lock()
+			paths := make([]string, 0, len(w.pending))
+			for path := range w.pending {
+				paths = append(paths, path)
+			}
+			clear(w.pending)
+			w.mu.Unlock()
+
+			for _, path := range paths {
+				w.sync(path)
+			}
+		}
+	}
+}
+
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
+
+// sync brings the document for path up to date with the file system.
+func (w *Watcher) sync(path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		// Gone, or renamed away: either way the old document has to go. A directory
+		// that went away takes its files with it.
+		w.remove(path)
+		return
+	}
+	if info.IsDir() {
+		if err := w.Add(path); err != nil {
+			slog.Error("watch", "error", err)
+		}
+		return
+	}
+
+	doc, ok, err := readDocument(path)
+	if err != nil {
+		slog.Error("watch", "path", path, "error", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id, ok := w.ids[path]
+	if !ok {
+		if id, ok = w.indexed[doc.URL]; ok {
+			delete(w.indexed, doc.URL)
+		}
+	}
+	if ok {
+		doc.ID = id
+		if w.target.Update(doc) == nil {
+			return
+		}
+	}
+	id, err = w.target.Add(doc)
+	if err != nil {
+		slog.Error("watch", "path", path, "error", err)
+		return
+	}
+	w.ids[path] = id
+}
+
+func (w *Watcher) remove(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	prefix := path + string(filepath.Separator)
+	for p, id := range w.ids {
+		if p == path || strings.HasPrefix(p, prefix) {
+			w.target.Delete(id)
+			delete(w.ids, p)
+		}
+	}
+}
+
+// readDocument reads the document in path; ok is false for files we don't index.
+func readDocument(path string) (doc index.Document, ok bool, err error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".txt" && ext != ".md" && ext != ".json" {
+		return doc, false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return doc, false, err
+	}
+
+	if ext == ".json" {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return doc, false, err
+		}
+	} else {
+		doc.Text = string(data)
+	}
+
+	if doc.Title == "" {
+		doc.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if doc.URL == "" {
+		doc.URL = path
+	}
+	if doc.Boost == 0 {
+		doc.Boost = index.DefaultBoost
+	}
+	return doc, true, nil
+}
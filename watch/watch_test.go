@@ -0,0 +1,90 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/leoashish/FullTextSearchApp/index"
+	"github.com/leoashish/FullTextSearchApp/server"
+	"github.com/leoashish/FullTextSearchApp/store"
+)
+
+func TestRestart(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(dir string) error // while the watcher is down
+		total   int                    // documents after the restart
+		query   string
+		matches int
+	}{
+		{
+			name:    "nothing changed",
+			change:  func(string) error { return nil },
+			total:   2,
+			query:   "cat",
+			matches: 1,
+		},
+		{
+			name:    "file changed",
+			change:  func(dir string) error { return os.WriteFile(filepath.Join(dir, "cat.txt"), []byte("a tiger"), 0o644) },
+			total:   2,
+			query:   "tiger",
+			matches: 1,
+		},
+		{
+			name:    "file added",
+			change:  func(dir string) error { return os.WriteFile(filepath.Join(dir, "fox.txt"), []byte("a fox"), 0o644) },
+			total:   3,
+			query:   "fox",
+			matches: 1,
+		},
+		{
+			name:    "file deleted",
+			change:  func(dir string) error { return os.Remove(filepath.Join(dir, "cat.txt")) },
+			total:   1,
+			query:   "cat",
+			matches: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, text := range map[string]string{"cat.txt": "a cat", "dog.txt": "a dog"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			srv := server.New(index.New(nil), store.NewMemory(nil))
+			watchOnce(t, srv, dir)
+			if err := tt.change(dir); err != nil {
+				t.Fatal(err)
+			}
+			watchOnce(t, srv, dir)
+
+			if n := srv.Stats().Documents; n != tt.total {
+				t.Errorf("%d documents, want %d", n, tt.total)
+			}
+			resp, err := srv.Search(server.SearchRequest{Query: tt.query, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Total != tt.matches {
+				t.Errorf("%q matches %d documents, want %d", tt.query, resp.Total, tt.matches)
+			}
+		})
+	}
+}
+
+// watchOnce indexes dir into srv the way a new Watcher does on startup.
+func watchOnce(t *testing.T, srv *server.Server, dir string) {
+	t.Helper()
+	w, err := New(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+}